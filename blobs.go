@@ -113,6 +113,31 @@ type BlobEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error
 }
 
+// ResumableBlobEnumerator enables iterating over blobs from storage in
+// order, resuming an interrupted iteration.
+type ResumableBlobEnumerator interface {
+	// EnumerateFrom calls ingester for each blob after marker, or for each
+	// blob if marker is empty. It returns the marker of the last blob
+	// ingested, from which an interrupted iteration resumes.
+	EnumerateFrom(ctx context.Context, marker string, ingester func(dgst digest.Digest) error) (string, error)
+}
+
+// BlobInfo describes a blob as listed by the storage.
+type BlobInfo struct {
+	Digest  digest.Digest
+	Size    int64
+	ModTime time.Time
+}
+
+// DetailedBlobEnumerator enables iterating over blobs from storage along
+// with their size and modification time, taken from the listing of the
+// storage rather than from a Stat of each blob.
+type DetailedBlobEnumerator interface {
+	// EnumerateDetailed calls ingester for each blob after marker, or for
+	// each blob if marker is empty, as EnumerateFrom does.
+	EnumerateDetailed(ctx context.Context, marker string, ingester func(info BlobInfo) error) (string, error)
+}
+
 // BlobDescriptorService manages metadata about a blob by digest. Most
 // implementations will not expose such an interface explicitly. Such mappings
 // should be maintained by interacting with the BlobIngester. Hence, this is
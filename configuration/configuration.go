@@ -89,6 +89,12 @@ type Configuration struct {
 		// receives a stop signal
 		DrainTimeout time.Duration `yaml:"draintimeout,omitempty"`
 
+		// ErrorDocs is the base of the URLs documenting the error codes,
+		// included in error response bodies. The URL of an error code is the
+		// base followed by the lowercased code, such as
+		// https://docs.example.com/errors#manifest_invalid.
+		ErrorDocs string `yaml:"errordocs,omitempty"`
+
 		// TLS instructs the http server to listen with a TLS configuration.
 		// This only support simple tls configuration with a cert and key.
 		// Mostly, this is useful for testing situations or simple deployments
@@ -149,6 +155,12 @@ type Configuration struct {
 				Enabled bool   `yaml:"enabled,omitempty"`
 				Path    string `yaml:"path,omitempty"`
 			} `yaml:"prometheus,omitempty"`
+			// Watchdog logs the requests which run for longer than
+			// Threshold, with the storage operation they are waiting
+			// for and the stacks of the goroutines.
+			Watchdog struct {
+				Threshold time.Duration `yaml:"threshold,omitempty"`
+			} `yaml:"watchdog,omitempty"`
 		} `yaml:"debug,omitempty"`
 
 		// HTTP2 configuration options
@@ -232,6 +244,13 @@ type Configuration struct {
 				// that URLs in pushed manifests must not match.
 				Deny []string `yaml:"deny,omitempty"`
 			} `yaml:"urls,omitempty"`
+			// Artifacts restricts the artifact classes of pushed manifests.
+			Artifacts struct {
+				// Allow lists the only artifact classes accepted, if set.
+				Allow []string `yaml:"allow,omitempty"`
+				// Deny lists artifact classes which are refused.
+				Deny []string `yaml:"deny,omitempty"`
+			} `yaml:"artifacts,omitempty"`
 		} `yaml:"manifests,omitempty"`
 	} `yaml:"validation,omitempty"`
 
@@ -246,7 +265,503 @@ type Configuration struct {
 			// the class in authorized resources.
 			Classes []string `yaml:"classes"`
 		} `yaml:"repository,omitempty"`
+
+		// Freeze lists time windows during which destructive operations,
+		// such as API deletes and garbage collection, are refused.
+		Freeze []FreezeWindow `yaml:"freeze,omitempty"`
+
+		// Egress caps the bytes of blobs authenticated subjects may
+		// download.
+		Egress Egress `yaml:"egress,omitempty"`
+
+		// Bulkhead caps the requests served concurrently for each
+		// repository.
+		Bulkhead Bulkhead `yaml:"bulkhead,omitempty"`
+
+		// Network restricts the client addresses which may access
+		// repositories.
+		Network Network `yaml:"network,omitempty"`
+
+		// TagProtection restricts the clients which may create and move
+		// the tags matching patterns.
+		TagProtection []TagProtectionRule `yaml:"tagprotection,omitempty"`
+
+		// FIPS restricts digest and TLS algorithms to FIPS 140 approved
+		// ones.
+		FIPS bool `yaml:"fips,omitempty"`
+
+		// Warnings configures the warnings attached to successful
+		// responses, to notify clients of deprecations and policy changes.
+		Warnings Warnings `yaml:"warnings,omitempty"`
 	} `yaml:"policy,omitempty"`
+
+	// Usage configures the periodic export of per-namespace usage to a
+	// billing or chargeback endpoint.
+	Usage Usage `yaml:"usage,omitempty"`
+
+	// Fetch configures the extension endpoint through which clients have
+	// the registry fetch blobs from URLs.
+	Fetch Fetch `yaml:"fetch,omitempty"`
+
+	// Share configures the extension endpoint issuing share links, which
+	// allow unauthenticated pulls of a single manifest.
+	Share Share `yaml:"share,omitempty"`
+
+	// Referrers configures how the referrers of manifests are reported.
+	Referrers Referrers `yaml:"referrers,omitempty"`
+
+	// Replica configures the registry as a read-only replica serving the
+	// storage of another registry.
+	Replica Replica `yaml:"replica,omitempty"`
+
+	// Admin configures the administration endpoints of the registry.
+	Admin Admin `yaml:"admin,omitempty"`
+
+	// Peers lists peers hinted to clients as other sources of blobs.
+	Peers Peers `yaml:"peers,omitempty"`
+
+	// Notary proxies the content trust requests of Docker clients to a
+	// Notary server.
+	Notary Notary `yaml:"notary,omitempty"`
+
+	// Shadow mirrors a sample of read requests to another registry, to
+	// validate storage migrations and upgrades against live traffic.
+	Shadow Shadow `yaml:"shadow,omitempty"`
+
+	// Timeline configures the extension endpoint listing the recent events
+	// of repositories.
+	Timeline Timeline `yaml:"timeline,omitempty"`
+
+	// UploadMonitor tracks the uploads in progress in each repository, to
+	// detect stranded uploads before they fill the storage.
+	UploadMonitor UploadMonitor `yaml:"uploadmonitor,omitempty"`
+}
+
+// UploadMonitor configures the periodic scan of the uploads in progress,
+// which reports their count and age per repository in the metrics and alerts
+// an endpoint when thresholds are exceeded.
+type UploadMonitor struct {
+	// Enabled starts the periodic scan.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Interval is the time between two scans. It defaults to 10 minutes.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Alert configures the endpoint alerted of the repositories exceeding
+	// the thresholds.
+	Alert UploadAlert `yaml:"alert,omitempty"`
+}
+
+// UploadAlert configures the alerts of the upload monitor.
+type UploadAlert struct {
+	// URL is the endpoint alerts are posted to. Alerts are not sent if it
+	// is empty.
+	URL string `yaml:"url,omitempty"`
+
+	// Headers are added to each alert request.
+	Headers http.Header `yaml:"headers,omitempty"`
+
+	// Timeout bounds each alert request. It defaults to 30 seconds.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// MaxUploads is the number of uploads in progress a repository may
+	// hold. It is not checked if zero.
+	MaxUploads int `yaml:"maxuploads,omitempty"`
+
+	// MaxAge is how long an upload may stay in progress. It is not checked
+	// if zero.
+	MaxAge time.Duration `yaml:"maxage,omitempty"`
+}
+
+// Timeline configures the recording of the significant events of each
+// repository, such as pushes, deletions and tag moves, and the endpoint
+// listing them.
+type Timeline struct {
+	// Enabled records the events and enables the endpoint.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// MaxEvents is the number of events kept for each repository, the
+	// oldest being dropped first. It defaults to 1000.
+	MaxEvents int `yaml:"maxevents,omitempty"`
+}
+
+// Shadow configures the mirroring of read requests to a second registry,
+// whose responses are compared with those of the registry.
+type Shadow struct {
+	// URL is the base URL of the registry requests are mirrored to.
+	// Requests are not mirrored if it is empty.
+	URL string `yaml:"url,omitempty"`
+
+	// Headers are set on each mirrored request, replacing those of the
+	// original request. The credentials of clients are never mirrored, so
+	// this is where the credentials of the shadow registry go.
+	Headers http.Header `yaml:"headers,omitempty"`
+
+	// SampleRate is the fraction of read requests mirrored, between 0 and
+	// 1. It defaults to 0.1.
+	SampleRate float64 `yaml:"samplerate,omitempty"`
+
+	// MaxInFlight caps the mirrored requests in flight. Requests sampled
+	// beyond it are not mirrored. It defaults to 100.
+	MaxInFlight int `yaml:"maxinflight,omitempty"`
+
+	// Timeout bounds each mirrored request. It defaults to 30 seconds.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Notary configures the proxying of content trust requests to a Notary
+// server, so that clients use the registry host for content trust as well.
+type Notary struct {
+	// URL is the base URL of the Notary server. Content trust requests are
+	// refused if it is empty.
+	URL string `yaml:"url,omitempty"`
+}
+
+// Peers configures the peer hints of blob responses. Peers are other
+// sources of the blobs of the registry, such as the other nodes of a
+// cluster sharing its storage, or the agents of a peer-to-peer distribution
+// mesh, from which cluster-local clients may pull to offload the registry.
+type Peers struct {
+	// URLs are the base URLs of the peers, which serve blobs at the paths
+	// of the registry API. Hints are disabled if it is empty.
+	URLs []string `yaml:"urls,omitempty"`
+
+	// MaxHints bounds the number of peers hinted for a blob. It defaults
+	// to 3.
+	MaxHints int `yaml:"maxhints,omitempty"`
+
+	// MinSize is the size in bytes below which blobs are not worth
+	// hinting. All blobs are hinted if it is not set.
+	MinSize int64 `yaml:"minsize,omitempty"`
+}
+
+// Admin configures the administration endpoints, served under /v2/_admin/.
+// They require an access controller.
+type Admin struct {
+	// GC configures the endpoint running garbage collections.
+	GC AdminGC `yaml:"gc,omitempty"`
+
+	// Preheat configures the endpoint listing the blobs of images for
+	// peer-to-peer distribution systems.
+	Preheat AdminPreheat `yaml:"preheat,omitempty"`
+
+	// Config configures the endpoint reporting the effective configuration
+	// and features of the registry.
+	Config AdminConfig `yaml:"config,omitempty"`
+
+	// Log configures the endpoint changing the level of the logs at
+	// runtime.
+	Log AdminLog `yaml:"log,omitempty"`
+
+	// Markers configures the endpoint recording consistency markers.
+	Markers AdminMarkers `yaml:"markers,omitempty"`
+}
+
+// AdminMarkers configures the markers endpoint, which holds the writes of
+// the registry instance until those in flight complete, and records a
+// consistency marker in the storage, so that snapshots of the storage can be
+// correlated with a consistent state of the registry.
+type AdminMarkers struct {
+	// Enabled enables the endpoint.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Timeout bounds how long writes are held waiting for those in flight
+	// to complete. It defaults to 30 seconds.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// AdminLog configures the log endpoint, which overrides the level of the
+// logs, and enables the debug logs of modules, for a limited duration.
+type AdminLog struct {
+	// Enabled enables the endpoint.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// MaxDuration bounds the duration of the overrides. It defaults to one
+	// hour.
+	MaxDuration time.Duration `yaml:"maxduration,omitempty"`
+}
+
+// AdminConfig configures the configuration endpoint, which reports the
+// effective configuration of the registry, with its secrets redacted, its
+// enabled extensions and its feature flags.
+type AdminConfig struct {
+	// Enabled enables the endpoint.
+	Enabled bool `yaml:"enabled,omitempty"`
+}
+
+// AdminPreheat configures the preheat endpoint, which lists the blobs of an
+// image with URLs from which they are downloaded.
+type AdminPreheat struct {
+	// Enabled enables the endpoint.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// URLExpiry is how long the signed blob URLs stay valid. It defaults
+	// to 20 minutes.
+	URLExpiry time.Duration `yaml:"urlexpiry,omitempty"`
+}
+
+// AdminGC configures the garbage collections started through the
+// administration endpoint. They run online, alongside the traffic.
+type AdminGC struct {
+	// Enabled enables the endpoint.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// GracePeriod is the grace window of the collections, during which
+	// new blobs and links are kept. It defaults to one hour.
+	GracePeriod time.Duration `yaml:"graceperiod,omitempty"`
+
+	// DeleteRate limits the deletes of the collections per second. It is
+	// not limited if not set.
+	DeleteRate float64 `yaml:"deleterate,omitempty"`
+}
+
+// Replica configures a read-only replica. Replicas share the storage of a
+// primary registry, which alone writes to it, to scale pulls horizontally.
+type Replica struct {
+	// Enabled makes the registry refuse writes, as in the read-only
+	// maintenance mode, and disables upload purging and garbage
+	// collection.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Storage overrides parameters of the storage driver, for instance to
+	// read from a read replica endpoint of the backend.
+	Storage Parameters `yaml:"storage,omitempty"`
+}
+
+// Referrers configures the reporting of referrers.
+type Referrers struct {
+	// Headers adds the number of referrers of a manifest, in total and by
+	// artifact type, to the responses of manifest GET and HEAD requests.
+	Headers bool `yaml:"headers,omitempty"`
+
+	// CacheTTL is how long the counts of a manifest are reused before
+	// they are computed again. It defaults to 30 seconds.
+	CacheTTL time.Duration `yaml:"cachettl,omitempty"`
+
+	// LinkCacheTTL, if set, is how long the referrer links of a subject
+	// are reused by referrers queries before the storage is walked again.
+	// Links written or deleted through this instance refresh them.
+	LinkCacheTTL time.Duration `yaml:"linkcachettl,omitempty"`
+
+	// Index maintains an index of the referrers of each subject in the
+	// storage, updated as referrers are pushed and deleted, from which
+	// referrers queries are served without walking the referrer links.
+	Index bool `yaml:"index,omitempty"`
+
+	// TagSchema maintains, for each subject with referrers, the tag of the
+	// referrers tag schema of the OCI distribution specification, for
+	// clients which predate the referrers API.
+	TagSchema bool `yaml:"tagschema,omitempty"`
+
+	// Global maintains an index of the referrers of each subject across
+	// the repositories of the registry, from which the registry-scoped
+	// referrers query lists them.
+	Global bool `yaml:"global,omitempty"`
+
+	// MaxPerSubject, if set, is the maximum number of referrers of a
+	// subject in a repository. Pushing more is refused.
+	MaxPerSubject int `yaml:"maxpersubject,omitempty"`
+
+	// Layout is the layout of the referrer links in the storage: v1, the
+	// default, or v2, which partitions the links of each subject by
+	// artifact type so that queries filtered by artifact type only read
+	// the manifests of the matching referrers.
+	Layout string `yaml:"layout,omitempty"`
+}
+
+// Fetch configures server side blob fetches.
+type Fetch struct {
+	// Hosts lists the hosts blobs may be fetched from. An entry starting
+	// with "*." matches the subdomains of the rest of the entry. Fetches
+	// are disabled if it is empty.
+	Hosts []string `yaml:"hosts,omitempty"`
+
+	// MaxSize is the largest blob, in bytes, which may be fetched. It
+	// defaults to 10 GiB.
+	MaxSize int64 `yaml:"maxsize,omitempty"`
+
+	// Timeout bounds each fetch. It defaults to one hour.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Share configures share links, signed and expiring tokens granting pull
+// access to a manifest and its content to clients without credentials.
+type Share struct {
+	// Enabled enables the endpoint issuing share links.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// MaxExpiry bounds the lifetime of share links. It defaults to 7 days.
+	MaxExpiry time.Duration `yaml:"maxexpiry,omitempty"`
+}
+
+// Usage configures the export of per-namespace usage reports.
+type Usage struct {
+	// URL is the endpoint usage reports are posted to. Reports are not
+	// exported if it is empty.
+	URL string `yaml:"url,omitempty"`
+
+	// Headers are added to each report request.
+	Headers http.Header `yaml:"headers,omitempty"`
+
+	// Interval is the time between two reports. It defaults to one hour.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Timeout bounds each report request. It defaults to 30 seconds.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// NamespaceDepth is the number of leading components of a repository
+	// name which form its namespace. It defaults to 1.
+	NamespaceDepth int `yaml:"namespacedepth,omitempty"`
+}
+
+// FreezeWindow configures a recurring time window during which content of
+// the matching repositories may not be deleted.
+type FreezeWindow struct {
+	// Repositories lists regular expressions matched against repository
+	// names. An empty list matches every repository.
+	Repositories []string `yaml:"repositories,omitempty"`
+
+	// Schedule is a cron expression, in the standard five field format,
+	// giving the start of each window.
+	Schedule string `yaml:"schedule"`
+
+	// Duration is the length of each window.
+	Duration time.Duration `yaml:"duration"`
+
+	// Timezone is the IANA time zone the schedule is evaluated in. It
+	// defaults to UTC.
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+// Warnings configures the Warning headers attached to successful responses.
+type Warnings struct {
+	// Schema1 warns clients pushing or pulling schema1 manifests that
+	// they are deprecated.
+	Schema1 bool `yaml:"schema1,omitempty"`
+
+	// Notices are attached to the responses of the matching requests.
+	Notices []WarningNotice `yaml:"notices,omitempty"`
+}
+
+// WarningNotice is a warning attached to the responses of the requests to
+// the matching repositories.
+type WarningNotice struct {
+	// Repositories lists regular expressions matched against repository
+	// names. An empty list matches every repository.
+	Repositories []string `yaml:"repositories,omitempty"`
+
+	// Methods lists the HTTP methods of the requests warned. An empty list
+	// matches every method.
+	Methods []string `yaml:"methods,omitempty"`
+
+	// Message is the text of the warning.
+	Message string `yaml:"message"`
+}
+
+// Network configures the client addresses allowed to access repositories.
+type Network struct {
+	// Rules restrict the clients of the matching repositories. A request
+	// is refused if any rule matching its repository refuses it.
+	Rules []NetworkRule `yaml:"rules,omitempty"`
+
+	// TrustedProxies lists the addresses, in CIDR notation, of the proxies
+	// whose X-Forwarded-For header is trusted to carry the client address.
+	TrustedProxies []string `yaml:"trustedproxies,omitempty"`
+}
+
+// NetworkRule restricts the client addresses which may access the matching
+// repositories.
+type NetworkRule struct {
+	// Repositories lists regular expressions matched against repository
+	// names. An empty list matches every repository.
+	Repositories []string `yaml:"repositories,omitempty"`
+
+	// Allow lists the addresses, in CIDR notation, of the only clients
+	// allowed. If empty, every client not denied is allowed.
+	Allow []string `yaml:"allow,omitempty"`
+
+	// Deny lists the addresses, in CIDR notation, of clients refused even if
+	// they are allowed.
+	Deny []string `yaml:"deny,omitempty"`
+}
+
+// TagProtectionRule restricts the clients which may create and move the
+// matching tags. Pushing a tag again to the manifest it points at is always
+// allowed.
+type TagProtectionRule struct {
+	// Repositories lists regular expressions matched against repository
+	// names. An empty list matches every repository.
+	Repositories []string `yaml:"repositories,omitempty"`
+
+	// Tags lists the patterns of the protected tags, such as v*, in the
+	// syntax of path.Match.
+	Tags []string `yaml:"tags,omitempty"`
+
+	// Scopes lists token scopes, in the type:name:action form, any of
+	// which allows a client to create and move the tags. The name * stands
+	// for the repository of the tag.
+	Scopes []string `yaml:"scopes,omitempty"`
+
+	// Allow lists the addresses, in CIDR notation, of the clients allowed
+	// to create and move the tags.
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+// Egress configures the egress caps of authenticated subjects.
+type Egress struct {
+	// EgressCaps are the caps of subjects not listed in Subjects.
+	EgressCaps `yaml:",inline"`
+
+	// Subjects overrides the caps of individual subjects, by user name.
+	Subjects map[string]EgressCaps `yaml:"subjects,omitempty"`
+}
+
+// EgressCaps limits the bytes of blobs a subject may download. A zero cap
+// is unlimited.
+type EgressCaps struct {
+	// Daily is the number of bytes a subject may download per UTC day.
+	Daily int64 `yaml:"daily,omitempty"`
+
+	// Monthly is the number of bytes a subject may download per UTC
+	// calendar month.
+	Monthly int64 `yaml:"monthly,omitempty"`
+}
+
+// Bulkhead caps the requests served concurrently for each repository, in
+// separate pools for reads and writes, so that a burst of requests to one
+// repository cannot starve the others. A zero cap is unlimited.
+type Bulkhead struct {
+	// Reads caps the concurrent GET and HEAD requests to a repository.
+	Reads int `yaml:"reads,omitempty"`
+
+	// Writes caps the concurrent requests of other methods to a
+	// repository.
+	Writes int `yaml:"writes,omitempty"`
+
+	// QueueTimeout is how long a request waits for a slot of a full pool
+	// before being refused. Zero refuses it at once.
+	QueueTimeout time.Duration `yaml:"queuetimeout,omitempty"`
+
+	// Background configures the background traffic, such as replication
+	// and mirror syncs, which is shed before interactive requests.
+	Background BulkheadBackground `yaml:"background,omitempty"`
+}
+
+// BulkheadBackground selects the requests of background traffic. Background
+// requests may only hold a share of the slots of each pool, and are refused
+// rather than queued when they cannot get one.
+type BulkheadBackground struct {
+	// Subjects lists the user names whose requests are background
+	// traffic.
+	Subjects []string `yaml:"subjects,omitempty"`
+
+	// TrustedClients lists the addresses, in CIDR notation, of clients
+	// whose Registry-Priority header sets the priority of their requests.
+	TrustedClients []string `yaml:"trustedclients,omitempty"`
+
+	// Share is the percentage of the slots of each pool background
+	// requests may hold. It defaults to 50.
+	Share int `yaml:"share,omitempty"`
 }
 
 // LogHook is composed of hook Level and Type.
@@ -299,6 +814,9 @@ type FileChecker struct {
 	// Threshold is the number of times a check must fail to trigger an
 	// unhealthy state
 	Threshold int `yaml:"threshold,omitempty"`
+	// Liveness makes a failure of the check also fail the liveness
+	// endpoint
+	Liveness bool `yaml:"liveness,omitempty"`
 }
 
 // HTTPChecker is a type of entry in the health section for checking HTTP URIs.
@@ -316,6 +834,9 @@ type HTTPChecker struct {
 	// Threshold is the number of times a check must fail to trigger an
 	// unhealthy state
 	Threshold int `yaml:"threshold,omitempty"`
+	// Liveness makes a failure of the check also fail the liveness
+	// endpoint
+	Liveness bool `yaml:"liveness,omitempty"`
 }
 
 // TCPChecker is a type of entry in the health section for checking TCP servers.
@@ -329,6 +850,9 @@ type TCPChecker struct {
 	// Threshold is the number of times a check must fail to trigger an
 	// unhealthy state
 	Threshold int `yaml:"threshold,omitempty"`
+	// Liveness makes a failure of the check also fail the liveness
+	// endpoint
+	Liveness bool `yaml:"liveness,omitempty"`
 }
 
 // Health provides the configuration section for health checks.
@@ -349,7 +873,22 @@ type Health struct {
 		// Threshold is the number of times a check must fail to trigger an
 		// unhealthy state
 		Threshold int `yaml:"threshold,omitempty"`
+		// Liveness makes a failure of the check also fail the liveness
+		// endpoint
+		Liveness bool `yaml:"liveness,omitempty"`
 	} `yaml:"storagedriver,omitempty"`
+	// Extensions configures health checks on the enabled extensions which
+	// depend on a service or a storage path of their own, so that an
+	// extension unable to serve requests makes the instance not ready
+	Extensions struct {
+		// Enabled turns on the health checks of the extensions
+		Enabled bool `yaml:"enabled,omitempty"`
+		// Interval is the duration in between checks
+		Interval time.Duration `yaml:"interval,omitempty"`
+		// Threshold is the number of times a check must fail to trigger an
+		// unhealthy state
+		Threshold int `yaml:"threshold,omitempty"`
+	} `yaml:"extensions,omitempty"`
 }
 
 // v0_1Configuration is a Version 0.1 Configuration struct
@@ -427,6 +966,10 @@ func (storage Storage) Type() string {
 			// allow configuration of delete
 		case "redirect":
 			// allow configuration of redirect
+		case "referenceindex":
+			// allow configuration of the reference index
+		case "hashing":
+			// allow configuration of the hash implementation
 		default:
 			storageType = append(storageType, k)
 		}
@@ -468,6 +1011,10 @@ func (storage *Storage) UnmarshalYAML(unmarshal func(interface{}) error) error {
 					// allow configuration of delete
 				case "redirect":
 					// allow configuration of redirect
+				case "referenceindex":
+					// allow configuration of the reference index
+				case "hashing":
+					// allow configuration of the hash implementation
 				default:
 					types = append(types, k)
 				}
@@ -582,6 +1129,7 @@ type Endpoint struct {
 	Backoff           time.Duration `yaml:"backoff"`           // backoff duration
 	IgnoredMediaTypes []string      `yaml:"ignoredmediatypes"` // target media types to ignore
 	Ignore            Ignore        `yaml:"ignore"`            // ignore event types
+	Preheat           bool          `yaml:"preheat,omitempty"` // only notify pushes of tagged manifests
 }
 
 // Events configures notification events.
@@ -654,6 +1202,17 @@ type Proxy struct {
 // Configuration.Abc may be replaced by the value of REGISTRY_ABC,
 // Configuration.Abc.Xyz may be replaced by the value of REGISTRY_ABC_XYZ, and so forth
 func Parse(rd io.Reader) (*Configuration, error) {
+	return parse(rd, false)
+}
+
+// ParseStrict is like Parse, but fails on keys which do not correspond to a
+// configuration field rather than ignoring them. Parameters of the storage
+// and auth sections are passed to their drivers and are not checked.
+func ParseStrict(rd io.Reader) (*Configuration, error) {
+	return parse(rd, true)
+}
+
+func parse(rd io.Reader, strict bool) (*Configuration, error) {
 	in, err := ioutil.ReadAll(rd)
 	if err != nil {
 		return nil, err
@@ -684,6 +1243,7 @@ func Parse(rd io.Reader) (*Configuration, error) {
 			},
 		},
 	})
+	p.strict = strict
 
 	config := new(Configuration)
 	err = p.Parse(in, config)
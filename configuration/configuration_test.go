@@ -2,6 +2,7 @@ package configuration
 
 import (
 	"bytes"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"reflect"
@@ -78,6 +79,7 @@ var configStruct = Configuration{
 		Secret       string        `yaml:"secret,omitempty"`
 		RelativeURLs bool          `yaml:"relativeurls,omitempty"`
 		DrainTimeout time.Duration `yaml:"draintimeout,omitempty"`
+		ErrorDocs    string        `yaml:"errordocs,omitempty"`
 		TLS          struct {
 			Certificate  string   `yaml:"certificate,omitempty"`
 			Key          string   `yaml:"key,omitempty"`
@@ -97,6 +99,9 @@ var configStruct = Configuration{
 				Enabled bool   `yaml:"enabled,omitempty"`
 				Path    string `yaml:"path,omitempty"`
 			} `yaml:"prometheus,omitempty"`
+			Watchdog struct {
+				Threshold time.Duration `yaml:"threshold,omitempty"`
+			} `yaml:"watchdog,omitempty"`
 		} `yaml:"debug,omitempty"`
 		HTTP2 struct {
 			Disabled bool `yaml:"disabled,omitempty"`
@@ -230,6 +235,27 @@ func (suite *ConfigSuite) TestParseSimple(c *C) {
 	c.Assert(config, DeepEquals, suite.expectedConfig)
 }
 
+// TestParseStrict validates that strict parsing rejects keys which do not
+// correspond to a configuration field
+func (suite *ConfigSuite) TestParseStrict(c *C) {
+	suite.expectedConfig.Storage = Storage{"inmemory": Parameters{}}
+	suite.expectedConfig.Reporting = Reporting{}
+	suite.expectedConfig.Log.Fields = nil
+
+	config, err := ParseStrict(bytes.NewReader([]byte(inmemoryConfigYamlV0_1)))
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, suite.expectedConfig)
+
+	typo := inmemoryConfigYamlV0_1 + "validaton:\n  disabled: true\n"
+	_, err = ParseStrict(bytes.NewReader([]byte(typo)))
+	c.Assert(err, ErrorMatches, `invalid configuration: line \d+: unknown key "validaton"`)
+
+	// Unknown keys are only ignored by the lenient parser.
+	config, err = Parse(bytes.NewReader([]byte(typo)))
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, suite.expectedConfig)
+}
+
 // TestParseInmemory validates that configuration yaml with storage provided as
 // a string can be parsed into a Configuration struct with no storage parameters
 func (suite *ConfigSuite) TestParseInmemory(c *C) {
@@ -242,6 +268,22 @@ func (suite *ConfigSuite) TestParseInmemory(c *C) {
 	c.Assert(config, DeepEquals, suite.expectedConfig)
 }
 
+// TestParseStorageHashing validates that the hashing options may be
+// configured along with the storage driver
+func (suite *ConfigSuite) TestParseStorageHashing(c *C) {
+	yml := `
+version: 0.1
+storage:
+  inmemory:
+  hashing:
+    implementation: go
+`
+	config, err := Parse(bytes.NewReader([]byte(yml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Storage.Type(), Equals, "inmemory")
+	c.Assert(config.Storage["hashing"], DeepEquals, Parameters{"implementation": "go"})
+}
+
 // TestParseIncomplete validates that an incomplete yaml configuration cannot
 // be parsed without providing environment variables to fill in the missing
 // components.
@@ -475,6 +517,62 @@ func (suite *ConfigSuite) TestParseEnvMany(c *C) {
 	c.Assert(err, IsNil)
 }
 
+// TestParseEnvReferences validates that ${NAME} references are expanded and
+// that key_file entries are replaced by the content of the file.
+func (suite *ConfigSuite) TestParseEnvReferences(c *C) {
+	secretPath := c.MkDir() + "/secret"
+	err := ioutil.WriteFile(secretPath, []byte("filesecret\n"), 0600)
+	c.Assert(err, IsNil)
+
+	os.Setenv("TEST_ACCESS_KEY", "envkey")
+	os.Setenv("TEST_PASSWORD", "yes")
+	os.Setenv("TEST_PIN", "0123")
+	os.Setenv("TEST_TOKEN", "1e5")
+	os.Setenv("TEST_SECRET_PATH", secretPath)
+
+	configYaml := `
+version: 0.1
+storage:
+  s3:
+    accesskey: ${TEST_ACCESS_KEY}
+    secretkey_file: ${TEST_SECRET_PATH}
+    region: us-${TEST_ACCESS_KEY}-1
+    password: ${TEST_PASSWORD}
+    pin: ${TEST_PIN}
+    token: ${TEST_TOKEN}
+http:
+  secret_file: ` + secretPath + `
+  prefix: $${TEST_ACCESS_KEY}
+`
+	config, err := Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config.Storage.Parameters(), DeepEquals, Parameters{
+		"accesskey": "envkey",
+		"secretkey": "filesecret",
+		"region":    "us-envkey-1",
+		"password":  "yes",
+		"pin":       "0123",
+		"token":     "1e5",
+	})
+	c.Assert(config.HTTP.Secret, Equals, "filesecret")
+	c.Assert(config.HTTP.Prefix, Equals, "${TEST_ACCESS_KEY}")
+
+	_, err = Parse(bytes.NewReader([]byte("version: 0.1\nstorage: inmemory\nhttp:\n  secret: ${TEST_UNSET}\n")))
+	c.Assert(err, ErrorMatches, ".*TEST_UNSET.*not set")
+
+	_, err = Parse(bytes.NewReader([]byte("version: 0.1\nstorage: inmemory\nhttp:\n  secret: a\n  secret_file: " + secretPath + "\n")))
+	c.Assert(err, ErrorMatches, "both secret and secret_file are set")
+
+	// Values read from files are not reported as unknown keys, and errors
+	// keep the lines of the document.
+	config, err = ParseStrict(bytes.NewReader([]byte("version: 0.1\nstorage: inmemory\nhttp:\n  secret_file: " + secretPath + "\n")))
+	c.Assert(err, IsNil)
+	c.Assert(config.HTTP.Secret, Equals, "filesecret")
+
+	_, err = Parse(bytes.NewReader([]byte("version: 0.1\nstorage: inmemory\nhttp:\n  secret_file: " + secretPath + "\n  addr: [oops]\n")))
+	c.Assert(err, ErrorMatches, "(?s).*line 5: cannot unmarshal.*")
+}
+
 func checkStructs(c *C, t reflect.Type, structsChecked map[string]struct{}) {
 	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Map || t.Kind() == reflect.Slice {
 		t = t.Elem()
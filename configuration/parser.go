@@ -1,9 +1,12 @@
 package configuration
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -77,6 +80,10 @@ type Parser struct {
 	prefix  string
 	mapping map[Version]VersionedParseInfo
 	env     envVars
+
+	// strict rejects configuration keys which do not correspond to a
+	// field, instead of logging a warning and ignoring them.
+	strict bool
 }
 
 // NewParser returns a *Parser with the given environment prefix which handles
@@ -112,6 +119,11 @@ func NewParser(prefix string, parseInfos []VersionedParseInfo) *Parser {
 // v.Abc may be replaced by the value of PREFIX_ABC,
 // v.Abc.Xyz may be replaced by the value of PREFIX_ABC_XYZ, and so forth
 func (p *Parser) Parse(in []byte, v interface{}) error {
+	fileRefs, err := readFileReferences(in)
+	if err != nil {
+		return err
+	}
+
 	var versionedStruct struct {
 		Version Version
 	}
@@ -126,18 +138,40 @@ func (p *Parser) Parse(in []byte, v interface{}) error {
 	}
 
 	parseAs := reflect.New(parseInfo.ParseAs)
-	err := yaml.Unmarshal(in, parseAs.Interface())
-	if err != nil {
+	if p.strict {
+		if err := yaml.UnmarshalStrict(in, parseAs.Interface()); err != nil {
+			if err := unknownFieldsError(err, fileRefs); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := yaml.Unmarshal(in, parseAs.Interface()); err != nil {
+			return err
+		}
+		// Unknown keys are most often typos which silently disable the
+		// feature they were meant to configure, so point them out.
+		if err := yaml.UnmarshalStrict(in, reflect.New(parseInfo.ParseAs).Interface()); err != nil {
+			if err := unknownFieldsError(err, fileRefs); err != nil {
+				logrus.Warnf("Ignoring unrecognized configuration: %v", err)
+			}
+		}
+	}
+
+	if err := expandEnvReferences(parseAs); err != nil {
 		return err
 	}
+	for _, ref := range fileRefs {
+		if err := setFileReference(parseAs, ref.path, ref); err != nil {
+			return err
+		}
+	}
 
 	for _, envVar := range p.env {
 		pathStr := envVar.name
 		if strings.HasPrefix(pathStr, strings.ToUpper(p.prefix)+"_") {
 			path := strings.Split(pathStr, "_")
 
-			err = p.overwriteFields(parseAs, pathStr, path[1:], envVar.value)
-			if err != nil {
+			if err := p.overwriteFields(parseAs, pathStr, path[1:], envVar.value); err != nil {
 				return err
 			}
 		}
@@ -151,6 +185,307 @@ func (p *Parser) Parse(in []byte, v interface{}) error {
 	return nil
 }
 
+var envReferenceRegexp = regexp.MustCompile(`\$?\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// fileKeySuffix marks keys whose value is the path of a file holding the
+// value of the key without the suffix, such as secrets mounted as files.
+const fileKeySuffix = "_file"
+
+// fileReference is a key of the form key_file of a configuration document.
+type fileReference struct {
+	// path lists the keys and sequence indices leading to the mapping
+	// holding the key.
+	path []interface{}
+	// key is the key without the suffix, set to content.
+	key     string
+	fileKey string
+	content string
+}
+
+// readFileReferences reads the files named by the keys of the form key_file
+// of a configuration document. The file names may reference environment
+// variables.
+func readFileReferences(in []byte) ([]fileReference, error) {
+	if !bytes.Contains(in, []byte(fileKeySuffix)) {
+		return nil, nil
+	}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(in, &doc); err != nil {
+		return nil, err
+	}
+	var refs []fileReference
+	if err := collectFileReferences(doc, nil, &refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func collectFileReferences(v interface{}, path []interface{}, refs *[]fileReference) error {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			if err := collectFileReferences(v[i], append(path[:len(path):len(path)], i), refs); err != nil {
+				return err
+			}
+		}
+	case yaml.MapSlice:
+		for _, item := range v {
+			key, ok := item.Key.(string)
+			if !ok || !strings.HasSuffix(key, fileKeySuffix) || key == fileKeySuffix {
+				if err := collectFileReferences(item.Value, append(path[:len(path):len(path)], item.Key), refs); err != nil {
+					return err
+				}
+				continue
+			}
+			name := strings.TrimSuffix(key, fileKeySuffix)
+			for _, other := range v {
+				if other.Key == name {
+					return fmt.Errorf("both %s and %s are set", name, key)
+				}
+			}
+			filename, ok := item.Value.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a file path", key)
+			}
+			filename, err := expandEnv(filename)
+			if err != nil {
+				return err
+			}
+			content, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", key, err)
+			}
+			*refs = append(*refs, fileReference{
+				path:    path,
+				key:     name,
+				fileKey: key,
+				content: strings.TrimRight(string(content), "\r\n"),
+			})
+		}
+	}
+	return nil
+}
+
+// setFileReference sets the key of a file reference to the content of the
+// file, in the decoded configuration v, following the remaining path.
+func setFileReference(v reflect.Value, path []interface{}, ref fileReference) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return fmt.Errorf("%s cannot be read from a file", ref.fileKey)
+		}
+		return setFileReference(v.Elem(), path, ref)
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return fmt.Errorf("%s cannot be read from a file", ref.fileKey)
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := setFileReference(elem, path, ref); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	if len(path) == 0 {
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := yamlField(v, ref.key)
+			if !ok || field.Kind() != reflect.String || !field.CanSet() {
+				return fmt.Errorf("%s cannot be read from a file", ref.fileKey)
+			}
+			field.SetString(ref.content)
+			return nil
+		case reflect.Map:
+			key, ok := mapKey(v, ref.key)
+			fileKey, _ := mapKey(v, ref.fileKey)
+			content := reflect.ValueOf(ref.content)
+			if !ok || !content.Type().ConvertibleTo(v.Type().Elem()) {
+				return fmt.Errorf("%s cannot be read from a file", ref.fileKey)
+			}
+			v.SetMapIndex(fileKey, reflect.Value{})
+			v.SetMapIndex(key, content.Convert(v.Type().Elem()))
+			return nil
+		}
+		return fmt.Errorf("%s cannot be read from a file", ref.fileKey)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		name, ok := path[0].(string)
+		if !ok {
+			break
+		}
+		if field, ok := yamlField(v, name); ok {
+			return setFileReference(field, path[1:], ref)
+		}
+	case reflect.Map:
+		key, ok := mapKey(v, path[0])
+		if !ok || !v.MapIndex(key).IsValid() {
+			break
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		elem.Set(v.MapIndex(key))
+		if err := setFileReference(elem, path[1:], ref); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	case reflect.Slice, reflect.Array:
+		i, ok := path[0].(int)
+		if ok && i < v.Len() {
+			return setFileReference(v.Index(i), path[1:], ref)
+		}
+	}
+	return fmt.Errorf("%s cannot be read from a file", ref.fileKey)
+}
+
+// yamlField returns the field of a struct decoded from the given key.
+func yamlField(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(sf.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" && v.Field(i).Kind() == reflect.Struct {
+			if field, ok := yamlField(v.Field(i), key); ok {
+				return field, true
+			}
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if name == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// mapKey converts a key of a configuration document to the key type of m.
+func mapKey(m reflect.Value, key interface{}) (reflect.Value, bool) {
+	k := reflect.ValueOf(key)
+	if !k.IsValid() || !k.Type().ConvertibleTo(m.Type().Key()) {
+		return reflect.Value{}, false
+	}
+	return k.Convert(m.Type().Key()), true
+}
+
+// expandEnvReferences expands the environment variable references in the
+// strings of a decoded configuration. Expanded values remain strings, so
+// that variables holding values such as "yes" or "0123" are not read as
+// booleans or numbers.
+func expandEnvReferences(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return expandEnvReferences(v.Elem())
+		}
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return nil
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := expandEnvReferences(elem); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		expanded, err := expandEnv(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(expanded)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := expandEnvReferences(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandEnvReferences(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := expandEnvReferences(elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// expandEnv expands the environment variable references in a string.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var err error
+	expanded := envReferenceRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name := ref[2 : len(ref)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s referenced by the configuration is not set", name)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+var unknownFieldRegexp = regexp.MustCompile(`^(line \d+): field (\S+) not found in type .*$`)
+
+// unknownFieldsError rewrites the errors reported by strict unmarshaling,
+// which name the anonymous struct types of the configuration in full, to
+// only mention the offending key and its line. The keys of file references
+// are not reported, and nil is returned if no error remains.
+func unknownFieldsError(err error, fileRefs []fileReference) error {
+	typeErr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return err
+	}
+	fileKeys := make(map[string]bool, len(fileRefs))
+	for _, ref := range fileRefs {
+		fileKeys[ref.fileKey] = true
+	}
+	errs := make([]string, 0, len(typeErr.Errors))
+	for _, e := range typeErr.Errors {
+		if match := unknownFieldRegexp.FindStringSubmatch(e); match != nil && fileKeys[match[2]] {
+			continue
+		}
+		errs = append(errs, unknownFieldRegexp.ReplaceAllString(e, `$1: unknown key "$2"`))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+}
+
 // overwriteFields replaces configuration values with alternate values specified
 // through the environment. Precondition: an empty path slice must never be
 // passed in.
@@ -37,6 +37,18 @@ func (err ErrTagUnknown) Error() string {
 	return fmt.Sprintf("unknown tag=%s", err.Tag)
 }
 
+// ErrTagProtected is returned when a tag protection rule does not allow the
+// client to create or move a tag.
+type ErrTagProtected struct {
+	Tag string
+	// Pattern is the pattern of the rule protecting the tag.
+	Pattern string
+}
+
+func (err ErrTagProtected) Error() string {
+	return fmt.Sprintf("tag %s is protected by pattern %q", err.Tag, err.Pattern)
+}
+
 // ErrRepositoryUnknown is returned if the named repository is not known by
 // the registry.
 type ErrRepositoryUnknown struct {
@@ -111,6 +123,27 @@ func (err ErrManifestBlobUnknown) Error() string {
 	return fmt.Sprintf("unknown blob %v on manifest", err.Digest)
 }
 
+// ErrManifestArtifactTypeDenied is returned when the registry does not
+// accept manifests of an artifact type.
+type ErrManifestArtifactTypeDenied struct {
+	ArtifactType string
+}
+
+func (err ErrManifestArtifactTypeDenied) Error() string {
+	return fmt.Sprintf("artifact type %q is not accepted by this registry", err.ArtifactType)
+}
+
+// ErrReferrersLimitExceeded is returned when a manifest is pushed with a
+// subject which already has as many referrers as the registry accepts.
+type ErrReferrersLimitExceeded struct {
+	Subject digest.Digest
+	Limit   int
+}
+
+func (err ErrReferrersLimitExceeded) Error() string {
+	return fmt.Sprintf("subject %v already has the maximum of %d referrers", err.Subject, err.Limit)
+}
+
 // ErrManifestNameInvalid should be used to denote an invalid manifest
 // name. Reason may set, indicating the cause of invalidity.
 type ErrManifestNameInvalid struct {
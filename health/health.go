@@ -29,9 +29,14 @@ func NewRegistry() *Registry {
 }
 
 // DefaultRegistry is the default registry where checks are registered. It is
-// the registry used by the HTTP handler.
+// the registry used by the HTTP handler, and determines readiness.
 var DefaultRegistry *Registry
 
+// LivenessRegistry is the registry of checks whose failure means the process
+// should be restarted, rather than only taken out of rotation. It is empty
+// unless checks are registered with it explicitly.
+var LivenessRegistry *Registry
+
 // Checker is the interface for a Health Checker
 type Checker interface {
 	// Check returns nil if the service is okay.
@@ -242,8 +247,15 @@ func RegisterPeriodicThresholdFunc(name string, period time.Duration, threshold
 // and their corresponding status.
 // Returns 503 if any Error status exists, 200 otherwise
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	DefaultRegistry.StatusHandler(w, r)
+}
+
+// StatusHandler returns a JSON blob with all the checks of the registry
+// which currently fail and their errors.
+// Returns 503 if any Error status exists, 200 otherwise
+func (registry *Registry) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		checks := CheckStatus()
+		checks := registry.CheckStatus()
 		status := http.StatusOK
 
 		// If there is an error, return 503
@@ -301,8 +313,15 @@ func statusResponse(w http.ResponseWriter, r *http.Request, status int, checks m
 	}
 }
 
-// Registers global /debug/health api endpoint, creates default registry
+// Registers global /debug/health api endpoints, creates default registries.
+// /debug/health/ready reports the checks of the default registry, like
+// /debug/health, and /debug/health/live those of the liveness registry.
 func init() {
 	DefaultRegistry = NewRegistry()
+	LivenessRegistry = NewRegistry()
 	http.HandleFunc("/debug/health", StatusHandler)
+	http.HandleFunc("/debug/health/ready", StatusHandler)
+	http.HandleFunc("/debug/health/live", func(w http.ResponseWriter, r *http.Request) {
+		LivenessRegistry.StatusHandler(w, r)
+	})
 }
@@ -0,0 +1,259 @@
+package manifestlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ErrInvalidPlatform is returned when a manifest is appended to a Builder
+// with a missing or invalid platform.
+type ErrInvalidPlatform struct {
+	Descriptor distribution.Descriptor
+	Reason     string
+}
+
+func (err ErrInvalidPlatform) Error() string {
+	return fmt.Sprintf("invalid platform for manifest %s: %s", err.Descriptor.Digest, err.Reason)
+}
+
+// knownPlatforms lists the architectures known to be valid for each
+// operating system. It follows the GOOS/GOARCH pairs supported by Go.
+var knownPlatforms = map[string][]string{
+	"aix":       {"ppc64"},
+	"android":   {"386", "amd64", "arm", "arm64"},
+	"darwin":    {"amd64", "arm64"},
+	"dragonfly": {"amd64"},
+	"freebsd":   {"386", "amd64", "arm", "arm64", "riscv64"},
+	"illumos":   {"amd64"},
+	"ios":       {"amd64", "arm64"},
+	"js":        {"wasm"},
+	"linux":     {"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le", "mipsle", "ppc64", "ppc64le", "riscv64", "s390x"},
+	"netbsd":    {"386", "amd64", "arm", "arm64"},
+	"openbsd":   {"386", "amd64", "arm", "arm64", "mips64"},
+	"plan9":     {"386", "amd64", "arm"},
+	"solaris":   {"amd64"},
+	"wasip1":    {"wasm"},
+	"windows":   {"386", "amd64", "arm", "arm64"},
+	// BuildKit marks attestation manifests with an unknown platform.
+	"unknown": {"unknown"},
+}
+
+// knownVariants matches the CPU variants valid for each architecture.
+// Architectures not listed here do not have variants.
+var knownVariants = map[string]*regexp.Regexp{
+	"amd64": regexp.MustCompile(`^v[1-4]$`),
+	"arm":   regexp.MustCompile(`^v[5-8]$`),
+	"arm64": regexp.MustCompile(`^v(8|9)(\.[0-9])?$`),
+}
+
+// Builder is a type for constructing manifest lists and OCI image indexes.
+// Unlike FromDescriptors, it validates the platform of every appended
+// manifest and ignores duplicate entries.
+type Builder struct {
+	mediaType string
+	manifests []ManifestDescriptor
+}
+
+// NewManifestBuilder is used to build new manifest lists or, if mediaType
+// is v1.MediaTypeImageIndex, OCI image indexes.
+func NewManifestBuilder(mediaType string) (*Builder, error) {
+	if mediaType != MediaTypeManifestList && mediaType != v1.MediaTypeImageIndex {
+		return nil, fmt.Errorf("invalid media type for manifest list: %s", mediaType)
+	}
+	return &Builder{mediaType: mediaType}, nil
+}
+
+// Build produces a final manifest list from the given references.
+func (b *Builder) Build(ctx context.Context) (distribution.Manifest, error) {
+	if len(b.manifests) == 0 {
+		return nil, errors.New("manifest list must reference at least one manifest")
+	}
+	return FromDescriptorsWithMediaType(b.manifests, b.mediaType)
+}
+
+// AppendReference adds a platform-specific manifest to the list. The
+// descriptor must carry a valid platform. Appending the same manifest for
+// the same platform twice is a no-op, while appending two different
+// manifests for the same platform is an error.
+func (b *Builder) AppendReference(d distribution.Describable) error {
+	desc := d.Descriptor()
+	if err := desc.Digest.Validate(); err != nil {
+		return err
+	}
+	if err := ValidatePlatform(desc); err != nil {
+		return err
+	}
+
+	platform := PlatformSpec{
+		Architecture: desc.Platform.Architecture,
+		OS:           desc.Platform.OS,
+		OSVersion:    desc.Platform.OSVersion,
+		OSFeatures:   desc.Platform.OSFeatures,
+		Variant:      desc.Platform.Variant,
+	}
+
+	for _, existing := range b.manifests {
+		if !samePlatform(existing.Platform, platform) {
+			continue
+		}
+		if existing.Digest == desc.Digest {
+			return nil
+		}
+		// Attestation manifests all share the unknown platform.
+		if platform.OS == "unknown" {
+			continue
+		}
+		return ErrInvalidPlatform{
+			Descriptor: desc,
+			Reason:     fmt.Sprintf("platform already provided by manifest %s", existing.Digest),
+		}
+	}
+
+	desc.Platform = nil
+	b.manifests = append(b.manifests, ManifestDescriptor{
+		Descriptor: desc,
+		Platform:   platform,
+	})
+	return nil
+}
+
+// References returns the current references added to this builder.
+func (b *Builder) References() []distribution.Descriptor {
+	return ManifestList{Manifests: b.manifests}.References()
+}
+
+// ValidatePlatform checks that the descriptor carries a platform with a
+// known combination of operating system, architecture and variant.
+func ValidatePlatform(desc distribution.Descriptor) error {
+	p := desc.Platform
+	if p == nil {
+		return ErrInvalidPlatform{Descriptor: desc, Reason: "platform is required"}
+	}
+	if p.OS == "" || p.Architecture == "" {
+		return ErrInvalidPlatform{Descriptor: desc, Reason: "os and architecture are required"}
+	}
+
+	archs, ok := knownPlatforms[p.OS]
+	if !ok {
+		return ErrInvalidPlatform{Descriptor: desc, Reason: fmt.Sprintf("unknown os %q", p.OS)}
+	}
+	if !containsString(archs, p.Architecture) {
+		return ErrInvalidPlatform{Descriptor: desc, Reason: fmt.Sprintf("unsupported architecture %q for os %q", p.Architecture, p.OS)}
+	}
+
+	if p.Variant != "" {
+		variants, ok := knownVariants[p.Architecture]
+		if !ok || !variants.MatchString(p.Variant) {
+			return ErrInvalidPlatform{Descriptor: desc, Reason: fmt.Sprintf("unsupported variant %q for architecture %q", p.Variant, p.Architecture)}
+		}
+	}
+
+	if (p.OSVersion != "" || len(p.OSFeatures) > 0) && p.OS != "windows" {
+		return ErrInvalidPlatform{Descriptor: desc, Reason: "os.version and os.features are only supported for windows"}
+	}
+
+	return nil
+}
+
+// AnnotationReferenceDigest is the annotation BuildKit sets on attestation
+// manifests to the digest of the manifest they describe.
+const AnnotationReferenceDigest = "vnd.docker.reference.digest"
+
+// Update returns a copy of a manifest list without the manifests listed in
+// remove, and with the manifests of add appended. An appended manifest
+// replaces the manifest for the same platform, if any. The attestation
+// manifests of removed or replaced manifests are removed as well. Appended
+// manifests must carry a valid platform, while the platforms already in the
+// list are kept as they are.
+func Update(m *DeserializedManifestList, add []distribution.Descriptor, remove []digest.Digest) (*DeserializedManifestList, error) {
+	manifests := append([]ManifestDescriptor(nil), m.Manifests...)
+	dropped := make(map[digest.Digest]struct{})
+
+	for _, dgst := range remove {
+		i := indexOfDigest(manifests, dgst)
+		if i < 0 {
+			return nil, fmt.Errorf("manifest %s is not in the manifest list", dgst)
+		}
+		manifests = append(manifests[:i], manifests[i+1:]...)
+		dropped[dgst] = struct{}{}
+	}
+
+	for _, desc := range add {
+		if err := desc.Digest.Validate(); err != nil {
+			return nil, err
+		}
+		if err := ValidatePlatform(desc); err != nil {
+			return nil, err
+		}
+		if indexOfDigest(manifests, desc.Digest) >= 0 {
+			continue
+		}
+
+		entry := ManifestDescriptor{
+			Descriptor: desc,
+			Platform: PlatformSpec{
+				Architecture: desc.Platform.Architecture,
+				OS:           desc.Platform.OS,
+				OSVersion:    desc.Platform.OSVersion,
+				OSFeatures:   desc.Platform.OSFeatures,
+				Variant:      desc.Platform.Variant,
+			},
+		}
+		entry.Descriptor.Platform = nil
+
+		replaced := false
+		if entry.Platform.OS != "unknown" {
+			for i, existing := range manifests {
+				if samePlatform(existing.Platform, entry.Platform) {
+					dropped[existing.Digest] = struct{}{}
+					manifests[i] = entry
+					replaced = true
+					break
+				}
+			}
+		}
+		if !replaced {
+			manifests = append(manifests, entry)
+		}
+	}
+
+	kept := manifests[:0]
+	for _, entry := range manifests {
+		if _, ok := dropped[digest.Digest(entry.Annotations[AnnotationReferenceDigest])]; ok {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if len(kept) == 0 {
+		return nil, errors.New("manifest list must reference at least one manifest")
+	}
+	return FromDescriptorsWithMediaType(kept, m.MediaType)
+}
+
+func indexOfDigest(manifests []ManifestDescriptor, dgst digest.Digest) int {
+	for i, entry := range manifests {
+		if entry.Digest == dgst {
+			return i
+		}
+	}
+	return -1
+}
+
+func samePlatform(a, b PlatformSpec) bool {
+	return a.OS == b.OS && a.Architecture == b.Architecture && a.Variant == b.Variant && a.OSVersion == b.OSVersion
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
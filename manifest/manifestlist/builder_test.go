@@ -0,0 +1,167 @@
+package manifestlist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func platformDescriptor(content string, platform v1.Platform) distribution.Descriptor {
+	return distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Size:      int64(len(content)),
+		Digest:    digest.FromString(content),
+		Platform:  &platform,
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	builder, err := NewManifestBuilder(v1.MediaTypeImageIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amd64 := platformDescriptor("amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	arm := platformDescriptor("arm", v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})
+	attestation1 := platformDescriptor("attestation1", v1.Platform{OS: "unknown", Architecture: "unknown"})
+	attestation2 := platformDescriptor("attestation2", v1.Platform{OS: "unknown", Architecture: "unknown"})
+
+	for _, desc := range []distribution.Descriptor{amd64, arm, amd64, attestation1, attestation2} {
+		if err := builder.AppendReference(desc); err != nil {
+			t.Fatalf("unexpected error appending %s: %v", desc.Digest, err)
+		}
+	}
+
+	err = builder.AppendReference(platformDescriptor("other", v1.Platform{OS: "linux", Architecture: "amd64"}))
+	if _, ok := err.(ErrInvalidPlatform); !ok {
+		t.Fatalf("expected ErrInvalidPlatform for a duplicate platform, got %v", err)
+	}
+
+	m, err := builder.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ml := m.(*DeserializedManifestList)
+	if ml.MediaType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected media type: %s", ml.MediaType)
+	}
+	if len(ml.Manifests) != 4 {
+		t.Fatalf("expected 4 manifests, got %d", len(ml.Manifests))
+	}
+	if ml.Manifests[1].Platform.Variant != "v7" {
+		t.Fatalf("unexpected platform: %v", ml.Manifests[1].Platform)
+	}
+	if len(builder.References()) != 4 {
+		t.Fatalf("expected 4 references, got %d", len(builder.References()))
+	}
+}
+
+func TestBuilderEmpty(t *testing.T) {
+	if _, err := NewManifestBuilder("application/json"); err == nil {
+		t.Fatal("expected error for invalid media type")
+	}
+
+	builder, err := NewManifestBuilder(MediaTypeManifestList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.Build(context.Background()); err == nil {
+		t.Fatal("expected error building an empty manifest list")
+	}
+}
+
+func TestValidatePlatform(t *testing.T) {
+	for _, tc := range []struct {
+		platform *v1.Platform
+		valid    bool
+	}{
+		{platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, valid: true},
+		{platform: &v1.Platform{OS: "linux", Architecture: "amd64", Variant: "v3"}, valid: true},
+		{platform: &v1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1879"}, valid: true},
+		{platform: nil},
+		{platform: &v1.Platform{OS: "linux"}},
+		{platform: &v1.Platform{OS: "temple", Architecture: "amd64"}},
+		{platform: &v1.Platform{OS: "darwin", Architecture: "s390x"}},
+		{platform: &v1.Platform{OS: "linux", Architecture: "s390x", Variant: "v1"}},
+		{platform: &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v9"}},
+		{platform: &v1.Platform{OS: "linux", Architecture: "amd64", OSVersion: "5.10"}},
+	} {
+		err := ValidatePlatform(distribution.Descriptor{Digest: digest.FromString("m"), Platform: tc.platform})
+		if tc.valid && err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.platform, err)
+		} else if !tc.valid && err == nil {
+			t.Errorf("%v: expected an error", tc.platform)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	amd64 := platformDescriptor("amd64", v1.Platform{OS: "linux", Architecture: "amd64"})
+	arm := platformDescriptor("arm", v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})
+	attestation := platformDescriptor("attestation", v1.Platform{OS: "unknown", Architecture: "unknown"})
+	attestation.Annotations = map[string]string{AnnotationReferenceDigest: amd64.Digest.String()}
+
+	builder, err := NewManifestBuilder(v1.MediaTypeImageIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, desc := range []distribution.Descriptor{amd64, arm, attestation} {
+		if err := builder.AppendReference(desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	built, err := builder.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := built.(*DeserializedManifestList)
+
+	// A new amd64 build replaces the previous one and its attestation.
+	newAMD64 := platformDescriptor("amd64-2", v1.Platform{OS: "linux", Architecture: "amd64"})
+	arm64 := platformDescriptor("arm64", v1.Platform{OS: "linux", Architecture: "arm64"})
+	updated, err := Update(list, []distribution.Descriptor{newAMD64, arm64}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.MediaType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected media type %q", updated.MediaType)
+	}
+	var got []digest.Digest
+	for _, desc := range updated.References() {
+		got = append(got, desc.Digest)
+	}
+	want := []digest.Digest{newAMD64.Digest, arm.Digest, arm64.Digest}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected manifests %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected manifests %v, want %v", got, want)
+		}
+	}
+	if len(list.Manifests) != 3 {
+		t.Fatalf("the original manifest list was modified")
+	}
+
+	updated, err = Update(updated, nil, []digest.Digest{arm.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Manifests) != 2 {
+		t.Fatalf("expected 2 manifests after removal, got %d", len(updated.Manifests))
+	}
+
+	if _, err := Update(updated, nil, []digest.Digest{arm.Digest}); err == nil {
+		t.Fatalf("expected an error removing a manifest not in the list")
+	}
+	if _, err := Update(updated, nil, []digest.Digest{newAMD64.Digest, arm64.Digest}); err == nil {
+		t.Fatalf("expected an error removing every manifest")
+	}
+	invalid := platformDescriptor("invalid", v1.Platform{OS: "linux", Architecture: "wasm"})
+	if _, err := Update(updated, []distribution.Descriptor{invalid}, nil); err == nil {
+		t.Fatalf("expected an error adding a manifest with an invalid platform")
+	}
+}
@@ -121,6 +121,17 @@ type ManifestList struct {
 
 	// Manifests references a list of manifests
 	Manifests []ManifestDescriptor `json:"manifests"`
+
+	// ArtifactType specifies the type of artifact packaged by an OCI image
+	// index.
+	ArtifactType string `json:"artifactType,omitempty"`
+
+	// Subject specifies the descriptor of another manifest, which an OCI
+	// image index refers to. This value is used by the referrers API.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
+
+	// Annotations contains arbitrary metadata for an OCI image index.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // References returns the distribution descriptors for the referenced image
@@ -279,6 +279,39 @@ func TestOCIImageIndex(t *testing.T) {
 	}
 }
 
+func TestOCIImageIndexSubject(t *testing.T) {
+	index := []byte(`{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.oci.image.index.v1+json",
+   "artifactType": "application/vnd.example.attestations",
+   "manifests": [],
+   "subject": {
+      "mediaType": "application/vnd.oci.image.index.v1+json",
+      "digest": "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
+      "size": 985
+   },
+   "annotations": {
+      "org.example.bundle": "attestations"
+   }
+}`)
+
+	unmarshalled, _, err := distribution.UnmarshalManifest(v1.MediaTypeImageIndex, index)
+	if err != nil {
+		t.Fatalf("error unmarshaling image index: %v", err)
+	}
+	m := unmarshalled.(*DeserializedManifestList)
+	if m.ArtifactType != "application/vnd.example.attestations" || m.Annotations["org.example.bundle"] != "attestations" {
+		t.Fatalf("unexpected image index %+v", m.ManifestList)
+	}
+	if m.Subject == nil || m.Subject.Digest != "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b" {
+		t.Fatalf("unexpected subject %v", m.Subject)
+	}
+	// The subject is not a dependency of the index.
+	if references := m.References(); len(references) != 0 {
+		t.Fatalf("unexpected references %v", references)
+	}
+}
+
 func mediaTypeTest(t *testing.T, contentType string, mediaType string, shouldError bool) {
 	var m *DeserializedManifestList
 	if contentType == MediaTypeManifestList {
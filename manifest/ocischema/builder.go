@@ -1,6 +1,7 @@
 package ocischema
 
 import (
+	"bytes"
 	"context"
 	"errors"
 
@@ -22,6 +23,9 @@ type Builder struct {
 	// calls to AppendReference.
 	layers []distribution.Descriptor
 
+	// artifactType specifies the type of artifact packaged by the manifest.
+	artifactType string
+
 	// Subject specifies the descriptor of another manifest. This value is
 	// used by the referrers API.
 	subject *distribution.Descriptor
@@ -60,6 +64,18 @@ func (mb *Builder) SetMediaType(mediaType string) error {
 	return nil
 }
 
+// SetArtifactType sets the artifact type of the manifest. If the config is
+// the empty JSON object, it is referenced with MediaTypeEmptyJSON.
+func (mb *Builder) SetArtifactType(artifactType string) {
+	mb.artifactType = artifactType
+}
+
+// SetSubject sets the manifest referenced by this manifest through the
+// referrers API.
+func (mb *Builder) SetSubject(subject *distribution.Descriptor) {
+	mb.subject = subject
+}
+
 // Build produces a final manifest from the given references.
 func (mb *Builder) Build(ctx context.Context) (distribution.Manifest, error) {
 	m := Manifest{
@@ -67,13 +83,18 @@ func (mb *Builder) Build(ctx context.Context) (distribution.Manifest, error) {
 			SchemaVersion: 2,
 			MediaType:     mb.mediaType,
 		},
-		Layers:      make([]distribution.Descriptor, len(mb.layers)),
-		Subject:     mb.subject,
-		Annotations: mb.annotations,
+		ArtifactType: mb.artifactType,
+		Layers:       make([]distribution.Descriptor, len(mb.layers)),
+		Subject:      mb.subject,
+		Annotations:  mb.annotations,
 	}
 	copy(m.Layers, mb.layers)
 
 	configDigest := digest.FromBytes(mb.configJSON)
+	configMediaType := v1.MediaTypeImageConfig
+	if mb.artifactType != "" && bytes.Equal(mb.configJSON, []byte("{}")) {
+		configMediaType = MediaTypeEmptyJSON
+	}
 
 	var err error
 	m.Config, err = mb.bs.Stat(ctx, configDigest)
@@ -81,7 +102,7 @@ func (mb *Builder) Build(ctx context.Context) (distribution.Manifest, error) {
 	case nil:
 		// Override MediaType, since Put always replaces the specified media
 		// type with application/octet-stream in the descriptor it returns.
-		m.Config.MediaType = v1.MediaTypeImageConfig
+		m.Config.MediaType = configMediaType
 		return FromStruct(m)
 	case distribution.ErrBlobUnknown:
 		// nop
@@ -90,10 +111,10 @@ func (mb *Builder) Build(ctx context.Context) (distribution.Manifest, error) {
 	}
 
 	// Add config to the blob store
-	m.Config, err = mb.bs.Put(ctx, v1.MediaTypeImageConfig, mb.configJSON)
+	m.Config, err = mb.bs.Put(ctx, configMediaType, mb.configJSON)
 	// Override MediaType, since Put always replaces the specified media
 	// type with application/octet-stream in the descriptor it returns.
-	m.Config.MediaType = v1.MediaTypeImageConfig
+	m.Config.MediaType = configMediaType
 	if err != nil {
 		return nil, err
 	}
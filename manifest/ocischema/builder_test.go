@@ -2,6 +2,7 @@ package ocischema
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -171,3 +172,70 @@ func TestBuilder(t *testing.T) {
 		t.Fatal("References() does not match the descriptors added")
 	}
 }
+
+func TestBuilderArtifact(t *testing.T) {
+	subject := &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Size:      1234,
+		Digest:    digest.Digest("sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270"),
+	}
+	layer := distribution.Descriptor{
+		MediaType: "application/vnd.example.sbom.v1+json",
+		Size:      512,
+		Digest:    digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"),
+	}
+
+	bs := &mockBlobService{descriptors: make(map[digest.Digest]distribution.Descriptor)}
+	builder := NewManifestBuilder(bs, []byte("{}"), nil, nil).(*Builder)
+	builder.SetArtifactType("application/vnd.example.sbom.v1")
+	builder.SetSubject(subject)
+	if err := builder.AppendReference(layer); err != nil {
+		t.Fatalf("AppendReference returned error: %v", err)
+	}
+
+	built, err := builder.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Build returned error: %v", err)
+	}
+
+	_, canonical, err := built.Payload()
+	if err != nil {
+		t.Fatalf("Payload returned error: %v", err)
+	}
+	expected := `{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.oci.image.manifest.v1+json",
+   "artifactType": "application/vnd.example.sbom.v1",
+   "config": {
+      "mediaType": "application/vnd.oci.empty.v1+json",
+      "size": 2,
+      "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+   },
+   "layers": [
+      {
+         "mediaType": "application/vnd.example.sbom.v1+json",
+         "size": 512,
+         "digest": "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"
+      }
+   ],
+   "subject": {
+      "mediaType": "application/vnd.oci.image.manifest.v1+json",
+      "size": 1234,
+      "digest": "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270"
+   }
+}`
+	if string(canonical) != expected {
+		t.Fatalf("unexpected manifest serialization: %s", canonical)
+	}
+
+	var unmarshalled DeserializedManifest
+	if err := json.Unmarshal(canonical, &unmarshalled); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+	if unmarshalled.ArtifactType != "application/vnd.example.sbom.v1" {
+		t.Fatalf("unexpected artifact type: %s", unmarshalled.ArtifactType)
+	}
+	if !reflect.DeepEqual(unmarshalled.Subject, subject) {
+		t.Fatalf("unexpected subject: %v", unmarshalled.Subject)
+	}
+}
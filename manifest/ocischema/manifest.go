@@ -20,6 +20,10 @@ var (
 	}
 )
 
+// MediaTypeEmptyJSON is the media type of the empty JSON object used as the
+// config of manifests which package an artifact rather than an image.
+const MediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
+
 func init() {
 	ocischemaFunc := func(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
 		if err := validateManifest(b); err != nil {
@@ -44,6 +48,10 @@ func init() {
 type Manifest struct {
 	manifest.Versioned
 
+	// ArtifactType specifies the type of artifact packaged by the manifest.
+	// It is required when the config is the empty JSON object.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Config references the image configuration as a blob.
 	Config distribution.Descriptor `json:"config"`
 
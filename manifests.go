@@ -69,6 +69,15 @@ type ManifestEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(digest.Digest) error) error
 }
 
+// ResumableManifestEnumerator enables iterating over manifests in order,
+// resuming an interrupted iteration.
+type ResumableManifestEnumerator interface {
+	// EnumerateFrom calls ingester for each manifest after marker, or for
+	// each manifest if marker is empty. It returns the marker of the last
+	// manifest ingested, from which an interrupted iteration resumes.
+	EnumerateFrom(ctx context.Context, marker string, ingester func(digest.Digest) error) (string, error)
+}
+
 // Describable is an interface for descriptors
 type Describable interface {
 	Descriptor() Descriptor
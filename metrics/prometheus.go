@@ -13,4 +13,24 @@ var (
 
 	// NotificationsNamespace is the prometheus namespace of notification related metrics
 	NotificationsNamespace = metrics.NewNamespace(NamespacePrefix, "notifications", nil)
+
+	// GCNamespace is the prometheus namespace of garbage collection related metrics
+	GCNamespace = metrics.NewNamespace(NamespacePrefix, "gc", nil)
+
+	// BulkheadNamespace is the prometheus namespace of per-repository concurrency limit metrics
+	BulkheadNamespace = metrics.NewNamespace(NamespacePrefix, "bulkhead", nil)
+
+	// ShadowNamespace is the prometheus namespace of the metrics of requests mirrored to a shadow registry
+	ShadowNamespace = metrics.NewNamespace(NamespacePrefix, "shadow", nil)
+
+	// UploadsNamespace is the prometheus namespace of the metrics of uploads in progress
+	UploadsNamespace = metrics.NewNamespace(NamespacePrefix, "uploads", nil)
 )
+
+// ExtensionNamespace returns the prometheus namespace of the metrics of the
+// extension name, which prefixes them with registry_extension_<name>_ so that
+// they cannot clash with those of the registry or of other extensions. The
+// namespace must be registered once, after its metrics are created.
+func ExtensionNamespace(name string) *metrics.Namespace {
+	return metrics.NewNamespace(NamespacePrefix, "extension_"+name, nil)
+}
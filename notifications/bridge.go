@@ -6,6 +6,9 @@ import (
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ociartifact"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/uuid"
 	events "github.com/docker/go-events"
@@ -22,6 +25,7 @@ type bridge struct {
 }
 
 var _ Listener = &bridge{}
+var _ PolicyListener = &bridge{}
 
 // URLBuilder defines a subset of url builder to be used by the event listener.
 type URLBuilder interface {
@@ -68,7 +72,39 @@ func (b *bridge) ManifestPushed(repo reference.Named, sm distribution.Manifest,
 			break
 		}
 	}
-	return b.sink.Write(*manifestEvent)
+	if err := b.sink.Write(*manifestEvent); err != nil {
+		return err
+	}
+
+	subject, artifactType := referrerMetadata(sm)
+	if subject == nil {
+		return nil
+	}
+	referrerEvent := b.createEvent(EventActionReferrerPush)
+	referrerEvent.Target.Descriptor = manifestEvent.Target.Descriptor
+	referrerEvent.Target.Length = manifestEvent.Target.Length
+	referrerEvent.Target.Repository = manifestEvent.Target.Repository
+	referrerEvent.Target.URL = manifestEvent.Target.URL
+	referrerEvent.Target.Subject = subject.Digest
+	referrerEvent.Target.ArtifactType = artifactType
+	return b.sink.Write(*referrerEvent)
+}
+
+// referrerMetadata returns the subject of a manifest, nil if it has none,
+// and its artifact type, as reported by the referrers API.
+func referrerMetadata(sm distribution.Manifest) (*distribution.Descriptor, string) {
+	switch m := sm.(type) {
+	case *ocischema.DeserializedManifest:
+		if m.ArtifactType != "" {
+			return m.Subject, m.ArtifactType
+		}
+		return m.Subject, m.Config.MediaType
+	case *ociartifact.DeserializedManifest:
+		return m.Subject, m.ArtifactType
+	case *manifestlist.DeserializedManifestList:
+		return m.Subject, m.ArtifactType
+	}
+	return nil, ""
 }
 
 func (b *bridge) ManifestPulled(repo reference.Named, sm distribution.Manifest, options ...distribution.ManifestServiceOption) error {
@@ -119,6 +155,16 @@ func (b *bridge) TagDeleted(repo reference.Named, tag string) error {
 	return b.sink.Write(*event)
 }
 
+func (b *bridge) TagProtected(repo reference.Named, tag string, desc distribution.Descriptor) error {
+	event := b.createEvent(EventActionTagProtected)
+	event.Target.Repository = repo.Name()
+	event.Target.Tag = tag
+	event.Target.MediaType = desc.MediaType
+	event.Target.Digest = desc.Digest
+
+	return b.sink.Write(*event)
+}
+
 func (b *bridge) RepoDeleted(repo reference.Named) error {
 	event := b.createEvent(EventActionDelete)
 	event.Target.Repository = repo.Name()
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/manifest/schema1"
 	"github.com/distribution/distribution/v3/reference"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
@@ -11,6 +12,7 @@ import (
 	events "github.com/docker/go-events"
 	"github.com/docker/libtrust"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var (
@@ -88,6 +90,43 @@ func TestEventBridgeManifestPushedWithTag(t *testing.T) {
 	}
 }
 
+func TestEventBridgeReferrerPushed(t *testing.T) {
+	subject := digest.FromString("subject")
+	referrer, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: "application/vnd.example.signature",
+		Config:       distribution.Descriptor{MediaType: v1.MediaTypeImageConfig, Digest: digest.FromString("{}"), Size: 2},
+		Layers:       []distribution.Descriptor{},
+		Subject:      &distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: subject, Size: 1},
+	})
+	if err != nil {
+		t.Fatalf("error building referrer: %v", err)
+	}
+	_, referrerPayload, _ := referrer.Payload()
+	referrerDigest := digest.FromBytes(referrerPayload)
+
+	var actions []string
+	l := NewBridge(ub, source, actor, request, testSinkFn(func(event events.Event) error {
+		e := event.(Event)
+		actions = append(actions, e.Action)
+		if e.Target.Digest != referrerDigest || e.Target.Repository != repo {
+			t.Fatalf("unexpected event target: %#v", e.Target)
+		}
+		if e.Action == EventActionReferrerPush && (e.Target.Subject != subject || e.Target.ArtifactType != "application/vnd.example.signature") {
+			t.Fatalf("unexpected referrer event target: %#v", e.Target)
+		}
+		return nil
+	}), false)
+
+	repoRef, _ := reference.WithName(repo)
+	if err := l.ManifestPushed(repoRef, referrer); err != nil {
+		t.Fatalf("unexpected error notifying referrer push: %v", err)
+	}
+	if len(actions) != 2 || actions[0] != EventActionPush || actions[1] != EventActionReferrerPush {
+		t.Fatalf("unexpected event actions: %v", actions)
+	}
+}
+
 func TestEventBridgeManifestPulledWithTag(t *testing.T) {
 	l := createTestEnv(t, testSinkFn(func(event events.Event) error {
 		checkCommonManifest(t, EventActionPull, event)
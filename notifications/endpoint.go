@@ -18,6 +18,9 @@ type EndpointConfig struct {
 	IgnoredMediaTypes []string
 	Transport         *http.Transport `json:"-"`
 	Ignore            configuration.Ignore
+	// Preheat only notifies the endpoint of the pushes of tagged
+	// manifests.
+	Preheat bool
 }
 
 // defaults set any zero-valued fields to a reasonable default.
@@ -69,6 +72,9 @@ func NewEndpoint(name, url string, config EndpointConfig) *Endpoint {
 	endpoint.Sink = newEventQueue(endpoint.Sink, endpoint.metrics.eventQueueListener())
 	mediaTypes := append(config.Ignore.MediaTypes, config.IgnoredMediaTypes...)
 	endpoint.Sink = newIgnoredSink(endpoint.Sink, mediaTypes, config.Ignore.Actions)
+	if config.Preheat {
+		endpoint.Sink = newPreheatSink(endpoint.Sink)
+	}
 
 	register(&endpoint)
 	return &endpoint
@@ -6,6 +6,7 @@ import (
 
 	"github.com/distribution/distribution/v3"
 	events "github.com/docker/go-events"
+	"github.com/opencontainers/go-digest"
 )
 
 // EventAction constants used in action field of Event.
@@ -14,6 +15,14 @@ const (
 	EventActionPush   = "push"
 	EventActionMount  = "mount"
 	EventActionDelete = "delete"
+
+	// EventActionReferrerPush is the action of the events notifying the
+	// push of a manifest with a subject, in addition to its push event.
+	EventActionReferrerPush = "referrer.push"
+
+	// EventActionTagProtected is the action of the events auditing the
+	// refused attempts to create or move a protected tag.
+	EventActionTagProtected = "tag.protected"
 )
 
 const (
@@ -75,6 +84,12 @@ type Event struct {
 
 		// References provides the references descriptors.
 		References []distribution.Descriptor `json:"references,omitempty"`
+
+		// Subject is the digest of the subject of a referrer.
+		Subject digest.Digest `json:"subject,omitempty"`
+
+		// ArtifactType is the artifact type of a referrer.
+		ArtifactType string `json:"artifactType,omitempty"`
 	} `json:"target,omitempty"`
 
 	// Request covers the request that generated the event.
@@ -2,12 +2,14 @@ package notifications
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/distribution/distribution/v3/registry/loglevel"
 	events "github.com/docker/go-events"
 )
 
@@ -95,6 +97,7 @@ func (hs *httpSink) Write(event events.Event) error {
 	// endpoint.
 	switch {
 	case resp.StatusCode >= 200 && resp.StatusCode < 400:
+		loglevel.Logger(context.Background(), loglevel.Notifications).Debugf("%v: event delivered: %v", hs, resp.Status)
 		for _, listener := range hs.listeners {
 			listener.success(resp.StatusCode, event)
 		}
@@ -105,6 +108,7 @@ func (hs *httpSink) Write(event events.Event) error {
 
 		return nil
 	default:
+		loglevel.Logger(context.Background(), loglevel.Notifications).Debugf("%v: event unaccepted: %v", hs, resp.Status)
 		for _, listener := range hs.listeners {
 			listener.failure(resp.StatusCode, event)
 		}
@@ -32,6 +32,12 @@ type RepoListener interface {
 	RepoDeleted(repo reference.Named) error
 }
 
+// PolicyListener is notified of the requests refused by the policies of the
+// registry, to audit them. The listener created by NewBridge implements it.
+type PolicyListener interface {
+	TagProtected(repo reference.Named, tag string, desc distribution.Descriptor) error
+}
+
 // Listener combines all repository events into a single interface.
 type Listener interface {
 	ManifestListener
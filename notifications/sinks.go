@@ -128,7 +128,7 @@ type ignoredSink struct {
 }
 
 func newIgnoredSink(sink events.Sink, ignored []string, ignoreActions []string) events.Sink {
-	if len(ignored) == 0 {
+	if len(ignored) == 0 && len(ignoreActions) == 0 {
 		return sink
 	}
 
@@ -162,3 +162,27 @@ func (imts *ignoredSink) Write(event events.Event) error {
 func (imts *ignoredSink) Close() error {
 	return nil
 }
+
+// preheatSink only passes along the pushes of tagged manifests, which
+// peer-to-peer distribution systems preheat.
+type preheatSink struct {
+	events.Sink
+}
+
+func newPreheatSink(sink events.Sink) events.Sink {
+	return &preheatSink{Sink: sink}
+}
+
+// Write discards the events which are not pushes of tagged manifests.
+func (ps *preheatSink) Write(event events.Event) error {
+	e := event.(Event)
+	if e.Action != EventActionPush || e.Target.Tag == "" {
+		return nil
+	}
+
+	return ps.Sink.Write(event)
+}
+
+func (ps *preheatSink) Close() error {
+	return nil
+}
@@ -80,6 +80,7 @@ func TestIgnoredSink(t *testing.T) {
 		{[]string{"blob", "manifest"}, []string{"other"}, nil},
 		{[]string{"other"}, []string{"pull"}, blob},
 		{[]string{"other"}, []string{"pull", "push"}, nil},
+		{nil, []string{"push"}, nil},
 	}
 
 	for _, c := range cases {
@@ -122,6 +123,36 @@ func TestIgnoredSink(t *testing.T) {
 	}
 }
 
+func TestPreheatSink(t *testing.T) {
+	tagged := createTestEvent("push", "library/test", "manifest")
+	tagged.Target.Tag = "latest"
+	untagged := createTestEvent("push", "library/test", "manifest")
+	pulled := createTestEvent("pull", "library/test", "manifest")
+	pulled.Target.Tag = "latest"
+
+	for _, c := range []struct {
+		event    Event
+		expected events.Event
+	}{
+		{tagged, tagged},
+		{untagged, nil},
+		{pulled, nil},
+	} {
+		ts := &testSink{}
+		s := newPreheatSink(ts)
+
+		if err := s.Write(c.event); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+
+		ts.mu.Lock()
+		if !reflect.DeepEqual(ts.event, c.expected) {
+			t.Fatalf("unexpected event: %#v != %#v", ts.event, c.expected)
+		}
+		ts.mu.Unlock()
+	}
+}
+
 type testSink struct {
 	event  events.Event
 	count  int
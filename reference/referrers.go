@@ -0,0 +1,114 @@
+package reference
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// ReferrersTagAlgorithmMax is the maximum number of characters of the
+	// digest algorithm kept in a referrers fallback tag.
+	ReferrersTagAlgorithmMax = 32
+
+	// ReferrersTagEncodedMax is the maximum number of characters of the
+	// encoded digest kept in a referrers fallback tag.
+	ReferrersTagEncodedMax = 64
+)
+
+var (
+	// ErrReferrersTagInvalidFormat is returned when a tag does not follow the
+	// referrers fallback tag schema.
+	ErrReferrersTagInvalidFormat = errors.New("invalid referrers tag format")
+
+	// ErrReferrersTagTruncated is returned when a referrers fallback tag holds
+	// a truncated digest, which cannot be turned back into a digest.
+	ErrReferrersTagTruncated = errors.New("referrers tag holds a truncated digest")
+)
+
+// ReferrersTag returns the referrers fallback tag for the given subject
+// digest, as defined by the OCI distribution specification for registries
+// without support for the referrers API. The tag has the form
+// <alg>-<encoded>, with the algorithm truncated to ReferrersTagAlgorithmMax
+// and the encoded digest truncated to ReferrersTagEncodedMax characters so
+// that the result always fits the tag length limit.
+func ReferrersTag(dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", err
+	}
+
+	alg := dgst.Algorithm().String()
+	if len(alg) > ReferrersTagAlgorithmMax {
+		alg = alg[:ReferrersTagAlgorithmMax]
+	}
+	encoded := dgst.Encoded()
+	if len(encoded) > ReferrersTagEncodedMax {
+		encoded = encoded[:ReferrersTagEncodedMax]
+	}
+
+	tag := alg + "-" + encoded
+	if !anchoredTagRegexp.MatchString(tag) {
+		return "", ErrTagInvalidFormat
+	}
+	return tag, nil
+}
+
+// ParseReferrersTag parses a referrers fallback tag back into the subject
+// digest. ErrReferrersTagTruncated is returned if the tag was built from a
+// digest whose encoded form exceeded ReferrersTagEncodedMax characters; use
+// MatchesReferrersTag to compare such tags.
+func ParseReferrersTag(tag string) (digest.Digest, error) {
+	alg, encoded, err := splitReferrersTag(tag)
+	if err != nil {
+		return "", err
+	}
+
+	algorithm := digest.Algorithm(alg)
+	if !algorithm.Available() {
+		return "", digest.ErrDigestUnsupported
+	}
+	if len(encoded) < algorithm.Size()*2 && len(encoded) == ReferrersTagEncodedMax {
+		return "", ErrReferrersTagTruncated
+	}
+
+	dgst := digest.NewDigestFromEncoded(algorithm, encoded)
+	if err := dgst.Validate(); err != nil {
+		return "", err
+	}
+	return dgst, nil
+}
+
+// MatchesReferrersTag reports whether tag is the referrers fallback tag of
+// the given digest. Unlike ParseReferrersTag, it handles truncated tags.
+func MatchesReferrersTag(tag string, dgst digest.Digest) bool {
+	expected, err := ReferrersTag(dgst)
+	if err != nil {
+		return false
+	}
+	return tag == expected
+}
+
+// splitReferrersTag splits a referrers fallback tag into its algorithm and
+// encoded parts. The encoded part never contains a dash, so the last dash
+// separates them.
+func splitReferrersTag(tag string) (string, string, error) {
+	if !anchoredTagRegexp.MatchString(tag) {
+		return "", "", ErrTagInvalidFormat
+	}
+
+	i := strings.LastIndex(tag, "-")
+	if i <= 0 || i == len(tag)-1 {
+		return "", "", ErrReferrersTagInvalidFormat
+	}
+	alg, encoded := tag[:i], tag[i+1:]
+	if len(alg) > ReferrersTagAlgorithmMax || len(encoded) > ReferrersTagEncodedMax {
+		return "", "", ErrReferrersTagInvalidFormat
+	}
+	for _, c := range encoded {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", "", ErrReferrersTagInvalidFormat
+		}
+	}
+	return alg, encoded, nil
+}
@@ -0,0 +1,106 @@
+package reference
+
+import (
+	_ "crypto/sha512"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestReferrersTag(t *testing.T) {
+	sha256Digest := digest.FromString("subject")
+	sha512Digest := digest.SHA512.FromString("subject")
+
+	for _, tc := range []struct {
+		digest   digest.Digest
+		expected string
+		err      error
+	}{
+		{
+			digest:   sha256Digest,
+			expected: "sha256-" + sha256Digest.Encoded(),
+		},
+		{
+			digest:   sha512Digest,
+			expected: "sha512-" + sha512Digest.Encoded()[:ReferrersTagEncodedMax],
+		},
+		{
+			digest: "sha256:invalid",
+			err:    digest.ErrDigestInvalidLength,
+		},
+		{
+			digest: "",
+			err:    digest.ErrDigestInvalidFormat,
+		},
+	} {
+		tag, err := ReferrersTag(tc.digest)
+		if err != tc.err {
+			t.Errorf("%q: expected error %v, got %v", tc.digest, tc.err, err)
+			continue
+		}
+		if tag != tc.expected {
+			t.Errorf("%q: expected tag %q, got %q", tc.digest, tc.expected, tag)
+		}
+		if err == nil && !MatchesReferrersTag(tag, tc.digest) {
+			t.Errorf("%q: tag %q does not match its digest", tc.digest, tag)
+		}
+	}
+}
+
+func TestParseReferrersTag(t *testing.T) {
+	sha256Digest := digest.FromString("subject")
+	sha512Digest := digest.SHA512.FromString("subject")
+
+	for _, tc := range []struct {
+		tag      string
+		expected digest.Digest
+		err      error
+	}{
+		{
+			tag:      "sha256-" + sha256Digest.Encoded(),
+			expected: sha256Digest,
+		},
+		{
+			tag: "sha512-" + sha512Digest.Encoded()[:ReferrersTagEncodedMax],
+			err: ErrReferrersTagTruncated,
+		},
+		{
+			tag: "latest",
+			err: ErrReferrersTagInvalidFormat,
+		},
+		{
+			tag: "sha256-" + strings.ToUpper(sha256Digest.Encoded()),
+			err: ErrReferrersTagInvalidFormat,
+		},
+		{
+			tag: "sha256-",
+			err: ErrReferrersTagInvalidFormat,
+		},
+		{
+			tag: "-" + sha256Digest.Encoded(),
+			err: ErrTagInvalidFormat,
+		},
+		{
+			tag: "md5-" + sha256Digest.Encoded()[:32],
+			err: digest.ErrDigestUnsupported,
+		},
+		{
+			tag: "sha256-" + sha256Digest.Encoded()[:32],
+			err: digest.ErrDigestInvalidLength,
+		},
+	} {
+		dgst, err := ParseReferrersTag(tc.tag)
+		if err != tc.err {
+			t.Errorf("%q: expected error %v, got %v", tc.tag, tc.err, err)
+			continue
+		}
+		if dgst != tc.expected {
+			t.Errorf("%q: expected digest %q, got %q", tc.tag, tc.expected, dgst)
+		}
+	}
+
+	if !MatchesReferrersTag("sha512-"+sha512Digest.Encoded()[:ReferrersTagEncodedMax], sha512Digest) {
+		t.Error("truncated sha512 tag does not match its digest")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/distribution/distribution/v3/reference"
+	"github.com/opencontainers/go-digest"
 )
 
 // Scope defines the set of items that match a namespace.
@@ -59,6 +60,15 @@ type RepositoryRemover interface {
 	Remove(ctx context.Context, name reference.Named) error
 }
 
+// ReferrersLister is implemented by repositories able to list the manifests
+// which declare a given manifest as their subject.
+type ReferrersLister interface {
+	// Referrers returns descriptors of the manifests referring to subject.
+	// If artifactTypes are given, only referrers of one of those artifact
+	// types are returned.
+	Referrers(ctx context.Context, subject digest.Digest, artifactTypes ...string) ([]Descriptor, error)
+}
+
 // ManifestServiceOption is a function argument for Manifest Service methods
 type ManifestServiceOption interface {
 	Apply(ManifestService) error
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync/atomic"
 )
 
 // ErrorCoder is the base interface for ErrorCode and Error allowing
@@ -95,12 +96,39 @@ func (ec ErrorCode) WithArgs(args ...interface{}) Error {
 	}.WithArgs(args...)
 }
 
+// DocURL returns the URL documenting this error code, or "" if no
+// documentation base is set.
+func (ec ErrorCode) DocURL() string {
+	base, _ := docBase.Load().(string)
+	if base == "" {
+		return ""
+	}
+	return base + strings.ToLower(ec.String())
+}
+
+// docBase holds the base of the documentation URLs of the error codes.
+var docBase atomic.Value
+
+// SetDocumentationBase sets the base of the URLs documenting the error codes,
+// which are included in serialized errors. The URL of an error code is the
+// base followed by its lowercased value, such as
+// https://example.com/errors#manifest_invalid for a base of
+// https://example.com/errors#. An empty base leaves the URLs out.
+func SetDocumentationBase(base string) {
+	docBase.Store(base)
+}
+
 // Error provides a wrapper around ErrorCode with extra Details provided.
 type Error struct {
 	Code    ErrorCode   `json:"code"`
 	Message string      `json:"message"`
 	Detail  interface{} `json:"detail,omitempty"`
 
+	// DocURL points to the documentation of the error code, explaining how
+	// to resolve it. It is set when errors are serialized, if a
+	// documentation base is set.
+	DocURL string `json:"docUrl,omitempty"`
+
 	// TODO(duglin): See if we need an "args" property so we can do the
 	// variable substitution right before showing the message to the user
 }
@@ -114,6 +142,9 @@ func (e Error) ErrorCode() ErrorCode {
 
 // Error returns a human readable representation of the error.
 func (e Error) Error() string {
+	if e.DocURL != "" {
+		return fmt.Sprintf("%s: %s (see %s)", e.Code.Error(), e.Message, e.DocURL)
+	}
 	return fmt.Sprintf("%s: %s", e.Code.Error(), e.Message)
 }
 
@@ -124,6 +155,7 @@ func (e Error) WithDetail(detail interface{}) Error {
 		Code:    e.Code,
 		Message: e.Message,
 		Detail:  detail,
+		DocURL:  e.DocURL,
 	}
 }
 
@@ -134,6 +166,7 @@ func (e Error) WithArgs(args ...interface{}) Error {
 		Code:    e.Code,
 		Message: fmt.Sprintf(e.Code.Message(), args...),
 		Detail:  e.Detail,
+		DocURL:  e.DocURL,
 	}
 }
 
@@ -224,10 +257,16 @@ func (errs Errors) MarshalJSON() ([]byte, error) {
 			msg = err.Code.Message()
 		}
 
+		docURL := err.DocURL
+		if docURL == "" {
+			docURL = err.Code.DocURL()
+		}
+
 		tmpErrs.Errors = append(tmpErrs.Errors, Error{
 			Code:    err.Code,
 			Message: msg,
 			Detail:  err.Detail,
+			DocURL:  docURL,
 		})
 	}
 
@@ -249,15 +288,16 @@ func (errs *Errors) UnmarshalJSON(data []byte) error {
 	for _, daErr := range tmpErrs.Errors {
 		// If Message is empty or exactly matches the Code's message string
 		// then just use the Code, no need for a full Error struct
-		if daErr.Detail == nil && (daErr.Message == "" || daErr.Message == daErr.Code.Message()) {
+		if daErr.Detail == nil && daErr.DocURL == "" && (daErr.Message == "" || daErr.Message == daErr.Code.Message()) {
 			// Error's w/o details get converted to ErrorCode
 			newErrs = append(newErrs, daErr.Code)
 		} else {
-			// Error's w/ details are untouched
+			// Error's w/ details or documentation are untouched
 			newErrs = append(newErrs, Error{
 				Code:    daErr.Code,
 				Message: daErr.Message,
 				Detail:  daErr.Detail,
+				DocURL:  daErr.DocURL,
 			})
 		}
 	}
@@ -183,3 +183,45 @@ func TestErrorsManagement(t *testing.T) {
 	}
 
 }
+
+func TestErrorsDocumentation(t *testing.T) {
+	SetDocumentationBase("https://docs.example.com/errors#")
+	defer SetDocumentationBase("")
+
+	errs := Errors{ErrorCodeTest1, ErrorCodeTest2.WithDetail("data")}
+	p, err := json.Marshal(errs)
+	if err != nil {
+		t.Fatalf("error marshaling errors: %v", err)
+	}
+
+	expectedJSON := `{"errors":[` +
+		`{"code":"TEST1","message":"test error 1","docUrl":"https://docs.example.com/errors#test1"},` +
+		`{"code":"TEST2","message":"test error 2","detail":"data","docUrl":"https://docs.example.com/errors#test2"}` +
+		`]}`
+	if string(p) != expectedJSON {
+		t.Fatalf("unexpected json:\ngot:\n%q\n\nexpected:\n%q", string(p), expectedJSON)
+	}
+
+	// Documentation URLs are kept when errors are read back, even without
+	// a detail.
+	var unmarshaled Errors
+	if err := json.Unmarshal(p, &unmarshaled); err != nil {
+		t.Fatalf("unexpected error unmarshaling error envelope: %v", err)
+	}
+	e1, ok := unmarshaled[0].(Error)
+	if !ok {
+		t.Fatalf("expected an Error, got %#v", unmarshaled[0])
+	}
+	if e1.DocURL != "https://docs.example.com/errors#test1" {
+		t.Fatalf("unexpected documentation url %q", e1.DocURL)
+	}
+	exp := "test1: test error 1 (see https://docs.example.com/errors#test1)"
+	if e1.Error() != exp {
+		t.Fatalf("Error() didn't return the right string, got:%s\nexpected:%s", e1.Error(), exp)
+	}
+
+	SetDocumentationBase("")
+	if url := ErrorCodeTest1.DocURL(); url != "" {
+		t.Fatalf("unexpected documentation url %q without a base", url)
+	}
+}
@@ -95,6 +95,13 @@ var (
 		Format:      `<<url>?n=<last n value>&last=<last entry from response>>; rel="next"`,
 	}
 
+	referrersETagHeader = ParameterDescriptor{
+		Name:        "Etag",
+		Type:        "string",
+		Description: "The digest of the page of referrers and of its link to the next page, to send back in the If-None-Match header to check for changes.",
+		Format:      `"<digest>"`,
+	}
+
 	paginationParameters = []ParameterDescriptor{
 		{
 			Name:        "n",
@@ -112,6 +119,48 @@ var (
 		},
 	}
 
+	// trustDomain matches the registry host leading the globally unique
+	// names of content trust data, as Docker clients name them: a host name
+	// with a dot or a port, or localhost.
+	trustDomain = `(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)+(?::[0-9]+)?|[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?:[0-9]+|localhost(?::[0-9]+)?)`
+
+	trustPathParameters = []ParameterDescriptor{
+		{
+			Name:        "domain",
+			Type:        "string",
+			Format:      "<registry host>",
+			Required:    true,
+			Description: "The registry host leading the globally unique name of the trust data. It must be the host of the configured `http.host`, or the host of the request if none is configured.",
+		},
+		nameParameterDescriptor,
+		{
+			Name:        "trust",
+			Type:        "path",
+			Format:      "<path>",
+			Required:    true,
+			Description: "The path of the request under `_trust/` in the Notary API, such as `tuf/root.json`.",
+		},
+	}
+
+	trustFailures = []ResponseDescriptor{
+		{
+			Name:        "Content Trust Disabled",
+			Description: "No Notary server is configured.",
+			StatusCode:  http.StatusMethodNotAllowed,
+			ErrorCodes: []errcode.ErrorCode{
+				errcode.ErrorCodeUnsupported,
+			},
+			Body: BodyDescriptor{
+				ContentType: "application/json",
+				Format:      errorsBody,
+			},
+		},
+		unauthorizedResponseDescriptor,
+		repositoryNotFoundResponseDescriptor,
+		deniedResponseDescriptor,
+		tooManyRequestsDescriptor,
+	}
+
 	unauthorizedResponseDescriptor = ResponseDescriptor{
 		Name:        "Authentication Required",
 		StatusCode:  http.StatusUnauthorized,
@@ -176,6 +225,19 @@ var (
 		},
 	}
 
+	tagProtectedResponseDescriptor = ResponseDescriptor{
+		Name:        "Tag Protected",
+		StatusCode:  http.StatusForbidden,
+		Description: "A tag protection rule does not allow the client to create or move the tag.",
+		Body: BodyDescriptor{
+			ContentType: "application/json",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeTagProtected,
+		},
+	}
+
 	tooManyRequestsDescriptor = ResponseDescriptor{
 		Name:        "Too Many Requests",
 		StatusCode:  http.StatusTooManyRequests,
@@ -218,7 +280,8 @@ const (
 	    {
             "code": <error code>,
             "message": "<error message>",
-            "detail": ...
+            "detail": ...,
+            "docUrl": "<documentation url>"
         },
         ...
     ]
@@ -613,11 +676,15 @@ var routeDescriptors = []RouteDescriptor{
 									ErrorCodeManifestInvalid,
 									ErrorCodeManifestUnverified,
 									ErrorCodeBlobUnknown,
+									ErrorCodeArtifactTypeDenied,
+									ErrorCodeSubjectInvalid,
+									ErrorCodeReferrersLimitExceeded,
 								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							tagProtectedResponseDescriptor,
 							tooManyRequestsDescriptor,
 							{
 								Name:        "Missing Layer(s)",
@@ -1608,6 +1675,14 @@ var routeDescriptors = []RouteDescriptor{
 					{
 						Name:        "Referrers",
 						Description: "Request an unabridged list of referrers.",
+						Headers: []ParameterDescriptor{
+							{
+								Name:        "If-None-Match",
+								Type:        "string",
+								Description: "The Etag of a previous response. If the page of referrers did not change, the registry responds with 304 Not Modified and no body.",
+								Format:      `"<digest>"`,
+							},
+						},
 						Successes: []ResponseDescriptor{
 							{
 								Description: "Returns an image index containing all referrers as a json response.",
@@ -1620,6 +1695,7 @@ var routeDescriptors = []RouteDescriptor{
 										Format:      "<length>",
 									},
 									linkHeader,
+									referrersETagHeader,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/vnd.oci.image.index.v1+json",
@@ -1633,6 +1709,13 @@ var routeDescriptors = []RouteDescriptor{
 }`,
 								},
 							},
+							{
+								Description: "The page of referrers did not change since the response whose Etag was sent in the If-None-Match header.",
+								StatusCode:  http.StatusNotModified,
+								Headers: []ParameterDescriptor{
+									referrersETagHeader,
+								},
+							},
 						},
 						Failures: []ResponseDescriptor{
 							{
@@ -1658,15 +1741,22 @@ var routeDescriptors = []RouteDescriptor{
 						// may need to change to accommodate multiple filters applied.
 						// spec is not clear regarding applying multiple filters
 						Name:        "referrers with filtering",
-						Description: "Request a list of referrers filtered on artifact type.",
+						Description: "Request a list of referrers filtered on artifact type and annotations.",
 						QueryParameters: []ParameterDescriptor{
 							{
 								Name:        "artifactType",
 								Type:        "string",
-								Description: "This is the artifact type to be appied on the filter.",
+								Description: "The artifact types of the referrers to list, separated by commas. May be repeated, in which case referrers of any of the artifact types are listed.",
 								Format:      "<string>",
 								Required:    false,
 							},
+							{
+								Name:        "annotation",
+								Type:        "string",
+								Description: "An annotation the referrers must carry, with the given value, or with any value if only the key is given. May be repeated, in which case the referrers must carry all of the annotations.",
+								Format:      "<key>=<value>",
+								Required:    false,
+							},
 						},
 						Successes: []ResponseDescriptor{
 							{
@@ -1680,6 +1770,7 @@ var routeDescriptors = []RouteDescriptor{
 										Format:      "<length>",
 									},
 									linkHeader,
+									referrersETagHeader,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/vnd.oci.image.index.v1+json",
@@ -1719,11 +1810,1866 @@ var routeDescriptors = []RouteDescriptor{
 							tooManyRequestsDescriptor,
 						},
 					},
+					{
+						Name:        "Referrers Paginated",
+						Description: "Return a portion of the referrers. Referrers are listed newest first, by their `org.opencontainers.image.created` annotation, then in the order of their digests, those without the annotation last; the order is the same across requests, so pages follow each other. Without `n`, all referrers are returned.",
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "n",
+								Type:        "integer",
+								Description: "Limit the number of referrers in each response.",
+								Format:      "<integer>",
+								Required:    false,
+							},
+							{
+								Name:        "last",
+								Type:        "digest",
+								Description: "Result set will include the referrers listed after the referrer whose digest is last. An error is returned if it is no longer a referrer.",
+								Format:      "<digest>",
+								Required:    false,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "Returns an image index containing a portion of the referrers as a json response. The `Link` header points to the next portion, keeping the filters of the request.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+									referrersETagHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.oci.image.index.v1+json",
+									Format: `{
+	"schemaVersion": 2,
+	"mediaType": "application/vnd.oci.image.index.v1+json",
+	"manifests": [
+		<manifest>,
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The received parameter n or last was invalid in some way, as described by the error code. The client should resolve the issue and retry the request.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodePaginationNumberInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "HEAD",
+				Description: "Count the referrers of the artifact identified by `digest` by artifact type, without listing them. The `artifactType` and `annotation` filters of `GET` apply.",
+				Requests: []RequestDescriptor{
+					{
+						Name:        "Referrers Count",
+						Description: "Request the number of referrers.",
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The referrers are counted in the headers, without a body.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "OCI-Referrers-Count",
+										Type:        "integer",
+										Description: "The number of referrers.",
+										Format:      "<count>",
+									},
+									{
+										Name:        "OCI-Referrers-Summary",
+										Type:        "string",
+										Description: "The number of referrers of each artifact type, sorted by artifact type. Absent if there are no referrers.",
+										Format:      "<artifactType>=<count>, ...",
+									},
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `digest`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+							},
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
 				},
 			},
 		},
 	},
-}
+	{
+		Name:        RouteNameGlobalReferrers,
+		Path:        "/v2/_distribution/referrers/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Global Referrers",
+		Description: "List the referrers of a subject across the repositories of the registry. The global referrers index must be enabled in the registry configuration.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the referrers of the artifact identified by `digest` in every repository the client may pull from, sorted by repository then digest.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Global Referrers",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							digestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "artifactType",
+								Type:        "string",
+								Description: "The artifact types of the referrers to list, separated by commas. May be repeated.",
+								Format:      "<artifactType>",
+								Required:    false,
+							},
+							{
+								Name:        "annotation",
+								Type:        "string",
+								Description: "An annotation the referrers must carry, as `<key>=<value>` or `<key>`. May be repeated.",
+								Format:      "<key>=<value>",
+								Required:    false,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The referrers of the subject. Repositories the client may not pull from are left out.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"subject": <digest>,
+	"referrers": [
+		{
+			"repository": <name>,
+			"mediaType": <media type>,
+			"digest": <digest>,
+			"size": <size>,
+			"artifactType": <artifact type>,
+			"annotations": {<key>: <value>, ...}
+		},
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Digest",
+								Description: "The `digest` is not a valid digest.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Global Referrers Disabled",
+								Description: "The global referrers index is not enabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameIndex,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/index",
+		Entity:      "Index",
+		Description: "Assemble image indexes from manifests already pushed to the repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Build an image index referencing the given child manifests and store it in the repository. The registry validates that every child manifest exists and carries a valid, unique platform.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Assemble Index",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"mediaType": "application/vnd.oci.image.index.v1+json",
+	"tag": <tag>,
+	"manifests": [
+		{
+			"digest": <digest>,
+			"platform": {
+				"os": <os>,
+				"architecture": <architecture>,
+				"variant": <variant>
+			}
+		},
+		...
+	]
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The index has been stored and, if requested, tagged.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the stored index.",
+										Format:      "<url>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Index",
+								Description: "The request body was invalid or a child manifest has an invalid or duplicate platform.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
+									ErrorCodeManifestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Manifest",
+								Description: "A child manifest referenced by the request does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tagProtectedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameIndexUpdate,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/index/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Index",
+		Description: "Update image indexes already pushed to the repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "PATCH",
+				Description: "Store a copy of the index identified by `reference` without the child manifests listed in `remove` and with those of `add`. An added manifest replaces the manifest for the same platform, and attestation manifests describing a removed or replaced manifest are removed as well. If `reference` is a tag, or `tag` is set, the tag is pointed at the new index.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Update Index",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"tag": <tag>,
+	"add": [
+		{
+			"digest": <digest>,
+			"platform": {
+				"os": <os>,
+				"architecture": <architecture>,
+				"variant": <variant>
+			}
+		},
+		...
+	],
+	"remove": [<digest>, ...]
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The updated index has been stored and, if requested, tagged.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the updated index.",
+										Format:      "<url>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Update",
+								Description: "The request body was invalid, the manifest identified by `reference` is not an index, a removed manifest is not in the index or an added manifest has an invalid platform.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
+									ErrorCodeManifestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Manifest",
+								Description: "The index or an added manifest does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tagProtectedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAnnotations,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/annotations/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Annotations",
+		Description: "Update the annotations of manifests already pushed to the repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "PATCH",
+				Description: "Store a copy of the OCI image manifest, image index or artifact manifest identified by `reference` with the annotations of `set` added or replaced and those listed in `remove` removed. The rest of the manifest is left unchanged, so its blobs need not be uploaded again. If `reference` is a tag, or `tag` is set, the tag is pointed at the new manifest once it is stored.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Update Annotations",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"tag": <tag>,
+	"set": {
+		<key>: <value>,
+		...
+	},
+	"remove": [<key>, ...]
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The updated manifest has been stored and, if requested, tagged.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the updated manifest.",
+										Format:      "<url>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Update",
+								Description: "The request body was invalid, or the manifest identified by `reference` does not support annotations.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeManifestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Manifest",
+								Description: "The manifest does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameShare,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/share/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Share",
+		Description: "Issue share links granting clients without credentials pull access to a manifest.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Issue a share link for the manifest identified by `reference`. A tag is resolved to the manifest it points at when the link is issued. Requests for the manifest, by digest, and for the manifests and blobs it references are authorized without credentials when they carry the token of the link in the `share` query parameter, until the link expires. The manifest of a pull-once link can only be fetched once.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Issue Share Link",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"expiry": <duration>,
+	"once": <true|false>
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The share link has been issued.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Type",
+										Type:        "string",
+										Description: "The share link is returned as JSON.",
+										Format:      "application/json",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      shareLinkBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Unknown Manifest",
+								Description: "The manifest does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Invalid Request",
+								Description: "The request body was invalid or the expiry exceeds the longest allowed.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeShareRequestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Share Links Disabled",
+								Description: "Share links are not enabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameGraph,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/graph",
+		Entity:      "Graph",
+		Description: "Export the dependency graph of the manifests, blobs and referrers of a repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the dependency graph of the manifests identified by the `digest` parameters, or of all manifests of the repository. Manifests are followed to the manifests and blobs they reference and to their referrers.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Graph",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Accept",
+								Type:        "string",
+								Description: "Set to `text/vnd.graphviz` to fetch the graph in the Graphviz DOT language rather than as JSON.",
+								Format:      "text/vnd.graphviz",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "digest",
+								Description: "Digest of a manifest to start the graph from. May be repeated.",
+								Format:      "<digest>",
+								Required:    false,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The dependency graph of the repository.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repository": <name>,
+	"nodes": [
+		{
+			"kind": "manifest" | "blob",
+			"digest": <digest>,
+			"mediaType": <media type>,
+			"size": <size>,
+			"tags": [<tag>, ...]
+		},
+		...
+	],
+	"edges": [
+		{
+			"kind": "reference" | "subject",
+			"from": <digest>,
+			"to": <digest>
+		},
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Digest",
+								Description: "A `digest` parameter is not a valid digest.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Manifest",
+								Description: "A manifest given by a `digest` parameter does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameImpact,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/impact/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Impact",
+		Description: "Analyze what deleting a manifest or tag would affect, before deleting it.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch what deleting the manifest or tag identified by `reference` would affect, without deleting anything. Deleting a manifest by digest deletes every tag pointing at it, and leaves the indexes referencing it and its referrers dangling. Deleting a tag only deletes the tag, but may leave the manifest untagged.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Delete Impact",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "What deleting the manifest or tag would affect.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repository": <name>,
+	"digest": <digest>,
+	"tag": <tag>,
+	"tags": [<tag>, ...],
+	"untagged": <true if deleting the tag leaves the manifest untagged>,
+	"indexes": [<digest>, ...],
+	"referrers": [<digest>, ...]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Unknown Manifest",
+								Description: "The manifest or tag does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameTimeline,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/timeline",
+		Entity:      "Timeline",
+		Description: "List the recent events of a repository, such as the pushes and deletions of its manifests and tags, so that users can find out what happened to a tag.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the most recent events of the repository, most recent first. Events are recorded while the timeline is enabled in the configuration, and the oldest are dropped once the repository has more than the configured maximum.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Timeline",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "n",
+								Type:        "integer",
+								Description: "Limit the number of events returned. If not present, 100 events are returned.",
+								Format:      "<integer>",
+								Required:    false,
+							},
+							{
+								Name:        "tag",
+								Type:        "string",
+								Description: "Only return the events of this tag.",
+								Format:      "<tag>",
+								Required:    false,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The recent events of the repository. The action of each event is one of `push`, `tag.move`, `delete`, `gc.delete` and `rejected`.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repository": <name>,
+	"events": [
+		{
+			"timestamp": <time>,
+			"action": <action>,
+			"digest": <digest>,
+			"tag": <tag>,
+			"previous": <digest the tag pointed at before a tag.move>,
+			"actor": <user>,
+			"reason": <why the request was rejected>
+		},
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid pagination number",
+								Description: "The received parameter n was invalid in some way, as described by the error code. The client should resolve the issue and retry the request.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodePaginationNumberInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Timeline Disabled",
+								Description: "The timeline is not enabled in the configuration of the registry.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameBundle,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/bundle/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Bundle",
+		Description: "Download a manifest and the blobs it references in a single request.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Stream the manifest identified by `reference` and the blobs it references as a tar archive in the OCI image layout. The `index.json` file of the archive describes the manifest, which describes the blobs. Image indexes are not supported.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Bundle",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The archive of the manifest and its blobs.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/x-tar",
+									Format:      "<tar archive>",
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Manifest",
+								Description: "The name or reference was invalid, or the manifest is an image index.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeManifestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Manifest or Blob",
+								Description: "The manifest, or a blob it references, does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameHelmIndex,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/helm/index.yaml",
+		Entity:      "Helm Index",
+		Description: "Serve the Helm charts pushed to a repository as a classic Helm chart repository, whose URL is the path of this route without `/index.yaml`.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the `index.yaml` file listing the tagged Helm charts of the repository. The URLs of the charts are relative to the chart repository. The index is cached for up to a minute, until the repository is written to through the registry.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Helm Index",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The index of the charts of the repository.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/x-yaml",
+									Format: `apiVersion: v1
+entries:
+  <chart name>:
+  - name: <chart name>
+    version: <chart version>
+    digest: <hex digest of the chart archive>
+    urls:
+    - charts/<chart name>-<chart version>.tgz
+    ...
+generated: <time>`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameHelmChart,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/helm/charts/{chart:[A-Za-z0-9_.+-]+\\.tgz(?:\\.prov)?}",
+		Entity:      "Helm Chart",
+		Description: "Download a chart listed in the Helm index of a repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the archive `<chart name>-<chart version>.tgz` of a chart, or its provenance file if the name ends with `.prov`.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Helm Chart",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							{
+								Name:        "chart",
+								Type:        "string",
+								Format:      "<chart name>-<chart version>.tgz[.prov]",
+								Required:    true,
+								Description: "File name of the chart archive or provenance file.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The chart archive or provenance file.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob>",
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Unknown Chart",
+								Description: "No tagged chart of the repository has this file name, or the chart has no provenance file.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameFetch,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/fetch/",
+		Entity:      "Blob Fetch",
+		Description: "Have the registry fetch a blob from a URL, so that content already stored near the registry is not transferred through the client. Only the hosts allowed in the registry configuration may be fetched from.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Start fetching a blob into the repository. The fetch runs in the background, and its progress is polled at the returned `Location`.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Fetch Blob",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"url": <url>,
+	"digest": <digest>,
+	"size": <size>
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The fetch has started.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/_distribution/fetch/<uuid>",
+										Description: "The location of the status of the fetch.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      fetchStatusBody,
+								},
+							},
+							{
+								Description: "The blob already exists in the repository.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<blob location>",
+										Description: "The location of the blob.",
+									},
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Request",
+								Description: "The body is not a valid fetch request, its digest is invalid, or the blob is too large.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadInvalid,
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Fetches Disabled",
+								Description: "The registry is not configured to fetch blobs.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameFetchStatus,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_distribution/fetch/{uuid:[a-zA-Z0-9-_.=]+}",
+		Entity:      "Blob Fetch",
+		Description: "Poll the progress of a blob fetch. Clients should take this URL from the `Location` header of the request starting the fetch.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the status of the fetch identified by `uuid`.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Fetch Status",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The status of the fetch. Once it is complete, the `Location` header gives the location of the blob.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      fetchStatusBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Unknown Fetch",
+								Description: "The fetch is unknown to the registry, or finished too long ago.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeFetchUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAdminGC,
+		Path:        "/v2/_admin/gc",
+		Entity:      "Garbage Collection",
+		Description: "Run an online garbage collection of the registry. The endpoint must be enabled in the registry configuration, and requires an access controller granting access to the `registry:gc` resource.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Start a garbage collection. The collection runs in the background, and its progress is polled at the returned `Location`. Only one collection runs at a time.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Start Garbage Collection",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"dryRun": <bool>,
+	"removeUntagged": <bool>,
+	"includeRepositories": [<pattern>, ...],
+	"excludeRepositories": [<pattern>, ...]
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The garbage collection has started.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/_admin/gc/<uuid>",
+										Description: "The location of the status of the garbage collection.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      gcStatusBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Request",
+								Description: "The body is not a valid garbage collection request, or a repository pattern of the request is invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeGCRequestInvalid,
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Garbage Collection Disabled",
+								Description: "The endpoint is not enabled, or the registry is in read-only mode.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Garbage Collection Running",
+								Description: "Another garbage collection is running, or a freeze window covering every repository is open.",
+								StatusCode:  http.StatusServiceUnavailable,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnavailable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAdminGCStatus,
+		Path:        "/v2/_admin/gc/{uuid:[a-zA-Z0-9-_.=]+}",
+		Entity:      "Garbage Collection",
+		Description: "Poll the progress of a garbage collection. Clients should take this URL from the `Location` header of the request starting the collection.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the status of the garbage collection identified by `uuid`.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Garbage Collection Status",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							uuidParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The status of the garbage collection. Once it is complete, it includes the report of the collection.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      gcStatusBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Unknown Garbage Collection",
+								Description: "The garbage collection is unknown to the registry instance, or finished too long ago.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeGCUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAdminPreheat,
+		Path:        "/v2/_admin/preheat/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Preheat",
+		Description: "List the blobs of an image for peer-to-peer distribution systems preheating their caches. The endpoint must be enabled in the registry configuration, and requires an access controller granting pull access to the repository and access to the `registry:preheat` resource.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the blobs referenced by the manifest identified by `reference`, in the order of the manifest. The blobs of all the manifests of an image index are listed. Blob URLs are signed URLs of the storage backend when it supports them and redirects are enabled, and URLs of the registry otherwise.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Preheat",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blobs of the image.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"repository": <name>,
+	"tag": <tag>,
+	"digest": <manifest digest>,
+	"mediaType": <manifest media type>,
+	"blobs": [
+		{
+			"mediaType": <media type>,
+			"digest": <digest>,
+			"size": <size>,
+			"url": <url>
+		},
+		...
+	]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Name or Reference",
+								Description: "The name or reference was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Manifest or Blob",
+								Description: "The manifest, or a manifest or blob it references, does not exist in the repository.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Preheat Disabled",
+								Description: "The endpoint is not enabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAdminConfig,
+		Path:        "/v2/_admin/config",
+		Entity:      "Configuration",
+		Description: "Report the effective configuration of the registry instance, for diagnostics. The endpoint must be enabled in the registry configuration, and requires an access controller granting access to the `registry:config` resource.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the configuration the instance runs with, its enabled extensions with their options, and its feature flags. Values of secret parameters, such as passwords, keys and tokens, and the passwords of URLs, are redacted.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Configuration",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The configuration of the instance.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"version": <version>,
+	"configuration": <configuration>,
+	"extensions": {
+		<extension>: <options>,
+		...
+	},
+	"features": {
+		<feature>: <bool>,
+		...
+	}
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Configuration Disabled",
+								Description: "The endpoint is not enabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAdminLog,
+		Path:        "/v2/_admin/log",
+		Entity:      "Log Level",
+		Description: "Change the level of the logs of the registry instance at runtime, for a limited duration. The endpoint must be enabled in the registry configuration, and requires an access controller granting access to the `registry:log` resource.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Retrieve the level of the logs, the modules whose debug logs are enabled and when the override in effect expires.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Log Level",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The log level of the instance.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      logLevelBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							logLevelDisabledDescriptor,
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "PUT",
+				Description: "Override the level of the logs, and enable the debug logs of modules, `storage`, `auth` or `notifications`, for `duration`, replacing any override in effect. The level is left unchanged if it is not set. The duration defaults to 15 minutes.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Override Log Level",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"level": <level>,
+	"modules": [<module>, ...],
+	"duration": <duration>
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The override is in effect.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      logLevelBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Override",
+								Description: "The body is not a valid override, the level, a module or the duration of the override is invalid, or the duration exceeds the maximum of the configuration.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeLogRequestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Log Endpoint Disabled",
+								Description: "The endpoint is not enabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "End the override in effect, restoring the level of the logs of the configuration.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Reset Log Level",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The log level is restored.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      logLevelBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							logLevelDisabledDescriptor,
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameAdminMarkers,
+		Path:        "/v2/_admin/markers",
+		Entity:      "Consistency Markers",
+		Description: "Record consistency markers, with which snapshots of the storage of the registry, such as volume snapshots or checkpoints of bucket replication, are correlated with a state of the registry in which no write was in flight. The endpoint must be enabled in the registry configuration, and requires an access controller granting access to the `registry:markers` resource. Writes are only held on the instance serving the request.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Hold the writes to the registry instance, wait for those in flight to complete, record a consistency marker in the storage and resume the writes. The label of the request, if any, is recorded in the marker.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Record Marker",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+	"label": <label>
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The marker is recorded in the storage.",
+								StatusCode:  http.StatusCreated,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      consistencyMarkerBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Request",
+								Description: "The body of the request is invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeMarkerRequestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Markers Disabled",
+								Description: "The endpoint is not enabled, or the registry is in read-only mode.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Writes In Flight",
+								Description: "Another marker is being recorded, or writes were still in flight once the timeout of the configuration elapsed. No marker is recorded.",
+								StatusCode:  http.StatusServiceUnavailable,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnavailable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "GET",
+				Description: "List the consistency markers recorded in the storage, oldest first.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Markers",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The markers recorded in the storage.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"markers": [` + consistencyMarkerBody + `, ...]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Markers Disabled",
+								Description: "The endpoint is not enabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameTrust,
+		Path:        "/v2/{domain:" + trustDomain + "}/{name:" + reference.NameRegexp.String() + "}/_trust/{trust:.*}",
+		Entity:      "Content Trust",
+		Description: "Proxy the Notary API serving the content trust data of a repository, whose globally unique name is the registry host followed by the repository name, to the Notary server configured in the registry. Access is checked against the repository as for its manifests, so that Docker content trust works against the registry host with the same credentials.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch trust metadata or keys of the repository from the Notary server.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Trust Metadata",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: trustPathParameters,
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The response of the Notary server.",
+								StatusCode:  http.StatusOK,
+							},
+						},
+						Failures: trustFailures,
+					},
+				},
+			},
+			{
+				Method:      "POST",
+				Description: "Publish trust metadata of the repository, or rotate its keys, on the Notary server. Requires push access to the repository.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Publish Trust Metadata",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: trustPathParameters,
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The response of the Notary server.",
+								StatusCode:  http.StatusOK,
+							},
+						},
+						Failures: trustFailures,
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Delete the trust data of the repository from the Notary server. Requires delete access to the repository.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Delete Trust Data",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: trustPathParameters,
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The response of the Notary server.",
+								StatusCode:  http.StatusOK,
+							},
+						},
+						Failures: trustFailures,
+					},
+				},
+			},
+		},
+	},
+}
+
+// fetchStatusBody is the format of the status of a blob fetch.
+const fetchStatusBody = `{
+	"id": <uuid>,
+	"url": <url>,
+	"digest": <digest>,
+	"state": "running" | "complete" | "failed",
+	"bytesFetched": <bytes>,
+	"size": <size>,
+	"error": <message>
+}`
+
+// logLevelBody is the format of the log level of the registry.
+const logLevelBody = `{
+	"level": <level>,
+	"modules": [<module>, ...],
+	"expires": <time>
+}`
+
+// logLevelDisabledDescriptor is the failure of the log endpoint when it is
+// not enabled.
+var logLevelDisabledDescriptor = ResponseDescriptor{
+	Name:        "Log Level Disabled",
+	Description: "The endpoint is not enabled.",
+	StatusCode:  http.StatusMethodNotAllowed,
+	ErrorCodes: []errcode.ErrorCode{
+		errcode.ErrorCodeUnsupported,
+	},
+	Body: BodyDescriptor{
+		ContentType: "application/json",
+		Format:      errorsBody,
+	},
+}
+
+// shareLinkBody is the format of a share link.
+const shareLinkBody = `{
+	"token": <token>,
+	"digest": <digest>,
+	"expires": <time>,
+	"once": <true|false>,
+	"url": <url>
+}`
+
+// consistencyMarkerBody is the format of a consistency marker.
+const consistencyMarkerBody = `{
+	"id": <id>,
+	"label": <label>,
+	"instance": <instance id>,
+	"quiescedAt": <time>,
+	"createdAt": <time>,
+	"drainedWrites": <count>
+}`
+
+// gcStatusBody is the format of the status of a garbage collection.
+const gcStatusBody = `{
+	"id": <uuid>,
+	"state": "running" | "complete" | "failed",
+	"dryRun": <bool>,
+	"removeUntagged": <bool>,
+	"includeRepositories": [<pattern>, ...],
+	"excludeRepositories": [<pattern>, ...],
+	"startedAt": <time>,
+	"finishedAt": <time>,
+	"phase": "mark" | "sweep" | "done",
+	"completion": <fraction>,
+	"report": <report>,
+	"error": <message>
+}`
 
 var routeDescriptorsMap map[string]RouteDescriptor
 
@@ -63,6 +63,18 @@ var (
 		HTTPStatusCode: http.StatusBadRequest,
 	})
 
+	// ErrorCodeTagProtected is returned when a tag protection rule does not
+	// allow the client to create or move a tag.
+	ErrorCodeTagProtected = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TAG_PROTECTED",
+		Message: "tag is protected",
+		Description: `This error is returned when a tag matching a tag
+		protection rule is created or moved by a client which the rule does
+		not allow to. The detail will contain the tag and the pattern
+		protecting it.`,
+		HTTPStatusCode: http.StatusForbidden,
+	})
+
 	// ErrorCodeNameUnknown when the repository name is not known.
 	ErrorCodeNameUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "NAME_UNKNOWN",
@@ -114,6 +126,39 @@ var (
 		HTTPStatusCode: http.StatusBadRequest,
 	})
 
+	// ErrorCodeArtifactTypeDenied is returned when a manifest is pushed
+	// with an artifact type the registry does not accept.
+	ErrorCodeArtifactTypeDenied = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "ARTIFACT_TYPE_DENIED",
+		Message: "artifact type not accepted",
+		Description: `This error is returned when a manifest is pushed with an
+		artifact type that the registry policy does not accept. The detail
+		will contain the artifact type.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeReferrersLimitExceeded is returned when a manifest is pushed
+	// with a subject which already has the maximum number of referrers.
+	ErrorCodeReferrersLimitExceeded = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "REFERRERS_LIMIT_EXCEEDED",
+		Message: "too many referrers of subject",
+		Description: `This error is returned when a manifest is pushed with a
+		subject which already has as many referrers as the registry accepts.
+		The detail will contain the subject and the limit.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeSubjectInvalid is returned when the subject of a manifest is
+	// not a manifest.
+	ErrorCodeSubjectInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "SUBJECT_INVALID",
+		Message: "subject is not a manifest",
+		Description: `This error is returned when a manifest is pushed with a
+		subject whose media type is not the media type of a manifest.
+		Referrers may only refer to manifests.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
 	// ErrorCodeBlobUnknown is returned when a blob is unknown to the
 	// registry. This can happen when the manifest references a nonexistent
 	// layer or the result is not found by a blob fetch.
@@ -154,4 +199,69 @@ var (
 		to return) is not an integer, or "n" is negative.`,
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+
+	// ErrorCodeGCUnknown is returned when the garbage collection whose
+	// status is requested is unknown.
+	ErrorCodeGCUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "GC_UNKNOWN",
+		Message: "garbage collection unknown to registry",
+		Description: `Returned when the garbage collection whose status is
+		requested was never started on the registry instance, or finished
+		too long ago.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeGCRequestInvalid is returned when the body of a request
+	// starting a garbage collection is invalid.
+	ErrorCodeGCRequestInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "GC_REQUEST_INVALID",
+		Message: "invalid garbage collection request",
+		Description: `Returned when the body of a request starting a garbage
+		collection is not a valid JSON garbage collection request.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeShareRequestInvalid is returned when the body of a request
+	// issuing a share link is invalid.
+	ErrorCodeShareRequestInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "SHARE_REQUEST_INVALID",
+		Message: "invalid share link request",
+		Description: `Returned when the body of a request issuing a share
+		link is not a valid JSON share link request, or its expiry is
+		invalid or exceeds the longest allowed.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeLogRequestInvalid is returned when the body of a request
+	// overriding the log level is invalid.
+	ErrorCodeLogRequestInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "LOG_REQUEST_INVALID",
+		Message: "invalid log level request",
+		Description: `Returned when the body of a request overriding the log
+		level is not a valid JSON log level request, its level, a module or
+		its duration is invalid, or its duration exceeds the longest
+		allowed.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeMarkerRequestInvalid is returned when the body of a request
+	// recording a consistency marker is invalid.
+	ErrorCodeMarkerRequestInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "MARKER_REQUEST_INVALID",
+		Message: "invalid consistency marker request",
+		Description: `Returned when the body of a request recording a
+		consistency marker is not a valid JSON marker request.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeFetchUnknown is returned when the fetch whose status is
+	// requested is unknown.
+	ErrorCodeFetchUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "FETCH_UNKNOWN",
+		Message: "blob fetch unknown to registry",
+		Description: `Returned when the blob fetch whose status is requested
+		was never started in the repository on the registry instance, or
+		finished too long ago.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
 )
@@ -17,6 +17,26 @@ const (
 	RouteNameBlobUploadChunk = "blob-upload-chunk"
 	RouteNameCatalog         = "catalog"
 	RouteNameReferrers       = "referrers"
+	RouteNameGlobalReferrers = "global-referrers"
+	RouteNameIndex           = "index"
+	RouteNameIndexUpdate     = "index-update"
+	RouteNameAnnotations     = "annotations"
+	RouteNameShare           = "share"
+	RouteNameGraph           = "graph"
+	RouteNameImpact          = "impact"
+	RouteNameTimeline        = "timeline"
+	RouteNameBundle          = "bundle"
+	RouteNameHelmIndex       = "helm-index"
+	RouteNameHelmChart       = "helm-chart"
+	RouteNameFetch           = "fetch"
+	RouteNameFetchStatus     = "fetch-status"
+	RouteNameAdminGC         = "admin-gc"
+	RouteNameAdminGCStatus   = "admin-gc-status"
+	RouteNameAdminPreheat    = "admin-preheat"
+	RouteNameAdminConfig     = "admin-config"
+	RouteNameAdminLog        = "admin-log"
+	RouteNameAdminMarkers    = "admin-markers"
+	RouteNameTrust           = "trust"
 )
 
 var (
@@ -43,9 +63,10 @@ func RouterWithPrefix(prefix string) *mux.Router {
 		router = router.PathPrefix(prefix).Subrouter()
 	}
 
-	router.StrictSlash(true)
-
 	for _, descriptor := range routeDescriptors {
+		// The Notary API tells apart paths with and without a trailing
+		// slash, so they must not be redirected.
+		router.StrictSlash(descriptor.Name != RouteNameTrust)
 		router.Path(descriptor.Path).Name(descriptor.Name)
 	}
 
@@ -178,6 +178,187 @@ func TestRouter(t *testing.T) {
 				"digest": "sha256:abcdef0919234",
 			},
 		},
+		{
+			RouteName:  RouteNameIndex,
+			RequestURI: "/v2/foo/bar/_distribution/index",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameIndexUpdate,
+			RequestURI: "/v2/foo/bar/_distribution/index/latest",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "latest",
+			},
+		},
+		{
+			RouteName:  RouteNameIndexUpdate,
+			RequestURI: "/v2/foo/bar/_distribution/index/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			},
+		},
+		{
+			RouteName:  RouteNameAnnotations,
+			RequestURI: "/v2/foo/bar/_distribution/annotations/latest",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "latest",
+			},
+		},
+		{
+			RouteName:  RouteNameAnnotations,
+			RequestURI: "/v2/foo/bar/_distribution/annotations/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			},
+		},
+		{
+			RouteName:  RouteNameShare,
+			RequestURI: "/v2/foo/bar/_distribution/share/latest",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "latest",
+			},
+		},
+		{
+			RouteName:  RouteNameGraph,
+			RequestURI: "/v2/foo/bar/_distribution/graph",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameImpact,
+			RequestURI: "/v2/foo/bar/_distribution/impact/latest",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "latest",
+			},
+		},
+		{
+			RouteName:  RouteNameImpact,
+			RequestURI: "/v2/foo/bar/_distribution/impact/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			},
+		},
+		{
+			RouteName:  RouteNameTimeline,
+			RequestURI: "/v2/foo/bar/_distribution/timeline",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameBundle,
+			RequestURI: "/v2/foo/bar/_distribution/bundle/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			},
+		},
+		{
+			RouteName:  RouteNameHelmIndex,
+			RequestURI: "/v2/foo/bar/_distribution/helm/index.yaml",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameHelmChart,
+			RequestURI: "/v2/foo/bar/_distribution/helm/charts/bar-1.0.0+build.1.tgz.prov",
+			Vars: map[string]string{
+				"name":  "foo/bar",
+				"chart": "bar-1.0.0+build.1.tgz.prov",
+			},
+		},
+		{
+			RouteName:  RouteNameFetch,
+			RequestURI: "/v2/foo/bar/_distribution/fetch/",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameFetchStatus,
+			RequestURI: "/v2/foo/bar/_distribution/fetch/a3f8a1c1-8fbb-4c42-9b2a-fa3c0b8c9d5e",
+			Vars: map[string]string{
+				"name": "foo/bar",
+				"uuid": "a3f8a1c1-8fbb-4c42-9b2a-fa3c0b8c9d5e",
+			},
+		},
+		{
+			RouteName:  RouteNameGlobalReferrers,
+			RequestURI: "/v2/_distribution/referrers/sha256:abcdef0919234",
+			Vars: map[string]string{
+				"digest": "sha256:abcdef0919234",
+			},
+		},
+		{
+			RouteName:  RouteNameAdminGC,
+			RequestURI: "/v2/_admin/gc",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameAdminGCStatus,
+			RequestURI: "/v2/_admin/gc/a3f8a1c1-8fbb-4c42-9b2a-fa3c0b8c9d5e",
+			Vars: map[string]string{
+				"uuid": "a3f8a1c1-8fbb-4c42-9b2a-fa3c0b8c9d5e",
+			},
+		},
+		{
+			RouteName:  RouteNameAdminPreheat,
+			RequestURI: "/v2/_admin/preheat/foo/bar/manifests/latest",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "latest",
+			},
+		},
+		{
+			RouteName:  RouteNameAdminConfig,
+			RequestURI: "/v2/_admin/config",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameAdminLog,
+			RequestURI: "/v2/_admin/log",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameAdminMarkers,
+			RequestURI: "/v2/_admin/markers",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameTrust,
+			RequestURI: "/v2/registry.example.com:5000/foo/bar/_trust/tuf/root.json",
+			Vars: map[string]string{
+				"domain": "registry.example.com:5000",
+				"name":   "foo/bar",
+				"trust":  "tuf/root.json",
+			},
+		},
+		{
+			RouteName:  RouteNameTrust,
+			RequestURI: "/v2/localhost/foo/_trust/tuf/",
+			Vars: map[string]string{
+				"domain": "localhost",
+				"name":   "foo",
+				"trust":  "tuf/",
+			},
+		},
+		{
+			// Trust data is only named after a registry host.
+			RouteName:  RouteNameTrust,
+			RequestURI: "/v2/foo/bar/_trust/tuf/root.json",
+			StatusCode: http.StatusNotFound,
+		},
 	}
 
 	checkTestRouter(t, testCases, "", true)
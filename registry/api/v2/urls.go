@@ -8,6 +8,7 @@ import (
 
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
 )
 
 // URLBuilder creates registry API urls from a single base endpoint. It can be
@@ -174,6 +175,312 @@ func (ub *URLBuilder) BuildReferrersURL(ref reference.Canonical, values ...url.V
 	return appendValuesURL(referrersURL, values...).String(), nil
 }
 
+// BuildGlobalReferrersURL constructs the url listing the referrers of the
+// subject identified by dgst across repositories.
+func (ub *URLBuilder) BuildGlobalReferrersURL(dgst digest.Digest, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameGlobalReferrers)
+
+	referrersURL, err := route.URL("digest", dgst.String())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(referrersURL, values...).String(), nil
+}
+
+// BuildIndexURL constructs the url used to assemble image indexes in the
+// repository identified by name.
+func (ub *URLBuilder) BuildIndexURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameIndex)
+
+	indexURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return indexURL.String(), nil
+}
+
+// BuildIndexUpdateURL constructs the url used to update the image index
+// identified by ref.
+func (ub *URLBuilder) BuildIndexUpdateURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameIndexUpdate)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	indexURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return indexURL.String(), nil
+}
+
+// BuildAnnotationsURL constructs the url used to update the annotations of
+// the manifest identified by ref.
+func (ub *URLBuilder) BuildAnnotationsURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameAnnotations)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	annotationsURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return annotationsURL.String(), nil
+}
+
+// BuildShareURL constructs the url used to issue share links for the
+// manifest identified by ref.
+func (ub *URLBuilder) BuildShareURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameShare)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	shareURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return shareURL.String(), nil
+}
+
+// BuildGraphURL constructs the url used to export the dependency graph of
+// the repository identified by name, with optional url values.
+func (ub *URLBuilder) BuildGraphURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameGraph)
+
+	graphURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(graphURL, values...).String(), nil
+}
+
+// BuildImpactURL constructs the url used to analyze what deleting the
+// manifest or tag identified by ref would affect.
+func (ub *URLBuilder) BuildImpactURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameImpact)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	impactURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return impactURL.String(), nil
+}
+
+// BuildTimelineURL constructs the url used to list the recent events of the
+// repository identified by name, with optional url values.
+func (ub *URLBuilder) BuildTimelineURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameTimeline)
+
+	timelineURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(timelineURL, values...).String(), nil
+}
+
+// BuildBundleURL constructs the url used to download the manifest
+// identified by ref and its blobs as a single archive.
+func (ub *URLBuilder) BuildBundleURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameBundle)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	bundleURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return bundleURL.String(), nil
+}
+
+// BuildHelmIndexURL constructs the url of the Helm chart repository index
+// of the repository identified by name.
+func (ub *URLBuilder) BuildHelmIndexURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameHelmIndex)
+
+	indexURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return indexURL.String(), nil
+}
+
+// BuildHelmChartURL constructs the url used to download the chart archive,
+// or its provenance file, named file from the repository identified by name.
+func (ub *URLBuilder) BuildHelmChartURL(name reference.Named, file string) (string, error) {
+	route := ub.cloneRoute(RouteNameHelmChart)
+
+	chartURL, err := route.URL("name", name.Name(), "chart", file)
+	if err != nil {
+		return "", err
+	}
+
+	return chartURL.String(), nil
+}
+
+// BuildFetchURL constructs the url used to start fetching a blob into the
+// repository identified by name.
+func (ub *URLBuilder) BuildFetchURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameFetch)
+
+	fetchURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return fetchURL.String(), nil
+}
+
+// BuildFetchStatusURL constructs the url of the status of the blob fetch
+// identified by name and uuid.
+func (ub *URLBuilder) BuildFetchStatusURL(name reference.Named, uuid string) (string, error) {
+	route := ub.cloneRoute(RouteNameFetchStatus)
+
+	statusURL, err := route.URL("name", name.Name(), "uuid", uuid)
+	if err != nil {
+		return "", err
+	}
+
+	return statusURL.String(), nil
+}
+
+// BuildAdminGCURL constructs the url used to start garbage collections.
+func (ub *URLBuilder) BuildAdminGCURL() (string, error) {
+	route := ub.cloneRoute(RouteNameAdminGC)
+
+	gcURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return gcURL.String(), nil
+}
+
+// BuildAdminGCStatusURL constructs the url of the status of the garbage
+// collection identified by uuid.
+func (ub *URLBuilder) BuildAdminGCStatusURL(uuid string) (string, error) {
+	route := ub.cloneRoute(RouteNameAdminGCStatus)
+
+	statusURL, err := route.URL("uuid", uuid)
+	if err != nil {
+		return "", err
+	}
+
+	return statusURL.String(), nil
+}
+
+// BuildAdminConfigURL constructs the url reporting the effective
+// configuration of the registry.
+func (ub *URLBuilder) BuildAdminConfigURL() (string, error) {
+	route := ub.cloneRoute(RouteNameAdminConfig)
+
+	configURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return configURL.String(), nil
+}
+
+// BuildAdminLogURL constructs the url used to change the level of the logs
+// of the registry.
+func (ub *URLBuilder) BuildAdminLogURL() (string, error) {
+	route := ub.cloneRoute(RouteNameAdminLog)
+
+	logURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return logURL.String(), nil
+}
+
+// BuildAdminMarkersURL constructs the url used to record and list the
+// consistency markers of the registry.
+func (ub *URLBuilder) BuildAdminMarkersURL() (string, error) {
+	route := ub.cloneRoute(RouteNameAdminMarkers)
+
+	markersURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return markersURL.String(), nil
+}
+
+// BuildAdminPreheatURL constructs the url listing the blobs to preheat for
+// the manifest identified by ref.
+func (ub *URLBuilder) BuildAdminPreheatURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameAdminPreheat)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	preheatURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return preheatURL.String(), nil
+}
+
 // BuildBlobURL constructs the url for the blob identified by name and dgst.
 func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
 	route := ub.cloneRoute(RouteNameBlob)
@@ -138,6 +138,82 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				})
 			},
 		},
+		{
+			description:  "build global referrers url",
+			expectedPath: "/v2/_distribution/referrers/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5?artifactType=example.test.type",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildGlobalReferrersURL("sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5", url.Values{
+					"artifactType": []string{"example.test.type"},
+				})
+			},
+		},
+		{
+			description:  "build index url",
+			expectedPath: "/v2/foo/bar/_distribution/index",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildIndexURL(fooBarRef)
+			},
+		},
+		{
+			description:  "build index update url",
+			expectedPath: "/v2/foo/bar/_distribution/index/tag",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildIndexUpdateURL(ref)
+			},
+		},
+		{
+			description:  "build graph url",
+			expectedPath: "/v2/foo/bar/_distribution/graph?digest=sha256%3A3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildGraphURL(fooBarRef, url.Values{"digest": []string{"sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5"}})
+			},
+		},
+		{
+			description:  "build bundle url",
+			expectedPath: "/v2/foo/bar/_distribution/bundle/tag",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildBundleURL(ref)
+			},
+		},
+		{
+			description:  "build helm index url",
+			expectedPath: "/v2/foo/bar/_distribution/helm/index.yaml",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildHelmIndexURL(fooBarRef)
+			},
+		},
+		{
+			description:  "build helm chart url",
+			expectedPath: "/v2/foo/bar/_distribution/helm/charts/bar-1.0.0.tgz",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildHelmChartURL(fooBarRef, "bar-1.0.0.tgz")
+			},
+		},
+		{
+			description:  "build fetch url",
+			expectedPath: "/v2/foo/bar/_distribution/fetch/",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildFetchURL(fooBarRef)
+			},
+		},
+		{
+			description:  "build fetch status url",
+			expectedPath: "/v2/foo/bar/_distribution/fetch/uuid-4",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildFetchStatusURL(fooBarRef, "uuid-4")
+			},
+		},
 	}
 }
 
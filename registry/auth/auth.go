@@ -168,6 +168,41 @@ func AuthorizedResources(ctx context.Context) []Resource {
 	return nil
 }
 
+// WithAccess returns a context with the access granted to the request by
+// its credentials, which may exceed the access it was authorized for.
+func WithAccess(ctx context.Context, access []Access) context.Context {
+	return accessContext{
+		Context: ctx,
+		access:  access,
+	}
+}
+
+type accessContext struct {
+	context.Context
+	access []Access
+}
+
+type accessKey struct{}
+
+func (ac accessContext) Value(key interface{}) interface{} {
+	if key == (accessKey{}) {
+		return ac.access
+	}
+
+	return ac.Context.Value(key)
+}
+
+// GrantedAccess returns the access granted to the request by its
+// credentials, such as the scopes of its token, if the access controller
+// reports it.
+func GrantedAccess(ctx context.Context) []Access {
+	if access, ok := ctx.Value(accessKey{}).([]Access); ok {
+		return access
+	}
+
+	return nil
+}
+
 // InitFunc is the type of an AccessController factory function and is used
 // to register the constructor for different AccesController backends.
 type InitFunc func(options map[string]interface{}) (AccessController, error)
@@ -0,0 +1,246 @@
+// Package signature provides an authentication scheme for machine clients,
+// which sign each request with a shared secret instead of obtaining a token.
+// Requests carry the ID of their key, the time they were signed and an
+// HMAC-SHA256 signature of their method, host, path, query and date.
+// Requests signed outside the allowed clock skew are refused. Each key may be
+// limited to scopes, and only admin keys access the administration
+// endpoints.
+//
+// Request bodies are not signed, and a signed request may be replayed until
+// its date falls outside the allowed skew, so this authentication method
+// MUST be used under TLS.
+package signature
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+const defaultSkew = 5 * time.Minute
+
+// adminKeyword marks the keys with access to every resource.
+const adminKeyword = "admin"
+
+// errInsufficientScope is returned when a key is not granted the access
+// requested.
+var errInsufficientScope = errors.New("insufficient scope")
+
+type accessController struct {
+	realm string
+	skew  time.Duration
+	keys  map[string]key
+}
+
+// key is a signing key of the keys file.
+type key struct {
+	secret []byte
+	// admin grants access to every resource.
+	admin bool
+	// scopes limit the access of the key, if any.
+	scopes []scope
+}
+
+// scope grants the actions on the resources of a type whose name matches a
+// pattern.
+type scope struct {
+	typ     string
+	name    string
+	actions []string
+}
+
+func (s scope) grants(access auth.Access) bool {
+	if access.Type != s.typ {
+		return false
+	}
+	if ok, _ := path.Match(s.name, access.Name); !ok {
+		return false
+	}
+	for _, action := range s.actions {
+		if action == "*" || action == access.Action {
+			return true
+		}
+	}
+	return false
+}
+
+// grants reports whether the key is granted the access. Keys without scopes
+// are granted every repository and the catalog, while the other registry
+// resources, those of the administration endpoints, need an admin key.
+func (k key) grants(access auth.Access) bool {
+	if k.admin {
+		return true
+	}
+	if len(k.scopes) == 0 {
+		return access.Type == "repository" || access.Type == "registry" && access.Name == "catalog"
+	}
+	for _, s := range k.scopes {
+		if s.grants(access) {
+			return true
+		}
+	}
+	return false
+}
+
+var _ auth.AccessController = &accessController{}
+
+func newAccessController(options map[string]interface{}) (auth.AccessController, error) {
+	realm, present := options["realm"]
+	if _, ok := realm.(string); !present || !ok {
+		return nil, fmt.Errorf(`"realm" must be set for signature access controller`)
+	}
+
+	path, ok := options["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf(`"path" must be set for signature access controller`)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := parseKeys(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature keys file %s: %v", path, err)
+	}
+
+	skew := defaultSkew
+	if s, present := options["skew"]; present {
+		str, ok := s.(string)
+		if !ok {
+			return nil, fmt.Errorf(`"skew" must be a duration for signature access controller`)
+		}
+		if skew, err = time.ParseDuration(str); err != nil {
+			return nil, fmt.Errorf(`invalid "skew" for signature access controller: %v`, err)
+		}
+	}
+
+	return &accessController{realm: realm.(string), skew: skew, keys: keys}, nil
+}
+
+// parseKeys reads keys in the format "<key id>:<secret> [<scope>...]", one
+// per line, where scopes are "admin" or "<type>:<name pattern>:<actions>".
+// Blank lines and lines starting with # are ignored.
+func parseKeys(r io.Reader) (map[string]key, error) {
+	keys := make(map[string]key)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		t := strings.TrimSpace(scanner.Text())
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		fields := strings.Fields(t)
+		keyID, secret, found := strings.Cut(fields[0], ":")
+		if !found || keyID == "" || secret == "" {
+			return nil, fmt.Errorf("line %d: expected <key id>:<secret>", line)
+		}
+		k := key{secret: []byte(secret)}
+		for _, field := range fields[1:] {
+			if field == adminKeyword {
+				k.admin = true
+				continue
+			}
+			parts := strings.Split(field, ":")
+			if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+				return nil, fmt.Errorf("line %d: invalid scope %q, expected %s or <type>:<name>:<actions>", line, field, adminKeyword)
+			}
+			if _, err := path.Match(parts[1], ""); err != nil {
+				return nil, fmt.Errorf("line %d: invalid scope %q: %v", line, field, err)
+			}
+			k.scopes = append(k.scopes, scope{typ: parts[0], name: parts[1], actions: strings.Split(parts[2], ",")})
+		}
+		keys[keyID] = k
+	}
+	return keys, scanner.Err()
+}
+
+func (ac *accessController) Authorized(ctx context.Context, accessRecords ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, sig, ok := parseAuthorization(req.Header.Get("Authorization"))
+	if !ok {
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrInvalidCredential,
+		}
+	}
+
+	if err := ac.verify(req, keyID, sig, time.Now()); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error authenticating key %q: %v", keyID, err)
+		return nil, &challenge{
+			realm: ac.realm,
+			err:   auth.ErrAuthenticationFailure,
+		}
+	}
+
+	k := ac.keys[keyID]
+	for _, access := range accessRecords {
+		if !k.grants(access) {
+			dcontext.GetLogger(ctx).Errorf("key %q is not granted %s:%s:%s", keyID, access.Type, access.Name, access.Action)
+			return nil, &challenge{
+				realm: ac.realm,
+				err:   errInsufficientScope,
+			}
+		}
+	}
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: keyID}), nil
+}
+
+// verify checks the signature of a request signed with a key at a time
+// within the allowed skew of now.
+func (ac *accessController) verify(r *http.Request, keyID, sig string, now time.Time) error {
+	k, ok := ac.keys[keyID]
+	if !ok {
+		return fmt.Errorf("unknown key")
+	}
+
+	date := r.Header.Get(DateHeader)
+	signedAt, err := time.Parse(DateFormat, date)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %v", DateHeader, err)
+	}
+	if skew := now.Sub(signedAt); skew > ac.skew || skew < -ac.skew {
+		return fmt.Errorf("request signed at %s, outside the allowed clock skew", signedAt.Format(time.RFC3339))
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(signature(r, date, k.secret))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// challenge implements the auth.Challenge interface.
+type challenge struct {
+	realm string
+	err   error
+}
+
+var _ auth.Challenge = challenge{}
+
+// SetHeaders sets the signature challenge header on the response.
+func (ch challenge) SetHeaders(r *http.Request, w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("%s realm=%q", Algorithm, ch.realm))
+}
+
+func (ch challenge) Error() string {
+	return fmt.Sprintf("signature authentication challenge for realm %q: %s", ch.realm, ch.err)
+}
+
+func init() {
+	auth.Register("signature", auth.InitFunc(newAccessController))
+}
@@ -0,0 +1,204 @@
+package signature
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := parseKeys(strings.NewReader("# CI\nci-bot:s3cr3t:with:colons\n\nmirror:other repository:mirror/*:pull,push registry:catalog:*\nops:root admin\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(keys["ci-bot"].secret) != "s3cr3t:with:colons" || string(keys["mirror"].secret) != "other" || len(keys) != 3 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	if len(keys["mirror"].scopes) != 2 || keys["mirror"].admin || !keys["ops"].admin {
+		t.Fatalf("unexpected scopes: %v", keys)
+	}
+
+	for _, invalid := range []string{"ci-bot\n", "ci-bot:s3cr3t repository:foo\n", "ci-bot:s3cr3t repository:[:pull\n"} {
+		if _, err := parseKeys(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestKeyGrants(t *testing.T) {
+	keys, err := parseKeys(strings.NewReader("ci-bot:s3cr3t\nmirror:other repository:mirror/*:pull,push\nops:root admin\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	access := func(typ, name, action string) auth.Access {
+		return auth.Access{Resource: auth.Resource{Type: typ, Name: name}, Action: action}
+	}
+	for _, tc := range []struct {
+		key     string
+		access  auth.Access
+		granted bool
+	}{
+		{"ci-bot", access("repository", "foo/bar", "push"), true},
+		{"ci-bot", access("registry", "catalog", "*"), true},
+		{"ci-bot", access("registry", "gc", "*"), false},
+		{"mirror", access("repository", "mirror/app", "push"), true},
+		{"mirror", access("repository", "mirror/app", "delete"), false},
+		{"mirror", access("repository", "foo/bar", "pull"), false},
+		{"mirror", access("registry", "catalog", "*"), false},
+		{"ops", access("registry", "gc", "*"), true},
+		{"ops", access("repository", "foo/bar", "delete"), true},
+	} {
+		if granted := keys[tc.key].grants(tc.access); granted != tc.granted {
+			t.Errorf("key %s granted %v: %v, expected %v", tc.key, tc.access, granted, tc.granted)
+		}
+	}
+}
+
+func TestAuthorizedScopes(t *testing.T) {
+	keysPath := filepath.Join(t.TempDir(), "keys")
+	if err := ioutil.WriteFile(keysPath, []byte("ci-bot:s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	accessController, err := newAccessController(map[string]interface{}{
+		"realm": "machines",
+		"path":  keysPath,
+	})
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v2/_admin/gc", nil)
+	Sign(r, "ci-bot", []byte("s3cr3t"), time.Now())
+	ctx := context.WithRequest(context.Background(), r)
+	push := auth.Access{Resource: auth.Resource{Type: "repository", Name: "foo"}, Action: "push"}
+	if _, err := accessController.Authorized(ctx, push); err != nil {
+		t.Fatalf("unexpected error authorizing a push: %v", err)
+	}
+	gc := auth.Access{Resource: auth.Resource{Type: "registry", Name: "gc"}, Action: "*"}
+	if _, err := accessController.Authorized(ctx, push, gc); err == nil {
+		t.Fatal("expected a key which is not an admin to be refused the admin endpoints")
+	} else if _, ok := err.(auth.Challenge); !ok {
+		t.Fatalf("unexpected error type %T", err)
+	}
+}
+
+func TestSignatureAccessController(t *testing.T) {
+	keysPath := filepath.Join(t.TempDir(), "keys")
+	if err := ioutil.WriteFile(keysPath, []byte("ci-bot:s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	accessController, err := newAccessController(map[string]interface{}{
+		"realm": "machines",
+		"path":  keysPath,
+		"skew":  "1m",
+	})
+	if err != nil {
+		t.Fatalf("error creating access controller: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithRequest(context.Background(), r)
+		authCtx, err := accessController.Authorized(ctx)
+		if err != nil {
+			switch err := err.(type) {
+			case auth.Challenge:
+				err.SetHeaders(r, w)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			default:
+				t.Fatalf("unexpected error authorizing request: %v", err)
+			}
+		}
+
+		userInfo, ok := authCtx.Value(auth.UserKey).(auth.UserInfo)
+		if !ok || userInfo.Name != "ci-bot" {
+			t.Fatalf("expected user ci-bot, got %v", authCtx.Value(auth.UserKey))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	for _, tc := range []struct {
+		name     string
+		sign     func(r *http.Request)
+		expected int
+	}{
+		{
+			name:     "unsigned",
+			sign:     func(r *http.Request) {},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "signed",
+			sign: func(r *http.Request) {
+				Sign(r, "ci-bot", []byte("s3cr3t"), now)
+			},
+			expected: http.StatusNoContent,
+		},
+		{
+			name: "unknown key",
+			sign: func(r *http.Request) {
+				Sign(r, "intruder", []byte("s3cr3t"), now)
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong secret",
+			sign: func(r *http.Request) {
+				Sign(r, "ci-bot", []byte("guess"), now)
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "outside skew",
+			sign: func(r *http.Request) {
+				Sign(r, "ci-bot", []byte("s3cr3t"), now.Add(-2*time.Minute))
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered",
+			sign: func(r *http.Request) {
+				Sign(r, "ci-bot", []byte("s3cr3t"), now)
+				r.URL.Path = "/v2/other/blobs/uploads/"
+			},
+			expected: http.StatusUnauthorized,
+		},
+	} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/v2/foo/blobs/uploads/?mount=sha256:abc&from=bar", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.sign(req)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.expected {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.expected, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != `HMAC-SHA256 realm="machines"` {
+			t.Errorf("%s: unexpected challenge %q", tc.name, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestMissingKeysFile(t *testing.T) {
+	_, err := newAccessController(map[string]interface{}{
+		"realm": "machines",
+		"path":  filepath.Join(os.TempDir(), "does-not-exist"),
+	})
+	if err == nil {
+		t.Fatal("expected an error for a missing keys file")
+	}
+}
@@ -0,0 +1,78 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Algorithm is the authorization scheme of signed requests.
+	Algorithm = "HMAC-SHA256"
+
+	// DateHeader carries the time a request was signed, in DateFormat.
+	DateHeader = "X-Registry-Date"
+
+	// DateFormat is the format of DateHeader.
+	DateFormat = "20060102T150405Z"
+)
+
+// Sign signs a request with the secret of a key, setting its DateHeader and
+// Authorization headers. The host, method, path, query and date of the
+// request are signed; its body is not.
+func Sign(r *http.Request, keyID string, secret []byte, now time.Time) {
+	date := now.UTC().Format(DateFormat)
+	r.Header.Set(DateHeader, date)
+	r.Header.Set("Authorization", fmt.Sprintf("%s KeyId=%s, Signature=%s", Algorithm, keyID, signature(r, date, secret)))
+}
+
+// signature returns the hex encoded signature of a request.
+func signature(r *http.Request, date string, secret []byte) string {
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.Query().Encode(),
+		strings.ToLower(host(r)),
+		date,
+	}, "\n")
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := Algorithm + "\n" + date + "\n" + hex.EncodeToString(digest[:])
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// host returns the host a request is sent to, which is only set in the URL
+// of client requests.
+func host(r *http.Request) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return r.URL.Host
+}
+
+// parseAuthorization returns the key ID and signature of an Authorization
+// header.
+func parseAuthorization(header string) (keyID, sig string, ok bool) {
+	if !strings.HasPrefix(header, Algorithm+" ") {
+		return "", "", false
+	}
+	for _, param := range strings.Split(strings.TrimPrefix(header, Algorithm+" "), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found {
+			return "", "", false
+		}
+		switch name {
+		case "KeyId":
+			keyID = value
+		case "Signature":
+			sig = value
+		}
+	}
+	return keyID, sig, keyID != "" && sig != ""
+}
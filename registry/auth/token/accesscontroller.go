@@ -283,6 +283,7 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 	}
 
 	ctx = auth.WithResources(ctx, token.resources())
+	ctx = auth.WithAccess(ctx, token.access())
 
 	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
 }
@@ -373,6 +373,27 @@ func (t *Token) resources() []auth.Resource {
 	return resources
 }
 
+// access lists the actions the token grants on each resource.
+func (t *Token) access() []auth.Access {
+	if t.Claims == nil {
+		return nil
+	}
+
+	var access []auth.Access
+	for _, resourceActions := range t.Claims.Access {
+		resource := auth.Resource{
+			Type:  resourceActions.Type,
+			Class: resourceActions.Class,
+			Name:  resourceActions.Name,
+		}
+		for _, action := range resourceActions.Actions {
+			access = append(access, auth.Access{Resource: resource, Action: action})
+		}
+	}
+
+	return access
+}
+
 func (t *Token) compactRaw() string {
 	return fmt.Sprintf("%s.%s", t.Raw, joseBase64UrlEncode(t.Signature))
 }
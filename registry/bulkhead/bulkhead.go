@@ -0,0 +1,282 @@
+// Package bulkhead caps the requests served concurrently for each
+// repository, in separate pools for reads and writes, as configured under
+// policy.bulkhead. Background traffic, such as replication, is shed before
+// interactive requests when a pool fills up.
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/distribution/distribution/v3/registry/ipfilter"
+	"github.com/docker/go-metrics"
+)
+
+// ErrSaturated is returned when the pool of a repository has no free slot.
+var ErrSaturated = errors.New("too many concurrent requests to the repository")
+
+// PriorityHeader is the header with which trusted clients set the priority
+// of their requests, to "interactive" or "background".
+const PriorityHeader = "Registry-Priority"
+
+// defaultBackgroundShare is the percentage of the slots of a pool which
+// background requests may hold if unset.
+const defaultBackgroundShare = 50
+
+// Priority is the class of a request.
+type Priority int
+
+const (
+	// Interactive requests, such as pulls by users and deployments, may
+	// hold every slot of a pool, and wait for one when it is full.
+	Interactive Priority = iota
+
+	// Background requests, such as replication and mirror syncs, may only
+	// hold a share of the slots of a pool, and are refused at once when
+	// they cannot get one.
+	Background
+)
+
+func (p Priority) String() string {
+	if p == Background {
+		return "background"
+	}
+	return "interactive"
+}
+
+// The buckets of the metrics, one for each pool of a repository.
+const (
+	bucketRead  = "read"
+	bucketWrite = "write"
+)
+
+var (
+	inFlight  = prometheus.BulkheadNamespace.NewLabeledGauge("in_flight", "The number of requests holding a slot of a repository pool", metrics.Total, "bucket")
+	saturated = prometheus.BulkheadNamespace.NewLabeledGauge("saturated_repositories", "The number of repositories whose pool has no free slot", metrics.Total, "bucket")
+	rejected  = prometheus.BulkheadNamespace.NewLabeledCounter("rejected", "The number of requests refused because the pool of their repository was full", "bucket", "priority")
+)
+
+func init() {
+	metrics.Register(prometheus.BulkheadNamespace)
+}
+
+// pool holds the slots of one repository for reads or writes.
+type pool struct {
+	slots chan struct{}
+
+	// users counts the requests holding or waiting for a slot, so that
+	// the pool is dropped once idle.
+	users int
+	// background counts the background requests holding a slot.
+	background int
+	saturated  bool
+}
+
+type poolKey struct {
+	repository string
+	write      bool
+}
+
+// Limiter hands out the slots of the pools of each repository. Slots are
+// counted in memory, so each registry instance enforces the caps on the
+// requests it serves.
+type Limiter struct {
+	config             configuration.Bulkhead
+	backgroundSubjects map[string]struct{}
+	// trustedClients is nil if no client may set the priority of its
+	// requests.
+	trustedClients *ipfilter.Rule
+	clientIP       func(*http.Request) net.IP
+
+	mu    sync.Mutex
+	pools map[poolKey]*pool
+}
+
+// New returns a limiter enforcing the caps of the configuration. clientIP
+// returns the address of the client of a request, to tell whether it may
+// set the priority of its requests.
+func New(config configuration.Bulkhead, clientIP func(*http.Request) net.IP) (*Limiter, error) {
+	if config.Background.Share < 0 || config.Background.Share > 100 {
+		return nil, fmt.Errorf("invalid bulkhead background share %d: must be a percentage", config.Background.Share)
+	}
+	l := &Limiter{
+		config:             config,
+		backgroundSubjects: make(map[string]struct{}, len(config.Background.Subjects)),
+		clientIP:           clientIP,
+		pools:              make(map[poolKey]*pool),
+	}
+	for _, subject := range config.Background.Subjects {
+		l.backgroundSubjects[subject] = struct{}{}
+	}
+	if len(config.Background.TrustedClients) > 0 {
+		rule, err := ipfilter.NewRule(configuration.NetworkRule{Allow: config.Background.TrustedClients})
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulkhead trusted client: %v", err)
+		}
+		l.trustedClients = rule
+	}
+	return l, nil
+}
+
+// Priority returns the priority of a request by subject, the authenticated
+// user name if any. The Registry-Priority header of trusted clients takes
+// precedence over the background subjects.
+func (l *Limiter) Priority(r *http.Request, subject string) Priority {
+	if header := r.Header.Get(PriorityHeader); header != "" && l.trustedClients != nil {
+		if ip := l.clientIP(r); ip != nil && l.trustedClients.Allows(ip) {
+			switch strings.ToLower(header) {
+			case "background":
+				return Background
+			case "interactive":
+				return Interactive
+			}
+		}
+	}
+	if _, ok := l.backgroundSubjects[subject]; ok && subject != "" {
+		return Background
+	}
+	return Interactive
+}
+
+// backgroundSlots returns how many slots of a pool of the given size
+// background requests may hold, at least one.
+func (l *Limiter) backgroundSlots(size int) int {
+	share := l.config.Background.Share
+	if share == 0 {
+		share = defaultBackgroundShare
+	}
+	if n := size * share / 100; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Acquire takes a slot of the read or write pool of a repository. An
+// interactive request waits up to the configured queue timeout for one to
+// free up, while a background request is refused at once, and also once
+// background requests hold their share of the pool. It returns ErrSaturated
+// if no slot was taken, or the error of ctx if it is done first. The
+// returned function gives the slot back and must be called once the request
+// has been served.
+func (l *Limiter) Acquire(ctx context.Context, repository string, write bool, priority Priority) (func(), error) {
+	size, bucket := l.config.Reads, bucketRead
+	if write {
+		size, bucket = l.config.Writes, bucketWrite
+	}
+	if size <= 0 {
+		return func() {}, nil
+	}
+
+	key := poolKey{repository: repository, write: write}
+	l.mu.Lock()
+	p, ok := l.pools[key]
+	if !ok {
+		p = &pool{slots: make(chan struct{}, size)}
+		l.pools[key] = p
+	}
+	if priority == Background && p.background >= l.backgroundSlots(size) {
+		if p.users == 0 {
+			delete(l.pools, key)
+		}
+		l.mu.Unlock()
+		rejected.WithValues(bucket, priority.String()).Inc(1)
+		return nil, ErrSaturated
+	}
+	p.users++
+	if priority == Background {
+		// The share is reserved before the slot is taken, so that
+		// concurrent background requests cannot exceed it.
+		p.background++
+	}
+	l.mu.Unlock()
+
+	if err := l.wait(ctx, p, priority); err != nil {
+		l.mu.Lock()
+		if priority == Background {
+			p.background--
+		}
+		l.leave(key, p)
+		l.mu.Unlock()
+		rejected.WithValues(bucket, priority.String()).Inc(1)
+		return nil, err
+	}
+	inFlight.WithValues(bucket).Inc(1)
+
+	l.mu.Lock()
+	if !p.saturated && len(p.slots) == cap(p.slots) {
+		p.saturated = true
+		saturated.WithValues(bucket).Inc(1)
+	}
+	l.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-p.slots
+			inFlight.WithValues(bucket).Dec(1)
+
+			l.mu.Lock()
+			if p.saturated && len(p.slots) < cap(p.slots) {
+				p.saturated = false
+				saturated.WithValues(bucket).Dec(1)
+			}
+			if priority == Background {
+				p.background--
+			}
+			l.leave(key, p)
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+// wait takes a slot of a pool, waiting up to the queue timeout for one if
+// the request is interactive.
+func (l *Limiter) wait(ctx context.Context, p *pool, priority Priority) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if priority == Background || l.config.QueueTimeout <= 0 {
+		return ErrSaturated
+	}
+
+	timer := time.NewTimer(l.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrSaturated
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// leave drops a request from the users of a pool, and the pool once it has
+// none. It must be called with l.mu held.
+func (l *Limiter) leave(key poolKey, p *pool) {
+	p.users--
+	if p.users == 0 {
+		delete(l.pools, key)
+	}
+}
+
+// InFlight returns the number of requests holding a slot of the read or
+// write pool of a repository.
+func (l *Limiter) InFlight(repository string, write bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, ok := l.pools[poolKey{repository: repository, write: write}]; ok {
+		return len(p.slots)
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package bulkhead
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+func newLimiter(t *testing.T, config configuration.Bulkhead) *Limiter {
+	l, err := New(config, func(r *http.Request) net.IP {
+		return net.ParseIP(r.RemoteAddr)
+	})
+	if err != nil {
+		t.Fatalf("error creating limiter: %v", err)
+	}
+	return l
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(t, configuration.Bulkhead{Reads: 2, Writes: 1})
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire(ctx, "busy", false, Interactive)
+		if err != nil {
+			t.Fatalf("unexpected error acquiring read %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := l.Acquire(ctx, "busy", false, Interactive); err != ErrSaturated {
+		t.Fatalf("expected the read pool to be saturated, got %v", err)
+	}
+
+	// Other repositories and the write pool are not affected.
+	release, err := l.Acquire(ctx, "quiet", false, Interactive)
+	if err != nil {
+		t.Fatalf("unexpected error reading another repository: %v", err)
+	}
+	release()
+	release, err = l.Acquire(ctx, "busy", true, Interactive)
+	if err != nil {
+		t.Fatalf("unexpected error writing the busy repository: %v", err)
+	}
+	release()
+
+	releases[0]()
+	// Releasing twice gives back a single slot.
+	releases[0]()
+	if n := l.InFlight("busy", false); n != 1 {
+		t.Fatalf("expected 1 read in flight, got %d", n)
+	}
+	release, err = l.Acquire(ctx, "busy", false, Interactive)
+	if err != nil {
+		t.Fatalf("expected a released slot to be reused, got %v", err)
+	}
+	release()
+	releases[1]()
+
+	if len(l.pools) != 0 {
+		t.Fatalf("expected idle pools to be dropped, got %d", len(l.pools))
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(t, configuration.Bulkhead{Writes: 1, QueueTimeout: time.Minute})
+
+	release, err := l.Acquire(ctx, "repo", true, Interactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A queued request gets the slot once it is released.
+	acquired := make(chan error)
+	go func() {
+		release, err := l.Acquire(ctx, "repo", true, Interactive)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("expected the queued request to get the slot, got %v", err)
+	}
+
+	// A queued request gives up when its context is done.
+	release, err = l.Acquire(ctx, "repo", true, Interactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := l.Acquire(cancelled, "repo", true, Interactive); err != context.Canceled {
+		t.Fatalf("expected the queued request to be cancelled, got %v", err)
+	}
+
+	// Reads are not capped.
+	if _, err := l.Acquire(ctx, "repo", false, Interactive); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+}
+
+func TestLimiterBackground(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(t, configuration.Bulkhead{
+		Reads:        4,
+		QueueTimeout: time.Minute,
+		Background:   configuration.BulkheadBackground{Subjects: []string{"replicator"}},
+	})
+
+	// Background requests may hold half of the pool.
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire(ctx, "repo", false, Background)
+		if err != nil {
+			t.Fatalf("unexpected error acquiring background read %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	if _, err := l.Acquire(ctx, "repo", false, Background); err != ErrSaturated {
+		t.Fatalf("expected background reads to be capped at their share, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire(ctx, "repo", false, Interactive)
+		if err != nil {
+			t.Fatalf("unexpected error acquiring interactive read %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+
+	// Once its share frees up, a background request takes a free slot but
+	// is not queued for one of a full pool.
+	releases[0]()
+	release, err := l.Acquire(ctx, "repo", false, Background)
+	if err != nil {
+		t.Fatalf("unexpected error acquiring a free slot: %v", err)
+	}
+	defer release()
+	releases[1]()
+	release, err = l.Acquire(ctx, "repo", false, Interactive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if _, err := l.Acquire(ctx, "repo", false, Background); err != ErrSaturated {
+		t.Fatalf("expected a background request to be refused from a full pool, got %v", err)
+	}
+	for _, release := range releases[2:] {
+		release()
+	}
+}
+
+func TestLimiterPriority(t *testing.T) {
+	l := newLimiter(t, configuration.Bulkhead{
+		Reads: 1,
+		Background: configuration.BulkheadBackground{
+			Subjects:       []string{"replicator"},
+			TrustedClients: []string{"10.0.0.0/8"},
+		},
+	})
+
+	for _, tc := range []struct {
+		subject  string
+		addr     string
+		header   string
+		expected Priority
+	}{
+		{subject: "user", addr: "192.0.2.1", expected: Interactive},
+		{subject: "replicator", addr: "192.0.2.1", expected: Background},
+		{subject: "", addr: "192.0.2.1", expected: Interactive},
+		// Only trusted clients may set the priority.
+		{subject: "user", addr: "192.0.2.1", header: "background", expected: Interactive},
+		{subject: "replicator", addr: "192.0.2.1", header: "interactive", expected: Background},
+		{subject: "user", addr: "10.1.2.3", header: "Background", expected: Background},
+		{subject: "replicator", addr: "10.1.2.3", header: "interactive", expected: Interactive},
+		{subject: "replicator", addr: "10.1.2.3", header: "urgent", expected: Background},
+	} {
+		r, _ := http.NewRequest(http.MethodGet, "/v2/", nil)
+		r.RemoteAddr = tc.addr
+		if tc.header != "" {
+			r.Header.Set(PriorityHeader, tc.header)
+		}
+		if priority := l.Priority(r, tc.subject); priority != tc.expected {
+			t.Errorf("unexpected priority %v of %s from %s with header %q, expected %v", priority, tc.subject, tc.addr, tc.header, tc.expected)
+		}
+	}
+
+	if _, err := New(configuration.Bulkhead{Background: configuration.BulkheadBackground{TrustedClients: []string{"nope"}}}, nil); err == nil {
+		t.Error("expected an invalid trusted client to be refused")
+	}
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// CopyAction describes what happened to a single piece of content during
+// a Copy.
+type CopyAction int
+
+const (
+	// CopyActionCopied indicates that the content was transferred from the
+	// source to the destination repository.
+	CopyActionCopied CopyAction = iota
+
+	// CopyActionMounted indicates that the blob was cross-repository mounted
+	// into the destination repository without transferring its content.
+	CopyActionMounted
+
+	// CopyActionSkipped indicates that the content already existed in the
+	// destination repository.
+	CopyActionSkipped
+)
+
+// String returns a human readable representation of the action.
+func (a CopyAction) String() string {
+	switch a {
+	case CopyActionCopied:
+		return "copied"
+	case CopyActionMounted:
+		return "mounted"
+	case CopyActionSkipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("CopyAction(%d)", int(a))
+}
+
+// CopyProgress is reported to CopyOptions.Progress once for every blob and
+// manifest handled by Copy.
+type CopyProgress struct {
+	// Descriptor identifies the content that was handled.
+	Descriptor distribution.Descriptor
+
+	// Manifest is true if the content is a manifest rather than a blob.
+	Manifest bool
+
+	// Action describes how the content was handled.
+	Action CopyAction
+}
+
+// CopyOptions controls the behavior of Copy.
+type CopyOptions struct {
+	// Tag, if set, tags the copied root manifest in the destination
+	// repository. When ref is a tag and Tag is empty, the same tag is used.
+	Tag string
+
+	// Referrers, if true, also copies every referrer of each copied
+	// manifest, recursively. Referrers are only discovered when the source
+	// repository supports listing them.
+	Referrers bool
+
+	// DisableMount disables cross-repository blob mount attempts.
+	DisableMount bool
+
+	// Progress, if set, is called after each blob or manifest is handled.
+	Progress func(CopyProgress)
+}
+
+// Copy copies the manifest identified by ref, which may be a tag or a
+// digest, from src to dst. Index children, config and layer blobs and,
+// optionally, referrers are copied before the manifests that depend on
+// them so that the destination never holds a manifest with missing
+// references. Blobs are mounted across repositories when possible. The
+// descriptor of the copied root manifest is returned.
+func Copy(ctx context.Context, src, dst distribution.Repository, ref string, opts CopyOptions) (distribution.Descriptor, error) {
+	var root distribution.Descriptor
+
+	if dgst, err := digest.Parse(ref); err == nil {
+		root.Digest = dgst
+	} else {
+		root, err = src.Tags(ctx).Get(ctx, ref)
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		if opts.Tag == "" {
+			opts.Tag = ref
+		}
+	}
+
+	dstManifests, err := dst.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	c := &copier{
+		src:          src,
+		dst:          dst,
+		dstManifests: dstManifests,
+		opts:         opts,
+		existing:     make(map[digest.Digest]struct{}),
+	}
+
+	err = Walk(ctx, src, root, WalkOptions{
+		Referrers: opts.Referrers,
+		PostVisit: c.putManifest,
+	}, c.visit)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	if opts.Tag != "" {
+		if err := c.tag(ctx); err != nil {
+			return distribution.Descriptor{}, err
+		}
+	}
+
+	return c.root.Descriptor, nil
+}
+
+// copier holds the state of a single Copy call.
+type copier struct {
+	src, dst     distribution.Repository
+	dstManifests distribution.ManifestService
+	opts         CopyOptions
+
+	// root is the node of the manifest being copied.
+	root WalkNode
+
+	// existing holds the manifests already present in the destination.
+	existing map[digest.Digest]struct{}
+}
+
+func (c *copier) progress(desc distribution.Descriptor, isManifest bool, action CopyAction) {
+	if c.opts.Progress != nil {
+		c.opts.Progress(CopyProgress{Descriptor: desc, Manifest: isManifest, Action: action})
+	}
+}
+
+// visit is called before the children of a node are walked. Blobs are
+// copied right away, manifests once all of their children are.
+func (c *copier) visit(ctx context.Context, node WalkNode) error {
+	if node.Manifest == nil {
+		return c.copyBlob(ctx, node.Descriptor)
+	}
+
+	if node.Depth == 0 {
+		c.root = node
+	}
+
+	exists, err := c.dstManifests.Exists(ctx, node.Descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		c.existing[node.Descriptor.Digest] = struct{}{}
+		c.progress(node.Descriptor, true, CopyActionSkipped)
+		return ErrSkipChildren
+	}
+	return nil
+}
+
+// putManifest pushes a manifest to the destination after all of the content
+// it references has been copied.
+func (c *copier) putManifest(ctx context.Context, node WalkNode) error {
+	if node.Manifest == nil {
+		return nil
+	}
+	if _, ok := c.existing[node.Descriptor.Digest]; ok {
+		return nil
+	}
+
+	dgst, err := c.dstManifests.Put(ctx, node.Manifest)
+	if err != nil {
+		return err
+	}
+	if dgst != node.Descriptor.Digest {
+		return fmt.Errorf("manifest digest mismatch after copy: expected %s, got %s", node.Descriptor.Digest, dgst)
+	}
+	c.progress(node.Descriptor, true, CopyActionCopied)
+	return nil
+}
+
+// copyBlob copies a single blob, attempting a cross-repository mount
+// before falling back to transferring the content.
+func (c *copier) copyBlob(ctx context.Context, desc distribution.Descriptor) error {
+	dstBlobs := c.dst.Blobs(ctx)
+	if _, err := dstBlobs.Stat(ctx, desc.Digest); err == nil {
+		c.progress(desc, false, CopyActionSkipped)
+		return nil
+	} else if err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	var options []distribution.BlobCreateOption
+	if !c.opts.DisableMount && c.src.Named().Name() != c.dst.Named().Name() {
+		canonical, err := reference.WithDigest(c.src.Named(), desc.Digest)
+		if err != nil {
+			return err
+		}
+		options = append(options, WithMountFrom(canonical))
+	}
+
+	writer, err := dstBlobs.Create(ctx, options...)
+	if err != nil {
+		if ebm, ok := err.(distribution.ErrBlobMounted); ok {
+			c.progress(ebm.Descriptor, false, CopyActionMounted)
+			return nil
+		}
+		return err
+	}
+	defer writer.Close()
+
+	reader, err := c.src.Blobs(ctx).Open(ctx, desc.Digest)
+	if err != nil {
+		writer.Cancel(ctx)
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Cancel(ctx)
+		return err
+	}
+
+	committed, err := writer.Commit(ctx, desc)
+	if err != nil {
+		return err
+	}
+	c.progress(committed, false, CopyActionCopied)
+	return nil
+}
+
+// tag points the given tag at the copied root manifest in the destination.
+func (c *copier) tag(ctx context.Context) error {
+	// Remote repositories can only be tagged by pushing the manifest by tag.
+	if _, ok := c.dst.(*repository); ok {
+		_, err := c.dstManifests.Put(ctx, c.root.Manifest, distribution.WithTag(c.opts.Tag))
+		return err
+	}
+	return c.dst.Tags(ctx).Tag(ctx, c.opts.Tag, c.root.Descriptor)
+}
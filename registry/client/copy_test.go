@@ -0,0 +1,167 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func newCopyTestRepository(t *testing.T, ns distribution.Namespace, name string) distribution.Repository {
+	named, err := reference.WithName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := ns.Repository(context.Background(), named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func pushCopyTestIndex(t *testing.T, ns distribution.Namespace, repo distribution.Repository) digest.Digest {
+	ctx := context.Background()
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var children []digest.Digest
+	for i := 0; i < 2; i++ {
+		var digests []digest.Digest
+		for j := 0; j < 2; j++ {
+			_, content := newRandomBlob(1024)
+			desc, err := repo.Blobs(ctx).Put(ctx, "application/octet-stream", content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			digests = append(digests, desc.Digest)
+		}
+		m, err := testutil.MakeSchema2Manifest(repo, digests)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := manifests.Put(ctx, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, dgst)
+	}
+
+	index, err := testutil.MakeManifestList(ns.BlobStatter(), children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(ctx, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatal(err)
+	}
+	return dgst
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	ns, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newCopyTestRepository(t, ns, "copy/src")
+	dst := newCopyTestRepository(t, ns, "copy/dst")
+	root := pushCopyTestIndex(t, ns, src)
+
+	actions := make(map[CopyAction]int)
+	desc, err := Copy(ctx, src, dst, "latest", CopyOptions{
+		Progress: func(p CopyProgress) {
+			actions[p.Action]++
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+	if desc.Digest != root {
+		t.Fatalf("unexpected digest: %s != %s", desc.Digest, root)
+	}
+
+	// two image manifests and one index, five blobs (four layers and a
+	// config shared by both images)
+	if actions[CopyActionCopied] != 3 {
+		t.Errorf("expected 3 copied manifests, got %d", actions[CopyActionCopied])
+	}
+	if actions[CopyActionMounted] != 5 {
+		t.Errorf("expected 5 mounted blobs, got %d", actions[CopyActionMounted])
+	}
+
+	tagged, err := dst.Tags(ctx).Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error getting tag: %v", err)
+	}
+	if tagged.Digest != root {
+		t.Fatalf("unexpected tagged digest: %s != %s", tagged.Digest, root)
+	}
+
+	// copying again must not transfer anything
+	actions = make(map[CopyAction]int)
+	if _, err := Copy(ctx, src, dst, root.String(), CopyOptions{
+		Progress: func(p CopyProgress) {
+			actions[p.Action]++
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+	if actions[CopyActionCopied] != 0 || actions[CopyActionMounted] != 0 || actions[CopyActionSkipped] != 1 {
+		t.Errorf("unexpected actions on second copy: %v", actions)
+	}
+}
+
+func TestCopyAcrossRegistries(t *testing.T) {
+	ctx := context.Background()
+	srcNS, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstNS, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newCopyTestRepository(t, srcNS, "copy/src")
+	dst := newCopyTestRepository(t, dstNS, "copy/dst")
+	root := pushCopyTestIndex(t, srcNS, src)
+	signature := pushTestReferrer(t, src, root, "application/vnd.example.signature")
+
+	actions := make(map[CopyAction]int)
+	if _, err := Copy(ctx, src, dst, root.String(), CopyOptions{
+		Tag:       "mirrored",
+		Referrers: true,
+		Progress: func(p CopyProgress) {
+			actions[p.Action]++
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+	// the index, its five blobs and two images, the signature and its blob
+	if actions[CopyActionCopied] != 10 {
+		t.Errorf("expected 10 copied items, got %d", actions[CopyActionCopied])
+	}
+
+	manifests, err := dst.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifests.Get(ctx, root); err != nil {
+		t.Fatalf("copied index not found: %v", err)
+	}
+	if _, err := manifests.Get(ctx, signature); err != nil {
+		t.Fatalf("copied referrer not found: %v", err)
+	}
+	if _, err := dst.Tags(ctx).Get(ctx, "mirrored"); err != nil {
+		t.Fatalf("unexpected error getting tag: %v", err)
+	}
+}
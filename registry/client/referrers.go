@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// referrersAPI is an API through which a registry lists the referrers of a
+// subject.
+type referrersAPI int32
+
+const (
+	// referrersAPIUnknown is the API of a registry which has not been
+	// queried yet.
+	referrersAPIUnknown referrersAPI = iota
+
+	// referrersAPIOCI is the referrers API of the OCI distribution
+	// specification, at /v2/<name>/referrers/<digest>.
+	referrersAPIOCI
+
+	// referrersAPIORAS is the referrers extension of ORAS artifacts, at
+	// /oras/artifacts/v1/<name>/manifests/<digest>/referrers.
+	referrersAPIORAS
+
+	// referrersAPINone is the API of a registry which supports neither.
+	referrersAPINone
+)
+
+// Referrers fetches the referrers of the given subject, following every
+// page of results. The OCI referrers API is used if the registry supports
+// it, and the ORAS referrers extension otherwise. The API found is kept for
+// later calls. An empty list is returned if the registry supports neither,
+// and an error if it does not have the subject.
+// Referrers of any of the artifact types are fetched in a single request.
+func (r *repository) Referrers(ctx context.Context, subject digest.Digest, artifactTypes ...string) ([]distribution.Descriptor, error) {
+	apis := []referrersAPI{referrersAPIOCI, referrersAPIORAS}
+	switch detected := referrersAPI(atomic.LoadInt32(&r.referrersAPI)); detected {
+	case referrersAPINone:
+		return nil, nil
+	case referrersAPIOCI, referrersAPIORAS:
+		apis = []referrersAPI{detected}
+	}
+
+	for _, api := range apis {
+		u, err := r.referrersURL(api, subject, artifactTypes)
+		if err != nil {
+			return nil, err
+		}
+		descriptors, supported, err := r.fetchReferrers(ctx, u)
+		if err != nil {
+			if supported {
+				atomic.StoreInt32(&r.referrersAPI, int32(api))
+			}
+			return nil, err
+		}
+		if !supported {
+			continue
+		}
+		atomic.StoreInt32(&r.referrersAPI, int32(api))
+
+		referrers := make([]distribution.Descriptor, 0, len(descriptors))
+		for _, d := range descriptors {
+			// The registry may not support filtering, so filter here as well.
+			if len(artifactTypes) > 0 && !containsString(artifactTypes, d.ArtifactType) {
+				continue
+			}
+			referrers = append(referrers, distribution.Descriptor{
+				MediaType:   d.MediaType,
+				Size:        d.Size,
+				Digest:      d.Digest,
+				Annotations: d.Annotations,
+			})
+		}
+		return referrers, nil
+	}
+	if len(apis) > 1 {
+		atomic.StoreInt32(&r.referrersAPI, int32(referrersAPINone))
+	}
+	return nil, nil
+}
+
+// referrersURL returns the URL of the first page of referrers of subject
+// through api.
+func (r *repository) referrersURL(api referrersAPI, subject digest.Digest, artifactTypes []string) (string, error) {
+	var values []url.Values
+	if len(artifactTypes) > 0 {
+		values = append(values, url.Values{"artifactType": artifactTypes})
+	}
+	if api == referrersAPIOCI {
+		ref, err := reference.WithDigest(r.name, subject)
+		if err != nil {
+			return "", err
+		}
+		return r.ub.BuildReferrersURL(ref, values...)
+	}
+
+	// The ORAS extension is served next to the /v2/ API, which the URL
+	// builder does not know about.
+	base, err := r.ub.BuildBaseURL()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(strings.TrimSuffix(base, "v2/") + "oras/artifacts/v1/" + r.name.Name() + "/manifests/" + subject.String() + "/referrers")
+	if err != nil {
+		return "", err
+	}
+	if len(values) > 0 {
+		u.RawQuery = values[0].Encode()
+	}
+	return u.String(), nil
+}
+
+// fetchReferrers fetches the referrers listed at u, following the Link
+// headers of each page. supported is false if the registry does not serve
+// the API of u, and true along with the error if it does but does not have
+// the subject.
+func (r *repository) fetchReferrers(ctx context.Context, u string) (descriptors []v1.Descriptor, supported bool, err error) {
+	listURL, err := url.Parse(u)
+	if err != nil {
+		return nil, false, err
+	}
+	for first := true; ; first = false {
+		req, err := http.NewRequestWithContext(ctx, "GET", listURL.String(), nil)
+		if err != nil {
+			return nil, false, err
+		}
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if resp.StatusCode == http.StatusNotFound && first {
+			err := HandleErrorResponse(resp)
+			resp.Body.Close()
+			// A registry serving the API answers with its errors for a
+			// subject or repository it does not have.
+			if subjectUnknown(err) {
+				return nil, true, err
+			}
+			return nil, false, nil
+		}
+		if !SuccessStatus(resp.StatusCode) {
+			err := HandleErrorResponse(resp)
+			resp.Body.Close()
+			return nil, false, err
+		}
+
+		// The OCI API responds with an image index, and the ORAS extension
+		// with a list of references.
+		var page struct {
+			Manifests  []v1.Descriptor `json:"manifests"`
+			References []v1.Descriptor `json:"references"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, false, err
+		}
+		descriptors = append(descriptors, page.Manifests...)
+		descriptors = append(descriptors, page.References...)
+
+		link := resp.Header.Get("Link")
+		if link == "" {
+			return descriptors, true, nil
+		}
+		linkURL, err := url.Parse(strings.Trim(strings.Split(link, ";")[0], "<>"))
+		if err != nil {
+			return nil, false, err
+		}
+		listURL = listURL.ResolveReference(linkURL)
+	}
+}
+
+// subjectUnknown returns true if err reports that the registry does not have
+// the subject or repository, rather than that it does not serve the API.
+func subjectUnknown(err error) bool {
+	errs, ok := err.(errcode.Errors)
+	if !ok {
+		errs = errcode.Errors{err}
+	}
+	for _, err := range errs {
+		var code errcode.ErrorCode
+		switch err := err.(type) {
+		case errcode.Error:
+			code = err.Code
+		case errcode.ErrorCode:
+			code = err
+		}
+		if code == v2.ErrorCodeManifestUnknown || code == v2.ErrorCodeNameUnknown {
+			return true
+		}
+	}
+	return false
+}
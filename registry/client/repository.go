@@ -156,6 +156,10 @@ type repository struct {
 	client *http.Client
 	ub     *v2.URLBuilder
 	name   reference.Named
+
+	// referrersAPI is the referrers API detected on the registry, accessed
+	// atomically.
+	referrersAPI int32
 }
 
 func (r *repository) Named() reference.Named {
@@ -194,6 +198,15 @@ func (r *repository) Tags(ctx context.Context) distribution.TagService {
 	}
 }
 
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // tags implements remote tagging operations.
 type tags struct {
 	client *http.Client
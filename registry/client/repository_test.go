@@ -1425,6 +1425,217 @@ func TestManifestTags(t *testing.T) {
 	// TODO(dmcgowan): Check for error cases
 }
 
+func TestReferrers(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/referrers")
+	subject := digest.FromString("subject")
+	signature := digest.FromString("signature")
+	attestation := digest.FromString("attestation")
+	index := []byte(fmt.Sprintf(`{
+	"schemaVersion": 2,
+	"mediaType": "application/vnd.oci.image.index.v1+json",
+	"manifests": [
+		{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": %q, "size": 1, "artifactType": "application/vnd.example.signature"},
+		{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": %q, "size": 1, "artifactType": "application/vnd.example.attestation"},
+		{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": %q, "size": 1, "artifactType": "application/vnd.example.sbom"}
+	]
+}`, signature, attestation, digest.FromString("sbom")))
+	m := testutil.RequestResponseMap{{
+		// Both artifact types are filtered in a single request.
+		Request: testutil.Request{
+			Method: "GET",
+			Route:  "/v2/" + repo.Name() + "/referrers/" + subject.String(),
+			QueryParams: map[string][]string{
+				"artifactType": {"application/vnd.example.signature", "application/vnd.example.attestation"},
+			},
+		},
+		Response: testutil.Response{
+			StatusCode: http.StatusOK,
+			Body:       index,
+			Headers: http.Header(map[string][]string{
+				"Content-Type": {"application/vnd.oci.image.index.v1+json"},
+			}),
+		},
+	}}
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	referrers, err := r.(distribution.ReferrersLister).Referrers(ctx, subject, "application/vnd.example.signature", "application/vnd.example.attestation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Referrers of other types are left out, should the registry not
+	// filter them.
+	if len(referrers) != 2 || referrers[0].Digest != signature || referrers[1].Digest != attestation {
+		t.Fatalf("unexpected referrers %v", referrers)
+	}
+}
+
+func TestReferrersPagination(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/referrers")
+	subject := digest.FromString("subject")
+	first, second := digest.FromString("first"), digest.FromString("second")
+	route := "/v2/" + repo.Name() + "/referrers/" + subject.String()
+	m := testutil.RequestResponseMap{{
+		Request: testutil.Request{Method: "GET", Route: route},
+		Response: testutil.Response{
+			StatusCode: http.StatusOK,
+			Body:       []byte(fmt.Sprintf(`{"schemaVersion": 2, "manifests": [{"digest": %q, "size": 1}]}`, first)),
+			Headers: http.Header(map[string][]string{
+				"Link": {fmt.Sprintf(`<%s?last=%s&n=1>; rel="next"`, route, first)},
+			}),
+		},
+	}, {
+		Request: testutil.Request{
+			Method:      "GET",
+			Route:       route,
+			QueryParams: map[string][]string{"last": {first.String()}, "n": {"1"}},
+		},
+		Response: testutil.Response{
+			StatusCode: http.StatusOK,
+			Body:       []byte(fmt.Sprintf(`{"schemaVersion": 2, "manifests": [{"digest": %q, "size": 1}]}`, second)),
+		},
+	}}
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := r.(distribution.ReferrersLister).Referrers(context.Background(), subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 2 || referrers[0].Digest != first || referrers[1].Digest != second {
+		t.Fatalf("unexpected referrers %v", referrers)
+	}
+}
+
+func TestReferrersORAS(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/referrers")
+	subject, other := digest.FromString("subject"), digest.FromString("other")
+	signature := digest.FromString("signature")
+	orasReferrers := func(subject digest.Digest) testutil.RequestResponseMapping {
+		return testutil.RequestResponseMapping{
+			Request: testutil.Request{
+				Method:      "GET",
+				Route:       "/oras/artifacts/v1/" + repo.Name() + "/manifests/" + subject.String() + "/referrers",
+				QueryParams: map[string][]string{"artifactType": {"application/vnd.example.signature"}},
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(fmt.Sprintf(`{"references": [{"digest": %q, "size": 1, "artifactType": "application/vnd.example.signature"}]}`, signature)),
+			},
+		}
+	}
+	m := testutil.RequestResponseMap{
+		orasReferrers(subject),
+		orasReferrers(other),
+		// Once the ORAS extension is detected, the OCI API is not queried
+		// anymore.
+		{
+			Request: testutil.Request{
+				Method:      "GET",
+				Route:       "/v2/" + repo.Name() + "/referrers/" + other.String(),
+				QueryParams: map[string][]string{"artifactType": {"application/vnd.example.signature"}},
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(`{"schemaVersion": 2, "manifests": []}`),
+			},
+		},
+	}
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, subject := range []digest.Digest{subject, other} {
+		referrers, err := r.(distribution.ReferrersLister).Referrers(ctx, subject, "application/vnd.example.signature")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(referrers) != 1 || referrers[0].Digest != signature {
+			t.Fatalf("unexpected referrers %v of %s", referrers, subject)
+		}
+	}
+}
+
+// TestReferrersORASMissingSubject checks that a subject missing from a
+// registry serving only the ORAS extension is reported, rather than taken
+// for an unsupported API.
+func TestReferrersORASMissingSubject(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/referrers")
+	missing, subject := digest.FromString("missing"), digest.FromString("subject")
+	signature := digest.FromString("signature")
+	m := testutil.RequestResponseMap{
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/oras/artifacts/v1/" + repo.Name() + "/manifests/" + missing.String() + "/referrers",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       []byte(`{"errors": [{"code": "MANIFEST_UNKNOWN", "message": "manifest unknown"}]}`),
+			},
+		},
+		{
+			Request: testutil.Request{
+				Method: "GET",
+				Route:  "/oras/artifacts/v1/" + repo.Name() + "/manifests/" + subject.String() + "/referrers",
+			},
+			Response: testutil.Response{
+				StatusCode: http.StatusOK,
+				Body:       []byte(fmt.Sprintf(`{"references": [{"digest": %q, "size": 1, "artifactType": "application/vnd.example.signature"}]}`, signature)),
+			},
+		},
+	}
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := r.(distribution.ReferrersLister).Referrers(ctx, missing); !subjectUnknown(err) {
+		t.Fatalf("expected the subject to be unknown, got %v", err)
+	}
+	referrers, err := r.(distribution.ReferrersLister).Referrers(ctx, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != signature {
+		t.Fatalf("unexpected referrers %v of %s", referrers, subject)
+	}
+}
+
+func TestReferrersUnsupported(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/referrers")
+	e, c := testServer(testutil.RequestResponseMap{})
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := r.(distribution.ReferrersLister).Referrers(context.Background(), digest.FromString("subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 0 {
+		t.Fatalf("unexpected referrers %v", referrers)
+	}
+}
+
 func TestTagDelete(t *testing.T) {
 	tag := "latest"
 	repo, _ := reference.WithName("test.example.com/repo/delete")
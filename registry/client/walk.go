@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrSkipChildren may be returned by a WalkFunc to prevent Walk from
+// descending into the content referenced by the current node. Referrers of
+// the node are still walked when requested.
+var ErrSkipChildren = errors.New("skip children")
+
+// WalkNode describes a single node of a content graph visited by Walk.
+type WalkNode struct {
+	// Descriptor identifies the node's content.
+	Descriptor distribution.Descriptor
+
+	// Manifest is set when the node is a manifest and is nil for blobs.
+	Manifest distribution.Manifest
+
+	// Parent is the digest of the node through which this node was reached,
+	// either because the parent references it or because it refers to the
+	// parent as its subject. It is empty for the root.
+	Parent digest.Digest
+
+	// Referrer is true if the node was reached as a referrer of its parent.
+	Referrer bool
+
+	// Depth is the distance from the root.
+	Depth int
+}
+
+// WalkFunc is called for every node visited by Walk. Returning
+// ErrSkipChildren skips the content referenced by a manifest; any other
+// error stops the walk and is returned by Walk.
+type WalkFunc func(ctx context.Context, node WalkNode) error
+
+// WalkOptions controls the behavior of Walk.
+type WalkOptions struct {
+	// Referrers, if true, also walks the referrers of every manifest,
+	// recursively. Referrers are only discovered when the repository
+	// implements distribution.ReferrersLister.
+	Referrers bool
+
+	// ArtifactTypes restricts the referrers walked to those of the given
+	// artifact types.
+	ArtifactTypes []string
+
+	// PostVisit, if set, is called for every node after the content it
+	// references has been walked, but before its referrers are.
+	PostVisit WalkFunc
+}
+
+// Walk traverses the content graph rooted at the manifest described by root
+// depth first: image indexes lead to their child manifests, manifests lead
+// to their config and layer blobs and, optionally, every manifest leads to
+// its referrers. Each node is visited at most once, which protects the walk
+// against cycles in referrer graphs. Walk works against any repository, be
+// it remote or backed by local storage.
+func Walk(ctx context.Context, repo distribution.Repository, root distribution.Descriptor, opts WalkOptions, fn WalkFunc) error {
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := &walker{
+		repo:      repo,
+		manifests: manifests,
+		opts:      opts,
+		fn:        fn,
+		visited:   make(map[digest.Digest]struct{}),
+	}
+	return w.walkManifest(ctx, WalkNode{Descriptor: root})
+}
+
+type walker struct {
+	repo      distribution.Repository
+	manifests distribution.ManifestService
+	opts      WalkOptions
+	fn        WalkFunc
+	visited   map[digest.Digest]struct{}
+}
+
+func (w *walker) walkManifest(ctx context.Context, node WalkNode) error {
+	dgst := node.Descriptor.Digest
+	if _, ok := w.visited[dgst]; ok {
+		return nil
+	}
+	w.visited[dgst] = struct{}{}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m, err := w.manifests.Get(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return err
+	}
+	node.Manifest = m
+	node.Descriptor.MediaType = mediaType
+	node.Descriptor.Size = int64(len(payload))
+
+	err = w.fn(ctx, node)
+	switch err {
+	case nil:
+		_, isIndex := m.(*manifestlist.DeserializedManifestList)
+		for _, ref := range m.References() {
+			child := WalkNode{
+				Descriptor: ref,
+				Parent:     dgst,
+				Depth:      node.Depth + 1,
+			}
+			if isIndex {
+				err = w.walkManifest(ctx, child)
+			} else {
+				err = w.walkBlob(ctx, child)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case ErrSkipChildren:
+	default:
+		return err
+	}
+
+	if w.opts.PostVisit != nil {
+		if err := w.opts.PostVisit(ctx, node); err != nil {
+			return err
+		}
+	}
+
+	if w.opts.Referrers {
+		return w.walkReferrers(ctx, node)
+	}
+	return nil
+}
+
+func (w *walker) walkReferrers(ctx context.Context, subject WalkNode) error {
+	lister, ok := w.repo.(distribution.ReferrersLister)
+	if !ok {
+		return nil
+	}
+
+	referrers, err := lister.Referrers(ctx, subject.Descriptor.Digest, w.opts.ArtifactTypes...)
+	if err != nil {
+		return err
+	}
+
+	for _, referrer := range referrers {
+		err := w.walkManifest(ctx, WalkNode{
+			Descriptor: referrer,
+			Parent:     subject.Descriptor.Digest,
+			Referrer:   true,
+			Depth:      subject.Depth + 1,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) walkBlob(ctx context.Context, node WalkNode) error {
+	if _, ok := w.visited[node.Descriptor.Digest]; ok {
+		return nil
+	}
+	w.visited[node.Descriptor.Digest] = struct{}{}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := w.fn(ctx, node); err != nil && err != ErrSkipChildren {
+		return err
+	}
+	if w.opts.PostVisit != nil {
+		return w.opts.PostVisit(ctx, node)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ociartifact"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func pushTestReferrer(t *testing.T, repo distribution.Repository, subject digest.Digest, artifactType string) digest.Digest {
+	ctx := context.Background()
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, content := newRandomBlob(64)
+	blob, err := repo.Blobs(ctx).Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ociartifact.FromStruct(ociartifact.Manifest{
+		MediaType:    v1.MediaTypeArtifactManifest,
+		ArtifactType: artifactType,
+		Blobs:        []distribution.Descriptor{blob},
+		Subject:      &distribution.Descriptor{MediaType: v1.MediaTypeImageIndex, Digest: subject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := manifests.Put(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dgst
+}
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+	ns, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newCopyTestRepository(t, ns, "walk/repo")
+	root := pushCopyTestIndex(t, ns, repo)
+	signature := pushTestReferrer(t, repo, root, "application/vnd.example.signature")
+	sbom := pushTestReferrer(t, repo, root, "application/vnd.example.sbom")
+	// a signature of the signature
+	nested := pushTestReferrer(t, repo, signature, "application/vnd.example.signature")
+
+	var manifests, blobs int
+	referrers := make(map[digest.Digest]digest.Digest)
+	err = Walk(ctx, repo, distribution.Descriptor{Digest: root}, WalkOptions{Referrers: true}, func(ctx context.Context, node WalkNode) error {
+		if node.Manifest == nil {
+			blobs++
+		} else {
+			manifests++
+		}
+		if node.Referrer {
+			referrers[node.Descriptor.Digest] = node.Parent
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error walking: %v", err)
+	}
+
+	// index, two images and three referrers
+	if manifests != 6 {
+		t.Errorf("expected 6 manifests, got %d", manifests)
+	}
+	// five image blobs and one blob per referrer
+	if blobs != 8 {
+		t.Errorf("expected 8 blobs, got %d", blobs)
+	}
+	expected := map[digest.Digest]digest.Digest{
+		signature: root,
+		sbom:      root,
+		nested:    signature,
+	}
+	for referrer, parent := range expected {
+		if referrers[referrer] != parent {
+			t.Errorf("expected referrer %s of %s, got parent %q", referrer, parent, referrers[referrer])
+		}
+	}
+
+	// filtering by artifact type and skipping children
+	manifests, blobs = 0, 0
+	err = Walk(ctx, repo, distribution.Descriptor{Digest: root}, WalkOptions{
+		Referrers:     true,
+		ArtifactTypes: []string{"application/vnd.example.sbom"},
+	}, func(ctx context.Context, node WalkNode) error {
+		if node.Manifest == nil {
+			blobs++
+			return nil
+		}
+		manifests++
+		if node.Depth == 0 {
+			return ErrSkipChildren
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error walking: %v", err)
+	}
+	if manifests != 2 || blobs != 1 {
+		t.Errorf("expected 2 manifests and 1 blob, got %d and %d", manifests, blobs)
+	}
+}
+
+func TestWalkCancelled(t *testing.T) {
+	ctx := context.Background()
+	ns, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newCopyTestRepository(t, ns, "walk/repo")
+	root := pushCopyTestIndex(t, ns, repo)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = Walk(cctx, repo, distribution.Descriptor{Digest: root}, WalkOptions{}, func(ctx context.Context, node WalkNode) error {
+		t.Fatalf("unexpected visit of %s", node.Descriptor.Digest)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deleteCascadeReferrers bool
+	deleteDryRun           bool
+)
+
+// DeleteCmd is the cobra command that corresponds to the delete subcommand
+var DeleteCmd = &cobra.Command{
+	Use:   "delete <config> <repository> <tag or digest>",
+	Short: "`delete` deletes a manifest and its tags from the storage",
+	Long:  "`delete` deletes a manifest of a repository, the tags pointing at it and, with --cascade-referrers, its referrers, straight from the storage without a garbage collection. The blobs are left for the next garbage collection to delete.",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		named, err := reference.WithName(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name %q: %v\n", args[1], err)
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		var options []storage.RegistryOption
+		if r, ok := config.Storage["referenceindex"]; ok {
+			if enabled, ok := r["enabled"].(bool); ok && enabled {
+				options = append(options, storage.EnableReferenceIndex)
+			}
+		}
+		registry, err := storage.NewRegistry(ctx, driver, options...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		dgst, err := digest.Parse(args[2])
+		if err != nil {
+			repository, err := registry.Repository(ctx, named)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to construct repository: %v", err)
+				os.Exit(1)
+			}
+			desc, err := repository.Tags(ctx).Get(ctx, args[2])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to resolve %s: %v\n", args[2], err)
+				os.Exit(1)
+			}
+			dgst = desc.Digest
+		}
+
+		report, err := storage.DeleteManifest(ctx, driver, registry, named.Name(), dgst, storage.DeleteOpts{
+			DryRun:           deleteDryRun,
+			CascadeReferrers: deleteCascadeReferrers,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete %s: %v\n", args[2], err)
+			os.Exit(1)
+		}
+		printDeleteReport(os.Stdout, report, deleteDryRun)
+	},
+}
+
+func printDeleteReport(w io.Writer, report storage.DeleteReport, dryRun bool) {
+	verb := "deleted"
+	if dryRun {
+		verb = "would delete"
+	}
+	for _, del := range report.Manifests {
+		if len(del.Untag) > 0 {
+			fmt.Fprintf(w, "%s %s@%s, tagged %s\n", verb, del.Name, del.Digest, strings.Join(del.Untag, ", "))
+		} else {
+			fmt.Fprintf(w, "%s %s@%s\n", verb, del.Name, del.Digest)
+		}
+	}
+	for _, dgst := range report.KeptReferrers {
+		fmt.Fprintf(w, "kept referrer %s, delete it with --cascade-referrers\n", dgst)
+	}
+}
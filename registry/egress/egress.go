@@ -0,0 +1,128 @@
+// Package egress accounts for the bytes of blobs served to each
+// authenticated subject and enforces the caps configured under
+// policy.egress.
+package egress
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+var (
+	// ErrDailyCap is returned when a subject has reached its daily cap.
+	ErrDailyCap = errors.New("daily egress cap reached")
+
+	// ErrMonthlyCap is returned when a subject has reached its monthly cap.
+	ErrMonthlyCap = errors.New("monthly egress cap reached")
+)
+
+// usage is the egress of a subject during the current day and month.
+type usage struct {
+	day, month     time.Time
+	daily, monthly int64
+}
+
+// reset starts new periods if now is past the current ones.
+func (u *usage) reset(now time.Time) {
+	if day := startOfDay(now); !day.Equal(u.day) {
+		u.day, u.daily = day, 0
+	}
+	if month := startOfMonth(now); !month.Equal(u.month) {
+		u.month, u.monthly = month, 0
+	}
+}
+
+// Meter records the egress of each subject. Counts are kept in memory, so
+// each registry instance enforces the caps on the traffic it serves.
+type Meter struct {
+	config configuration.Egress
+
+	mu    sync.Mutex
+	usage map[string]*usage
+}
+
+// New returns a meter enforcing the caps of the configuration.
+func New(config configuration.Egress) *Meter {
+	return &Meter{
+		config: config,
+		usage:  make(map[string]*usage),
+	}
+}
+
+// caps returns the caps of a subject.
+func (m *Meter) caps(subject string) configuration.EgressCaps {
+	if caps, ok := m.config.Subjects[subject]; ok {
+		return caps
+	}
+	return m.config.EgressCaps
+}
+
+// Allow reports whether a subject may download more blobs, returning
+// ErrDailyCap or ErrMonthlyCap if not. Anonymous requests, with an empty
+// subject, are not capped.
+func (m *Meter) Allow(subject string, now time.Time) error {
+	if subject == "" {
+		return nil
+	}
+	caps := m.caps(subject)
+	daily, monthly := m.Usage(subject, now)
+	if caps.Monthly > 0 && monthly >= caps.Monthly {
+		return ErrMonthlyCap
+	}
+	if caps.Daily > 0 && daily >= caps.Daily {
+		return ErrDailyCap
+	}
+	return nil
+}
+
+// Add records n bytes served to a subject.
+func (m *Meter) Add(subject string, n int64, now time.Time) {
+	if subject == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.usage[subject]
+	if !ok {
+		u = &usage{}
+		m.usage[subject] = u
+	}
+	u.reset(now)
+	u.daily += n
+	u.monthly += n
+}
+
+// Usage returns the bytes served to a subject during the day and the month
+// of now.
+func (m *Meter) Usage(subject string, now time.Time) (daily, monthly int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.usage[subject]
+	if !ok {
+		return 0, 0
+	}
+	u.reset(now)
+	return u.daily, u.monthly
+}
+
+// Reset returns the time at which a cap reached at now is lifted.
+func Reset(err error, now time.Time) time.Time {
+	if err == ErrMonthlyCap {
+		return startOfMonth(now).AddDate(0, 1, 0)
+	}
+	return startOfDay(now).AddDate(0, 0, 1)
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,55 @@
+package egress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+func TestMeter(t *testing.T) {
+	m := New(configuration.Egress{
+		EgressCaps: configuration.EgressCaps{Daily: 100, Monthly: 150},
+		Subjects: map[string]configuration.EgressCaps{
+			"paid": {},
+		},
+	})
+
+	now := time.Date(2023, time.January, 31, 12, 0, 0, 0, time.UTC)
+	for _, subject := range []string{"", "free", "paid"} {
+		m.Add(subject, 100, now)
+	}
+
+	if err := m.Allow("", now); err != nil {
+		t.Errorf("anonymous subject should not be capped: %v", err)
+	}
+	if err := m.Allow("paid", now); err != nil {
+		t.Errorf("subject without caps should not be capped: %v", err)
+	}
+	if err := m.Allow("free", now); err != ErrDailyCap {
+		t.Errorf("expected the daily cap to be reached, got %v", err)
+	}
+	if reset := Reset(ErrDailyCap, now); !reset.Equal(time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected daily reset: %v", reset)
+	}
+
+	// Both counts start over in a new month.
+	now = time.Date(2023, time.February, 1, 1, 0, 0, 0, time.UTC)
+	if err := m.Allow("free", now); err != nil {
+		t.Errorf("expected caps to be lifted in a new month, got %v", err)
+	}
+
+	// The daily count starts over the next day, the monthly count is kept.
+	m.Add("free", 100, now)
+	now = now.AddDate(0, 0, 1)
+	m.Add("free", 50, now)
+	if daily, monthly := m.Usage("free", now); daily != 50 || monthly != 150 {
+		t.Errorf("unexpected usage: %d, %d", daily, monthly)
+	}
+	if err := m.Allow("free", now); err != ErrMonthlyCap {
+		t.Errorf("expected the monthly cap to be reached, got %v", err)
+	}
+	if reset := Reset(ErrMonthlyCap, now); !reset.Equal(time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected monthly reset: %v", reset)
+	}
+}
@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/health"
+	"github.com/distribution/distribution/v3/registry/freeze"
+	"github.com/distribution/distribution/v3/registry/handlers"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/docker/libtrust"
+)
+
+// Embedded is a registry application which can be mounted into another HTTP
+// server, for products which serve the registry API alongside their own.
+type Embedded struct {
+	config *configuration.Configuration
+	app    *handlers.App
+}
+
+// NewEmbedded creates a registry application from a configuration. Unlike
+// NewRegistry, it leaves logging, error reporting, health checks and
+// listening to the caller, and reports configuration errors instead of
+// panicking.
+func NewEmbedded(ctx context.Context, config *configuration.Configuration) (embedded *Embedded, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("error creating registry app: %v", r)
+		}
+	}()
+
+	app := handlers.NewApp(ctx, config)
+	return &Embedded{
+		config: config,
+		app:    app,
+	}, nil
+}
+
+// Handler returns the handler serving the registry API. It serves the /v2/
+// routes below config.HTTP.Prefix and should be mounted at the root of the
+// embedding server's URL space.
+func (e *Embedded) Handler() http.Handler {
+	return e.app
+}
+
+// RegisterHealthChecks registers the health checks configured in the health
+// section with the given health registry, or the default one. It must be
+// called at most once per process.
+func (e *Embedded) RegisterHealthChecks(healthRegistries ...*health.Registry) {
+	e.app.RegisterHealthChecks(healthRegistries...)
+}
+
+// GarbageCollect runs a mark and sweep over the registry storage, honouring
+// the configured freeze windows, and returns its report. As with the
+// garbage-collect command, the registry should not accept uploads while it
+// runs.
+func (e *Embedded) GarbageCollect(ctx context.Context, opts storage.GCOpts) (storage.GCReport, error) {
+	opts, err := freezeGCOpts(e.config, opts)
+	if err != nil {
+		return storage.GCReport{}, err
+	}
+
+	k, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		return storage.GCReport{}, err
+	}
+
+	driver := e.app.Driver()
+	registry, err := storage.NewRegistry(ctx, driver, storage.Schema1SigningKey(k))
+	if err != nil {
+		return storage.GCReport{}, fmt.Errorf("failed to construct registry: %v", err)
+	}
+	return storage.MarkAndSweep(ctx, driver, registry, opts)
+}
+
+// Shutdown flushes pending notifications and releases the resources held by
+// the registry application. The handler must not be used afterwards.
+func (e *Embedded) Shutdown() error {
+	return e.app.Shutdown()
+}
+
+// errFrozen is returned when garbage collection is refused because a freeze
+// window covering every repository is open.
+var errFrozen = errors.New("refusing to garbage collect: the registry is in a freeze window")
+
+// errReplica is returned when garbage collection is refused because the
+// configuration is the one of a replica, which must not write to the
+// storage.
+var errReplica = errors.New("refusing to garbage collect: the registry is a replica, collect from the primary instead")
+
+// freezeGCOpts applies the freeze windows of the configuration to the
+// garbage collection options. Replicas are refused.
+func freezeGCOpts(config *configuration.Configuration, opts storage.GCOpts) (storage.GCOpts, error) {
+	if config.Replica.Enabled {
+		return opts, errReplica
+	}
+	windows, err := freeze.New(config.Policy.Freeze)
+	if err != nil {
+		return opts, err
+	}
+
+	now := time.Now()
+	if windows.FrozenAll(now) {
+		return opts, errFrozen
+	}
+	if opts.Frozen == nil {
+		opts.Frozen = func(repoName string) bool {
+			return windows.Frozen(repoName, now)
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/registry/storage"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestEmbedded(t *testing.T) {
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+
+	embedded, err := NewEmbedded(context.Background(), config)
+	if err != nil {
+		t.Fatalf("unexpected error creating embedded registry: %v", err)
+	}
+
+	server := httptest.NewServer(embedded.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v2/")
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// Push a blob so that the storage is not empty.
+	resp, err = http.Post(server.URL+"/v2/foo/blobs/uploads/", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("unexpected status code starting upload: %d", resp.StatusCode)
+	}
+
+	content := []byte("layer")
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing upload location: %v", err)
+	}
+	q := location.Query()
+	q.Set("digest", digest.FromBytes(content).String())
+	location.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodPut, location.String(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error finishing upload: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status code finishing upload: %d", resp.StatusCode)
+	}
+
+	report, err := embedded.GarbageCollect(context.Background(), storage.GCOpts{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error collecting garbage: %v", err)
+	}
+	if report.BlobsDeleted != 1 || report.BytesReclaimed != int64(len(content)) {
+		t.Fatalf("expected the unreferenced blob to be reported, got %+v", report)
+	}
+
+	config.Policy.Freeze = []configuration.FreezeWindow{{Schedule: "* * * * *", Duration: time.Hour}}
+	if _, err := embedded.GarbageCollect(context.Background(), storage.GCOpts{DryRun: true}); err != errFrozen {
+		t.Fatalf("expected garbage collection to be refused, got %v", err)
+	}
+
+	if err := embedded.Shutdown(); err != nil {
+		t.Fatalf("unexpected error shutting down: %v", err)
+	}
+}
+
+func TestEmbeddedInvalidConfiguration(t *testing.T) {
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"nonexistent": configuration.Parameters{},
+		},
+	}
+
+	if _, err := NewEmbedded(context.Background(), config); err == nil {
+		t.Fatal("expected an error for an unknown storage driver")
+	}
+}
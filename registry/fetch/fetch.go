@@ -0,0 +1,265 @@
+// Package fetch implements server side blob fetches: the registry downloads
+// a blob from a URL on behalf of a client, so that content which already
+// lives next to the registry is not transferred through the client. Only
+// hosts allowed under fetch in the configuration may be fetched from.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultMaxSize = 10 << 30
+	defaultTimeout = time.Hour
+
+	// retention is how long the status of a finished fetch is kept.
+	retention = time.Hour
+
+	maxRedirects = 10
+)
+
+// ErrHostNotAllowed is returned for URLs whose host is not allowed.
+var ErrHostNotAllowed = errors.New("host is not allowed")
+
+// State is the state of a fetch.
+type State string
+
+// States of a fetch.
+const (
+	StateRunning  State = "running"
+	StateComplete State = "complete"
+	StateFailed   State = "failed"
+)
+
+// Status is the progress of a fetch.
+type Status struct {
+	ID     string        `json:"id"`
+	URL    string        `json:"url"`
+	Digest digest.Digest `json:"digest"`
+	State  State         `json:"state"`
+
+	// BytesFetched is the number of bytes downloaded so far.
+	BytesFetched int64 `json:"bytesFetched"`
+
+	// Size is the size of the blob, if known.
+	Size int64 `json:"size,omitempty"`
+
+	// Error describes why a failed fetch failed.
+	Error string `json:"error,omitempty"`
+}
+
+// job is a fetch in progress or finished.
+type job struct {
+	repoName string
+
+	mu       sync.Mutex
+	status   Status
+	finished time.Time
+}
+
+func (j *job) Status() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Write counts the bytes fetched.
+func (j *job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.BytesFetched += int64(len(p))
+	return len(p), nil
+}
+
+func (j *job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finished = time.Now()
+	j.status.State = StateComplete
+	if err != nil {
+		j.status.State = StateFailed
+		j.status.Error = err.Error()
+	}
+}
+
+// Fetcher runs blob fetches and keeps their status in memory.
+type Fetcher struct {
+	config configuration.Fetch
+	client *http.Client
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// New returns a fetcher enforcing the limits of the configuration.
+func New(config configuration.Fetch) *Fetcher {
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultMaxSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	f := &Fetcher{
+		config: config,
+		jobs:   make(map[string]*job),
+	}
+	f.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return f.Allowed(req.URL)
+		},
+	}
+	return f
+}
+
+// Allowed returns an error unless u is an HTTP or HTTPS URL of an allowed
+// host.
+func (f *Fetcher) Allowed(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range f.config.Hosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", host, ErrHostNotAllowed)
+}
+
+// Start fetches the blob at rawURL into a repository in the background, and
+// returns its initial status. The digest, and the size if positive, are
+// checked before the blob is committed. The fetch runs with ctx, bounded by
+// the configured timeout.
+func (f *Fetcher) Start(ctx context.Context, repoName string, blobs distribution.BlobIngester, rawURL string, dgst digest.Digest, size int64) (Status, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Status{}, err
+	}
+	if err := f.Allowed(u); err != nil {
+		return Status{}, err
+	}
+	if size > f.config.MaxSize {
+		return Status{}, fmt.Errorf("blob size %d exceeds the limit of %d bytes", size, f.config.MaxSize)
+	}
+
+	j := &job{
+		repoName: repoName,
+		status: Status{
+			ID:     uuid.Generate().String(),
+			URL:    rawURL,
+			Digest: dgst,
+			State:  StateRunning,
+			Size:   size,
+		},
+	}
+
+	f.mu.Lock()
+	f.prune(time.Now())
+	f.jobs[j.status.ID] = j
+	f.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+		defer cancel()
+		err := f.fetch(ctx, j, blobs)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error fetching %s: %v", rawURL, err)
+		}
+		j.finish(err)
+	}()
+	return j.Status(), nil
+}
+
+// Status returns the status of a fetch into a repository.
+func (f *Fetcher) Status(repoName, id string) (Status, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	j, ok := f.jobs[id]
+	if !ok || j.repoName != repoName {
+		return Status{}, false
+	}
+	return j.Status(), true
+}
+
+// prune forgets the fetches finished for longer than the retention.
+func (f *Fetcher) prune(now time.Time) {
+	for id, j := range f.jobs {
+		j.mu.Lock()
+		expired := !j.finished.IsZero() && now.Sub(j.finished) > retention
+		j.mu.Unlock()
+		if expired {
+			delete(f.jobs, id)
+		}
+	}
+}
+
+func (f *Fetcher) fetch(ctx context.Context, j *job, blobs distribution.BlobIngester) error {
+	status := j.Status()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, status.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	size := status.Size
+	if resp.ContentLength >= 0 {
+		if size > 0 && resp.ContentLength != size {
+			return fmt.Errorf("content length %d does not match the expected size %d", resp.ContentLength, size)
+		}
+		if resp.ContentLength > f.config.MaxSize {
+			return fmt.Errorf("content length %d exceeds the limit of %d bytes", resp.ContentLength, f.config.MaxSize)
+		}
+		size = resp.ContentLength
+		j.mu.Lock()
+		j.status.Size = size
+		j.mu.Unlock()
+	}
+
+	writer, err := blobs.Create(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := writer.ReadFrom(io.TeeReader(io.LimitReader(resp.Body, f.config.MaxSize+1), j))
+	if err == nil && n > f.config.MaxSize {
+		err = fmt.Errorf("blob exceeds the limit of %d bytes", f.config.MaxSize)
+	}
+	if err == nil && size > 0 && n != size {
+		err = fmt.Errorf("fetched %d bytes, expected %d", n, size)
+	}
+	if err == nil {
+		_, err = writer.Commit(ctx, distribution.Descriptor{Digest: status.Digest, Size: n})
+	}
+	if err != nil {
+		if cancelErr := writer.Cancel(ctx); cancelErr != nil {
+			dcontext.GetLogger(ctx).Errorf("error canceling fetch upload: %v", cancelErr)
+		}
+		return err
+	}
+	return nil
+}
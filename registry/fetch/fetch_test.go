@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestAllowed(t *testing.T) {
+	f := New(configuration.Fetch{Hosts: []string{"objects.example.com", "*.blob.example.net"}})
+	for _, tc := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://objects.example.com/layer", true},
+		{"http://OBJECTS.example.com:8080/layer", true},
+		{"https://eu.blob.example.net/layer", true},
+		{"https://blob.example.net/layer", false},
+		{"https://example.com/layer", false},
+		{"https://objects.example.com.evil.org/layer", false},
+		{"ftp://objects.example.com/layer", false},
+	} {
+		u, err := url.Parse(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Allowed(u); (err == nil) != tc.allowed {
+			t.Errorf("Allowed(%s) = %v, expected allowed %v", tc.url, err, tc.allowed)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	named, err := reference.WithName("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("error creating repository: %v", err)
+	}
+
+	content := strings.Repeat("layer", 100)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://localhost/layer", http.StatusFound)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer origin.Close()
+
+	f := New(configuration.Fetch{Hosts: []string{"127.0.0.1"}, MaxSize: int64(len(content))})
+	wait := func(status Status) Status {
+		for i := 0; i < 100; i++ {
+			status, ok := f.Status("foo/bar", status.ID)
+			if !ok {
+				t.Fatalf("unknown fetch %s", status.ID)
+			}
+			if status.State != StateRunning {
+				return status
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("fetch did not finish")
+		return Status{}
+	}
+
+	dgst := digest.FromString(content)
+	status, err := f.Start(ctx, "foo/bar", repo.Blobs(ctx), origin.URL+"/layer", dgst, 0)
+	if err != nil {
+		t.Fatalf("unexpected error starting fetch: %v", err)
+	}
+	if _, ok := f.Status("other", status.ID); ok {
+		t.Fatalf("fetch visible from another repository")
+	}
+	if status = wait(status); status.State != StateComplete || status.BytesFetched != int64(len(content)) || status.Size != int64(len(content)) {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+		t.Fatalf("fetched blob is missing: %v", err)
+	}
+
+	// Redirects are only followed to allowed hosts.
+	status, err = f.Start(ctx, "foo/bar", repo.Blobs(ctx), origin.URL+"/redirect", dgst, 0)
+	if err != nil {
+		t.Fatalf("unexpected error starting fetch: %v", err)
+	}
+	if status = wait(status); status.State != StateFailed || !strings.Contains(status.Error, ErrHostNotAllowed.Error()) {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	if _, err := f.Start(ctx, "foo/bar", repo.Blobs(ctx), origin.URL+"/layer", dgst, int64(len(content))+1); err == nil {
+		t.Fatalf("expected an error for a blob larger than the limit")
+	}
+	if _, err := f.Start(ctx, "foo/bar", repo.Blobs(ctx), "https://example.com/layer", dgst, 0); err == nil {
+		t.Fatalf("expected an error for a host which is not allowed")
+	}
+}
@@ -0,0 +1,7 @@
+//go:build fips
+// +build fips
+
+package fips
+
+// build is set in binaries built with the fips tag.
+const build = true
@@ -0,0 +1,66 @@
+// Package fips restricts the cryptographic algorithms used by the registry
+// to FIPS 140 approved ones. The restrictions apply when policy.fips is set
+// in the configuration, or unconditionally in binaries built with the fips
+// build tag.
+package fips
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/opencontainers/go-digest"
+)
+
+// approvedDigests are the digest algorithms of the SHA-2 family accepted in
+// FIPS mode.
+var approvedDigests = map[digest.Algorithm]struct{}{
+	digest.SHA256: {},
+	digest.SHA384: {},
+	digest.SHA512: {},
+}
+
+// CipherSuites are the TLS 1.2 cipher suites allowed in FIPS mode: ECDHE
+// key exchange with AES-GCM. The TLS 1.3 suites cannot be configured in Go;
+// they are restricted to AES-GCM when Go runs its FIPS 140 module.
+var CipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+}
+
+// CurvePreferences are the elliptic curves allowed in FIPS mode.
+var CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// Enabled reports whether FIPS mode is in effect for a configuration.
+func Enabled(config *configuration.Configuration) bool {
+	return build || config.Policy.FIPS
+}
+
+// ApprovedDigest returns an error if the algorithm of a digest is not
+// approved.
+func ApprovedDigest(dgst digest.Digest) error {
+	if _, ok := approvedDigests[dgst.Algorithm()]; !ok {
+		return fmt.Errorf("digest algorithm %q is not FIPS approved", dgst.Algorithm())
+	}
+	return nil
+}
+
+// ApprovedCipherSuites returns an error if any of the cipher suites is not
+// allowed.
+func ApprovedCipherSuites(ids []uint16) error {
+	for _, id := range ids {
+		approved := false
+		for _, allowed := range CipherSuites {
+			if id == allowed {
+				approved = true
+				break
+			}
+		}
+		if !approved {
+			return fmt.Errorf("TLS cipher suite %s is not FIPS approved", tls.CipherSuiteName(id))
+		}
+	}
+	return nil
+}
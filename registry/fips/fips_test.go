@@ -0,0 +1,40 @@
+package fips
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestApprovedDigest(t *testing.T) {
+	for _, tc := range []struct {
+		dgst     digest.Digest
+		approved bool
+	}{
+		{digest.FromString("foo"), true},
+		{digest.SHA384.FromString("foo"), true},
+		{digest.SHA512.FromString("foo"), true},
+		{"md5:acbd18db4cc2f85cedef654fccc4a4d8", false},
+		{"blake3:04e0bb39f30b1a3feb89f536c93be15055482df748674b00d26e5a75777702e9", false},
+	} {
+		if err := ApprovedDigest(tc.dgst); (err == nil) != tc.approved {
+			t.Errorf("ApprovedDigest(%s) = %v, expected approved %v", tc.dgst, err, tc.approved)
+		}
+	}
+}
+
+func TestApprovedCipherSuites(t *testing.T) {
+	if err := ApprovedCipherSuites(CipherSuites); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, id := range []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	} {
+		if err := ApprovedCipherSuites([]uint16{id}); err == nil {
+			t.Errorf("expected %s to be refused", tls.CipherSuiteName(id))
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package freeze implements the freeze windows configured under
+// policy.freeze, during which destructive operations such as deletes and
+// garbage collection are refused for the matching repositories.
+package freeze
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+// Window is a recurring time window during which content of the matching
+// repositories may not be deleted.
+type Window struct {
+	repositories []*regexp.Regexp
+	schedule     *schedule
+	duration     time.Duration
+	location     *time.Location
+}
+
+// Windows is a set of freeze windows.
+type Windows []*Window
+
+// New parses the freeze windows of a registry configuration.
+func New(config []configuration.FreezeWindow) (Windows, error) {
+	windows := make(Windows, 0, len(config))
+	for _, c := range config {
+		w, err := NewWindow(c)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// NewWindow parses a single freeze window.
+func NewWindow(config configuration.FreezeWindow) (*Window, error) {
+	schedule, err := parseSchedule(config.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	if config.Duration <= 0 {
+		return nil, fmt.Errorf("invalid freeze window duration %v for schedule %q", config.Duration, config.Schedule)
+	}
+
+	location := time.UTC
+	if config.Timezone != "" {
+		location, err = time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid freeze window timezone %q: %v", config.Timezone, err)
+		}
+	}
+
+	w := &Window{
+		schedule: schedule,
+		duration: config.Duration,
+		location: location,
+	}
+	for _, expr := range config.Repositories {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid freeze window repository %q: %v", expr, err)
+		}
+		w.repositories = append(w.repositories, re)
+	}
+	return w, nil
+}
+
+// Active reports whether the window is open at time t, that is, whether
+// the schedule fired less than the window duration before t.
+func (w *Window) Active(t time.Time) bool {
+	t = t.In(w.location).Truncate(time.Minute)
+	for start := t; t.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+		if w.schedule.matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies reports whether the window covers the named repository.
+func (w *Window) Applies(name string) bool {
+	if len(w.repositories) == 0 {
+		return true
+	}
+	for _, re := range w.repositories {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Frozen reports whether deletes in the named repository are refused at
+// time t.
+func (ws Windows) Frozen(name string, t time.Time) bool {
+	for _, w := range ws {
+		if w.Applies(name) && w.Active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// FrozenAll reports whether a window covering every repository is open at
+// time t.
+func (ws Windows) FrozenAll(t time.Time) bool {
+	for _, w := range ws {
+		if len(w.repositories) == 0 && w.Active(t) {
+			return true
+		}
+	}
+	return false
+}
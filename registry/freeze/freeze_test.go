@@ -0,0 +1,111 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *",
+		"0 18 * * 5",
+		"*/15 0-6 1,15 * 1-5",
+		"30 2 * 12 7",
+		"0 0-23/2 * * *",
+	} {
+		if _, err := parseSchedule(expr); err != nil {
+			t.Errorf("%q: unexpected error: %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := parseSchedule(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestWindowActive(t *testing.T) {
+	// A release weekend: from Friday 18:00 for 54 hours.
+	w, err := NewWindow(configuration.FreezeWindow{
+		Repositories: []string{"release/.*"},
+		Schedule:     "0 18 * * 5",
+		Duration:     54 * time.Hour,
+		Timezone:     "Europe/Berlin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		t      time.Time
+		active bool
+	}{
+		{t: time.Date(2023, 3, 10, 17, 59, 0, 0, berlin)},
+		{t: time.Date(2023, 3, 10, 18, 0, 0, 0, berlin), active: true},
+		{t: time.Date(2023, 3, 11, 12, 0, 0, 0, berlin), active: true},
+		{t: time.Date(2023, 3, 12, 23, 59, 0, 0, berlin), active: true},
+		{t: time.Date(2023, 3, 13, 0, 0, 0, 0, berlin)},
+		{t: time.Date(2023, 3, 14, 12, 0, 0, 0, berlin)},
+		// 17:30 UTC is 18:30 in Berlin.
+		{t: time.Date(2023, 3, 10, 17, 30, 0, 0, time.UTC), active: true},
+	} {
+		if active := w.Active(tc.t); active != tc.active {
+			t.Errorf("%v: expected active %v, got %v", tc.t, tc.active, active)
+		}
+	}
+
+	if !w.Applies("release/app") || w.Applies("ci/release/app") {
+		t.Error("unexpected repository matching")
+	}
+}
+
+func TestWindowsFrozen(t *testing.T) {
+	windows, err := New([]configuration.FreezeWindow{
+		{Repositories: []string{"release/.*"}, Schedule: "0 0 * * *", Duration: time.Hour},
+		{Schedule: "0 0 1 1 *", Duration: 24 * time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	midnight := time.Date(2023, 3, 10, 0, 30, 0, 0, time.UTC)
+	if !windows.Frozen("release/app", midnight) {
+		t.Error("expected release/app to be frozen")
+	}
+	if windows.Frozen("ci/app", midnight) {
+		t.Error("expected ci/app not to be frozen")
+	}
+	if windows.FrozenAll(midnight) {
+		t.Error("expected registry not to be frozen")
+	}
+
+	newYear := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	if !windows.Frozen("ci/app", newYear) || !windows.FrozenAll(newYear) {
+		t.Error("expected registry to be frozen on new year")
+	}
+
+	if _, err := New([]configuration.FreezeWindow{{Schedule: "* * * * *"}}); err == nil {
+		t.Error("expected an error for a window without duration")
+	}
+	if _, err := New([]configuration.FreezeWindow{{Schedule: "* * * * *", Duration: time.Hour, Repositories: []string{"("}}}); err == nil {
+		t.Error("expected an error for an invalid repository expression")
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/version"
+	"github.com/gorilla/handlers"
+	"gopkg.in/yaml.v2"
+)
+
+// redactedValue replaces the values of secret configuration parameters.
+const redactedValue = "<redacted>"
+
+// secretParameters are the substrings of the names of configuration
+// parameters whose values are secrets.
+var secretParameters = []string{"secret", "password", "passphrase", "token", "key", "credential", "authorization", "cookie"}
+
+// adminConfigResponse reports the effective configuration of the registry.
+type adminConfigResponse struct {
+	Version       string                 `json:"version"`
+	Configuration map[string]interface{} `json:"configuration"`
+	Extensions    map[string]interface{} `json:"extensions"`
+	Features      map[string]bool        `json:"features"`
+}
+
+// adminConfigDispatcher constructs the handler reporting the effective
+// configuration of the registry.
+func adminConfigDispatcher(ctx *Context, r *http.Request) http.Handler {
+	configHandler := &adminConfigHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(configHandler.GetConfig),
+	}
+}
+
+// adminConfigHandler handles requests for the configuration.
+type adminConfigHandler struct {
+	*Context
+}
+
+// GetConfig returns the configuration of the registry, with its secrets
+// redacted, along with its enabled extensions and feature flags.
+func (ch *adminConfigHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(ch).Debug("GetConfig")
+
+	app := ch.App
+	if !app.Config.Admin.Config.Enabled {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnsupported.WithDetail("the configuration endpoint is not enabled"))
+		return
+	}
+
+	config, err := redactConfiguration(app.Config)
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	response := adminConfigResponse{
+		Version:       version.Version,
+		Configuration: config,
+		Extensions:    app.extensions(config),
+		Features:      app.features(),
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.Write(body)
+}
+
+// extensions returns the options of the extensions enabled on the
+// application, from its redacted configuration, by name.
+func (app *App) extensions(config map[string]interface{}) map[string]interface{} {
+	admin := configSection(config, "admin")
+	extensions := map[string]interface{}{
+		"referrers": configSection(config, "referrers"),
+	}
+	if app.fetcher != nil {
+		extensions["fetch"] = configSection(config, "fetch")
+	}
+	if app.gcJobs != nil {
+		extensions["gc"] = configSection(admin, "gc")
+	}
+	if app.preheater != nil {
+		extensions["preheat"] = configSection(admin, "preheat")
+	}
+	if app.writes != nil {
+		extensions["markers"] = configSection(admin, "markers")
+	}
+	if app.shareSigner != nil {
+		extensions["share"] = configSection(config, "share")
+	}
+	if app.notary != nil {
+		extensions["notary"] = configSection(config, "notary")
+	}
+	if app.peerHints != nil {
+		extensions["peers"] = configSection(config, "peers")
+	}
+	if app.timeline != nil {
+		extensions["timeline"] = configSection(config, "timeline")
+	}
+	return extensions
+}
+
+// features returns the feature flags of the application.
+func (app *App) features() map[string]bool {
+	config := app.Config
+	return map[string]bool{
+		"delete":             storageFlag(config, "delete", "enabled"),
+		"readOnly":           app.readOnly,
+		"replica":            config.Replica.Enabled,
+		"proxy":              app.isCache,
+		"schema1":            config.Compatibility.Schema1.Enabled,
+		"fips":               app.fips,
+		"referenceIndex":     storageFlag(config, "referenceindex", "enabled"),
+		"referrersHeaders":   app.referrerSummaries != nil,
+		"referrersIndex":     config.Referrers.Index,
+		"referrersTagSchema": config.Referrers.TagSchema,
+		"referrersLinkCache": config.Referrers.LinkCacheTTL > 0,
+		"globalReferrers":    config.Referrers.Global,
+		"referrersLayoutV2":  config.Referrers.Layout == "v2",
+	}
+}
+
+// storageFlag returns the boolean parameter key of a section of the storage
+// configuration, false if it is not set.
+func storageFlag(config *configuration.Configuration, section, key string) bool {
+	enabled, _ := config.Storage[section][key].(bool)
+	return enabled
+}
+
+// configSection returns the named section of a redacted configuration, empty
+// if it is not set.
+func configSection(config map[string]interface{}, name string) map[string]interface{} {
+	if section, ok := config[name].(map[string]interface{}); ok {
+		return section
+	}
+	return map[string]interface{}{}
+}
+
+// redactConfiguration returns the configuration as it is serialized, with
+// the values of secret parameters and the passwords of URLs redacted.
+func redactConfiguration(config *configuration.Configuration) (map[string]interface{}, error) {
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := yaml.Unmarshal(content, &tree); err != nil {
+		return nil, err
+	}
+	redacted, _ := redact(tree).(map[string]interface{})
+	return redacted, nil
+}
+
+// redact returns a copy of a configuration value, as unmarshaled from YAML,
+// with its secrets redacted and its maps keyed by strings, so that it
+// serializes to JSON.
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			name := fmt.Sprint(k)
+			if isSecretParameter(name) && value != nil && value != "" {
+				m[name] = redactedValue
+				continue
+			}
+			m[name] = redact(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = redact(value)
+		}
+		return s
+	case string:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	}
+	return value
+}
+
+// isSecretParameter reports whether the value of the named configuration
+// parameter is a secret.
+func isSecretParameter(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretParameters {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
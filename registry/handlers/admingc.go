@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/gorilla/handlers"
+)
+
+// maxGCRequestSize bounds the body of garbage collection requests.
+const maxGCRequestSize = 64 << 10
+
+// gcJobRetention is how long the status of a finished garbage collection
+// is kept.
+const gcJobRetention = 24 * time.Hour
+
+// gcRequest is the body of a request starting a garbage collection.
+type gcRequest struct {
+	DryRun              bool     `json:"dryRun"`
+	RemoveUntagged      bool     `json:"removeUntagged"`
+	IncludeRepositories []string `json:"includeRepositories,omitempty"`
+	ExcludeRepositories []string `json:"excludeRepositories,omitempty"`
+}
+
+// States of a garbage collection.
+const (
+	gcStateRunning  = "running"
+	gcStateComplete = "complete"
+	gcStateFailed   = "failed"
+)
+
+// gcStatus is the progress of a garbage collection.
+type gcStatus struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	gcRequest
+
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	Phase      storage.GCPhase `json:"phase,omitempty"`
+	Completion float64         `json:"completion"`
+
+	// Report is the report of a complete collection.
+	Report *storage.GCReport `json:"report,omitempty"`
+
+	// Error describes why a failed collection failed.
+	Error string `json:"error,omitempty"`
+}
+
+// gcJob is a garbage collection in progress or finished.
+type gcJob struct {
+	mu     sync.Mutex
+	status gcStatus
+}
+
+func (j *gcJob) Status() gcStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+func (j *gcJob) progress(progress storage.GCProgress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Phase = progress.Phase
+	j.status.Completion = progress.Completion
+}
+
+func (j *gcJob) finish(report storage.GCReport, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.status.FinishedAt = &now
+	if err != nil {
+		j.status.State = gcStateFailed
+		j.status.Error = err.Error()
+		return
+	}
+	j.status.State = gcStateComplete
+	j.status.Phase = storage.GCPhaseDone
+	j.status.Completion = 1
+	j.status.Report = &report
+}
+
+func (j *gcJob) expired(now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status.FinishedAt != nil && now.Sub(*j.status.FinishedAt) > gcJobRetention
+}
+
+// errGCRunning is returned when a garbage collection is started while
+// another one runs.
+var errGCRunning = errors.New("a garbage collection is already running")
+
+// gcJobs runs the garbage collections started through the admin endpoint,
+// one at a time, and keeps their status in memory.
+type gcJobs struct {
+	mu      sync.Mutex
+	jobs    map[string]*gcJob
+	running *gcJob
+}
+
+func newGCJobs() *gcJobs {
+	return &gcJobs{jobs: make(map[string]*gcJob)}
+}
+
+// start registers a new garbage collection, or returns errGCRunning.
+func (g *gcJobs) start(req gcRequest) (*gcJob, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running != nil {
+		return nil, errGCRunning
+	}
+	now := time.Now()
+	for id, j := range g.jobs {
+		if j.expired(now) {
+			delete(g.jobs, id)
+		}
+	}
+	j := &gcJob{
+		status: gcStatus{
+			ID:        uuid.Generate().String(),
+			State:     gcStateRunning,
+			gcRequest: req,
+			StartedAt: now,
+			Phase:     storage.GCPhaseMark,
+		},
+	}
+	g.jobs[j.status.ID] = j
+	g.running = j
+	return j, nil
+}
+
+// done records that the running garbage collection is finished.
+func (g *gcJobs) done(j *gcJob, report storage.GCReport, err error) {
+	j.finish(report, err)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running == j {
+		g.running = nil
+	}
+}
+
+// Status returns the status of a garbage collection.
+func (g *gcJobs) Status(id string) (gcStatus, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	j, ok := g.jobs[id]
+	if !ok {
+		return gcStatus{}, false
+	}
+	return j.Status(), true
+}
+
+// adminGCDispatcher constructs the handler used to start garbage
+// collections and poll their status.
+func adminGCDispatcher(ctx *Context, r *http.Request) http.Handler {
+	gcHandler := &adminGCHandler{
+		Context: ctx,
+		ID:      getUploadUUID(ctx),
+	}
+
+	if gcHandler.ID != "" {
+		return handlers.MethodHandler{
+			"GET": http.HandlerFunc(gcHandler.GetGCStatus),
+		}
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(gcHandler.StartGC)
+	}
+	return mhandler
+}
+
+// adminGCHandler handles requests for garbage collections.
+type adminGCHandler struct {
+	*Context
+
+	// ID identifies the garbage collection of status requests.
+	ID string
+}
+
+// StartGC starts an online garbage collection with the options given in
+// the request body.
+func (gh *adminGCHandler) StartGC(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(gh).Debug("StartGC")
+
+	if gh.App.gcJobs == nil {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the garbage collection endpoint is not enabled"))
+		return
+	}
+
+	var req gcRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxGCRequestSize)).Decode(&req); err != nil && err != io.EOF {
+		gh.Errors = append(gh.Errors, v2.ErrorCodeGCRequestInvalid.WithDetail(err.Error()))
+		return
+	}
+	for _, pattern := range append(req.IncludeRepositories, req.ExcludeRepositories...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			gh.Errors = append(gh.Errors, v2.ErrorCodeNameInvalid.WithDetail(fmt.Sprintf("invalid repository pattern %q: %v", pattern, err)))
+			return
+		}
+	}
+
+	now := time.Now()
+	if gh.App.freeze.FrozenAll(now) {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnavailable.WithDetail("the registry is in a freeze window"))
+		return
+	}
+
+	j, err := gh.App.gcJobs.start(req)
+	if err != nil {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnavailable.WithDetail(err.Error()))
+		return
+	}
+
+	app := gh.App
+	config := app.Config.Admin.GC
+	opts := storage.GCOpts{
+		DryRun:              req.DryRun,
+		RemoveUntagged:      req.RemoveUntagged,
+		IncludeRepositories: req.IncludeRepositories,
+		ExcludeRepositories: req.ExcludeRepositories,
+		Online:              true,
+		GracePeriod:         config.GracePeriod,
+		DeleteRate:          config.DeleteRate,
+		Frozen: func(repoName string) bool {
+			return app.freeze.Frozen(repoName, now)
+		},
+		OnProgress: j.progress,
+		Timeline:   app.timeline,
+		Events: func(event storage.GCEvent) {
+			dcontext.GetLogger(app).Debug(event.Message)
+		},
+	}
+	dcontext.GetLogger(gh).Infof("starting garbage collection %s", j.status.ID)
+
+	// The collection outlives the request, so it runs with the context of
+	// the application.
+	go func() {
+		report, err := app.collectGarbage(opts)
+		if err != nil {
+			dcontext.GetLogger(app).Errorf("garbage collection %s failed: %v", j.status.ID, err)
+		} else {
+			dcontext.GetLogger(app).Infof("garbage collection %s complete", j.status.ID)
+		}
+		app.gcJobs.done(j, report, err)
+	}()
+
+	statusURL, err := gh.urlBuilder.BuildAdminGCStatusURL(j.status.ID)
+	if err != nil {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Location", statusURL)
+	gh.writeStatus(w, j.Status(), http.StatusAccepted)
+}
+
+// GetGCStatus returns the progress of a garbage collection.
+func (gh *adminGCHandler) GetGCStatus(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(gh).Debug("GetGCStatus")
+
+	if gh.App.gcJobs == nil {
+		gh.Errors = append(gh.Errors, v2.ErrorCodeGCUnknown.WithDetail(map[string]string{"id": gh.ID}))
+		return
+	}
+	status, ok := gh.App.gcJobs.Status(gh.ID)
+	if !ok {
+		gh.Errors = append(gh.Errors, v2.ErrorCodeGCUnknown.WithDetail(map[string]string{"id": gh.ID}))
+		return
+	}
+	gh.writeStatus(w, status, http.StatusOK)
+}
+
+func (gh *adminGCHandler) writeStatus(w http.ResponseWriter, status gcStatus, code int) {
+	body, err := json.Marshal(status)
+	if err != nil {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// collectGarbage runs a garbage collection of the storage of the
+// application.
+func (app *App) collectGarbage(opts storage.GCOpts) (storage.GCReport, error) {
+	registry, err := storage.NewRegistry(app, app.driver, storage.Schema1SigningKey(app.trustKey))
+	if err != nil {
+		return storage.GCReport{}, fmt.Errorf("failed to construct registry: %v", err)
+	}
+	return storage.MarkAndSweep(app, app.driver, registry, opts)
+}
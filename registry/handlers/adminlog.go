@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/loglevel"
+	"github.com/gorilla/handlers"
+)
+
+const (
+	// defaultLogOverrideDuration is how long log level overrides last if
+	// the request does not say.
+	defaultLogOverrideDuration = 15 * time.Minute
+
+	// defaultMaxLogOverrideDuration bounds the duration of log level
+	// overrides if the configuration does not say.
+	defaultMaxLogOverrideDuration = time.Hour
+
+	// maxLogRequestSize bounds the body of log level requests.
+	maxLogRequestSize = 4096
+)
+
+// logRequest is the body of a request overriding the log level.
+type logRequest struct {
+	Level    string            `json:"level"`
+	Modules  []loglevel.Module `json:"modules"`
+	Duration string            `json:"duration"`
+}
+
+// adminLogDispatcher constructs the handler changing the level of the logs.
+func adminLogDispatcher(ctx *Context, r *http.Request) http.Handler {
+	logHandler := &adminLogHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET":    http.HandlerFunc(logHandler.GetLogLevel),
+		"PUT":    http.HandlerFunc(logHandler.SetLogLevel),
+		"DELETE": http.HandlerFunc(logHandler.ResetLogLevel),
+	}
+}
+
+// adminLogHandler handles requests for the level of the logs.
+type adminLogHandler struct {
+	*Context
+}
+
+// GetLogLevel returns the level of the logs and the modules whose debug logs
+// are enabled.
+func (lh *adminLogHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(lh).Debug("GetLogLevel")
+
+	if !lh.enabled() {
+		return
+	}
+	lh.writeStatus(w, loglevel.Current())
+}
+
+// SetLogLevel overrides the level of the logs with the options given in the
+// request body.
+func (lh *adminLogHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(lh).Debug("SetLogLevel")
+
+	if !lh.enabled() {
+		return
+	}
+
+	var req logRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxLogRequestSize)).Decode(&req); err != nil && err != io.EOF {
+		lh.Errors = append(lh.Errors, v2.ErrorCodeLogRequestInvalid.WithDetail(err.Error()))
+		return
+	}
+	duration := defaultLogOverrideDuration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil {
+			lh.Errors = append(lh.Errors, v2.ErrorCodeLogRequestInvalid.WithDetail(fmt.Sprintf("invalid log level override duration: %v", err)))
+			return
+		}
+	}
+	maxDuration := lh.App.Config.Admin.Log.MaxDuration
+	if maxDuration <= 0 {
+		maxDuration = defaultMaxLogOverrideDuration
+	}
+	if duration > maxDuration {
+		lh.Errors = append(lh.Errors, v2.ErrorCodeLogRequestInvalid.WithDetail(fmt.Sprintf("log level overrides may not last more than %v", maxDuration)))
+		return
+	}
+
+	status, err := loglevel.Set(req.Level, req.Modules, duration)
+	if err != nil {
+		lh.Errors = append(lh.Errors, v2.ErrorCodeLogRequestInvalid.WithDetail(err.Error()))
+		return
+	}
+	dcontext.GetLogger(lh).Infof("log level set to %s with the debug logs of %v for %v", status.Level, status.Modules, duration)
+	lh.writeStatus(w, status)
+}
+
+// ResetLogLevel ends the override in effect.
+func (lh *adminLogHandler) ResetLogLevel(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(lh).Debug("ResetLogLevel")
+
+	if !lh.enabled() {
+		return
+	}
+	loglevel.Reset()
+	dcontext.GetLogger(lh).Info("log level override reset")
+	lh.writeStatus(w, loglevel.Current())
+}
+
+// enabled reports whether the endpoint is enabled, recording an error if it
+// is not.
+func (lh *adminLogHandler) enabled() bool {
+	if !lh.App.Config.Admin.Log.Enabled {
+		lh.Errors = append(lh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the log endpoint is not enabled"))
+		return false
+	}
+	return true
+}
+
+func (lh *adminLogHandler) writeStatus(w http.ResponseWriter, status loglevel.Status) {
+	body, err := json.Marshal(status)
+	if err != nil {
+		lh.Errors = append(lh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.Write(body)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/quiesce"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+const (
+	// defaultMarkerTimeout is how long writes are held waiting for those
+	// in flight if the configuration does not say.
+	defaultMarkerTimeout = 30 * time.Second
+
+	// maxMarkerRequestSize bounds the body of marker requests.
+	maxMarkerRequestSize = 4096
+)
+
+// markerRequest is the body of a request recording a consistency marker.
+type markerRequest struct {
+	Label string `json:"label"`
+}
+
+// adminMarkersDispatcher constructs the handler recording consistency
+// markers.
+func adminMarkersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	markersHandler := &adminMarkersHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{
+		"GET": http.HandlerFunc(markersHandler.GetMarkers),
+	}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(markersHandler.PutMarker)
+	}
+	return mhandler
+}
+
+// adminMarkersHandler handles requests for consistency markers.
+type adminMarkersHandler struct {
+	*Context
+}
+
+// PutMarker holds the writes of the instance until those in flight
+// complete, and records a consistency marker.
+func (mh *adminMarkersHandler) PutMarker(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(mh).Debug("PutMarker")
+
+	if !mh.enabled() {
+		return
+	}
+
+	var req markerRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMarkerRequestSize)).Decode(&req); err != nil && err != io.EOF {
+		mh.Errors = append(mh.Errors, v2.ErrorCodeMarkerRequestInvalid.WithDetail(err.Error()))
+		return
+	}
+
+	timeout := mh.App.Config.Admin.Markers.Timeout
+	if timeout <= 0 {
+		timeout = defaultMarkerTimeout
+	}
+	ctx, cancel := context.WithTimeout(mh, timeout)
+	defer cancel()
+
+	marker := storage.ConsistencyMarker{
+		Label:      req.Label,
+		Instance:   dcontext.GetStringValue(mh.App, "instance.id"),
+		QuiescedAt: time.Now().UTC(),
+	}
+	drained, resume, err := mh.App.writes.Quiesce(ctx)
+	if err != nil {
+		if errors.Is(err, quiesce.ErrQuiesced) {
+			mh.Errors = append(mh.Errors, errcode.ErrorCodeUnavailable.WithDetail("another consistency marker is being recorded"))
+			return
+		}
+		resume()
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnavailable.WithDetail(fmt.Sprintf("%d writes were still in flight after %v", drained, timeout)))
+		return
+	}
+	marker.DrainedWrites = drained
+	err = storage.PutConsistencyMarker(mh, mh.App.driver, &marker)
+	resume()
+	if err != nil {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	dcontext.GetLogger(mh).Infof("recorded consistency marker %s after holding writes for %v", marker.ID, marker.CreatedAt.Sub(marker.QuiescedAt))
+
+	mh.writeJSON(w, http.StatusCreated, marker)
+}
+
+// GetMarkers lists the consistency markers recorded in the storage.
+func (mh *adminMarkersHandler) GetMarkers(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(mh).Debug("GetMarkers")
+
+	if !mh.enabled() {
+		return
+	}
+
+	markers, err := storage.ConsistencyMarkers(mh, mh.App.driver)
+	if err != nil {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if markers == nil {
+		markers = []storage.ConsistencyMarker{}
+	}
+	mh.writeJSON(w, http.StatusOK, struct {
+		Markers []storage.ConsistencyMarker `json:"markers"`
+	}{markers})
+}
+
+// enabled reports whether the endpoint is enabled, recording an error if it
+// is not.
+func (mh *adminMarkersHandler) enabled() bool {
+	if !mh.App.Config.Admin.Markers.Enabled {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnsupported.WithDetail("the markers endpoint is not enabled"))
+		return false
+	}
+	return true
+}
+
+func (mh *adminMarkersHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
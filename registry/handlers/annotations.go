@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// annotationsDispatcher constructs the handler used to update the
+// annotations of manifests already present in the repository.
+func annotationsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	annotationsHandler := &annotationsHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		annotationsHandler.Tag = reference
+	} else {
+		annotationsHandler.Digest = dgst
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["PATCH"] = http.HandlerFunc(annotationsHandler.UpdateAnnotations)
+	}
+	return mhandler
+}
+
+// annotationsHandler handles requests to update the annotations of
+// manifests.
+type annotationsHandler struct {
+	*Context
+
+	// One of tag or digest identifies the manifest.
+	Tag    string
+	Digest digest.Digest
+}
+
+// updateAnnotationsRequest is the body of an annotations update request.
+type updateAnnotationsRequest struct {
+	// Tag, if set, is pointed at the updated manifest. It defaults to the
+	// tag the manifest was requested by, if any.
+	Tag string `json:"tag,omitempty"`
+
+	// Set lists the annotations to add or replace.
+	Set map[string]string `json:"set,omitempty"`
+
+	// Remove lists the keys of the annotations to remove.
+	Remove []string `json:"remove,omitempty"`
+}
+
+// UpdateAnnotations stores a copy of a manifest with annotations added,
+// replaced or removed, so that provenance or labels can be attached to an
+// image after it is pushed.
+func (ah *annotationsHandler) UpdateAnnotations(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(ah).Debug("UpdateAnnotations")
+
+	var req updateAnnotationsRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxManifestBodySize)).Decode(&req); err != nil {
+		ah.Errors = append(ah.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+
+	if req.Tag == "" {
+		req.Tag = ah.Tag
+	}
+	if req.Tag != "" {
+		if _, err := reference.WithTag(ah.Repository.Named(), req.Tag); err != nil {
+			ah.Errors = append(ah.Errors, v2.ErrorCodeTagInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	manifests, err := ah.Repository.Manifests(ah)
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if ah.Tag != "" {
+		desc, err := ah.Repository.Tags(ah).Get(ah, ah.Tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				ah.Errors = append(ah.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		ah.Digest = desc.Digest
+	}
+
+	manifest, err := manifests.Get(ah, ah.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			ah.Errors = append(ah.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else {
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	switch mediaType {
+	case v1.MediaTypeImageManifest, v1.MediaTypeImageIndex, v1.MediaTypeArtifactManifest:
+	default:
+		ah.Errors = append(ah.Errors, v2.ErrorCodeManifestInvalid.WithDetail(fmt.Sprintf("manifests of type %s have no annotations", mediaType)))
+		return
+	}
+
+	payload, err = patchAnnotations(payload, req.Set, req.Remove)
+	if err != nil {
+		ah.Errors = append(ah.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+	updated, _, err := distribution.UnmarshalManifest(mediaType, payload)
+	if err != nil {
+		ah.Errors = append(ah.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+
+	storeManifest(ah.Context, w, manifests, updated, req.Tag)
+}
+
+// patchAnnotations returns a copy of the payload of a manifest with the
+// annotations of set added or replaced and those of remove removed. The
+// other fields of the manifest are kept as they are, including those the
+// registry does not know about.
+func patchAnnotations(payload []byte, set map[string]string, remove []string) ([]byte, error) {
+	if len(set) == 0 && len(remove) == 0 {
+		return nil, errors.New("no annotation to set or remove")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	annotations := make(map[string]string)
+	if raw, ok := fields["annotations"]; ok && !bytes.Equal(raw, []byte("null")) {
+		if err := json.Unmarshal(raw, &annotations); err != nil {
+			return nil, fmt.Errorf("invalid annotations: %v", err)
+		}
+	}
+
+	for _, key := range remove {
+		if _, ok := set[key]; ok {
+			return nil, fmt.Errorf("annotation %q is both set and removed", key)
+		}
+		if _, ok := annotations[key]; !ok {
+			return nil, fmt.Errorf("annotation %q is not in the manifest", key)
+		}
+		delete(annotations, key)
+	}
+	for key, value := range set {
+		if key == "" {
+			return nil, errors.New("annotation keys must not be empty")
+		}
+		annotations[key] = value
+	}
+
+	if len(annotations) == 0 {
+		delete(fields, "annotations")
+	} else {
+		raw, err := json.Marshal(annotations)
+		if err != nil {
+			return nil, err
+		}
+		fields["annotations"] = raw
+	}
+	return json.MarshalIndent(fields, "", "   ")
+}
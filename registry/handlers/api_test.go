@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -16,26 +17,39 @@ import (
 	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/configuration"
 	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/manifest/schema1"
 	"github.com/distribution/distribution/v3/manifest/schema2"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/fetch"
+	"github.com/distribution/distribution/v3/registry/freeze"
+	"github.com/distribution/distribution/v3/registry/ipfilter"
+	"github.com/distribution/distribution/v3/registry/storage"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/distribution/distribution/v3/registry/tagprotection"
+	"github.com/distribution/distribution/v3/registry/usage"
 	"github.com/distribution/distribution/v3/testutil"
+	"github.com/distribution/distribution/v3/uuid"
 	"github.com/docker/libtrust"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"gopkg.in/yaml.v2"
 )
 
 var headerConfig = http.Header{
@@ -939,6 +953,50 @@ func TestDeleteReadOnly(t *testing.T) {
 	checkResponse(t, "deleting layer in read-only mode", resp, http.StatusMethodNotAllowed)
 }
 
+func TestDeleteFrozen(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bar")
+	// "build" our layer file
+	layerFile, layerDigest, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer file: %v", err)
+	}
+
+	ref, _ := reference.WithDigest(imageName, layerDigest)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("Error building blob URL")
+	}
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layerFile)
+
+	env.app.freeze, err = freeze.New([]configuration.FreezeWindow{
+		{Repositories: []string{"foo/.*"}, Schedule: "* * * * *", Duration: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error configuring freeze windows: %v", err)
+	}
+
+	resp, err := httpDelete(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting layer: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting layer in a freeze window", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "deleting layer in a freeze window", resp, errcode.ErrorCodeDenied)
+
+	// Reads are unaffected.
+	resp, err = http.Head(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking layer: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "checking layer in a freeze window", resp, http.StatusOK)
+}
+
 func TestStartPushReadOnly(t *testing.T) {
 	env := newTestEnv(t, true)
 	defer env.Shutdown()
@@ -960,6 +1018,115 @@ func TestStartPushReadOnly(t *testing.T) {
 	checkResponse(t, "starting push in read-only mode", resp, http.StatusMethodNotAllowed)
 }
 
+func TestReplica(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Replica.Enabled = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	baseURL, err := env.builder.BuildBaseURL()
+	if err != nil {
+		t.Fatalf("unexpected error building base url: %v", err)
+	}
+	resp, err := http.Get(baseURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "checking the api of a replica", resp, http.StatusOK)
+	if resp.Header.Get("Docker-Distribution-Read-Only") != "true" {
+		t.Fatalf("replica does not advertise it is read-only")
+	}
+
+	imageName, _ := reference.WithName("foo/bar")
+	layerUploadURL, err := env.builder.BuildBlobUploadURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building layer upload url: %v", err)
+	}
+	resp, err = http.Post(layerUploadURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error starting layer push: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "starting push to a replica", resp, http.StatusMethodNotAllowed)
+
+	ref, _ := reference.WithDigest(imageName, digestSha256EmptyTar)
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+	resp, err = httpDelete(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "deleting manifest from a replica", resp, http.StatusMethodNotAllowed)
+}
+
+func TestPeerHints(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Peers.URLs = []string{"http://peer-a:5000", "http://peer-b:5000", "https://peer-c", "http://127.0.0.1:65001/mirror"}
+	config.Peers.MaxHints = 2
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bar")
+	layerFile, layerDigest, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer file: %v", err)
+	}
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layerFile)
+
+	ref, _ := reference.WithDigest(imageName, layerDigest)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob url: %v", err)
+	}
+	var hints string
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, layerURL, nil)
+		if err != nil {
+			t.Fatalf("error creating request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error fetching layer: %v", err)
+		}
+		resp.Body.Close()
+		checkResponse(t, "fetching layer with peer hints", resp, http.StatusOK)
+
+		header := resp.Header.Get("Docker-Distribution-Peer-Hints")
+		if hints != "" && header != hints {
+			t.Fatalf("peers hinted for the same blob differ: %q != %q", header, hints)
+		}
+		hints = header
+	}
+	urls := strings.Split(hints, ", ")
+	if len(urls) != 2 {
+		t.Fatalf("unexpected peer hints: %q", hints)
+	}
+	for _, u := range urls {
+		if !strings.HasSuffix(u, "/v2/foo/bar/blobs/"+layerDigest.String()) {
+			t.Fatalf("unexpected peer hint: %s", u)
+		}
+		if strings.HasPrefix(u, "http://127.0.0.1:65001/") && !strings.HasPrefix(u, "http://127.0.0.1:65001/mirror/v2/") {
+			t.Fatalf("peer hint %s drops the path of the peer", u)
+		}
+	}
+}
+
 func httpDelete(url string) (*http.Response, error) {
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
@@ -988,6 +1155,7 @@ func TestManifestAPI(t *testing.T) {
 	deleteEnabled := false
 	env1 := newTestEnv(t, deleteEnabled)
 	defer env1.Shutdown()
+	env1.app.Config.Policy.Warnings.Schema1 = true
 	testManifestAPISchema1(t, env1, schema1Repo)
 	schema2Args := testManifestAPISchema2(t, env1, schema2Repo)
 	testManifestAPIManifestList(t, env1, schema2Args)
@@ -1368,6 +1536,10 @@ func testManifestAPISchema1(t *testing.T, env *testEnv, imageName reference.Name
 		"Location":              []string{manifestDigestURL},
 		"Docker-Content-Digest": []string{dgst.String()},
 	})
+	// Schema1 pushes are warned about, if enabled.
+	if warned := resp.Header.Get("Warning") != ""; warned != env.app.Config.Policy.Warnings.Schema1 {
+		t.Fatalf("unexpected warning %q on a schema1 push", resp.Header.Get("Warning"))
+	}
 
 	// --------------------
 	// Push by digest -- should get same result
@@ -2271,147 +2443,2307 @@ func testManifestDelete(t *testing.T, env *testEnv, args manifestArgs) {
 
 }
 
-type testEnv struct {
-	pk      libtrust.PrivateKey
-	ctx     context.Context
-	config  configuration.Configuration
-	app     *App
-	server  *httptest.Server
-	builder *v2.URLBuilder
-}
-
-func newTestEnvMirror(t *testing.T, deleteEnabled bool) *testEnv {
-	upstreamEnv := newTestEnv(t, deleteEnabled)
-	config := configuration.Configuration{
-		Storage: configuration.Storage{
-			"testdriver": configuration.Parameters{},
-			"delete":     configuration.Parameters{"enabled": deleteEnabled},
-			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
-				"enabled": false,
-			}},
-		},
-		Proxy: configuration.Proxy{
-			RemoteURL: upstreamEnv.server.URL,
-		},
+// pushIndexTestImage stores a schema2 image built from a single random
+// layer and returns the digest of its manifest.
+func pushIndexTestImage(t *testing.T, env *testEnv, name reference.Named) digest.Digest {
+	repo, err := env.app.registry.Repository(env.ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
 	}
-	config.Compatibility.Schema1.Enabled = true
-
-	return newTestEnvWithConfig(t, &config)
 
-}
-
-func newTestEnv(t *testing.T, deleteEnabled bool) *testEnv {
-	config := configuration.Configuration{
-		Storage: configuration.Storage{
-			"testdriver": configuration.Parameters{},
-			"delete":     configuration.Parameters{"enabled": deleteEnabled},
-			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
-				"enabled": false,
-			}},
-		},
+	blobs := repo.Blobs(env.ctx)
+	config, err := blobs.Put(env.ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
 	}
-
-	config.Compatibility.Schema1.Enabled = true
-	config.HTTP.Headers = headerConfig
-
-	return newTestEnvWithConfig(t, &config)
-}
-
-func newTestEnvWithConfig(t *testing.T, config *configuration.Configuration) *testEnv {
-	ctx := context.Background()
-
-	app := NewApp(ctx, config)
-	server := httptest.NewServer(handlers.CombinedLoggingHandler(os.Stderr, app))
-	builder, err := v2.NewURLBuilderFromString(server.URL+config.HTTP.Prefix, false)
-
+	layer, err := blobs.Put(env.ctx, schema2.MediaTypeLayer, []byte(fmt.Sprintf("layer-%d", time.Now().UnixNano())))
 	if err != nil {
-		t.Fatalf("error creating url builder: %v", err)
+		t.Fatalf("unexpected error putting layer: %v", err)
 	}
 
-	pk, err := libtrust.GenerateECP256PrivateKey()
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
 	if err != nil {
-		t.Fatalf("unexpected error generating private key: %v", err)
+		t.Fatalf("unexpected error creating manifest: %v", err)
 	}
 
-	return &testEnv{
-		pk:      pk,
-		ctx:     ctx,
-		config:  *config,
-		app:     app,
-		server:  server,
-		builder: builder,
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	dgst, err := manifests.Put(env.ctx, m)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
 	}
+	return dgst
 }
 
-func (t *testEnv) Shutdown() {
-	t.server.CloseClientConnections()
-	t.server.Close()
-}
+func TestAssembleIndexAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
 
-func putManifest(t *testing.T, msg, url, contentType string, v interface{}) *http.Response {
-	var body []byte
+	imageName, _ := reference.WithName("foo/index")
+	amd64 := pushIndexTestImage(t, env, imageName)
+	arm64 := pushIndexTestImage(t, env, imageName)
 
-	switch m := v.(type) {
-	case *schema1.SignedManifest:
-		_, pl, err := m.Payload()
-		if err != nil {
-			t.Fatalf("error getting payload: %v", err)
-		}
-		body = pl
-	case *manifestlist.DeserializedManifestList:
-		_, pl, err := m.Payload()
+	indexURL, err := env.builder.BuildIndexURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building index url: %v", err)
+	}
+
+	assemble := func(msg string, body interface{}) *http.Response {
+		p, err := json.Marshal(body)
 		if err != nil {
-			t.Fatalf("error getting payload: %v", err)
+			t.Fatalf("unexpected error marshaling request: %v", err)
 		}
-		body = pl
-	default:
-		var err error
-		body, err = json.MarshalIndent(v, "", "   ")
+		resp, err := http.Post(indexURL, "application/json", bytes.NewReader(p))
 		if err != nil {
-			t.Fatalf("unexpected error marshaling %v: %v", v, err)
+			t.Fatalf("unexpected error %s: %v", msg, err)
 		}
+		return resp
 	}
 
-	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
-	if err != nil {
-		t.Fatalf("error creating request for %s: %v", msg, err)
+	platform := func(dgst digest.Digest, os, arch string) distribution.Descriptor {
+		return distribution.Descriptor{
+			Digest:   dgst,
+			Platform: &v1.Platform{OS: os, Architecture: arch},
+		}
 	}
 
-	if contentType != "" {
-		req.Header.Set("Content-Type", contentType)
-	}
+	// An unknown child manifest is rejected.
+	resp := assemble("assembling index with unknown manifest", assembleIndexRequest{
+		Manifests: []distribution.Descriptor{platform(digest.FromString("unknown"), "linux", "amd64")},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "assembling index with unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "assembling index with unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+
+	// Two manifests for the same platform are rejected.
+	resp = assemble("assembling index with duplicate platform", assembleIndexRequest{
+		Manifests: []distribution.Descriptor{
+			platform(amd64, "linux", "amd64"),
+			platform(arm64, "linux", "amd64"),
+		},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "assembling index with duplicate platform", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "assembling index with duplicate platform", resp, v2.ErrorCodeManifestInvalid)
 
-	resp, err := http.DefaultClient.Do(req)
+	// An invalid platform is rejected.
+	resp = assemble("assembling index with invalid platform", assembleIndexRequest{
+		Manifests: []distribution.Descriptor{platform(amd64, "linux", "z80")},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "assembling index with invalid platform", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "assembling index with invalid platform", resp, v2.ErrorCodeManifestInvalid)
+
+	resp = assemble("assembling index", assembleIndexRequest{
+		Tag: "multiarch",
+		Manifests: []distribution.Descriptor{
+			platform(amd64, "linux", "amd64"),
+			platform(arm64, "linux", "arm64"),
+		},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "assembling index", resp, http.StatusCreated)
+
+	dgst, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
 	if err != nil {
-		t.Fatalf("error doing put request while %s: %v", msg, err)
+		t.Fatalf("invalid digest header: %v", err)
 	}
+	digestRef, _ := reference.WithDigest(imageName, dgst)
+	location, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building location URL")
+	checkHeaders(t, resp, http.Header{
+		"Location": []string{location},
+	})
 
-	return resp
-}
+	tagRef, _ := reference.WithTag(imageName, "multiarch")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
 
-func startPushLayer(t *testing.T, env *testEnv, name reference.Named) (location string, uuid string) {
-	layerUploadURL, err := env.builder.BuildBlobUploadURL(name)
+	req, err := http.NewRequest("GET", tagURL, nil)
 	if err != nil {
-		t.Fatalf("unexpected error building layer upload url: %v", err)
+		t.Fatalf("error constructing request: %s", err)
 	}
-
-	u, err := url.Parse(layerUploadURL)
+	req.Header.Set("Accept", v1.MediaTypeImageIndex)
+	resp, err = http.DefaultClient.Do(req)
 	if err != nil {
-		t.Fatalf("error parsing layer upload URL: %v", err)
+		t.Fatalf("unexpected error fetching index: %v", err)
 	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching assembled index", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{dgst.String()},
+		"Content-Type":          []string{v1.MediaTypeImageIndex},
+	})
 
-	base, err := url.Parse(env.server.URL)
-	if err != nil {
-		t.Fatalf("error parsing server URL: %v", err)
+	var index manifestlist.ManifestList
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		t.Fatalf("error decoding fetched index: %v", err)
 	}
-
-	layerUploadURL = base.ResolveReference(u).String()
-	resp, err := http.Post(layerUploadURL, "", nil)
-	if err != nil {
-		t.Fatalf("unexpected error starting layer push: %v", err)
+	if len(index.Manifests) != 2 {
+		t.Fatalf("expected 2 manifests in index, got %d", len(index.Manifests))
+	}
+	if index.Manifests[0].Digest != amd64 || index.Manifests[0].MediaType != schema2.MediaTypeManifest {
+		t.Fatalf("unexpected first manifest: %v", index.Manifests[0].Descriptor)
+	}
+	if index.Manifests[1].Platform.Architecture != "arm64" {
+		t.Fatalf("unexpected platform for second manifest: %v", index.Manifests[1].Platform)
 	}
+}
 
-	defer resp.Body.Close()
+func TestUpdateIndexAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/index-update")
+	amd64 := pushIndexTestImage(t, env, imageName)
+	arm64 := pushIndexTestImage(t, env, imageName)
+	rebuilt := pushIndexTestImage(t, env, imageName)
+
+	platform := func(dgst digest.Digest, os, arch string) distribution.Descriptor {
+		return distribution.Descriptor{
+			Digest:   dgst,
+			Platform: &v1.Platform{OS: os, Architecture: arch},
+		}
+	}
+
+	send := func(msg, method, u string, body interface{}) *http.Response {
+		p, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("unexpected error marshaling request: %v", err)
+		}
+		req, err := http.NewRequest(method, u, bytes.NewReader(p))
+		if err != nil {
+			t.Fatalf("error constructing request: %s", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error %s: %v", msg, err)
+		}
+		return resp
+	}
+
+	indexURL, err := env.builder.BuildIndexURL(imageName)
+	checkErr(t, err, "building index url")
+	resp := send("assembling index", "POST", indexURL, assembleIndexRequest{
+		Tag: "multiarch",
+		Manifests: []distribution.Descriptor{
+			platform(amd64, "linux", "amd64"),
+			platform(arm64, "linux", "arm64"),
+		},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "assembling index", resp, http.StatusCreated)
+	original := resp.Header.Get("Docker-Content-Digest")
+
+	tagRef, _ := reference.WithTag(imageName, "multiarch")
+	updateURL, err := env.builder.BuildIndexUpdateURL(tagRef)
+	checkErr(t, err, "building index update url")
+
+	// The index must exist.
+	unknownRef, _ := reference.WithTag(imageName, "unknown")
+	unknownURL, err := env.builder.BuildIndexUpdateURL(unknownRef)
+	checkErr(t, err, "building index update url")
+	resp = send("updating unknown index", "PATCH", unknownURL, updateIndexRequest{Remove: []digest.Digest{arm64}})
+	defer resp.Body.Close()
+	checkResponse(t, "updating unknown index", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "updating unknown index", resp, v2.ErrorCodeManifestUnknown)
+
+	// Image manifests cannot be updated.
+	imageRef, _ := reference.WithDigest(imageName, amd64)
+	imageURL, err := env.builder.BuildIndexUpdateURL(imageRef)
+	checkErr(t, err, "building index update url")
+	resp = send("updating image manifest", "PATCH", imageURL, updateIndexRequest{Add: []distribution.Descriptor{platform(arm64, "linux", "arm64")}})
+	defer resp.Body.Close()
+	checkResponse(t, "updating image manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "updating image manifest", resp, v2.ErrorCodeManifestInvalid)
+
+	// Removed manifests must be in the index.
+	resp = send("removing unknown manifest", "PATCH", updateURL, updateIndexRequest{Remove: []digest.Digest{rebuilt}})
+	defer resp.Body.Close()
+	checkResponse(t, "removing unknown manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "removing unknown manifest", resp, v2.ErrorCodeManifestInvalid)
+
+	// The rebuilt manifest replaces the amd64 one, and arm64 is removed.
+	resp = send("updating index", "PATCH", updateURL, updateIndexRequest{
+		Add:    []distribution.Descriptor{platform(rebuilt, "linux", "amd64")},
+		Remove: []digest.Digest{arm64},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "updating index", resp, http.StatusCreated)
+	updated := resp.Header.Get("Docker-Content-Digest")
+	if updated == "" || updated == original {
+		t.Fatalf("expected a new index digest, got %q", updated)
+	}
+
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest("GET", tagURL, nil)
+	if err != nil {
+		t.Fatalf("error constructing request: %s", err)
+	}
+	req.Header.Set("Accept", v1.MediaTypeImageIndex)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error fetching index: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching updated index", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{updated},
+	})
+
+	var index manifestlist.ManifestList
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		t.Fatalf("error decoding fetched index: %v", err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != rebuilt || index.Manifests[0].MediaType != schema2.MediaTypeManifest {
+		t.Fatalf("unexpected manifests in updated index: %v", index.Manifests)
+	}
+}
+
+func TestUpdateAnnotationsAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	env.app.timeline = storage.NewTimeline(env.app.driver, 0)
+
+	imageName, _ := reference.WithName("foo/annotations")
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	blobs := repo.Blobs(env.ctx)
+	manifests, err := repo.Manifests(env.ctx)
+	checkErr(t, err, "getting manifest service")
+
+	config, err := blobs.Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	config.MediaType = v1.MediaTypeImageConfig
+	layer, err := blobs.Put(env.ctx, v1.MediaTypeImageLayer, []byte("layer"))
+	checkErr(t, err, "putting layer")
+	layer.MediaType = v1.MediaTypeImageLayer
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+		Annotations: map[string]string{
+			v1.AnnotationCreated: "2023-01-02T03:04:05Z",
+			"org.example.team":   "a",
+		},
+	})
+	checkErr(t, err, "building manifest")
+	original, err := manifests.Put(env.ctx, m)
+	checkErr(t, err, "putting manifest")
+	if err := repo.Tags(env.ctx).Tag(env.ctx, "v1", distribution.Descriptor{Digest: original}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
+	send := func(msg, u string, body interface{}) *http.Response {
+		p, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("unexpected error marshaling request: %v", err)
+		}
+		req, err := http.NewRequest("PATCH", u, bytes.NewReader(p))
+		if err != nil {
+			t.Fatalf("error constructing request: %s", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error %s: %v", msg, err)
+		}
+		return resp
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "v1")
+	tagURL, err := env.builder.BuildAnnotationsURL(tagRef)
+	checkErr(t, err, "building annotations url")
+
+	// The manifest must exist.
+	unknownRef, _ := reference.WithTag(imageName, "unknown")
+	unknownURL, err := env.builder.BuildAnnotationsURL(unknownRef)
+	checkErr(t, err, "building annotations url")
+	resp := send("annotating unknown manifest", unknownURL, updateAnnotationsRequest{Set: map[string]string{"k": "v"}})
+	defer resp.Body.Close()
+	checkResponse(t, "annotating unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "annotating unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+
+	// Docker manifests have no annotations.
+	schema2Ref, _ := reference.WithDigest(imageName, pushIndexTestImage(t, env, imageName))
+	schema2URL, err := env.builder.BuildAnnotationsURL(schema2Ref)
+	checkErr(t, err, "building annotations url")
+	resp = send("annotating docker manifest", schema2URL, updateAnnotationsRequest{Set: map[string]string{"k": "v"}})
+	defer resp.Body.Close()
+	checkResponse(t, "annotating docker manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "annotating docker manifest", resp, v2.ErrorCodeManifestInvalid)
+
+	// Removed annotations must be in the manifest.
+	resp = send("removing unknown annotation", tagURL, updateAnnotationsRequest{Remove: []string{"unknown"}})
+	defer resp.Body.Close()
+	checkResponse(t, "removing unknown annotation", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "removing unknown annotation", resp, v2.ErrorCodeManifestInvalid)
+
+	resp = send("annotating manifest", tagURL, updateAnnotationsRequest{
+		Set:    map[string]string{v1.AnnotationSource: "https://example.com/foo"},
+		Remove: []string{"org.example.team"},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "annotating manifest", resp, http.StatusCreated)
+	updated := digest.Digest(resp.Header.Get("Docker-Content-Digest"))
+	if updated == "" || updated == original {
+		t.Fatalf("expected a new manifest digest, got %q", updated)
+	}
+
+	// The move of the tag is recorded in the timeline, while the failed
+	// requests are not.
+	events, err := env.app.timeline.Events(env.ctx, imageName.Name(), "", 0)
+	checkErr(t, err, "reading timeline")
+	if len(events) != 1 || events[0].Action != storage.TimelineTagMove || events[0].Tag != "v1" ||
+		events[0].Digest != updated || events[0].Previous != original {
+		t.Fatalf("unexpected timeline events: %+v", events)
+	}
+
+	// The tag the manifest was requested by is moved, and the original
+	// manifest is kept.
+	desc, err := repo.Tags(env.ctx).Get(env.ctx, "v1")
+	checkErr(t, err, "getting tag")
+	if desc.Digest != updated {
+		t.Fatalf("tag points at %s, expected %s", desc.Digest, updated)
+	}
+	if _, err := manifests.Get(env.ctx, original); err != nil {
+		t.Fatalf("unexpected error getting original manifest: %v", err)
+	}
+	manifest, err := manifests.Get(env.ctx, updated)
+	checkErr(t, err, "getting updated manifest")
+	annotated, ok := manifest.(*ocischema.DeserializedManifest)
+	if !ok {
+		t.Fatalf("unexpected manifest type %T", manifest)
+	}
+	expected := map[string]string{
+		v1.AnnotationCreated: "2023-01-02T03:04:05Z",
+		v1.AnnotationSource:  "https://example.com/foo",
+	}
+	if !reflect.DeepEqual(annotated.Annotations, expected) {
+		t.Fatalf("unexpected annotations: %v", annotated.Annotations)
+	}
+	if annotated.Config.Digest != config.Digest || len(annotated.Layers) != 1 || annotated.Layers[0].Digest != layer.Digest {
+		t.Fatalf("unexpected content in annotated manifest: %v %v", annotated.Config, annotated.Layers)
+	}
+
+	// A manifest requested by digest is only tagged if asked to.
+	digestRef, _ := reference.WithDigest(imageName, original)
+	digestURL, err := env.builder.BuildAnnotationsURL(digestRef)
+	checkErr(t, err, "building annotations url")
+	resp = send("annotating manifest by digest", digestURL, updateAnnotationsRequest{
+		Tag: "reviewed",
+		Set: map[string]string{"org.example.reviewed": "true"},
+	})
+	defer resp.Body.Close()
+	checkResponse(t, "annotating manifest by digest", resp, http.StatusCreated)
+	desc, err = repo.Tags(env.ctx).Get(env.ctx, "reviewed")
+	checkErr(t, err, "getting tag")
+	if desc.Digest.String() != resp.Header.Get("Docker-Content-Digest") {
+		t.Fatalf("tag points at %s, expected %s", desc.Digest, resp.Header.Get("Docker-Content-Digest"))
+	}
+	desc, err = repo.Tags(env.ctx).Get(env.ctx, "v1")
+	checkErr(t, err, "getting tag")
+	if desc.Digest != updated {
+		t.Fatalf("tag moved to %s", desc.Digest)
+	}
+}
+
+func TestShareLinkAPI(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"silly": {
+				"realm":   "realm-test",
+				"service": "service-test",
+			},
+		},
+	}
+	config.Share.Enabled = true
+	config.Share.MaxExpiry = 24 * time.Hour
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/shared")
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	manifests, err := repo.Manifests(env.ctx)
+	checkErr(t, err, "getting manifest service")
+	image := pushIndexTestImage(t, env, imageName)
+	m, err := manifests.Get(env.ctx, image)
+	checkErr(t, err, "getting image manifest")
+	layer := m.References()[1].Digest
+	_, payload, err := m.Payload()
+	checkErr(t, err, "getting image payload")
+	index, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{{
+		Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: image, Size: int64(len(payload))},
+		Platform:   manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"},
+	}})
+	checkErr(t, err, "building index")
+	indexDigest, err := manifests.Put(env.ctx, index)
+	checkErr(t, err, "putting index")
+	if err := repo.Tags(env.ctx).Tag(env.ctx, "release", distribution.Descriptor{Digest: indexDigest}); err != nil {
+		t.Fatalf("unexpected error tagging index: %v", err)
+	}
+	unshared, err := repo.Blobs(env.ctx).Put(env.ctx, "application/octet-stream", []byte("unshared"))
+	checkErr(t, err, "putting blob")
+
+	do := func(method, u string, body string, authorized bool) *http.Response {
+		req, err := http.NewRequest(method, u, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("error constructing request: %s", err)
+		}
+		req.Header.Set("Accept", manifestlist.MediaTypeManifestList+", "+schema2.MediaTypeManifest)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error requesting %s: %v", u, err)
+		}
+		return resp
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "release")
+	shareURL, err := env.builder.BuildShareURL(tagRef)
+	checkErr(t, err, "building share url")
+
+	resp := do("POST", shareURL, `{"expiry": "1h", "once": true}`, false)
+	defer resp.Body.Close()
+	checkResponse(t, "issuing share link without credentials", resp, http.StatusUnauthorized)
+
+	for _, body := range []string{`{"expiry": "48h"}`, `{"expiry": "soon"}`, `{"expiry": `} {
+		resp = do("POST", shareURL, body, true)
+		defer resp.Body.Close()
+		checkResponse(t, "issuing share link with "+body, resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "issuing share link with "+body, resp, v2.ErrorCodeShareRequestInvalid)
+	}
+
+	resp = do("POST", shareURL, `{"expiry": "1h", "once": true}`, true)
+	defer resp.Body.Close()
+	checkResponse(t, "issuing share link", resp, http.StatusCreated)
+	var link shareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&link); err != nil {
+		t.Fatalf("error decoding share link: %v", err)
+	}
+	if link.Digest != indexDigest || !link.Once || link.Token == "" {
+		t.Fatalf("unexpected share link: %+v", link)
+	}
+
+	shared := func(u string) string {
+		return u + "?share=" + url.QueryEscape(link.Token)
+	}
+	build := func(name reference.Named, dgst digest.Digest, blob bool) string {
+		ref, _ := reference.WithDigest(name, dgst)
+		var u string
+		if blob {
+			u, err = env.builder.BuildBlobURL(ref)
+		} else {
+			u, err = env.builder.BuildManifestURL(ref)
+		}
+		checkErr(t, err, "building url")
+		return u
+	}
+
+	// The manifests and blobs of the shared index are pulled without
+	// credentials.
+	for _, u := range []string{build(imageName, image, false), build(imageName, layer, true)} {
+		resp = do("GET", shared(u), "", false)
+		defer resp.Body.Close()
+		checkResponse(t, "pulling shared content", resp, http.StatusOK)
+	}
+
+	// Nothing else is.
+	otherName, _ := reference.WithName("foo/other")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	tagsURL, err := env.builder.BuildTagsURL(imageName)
+	checkErr(t, err, "building tags url")
+	for _, u := range []string{
+		shared(build(imageName, unshared.Digest, true)),
+		shared(build(otherName, indexDigest, false)),
+		shared(tagURL),
+		shared(tagsURL),
+		build(imageName, indexDigest, false) + "?share=invalid",
+	} {
+		resp = do("GET", u, "", false)
+		defer resp.Body.Close()
+		checkResponse(t, "pulling unshared content", resp, http.StatusForbidden)
+		checkBodyHasErrorCodes(t, "pulling unshared content", resp, errcode.ErrorCodeDenied)
+	}
+	resp = do("GET", build(imageName, image, false), "", false)
+	defer resp.Body.Close()
+	checkResponse(t, "pulling without share link", resp, http.StatusUnauthorized)
+
+	// The shared index is only fetched once.
+	resp = do("GET", link.URL, "", false)
+	defer resp.Body.Close()
+	checkResponse(t, "pulling shared index", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{"Docker-Content-Digest": []string{indexDigest.String()}})
+	resp = do("HEAD", link.URL, "", false)
+	defer resp.Body.Close()
+	checkResponse(t, "checking shared index", resp, http.StatusOK)
+	resp = do("GET", link.URL, "", false)
+	defer resp.Body.Close()
+	checkResponse(t, "pulling shared index again", resp, http.StatusForbidden)
+}
+
+func TestBundleAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bundle")
+	dgst := pushIndexTestImage(t, env, imageName)
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	manifests, err := repo.Manifests(env.ctx)
+	checkErr(t, err, "getting manifest service")
+	manifest, err := manifests.Get(env.ctx, dgst)
+	checkErr(t, err, "getting manifest")
+	if err := repo.Tags(env.ctx).Tag(env.ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
+	unknownRef, _ := reference.WithTag(imageName, "unknown")
+	unknownURL, err := env.builder.BuildBundleURL(unknownRef)
+	checkErr(t, err, "building bundle url")
+	resp, err := http.Get(unknownURL)
+	checkErr(t, err, "fetching unknown bundle")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching unknown bundle", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching unknown bundle", resp, v2.ErrorCodeManifestUnknown)
+
+	// Image indexes are not bundled.
+	index, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{{
+		Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: dgst, Size: 1},
+		Platform:   manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"},
+	}})
+	checkErr(t, err, "building index")
+	indexDigest, err := manifests.Put(env.ctx, index)
+	checkErr(t, err, "putting index")
+	indexRef, _ := reference.WithDigest(imageName, indexDigest)
+	indexURL, err := env.builder.BuildBundleURL(indexRef)
+	checkErr(t, err, "building bundle url")
+	resp, err = http.Get(indexURL)
+	checkErr(t, err, "fetching index bundle")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching index bundle", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "fetching index bundle", resp, v2.ErrorCodeManifestInvalid)
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	bundleURL, err := env.builder.BuildBundleURL(tagRef)
+	checkErr(t, err, "building bundle url")
+	resp, err = http.Get(bundleURL)
+	checkErr(t, err, "fetching bundle")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching bundle", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{"application/x-tar"},
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+
+	files := make(map[string][]byte)
+	var names []string
+	tr := tar.NewReader(resp.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		checkErr(t, err, "reading bundle")
+		content, err := io.ReadAll(tr)
+		checkErr(t, err, "reading bundle")
+		files[hdr.Name] = content
+		names = append(names, hdr.Name)
+	}
+
+	expected := []string{"oci-layout", "index.json", "blobs/sha256/" + dgst.Hex()}
+	for _, desc := range manifest.References() {
+		expected = append(expected, "blobs/sha256/"+desc.Digest.Hex())
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("unexpected bundle files %v, expected %v", names, expected)
+	}
+	for _, name := range expected[2:] {
+		if got := digest.FromBytes(files[name]).Hex(); got != path.Base(name) {
+			t.Fatalf("unexpected content for %s: digest %s", name, got)
+		}
+	}
+
+	var layoutIndex v1.Index
+	if err := json.Unmarshal(files["index.json"], &layoutIndex); err != nil {
+		t.Fatalf("error decoding index.json: %v", err)
+	}
+	if len(layoutIndex.Manifests) != 1 || layoutIndex.Manifests[0].Digest != dgst || layoutIndex.Manifests[0].MediaType != schema2.MediaTypeManifest || layoutIndex.Manifests[0].Annotations[v1.AnnotationRefName] != "latest" {
+		t.Fatalf("unexpected index.json: %s", files["index.json"])
+	}
+}
+
+func TestHelmAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	chartName, _ := reference.WithName("charts/mychart")
+	repo, err := env.app.registry.Repository(env.ctx, chartName)
+	checkErr(t, err, "getting repository")
+	blobs := repo.Blobs(env.ctx)
+	manifests, err := repo.Manifests(env.ctx)
+	checkErr(t, err, "getting manifest service")
+
+	pushChart := func(version string, withProvenance bool) (archive, provenance []byte) {
+		config, err := blobs.Put(env.ctx, "application/vnd.cncf.helm.config.v1+json", []byte(`{"name":"mychart","version":"`+version+`","apiVersion":"v2","description":"A chart"}`))
+		checkErr(t, err, "putting chart metadata")
+		config.MediaType = "application/vnd.cncf.helm.config.v1+json"
+		archive = []byte("chart-" + version)
+		layer, err := blobs.Put(env.ctx, "application/vnd.cncf.helm.chart.content.v1.tar+gzip", archive)
+		checkErr(t, err, "putting chart archive")
+		layer.MediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+		layers := []distribution.Descriptor{layer}
+		if withProvenance {
+			provenance = []byte("provenance-" + version)
+			prov, err := blobs.Put(env.ctx, "application/vnd.cncf.helm.chart.provenance.v1.prov", provenance)
+			checkErr(t, err, "putting chart provenance")
+			prov.MediaType = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+			layers = append(layers, prov)
+		}
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:   ocischema.SchemaVersion,
+			Config:      config,
+			Layers:      layers,
+			Annotations: map[string]string{v1.AnnotationCreated: "2023-01-02T03:04:05Z"},
+		})
+		checkErr(t, err, "building chart manifest")
+		dgst, err := manifests.Put(env.ctx, m)
+		checkErr(t, err, "putting chart manifest")
+		if err := repo.Tags(env.ctx).Tag(env.ctx, strings.ReplaceAll(version, "+", "_"), distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatalf("unexpected error tagging chart: %v", err)
+		}
+		return archive, provenance
+	}
+	archive, provenance := pushChart("1.0.0", true)
+	pushChart("1.1.0+build.2", false)
+	// Images in the repository are not listed.
+	imageDigest := pushIndexTestImage(t, env, chartName)
+	if err := repo.Tags(env.ctx).Tag(env.ctx, "image", distribution.Descriptor{Digest: imageDigest}); err != nil {
+		t.Fatalf("unexpected error tagging image: %v", err)
+	}
+
+	indexURL, err := env.builder.BuildHelmIndexURL(chartName)
+	checkErr(t, err, "building helm index url")
+	fetchIndex := func() map[string][]string {
+		resp, err := http.Get(indexURL)
+		checkErr(t, err, "fetching helm index")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching helm index", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{"Content-Type": []string{"application/x-yaml"}})
+
+		var index struct {
+			APIVersion string `yaml:"apiVersion"`
+			Entries    map[string][]struct {
+				Name        string   `yaml:"name"`
+				Version     string   `yaml:"version"`
+				Description string   `yaml:"description"`
+				Digest      string   `yaml:"digest"`
+				Created     string   `yaml:"created"`
+				URLs        []string `yaml:"urls"`
+			} `yaml:"entries"`
+		}
+		body, err := io.ReadAll(resp.Body)
+		checkErr(t, err, "reading helm index")
+		if err := yaml.Unmarshal(body, &index); err != nil {
+			t.Fatalf("error decoding helm index: %v", err)
+		}
+		if index.APIVersion != "v1" || len(index.Entries) != 1 {
+			t.Fatalf("unexpected helm index: %s", body)
+		}
+		versions := map[string][]string{}
+		for _, entry := range index.Entries["mychart"] {
+			if entry.Name != "mychart" || entry.Description != "A chart" || entry.Created != "2023-01-02T03:04:05Z" || len(entry.URLs) != 1 {
+				t.Fatalf("unexpected helm index entry: %+v", entry)
+			}
+			versions[entry.Version] = []string{entry.Digest, entry.URLs[0]}
+		}
+		return versions
+	}
+	expected := map[string][]string{
+		"1.0.0":         {digest.FromBytes(archive).Hex(), "charts/mychart-1.0.0.tgz"},
+		"1.1.0+build.2": {digest.FromBytes([]byte("chart-1.1.0+build.2")).Hex(), "charts/mychart-1.1.0+build.2.tgz"},
+	}
+	if versions := fetchIndex(); !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("unexpected helm index entries %v, expected %v", versions, expected)
+	}
+
+	// Chart URLs are relative to the chart repository.
+	fetchChart := func(file string, status int) []byte {
+		chartURL, err := url.Parse(indexURL)
+		checkErr(t, err, "parsing helm index url")
+		chartURL, err = chartURL.Parse(file)
+		checkErr(t, err, "resolving chart url")
+		resp, err := http.Get(chartURL.String())
+		checkErr(t, err, "fetching chart")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching chart "+file, resp, status)
+		body, err := io.ReadAll(resp.Body)
+		checkErr(t, err, "reading chart")
+		return body
+	}
+	if body := fetchChart("charts/mychart-1.0.0.tgz", http.StatusOK); !bytes.Equal(body, archive) {
+		t.Fatalf("unexpected chart archive %q", body)
+	}
+	if body := fetchChart("charts/mychart-1.0.0.tgz.prov", http.StatusOK); !bytes.Equal(body, provenance) {
+		t.Fatalf("unexpected chart provenance %q", body)
+	}
+	fetchChart("charts/mychart-1.1.0+build.2.tgz.prov", http.StatusNotFound)
+	fetchChart("charts/mychart-2.0.0.tgz", http.StatusNotFound)
+
+	// The index is cached until the repository is written to through the
+	// registry, while charts are looked up by tag.
+	pushChart("1.2.0", false)
+	if versions := fetchIndex(); !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("unexpected cached helm index entries %v, expected %v", versions, expected)
+	}
+	if body := fetchChart("charts/mychart-1.2.0.tgz", http.StatusOK); string(body) != "chart-1.2.0" {
+		t.Fatalf("unexpected chart archive %q", body)
+	}
+
+	tagRef, _ := reference.WithTag(chartName, "1.0.0")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building tag url")
+	resp, err := httpDelete(tagURL)
+	checkErr(t, err, "deleting tag")
+	checkResponse(t, "deleting tag", resp, http.StatusAccepted)
+	delete(expected, "1.0.0")
+	expected["1.2.0"] = []string{digest.FromBytes([]byte("chart-1.2.0")).Hex(), "charts/mychart-1.2.0.tgz"}
+	if versions := fetchIndex(); !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("unexpected helm index entries %v, expected %v", versions, expected)
+	}
+}
+
+func TestReferrerHeaders(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Referrers.Headers = true
+	// Only pushes through the registry refresh the counts.
+	config.Referrers.CacheTTL = time.Hour
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/referred")
+	subject := pushIndexTestImage(t, env, imageName)
+	subjectRef, _ := reference.WithDigest(imageName, subject)
+	subjectURL, err := env.builder.BuildManifestURL(subjectRef)
+	checkErr(t, err, "building manifest url")
+
+	headManifest := func(msg string) *http.Response {
+		resp, err := http.Head(subjectURL)
+		checkErr(t, err, msg)
+		resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusOK)
+		return resp
+	}
+	resp := headManifest("checking manifest without referrers")
+	checkHeaders(t, resp, http.Header{"OCI-Referrers-Count": []string{"0"}})
+	if summary := resp.Header.Get("OCI-Referrers-Summary"); summary != "" {
+		t.Fatalf("unexpected referrers summary %q", summary)
+	}
+
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	referrerConfig.MediaType = v1.MediaTypeImageConfig
+	for i, artifactType := range []string{"application/vnd.example.sbom", "application/vnd.example.signature", "application/vnd.example.signature"} {
+		referrer, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: artifactType,
+			Config:       referrerConfig,
+			Layers:       []distribution.Descriptor{},
+			Subject:      &distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: subject, Size: 1},
+			Annotations:  map[string]string{"index": strconv.Itoa(i)},
+		})
+		checkErr(t, err, "building referrer")
+		tagRef, _ := reference.WithTag(imageName, "referrer-"+strconv.Itoa(i))
+		tagURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting referrer", tagURL, v1.MediaTypeImageManifest, referrer)
+		resp.Body.Close()
+		checkResponse(t, "putting referrer", resp, http.StatusCreated)
+	}
+
+	resp = headManifest("checking manifest with referrers")
+	checkHeaders(t, resp, http.Header{
+		"OCI-Referrers-Count":   []string{"3"},
+		"OCI-Referrers-Summary": []string{"application/vnd.example.sbom=1, application/vnd.example.signature=2"},
+	})
+
+	// The referrers route counts them without listing them.
+	headReferrers := func(env *testEnv, values url.Values) *http.Response {
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values)
+		checkErr(t, err, "building referrers url")
+		resp, err := http.Head(referrersURL)
+		checkErr(t, err, "counting referrers")
+		resp.Body.Close()
+		checkResponse(t, "counting referrers", resp, http.StatusOK)
+		return resp
+	}
+	resp = headReferrers(env, url.Values{})
+	checkHeaders(t, resp, http.Header{
+		"OCI-Referrers-Count":   []string{"3"},
+		"OCI-Referrers-Summary": []string{"application/vnd.example.sbom=1, application/vnd.example.signature=2"},
+	})
+	resp = headReferrers(env, url.Values{"artifactType": []string{"application/vnd.example.signature"}})
+	checkHeaders(t, resp, http.Header{
+		"OCI-Referrers-Count":   []string{"2"},
+		"OCI-Referrers-Summary": []string{"application/vnd.example.signature=2"},
+	})
+
+	// The headers are off by default.
+	env2 := newTestEnv(t, false)
+	defer env2.Shutdown()
+	dgst := pushIndexTestImage(t, env2, imageName)
+	ref, _ := reference.WithDigest(imageName, dgst)
+	manifestURL, err := env2.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp, err = http.Get(manifestURL)
+	checkErr(t, err, "fetching manifest")
+	resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+	if count := resp.Header.Get("OCI-Referrers-Count"); count != "" {
+		t.Fatalf("unexpected referrers count %q", count)
+	}
+	// Counting referrers does not depend on the headers.
+	subjectRef, _ = reference.WithDigest(imageName, dgst)
+	resp = headReferrers(env2, url.Values{})
+	checkHeaders(t, resp, http.Header{"OCI-Referrers-Count": []string{"0"}})
+}
+
+func TestReferrersPagination(t *testing.T) {
+	for _, index := range []bool{false, true} {
+		t.Run(fmt.Sprintf("index=%v", index), func(t *testing.T) {
+			testReferrersPagination(t, index)
+		})
+	}
+}
+
+func testReferrersPagination(t *testing.T, index bool) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Referrers.Index = index
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/paginated")
+	subject := pushIndexTestImage(t, env, imageName)
+
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	referrerConfig.MediaType = v1.MediaTypeImageConfig
+	signatures := map[digest.Digest]struct{}{}
+	for i, artifactType := range []string{"application/vnd.example.sbom", "application/vnd.example.signature", "application/vnd.example.signature"} {
+		referrer, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: artifactType,
+			Config:       referrerConfig,
+			Layers:       []distribution.Descriptor{},
+			Subject:      &distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: subject, Size: 1},
+			Annotations:  map[string]string{"index": strconv.Itoa(i)},
+		})
+		checkErr(t, err, "building referrer")
+		_, payload, _ := referrer.Payload()
+		if artifactType == "application/vnd.example.signature" {
+			signatures[digest.FromBytes(payload)] = struct{}{}
+		}
+		tagRef, _ := reference.WithTag(imageName, "referrer-"+strconv.Itoa(i))
+		tagURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting referrer", tagURL, v1.MediaTypeImageManifest, referrer)
+		resp.Body.Close()
+		checkResponse(t, "putting referrer", resp, http.StatusCreated)
+	}
+
+	subjectRef, _ := reference.WithDigest(imageName, subject)
+	linkRegexp := regexp.MustCompile(`^<(/v2/foo/paginated/referrers/[^>]*)>; rel="next"$`)
+	// listReferrers follows the Link headers from the given query, checking
+	// the size of each page, and returns the digests listed.
+	listReferrers := func(values url.Values, pageSize int) []digest.Digest {
+		var digests []digest.Digest
+		for {
+			referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values)
+			checkErr(t, err, "building referrers url")
+			resp, err := http.Get(referrersURL)
+			checkErr(t, err, "fetching referrers")
+			defer resp.Body.Close()
+			checkResponse(t, "fetching referrers", resp, http.StatusOK)
+			var index v1.Index
+			if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+				t.Fatalf("error decoding referrers: %v", err)
+			}
+			for _, desc := range index.Manifests {
+				digests = append(digests, desc.Digest)
+			}
+
+			link := resp.Header.Get("Link")
+			if link == "" {
+				if len(index.Manifests) > pageSize {
+					t.Fatalf("unexpected page of %d referrers", len(index.Manifests))
+				}
+				return digests
+			}
+			if len(index.Manifests) != pageSize {
+				t.Fatalf("unexpected page of %d referrers", len(index.Manifests))
+			}
+			matches := linkRegexp.FindStringSubmatch(link)
+			if matches == nil {
+				t.Fatalf("unexpected link %q", link)
+			}
+			linkURL, err := url.Parse(matches[1])
+			checkErr(t, err, "parsing link")
+			values = linkURL.Query()
+			if values.Get("last") != index.Manifests[len(index.Manifests)-1].Digest.String() {
+				t.Fatalf("unexpected last referrer in link %q", link)
+			}
+		}
+	}
+
+	all := listReferrers(url.Values{}, 3)
+	if len(all) != 3 || !sort.SliceIsSorted(all, func(i, j int) bool { return all[i] < all[j] }) {
+		t.Fatalf("unexpected referrers %v", all)
+	}
+	if paged := listReferrers(url.Values{"n": []string{"1"}}, 1); !reflect.DeepEqual(paged, all) {
+		t.Fatalf("unexpected paged referrers %v, expected %v", paged, all)
+	}
+	filtered := listReferrers(url.Values{"n": []string{"1"}, "artifactType": []string{"application/vnd.example.signature"}}, 1)
+	if len(filtered) != len(signatures) {
+		t.Fatalf("unexpected filtered referrers %v", filtered)
+	}
+	for _, dgst := range filtered {
+		if _, ok := signatures[dgst]; !ok {
+			t.Fatalf("unexpected filtered referrer %s", dgst)
+		}
+	}
+	for _, artifactTypes := range [][]string{
+		{"application/vnd.example.signature,application/vnd.example.sbom"},
+		{"application/vnd.example.sbom", "application/vnd.example.signature"},
+	} {
+		if listed := listReferrers(url.Values{"n": []string{"2"}, "artifactType": artifactTypes}, 2); !reflect.DeepEqual(listed, all) {
+			t.Fatalf("unexpected referrers %v of artifact types %v, expected %v", listed, artifactTypes, all)
+		}
+	}
+	if listed := listReferrers(url.Values{"artifactType": []string{"application/vnd.example.sbom,application/vnd.example.other"}}, 3); len(listed) != 1 {
+		t.Fatalf("unexpected referrers %v of artifact types", listed)
+	}
+	if annotated := listReferrers(url.Values{"n": []string{"1"}, "annotation": []string{"index"}}, 1); !reflect.DeepEqual(annotated, all) {
+		t.Fatalf("unexpected referrers %v with an annotation, expected %v", annotated, all)
+	}
+	// The filters must all match.
+	for _, tc := range []struct {
+		annotations []string
+		expected    int
+	}{
+		{annotations: []string{"index=1"}, expected: 1},
+		{annotations: []string{"index=0"}, expected: 0},
+		{annotations: []string{"index=2", "index=1"}, expected: 0},
+	} {
+		annotated := listReferrers(url.Values{"annotation": tc.annotations, "artifactType": []string{"application/vnd.example.signature"}}, 3)
+		if len(annotated) != tc.expected {
+			t.Fatalf("unexpected referrers %v with annotations %v", annotated, tc.annotations)
+		}
+	}
+
+	referrersURL, err := env.builder.BuildReferrersURL(subjectRef, url.Values{"annotation": []string{"index=0"}})
+	checkErr(t, err, "building referrers url")
+	resp, err := http.Get(referrersURL)
+	checkErr(t, err, "fetching referrers")
+	defer resp.Body.Close()
+	var annotated v1.Index
+	if err := json.NewDecoder(resp.Body).Decode(&annotated); err != nil {
+		t.Fatalf("error decoding referrers: %v", err)
+	}
+	if len(annotated.Manifests) != 1 || annotated.Manifests[0].Annotations["index"] != "0" || annotated.Annotations[v1.AnnotationReferrersFiltersApplied] != "annotation" {
+		t.Fatalf("unexpected referrers %+v with an annotation", annotated)
+	}
+
+	for _, values := range []url.Values{
+		{"n": []string{"-1"}},
+		{"n": []string{"foo"}},
+		{"last": []string{"foo"}},
+	} {
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values)
+		checkErr(t, err, "building referrers url")
+		resp, err := http.Get(referrersURL)
+		checkErr(t, err, "fetching referrers")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching referrers with invalid pagination", resp, http.StatusBadRequest)
+	}
+}
+
+// TestReferrersOrder checks that referrers are listed newest first, then by
+// digest, the same with or without the referrers index, and that pages
+// follow that order.
+func TestReferrersOrder(t *testing.T) {
+	for _, index := range []bool{false, true} {
+		t.Run(fmt.Sprintf("index=%v", index), func(t *testing.T) {
+			testReferrersOrder(t, index)
+		})
+	}
+}
+
+func testReferrersOrder(t *testing.T, index bool) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Referrers.Index = index
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/ordered")
+	subject := pushIndexTestImage(t, env, imageName)
+
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	referrerConfig.MediaType = v1.MediaTypeImageConfig
+	// Referrers pushed out of order, two of them at the same time, and two
+	// without a valid created annotation.
+	created := []string{"2023-01-01T00:00:00Z", "2023-06-01T00:00:00Z", "", "2023-06-01T00:00:00Z", "yesterday"}
+	referrers := make([]digest.Digest, len(created))
+	for i, c := range created {
+		annotations := map[string]string{"index": strconv.Itoa(i)}
+		if c != "" {
+			annotations[v1.AnnotationCreated] = c
+		}
+		referrer, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: "application/vnd.example.signature",
+			Config:       referrerConfig,
+			Layers:       []distribution.Descriptor{},
+			Subject:      &distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: subject, Size: 1},
+			Annotations:  annotations,
+		})
+		checkErr(t, err, "building referrer")
+		tagRef, _ := reference.WithTag(imageName, "referrer-"+strconv.Itoa(i))
+		tagURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting referrer", tagURL, v1.MediaTypeImageManifest, referrer)
+		resp.Body.Close()
+		checkResponse(t, "putting referrer", resp, http.StatusCreated)
+		referrers[i] = digest.Digest(resp.Header.Get("Docker-Content-Digest"))
+	}
+	inDigestOrder := func(a, b digest.Digest) []digest.Digest {
+		if a < b {
+			return []digest.Digest{a, b}
+		}
+		return []digest.Digest{b, a}
+	}
+	expected := append(inDigestOrder(referrers[1], referrers[3]), referrers[0])
+	expected = append(expected, inDigestOrder(referrers[2], referrers[4])...)
+
+	subjectRef, _ := reference.WithDigest(imageName, subject)
+	fetchReferrers := func(values url.Values, status int) []digest.Digest {
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values)
+		checkErr(t, err, "building referrers url")
+		resp, err := http.Get(referrersURL)
+		checkErr(t, err, "fetching referrers")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching referrers", resp, status)
+		var index v1.Index
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("error decoding referrers: %v", err)
+		}
+		var digests []digest.Digest
+		for _, desc := range index.Manifests {
+			digests = append(digests, desc.Digest)
+		}
+		return digests
+	}
+
+	if listed := fetchReferrers(url.Values{}, http.StatusOK); !reflect.DeepEqual(listed, expected) {
+		t.Fatalf("unexpected referrers %v, expected %v", listed, expected)
+	}
+	var paged []digest.Digest
+	values := url.Values{"n": []string{"2"}}
+	for {
+		page := fetchReferrers(values, http.StatusOK)
+		paged = append(paged, page...)
+		if len(page) < 2 {
+			break
+		}
+		values.Set("last", page[len(page)-1].String())
+	}
+	if !reflect.DeepEqual(paged, expected) {
+		t.Fatalf("unexpected paged referrers %v, expected %v", paged, expected)
+	}
+
+	// A page cannot follow a digest which is not a referrer.
+	fetchReferrers(url.Values{"last": []string{subject.String()}}, http.StatusBadRequest)
+}
+
+// TestReferrersSubjectAlgorithms checks that the referrers of a subject
+// referenced by digests of different algorithms are listed apart.
+func TestReferrersSubjectAlgorithms(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/algorithms")
+	subject := pushIndexTestImage(t, env, imageName)
+	subjectRef, _ := reference.WithDigest(imageName, subject)
+	subjectURL, err := env.builder.BuildManifestURL(subjectRef)
+	checkErr(t, err, "building manifest url")
+	resp, err := http.Get(subjectURL)
+	checkErr(t, err, "fetching subject")
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	checkErr(t, err, "reading subject")
+
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	referrerConfig.MediaType = v1.MediaTypeImageConfig
+	referrers := make(map[digest.Digest]digest.Digest)
+	for _, subject := range []digest.Digest{digest.SHA256.FromBytes(payload), digest.SHA512.FromBytes(payload)} {
+		referrer, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: "application/vnd.example.signature",
+			Config:       referrerConfig,
+			Layers:       []distribution.Descriptor{},
+			Subject:      &distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: subject, Size: int64(len(payload))},
+		})
+		checkErr(t, err, "building referrer")
+		tagRef, _ := reference.WithTag(imageName, "signature-"+subject.Algorithm().String())
+		tagURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting referrer", tagURL, v1.MediaTypeImageManifest, referrer)
+		resp.Body.Close()
+		checkResponse(t, "putting referrer", resp, http.StatusCreated)
+		referrers[subject] = digest.Digest(resp.Header.Get("Docker-Content-Digest"))
+	}
+
+	for subject, referrer := range referrers {
+		subjectRef, _ := reference.WithDigest(imageName, subject)
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, url.Values{})
+		checkErr(t, err, "building referrers url")
+		resp, err := http.Get(referrersURL)
+		checkErr(t, err, "fetching referrers")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching referrers", resp, http.StatusOK)
+		var index v1.Index
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("error decoding referrers: %v", err)
+		}
+		if len(index.Manifests) != 1 || index.Manifests[0].Digest != referrer {
+			t.Fatalf("unexpected referrers %+v of %s, expected %s", index.Manifests, subject, referrer)
+		}
+
+		resp, err = http.Head(referrersURL)
+		checkErr(t, err, "counting referrers")
+		resp.Body.Close()
+		checkResponse(t, "counting referrers", resp, http.StatusOK)
+		if count := resp.Header.Get("OCI-Referrers-Count"); count != "1" {
+			t.Fatalf("unexpected referrers count %q of %s", count, subject)
+		}
+	}
+}
+
+// repositoryAccessController grants access to the listed repositories only.
+type repositoryAccessController map[string]bool
+
+func (ac repositoryAccessController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	for _, a := range access {
+		if a.Type == "repository" && !ac[a.Name] {
+			return nil, repositoryAccessChallenge(a.Name)
+		}
+	}
+	return ctx, nil
+}
+
+type repositoryAccessChallenge string
+
+func (c repositoryAccessChallenge) Error() string {
+	return "access to " + string(c) + " denied"
+}
+
+func (repositoryAccessChallenge) SetHeaders(r *http.Request, w http.ResponseWriter) {}
+
+// TestGlobalReferrers checks that the referrers of a subject are listed
+// across the repositories the client may pull from.
+func TestGlobalReferrers(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Referrers.Global = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	subject := digest.FromString("released image")
+	referrers := make(map[string]digest.Digest)
+	for _, repoName := range []string{"foo/signed", "foo/scanned", "foo/private"} {
+		imageName, _ := reference.WithName(repoName)
+		repo, err := env.app.registry.Repository(env.ctx, imageName)
+		checkErr(t, err, "getting repository")
+		referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+		checkErr(t, err, "putting config")
+		referrerConfig.MediaType = v1.MediaTypeImageConfig
+		referrer, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: "application/vnd.example." + path.Base(repoName),
+			Config:       referrerConfig,
+			Layers:       []distribution.Descriptor{},
+			Subject:      &distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: subject, Size: 1},
+		})
+		checkErr(t, err, "building referrer")
+		tagRef, _ := reference.WithTag(imageName, "referrer")
+		tagURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting referrer", tagURL, v1.MediaTypeImageManifest, referrer)
+		resp.Body.Close()
+		checkResponse(t, "putting referrer", resp, http.StatusCreated)
+		referrers[repoName] = digest.Digest(resp.Header.Get("Docker-Content-Digest"))
+	}
+	env.app.accessController = repositoryAccessController{"foo/signed": true, "foo/scanned": true}
+
+	listReferrers := func(values url.Values) []string {
+		referrersURL, err := env.builder.BuildGlobalReferrersURL(subject, values)
+		checkErr(t, err, "building global referrers url")
+		resp, err := http.Get(referrersURL)
+		checkErr(t, err, "fetching global referrers")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching global referrers", resp, http.StatusOK)
+		var body struct {
+			Subject   digest.Digest `json:"subject"`
+			Referrers []struct {
+				Repository string        `json:"repository"`
+				Digest     digest.Digest `json:"digest"`
+			} `json:"referrers"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("error decoding global referrers: %v", err)
+		}
+		if body.Subject != subject {
+			t.Fatalf("unexpected subject %s", body.Subject)
+		}
+		var repositories []string
+		for _, referrer := range body.Referrers {
+			if referrer.Digest != referrers[referrer.Repository] {
+				t.Fatalf("unexpected referrer %s of %s", referrer.Digest, referrer.Repository)
+			}
+			repositories = append(repositories, referrer.Repository)
+		}
+		return repositories
+	}
+
+	if listed := listReferrers(url.Values{}); !reflect.DeepEqual(listed, []string{"foo/scanned", "foo/signed"}) {
+		t.Fatalf("unexpected repositories %v of global referrers", listed)
+	}
+	if listed := listReferrers(url.Values{"artifactType": []string{"application/vnd.example.signed"}}); !reflect.DeepEqual(listed, []string{"foo/signed"}) {
+		t.Fatalf("unexpected repositories %v of filtered global referrers", listed)
+	}
+
+	// Repositories the network rules restrict for the client are left out.
+	ipFilter, err := ipfilter.New(configuration.Network{
+		Rules: []configuration.NetworkRule{{Repositories: []string{"foo/scanned"}, Deny: []string{"127.0.0.0/8", "::1/128"}}},
+	})
+	checkErr(t, err, "configuring network rules")
+	env.app.ipFilter = ipFilter
+	if listed := listReferrers(url.Values{}); !reflect.DeepEqual(listed, []string{"foo/signed"}) {
+		t.Fatalf("unexpected repositories %v of global referrers from a denied network", listed)
+	}
+}
+
+// TestGlobalReferrersDisabled checks that the registry-scoped referrers
+// query is refused without the global referrers index.
+func TestGlobalReferrersDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	referrersURL, err := env.builder.BuildGlobalReferrersURL(digest.FromString("subject"))
+	checkErr(t, err, "building global referrers url")
+	resp, err := http.Get(referrersURL)
+	checkErr(t, err, "fetching global referrers")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching global referrers", resp, http.StatusMethodNotAllowed)
+}
+
+// TestSubjectInvalidDocumentation checks that a referrer of a blob is
+// refused with an error pointing to its documentation.
+func TestSubjectInvalidDocumentation(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.ErrorDocs = "https://docs.example.com/errors#"
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+	defer errcode.SetDocumentationBase("")
+
+	imageName, _ := reference.WithName("foo/documented")
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	referrerConfig.MediaType = v1.MediaTypeImageConfig
+	referrer, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: "application/vnd.example.signature",
+		Config:       referrerConfig,
+		Layers:       []distribution.Descriptor{},
+		Subject:      &distribution.Descriptor{MediaType: v1.MediaTypeImageLayer, Digest: digest.FromString("layer"), Size: 5},
+	})
+	checkErr(t, err, "building referrer")
+	tagRef, _ := reference.WithTag(imageName, "signature")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting referrer of a blob", tagURL, v1.MediaTypeImageManifest, referrer)
+	defer resp.Body.Close()
+	checkResponse(t, "putting referrer of a blob", resp, http.StatusBadRequest)
+	errs, _, _ := checkBodyHasErrorCodes(t, "putting referrer of a blob", resp, v2.ErrorCodeSubjectInvalid)
+	if docURL := errs[0].(errcode.Error).DocURL; docURL != "https://docs.example.com/errors#subject_invalid" {
+		t.Fatalf("unexpected documentation url %q", docURL)
+	}
+}
+
+// TestReferrersLimitExceeded checks that a referrer of a subject which
+// already has the maximum number of referrers is refused.
+func TestReferrersLimitExceeded(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Referrers.MaxPerSubject = 1
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/limited")
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	referrerConfig.MediaType = v1.MediaTypeImageConfig
+	subject := digest.FromString("subject")
+	putReferrer := func(artifactType string) *http.Response {
+		referrer, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned:    ocischema.SchemaVersion,
+			ArtifactType: artifactType,
+			Config:       referrerConfig,
+			Layers:       []distribution.Descriptor{},
+			Subject:      &distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: subject, Size: 7},
+		})
+		checkErr(t, err, "building referrer")
+		_, payload, err := referrer.Payload()
+		checkErr(t, err, "getting referrer payload")
+		digestRef, _ := reference.WithDigest(imageName, digest.FromBytes(payload))
+		manifestURL, err := env.builder.BuildManifestURL(digestRef)
+		checkErr(t, err, "building manifest url")
+		return putManifest(t, "putting referrer", manifestURL, v1.MediaTypeImageManifest, referrer)
+	}
+
+	resp := putReferrer("application/vnd.example.signature")
+	defer resp.Body.Close()
+	checkResponse(t, "putting first referrer", resp, http.StatusCreated)
+
+	resp = putReferrer("application/vnd.example.sbom")
+	defer resp.Body.Close()
+	checkResponse(t, "putting referrer over the limit", resp, http.StatusBadRequest)
+	errs, _, _ := checkBodyHasErrorCodes(t, "putting referrer over the limit", resp, v2.ErrorCodeReferrersLimitExceeded)
+	detail, _ := errs[0].(errcode.Error).Detail.(map[string]interface{})
+	if detail["subject"] != subject.String() || detail["limit"] != float64(1) {
+		t.Fatalf("unexpected error detail %v", errs[0].(errcode.Error).Detail)
+	}
+}
+
+// TestWarningNotices checks that the configured notices are attached to the
+// successful responses of the matching requests only.
+func TestWarningNotices(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Policy.Warnings.Notices = []configuration.WarningNotice{{
+		Repositories: []string{"foo/.*"},
+		Methods:      []string{"get"},
+		Message:      `tags of "foo" will become immutable`,
+	}}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	blobURL := func(repoName string, dgst digest.Digest) string {
+		name, _ := reference.WithName(repoName)
+		ref, _ := reference.WithDigest(name, dgst)
+		u, err := env.builder.BuildBlobURL(ref)
+		checkErr(t, err, "building blob url")
+		return u
+	}
+	for _, repoName := range []string{"foo/warned", "bar/quiet"} {
+		name, _ := reference.WithName(repoName)
+		repo, err := env.app.registry.Repository(env.ctx, name)
+		checkErr(t, err, "getting repository")
+		_, err = repo.Blobs(env.ctx).Put(env.ctx, "application/octet-stream", []byte("content"))
+		checkErr(t, err, "putting blob")
+	}
+	dgst := digest.FromBytes([]byte("content"))
+
+	for _, tc := range []struct {
+		method   string
+		url      string
+		status   int
+		expected []string
+	}{
+		{method: http.MethodGet, url: blobURL("foo/warned", dgst), status: http.StatusOK, expected: []string{`299 - "tags of \"foo\" will become immutable"`}},
+		{method: http.MethodHead, url: blobURL("foo/warned", dgst), status: http.StatusOK},
+		{method: http.MethodGet, url: blobURL("foo/warned", digest.FromString("unknown")), status: http.StatusNotFound},
+		{method: http.MethodGet, url: blobURL("bar/quiet", dgst), status: http.StatusOK},
+	} {
+		req, err := http.NewRequest(tc.method, tc.url, nil)
+		checkErr(t, err, "building request")
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "doing request")
+		resp.Body.Close()
+		checkResponse(t, tc.method+" "+tc.url, resp, tc.status)
+		if warnings := resp.Header.Values("Warning"); !reflect.DeepEqual(warnings, tc.expected) {
+			t.Errorf("unexpected warnings %q on %s %s, expected %q", warnings, tc.method, tc.url, tc.expected)
+		}
+	}
+}
+
+// TestNotaryProxy checks that content trust requests are forwarded to the
+// Notary server once the client is granted access to the repository.
+func TestNotaryProxy(t *testing.T) {
+	type notaryRequest struct {
+		method        string
+		path          string
+		authorization string
+	}
+	var forwarded []notaryRequest
+	notary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, notaryRequest{method: r.Method, path: r.URL.Path, authorization: r.Header.Get("Authorization")})
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	}))
+	defer notary.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Notary.URL = notary.URL + "/notary/"
+	config.HTTP.Host = "https://registry.example.com"
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+	env.app.accessController = repositoryAccessController{"foo/signed": true}
+	serverURL, err := url.Parse(env.server.URL)
+	checkErr(t, err, "parsing server url")
+
+	for _, tc := range []struct {
+		method    string
+		path      string
+		status    int
+		forwarded string
+		// requestHost unsets http.host.
+		requestHost bool
+	}{
+		{method: http.MethodGet, path: "/v2/registry.example.com/foo/signed/_trust/tuf/root.json", status: http.StatusOK, forwarded: "/notary/v2/registry.example.com/foo/signed/_trust/tuf/root.json"},
+		// Paths with a trailing slash are not redirected.
+		{method: http.MethodPost, path: "/v2/registry.example.com/foo/signed/_trust/tuf/", status: http.StatusOK, forwarded: "/notary/v2/registry.example.com/foo/signed/_trust/tuf/"},
+		{method: http.MethodGet, path: "/v2/registry.example.com/foo/private/_trust/tuf/root.json", status: http.StatusUnauthorized},
+		// The trust data of other registries is not reachable.
+		{method: http.MethodGet, path: "/v2/other.example.com/foo/signed/_trust/tuf/root.json", status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/v2/localhost:5000/foo/signed/_trust/tuf/", status: http.StatusNotFound},
+		// Without http.host, the host of the request is the registry host.
+		{method: http.MethodGet, path: "/v2/" + serverURL.Host + "/foo/signed/_trust/tuf/root.json", status: http.StatusOK, forwarded: "/notary/v2/" + serverURL.Host + "/foo/signed/_trust/tuf/root.json", requestHost: true},
+		{method: http.MethodGet, path: "/v2/registry.example.com/foo/signed/_trust/tuf/root.json", status: http.StatusNotFound, requestHost: true},
+	} {
+		env.app.httpHost = url.URL{Scheme: "https", Host: "registry.example.com"}
+		if tc.requestHost {
+			env.app.httpHost = url.URL{}
+		}
+		forwarded = nil
+		req, err := http.NewRequest(tc.method, env.server.URL+tc.path, nil)
+		checkErr(t, err, "building request")
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, "doing request")
+		resp.Body.Close()
+		checkResponse(t, tc.method+" "+tc.path, resp, tc.status)
+
+		var expected []notaryRequest
+		if tc.forwarded != "" {
+			expected = []notaryRequest{{method: tc.method, path: tc.forwarded}}
+		}
+		if !reflect.DeepEqual(forwarded, expected) {
+			t.Fatalf("unexpected requests %+v forwarded for %s %s, expected %+v", forwarded, tc.method, tc.path, expected)
+		}
+	}
+
+	disabledEnv := newTestEnv(t, false)
+	defer disabledEnv.Shutdown()
+	resp, err := http.Get(disabledEnv.server.URL + "/v2/registry.example.com/foo/signed/_trust/tuf/root.json")
+	checkErr(t, err, "fetching trust data")
+	resp.Body.Close()
+	checkResponse(t, "fetching trust data without a Notary server", resp, http.StatusMethodNotAllowed)
+}
+
+// TestIndexReferrers checks that image indexes with a subject, such as
+// bundles of attestations, are listed as referrers.
+func TestIndexReferrers(t *testing.T) {
+	for _, index := range []bool{false, true} {
+		t.Run(fmt.Sprintf("index=%v", index), func(t *testing.T) {
+			testIndexReferrers(t, index)
+		})
+	}
+}
+
+func testIndexReferrers(t *testing.T, index bool) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Referrers.Index = index
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/attested")
+	subject := pushIndexTestImage(t, env, imageName)
+	subjectRef, _ := reference.WithDigest(imageName, subject)
+
+	tagRef, _ := reference.WithTag(imageName, "attestations")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting index referrer", tagURL, v1.MediaTypeImageIndex, manifestlist.ManifestList{
+		Versioned:    manifestlist.OCISchemaVersion,
+		Manifests:    []manifestlist.ManifestDescriptor{},
+		ArtifactType: "application/vnd.example.attestations",
+		Subject:      &distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: subject, Size: 1},
+		Annotations:  map[string]string{"org.example.bundle": "attestations"},
+	})
+	resp.Body.Close()
+	checkResponse(t, "putting index referrer", resp, http.StatusCreated)
+	referrer := digest.Digest(resp.Header.Get("Docker-Content-Digest"))
+
+	listReferrers := func() []v1.Descriptor {
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, url.Values{"artifactType": []string{"application/vnd.example.attestations"}})
+		checkErr(t, err, "building referrers url")
+		resp, err := http.Get(referrersURL)
+		checkErr(t, err, "fetching referrers")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching referrers", resp, http.StatusOK)
+		var index v1.Index
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("error decoding referrers: %v", err)
+		}
+		return index.Manifests
+	}
+
+	referrers := listReferrers()
+	if len(referrers) != 1 {
+		t.Fatalf("unexpected referrers %+v", referrers)
+	}
+	if referrers[0].Digest != referrer || referrers[0].MediaType != v1.MediaTypeImageIndex || referrers[0].Annotations["org.example.bundle"] != "attestations" {
+		t.Fatalf("unexpected index referrer %+v", referrers[0])
+	}
+
+	referrerRef, _ := reference.WithDigest(imageName, referrer)
+	referrerURL, err := env.builder.BuildManifestURL(referrerRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = httpDelete(referrerURL)
+	checkErr(t, err, "deleting index referrer")
+	resp.Body.Close()
+	checkResponse(t, "deleting index referrer", resp, http.StatusAccepted)
+	if referrers := listReferrers(); len(referrers) != 0 {
+		t.Fatalf("unexpected referrers %+v after deleting the index", referrers)
+	}
+}
+
+// TestReferrersConditionalGet checks that the referrers API answers polling
+// clients with 304 Not Modified until the referrers change.
+func TestReferrersConditionalGet(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/polled")
+	subject := pushIndexTestImage(t, env, imageName)
+	subjectRef, _ := reference.WithDigest(imageName, subject)
+	referrersURL, err := env.builder.BuildReferrersURL(subjectRef, url.Values{})
+	checkErr(t, err, "building referrers url")
+
+	fetchReferrers := func(msg, etag string, status int) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, referrersURL, nil)
+		checkErr(t, err, "creating request")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		checkErr(t, err, msg)
+		resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+		if resp.Header.Get("Etag") == "" {
+			t.Fatalf("%s: expected an Etag header", msg)
+		}
+		return resp
+	}
+
+	etag := fetchReferrers("fetching referrers", "", http.StatusOK).Header.Get("Etag")
+	resp := fetchReferrers("fetching unchanged referrers", etag, http.StatusNotModified)
+	if resp.Header.Get("Etag") != etag {
+		t.Fatalf("unexpected Etag %q of unchanged referrers, expected %q", resp.Header.Get("Etag"), etag)
+	}
+	// Unquoted entity tags are accepted like for manifests.
+	fetchReferrers("fetching unchanged referrers with an unquoted etag", strings.Trim(etag, `"`), http.StatusNotModified)
+
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	checkErr(t, err, "getting repository")
+	referrerConfig, err := repo.Blobs(env.ctx).Put(env.ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	checkErr(t, err, "putting config")
+	referrerConfig.MediaType = v1.MediaTypeImageConfig
+	referrer, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: "application/vnd.example.signature",
+		Config:       referrerConfig,
+		Layers:       []distribution.Descriptor{},
+		Subject:      &distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: subject, Size: 1},
+	})
+	checkErr(t, err, "building referrer")
+	tagRef, _ := reference.WithTag(imageName, "signature")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp = putManifest(t, "putting referrer", tagURL, v1.MediaTypeImageManifest, referrer)
+	resp.Body.Close()
+	checkResponse(t, "putting referrer", resp, http.StatusCreated)
+
+	resp = fetchReferrers("fetching changed referrers", etag, http.StatusOK)
+	if resp.Header.Get("Etag") == etag {
+		t.Fatalf("expected the Etag to change with the referrers")
+	}
+}
+
+func TestGraphAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/graph")
+	first := pushIndexTestImage(t, env, imageName)
+	pushIndexTestImage(t, env, imageName)
+
+	fetchGraph := func(msg string, accept string, digests ...digest.Digest) *http.Response {
+		values := url.Values{}
+		for _, dgst := range digests {
+			values.Add("digest", dgst.String())
+		}
+		graphURL, err := env.builder.BuildGraphURL(imageName, values)
+		if err != nil {
+			t.Fatalf("unexpected error building graph url: %v", err)
+		}
+		req, err := http.NewRequest("GET", graphURL, nil)
+		if err != nil {
+			t.Fatalf("error constructing request: %s", err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error %s: %v", msg, err)
+		}
+		return resp
+	}
+
+	resp := fetchGraph("fetching graph of unknown manifest", "", digest.FromString("unknown"))
+	defer resp.Body.Close()
+	checkResponse(t, "fetching graph of unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching graph of unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+
+	// Both images share their config.
+	for _, tc := range []struct {
+		digests []digest.Digest
+		nodes   int
+	}{
+		{nodes: 5},
+		{digests: []digest.Digest{first}, nodes: 3},
+	} {
+		resp := fetchGraph("fetching graph", "", tc.digests...)
+		defer resp.Body.Close()
+		checkResponse(t, "fetching graph", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Content-Type": []string{"application/json"},
+		})
+
+		var graph storage.Graph
+		if err := json.NewDecoder(resp.Body).Decode(&graph); err != nil {
+			t.Fatalf("error decoding graph: %v", err)
+		}
+		if graph.Repository != imageName.Name() || len(graph.Nodes) != tc.nodes {
+			t.Fatalf("unexpected graph for %v: %v", tc.digests, graph)
+		}
+	}
+
+	resp = fetchGraph("fetching DOT graph", mediaTypeDOT, first)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching DOT graph", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type": []string{mediaTypeDOT},
+	})
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading DOT graph: %v", err)
+	}
+	if !strings.HasPrefix(string(body), `digraph "foo/graph" {`) {
+		t.Fatalf("unexpected DOT graph:\n%s", body)
+	}
+}
+
+func TestImpactAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/impact")
+	image := pushIndexTestImage(t, env, imageName)
+	repo, err := env.app.registry.Repository(env.ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	if err := repo.Tags(env.ctx).Tag(env.ctx, "latest", distribution.Descriptor{Digest: image}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+	index, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: image}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating index: %v", err)
+	}
+	manifests, err := repo.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	indexDigest, err := manifests.Put(env.ctx, index)
+	if err != nil {
+		t.Fatalf("unexpected error putting index: %v", err)
+	}
+
+	fetchImpact := func(msg string, ref reference.Named, status int) *storage.DeleteImpact {
+		impactURL, err := env.builder.BuildImpactURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error building impact url: %v", err)
+		}
+		resp, err := http.Get(impactURL)
+		if err != nil {
+			t.Fatalf("unexpected error %s: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+		if status != http.StatusOK {
+			checkBodyHasErrorCodes(t, msg, resp, v2.ErrorCodeManifestUnknown)
+			return nil
+		}
+		var impact storage.DeleteImpact
+		if err := json.NewDecoder(resp.Body).Decode(&impact); err != nil {
+			t.Fatalf("error decoding impact: %v", err)
+		}
+		return &impact
+	}
+
+	ref, _ := reference.WithDigest(imageName, image)
+	impact := fetchImpact("fetching impact of deleting a manifest", ref, http.StatusOK)
+	if !reflect.DeepEqual(impact.Tags, []string{"latest"}) || !reflect.DeepEqual(impact.Indexes, []digest.Digest{indexDigest}) || len(impact.Referrers) != 0 {
+		t.Fatalf("unexpected impact of deleting a manifest: %+v", impact)
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	impact = fetchImpact("fetching impact of deleting a tag", tagRef, http.StatusOK)
+	if impact.Tag != "latest" || impact.Digest != image || !impact.Untagged || len(impact.Indexes) != 0 {
+		t.Fatalf("unexpected impact of deleting a tag: %+v", impact)
+	}
+
+	// Nothing was deleted.
+	if _, err := repo.Tags(env.ctx).Get(env.ctx, "latest"); err != nil {
+		t.Fatalf("tag deleted by a dry run: %v", err)
+	}
+
+	unknownRef, _ := reference.WithDigest(imageName, digest.FromString("unknown"))
+	fetchImpact("fetching impact of deleting an unknown manifest", unknownRef, http.StatusNotFound)
+	unknownTag, _ := reference.WithTag(imageName, "unknown")
+	fetchImpact("fetching impact of deleting an unknown tag", unknownTag, http.StatusNotFound)
+}
+
+func TestTimelineAPI(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/timeline")
+	timelineURL, err := env.builder.BuildTimelineURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building timeline url: %v", err)
+	}
+	fetchTimeline := func(msg string, values url.Values, status int) []storage.TimelineEvent {
+		resp, err := http.Get(timelineURL + "?" + values.Encode())
+		if err != nil {
+			t.Fatalf("unexpected error %s: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, status)
+		if status != http.StatusOK {
+			return nil
+		}
+		var timeline struct {
+			Repository string                  `json:"repository"`
+			Events     []storage.TimelineEvent `json:"events"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&timeline); err != nil {
+			t.Fatalf("error decoding timeline: %v", err)
+		}
+		if timeline.Repository != imageName.Name() {
+			t.Fatalf("unexpected repository of the timeline: %s", timeline.Repository)
+		}
+		return timeline.Events
+	}
+
+	fetchTimeline("fetching timeline while disabled", nil, http.StatusMethodNotAllowed)
+	env.app.timeline = storage.NewTimeline(env.app.driver, 0)
+
+	first := createRepository(env, t, imageName.Name(), "latest")
+	second := createRepository(env, t, imageName.Name(), "latest")
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+	resp, err := httpDelete(tagURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting tag: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "deleting tag", resp, http.StatusAccepted)
+
+	env.app.freeze, err = freeze.New([]configuration.FreezeWindow{
+		{Repositories: []string{"foo/.*"}, Schedule: "* * * * *", Duration: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error configuring freeze windows: %v", err)
+	}
+	digestRef, _ := reference.WithDigest(imageName, first)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+	resp, err = httpDelete(digestURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "deleting manifest in a freeze window", resp, http.StatusForbidden)
+
+	events := fetchTimeline("fetching timeline", nil, http.StatusOK)
+	expected := []storage.TimelineEvent{
+		{Action: storage.TimelineRejected, Digest: first, Reason: "repository is in a freeze window"},
+		{Action: storage.TimelineDelete, Digest: second, Tag: "latest"},
+		{Action: storage.TimelineTagMove, Digest: second, Tag: "latest", Previous: first},
+		{Action: storage.TimelinePush, Digest: first, Tag: "latest"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	for i, event := range events {
+		if event.Timestamp.IsZero() {
+			t.Errorf("event %d has no timestamp", i)
+		}
+		event.Timestamp = time.Time{}
+		if event != expected[i] {
+			t.Errorf("unexpected event %d: %+v, expected %+v", i, event, expected[i])
+		}
+	}
+
+	events = fetchTimeline("fetching timeline of a tag", url.Values{"tag": []string{"latest"}, "n": []string{"1"}}, http.StatusOK)
+	if len(events) != 1 || events[0].Action != storage.TimelineDelete {
+		t.Fatalf("unexpected events of the tag: %+v", events)
+	}
+
+	fetchTimeline("fetching timeline with an invalid n", url.Values{"n": []string{"-1"}}, http.StatusBadRequest)
+}
+
+func TestUsageExport(t *testing.T) {
+	reports := make(chan usage.Report, 1)
+	usageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report usage.Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("error decoding usage report: %v", err)
+		}
+		reports <- report
+	}))
+	defer usageServer.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Usage.URL = usageServer.URL
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	args := makeBlobArgs(t)
+	uploadURLBase, _ := startPushLayer(t, env, args.imageName)
+	pushLayer(t, env.builder, args.imageName, args.layerDigest, uploadURLBase, args.layerFile)
+	size, err := args.layerFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, _ := reference.WithDigest(args.imageName, args.layerDigest)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob url: %v", err)
+	}
+	resp, err := http.Get(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching layer: %v", err)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	checkResponse(t, "fetching layer", resp, http.StatusOK)
+
+	// Shutting down posts a last report.
+	if err := env.app.Shutdown(); err != nil {
+		t.Fatalf("unexpected error shutting down: %v", err)
+	}
+	report := <-reports
+	if len(report.Namespaces) != 1 {
+		t.Fatalf("expected usage of a single namespace, got %v", report.Namespaces)
+	}
+	// Starting the upload, uploading and fetching the layer.
+	u := report.Namespaces[0]
+	if u.Namespace != "foo" || u.Requests != 3 || u.EgressBytes != size {
+		t.Fatalf("unexpected usage: %+v, expected 3 requests and %d bytes of egress", u, size)
+	}
+}
+
+func TestBlobFetch(t *testing.T) {
+	args := makeBlobArgs(t)
+	layer, err := ioutil.ReadAll(args.layerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(layer)
+	}))
+	defer origin.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Fetch.Hosts = []string{"127.0.0.1"}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	fetchURL, err := env.builder.BuildFetchURL(args.imageName)
+	if err != nil {
+		t.Fatalf("error building fetch url: %v", err)
+	}
+	startFetch := func(blobURL string, dgst digest.Digest) *http.Response {
+		body, err := json.Marshal(map[string]interface{}{"url": blobURL, "digest": dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(fetchURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error starting fetch: %v", err)
+		}
+		return resp
+	}
+	waitFetch := func(resp *http.Response) (*http.Response, fetch.Status) {
+		statusURL := resp.Header.Get("Location")
+		for i := 0; i < 400; i++ {
+			resp, err := http.Get(statusURL)
+			if err != nil {
+				t.Fatalf("unexpected error polling fetch: %v", err)
+			}
+			var status fetch.Status
+			err = json.NewDecoder(resp.Body).Decode(&status)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("error decoding fetch status: %v", err)
+			}
+			checkResponse(t, "polling fetch", resp, http.StatusOK)
+			if status.State != fetch.StateRunning {
+				return resp, status
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("fetch did not finish")
+		return nil, fetch.Status{}
+	}
+
+	// A digest which does not match the content fails the fetch.
+	resp := startFetch(origin.URL+"/layer", digest.FromString("other"))
+	resp.Body.Close()
+	checkResponse(t, "starting fetch", resp, http.StatusAccepted)
+	if _, status := waitFetch(resp); status.State != fetch.StateFailed {
+		t.Fatalf("expected the fetch to fail, got %+v", status)
+	}
+
+	resp = startFetch(origin.URL+"/layer", args.layerDigest)
+	resp.Body.Close()
+	checkResponse(t, "starting fetch", resp, http.StatusAccepted)
+	resp, status := waitFetch(resp)
+	if status.State != fetch.StateComplete || status.BytesFetched != int64(len(layer)) {
+		t.Fatalf("unexpected fetch status: %+v", status)
+	}
+	ref, _ := reference.WithDigest(args.imageName, args.layerDigest)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob url: %v", err)
+	}
+	if resp.Header.Get("Location") != layerURL {
+		t.Fatalf("expected the location of the blob, got %q", resp.Header.Get("Location"))
+	}
+	resp, err = http.Get(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching layer: %v", err)
+	}
+	resp.Body.Close()
+	checkResponse(t, "fetching layer", resp, http.StatusOK)
+
+	// Fetching an existing blob does nothing.
+	resp = startFetch(origin.URL+"/layer", args.layerDigest)
+	resp.Body.Close()
+	checkResponse(t, "starting fetch of an existing blob", resp, http.StatusCreated)
+
+	resp = startFetch("http://example.com/layer", digest.FromString("other"))
+	defer resp.Body.Close()
+	checkResponse(t, "starting fetch from another host", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "starting fetch from another host", resp, errcode.ErrorCodeDenied)
+
+	unknownURL, err := env.builder.BuildFetchStatusURL(args.imageName, uuid.Generate().String())
+	if err != nil {
+		t.Fatalf("error building fetch status url: %v", err)
+	}
+	resp, err = http.Get(unknownURL)
+	if err != nil {
+		t.Fatalf("unexpected error polling fetch: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "polling an unknown fetch", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "polling an unknown fetch", resp, v2.ErrorCodeFetchUnknown)
+}
+
+type testEnv struct {
+	pk      libtrust.PrivateKey
+	ctx     context.Context
+	config  configuration.Configuration
+	app     *App
+	server  *httptest.Server
+	builder *v2.URLBuilder
+}
+
+func newTestEnvMirror(t *testing.T, deleteEnabled bool) *testEnv {
+	upstreamEnv := newTestEnv(t, deleteEnabled)
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": deleteEnabled},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Proxy: configuration.Proxy{
+			RemoteURL: upstreamEnv.server.URL,
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+
+	return newTestEnvWithConfig(t, &config)
+
+}
+
+func newTestEnv(t *testing.T, deleteEnabled bool) *testEnv {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": deleteEnabled},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+
+	return newTestEnvWithConfig(t, &config)
+}
+
+func newTestEnvWithConfig(t *testing.T, config *configuration.Configuration) *testEnv {
+	ctx := context.Background()
+
+	app := NewApp(ctx, config)
+	server := httptest.NewServer(handlers.CombinedLoggingHandler(os.Stderr, app))
+	builder, err := v2.NewURLBuilderFromString(server.URL+config.HTTP.Prefix, false)
+
+	if err != nil {
+		t.Fatalf("error creating url builder: %v", err)
+	}
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+
+	return &testEnv{
+		pk:      pk,
+		ctx:     ctx,
+		config:  *config,
+		app:     app,
+		server:  server,
+		builder: builder,
+	}
+}
+
+func (t *testEnv) Shutdown() {
+	t.server.CloseClientConnections()
+	t.server.Close()
+}
+
+func putManifest(t *testing.T, msg, url, contentType string, v interface{}) *http.Response {
+	var body []byte
+
+	switch m := v.(type) {
+	case *schema1.SignedManifest:
+		_, pl, err := m.Payload()
+		if err != nil {
+			t.Fatalf("error getting payload: %v", err)
+		}
+		body = pl
+	case *manifestlist.DeserializedManifestList:
+		_, pl, err := m.Payload()
+		if err != nil {
+			t.Fatalf("error getting payload: %v", err)
+		}
+		body = pl
+	default:
+		var err error
+		body, err = json.MarshalIndent(v, "", "   ")
+		if err != nil {
+			t.Fatalf("unexpected error marshaling %v: %v", v, err)
+		}
+	}
+
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("error creating request for %s: %v", msg, err)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error doing put request while %s: %v", msg, err)
+	}
+
+	return resp
+}
+
+func startPushLayer(t *testing.T, env *testEnv, name reference.Named) (location string, uuid string) {
+	layerUploadURL, err := env.builder.BuildBlobUploadURL(name)
+	if err != nil {
+		t.Fatalf("unexpected error building layer upload url: %v", err)
+	}
+
+	u, err := url.Parse(layerUploadURL)
+	if err != nil {
+		t.Fatalf("error parsing layer upload URL: %v", err)
+	}
+
+	base, err := url.Parse(env.server.URL)
+	if err != nil {
+		t.Fatalf("error parsing server URL: %v", err)
+	}
+
+	layerUploadURL = base.ResolveReference(u).String()
+	resp, err := http.Post(layerUploadURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error starting layer push: %v", err)
+	}
+
+	defer resp.Body.Close()
 
 	checkResponse(t, fmt.Sprintf("pushing starting layer push %v", name.String()), resp, http.StatusAccepted)
 
@@ -2872,3 +5204,62 @@ func TestProxyManifestGetByTag(t *testing.T) {
 		"Docker-Content-Digest": []string{newDigest.String()},
 	})
 }
+
+func TestTagProtectionAPI(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("release/app")
+	released := createRepository(env, t, imageName.Name(), "v1")
+
+	var err error
+	env.app.tagProtection, err = tagprotection.New([]configuration.TagProtectionRule{
+		{Repositories: []string{"release/.*"}, Tags: []string{"v*"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error configuring tag protection: %v", err)
+	}
+
+	latest := createRepository(env, t, imageName.Name(), "latest")
+	repository, err := env.app.registry.Repository(env.ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	getManifest := func(dgst digest.Digest) distribution.Manifest {
+		manifest, err := manifests.Get(env.ctx, dgst)
+		if err != nil {
+			t.Fatalf("unexpected error getting manifest %s: %v", dgst, err)
+		}
+		return manifest
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "v1")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+
+	resp := putManifest(t, "moving protected tag", tagURL, "", getManifest(latest))
+	defer resp.Body.Close()
+	checkResponse(t, "moving protected tag", resp, http.StatusForbidden)
+	_, _, counts := checkBodyHasErrorCodes(t, "moving protected tag", resp, v2.ErrorCodeTagProtected)
+	if counts[v2.ErrorCodeTagProtected] != 1 {
+		t.Fatalf("unexpected error counts: %v", counts)
+	}
+
+	resp = putManifest(t, "pushing protected tag again", tagURL, "", getManifest(released))
+	defer resp.Body.Close()
+	checkResponse(t, "pushing protected tag again", resp, http.StatusCreated)
+
+	desc, err := repository.Tags(env.ctx).Get(env.ctx, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error getting tag: %v", err)
+	}
+	if desc.Digest != released {
+		t.Fatalf("protected tag moved to %s", desc.Digest)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"expvar"
 	"fmt"
 	"math"
@@ -28,21 +29,36 @@ import (
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/bulkhead"
+	"github.com/distribution/distribution/v3/registry/egress"
+	"github.com/distribution/distribution/v3/registry/fetch"
+	"github.com/distribution/distribution/v3/registry/fips"
+	"github.com/distribution/distribution/v3/registry/freeze"
+	"github.com/distribution/distribution/v3/registry/ipfilter"
+	"github.com/distribution/distribution/v3/registry/loglevel"
 	registrymiddleware "github.com/distribution/distribution/v3/registry/middleware/registry"
 	repositorymiddleware "github.com/distribution/distribution/v3/registry/middleware/repository"
 	"github.com/distribution/distribution/v3/registry/proxy"
+	"github.com/distribution/distribution/v3/registry/quiesce"
+	"github.com/distribution/distribution/v3/registry/shadow"
+	"github.com/distribution/distribution/v3/registry/share"
 	"github.com/distribution/distribution/v3/registry/storage"
 	memorycache "github.com/distribution/distribution/v3/registry/storage/cache/memory"
 	rediscache "github.com/distribution/distribution/v3/registry/storage/cache/redis"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	storagemiddleware "github.com/distribution/distribution/v3/registry/storage/driver/middleware"
+	"github.com/distribution/distribution/v3/registry/tagprotection"
+	"github.com/distribution/distribution/v3/registry/uploadmonitor"
+	"github.com/distribution/distribution/v3/registry/usage"
+	"github.com/distribution/distribution/v3/registry/watchdog"
 	"github.com/distribution/distribution/v3/version"
 	events "github.com/docker/go-events"
 	"github.com/docker/go-metrics"
 	"github.com/docker/libtrust"
 	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
@@ -87,8 +103,85 @@ type App struct {
 	// isCache is true if this registry is configured as a pull through cache
 	isCache bool
 
-	// readOnly is true if the registry is in a read-only maintenance mode
+	// readOnly is true if the registry is in a read-only maintenance mode or
+	// a replica
 	readOnly bool
+
+	// freeze lists the windows during which deletes are refused
+	freeze freeze.Windows
+
+	// warningNotices are attached to the responses of the matching requests
+	warningNotices []warningNotice
+
+	// usage records per-namespace usage, if a usage endpoint is configured
+	usage *usage.Exporter
+
+	// uploadMonitor scans the uploads in progress, if enabled
+	uploadMonitor *uploadmonitor.Monitor
+
+	// egress enforces the egress caps of subjects, if any are configured
+	egress *egress.Meter
+
+	// bulkhead caps the concurrent requests to each repository, if
+	// configured
+	bulkhead *bulkhead.Limiter
+
+	// ipFilter restricts the clients of repositories, if rules are configured
+	ipFilter *ipfilter.Filter
+
+	// tagProtection restricts the clients which may create and move the
+	// matching tags, if rules are configured, resolving their address with
+	// clientIP
+	tagProtection tagprotection.Rules
+	clientIP      func(*http.Request) net.IP
+
+	// watchdog logs the requests running for too long, if configured
+	watchdog *watchdog.Watchdog
+
+	// writes counts the writes to repositories in flight, and holds them
+	// while consistency markers are recorded, if the markers endpoint is
+	// enabled
+	writes *quiesce.Gate
+
+	// shareSigner signs and verifies share links, if they are enabled
+	shareSigner *share.Signer
+
+	// shadow mirrors a sample of read requests to a shadow registry, if
+	// one is configured
+	shadow *shadow.Mirror
+
+	// timeline records the significant events of repositories, if enabled
+	timeline *storage.Timeline
+
+	// fips is true if pushed content must use FIPS approved digests
+	fips bool
+
+	// fetcher runs server side blob fetches, if hosts are allowed
+	fetcher *fetch.Fetcher
+
+	// gcJobs runs the garbage collections started through the admin
+	// endpoint, if it is enabled
+	gcJobs *gcJobs
+
+	// peerHints selects the peers hinted in blob responses, if peers are
+	// configured
+	peerHints *peerHints
+
+	// preheater lists the blobs of images for peer-to-peer distribution
+	// systems, if the preheat endpoint is enabled
+	preheater *preheater
+
+	// notary forwards content trust requests to the Notary server, if one
+	// is configured
+	notary *notaryProxy
+
+	// referrerSummaries caches the referrer headers of manifest responses,
+	// if they are enabled
+	referrerSummaries *referrerSummaryCache
+
+	// helmIndexes caches the charts listed in the Helm indexes of
+	// repositories
+	helmIndexes *helmIndexCache
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
@@ -109,17 +202,47 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	app.register(v2.RouteNameManifest, manifestDispatcher)
 	app.register(v2.RouteNameCatalog, catalogDispatcher)
 	app.register(v2.RouteNameReferrers, referrersDispatcher)
+	app.register(v2.RouteNameGlobalReferrers, globalReferrersDispatcher)
+	app.register(v2.RouteNameIndex, indexDispatcher)
+	app.register(v2.RouteNameIndexUpdate, indexUpdateDispatcher)
+	app.register(v2.RouteNameAnnotations, annotationsDispatcher)
+	app.register(v2.RouteNameShare, shareDispatcher)
+	app.register(v2.RouteNameGraph, graphDispatcher)
+	app.register(v2.RouteNameImpact, impactDispatcher)
+	app.register(v2.RouteNameTimeline, timelineDispatcher)
+	app.register(v2.RouteNameBundle, bundleDispatcher)
+	app.register(v2.RouteNameHelmIndex, helmDispatcher)
+	app.register(v2.RouteNameHelmChart, helmDispatcher)
+	app.register(v2.RouteNameFetch, fetchDispatcher)
+	app.register(v2.RouteNameFetchStatus, fetchDispatcher)
+	app.register(v2.RouteNameAdminGC, adminGCDispatcher)
+	app.register(v2.RouteNameAdminGCStatus, adminGCDispatcher)
+	app.register(v2.RouteNameAdminPreheat, preheatDispatcher)
+	app.register(v2.RouteNameAdminConfig, adminConfigDispatcher)
+	app.register(v2.RouteNameAdminLog, adminLogDispatcher)
+	app.register(v2.RouteNameAdminMarkers, adminMarkersDispatcher)
+	app.register(v2.RouteNameTrust, trustDispatcher)
 	app.register(v2.RouteNameTags, tagsDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
 
+	errcode.SetDocumentationBase(config.HTTP.ErrorDocs)
+
 	// override the storage driver's UA string for registry outbound HTTP requests
 	storageParams := config.Storage.Parameters()
 	if storageParams == nil {
 		storageParams = make(configuration.Parameters)
 	}
 	storageParams["useragent"] = fmt.Sprintf("docker-distribution/%s %s", version.Version, runtime.Version())
+	if config.Replica.Enabled {
+		if app.isCache {
+			panic("a pull through cache cannot be a replica")
+		}
+		for k, v := range config.Replica.Storage {
+			storageParams[k] = v
+		}
+	}
 
 	var err error
 	app.driver, err = factory.Create(config.Storage.Type(), storageParams)
@@ -151,14 +274,101 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 			}
 		}
 	}
+	// Replicas leave writing to the storage to the primary registry.
+	if config.Replica.Enabled {
+		app.readOnly = true
+	}
+
+	app.freeze, err = freeze.New(config.Policy.Freeze)
+	if err != nil {
+		panic(err)
+	}
+
+	app.warningNotices, err = newWarningNotices(config.Policy.Warnings.Notices)
+	if err != nil {
+		panic(err)
+	}
+
+	ipFilter, err := ipfilter.New(config.Policy.Network)
+	if err != nil {
+		panic(err)
+	}
+	if !ipFilter.Empty() {
+		app.ipFilter = ipFilter
+	}
+	app.clientIP = ipFilter.ClientIP
+
+	if len(config.Policy.TagProtection) > 0 {
+		app.tagProtection, err = tagprotection.New(config.Policy.TagProtection)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	app.fips = fips.Enabled(config)
+
+	if len(config.Fetch.Hosts) > 0 {
+		app.fetcher = fetch.New(config.Fetch)
+	}
+
+	if len(config.Peers.URLs) > 0 {
+		app.peerHints, err = newPeerHints(config.Peers)
+		if err != nil {
+			panic(err)
+		}
+	}
 
-	startUploadPurger(app, app.driver, dcontext.GetLogger(app), purgeConfig)
+	if config.Notary.URL != "" {
+		app.notary, err = newNotaryProxy(config.Notary)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	app.helmIndexes = newHelmIndexCache()
+
+	if config.Referrers.Headers {
+		app.referrerSummaries = newReferrerSummaryCache(config.Referrers.CacheTTL)
+	}
+
+	if egressConfig := config.Policy.Egress; egressConfig.Daily > 0 || egressConfig.Monthly > 0 || len(egressConfig.Subjects) > 0 {
+		app.egress = egress.New(egressConfig)
+	}
+
+	if bulkheadConfig := config.Policy.Bulkhead; bulkheadConfig.Reads > 0 || bulkheadConfig.Writes > 0 {
+		// Client addresses are resolved through the trusted proxies of
+		// the network rules.
+		app.bulkhead, err = bulkhead.New(bulkheadConfig, ipFilter.ClientIP)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if config.Shadow.URL != "" {
+		app.shadow, err = shadow.New(config.Shadow)
+		if err != nil {
+			panic(err)
+		}
+		dcontext.GetLogger(app).Infof("mirroring read requests to %s", config.Shadow.URL)
+	}
+
+	if threshold := config.HTTP.Debug.Watchdog.Threshold; threshold > 0 {
+		app.watchdog = watchdog.New(threshold)
+	}
+
+	if !config.Replica.Enabled {
+		startUploadPurger(app, app.driver, dcontext.GetLogger(app), purgeConfig)
+	}
 
 	app.driver, err = applyStorageMiddleware(app.driver, config.Middleware["storage"])
 	if err != nil {
 		panic(err)
 	}
 
+	if config.Timeline.Enabled {
+		app.timeline = storage.NewTimeline(app.driver, config.Timeline.MaxEvents)
+	}
+
 	app.configureSecret(config)
 	app.configureEvents(config)
 	app.configureRedis(config)
@@ -207,6 +417,20 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
+	// configure the reference index of incremental garbage collections
+	if r, ok := config.Storage["referenceindex"]; ok {
+		if enabled, ok := r["enabled"].(bool); ok && enabled {
+			options = append(options, storage.EnableReferenceIndex)
+		}
+	}
+
+	// configure the implementation digesting uploaded blobs
+	if h, ok := config.Storage["hashing"]; ok {
+		if implementation, ok := h["implementation"].(string); ok && implementation != "" {
+			options = append(options, storage.HashImplementation(implementation))
+		}
+	}
+
 	// configure redirects
 	var redirectDisabled bool
 	if redirectConfig, ok := config.Storage["redirect"]; ok {
@@ -259,6 +483,32 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				options = append(options, storage.ManifestURLsDenyRegexp(re))
 			}
 		}
+		if artifacts := config.Validation.Manifests.Artifacts; len(artifacts.Allow) > 0 || len(artifacts.Deny) > 0 {
+			options = append(options, storage.ManifestArtifactClasses(artifacts.Allow, artifacts.Deny))
+		}
+	}
+
+	if config.Referrers.LinkCacheTTL > 0 {
+		options = append(options, storage.ReferrerLinkCache(config.Referrers.LinkCacheTTL))
+	}
+	if config.Referrers.Index {
+		options = append(options, storage.ReferrersIndex(app.readOnly))
+	}
+	if config.Referrers.TagSchema {
+		options = append(options, storage.EnableReferrersTagSchema)
+	}
+	if config.Referrers.Global {
+		options = append(options, storage.EnableGlobalReferrersIndex)
+	}
+	switch config.Referrers.Layout {
+	case "", "v1":
+	case "v2":
+		options = append(options, storage.PartitionReferrerLinks)
+	default:
+		panic(fmt.Sprintf("unknown referrers layout %q, expected v1 or v2", config.Referrers.Layout))
+	}
+	if config.Referrers.MaxPerSubject > 0 {
+		options = append(options, storage.MaxReferrersPerSubject(config.Referrers.MaxPerSubject))
 	}
 
 	// configure storage caches
@@ -307,6 +557,25 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				dcontext.GetLogger(app).Warnf("unknown cache type %q, caching disabled", config.Storage["cache"])
 			}
 		}
+
+		// warm the cache in the background for the most recently tagged
+		// repositories
+		if w, ok := cc["warmrepositories"]; ok && app.registry != nil {
+			repositories, err := strconv.Atoi(fmt.Sprint(w))
+			if err != nil {
+				panic(fmt.Sprintf("invalid warmrepositories value %s: %s", w, err))
+			}
+			registry := app.registry
+			go func() {
+				start := time.Now()
+				warmed, err := storage.WarmBlobDescriptorCache(app, app.driver, registry, repositories)
+				if err != nil {
+					dcontext.GetLogger(app).Errorf("failed to warm the blob descriptor cache: %v", err)
+					return
+				}
+				dcontext.GetLogger(app).Infof("warmed the blob descriptor cache with %d descriptors in %s", warmed, time.Since(start))
+			}()
+		}
 	}
 
 	if app.registry == nil {
@@ -333,6 +602,42 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		dcontext.GetLogger(app).Debugf("configured %q access controller", authType)
 	}
 
+	if config.Admin.GC.Enabled {
+		if app.accessController == nil {
+			panic("the garbage collection admin endpoint requires an access controller")
+		}
+		if config.Replica.Enabled || config.Proxy.RemoteURL != "" {
+			panic("the garbage collection admin endpoint is not supported by replicas and proxy caches")
+		}
+		app.gcJobs = newGCJobs()
+	}
+
+	if config.Admin.Preheat.Enabled {
+		if app.accessController == nil {
+			panic("the preheat admin endpoint requires an access controller")
+		}
+		app.preheater = newPreheater(config.Admin.Preheat, !redirectDisabled)
+	}
+
+	if config.Admin.Config.Enabled && app.accessController == nil {
+		panic("the configuration admin endpoint requires an access controller")
+	}
+
+	if config.Admin.Log.Enabled && app.accessController == nil {
+		panic("the log admin endpoint requires an access controller")
+	}
+
+	if config.Admin.Markers.Enabled {
+		if app.accessController == nil {
+			panic("the markers admin endpoint requires an access controller")
+		}
+		app.writes = &quiesce.Gate{}
+	}
+
+	if config.Share.Enabled {
+		app.shareSigner = share.NewSigner(config.HTTP.Secret)
+	}
+
 	// configure as a pull through cache
 	if config.Proxy.RemoteURL != "" {
 		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy)
@@ -348,6 +653,22 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		dcontext.GetLogger(app).Warnf("Registry does not implement RepositoryRemover. Will not be able to delete repos and tags")
 	}
 
+	if config.Usage.URL != "" {
+		// Storage usage is read from the local storage, below any proxy.
+		registry, err := storage.NewRegistry(app, app.driver)
+		if err != nil {
+			panic("could not create registry: " + err.Error())
+		}
+		app.usage = usage.NewExporter(registry, config.Usage)
+		app.usage.Start(app)
+		dcontext.GetLogger(app).Infof("exporting usage to %s", config.Usage.URL)
+	}
+
+	if config.UploadMonitor.Enabled {
+		app.uploadMonitor = uploadmonitor.New(app.driver, config.UploadMonitor)
+		app.uploadMonitor.Start(app)
+	}
+
 	return app
 }
 
@@ -358,13 +679,29 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 // process. Because the configuration and app are tightly coupled,
 // implementing this properly will require a refactor. This method may panic
 // if called twice in the same process.
+//
+// Checks configured for liveness are also registered with the second
+// registry. If no registries are given, health.DefaultRegistry and
+// health.LivenessRegistry are used.
 func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
-	if len(healthRegistries) > 1 {
-		panic("RegisterHealthChecks called with more than one registry")
+	if len(healthRegistries) > 2 {
+		panic("RegisterHealthChecks called with more than two registries")
 	}
 	healthRegistry := health.DefaultRegistry
-	if len(healthRegistries) == 1 {
+	livenessRegistry := health.LivenessRegistry
+	if len(healthRegistries) > 0 {
 		healthRegistry = healthRegistries[0]
+		livenessRegistry = nil
+	}
+	if len(healthRegistries) == 2 {
+		livenessRegistry = healthRegistries[1]
+	}
+
+	register := func(name string, checker health.Checker, liveness bool) {
+		healthRegistry.Register(name, checker)
+		if liveness && livenessRegistry != nil {
+			livenessRegistry.Register(name, checker)
+		}
 	}
 
 	if app.Config.Health.StorageDriver.Enabled {
@@ -373,19 +710,21 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 			interval = defaultCheckInterval
 		}
 
-		storageDriverCheck := func() error {
+		storageDriverCheck := health.CheckFunc(func() error {
 			_, err := app.driver.Stat(app, "/") // "/" should always exist
-			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			if errors.Is(err, storagedriver.ErrNotFound) {
 				err = nil // pass this through, backend is responding, but this path doesn't exist.
 			}
 			return err
-		}
+		})
 
+		var checker health.Checker
 		if app.Config.Health.StorageDriver.Threshold != 0 {
-			healthRegistry.RegisterPeriodicThresholdFunc("storagedriver_"+app.Config.Storage.Type(), interval, app.Config.Health.StorageDriver.Threshold, storageDriverCheck)
+			checker = health.PeriodicThresholdChecker(storageDriverCheck, interval, app.Config.Health.StorageDriver.Threshold)
 		} else {
-			healthRegistry.RegisterPeriodicFunc("storagedriver_"+app.Config.Storage.Type(), interval, storageDriverCheck)
+			checker = health.PeriodicChecker(storageDriverCheck, interval)
 		}
+		register("storagedriver_"+app.Config.Storage.Type(), checker, app.Config.Health.StorageDriver.Liveness)
 	}
 
 	for _, fileChecker := range app.Config.Health.FileCheckers {
@@ -394,7 +733,7 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 			interval = defaultCheckInterval
 		}
 		dcontext.GetLogger(app).Infof("configuring file health check path=%s, interval=%d", fileChecker.File, interval/time.Second)
-		healthRegistry.Register(fileChecker.File, health.PeriodicChecker(checks.FileChecker(fileChecker.File), interval))
+		register(fileChecker.File, health.PeriodicChecker(checks.FileChecker(fileChecker.File), interval), fileChecker.Liveness)
 	}
 
 	for _, httpChecker := range app.Config.Health.HTTPCheckers {
@@ -412,10 +751,10 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 
 		if httpChecker.Threshold != 0 {
 			dcontext.GetLogger(app).Infof("configuring HTTP health check uri=%s, interval=%d, threshold=%d", httpChecker.URI, interval/time.Second, httpChecker.Threshold)
-			healthRegistry.Register(httpChecker.URI, health.PeriodicThresholdChecker(checker, interval, httpChecker.Threshold))
+			register(httpChecker.URI, health.PeriodicThresholdChecker(checker, interval, httpChecker.Threshold), httpChecker.Liveness)
 		} else {
 			dcontext.GetLogger(app).Infof("configuring HTTP health check uri=%s, interval=%d", httpChecker.URI, interval/time.Second)
-			healthRegistry.Register(httpChecker.URI, health.PeriodicChecker(checker, interval))
+			register(httpChecker.URI, health.PeriodicChecker(checker, interval), httpChecker.Liveness)
 		}
 	}
 
@@ -429,12 +768,89 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 
 		if tcpChecker.Threshold != 0 {
 			dcontext.GetLogger(app).Infof("configuring TCP health check addr=%s, interval=%d, threshold=%d", tcpChecker.Addr, interval/time.Second, tcpChecker.Threshold)
-			healthRegistry.Register(tcpChecker.Addr, health.PeriodicThresholdChecker(checker, interval, tcpChecker.Threshold))
+			register(tcpChecker.Addr, health.PeriodicThresholdChecker(checker, interval, tcpChecker.Threshold), tcpChecker.Liveness)
 		} else {
 			dcontext.GetLogger(app).Infof("configuring TCP health check addr=%s, interval=%d", tcpChecker.Addr, interval/time.Second)
-			healthRegistry.Register(tcpChecker.Addr, health.PeriodicChecker(checker, interval))
+			register(tcpChecker.Addr, health.PeriodicChecker(checker, interval), tcpChecker.Liveness)
+		}
+	}
+
+	if app.Config.Health.Extensions.Enabled {
+		interval := app.Config.Health.Extensions.Interval
+		if interval == 0 {
+			interval = defaultCheckInterval
+		}
+
+		for name, extension := range app.extensionHealthCheckers() {
+			extension := extension
+			checker := health.CheckFunc(func() error {
+				ctx, cancel := context.WithTimeout(app, interval)
+				defer cancel()
+				return extension.Health(ctx)
+			})
+
+			// Extensions only fail the readiness of the instance: restarting
+			// it would not repair their dependencies.
+			if app.Config.Health.Extensions.Threshold != 0 {
+				dcontext.GetLogger(app).Infof("configuring %s extension health check, interval=%d, threshold=%d", name, interval/time.Second, app.Config.Health.Extensions.Threshold)
+				register("extension_"+name, health.PeriodicThresholdChecker(checker, interval, app.Config.Health.Extensions.Threshold), false)
+			} else {
+				dcontext.GetLogger(app).Infof("configuring %s extension health check, interval=%d", name, interval/time.Second)
+				register("extension_"+name, health.PeriodicChecker(checker, interval), false)
+			}
+		}
+	}
+}
+
+// extensionHealthChecker is implemented by the extensions which can tell
+// whether they are able to serve requests, such as those depending on a
+// service or a storage path of their own.
+type extensionHealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// extensionHealthCheckers returns the enabled extensions which check their
+// health, by name.
+func (app *App) extensionHealthCheckers() map[string]extensionHealthChecker {
+	checkers := make(map[string]extensionHealthChecker)
+	if app.notary != nil {
+		checkers["notary"] = app.notary
+	}
+	if app.Config.Referrers.Global {
+		checkers["referrers"] = globalReferrersHealth{namespace: app.registry}
+	}
+	return checkers
+}
+
+// Driver returns the storage driver backing the application, including any
+// configured storage middleware.
+func (app *App) Driver() storagedriver.StorageDriver {
+	return app.driver
+}
+
+// Shutdown releases the resources held by the application: pending
+// notifications are flushed to their endpoints, a last usage report is
+// posted, the upload monitor is stopped and the redis pool, if any, is
+// closed. The application must not serve requests afterwards.
+func (app *App) Shutdown() error {
+	var err error
+	if app.uploadMonitor != nil {
+		app.uploadMonitor.Close()
+	}
+	if app.events.sink != nil {
+		err = app.events.sink.Close()
+	}
+	if app.usage != nil {
+		if uerr := app.usage.Close(app); uerr != nil && err == nil {
+			err = uerr
+		}
+	}
+	if app.redis != nil {
+		if rerr := app.redis.Close(); rerr != nil && err == nil {
+			err = rerr
 		}
 	}
+	return err
 }
 
 // register a handler with the application, by route name. The handler will be
@@ -478,6 +894,7 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 			Headers:           endpoint.Headers,
 			IgnoredMediaTypes: endpoint.IgnoredMediaTypes,
 			Ignore:            endpoint.Ignore,
+			Preheat:           endpoint.Preheat,
 		})
 
 		sinks = append(sinks, endpoint)
@@ -655,7 +1072,15 @@ func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Set a header with the Docker Distribution API Version for all responses.
 	w.Header().Add("Docker-Distribution-API-Version", "registry/2.0")
+	if app.readOnly {
+		w.Header().Add("Docker-Distribution-Read-Only", "true")
+	}
 	app.router.ServeHTTP(w, r)
+
+	if app.shadow != nil {
+		status, _ := ctx.Value("http.response.status").(int)
+		app.shadow.Observe(ctx, r, status, w.Header().Get("Docker-Content-Digest"))
+	}
 }
 
 // dispatchFunc takes a context and request and returns a constructed handler
@@ -679,7 +1104,39 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 
 		context := app.context(w, r)
 
-		if err := app.authorized(w, r, context); err != nil {
+		if app.watchdog != nil {
+			var served func()
+			context.Context, served = app.watchdog.Watch(context.Context, watchedRequest(context, r))
+			defer served()
+		}
+
+		// Network rules apply before authentication, so that credentials
+		// are of no use from a refused network.
+		if app.ipFilter != nil && app.nameRequired(r) {
+			if ip := app.ipFilter.ClientIP(r); !app.ipFilter.Allowed(getName(context), ip) {
+				dcontext.GetLogger(context).Warnf("refusing access to %s from %v", getName(context), ip)
+				context.Errors = append(context.Errors, errcode.ErrorCodeDenied.WithDetail("access from this network is not allowed"))
+				if err := errcode.ServeJSON(w, context.Errors); err != nil {
+					dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+				}
+				return
+			}
+		}
+
+		// Share links authorize the pulls of the content they share in
+		// place of credentials.
+		link, err := app.shareLink(context, r)
+		if err != nil {
+			dcontext.GetLogger(context).Warnf("refusing share link: %v", err)
+			context.Errors = append(context.Errors, errcode.ErrorCodeDenied.WithDetail(err.Error()))
+			if err := errcode.ServeJSON(w, context.Errors); err != nil {
+				dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+			}
+			return
+		}
+		if link != nil {
+			dcontext.GetLogger(context).Infof("authorized request with share link %s", link.ID)
+		} else if err := app.authorized(w, r, context); err != nil {
 			dcontext.GetLogger(context).Warnf("error authorizing context: %v", err)
 			return
 		}
@@ -703,6 +1160,16 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 				}
 				return
 			}
+
+			if r.Method == http.MethodDelete && app.freeze.Frozen(nameRef.Name(), time.Now()) {
+				context.Errors = append(context.Errors, errcode.ErrorCodeDenied.WithDetail("repository is in a freeze window"))
+				app.recordTimeline(context, r, "", "")
+				if err := errcode.ServeJSON(w, context.Errors); err != nil {
+					dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+				}
+				return
+			}
+
 			repository, err := app.registry.Repository(context, nameRef)
 
 			if err != nil {
@@ -724,10 +1191,15 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 			}
 
 			// assign and decorate the authorized repository with an event bridge.
+			bridge := app.eventBridge(context, r)
 			context.Repository, context.RepositoryRemover = notifications.Listen(
 				repository,
 				context.App.repoRemover,
-				app.eventBridge(context, r))
+				bridge)
+
+			if app.tagProtection != nil {
+				context.Repository = app.tagProtection.Repository(context.Repository, app.clientIP(r), auditTagProtected(nameRef, bridge))
+			}
 
 			context.Repository, err = applyRepoMiddleware(app, context.Repository, app.Config.Middleware["repository"])
 			if err != nil {
@@ -739,9 +1211,60 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 				}
 				return
 			}
+
+			if link != nil {
+				if err := app.checkShared(context, r, link); err != nil {
+					dcontext.GetLogger(context).Warnf("refusing share link %s: %v", link.ID, err)
+					context.Errors = append(context.Errors, errcode.ErrorCodeDenied.WithDetail(err.Error()))
+					if err := errcode.ServeJSON(w, context.Errors); err != nil {
+						dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+					}
+					return
+				}
+			}
+
+			if app.egress != nil && isBlobDownload(r) {
+				if err := app.egress.Allow(dcontext.GetStringValue(context, auth.UserNameKey), time.Now()); err != nil {
+					app.serveEgressCapped(context, w, err)
+					return
+				}
+			}
+
+			if app.writes != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				exit, err := app.writes.Enter(context)
+				if err != nil {
+					dcontext.GetLogger(context).Warnf("write held for a consistency marker abandoned: %v", err)
+					return
+				}
+				defer exit()
+			}
+
+			if app.bulkhead != nil {
+				write := r.Method != http.MethodGet && r.Method != http.MethodHead
+				priority := app.bulkhead.Priority(r, dcontext.GetStringValue(context, auth.UserNameKey))
+				release, err := app.bulkhead.Acquire(context, getName(context), write, priority)
+				if err != nil {
+					app.serveSaturated(context, w, err)
+					return
+				}
+				defer release()
+			}
+
+			for _, notice := range app.warningNotices {
+				if notice.applies(nameRef.Name(), r.Method) {
+					context.warn(notice.message)
+				}
+			}
 		}
 
-		dispatch(context, r).ServeHTTP(w, r)
+		// The tag a manifest is pushed to is looked up beforehand, so that
+		// the timeline records whether the push moved it.
+		var previous digest.Digest
+		if app.timeline != nil {
+			previous = app.taggedManifest(context, r)
+		}
+
+		dispatch(context, r).ServeHTTP(&warningResponseWriter{ResponseWriter: w, ctx: context}, r)
 		// Automated error response handling here. Handlers may return their
 		// own errors if they need different behavior (such as range errors
 		// for layer upload).
@@ -752,9 +1275,93 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 
 			app.logError(context, context.Errors)
 		}
+
+		app.recordTimeline(context, r, w.Header().Get("Docker-Content-Digest"), previous)
+
+		// Any write may push, tag or delete a chart.
+		if context.Repository != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			app.helmIndexes.invalidate(context.Repository.Named().Name())
+		}
+
+		if app.usage != nil && app.nameRequired(r) {
+			app.recordUsage(context, r)
+		}
+		if app.egress != nil && isBlobDownload(r) {
+			written, _ := context.Value("http.response.written").(int64)
+			app.egress.Add(dcontext.GetStringValue(context, auth.UserNameKey), written, time.Now())
+		}
 	})
 }
 
+// watchedRequest describes a request to the watchdog.
+func watchedRequest(ctx *Context, r *http.Request) *watchdog.Request {
+	req := &watchdog.Request{
+		Repository: getName(ctx),
+		Digest:     dcontext.GetStringValue(ctx, "vars.digest"),
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		req.Route = route.GetName()
+	}
+	if req.Digest == "" {
+		req.Digest = getReference(ctx)
+	}
+	return req
+}
+
+// isBlobDownload returns true if the request fetches the content of blobs:
+// a blob, the bundle of an image or a Helm chart.
+func isBlobDownload(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil || r.Method != http.MethodGet {
+		return false
+	}
+	switch route.GetName() {
+	case v2.RouteNameBlob, v2.RouteNameBundle, v2.RouteNameHelmChart:
+		return true
+	}
+	return false
+}
+
+// recordUsage accounts for a repository request in the usage reports. The
+// bytes written in response to blob downloads count as egress.
+func (app *App) recordUsage(ctx *Context, r *http.Request) {
+	var egressBytes int64
+	if isBlobDownload(r) {
+		egressBytes, _ = ctx.Value("http.response.written").(int64)
+	}
+	app.usage.Record(getName(ctx), egressBytes)
+}
+
+// serveEgressCapped refuses a blob download to a subject which reached its
+// egress cap: with 429 Too Many Requests for the daily cap and 403
+// Forbidden for the monthly cap.
+func (app *App) serveEgressCapped(ctx *Context, w http.ResponseWriter, err error) {
+	now := time.Now()
+	retryAfter := egress.Reset(err, now).Sub(now).Round(time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+
+	if err == egress.ErrMonthlyCap {
+		ctx.Errors = append(ctx.Errors, errcode.ErrorCodeDenied.WithDetail(err.Error()))
+	} else {
+		ctx.Errors = append(ctx.Errors, errcode.ErrorCodeTooManyRequests.WithDetail(err.Error()))
+	}
+	if err := errcode.ServeJSON(w, ctx.Errors); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error serving error json: %v (from %v)", err, ctx.Errors)
+	}
+}
+
+// serveSaturated refuses a request to a repository whose pool of
+// concurrent requests is full with 429 Too Many Requests.
+func (app *App) serveSaturated(ctx *Context, w http.ResponseWriter, err error) {
+	if err == bulkhead.ErrSaturated {
+		w.Header().Set("Retry-After", "1")
+	}
+	ctx.Errors = append(ctx.Errors, errcode.ErrorCodeTooManyRequests.WithDetail(err.Error()))
+	if err := errcode.ServeJSON(w, ctx.Errors); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error serving error json: %v (from %v)", err, ctx.Errors)
+	}
+}
+
 type errCodeKey struct{}
 
 func (errCodeKey) String() string { return "err.code" }
@@ -857,11 +1464,14 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 		}
 		accessRecords = appendCatalogAccessRecord(accessRecords, r)
 	}
+	accessRecords = appendAdminAccessRecord(accessRecords, r)
+	loglevel.Logger(context, loglevel.Auth).Debugf("checking access %v", accessRecords)
 
 	ctx, err := app.accessController.Authorized(context.Context, accessRecords...)
 	if err != nil {
 		switch err := err.(type) {
 		case auth.Challenge:
+			loglevel.Logger(context, loglevel.Auth).Debugf("challenging request: %v", err)
 			// Add the appropriate WWW-Auth header
 			err.SetHeaders(r, w)
 
@@ -906,7 +1516,11 @@ func (app *App) nameRequired(r *http.Request) bool {
 		return true
 	}
 	routeName := route.GetName()
-	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog
+	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog &&
+		routeName != v2.RouteNameAdminGC && routeName != v2.RouteNameAdminGCStatus &&
+		routeName != v2.RouteNameAdminConfig && routeName != v2.RouteNameAdminLog &&
+		routeName != v2.RouteNameAdminMarkers &&
+		routeName != v2.RouteNameGlobalReferrers
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -974,6 +1588,37 @@ func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []a
 	return accessRecords
 }
 
+// Add the access record for the administration endpoints if the route
+// accesses them.
+func appendAdminAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
+	route := mux.CurrentRoute(r)
+	routeName := route.GetName()
+
+	var name string
+	switch routeName {
+	case v2.RouteNameAdminGC, v2.RouteNameAdminGCStatus:
+		name = "gc"
+	case v2.RouteNameAdminPreheat:
+		name = "preheat"
+	case v2.RouteNameAdminConfig:
+		name = "config"
+	case v2.RouteNameAdminLog:
+		name = "log"
+	case v2.RouteNameAdminMarkers:
+		name = "markers"
+	default:
+		return accessRecords
+	}
+	return append(accessRecords,
+		auth.Access{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: name,
+			},
+			Action: "*",
+		})
+}
+
 // applyRegistryMiddleware wraps a registry instance with the configured middlewares
 func applyRegistryMiddleware(ctx context.Context, registry distribution.Namespace, middlewares []configuration.Middleware) (distribution.Namespace, error) {
 	for _, mw := range middlewares {
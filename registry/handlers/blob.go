@@ -5,6 +5,7 @@ import (
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/gorilla/handlers"
@@ -66,6 +67,16 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if bh.App.peerHints != nil {
+		ref, err := reference.WithDigest(bh.Repository.Named(), desc.Digest)
+		if err == nil {
+			err = bh.App.peerHints.setHeaders(w.Header(), ref, desc.Size)
+		}
+		if err != nil {
+			context.GetLogger(bh).Errorf("error hinting the peers of %s: %v", desc.Digest, err)
+		}
+	}
+
 	if err := blobs.ServeBlob(bh, w, r, desc.Digest); err != nil {
 		context.GetLogger(bh).Debugf("unexpected error getting blob HTTP handler: %v", err)
 		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
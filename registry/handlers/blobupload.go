@@ -11,6 +11,7 @@ import (
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/fips"
 	"github.com/distribution/distribution/v3/registry/storage"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
@@ -197,6 +198,13 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 		return
 	}
 
+	if buh.App.fips {
+		if err := fips.ApprovedDigest(dgst); err != nil {
+			buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err.Error()))
+			return
+		}
+	}
+
 	if err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PUT"); err != nil {
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
 		return
@@ -363,6 +371,11 @@ func (buh *blobUploadHandler) createBlobMountOption(fromRepo, mountDigest string
 	if err != nil {
 		return nil, err
 	}
+	if buh.App.fips {
+		if err := fips.ApprovedDigest(dgst); err != nil {
+			return nil, err
+		}
+	}
 
 	ref, err := reference.WithName(fromRepo)
 	if err != nil {
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// mediaTypeTar is the media type of bundles.
+const mediaTypeTar = "application/x-tar"
+
+// bundleDispatcher constructs the handler used to download a manifest and
+// its blobs in a single request.
+func bundleDispatcher(ctx *Context, r *http.Request) http.Handler {
+	bundleHandler := &bundleHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		bundleHandler.Tag = reference
+	} else {
+		bundleHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(bundleHandler.GetBundle),
+		"HEAD": http.HandlerFunc(bundleHandler.GetBundle),
+	}
+}
+
+// bundleHandler handles requests for bundles.
+type bundleHandler struct {
+	*Context
+
+	// One of tag or digest identifies the manifest.
+	Tag    string
+	Digest digest.Digest
+}
+
+// GetBundle streams a manifest and the blobs it references as a tar archive
+// in the OCI image layout, whose index.json describes the manifest.
+func (bh *bundleHandler) GetBundle(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(bh).Debug("GetBundle")
+
+	manifests, err := bh.Repository.Manifests(bh)
+	if err != nil {
+		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if bh.Tag != "" {
+		desc, err := bh.Repository.Tags(bh).Get(bh, bh.Tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				bh.Errors = append(bh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		bh.Digest = desc.Digest
+	}
+
+	manifest, err := manifests.Get(bh, bh.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			bh.Errors = append(bh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else {
+			bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	if _, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		bh.Errors = append(bh.Errors, v2.ErrorCodeManifestInvalid.WithDetail("bundles of image indexes are not supported"))
+		return
+	}
+
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	// Check every blob before the response is committed.
+	blobs := bh.Repository.Blobs(bh)
+	var descriptors []distribution.Descriptor
+	seen := make(map[digest.Digest]struct{})
+	for _, desc := range manifest.References() {
+		if _, ok := seen[desc.Digest]; ok {
+			continue
+		}
+		seen[desc.Digest] = struct{}{}
+		stat, err := blobs.Stat(bh, desc.Digest)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				bh.Errors = append(bh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(desc.Digest))
+			} else {
+				bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		descriptors = append(descriptors, stat)
+	}
+
+	layout, err := json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	target := v1.Descriptor{
+		MediaType: mediaType,
+		Digest:    bh.Digest,
+		Size:      int64(len(payload)),
+	}
+	if bh.Tag != "" {
+		target.Annotations = map[string]string{v1.AnnotationRefName: bh.Tag}
+	}
+	index, err := json.Marshal(v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: []v1.Descriptor{target},
+	})
+	if err != nil {
+		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeTar)
+	w.Header().Set("Docker-Content-Digest", bh.Digest.String())
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// Errors past this point can only abort the response.
+	tw := tar.NewWriter(w)
+	if err := writeBundleFile(tw, v1.ImageLayoutFile, layout); err != nil {
+		dcontext.GetLogger(bh).Errorf("error writing bundle: %v", err)
+		return
+	}
+	if err := writeBundleFile(tw, "index.json", index); err != nil {
+		dcontext.GetLogger(bh).Errorf("error writing bundle: %v", err)
+		return
+	}
+	if err := writeBundleFile(tw, bundleBlobPath(bh.Digest), payload); err != nil {
+		dcontext.GetLogger(bh).Errorf("error writing bundle: %v", err)
+		return
+	}
+	for _, desc := range descriptors {
+		if err := bh.writeBundleBlob(tw, blobs, desc); err != nil {
+			dcontext.GetLogger(bh).Errorf("error writing blob %s to bundle: %v", desc.Digest, err)
+			return
+		}
+	}
+	if err := tw.Close(); err != nil {
+		dcontext.GetLogger(bh).Errorf("error writing bundle: %v", err)
+	}
+}
+
+func (bh *bundleHandler) writeBundleBlob(tw *tar.Writer, blobs distribution.BlobStore, desc distribution.Descriptor) error {
+	rc, err := blobs.Open(bh, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := tw.WriteHeader(bundleHeader(bundleBlobPath(desc.Digest), desc.Size)); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, rc, desc.Size)
+	return err
+}
+
+func writeBundleFile(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(bundleHeader(name, int64(len(content)))); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+func bundleHeader(name string, size int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+	}
+}
+
+// bundleBlobPath returns the path of a blob in the OCI image layout.
+func bundleBlobPath(dgst digest.Digest) string {
+	return path.Join("blobs", dgst.Algorithm().String(), dgst.Hex())
+}
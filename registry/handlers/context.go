@@ -33,6 +33,16 @@ type Context struct {
 	// handler *must not* start the response via http.ResponseWriter.
 	Errors errcode.Errors
 
+	// warnings are attached to the response as Warning headers, should the
+	// request succeed.
+	warnings []string
+
+	// storedTag is the tag a manifest built by the registry is pushed to,
+	// and storedPrevious the manifest it pointed at before, for the
+	// timeline.
+	storedTag      string
+	storedPrevious digest.Digest
+
 	urlBuilder *v2.URLBuilder
 
 	// TODO(stevvooe): The goal is too completely factor this context and
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/fetch"
+	"github.com/distribution/distribution/v3/registry/fips"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// maxFetchRequestSize bounds the body of fetch requests.
+const maxFetchRequestSize = 64 << 10
+
+// fetchRequest is the body of a request starting a blob fetch.
+type fetchRequest struct {
+	URL    string        `json:"url"`
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size,omitempty"`
+}
+
+// fetchDispatcher constructs the handler used to start blob fetches and
+// poll their status.
+func fetchDispatcher(ctx *Context, r *http.Request) http.Handler {
+	fetchHandler := &fetchHandler{
+		Context: ctx,
+		ID:      getUploadUUID(ctx),
+	}
+
+	if fetchHandler.ID != "" {
+		return handlers.MethodHandler{
+			"GET": http.HandlerFunc(fetchHandler.GetFetchStatus),
+		}
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(fetchHandler.StartFetch)
+	}
+	return mhandler
+}
+
+// fetchHandler handles requests for blob fetches.
+type fetchHandler struct {
+	*Context
+
+	// ID identifies the fetch of status requests.
+	ID string
+}
+
+// StartFetch starts fetching a blob from the URL given in the request body.
+func (fh *fetchHandler) StartFetch(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(fh).Debug("StartFetch")
+
+	if fh.App.fetcher == nil {
+		fh.Errors = append(fh.Errors, errcode.ErrorCodeUnsupported.WithDetail("blob fetches are not enabled"))
+		return
+	}
+
+	var req fetchRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFetchRequestSize)).Decode(&req); err != nil {
+		fh.Errors = append(fh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail(fmt.Sprintf("invalid fetch request: %v", err)))
+		return
+	}
+	if req.URL == "" {
+		fh.Errors = append(fh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail("url missing"))
+		return
+	}
+	if err := req.Digest.Validate(); err != nil {
+		fh.Errors = append(fh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		return
+	}
+	if fh.App.fips {
+		if err := fips.ApprovedDigest(req.Digest); err != nil {
+			fh.Errors = append(fh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err.Error()))
+			return
+		}
+	}
+
+	if _, err := fh.Repository.Blobs(fh).Stat(fh, req.Digest); err == nil {
+		if err := fh.setBlobLocation(w, req.Digest); err != nil {
+			fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusCreated)
+		return
+	} else if err != distribution.ErrBlobUnknown {
+		fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	// The fetch outlives the request, so it runs with the context of the
+	// application.
+	status, err := fh.App.fetcher.Start(fh.App, fh.Repository.Named().Name(), fh.Repository.Blobs(fh.App), req.URL, req.Digest, req.Size)
+	if err != nil {
+		if errors.Is(err, fetch.ErrHostNotAllowed) {
+			fh.Errors = append(fh.Errors, errcode.ErrorCodeDenied.WithDetail(err.Error()))
+		} else {
+			fh.Errors = append(fh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail(err.Error()))
+		}
+		return
+	}
+
+	statusURL, err := fh.urlBuilder.BuildFetchStatusURL(fh.Repository.Named(), status.ID)
+	if err != nil {
+		fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Location", statusURL)
+	fh.writeStatus(w, status, http.StatusAccepted)
+}
+
+// GetFetchStatus returns the progress of a fetch.
+func (fh *fetchHandler) GetFetchStatus(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(fh).Debug("GetFetchStatus")
+
+	if fh.App.fetcher == nil {
+		fh.Errors = append(fh.Errors, v2.ErrorCodeFetchUnknown.WithDetail(map[string]string{"id": fh.ID}))
+		return
+	}
+	status, ok := fh.App.fetcher.Status(fh.Repository.Named().Name(), fh.ID)
+	if !ok {
+		fh.Errors = append(fh.Errors, v2.ErrorCodeFetchUnknown.WithDetail(map[string]string{"id": fh.ID}))
+		return
+	}
+
+	if status.State == fetch.StateComplete {
+		if err := fh.setBlobLocation(w, status.Digest); err != nil {
+			fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	}
+	fh.writeStatus(w, status, http.StatusOK)
+}
+
+// setBlobLocation sets the Location and Docker-Content-Digest headers of a
+// blob of the repository.
+func (fh *fetchHandler) setBlobLocation(w http.ResponseWriter, dgst digest.Digest) error {
+	ref, err := reference.WithDigest(fh.Repository.Named(), dgst)
+	if err != nil {
+		return err
+	}
+	blobURL, err := fh.urlBuilder.BuildBlobURL(ref)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", blobURL)
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	return nil
+}
+
+func (fh *fetchHandler) writeStatus(w http.ResponseWriter, status fetch.Status, code int) {
+	body, err := json.Marshal(status)
+	if err != nil {
+		fh.Errors = append(fh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(code)
+	w.Write(body)
+}
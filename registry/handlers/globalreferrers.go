@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// globalReferrersDispatcher constructs the handler listing the referrers of
+// a subject across repositories.
+func globalReferrersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	globalReferrersHandler := &globalReferrersHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(globalReferrersHandler.GetGlobalReferrers),
+	}
+}
+
+// globalReferrersHandler handles requests for the referrers of a subject
+// across repositories.
+type globalReferrersHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// globalReferrers is the response listing the referrers of a subject
+// across repositories.
+type globalReferrers struct {
+	Subject   digest.Digest    `json:"subject"`
+	Referrers []globalReferrer `json:"referrers"`
+}
+
+type globalReferrer struct {
+	Repository string `json:"repository"`
+	v1.Descriptor
+}
+
+// GetGlobalReferrers lists the referrers of the subject, from the global
+// referrers index, in the repositories the client may pull from and which
+// the network rules do not restrict for its address.
+func (h *globalReferrersHandler) GetGlobalReferrers(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(h).Debug("GetGlobalReferrers")
+
+	indexed, ok, err := storage.GlobalReferrers(h, h.App.registry, h.Digest)
+	if err != nil {
+		h.Errors = append(h.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if !ok {
+		h.Errors = append(h.Errors, errcode.ErrorCodeUnsupported.WithDetail("the global referrers index is not enabled"))
+		return
+	}
+
+	filter := parseReferrersFilter(r.URL.Query())
+	// pullable caches whether the client may pull from each repository.
+	pullable := make(map[string]bool)
+	response := globalReferrers{Subject: h.Digest, Referrers: []globalReferrer{}}
+	for _, referrer := range indexed {
+		if !filter.matches(referrer.Descriptor) {
+			continue
+		}
+		allowed, checked := pullable[referrer.Repository]
+		if !checked {
+			allowed = h.mayPull(r, referrer.Repository)
+			pullable[referrer.Repository] = allowed
+		}
+		if allowed {
+			response.Referrers = append(response.Referrers, globalReferrer{Repository: referrer.Repository, Descriptor: referrer.Descriptor})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(response); err != nil {
+		h.Errors = append(h.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// mayPull reports whether the network rules allow the client to access a
+// repository, and the access controller grants it pull access. Repositories
+// are left out of the response on any error, so that a failing access
+// controller does not disclose them.
+func (h *globalReferrersHandler) mayPull(r *http.Request, repoName string) bool {
+	if ipFilter := h.App.ipFilter; ipFilter != nil && !ipFilter.Allowed(repoName, ipFilter.ClientIP(r)) {
+		return false
+	}
+	if h.App.accessController == nil {
+		return true
+	}
+	_, err := h.App.accessController.Authorized(h, auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: repoName},
+		Action:   "pull",
+	})
+	if err != nil {
+		if _, ok := err.(auth.Challenge); !ok {
+			dcontext.GetLogger(h).Errorf("error checking pull access to %s: %v", repoName, err)
+		}
+		return false
+	}
+	return true
+}
+
+// globalReferrersHealth checks the health of the global referrers index.
+type globalReferrersHealth struct {
+	namespace distribution.Namespace
+}
+
+// Health checks that the global referrers index can be listed.
+func (h globalReferrersHealth) Health(ctx context.Context) error {
+	return storage.CheckGlobalReferrersIndex(ctx, h.namespace)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// mediaTypeDOT is the media type of dependency graphs in the Graphviz DOT
+// language.
+const mediaTypeDOT = "text/vnd.graphviz"
+
+// graphDispatcher constructs the handler used to export the dependency
+// graph of a repository.
+func graphDispatcher(ctx *Context, r *http.Request) http.Handler {
+	graphHandler := &graphHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(graphHandler.GetGraph),
+	}
+}
+
+// graphHandler handles requests for dependency graphs.
+type graphHandler struct {
+	*Context
+}
+
+// GetGraph exports the graph of the manifests given as digest parameters,
+// or of all manifests of the repository, as JSON or, if accepted, as DOT.
+func (gh *graphHandler) GetGraph(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(gh).Debug("GetGraph")
+
+	manifests, err := gh.Repository.Manifests(gh)
+	if err != nil {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	var roots []digest.Digest
+	for _, param := range r.URL.Query()["digest"] {
+		dgst, err := digest.Parse(param)
+		if err != nil {
+			gh.Errors = append(gh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+			return
+		}
+		exists, err := manifests.Exists(gh, dgst)
+		if err != nil {
+			gh.Errors = append(gh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		if !exists {
+			gh.Errors = append(gh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(dgst))
+			return
+		}
+		roots = append(roots, dgst)
+	}
+
+	// The repository of the context is wrapped by notifications, which
+	// hides the referrers of the storage repository.
+	repository, err := gh.App.registry.Repository(gh, gh.Repository.Named())
+	if err != nil {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	graph, err := storage.DependencyGraph(gh, repository, roots...)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			gh.Errors = append(gh.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		} else {
+			gh.Errors = append(gh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	mediaType := "application/json"
+	if strings.Contains(r.Header.Get("Accept"), mediaTypeDOT) {
+		mediaType = mediaTypeDOT
+		err = graph.WriteDOT(&buf)
+	} else {
+		err = json.NewEncoder(&buf).Encode(graph)
+	}
+	if err != nil {
+		gh.Errors = append(gh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+	w.Write(buf.Bytes())
+}
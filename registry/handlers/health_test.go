@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -65,6 +66,64 @@ func TestFileHealthCheck(t *testing.T) {
 	}
 }
 
+func TestLivenessHealthCheck(t *testing.T) {
+	interval := time.Second
+
+	var files []string
+	for i := 0; i < 2; i++ {
+		tmpfile, err := ioutil.TempFile(os.TempDir(), "healthcheck")
+		if err != nil {
+			t.Fatalf("could not create temporary file: %v", err)
+		}
+		tmpfile.Close()
+		defer os.Remove(tmpfile.Name())
+		files = append(files, tmpfile.Name())
+	}
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Health: configuration.Health{
+			FileCheckers: []configuration.FileChecker{
+				{
+					Interval: interval,
+					File:     files[0],
+				},
+				{
+					Interval: interval,
+					File:     files[1],
+					Liveness: true,
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	app := NewApp(ctx, config)
+	healthRegistry := health.NewRegistry()
+	livenessRegistry := health.NewRegistry()
+	app.RegisterHealthChecks(healthRegistry, livenessRegistry)
+
+	// Wait for health check to happen
+	<-time.After(2 * interval)
+
+	if status := healthRegistry.CheckStatus(); len(status) != 2 {
+		t.Fatalf("expected 2 items in readiness check results, got %v", status)
+	}
+	status := livenessRegistry.CheckStatus()
+	if len(status) != 1 {
+		t.Fatalf("expected 1 item in liveness check results, got %v", status)
+	}
+	if status[files[1]] != "file exists" {
+		t.Fatal(`did not get "file exists" result for liveness check`)
+	}
+}
+
 func TestTCPHealthCheck(t *testing.T) {
 	interval := time.Second
 
@@ -208,3 +267,59 @@ func TestHTTPHealthCheck(t *testing.T) {
 		t.Fatal("expected 0 items in health check results")
 	}
 }
+
+func TestExtensionHealthCheck(t *testing.T) {
+	interval := time.Second
+
+	var healthy int32
+	notary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_notary_server/health" {
+			t.Errorf("unexpected health check path %s", r.URL.Path)
+		}
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer notary.Close()
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Notary: configuration.Notary{
+			URL: notary.URL,
+		},
+	}
+	config.Referrers.Global = true
+	config.Health.Extensions.Enabled = true
+	config.Health.Extensions.Interval = interval
+
+	ctx := context.Background()
+
+	app := NewApp(ctx, config)
+	healthRegistry := health.NewRegistry()
+	livenessRegistry := health.NewRegistry()
+	app.RegisterHealthChecks(healthRegistry, livenessRegistry)
+
+	// Wait for health check to happen
+	<-time.After(2 * interval)
+
+	// The unhealthy Notary server makes the instance not ready, without
+	// failing its liveness.
+	status := healthRegistry.CheckStatus()
+	if len(status) != 1 || status["extension_notary"] != "the Notary server is unhealthy: 503 Service Unavailable" {
+		t.Fatalf("unexpected readiness check results: %v", status)
+	}
+	if status := livenessRegistry.CheckStatus(); len(status) != 0 {
+		t.Fatalf("unexpected liveness check results: %v", status)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	<-time.After(2 * interval)
+	if status := healthRegistry.CheckStatus(); len(status) != 0 {
+		t.Fatalf("unexpected readiness check results: %v", status)
+	}
+}
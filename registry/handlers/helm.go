@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// helmIndexTTL is how long the charts of a repository are cached, so
+	// that tags changed by other registry instances show up.
+	helmIndexTTL = time.Minute
+	// maxHelmIndexes bounds the number of repositories whose charts are
+	// cached.
+	maxHelmIndexes = 1000
+)
+
+// Media types of the Helm charts stored in OCI registries.
+const (
+	helmConfigMediaType     = "application/vnd.cncf.helm.config.v1+json"
+	helmChartMediaType      = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	helmProvenanceMediaType = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+// helmDispatcher constructs the handler serving the Helm charts of a
+// repository to the clients of classic Helm chart repositories.
+func helmDispatcher(ctx *Context, r *http.Request) http.Handler {
+	helmHandler := &helmHandler{
+		Context: ctx,
+		File:    dcontext.GetStringValue(ctx, "vars.chart"),
+	}
+
+	if helmHandler.File == "" {
+		return handlers.MethodHandler{
+			"GET": http.HandlerFunc(helmHandler.GetIndex),
+		}
+	}
+	return handlers.MethodHandler{
+		"GET":  http.HandlerFunc(helmHandler.GetChart),
+		"HEAD": http.HandlerFunc(helmHandler.GetChart),
+	}
+}
+
+// helmHandler handles requests for the Helm index and charts of a
+// repository.
+type helmHandler struct {
+	*Context
+
+	// File is the name of the requested chart archive or provenance file,
+	// empty for the index.
+	File string
+}
+
+// helmChart is a chart pushed to the repository.
+type helmChart struct {
+	// metadata is the chart metadata stored as the manifest config.
+	metadata   map[string]interface{}
+	name       string
+	version    string
+	created    string
+	archive    distribution.Descriptor
+	provenance *distribution.Descriptor
+}
+
+// file returns the name of the chart archive in the index.
+func (c helmChart) file() string {
+	return c.name + "-" + c.version + ".tgz"
+}
+
+// helmIndex is the index.yaml file of a classic Helm chart repository.
+type helmIndex struct {
+	APIVersion string                              `yaml:"apiVersion"`
+	Entries    map[string][]map[string]interface{} `yaml:"entries"`
+	Generated  string                              `yaml:"generated"`
+}
+
+// GetIndex lists the tagged charts of the repository in the index.yaml
+// format of classic Helm chart repositories.
+func (hh *helmHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(hh).Debug("GetIndex")
+
+	charts, ok := hh.charts()
+	if !ok {
+		return
+	}
+
+	index := helmIndex{
+		APIVersion: "v1",
+		Entries:    make(map[string][]map[string]interface{}),
+		Generated:  time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, chart := range charts {
+		entry := make(map[string]interface{}, len(chart.metadata)+3)
+		for k, v := range chart.metadata {
+			entry[k] = v
+		}
+		entry["digest"] = chart.archive.Digest.Hex()
+		entry["urls"] = []string{"charts/" + chart.file()}
+		if chart.created != "" {
+			entry["created"] = chart.created
+		}
+		index.Entries[chart.name] = append(index.Entries[chart.name], entry)
+	}
+
+	out, err := yaml.Marshal(index)
+	if err != nil {
+		hh.Errors = append(hh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write(out)
+}
+
+// GetChart serves the archive or the provenance file of a chart listed in
+// the index. The chart is looked up by the tag its version is pushed to,
+// falling back to the index for charts tagged otherwise.
+func (hh *helmHandler) GetChart(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(hh).Debug("GetChart")
+
+	file := strings.TrimSuffix(hh.File, ".prov")
+	chart, ok := hh.taggedChart(file)
+	if !ok {
+		charts, ok := hh.charts()
+		if !ok {
+			return
+		}
+		for i := range charts {
+			if charts[i].file() == file {
+				chart = &charts[i]
+				break
+			}
+		}
+	}
+	if chart == nil {
+		hh.Errors = append(hh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(map[string]string{"chart": hh.File}))
+		return
+	}
+
+	desc := chart.archive
+	if file != hh.File {
+		if chart.provenance == nil {
+			hh.Errors = append(hh.Errors, v2.ErrorCodeBlobUnknown.WithDetail("chart has no provenance file"))
+			return
+		}
+		desc = *chart.provenance
+	}
+	if err := hh.Repository.Blobs(hh).ServeBlob(hh, w, r, desc.Digest); err != nil {
+		if err == distribution.ErrBlobUnknown {
+			hh.Errors = append(hh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(desc.Digest))
+		} else {
+			hh.Errors = append(hh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+	}
+}
+
+// taggedChart looks up the chart archive file among the tags its version
+// may be pushed to, Helm replacing the "+" of versions by "_" in tags. As
+// both chart names and versions may contain "-", every split of the file
+// name is tried.
+func (hh *helmHandler) taggedChart(file string) (*helmChart, bool) {
+	base := strings.TrimSuffix(file, ".tgz")
+	if base == file {
+		return nil, false
+	}
+	tags := hh.Repository.Tags(hh)
+	for i := strings.Index(base, "-"); i >= 0; {
+		tag := strings.ReplaceAll(base[i+1:], "+", "_")
+		if desc, err := tags.Get(hh, tag); err == nil {
+			if chart, ok := hh.loadChart(desc); ok && chart.file() == file {
+				return &chart, true
+			}
+		}
+		next := strings.Index(base[i+1:], "-")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, false
+}
+
+// charts returns the charts pointed at by the tags of the repository,
+// appending the error to the response if they cannot be listed. The charts
+// are cached until the repository is written to, or for helmIndexTTL.
+func (hh *helmHandler) charts() ([]helmChart, bool) {
+	repo := hh.Repository.Named().Name()
+	charts, writes, ok := hh.App.helmIndexes.get(repo)
+	if ok {
+		return charts, true
+	}
+
+	tags := hh.Repository.Tags(hh)
+	names, err := tags.All(hh)
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			hh.Errors = append(hh.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": repo}))
+		case errcode.Error:
+			hh.Errors = append(hh.Errors, err)
+		default:
+			hh.Errors = append(hh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return nil, false
+	}
+
+	charts = nil
+	seen := make(map[string]struct{})
+	for _, tag := range names {
+		desc, err := tags.Get(hh, tag)
+		if err != nil {
+			// The tag was deleted since it was listed.
+			continue
+		}
+		chart, ok := hh.loadChart(desc)
+		if !ok {
+			continue
+		}
+		// A chart may be tagged more than once.
+		if _, ok := seen[chart.file()]; ok {
+			continue
+		}
+		seen[chart.file()] = struct{}{}
+		charts = append(charts, chart)
+	}
+	hh.App.helmIndexes.put(repo, charts, writes)
+	return charts, true
+}
+
+// loadChart reads the chart of the manifest desc, returning false if it is
+// not a Helm chart.
+func (hh *helmHandler) loadChart(desc distribution.Descriptor) (helmChart, bool) {
+	manifests, err := hh.Repository.Manifests(hh)
+	if err != nil {
+		dcontext.GetLogger(hh).Warnf("error reading manifests: %v", err)
+		return helmChart{}, false
+	}
+	manifest, err := manifests.Get(hh, desc.Digest)
+	if err != nil {
+		dcontext.GetLogger(hh).Warnf("error reading manifest %s: %v", desc.Digest, err)
+		return helmChart{}, false
+	}
+	m, ok := manifest.(*ocischema.DeserializedManifest)
+	if !ok || m.Config.MediaType != helmConfigMediaType {
+		return helmChart{}, false
+	}
+
+	chart := helmChart{created: m.Annotations[v1.AnnotationCreated]}
+	for _, layer := range m.Layers {
+		switch layer.MediaType {
+		case helmChartMediaType:
+			chart.archive = layer
+		case helmProvenanceMediaType:
+			layer := layer
+			chart.provenance = &layer
+		}
+	}
+	if chart.archive.Digest == "" {
+		return helmChart{}, false
+	}
+
+	config, err := hh.Repository.Blobs(hh).Get(hh, m.Config.Digest)
+	if err != nil {
+		dcontext.GetLogger(hh).Warnf("error reading chart metadata %s: %v", m.Config.Digest, err)
+		return helmChart{}, false
+	}
+	if err := json.Unmarshal(config, &chart.metadata); err != nil {
+		dcontext.GetLogger(hh).Warnf("invalid chart metadata %s: %v", m.Config.Digest, err)
+		return helmChart{}, false
+	}
+	chart.name, _ = chart.metadata["name"].(string)
+	chart.version, _ = chart.metadata["version"].(string)
+	if chart.name == "" || chart.version == "" {
+		return helmChart{}, false
+	}
+	return chart, true
+}
+
+// helmIndexCache caches the charts of repositories, as listing them reads
+// the manifest and the metadata of every tag.
+type helmIndexCache struct {
+	mu      sync.Mutex
+	entries map[string]helmIndexEntry
+	// writes counts the invalidations, so that charts listed while a
+	// repository was written to are not cached.
+	writes uint64
+}
+
+type helmIndexEntry struct {
+	charts  []helmChart
+	expires time.Time
+}
+
+func newHelmIndexCache() *helmIndexCache {
+	return &helmIndexCache{entries: make(map[string]helmIndexEntry)}
+}
+
+// get returns the cached charts of a repository, if they have not expired.
+// Otherwise, it returns the count of invalidations to pass to put.
+func (c *helmIndexCache) get(repo string) ([]helmChart, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[repo]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.writes, false
+	}
+	return entry.charts, c.writes, true
+}
+
+// put caches the charts of a repository listed after get returned writes,
+// unless a repository was written to since.
+func (c *helmIndexCache) put(repo string, charts []helmChart, writes uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writes != writes {
+		return
+	}
+	now := time.Now()
+	if len(c.entries) >= maxHelmIndexes {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxHelmIndexes {
+			c.entries = make(map[string]helmIndexEntry)
+		}
+	}
+	c.entries[repo] = helmIndexEntry{charts: charts, expires: now.Add(helmIndexTTL)}
+}
+
+// invalidate drops the cached charts of a repository after it is written to.
+func (c *helmIndexCache) invalidate(repo string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes++
+	delete(c.entries, repo)
+}
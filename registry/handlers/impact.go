@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// impactDispatcher constructs the handler used to analyze what deleting a
+// manifest or tag would affect.
+func impactDispatcher(ctx *Context, r *http.Request) http.Handler {
+	impactHandler := &impactHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		impactHandler.Tag = reference
+	} else {
+		impactHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(impactHandler.GetImpact),
+	}
+}
+
+// impactHandler handles requests for the impact of deletions.
+type impactHandler struct {
+	*Context
+
+	// One of tag or digest identifies what would be deleted.
+	Tag    string
+	Digest digest.Digest
+}
+
+// GetImpact returns what deleting the manifest or tag would affect, so that
+// users can check before deleting it.
+func (ih *impactHandler) GetImpact(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(ih).Debug("GetImpact")
+
+	// The repository of the context is wrapped by notifications, which
+	// hides the referrers of the storage repository.
+	repository, err := ih.App.registry.Repository(ih, ih.Repository.Named())
+	if err != nil {
+		ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	var impact *storage.DeleteImpact
+	if ih.Tag != "" {
+		impact, err = storage.TagDeleteImpact(ih, repository, ih.Tag)
+	} else {
+		impact, err = storage.ManifestDeleteImpact(ih, repository, ih.Digest)
+	}
+	if err != nil {
+		switch err.(type) {
+		case distribution.ErrTagUnknown, distribution.ErrManifestUnknownRevision:
+			ih.Errors = append(ih.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		case distribution.ErrRepositoryUnknown:
+			ih.Errors = append(ih.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		default:
+			ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	body, err := json.Marshal(impact)
+	if err != nil {
+		ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.Write(body)
+}
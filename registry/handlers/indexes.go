@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// indexDispatcher constructs the handler used to assemble image indexes
+// from manifests already present in the repository.
+func indexDispatcher(ctx *Context, r *http.Request) http.Handler {
+	indexHandler := &indexHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(indexHandler.AssembleIndex)
+	}
+	return mhandler
+}
+
+// indexUpdateDispatcher constructs the handler used to update image indexes
+// already present in the repository.
+func indexUpdateDispatcher(ctx *Context, r *http.Request) http.Handler {
+	indexHandler := &indexHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		indexHandler.Tag = reference
+	} else {
+		indexHandler.Digest = dgst
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["PATCH"] = http.HandlerFunc(indexHandler.UpdateIndex)
+	}
+	return mhandler
+}
+
+// indexHandler handles requests to assemble and update image indexes.
+type indexHandler struct {
+	*Context
+
+	// For updates, one of tag or digest identifies the index.
+	Tag    string
+	Digest digest.Digest
+}
+
+// assembleIndexRequest is the body of an index assembly request.
+type assembleIndexRequest struct {
+	// MediaType is the media type of the index, defaulting to the OCI
+	// image index media type.
+	MediaType string `json:"mediaType,omitempty"`
+
+	// Tag, if set, is pointed at the stored index.
+	Tag string `json:"tag,omitempty"`
+
+	// Manifests lists the digests and platforms of the child manifests.
+	Manifests []distribution.Descriptor `json:"manifests"`
+}
+
+// updateIndexRequest is the body of an index update request.
+type updateIndexRequest struct {
+	// Tag, if set, is pointed at the updated index. It defaults to the tag
+	// the index was requested by, if any.
+	Tag string `json:"tag,omitempty"`
+
+	// Add lists the digests and platforms of the child manifests to add.
+	Add []distribution.Descriptor `json:"add,omitempty"`
+
+	// Remove lists the digests of the child manifests to remove.
+	Remove []digest.Digest `json:"remove,omitempty"`
+}
+
+// AssembleIndex validates the requested child manifests, builds an index
+// referencing them and stores it in the repository.
+func (ih *indexHandler) AssembleIndex(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(ih).Debug("AssembleIndex")
+
+	var req assembleIndexRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxManifestBodySize)).Decode(&req); err != nil {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+
+	if req.Tag != "" {
+		if _, err := reference.WithTag(ih.Repository.Named(), req.Tag); err != nil {
+			ih.Errors = append(ih.Errors, v2.ErrorCodeTagInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	if req.MediaType == "" {
+		req.MediaType = v1.MediaTypeImageIndex
+	}
+	builder, err := manifestlist.NewManifestBuilder(req.MediaType)
+	if err != nil {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+
+	manifests, err := ih.Repository.Manifests(ih)
+	if err != nil {
+		ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	for _, desc := range req.Manifests {
+		desc, err := ih.describeChild(manifests, desc)
+		if err != nil {
+			ih.Errors = append(ih.Errors, err)
+			return
+		}
+
+		if err := builder.AppendReference(desc); err != nil {
+			ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	index, err := builder.Build(ih)
+	if err != nil {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+
+	storeManifest(ih.Context, w, manifests, index, req.Tag)
+}
+
+// UpdateIndex stores a copy of an index with child manifests added or
+// removed, so that the platforms of a multi-platform image can be pushed
+// as their builds complete.
+func (ih *indexHandler) UpdateIndex(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(ih).Debug("UpdateIndex")
+
+	var req updateIndexRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxManifestBodySize)).Decode(&req); err != nil {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+
+	if req.Tag == "" {
+		req.Tag = ih.Tag
+	}
+	if req.Tag != "" {
+		if _, err := reference.WithTag(ih.Repository.Named(), req.Tag); err != nil {
+			ih.Errors = append(ih.Errors, v2.ErrorCodeTagInvalid.WithDetail(err))
+			return
+		}
+	}
+	for _, dgst := range req.Remove {
+		if err := dgst.Validate(); err != nil {
+			ih.Errors = append(ih.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	manifests, err := ih.Repository.Manifests(ih)
+	if err != nil {
+		ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if ih.Tag != "" {
+		desc, err := ih.Repository.Tags(ih).Get(ih, ih.Tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				ih.Errors = append(ih.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		ih.Digest = desc.Digest
+	}
+
+	manifest, err := manifests.Get(ih, ih.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			ih.Errors = append(ih.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else {
+			ih.Errors = append(ih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	list, ok := manifest.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail("not an image index or manifest list"))
+		return
+	}
+
+	add := make([]distribution.Descriptor, 0, len(req.Add))
+	for _, desc := range req.Add {
+		desc, err := ih.describeChild(manifests, desc)
+		if err != nil {
+			ih.Errors = append(ih.Errors, err)
+			return
+		}
+		add = append(add, desc)
+	}
+
+	index, err := manifestlist.Update(list, add, req.Remove)
+	if err != nil {
+		ih.Errors = append(ih.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+
+	storeManifest(ih.Context, w, manifests, index, req.Tag)
+}
+
+// describeChild checks that a child manifest of an index exists in the
+// repository and completes its descriptor.
+func (ih *indexHandler) describeChild(manifests distribution.ManifestService, desc distribution.Descriptor) (distribution.Descriptor, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return desc, v2.ErrorCodeDigestInvalid.WithDetail(err)
+	}
+
+	child, err := manifests.Get(ih, desc.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			return desc, v2.ErrorCodeManifestUnknown.WithDetail(err)
+		}
+		return desc, errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+
+	mediaType, payload, err := child.Payload()
+	if err != nil {
+		return desc, errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+	desc.MediaType = mediaType
+	desc.Size = int64(len(payload))
+	return desc, nil
+}
+
+// storeManifest stores a manifest built by the registry, points tag at it
+// if set and writes the response.
+func storeManifest(ctx *Context, w http.ResponseWriter, manifests distribution.ManifestService, m distribution.Manifest, tag string) {
+	dgst, err := manifests.Put(ctx, m)
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrManifestVerification:
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		case errcode.Error:
+			ctx.Errors = append(ctx.Errors, err)
+		default:
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if tag != "" {
+		desc := distribution.Descriptor{
+			MediaType: mediaType,
+			Size:      int64(len(payload)),
+			Digest:    dgst,
+		}
+		if ctx.App.timeline != nil {
+			ctx.storedTag = tag
+			if previous, err := ctx.Repository.Tags(ctx).Get(ctx, tag); err == nil {
+				ctx.storedPrevious = previous.Digest
+			}
+		}
+		if err := ctx.Repository.Tags(ctx).Tag(ctx, tag, desc); err != nil {
+			ctx.Errors = append(ctx.Errors, tagError(err))
+			return
+		}
+	}
+
+	ref, err := reference.WithDigest(ctx.Repository.Named(), dgst)
+	if err != nil {
+		ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	location, err := ctx.urlBuilder.BuildManifestURL(ref)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error building manifest url from digest: %v", err)
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.WriteHeader(http.StatusCreated)
+}
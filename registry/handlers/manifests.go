@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"mime"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/fips"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
@@ -243,6 +245,10 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if _, isSchema1 := manifest.(*schema1.SignedManifest); isSchema1 && imh.App.Config.Policy.Warnings.Schema1 {
+		imh.warn(schema1Warning)
+	}
+	imh.setReferrerHeaders(w)
 	w.Header().Set("Content-Type", ct)
 	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
@@ -250,6 +256,22 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 	w.Write(p)
 }
 
+// setReferrerHeaders summarizes the referrers of the manifest in the
+// response headers, if enabled. The headers are left out if the referrers
+// cannot be listed.
+func (imh *manifestHandler) setReferrerHeaders(w http.ResponseWriter) {
+	if imh.App.referrerSummaries == nil {
+		return
+	}
+
+	summary, err := summarizeReferrers(imh.Context, imh.Digest, referrersFilter{})
+	if err != nil {
+		dcontext.GetLogger(imh).Errorf("error listing referrers of %s: %v", imh.Digest, err)
+		return
+	}
+	summary.setHeaders(w.Header())
+}
+
 func (imh *manifestHandler) convertSchema2Manifest(schema2Manifest *schema2.DeserializedManifest) (distribution.Manifest, error) {
 	targetDescriptor := schema2Manifest.Target()
 	blobs := imh.Repository.Blobs(imh)
@@ -322,6 +344,10 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if _, isSchema1 := manifest.(*schema1.SignedManifest); isSchema1 && imh.App.Config.Policy.Warnings.Schema1 {
+		imh.warn(schema1Warning)
+	}
+
 	if imh.Digest != "" {
 		if desc.Digest != imh.Digest {
 			dcontext.GetLogger(imh).Errorf("payload digest does not match: %q != %q", desc.Digest, imh.Digest)
@@ -335,6 +361,13 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if imh.App.fips {
+		if err := approvedDigests(manifest); err != nil {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err.Error()))
+			return
+		}
+	}
+
 	isAnOCIManifest := false
 	switch mediaType {
 	case v1.MediaTypeImageManifest, v1.MediaTypeArtifactManifest, v1.MediaTypeImageIndex:
@@ -379,9 +412,15 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 					imh.Errors = append(imh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
 				case distribution.ErrManifestUnverified:
 					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnverified)
+				case distribution.ErrManifestArtifactTypeDenied:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeArtifactTypeDenied.WithDetail(map[string]string{"artifactType": verificationError.ArtifactType}))
+				case distribution.ErrReferrersLimitExceeded:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeReferrersLimitExceeded.WithDetail(map[string]interface{}{"subject": verificationError.Subject, "limit": verificationError.Limit}))
 				default:
 					if verificationError == digest.ErrDigestInvalidFormat {
 						imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
+					} else if verificationError == distribution.ErrInvalidSubjectMediaType {
+						imh.Errors = append(imh.Errors, v2.ErrorCodeSubjectInvalid)
 					} else {
 						imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown, verificationError)
 					}
@@ -395,12 +434,18 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if imh.App.referrerSummaries != nil {
+		if subject := manifestSubject(manifest); subject != nil {
+			imh.App.referrerSummaries.invalidate(imh.Repository.Named().Name(), subject.Digest)
+		}
+	}
+
 	// Tag this manifest
 	if imh.Tag != "" {
 		tags := imh.Repository.Tags(imh)
 		err = tags.Tag(imh, imh.Tag, desc)
 		if err != nil {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			imh.Errors = append(imh.Errors, tagError(err))
 			return
 		}
 
@@ -428,6 +473,30 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 	dcontext.GetLogger(imh).Debug("Succeeded in putting manifest!")
 }
 
+// manifestSubject returns the subject of a manifest, if any.
+func manifestSubject(manifest distribution.Manifest) *distribution.Descriptor {
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		return m.Subject
+	case *ociartifact.DeserializedManifest:
+		return m.Subject
+	case *manifestlist.DeserializedManifestList:
+		return m.Subject
+	}
+	return nil
+}
+
+// approvedDigests checks that the manifest only references content by FIPS
+// approved digests.
+func approvedDigests(manifest distribution.Manifest) error {
+	for _, desc := range manifest.References() {
+		if err := fips.ApprovedDigest(desc.Digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // applyResourcePolicy checks whether the resource class matches what has
 // been authorized and allowed by the policy configuration.
 func (imh *manifestHandler) applyResourcePolicy(manifest distribution.Manifest) error {
@@ -514,10 +583,10 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		dcontext.GetLogger(imh).Debug("DeleteImageTag")
 		tagService := imh.Repository.Tags(imh.Context)
 		if err := tagService.Untag(imh.Context, imh.Tag); err != nil {
-			switch err.(type) {
-			case distribution.ErrTagUnknown, driver.PathNotFoundError:
+			var tagUnknown distribution.ErrTagUnknown
+			if errors.As(err, &tagUnknown) || errors.Is(err, driver.ErrNotFound) {
 				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
-			default:
+			} else {
 				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			}
 			return
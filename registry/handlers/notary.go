@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// notaryProxy forwards content trust requests to a Notary server.
+type notaryProxy struct {
+	*httputil.ReverseProxy
+
+	// healthURL is the health endpoint of the Notary server.
+	healthURL string
+}
+
+// newNotaryProxy returns the proxy forwarding content trust requests to the
+// Notary server of the configuration.
+func newNotaryProxy(config configuration.Notary) (*notaryProxy, error) {
+	target, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Notary URL %q: %v", config.URL, err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+		return nil, fmt.Errorf("invalid Notary URL %q: must be an absolute HTTP or HTTPS URL", config.URL)
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			r.URL.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+			r.URL.RawPath = ""
+			r.Host = target.Host
+			// Access is checked by the registry, whose credentials are
+			// not for the Notary server to see.
+			r.Header.Del("Authorization")
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			dcontext.GetLogger(r.Context()).Errorf("error proxying content trust request: %v", err)
+			if err := errcode.ServeJSON(w, errcode.ErrorCodeUnavailable.WithDetail("the Notary server is unavailable")); err != nil {
+				dcontext.GetLogger(r.Context()).Errorf("error serving error json: %v", err)
+			}
+		},
+	}
+	return &notaryProxy{
+		ReverseProxy: reverseProxy,
+		healthURL:    strings.TrimSuffix(target.String(), "/") + "/_notary_server/health",
+	}, nil
+}
+
+// Health checks that the Notary server reports itself healthy.
+func (np *notaryProxy) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, np.healthURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("the Notary server is unavailable: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the Notary server is unhealthy: %s", resp.Status)
+	}
+	return nil
+}
+
+// trustDispatcher constructs the handler forwarding the content trust
+// requests of a repository to the Notary server.
+func trustDispatcher(ctx *Context, r *http.Request) http.Handler {
+	if ctx.App.notary == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeUnsupported.WithDetail("content trust is not enabled"))
+		})
+	}
+
+	trustHandler := &trustHandler{Context: ctx}
+	mhandler := handlers.MethodHandler{
+		"GET":  http.HandlerFunc(trustHandler.ProxyTrust),
+		"HEAD": http.HandlerFunc(trustHandler.ProxyTrust),
+	}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(trustHandler.ProxyTrust)
+		mhandler["DELETE"] = http.HandlerFunc(trustHandler.ProxyTrust)
+	}
+	return mhandler
+}
+
+// trustHandler handles the content trust requests of a repository.
+type trustHandler struct {
+	*Context
+}
+
+// ProxyTrust forwards the request to the Notary server, under the
+// globally unique name of the trust data: the registry host followed by the
+// repository name. The host must be the one of the registry, the configured
+// http.host or else the host of the request, so that access to a repository
+// does not grant access to the trust data of the same repository name on
+// other registries sharing the Notary server.
+func (th *trustHandler) ProxyTrust(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(th).Debug("ProxyTrust")
+
+	domain := dcontext.GetStringValue(th, "vars.domain")
+	gun := domain + "/" + getName(th)
+	host := r.Host
+	if th.App.httpHost.Host != "" {
+		host = th.App.httpHost.Host
+	}
+	if !strings.EqualFold(domain, host) {
+		th.Errors = append(th.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": gun}))
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.URL.Path = "/v2/" + gun + "/_trust/" + dcontext.GetStringValue(th, "vars.trust")
+	th.App.notary.ServeHTTP(w, out)
+}
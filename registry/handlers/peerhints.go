@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+)
+
+// peerHintsHeader lists the URLs of the blob on peers of the registry.
+const peerHintsHeader = "Docker-Distribution-Peer-Hints"
+
+// defaultMaxPeerHints is the number of peers hinted per blob if the
+// configuration does not say.
+const defaultMaxPeerHints = 3
+
+// peerHints selects the peers hinted for blobs. Each blob is hinted the
+// same peers, chosen by rendezvous hashing, so that the blobs spread over
+// the peers and each peer caches the blobs it is hinted for.
+type peerHints struct {
+	peers   []*v2.URLBuilder
+	max     int
+	minSize int64
+}
+
+func newPeerHints(config configuration.Peers) (*peerHints, error) {
+	p := &peerHints{
+		max:     config.MaxHints,
+		minSize: config.MinSize,
+	}
+	if p.max <= 0 {
+		p.max = defaultMaxPeerHints
+	}
+	for _, rawURL := range config.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer URL %q: %v", rawURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid peer URL %q: must be an absolute HTTP or HTTPS URL", rawURL)
+		}
+		// The API paths are resolved under the path of the peer.
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		p.peers = append(p.peers, v2.NewURLBuilder(u, false))
+	}
+	return p, nil
+}
+
+// hints returns the URLs of a blob of a repository on the peers hinted
+// for it, the most preferred first.
+func (p *peerHints) hints(ref reference.Canonical) ([]string, error) {
+	type scored struct {
+		peer  *v2.URLBuilder
+		score uint64
+	}
+	candidates := make([]scored, 0, len(p.peers))
+	for _, peer := range p.peers {
+		candidates = append(candidates, scored{peer: peer, score: rendezvousScore(ref.Digest(), peer)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > p.max {
+		candidates = candidates[:p.max]
+	}
+
+	urls := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		blobURL, err := candidate.peer.BuildBlobURL(ref)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, blobURL)
+	}
+	return urls, nil
+}
+
+// setHeaders hints the peers of a blob in the response headers, unless
+// the blob is too small to be worth it.
+func (p *peerHints) setHeaders(h http.Header, ref reference.Canonical, size int64) error {
+	if size < p.minSize {
+		return nil
+	}
+	urls, err := p.hints(ref)
+	if err != nil {
+		return err
+	}
+	if len(urls) > 0 {
+		h.Set(peerHintsHeader, strings.Join(urls, ", "))
+	}
+	return nil
+}
+
+// rendezvousScore ranks a peer for a blob.
+func rendezvousScore(dgst digest.Digest, peer *v2.URLBuilder) uint64 {
+	base, _ := peer.BuildBaseURL()
+	sum := sha256.Sum256([]byte(dgst.String() + " " + base))
+	return binary.BigEndian.Uint64(sum[:8])
+}
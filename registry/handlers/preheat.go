@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultPreheatURLExpiry is how long signed blob URLs stay valid if the
+// configuration does not say.
+const defaultPreheatURLExpiry = 20 * time.Minute
+
+// preheater lists the blobs of images for peer-to-peer distribution
+// systems, such as Dragonfly or Kraken, preheating their caches.
+type preheater struct {
+	// signURLs is true if blob URLs are signed by the storage backend,
+	// which redirects must then be allowed to.
+	signURLs bool
+	expiry   time.Duration
+}
+
+func newPreheater(config configuration.AdminPreheat, signURLs bool) *preheater {
+	p := &preheater{
+		signURLs: signURLs,
+		expiry:   config.URLExpiry,
+	}
+	if p.expiry <= 0 {
+		p.expiry = defaultPreheatURLExpiry
+	}
+	return p
+}
+
+// preheatBlob is a blob to preheat.
+type preheatBlob struct {
+	MediaType string        `json:"mediaType,omitempty"`
+	Digest    digest.Digest `json:"digest"`
+	Size      int64         `json:"size"`
+	URL       string        `json:"url"`
+}
+
+// preheatResponse lists the blobs of an image to preheat.
+type preheatResponse struct {
+	Repository string        `json:"repository"`
+	Tag        string        `json:"tag,omitempty"`
+	Digest     digest.Digest `json:"digest"`
+	MediaType  string        `json:"mediaType"`
+	Blobs      []preheatBlob `json:"blobs"`
+}
+
+// preheatDispatcher constructs the handler listing the blobs to preheat
+// for a manifest.
+func preheatDispatcher(ctx *Context, r *http.Request) http.Handler {
+	preheatHandler := &preheatHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		preheatHandler.Tag = reference
+	} else {
+		preheatHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(preheatHandler.GetPreheat),
+	}
+}
+
+// preheatHandler handles requests for the blobs to preheat.
+type preheatHandler struct {
+	*Context
+
+	// One of tag or digest identifies the manifest.
+	Tag    string
+	Digest digest.Digest
+}
+
+// GetPreheat lists the blobs referenced by a manifest, or by the manifests
+// of an image index, in order, with the URLs they are downloaded from.
+func (ph *preheatHandler) GetPreheat(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(ph).Debug("GetPreheat")
+
+	if ph.App.preheater == nil {
+		ph.Errors = append(ph.Errors, errcode.ErrorCodeUnsupported.WithDetail("the preheat endpoint is not enabled"))
+		return
+	}
+
+	manifests, err := ph.Repository.Manifests(ph)
+	if err != nil {
+		ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if ph.Tag != "" {
+		desc, err := ph.Repository.Tags(ph).Get(ph, ph.Tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				ph.Errors = append(ph.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		ph.Digest = desc.Digest
+	}
+
+	manifest, err := manifests.Get(ph, ph.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			ph.Errors = append(ph.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else {
+			ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	mediaType, _, err := manifest.Payload()
+	if err != nil {
+		ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	var references []distribution.Descriptor
+	if _, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		for _, desc := range manifest.References() {
+			child, err := manifests.Get(ph, desc.Digest)
+			if err != nil {
+				if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+					ph.Errors = append(ph.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+				} else {
+					ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+				}
+				return
+			}
+			references = append(references, child.References()...)
+		}
+	} else {
+		references = manifest.References()
+	}
+
+	response := preheatResponse{
+		Repository: ph.Repository.Named().Name(),
+		Tag:        ph.Tag,
+		Digest:     ph.Digest,
+		MediaType:  mediaType,
+		Blobs:      []preheatBlob{},
+	}
+	blobs := ph.Repository.Blobs(ph)
+	expiry := time.Now().Add(ph.App.preheater.expiry)
+	seen := make(map[digest.Digest]struct{})
+	for _, desc := range references {
+		if _, ok := seen[desc.Digest]; ok {
+			continue
+		}
+		seen[desc.Digest] = struct{}{}
+		// Foreign layers are not stored in the registry.
+		if len(desc.URLs) > 0 {
+			continue
+		}
+		stat, err := blobs.Stat(ph, desc.Digest)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				ph.Errors = append(ph.Errors, v2.ErrorCodeBlobUnknown.WithDetail(desc.Digest))
+			} else {
+				ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		blobURL, err := ph.blobURL(stat.Digest, expiry)
+		if err != nil {
+			ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		response.Blobs = append(response.Blobs, preheatBlob{
+			MediaType: desc.MediaType,
+			Digest:    stat.Digest,
+			Size:      stat.Size,
+			URL:       blobURL,
+		})
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		ph.Errors = append(ph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.Header().Set("Docker-Content-Digest", ph.Digest.String())
+	w.Write(body)
+}
+
+// blobURL returns a signed URL of the storage backend from which a blob is
+// downloaded, or its URL in the registry if the backend cannot sign URLs.
+func (ph *preheatHandler) blobURL(dgst digest.Digest, expiry time.Time) (string, error) {
+	// The blobs of pull through caches may not be stored yet.
+	if ph.App.preheater.signURLs && !ph.App.isCache {
+		signedURL, err := storage.BlobURL(ph, ph.App.driver, dgst, expiry)
+		if err == nil {
+			return signedURL, nil
+		}
+		if !errors.As(err, &driver.ErrUnsupportedMethod{}) {
+			return "", err
+		}
+	}
+	ref, err := reference.WithDigest(ph.Repository.Named(), dgst)
+	if err != nil {
+		return "", err
+	}
+	return ph.urlBuilder.BuildBlobURL(ref)
+}
@@ -1,19 +1,26 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"path"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
 	"github.com/distribution/distribution/v3/manifest/ociartifact"
 	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/storage"
-	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go"
@@ -40,7 +47,8 @@ func referrersDispatcher(ctx *Context, r *http.Request) http.Handler {
 		Digest:  dgst,
 	}
 	return handlers.MethodHandler{
-		"GET": http.HandlerFunc(referrersHandler.GetReferrers),
+		"GET":  http.HandlerFunc(referrersHandler.GetReferrers),
+		"HEAD": http.HandlerFunc(referrersHandler.HeadReferrers),
 	}
 }
 
@@ -53,22 +61,47 @@ type referrersHandler struct {
 // GetReferrers fetches the list of referrers as an image index from the storage.
 func (h *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request) {
 	dcontext.GetLogger(h).Debug("GetReferrers")
+	defer observeReferrersRequest(r, time.Now())
 
 	if h.Digest == "" {
 		h.Errors = append(h.Errors, v2.ErrorCodeManifestUnknown.WithDetail("digest not specified"))
 		return
 	}
 
+	q := r.URL.Query()
+	filter := parseReferrersFilter(q)
 	var annotations map[string]string
-	var artifactTypeFilter string
-	if artifactTypeFilter = r.URL.Query().Get("artifactType"); artifactTypeFilter != "" {
+	if applied := filter.applied(); applied != "" {
 		annotations = map[string]string{
-			v1.AnnotationReferrersFiltersApplied: "artifactType",
+			v1.AnnotationReferrersFiltersApplied: applied,
 		}
 	}
-	referrers, err := h.generateReferrersList(h, h.Digest, artifactTypeFilter)
+
+	// do pagination if requested
+	var last digest.Digest
+	if lastEntry := q.Get("last"); lastEntry != "" {
+		dgst, err := digest.Parse(lastEntry)
+		if err != nil {
+			h.Errors = append(h.Errors, v2.ErrorCodeDigestInvalid.WithDetail(map[string]string{"last": lastEntry}))
+			return
+		}
+		last = dgst
+	}
+	maxEntries := -1
+	if n := q.Get("n"); n != "" {
+		var err error
+		maxEntries, err = strconv.Atoi(n)
+		if err != nil || maxEntries < 0 {
+			h.Errors = append(h.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(map[string]string{"n": n}))
+			return
+		}
+	}
+
+	referrers, skipped, more, err := h.listReferrers(h, h.Digest, filter, last, maxEntries)
 	if err != nil {
-		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+		if err == errUnknownLast {
+			h.Errors = append(h.Errors, v2.ErrorCodeDigestInvalid.WithMessage(err.Error()).WithDetail(map[string]string{"last": last.String()}))
+		} else if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
 			h.Errors = append(h.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
 		} else {
 			h.Errors = append(h.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
@@ -79,6 +112,7 @@ func (h *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request)
 	if referrers == nil {
 		referrers = []v1.Descriptor{}
 	}
+	referrersPages.WithValues(pageDepth(skipped, maxEntries)).Inc(1)
 
 	response := v1.Index{
 		Versioned:   specs.Versioned{SchemaVersion: 2},
@@ -87,160 +121,323 @@ func (h *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request)
 		Annotations: annotations,
 	}
 
-	w.Header().Set("Content-Type", v1.MediaTypeImageIndex)
-	enc := json.NewEncoder(w)
-	if err = enc.Encode(response); err != nil {
+	// Like for tags, no page is linked when n is zero.
+	var link string
+	if more && len(referrers) > 0 {
+		link = createReferrersLinkEntry(r.URL, maxEntries, referrers[len(referrers)-1].Digest)
+	}
+
+	var body bytes.Buffer
+	if err = json.NewEncoder(&body).Encode(response); err != nil {
 		h.Errors = append(h.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
+	// Clients polling for new referrers, such as policy controllers
+	// waiting for signatures, get a 304 while the page is unchanged.
+	etag := referrersETag(body.Bytes(), link)
+	w.Header().Set("Etag", fmt.Sprintf(`"%s"`, etag))
+	if etagMatch(r, etag.String()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if link != "" {
+		w.Header().Set("Link", link)
+	}
+	w.Header().Set("Content-Type", v1.MediaTypeImageIndex)
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	if _, err := body.WriteTo(w); err != nil {
+		dcontext.GetLogger(h).Errorf("error writing referrers: %v", err)
+	}
 }
 
-func (h *referrersHandler) generateReferrersList(ctx context.Context, subjectDigest digest.Digest, artifactType string) ([]v1.Descriptor, error) {
-	dcontext.GetLogger(ctx).Debug("(*referrersHandler).generateReferrersList")
+// referrersETag returns the entity tag of a page of referrers: the digest of
+// the referrers index and of the link to the next page, which changes when
+// referrers are added after a full page.
+func referrersETag(index []byte, link string) digest.Digest {
+	digester := digest.Canonical.Digester()
+	digester.Hash().Write(index)
+	digester.Hash().Write([]byte(link))
+	return digester.Digest()
+}
+
+// HeadReferrers counts the referrers of the subject by artifact type in the
+// OCI-Referrers-Count and OCI-Referrers-Summary headers, for clients such as
+// dashboards which do not need the referrers themselves. The filters of
+// GetReferrers apply.
+func (h *referrersHandler) HeadReferrers(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(h).Debug("HeadReferrers")
+	defer observeReferrersRequest(r, time.Now())
+
+	if h.Digest == "" {
+		h.Errors = append(h.Errors, v2.ErrorCodeManifestUnknown.WithDetail("digest not specified"))
+		return
+	}
+
+	summary, err := summarizeReferrers(h.Context, h.Digest, parseReferrersFilter(r.URL.Query()))
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			h.Errors = append(h.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else {
+			h.Errors = append(h.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	summary.setHeaders(w.Header())
+	w.Header().Set("Content-Type", v1.MediaTypeImageIndex)
+	w.WriteHeader(http.StatusOK)
+}
+
+// createReferrersLinkEntry returns the RFC5988 Link header of the next page
+// of referrers, keeping the filters of the request.
+func createReferrersLinkEntry(origURL *url.URL, maxEntries int, last digest.Digest) string {
+	calledURL := *origURL
+	v := calledURL.Query()
+	v.Set("n", strconv.Itoa(maxEntries))
+	v.Set("last", last.String())
+	calledURL.RawQuery = v.Encode()
+	calledURL.Fragment = ""
+	return fmt.Sprintf("<%s>; rel=\"next\"", calledURL.String())
+}
+
+// parseReferrersFilter returns the filter of the query of a referrers
+// request. artifactType may be repeated, or list artifact types separated by
+// commas.
+func parseReferrersFilter(q url.Values) referrersFilter {
+	filter := referrersFilter{
+		annotations: q["annotation"],
+	}
+	for _, artifactTypes := range q["artifactType"] {
+		for _, artifactType := range strings.Split(artifactTypes, ",") {
+			if artifactType = strings.TrimSpace(artifactType); artifactType != "" {
+				filter.artifactTypes = append(filter.artifactTypes, artifactType)
+			}
+		}
+	}
+	return filter
+}
+
+// referrersFilter selects the referrers listed by the referrers API.
+type referrersFilter struct {
+	// artifactTypes lists the artifact types of the referrers, any of
+	// which may match.
+	artifactTypes []string
+	// annotations lists the annotations a referrer must carry, as
+	// <key>=<value>, or as <key> alone to match any value.
+	annotations []string
+}
+
+// applied returns the value of the filters applied annotation, listing the
+// filters in use.
+func (f referrersFilter) applied() string {
+	var applied []string
+	if len(f.artifactTypes) > 0 {
+		applied = append(applied, "artifactType")
+	}
+	if len(f.annotations) > 0 {
+		applied = append(applied, "annotation")
+	}
+	return strings.Join(applied, ",")
+}
+
+// matches reports whether a referrer passes the filter.
+func (f referrersFilter) matches(referrer v1.Descriptor) bool {
+	if len(f.artifactTypes) > 0 {
+		var matched bool
+		for _, artifactType := range f.artifactTypes {
+			if referrer.ArtifactType == artifactType {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, annotation := range f.annotations {
+		key, value, hasValue := strings.Cut(annotation, "=")
+		actual, ok := referrer.Annotations[key]
+		if !ok || hasValue && actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// errUnknownLast is returned when the last referrer of the previous page is
+// no longer a referrer, so that the next page cannot be found.
+var errUnknownLast = errors.New("last referrer is no longer listed")
+
+// listReferrers lists the referrers of a subject which pass filter, in the
+// order of sortReferrers, starting after last, if set, up to maxEntries of
+// them unless it is negative. skipped is the number of referrers before the
+// page and more is true if referrers were left out after it.
+func (h *referrersHandler) listReferrers(ctx context.Context, subjectDigest digest.Digest, filter referrersFilter, last digest.Digest, maxEntries int) (referrers []v1.Descriptor, skipped int, more bool, err error) {
+	dcontext.GetLogger(ctx).Debug("(*referrersHandler).listReferrers")
 	repo := h.Repository
+	indexed, ok, err := storage.IndexedReferrers(ctx, h.registry, repo.Named().Name(), subjectDigest)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if ok {
+		for _, referrer := range indexed {
+			if filter.matches(referrer) {
+				referrers = append(referrers, referrer)
+			}
+		}
+		sortReferrers(referrers)
+		return pageReferrers(referrers, last, maxEntries)
+	}
+
 	manifests, err := repo.Manifests(ctx)
 	if err != nil {
-		return nil, err
+		return nil, 0, false, err
 	}
 	blobStatter := h.registry.BlobStatter()
-	rootPath := storage.GetReferrersSearchPath(repo.Named().Name(), subjectDigest)
-	var referrers []v1.Descriptor
+	links, err := storage.ReferrerLinksOfTypes(ctx, h.driver, h.registry, repo.Named().Name(), subjectDigest, filter.artifactTypes)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
 	err = enumerateReferrerLinks(ctx,
-		rootPath,
-		h.driver,
+		links,
 		blobStatter,
-		func(referrerDigest digest.Digest) error {
-			man, err := manifests.Get(ctx, referrerDigest)
+		func(desc distribution.Descriptor) error {
+			man, err := manifests.Get(ctx, desc.Digest)
 			if err != nil {
+				// A cached descriptor may outlive its manifest.
+				if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+					return nil
+				}
 				return err
 			}
+			var referrer v1.Descriptor
 			switch manifest := man.(type) {
 			case *ocischema.DeserializedManifest:
-				referrer, toAppend, err := generateReferrerFromImage(ctx, blobStatter, referrerDigest, manifest, artifactType)
-				if err != nil {
-					return err
-				}
-				if toAppend {
-					referrers = append(referrers, referrer)
-				}
-				return nil
+				referrer = generateReferrerFromImage(desc, manifest)
 			case *ociartifact.DeserializedManifest:
-				referrer, toAppend, err := generateReferrerFromArtifact(ctx, blobStatter, referrerDigest, manifest, artifactType)
-				if err != nil {
-					return err
-				}
-				if toAppend {
-					referrers = append(referrers, referrer)
-				}
-				return nil
+				referrer = generateReferrerFromArtifact(desc, manifest)
+			case *manifestlist.DeserializedManifestList:
+				referrer = generateReferrerFromIndex(desc, manifest)
 			default:
 				return nil
 			}
+			if filter.matches(referrer) {
+				referrers = append(referrers, referrer)
+			}
+			return nil
 		})
 	if err != nil {
-		switch err.(type) {
-		case driver.PathNotFoundError:
-			return nil, nil
-		}
-		return nil, err
+		return nil, 0, false, err
 	}
-	return referrers, nil
+	sortReferrers(referrers)
+	return pageReferrers(referrers, last, maxEntries)
 }
 
-func enumerateReferrerLinks(ctx context.Context,
-	rootPath string,
-	stDriver driver.StorageDriver,
-	blobstatter distribution.BlobStatter,
-	ingestor func(digest digest.Digest) error) error {
-
-	return stDriver.Walk(ctx, rootPath, func(fileInfo driver.FileInfo) error {
-		// exit early if directory...
-		if fileInfo.IsDir() {
-			return nil
+// sortReferrers sorts referrers newest first, by their
+// org.opencontainers.image.created annotation, then by digest. Referrers
+// without a valid created annotation come after the others. The order
+// does not depend on the storage, so that pages follow each other.
+func sortReferrers(referrers []v1.Descriptor) {
+	created := make(map[digest.Digest]time.Time, len(referrers))
+	for _, referrer := range referrers {
+		if t, err := time.Parse(time.RFC3339, referrer.Annotations[v1.AnnotationCreated]); err == nil {
+			created[referrer.Digest] = t
 		}
-		filePath := fileInfo.Path()
+	}
+	sort.SliceStable(referrers, func(i, j int) bool {
+		ti, tj := created[referrers[i].Digest], created[referrers[j].Digest]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return referrers[i].Digest < referrers[j].Digest
+	})
+}
 
-		// check if it's a link
-		_, fileName := path.Split(filePath)
-		if fileName != "link" {
-			return nil
+// pageReferrers returns the page of sorted referrers after last, if set, up
+// to maxEntries of them unless it is negative, and the number of referrers
+// before the page.
+func pageReferrers(referrers []v1.Descriptor, last digest.Digest, maxEntries int) ([]v1.Descriptor, int, bool, error) {
+	skipped := 0
+	if last != "" {
+		for skipped < len(referrers) && referrers[skipped].Digest != last {
+			skipped++
+		}
+		if skipped == len(referrers) {
+			return nil, 0, false, errUnknownLast
 		}
+		skipped++
+		referrers = referrers[skipped:]
+	}
+	if maxEntries >= 0 && len(referrers) > maxEntries {
+		return referrers[:maxEntries], skipped, true, nil
+	}
+	return referrers, skipped, false, nil
+}
 
-		// read the digest found in link
-		digest, err := readlink(ctx, filePath, stDriver)
-		if err != nil {
+// enumerateReferrerLinks calls ingestor with the descriptor of each linked
+// referrer. Sizes never change, so the descriptors come from the blob
+// descriptor cache when one is configured.
+func enumerateReferrerLinks(ctx context.Context,
+	links []digest.Digest,
+	blobstatter distribution.BlobStatter,
+	ingestor func(desc distribution.Descriptor) error) error {
+
+	for _, dgst := range links {
+		// the client may have gone away
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-
 		// ensure this conforms to the linkPathFns
-		_, err = blobstatter.Stat(ctx, digest)
+		desc, err := blobstatter.Stat(ctx, dgst)
 		if err != nil {
 			// we expect this error to occur so we move on
 			if err == distribution.ErrBlobUnknown {
-				return nil
+				continue
 			}
 			return err
 		}
 
-		return ingestor(digest)
-	})
+		if err := ingestor(desc); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func readlink(ctx context.Context, path string, stDriver driver.StorageDriver) (digest.Digest, error) {
-	content, err := stDriver.GetContent(ctx, path)
-	if err != nil {
-		return "", err
+func generateReferrerFromArtifact(desc distribution.Descriptor, man *ociartifact.DeserializedManifest) v1.Descriptor {
+	mediaType, _, _ := man.Payload()
+	return v1.Descriptor{
+		MediaType:    mediaType,
+		Size:         desc.Size,
+		Digest:       desc.Digest,
+		ArtifactType: man.ArtifactType,
+		Annotations:  man.Annotations,
 	}
+}
 
-	return digest.Parse(string(content))
+func generateReferrerFromImage(desc distribution.Descriptor, man *ocischema.DeserializedManifest) v1.Descriptor {
+	artifactType := man.Config.MediaType
+	if man.ArtifactType != "" {
+		artifactType = man.ArtifactType
+	}
+	mediaType, _, _ := man.Payload()
+	return v1.Descriptor{
+		MediaType:    mediaType,
+		Size:         desc.Size,
+		Digest:       desc.Digest,
+		ArtifactType: artifactType,
+		Annotations:  man.Annotations,
+	}
 }
 
-func generateReferrerFromArtifact(ctx context.Context,
-	blobStatter distribution.BlobStatter,
-	referrerDigest digest.Digest,
-	man *ociartifact.DeserializedManifest,
-	artifactType string) (v1.Descriptor, bool, error) {
-	extractedArtifactType := man.ArtifactType
-	// filtering by artifact type or bypass if no artifact type specified
-	if artifactType == "" || extractedArtifactType == artifactType {
-		desc, err := blobStatter.Stat(ctx, referrerDigest)
-		if err != nil {
-			return v1.Descriptor{}, false, err
-		}
-		desc.MediaType, _, _ = man.Payload()
-		artifactDesc := v1.Descriptor{
-			MediaType:    desc.MediaType,
-			Size:         desc.Size,
-			Digest:       desc.Digest,
-			ArtifactType: extractedArtifactType,
-			Annotations:  man.Annotations,
-		}
-		return artifactDesc, true, nil
-	}
-	return v1.Descriptor{}, false, nil
-}
-
-func generateReferrerFromImage(ctx context.Context,
-	blobStatter distribution.BlobStatter,
-	referrerDigest digest.Digest,
-	man *ocischema.DeserializedManifest,
-	configMediaType string) (v1.Descriptor, bool, error) {
-	extractedConfigMediaType := man.Config.MediaType
-	// filtering by artifact type or bypass if no artifact type specified
-	if configMediaType == "" || extractedConfigMediaType == configMediaType {
-		desc, err := blobStatter.Stat(ctx, referrerDigest)
-		if err != nil {
-			return v1.Descriptor{}, false, err
-		}
-		desc.MediaType, _, _ = man.Payload()
-		imageDesc := v1.Descriptor{
-			MediaType:    desc.MediaType,
-			Size:         desc.Size,
-			Digest:       desc.Digest,
-			ArtifactType: extractedConfigMediaType,
-			Annotations:  man.Annotations,
-		}
-		return imageDesc, true, nil
+func generateReferrerFromIndex(desc distribution.Descriptor, man *manifestlist.DeserializedManifestList) v1.Descriptor {
+	mediaType, _, _ := man.Payload()
+	return v1.Descriptor{
+		MediaType:    mediaType,
+		Size:         desc.Size,
+		Digest:       desc.Digest,
+		ArtifactType: man.ArtifactType,
+		Annotations:  man.Annotations,
 	}
-	return v1.Descriptor{}, false, nil
 }
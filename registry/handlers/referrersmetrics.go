@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/docker/go-metrics"
+)
+
+var (
+	// referrersNamespace is the namespace of the metrics of the referrers
+	// API, registry_extension_referrers.
+	referrersNamespace = prometheus.ExtensionNamespace("referrers")
+
+	referrersRequests = referrersNamespace.NewLabeledCounter("requests", "The number of requests listing or counting referrers", "method")
+	referrersDuration = referrersNamespace.NewLabeledTimer("request_duration", "The time taken to list or count referrers", "method")
+
+	// referrersPages counts the pages of referrers served by how deep into
+	// the listing they are, so that clients walking long lists of
+	// referrers page by page show up.
+	referrersPages = referrersNamespace.NewLabeledCounter("pages", "The number of pages of referrers served, by page depth", "depth")
+)
+
+func init() {
+	metrics.Register(referrersNamespace)
+}
+
+// observeReferrersRequest records a request to the referrers API which
+// started at start in the metrics.
+func observeReferrersRequest(r *http.Request, start time.Time) {
+	referrersRequests.WithValues(r.Method).Inc(1)
+	referrersDuration.WithValues(r.Method).UpdateSince(start)
+}
+
+// pageDepth returns the depth label of the page of maxEntries referrers
+// after skipped others: the page number up to 3, then 4-10 and 11+, to bound
+// the number of series. Unpaginated listings are a single page.
+func pageDepth(skipped, maxEntries int) string {
+	depth := 1
+	if maxEntries > 0 {
+		depth += skipped / maxEntries
+	}
+	switch {
+	case depth <= 3:
+		return strconv.Itoa(depth)
+	case depth <= 10:
+		return "4-10"
+	default:
+		return "11+"
+	}
+}
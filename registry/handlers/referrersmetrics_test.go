@@ -0,0 +1,24 @@
+package handlers
+
+import "testing"
+
+func TestPageDepth(t *testing.T) {
+	for _, tc := range []struct {
+		skipped, maxEntries int
+		expected            string
+	}{
+		{0, -1, "1"},
+		{0, 0, "1"},
+		{0, 10, "1"},
+		{9, 10, "1"},
+		{10, 10, "2"},
+		{25, 10, "3"},
+		{30, 10, "4-10"},
+		{99, 10, "4-10"},
+		{100, 10, "11+"},
+	} {
+		if depth := pageDepth(tc.skipped, tc.maxEntries); depth != tc.expected {
+			t.Errorf("unexpected depth of a page of %d after %d referrers: %s, expected %s", tc.maxEntries, tc.skipped, depth, tc.expected)
+		}
+	}
+}
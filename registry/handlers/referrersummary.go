@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Headers summarizing the referrers of a manifest.
+const (
+	referrersCountHeader   = "OCI-Referrers-Count"
+	referrersSummaryHeader = "OCI-Referrers-Summary"
+)
+
+const (
+	// defaultReferrerSummaryTTL is how long summaries are cached if the
+	// configuration does not say.
+	defaultReferrerSummaryTTL = 30 * time.Second
+	// maxReferrerSummaries bounds the number of cached summaries.
+	maxReferrerSummaries = 10000
+)
+
+// referrerSummary counts the referrers of a subject by artifact type.
+type referrerSummary map[string]int
+
+// setHeaders sets the referrer headers of a manifest response.
+func (s referrerSummary) setHeaders(h http.Header) {
+	var count int
+	types := make([]string, 0, len(s))
+	for artifactType, n := range s {
+		count += n
+		types = append(types, artifactType)
+	}
+	sort.Strings(types)
+
+	h.Set(referrersCountHeader, strconv.Itoa(count))
+	if len(types) == 0 {
+		return
+	}
+	parts := make([]string, 0, len(types))
+	for _, artifactType := range types {
+		parts = append(parts, fmt.Sprintf("%s=%d", artifactType, s[artifactType]))
+	}
+	h.Set(referrersSummaryHeader, strings.Join(parts, ", "))
+}
+
+// summarizeReferrers counts the referrers of a subject which pass filter by
+// artifact type. Unfiltered summaries are cached if referrer headers are
+// enabled.
+func summarizeReferrers(ctx *Context, subject digest.Digest, filter referrersFilter) (referrerSummary, error) {
+	cache := ctx.App.referrerSummaries
+	unfiltered := len(filter.artifactTypes) == 0 && len(filter.annotations) == 0
+	repo := ctx.Repository.Named().Name()
+	if cache != nil && unfiltered {
+		if summary, ok := cache.get(repo, subject); ok {
+			return summary, nil
+		}
+	}
+
+	referrers, _, _, err := (&referrersHandler{Context: ctx}).listReferrers(ctx, subject, filter, "", -1)
+	if err != nil {
+		return nil, err
+	}
+	summary := make(referrerSummary)
+	for _, referrer := range referrers {
+		summary[referrer.ArtifactType]++
+	}
+	if cache != nil && unfiltered {
+		cache.put(repo, subject, summary)
+	}
+	return summary, nil
+}
+
+// referrerSummaryCache caches the referrer summaries of subjects, as
+// computing one walks the referrers index of the subject.
+type referrerSummaryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]referrerSummaryEntry
+}
+
+type referrerSummaryEntry struct {
+	summary referrerSummary
+	expires time.Time
+}
+
+func newReferrerSummaryCache(ttl time.Duration) *referrerSummaryCache {
+	if ttl <= 0 {
+		ttl = defaultReferrerSummaryTTL
+	}
+	return &referrerSummaryCache{
+		ttl:     ttl,
+		entries: make(map[string]referrerSummaryEntry),
+	}
+}
+
+func referrerSummaryKey(repo string, subject digest.Digest) string {
+	return repo + "@" + subject.String()
+}
+
+// get returns the cached summary of a subject, if it has not expired.
+func (c *referrerSummaryCache) get(repo string, subject digest.Digest) (referrerSummary, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[referrerSummaryKey(repo, subject)]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.summary, true
+}
+
+// put caches the summary of a subject.
+func (c *referrerSummaryCache) put(repo string, subject digest.Digest, summary referrerSummary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxReferrerSummaries {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxReferrerSummaries {
+			c.entries = make(map[string]referrerSummaryEntry)
+		}
+	}
+	c.entries[referrerSummaryKey(repo, subject)] = referrerSummaryEntry{summary: summary, expires: now.Add(c.ttl)}
+}
+
+// invalidate drops the cached summary of a subject, once a referrer of it
+// is pushed.
+func (c *referrerSummaryCache) invalidate(repo string, subject digest.Digest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, referrerSummaryKey(repo, subject))
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/share"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// defaultShareExpiry is how long share links last if the request does
+	// not say.
+	defaultShareExpiry = 24 * time.Hour
+
+	// defaultMaxShareExpiry bounds the lifetime of share links if the
+	// configuration does not say.
+	defaultMaxShareExpiry = 7 * 24 * time.Hour
+
+	// maxShareRequestSize bounds the body of share link requests.
+	maxShareRequestSize = 4096
+
+	// shareQueryParameter is the query parameter carrying the token of a
+	// share link.
+	shareQueryParameter = "share"
+)
+
+// shareRequest is the body of a request issuing a share link.
+type shareRequest struct {
+	Expiry string `json:"expiry"`
+	Once   bool   `json:"once"`
+}
+
+// shareResponse is a share link issued for a manifest.
+type shareResponse struct {
+	Token   string        `json:"token"`
+	Digest  digest.Digest `json:"digest"`
+	Expires time.Time     `json:"expires"`
+	Once    bool          `json:"once,omitempty"`
+	URL     string        `json:"url"`
+}
+
+// shareDispatcher constructs the handler issuing share links.
+func shareDispatcher(ctx *Context, r *http.Request) http.Handler {
+	shareHandler := &shareHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		shareHandler.Tag = reference
+	} else {
+		shareHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"POST": http.HandlerFunc(shareHandler.IssueShareLink),
+	}
+}
+
+// shareHandler handles requests to issue share links.
+type shareHandler struct {
+	*Context
+
+	// One of tag or digest identifies the shared manifest.
+	Tag    string
+	Digest digest.Digest
+}
+
+// IssueShareLink signs a share link for a manifest, with the options given
+// in the request body.
+func (sh *shareHandler) IssueShareLink(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(sh).Debug("IssueShareLink")
+
+	if sh.App.shareSigner == nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnsupported.WithDetail("share links are not enabled"))
+		return
+	}
+
+	var req shareRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxShareRequestSize)).Decode(&req); err != nil && err != io.EOF {
+		sh.Errors = append(sh.Errors, v2.ErrorCodeShareRequestInvalid.WithDetail(err.Error()))
+		return
+	}
+	expiry := defaultShareExpiry
+	if req.Expiry != "" {
+		var err error
+		expiry, err = time.ParseDuration(req.Expiry)
+		if err != nil || expiry <= 0 {
+			sh.Errors = append(sh.Errors, v2.ErrorCodeShareRequestInvalid.WithDetail(fmt.Sprintf("invalid share link expiry %q", req.Expiry)))
+			return
+		}
+	}
+	maxExpiry := sh.App.Config.Share.MaxExpiry
+	if maxExpiry <= 0 {
+		maxExpiry = defaultMaxShareExpiry
+	}
+	if expiry > maxExpiry {
+		sh.Errors = append(sh.Errors, v2.ErrorCodeShareRequestInvalid.WithDetail(fmt.Sprintf("share links may not last more than %v", maxExpiry)))
+		return
+	}
+
+	if sh.Tag != "" {
+		desc, err := sh.Repository.Tags(sh).Get(sh, sh.Tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				sh.Errors = append(sh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		sh.Digest = desc.Digest
+	}
+	manifests, err := sh.Repository.Manifests(sh)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	exists, err := manifests.Exists(sh, sh.Digest)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	if !exists {
+		sh.Errors = append(sh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(sh.Digest))
+		return
+	}
+
+	link := share.Link{
+		ID:         uuid.Generate().String(),
+		Repository: sh.Repository.Named().Name(),
+		Digest:     sh.Digest,
+		Expires:    time.Now().Add(expiry).UTC(),
+		Once:       req.Once,
+	}
+	token, err := sh.App.shareSigner.Sign(link)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	ref, err := reference.WithDigest(sh.Repository.Named(), sh.Digest)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	manifestURL, err := sh.urlBuilder.BuildManifestURL(ref)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	manifestURL += "?" + url.Values{shareQueryParameter: []string{token}}.Encode()
+
+	dcontext.GetLogger(sh).Infof("issued share link %s for %s until %v", link.ID, ref, link.Expires)
+
+	body, err := json.Marshal(shareResponse{
+		Token:   token,
+		Digest:  link.Digest,
+		Expires: link.Expires,
+		Once:    link.Once,
+		URL:     manifestURL,
+	})
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+}
+
+// shareLink returns the share link carried by a request, nil if it carries
+// none, or an error if the link does not grant the request.
+func (app *App) shareLink(ctx *Context, r *http.Request) (*share.Link, error) {
+	if app.shareSigner == nil {
+		return nil, nil
+	}
+	token := r.URL.Query().Get(shareQueryParameter)
+	if token == "" {
+		return nil, nil
+	}
+
+	link, err := app.shareSigner.Verify(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return nil, errors.New("share links only grant pulls")
+	}
+	if route := mux.CurrentRoute(r); route == nil || (route.GetName() != v2.RouteNameManifest && route.GetName() != v2.RouteNameBlob) {
+		return nil, errors.New("share links only grant access to manifests and blobs")
+	}
+	if getName(ctx) != link.Repository {
+		return nil, errors.New("share link is for another repository")
+	}
+	return &link, nil
+}
+
+// checkShared returns an error unless the manifest or blob requested is the
+// manifest of a share link or content it references. The first fetch of the
+// manifest of a pull-once link uses up the link.
+func (app *App) checkShared(ctx *Context, r *http.Request, link *share.Link) error {
+	var dgst digest.Digest
+	if mux.CurrentRoute(r).GetName() == v2.RouteNameManifest {
+		var err error
+		dgst, err = digest.Parse(getReference(ctx))
+		if err != nil {
+			return errors.New("share links only grant access to manifests by digest")
+		}
+	} else {
+		var err error
+		dgst, err = getDigest(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if dgst == link.Digest {
+		if link.Once && r.Method == http.MethodGet {
+			first, err := storage.UseShareLink(ctx, app.driver, link.ID)
+			if err != nil {
+				return err
+			}
+			if !first {
+				return errors.New("share link already used")
+			}
+		}
+		return nil
+	}
+
+	manifests, err := ctx.Repository.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	visited := make(map[digest.Digest]struct{})
+	pending := []digest.Digest{link.Digest}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if _, ok := visited[current]; ok {
+			continue
+		}
+		visited[current] = struct{}{}
+
+		manifest, err := manifests.Get(ctx, current)
+		if err != nil {
+			return err
+		}
+		for _, desc := range manifest.References() {
+			if desc.Digest == dgst {
+				return nil
+			}
+			// Follow the manifests of indexes.
+			if exists, err := manifests.Exists(ctx, desc.Digest); err != nil {
+				return err
+			} else if exists {
+				pending = append(pending, desc.Digest)
+			}
+		}
+	}
+	return fmt.Errorf("%s is not shared", dgst)
+}
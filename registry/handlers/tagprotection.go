@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/notifications"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+// auditTagProtected returns the function auditing the attempts of a request
+// to create or move the protected tags of repo: they are logged, and
+// notified as tag.protected events.
+func auditTagProtected(repo reference.Named, listener notifications.Listener) func(context.Context, distribution.ErrTagProtected, distribution.Descriptor) {
+	return func(ctx context.Context, err distribution.ErrTagProtected, desc distribution.Descriptor) {
+		dcontext.GetLoggerWithFields(ctx, map[interface{}]interface{}{
+			"audit":   notifications.EventActionTagProtected,
+			"tag":     err.Tag,
+			"pattern": err.Pattern,
+			"digest":  desc.Digest,
+		}, auth.UserNameKey).Warn("refused to create or move a protected tag")
+
+		if policyListener, ok := listener.(notifications.PolicyListener); ok {
+			if err := policyListener.TagProtected(repo, err.Tag, desc); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error dispatching tag.protected event: %v", err)
+			}
+		}
+	}
+}
+
+// tagError returns the API error of a failure to tag a manifest.
+func tagError(err error) error {
+	var protected distribution.ErrTagProtected
+	if errors.As(err, &protected) {
+		return v2.ErrorCodeTagProtected.WithDetail(map[string]string{"tag": protected.Tag, "pattern": protected.Pattern})
+	}
+	return errcode.ErrorCodeUnknown.WithDetail(err)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultTimelineEntries is the number of events returned by the timeline
+// endpoint unless the request sets n.
+const defaultTimelineEntries = 100
+
+// timelineDispatcher constructs the handler listing the recent events of a
+// repository.
+func timelineDispatcher(ctx *Context, r *http.Request) http.Handler {
+	timelineHandler := &timelineHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(timelineHandler.GetTimeline),
+	}
+}
+
+// timelineHandler handles requests for the timeline of a repository.
+type timelineHandler struct {
+	*Context
+}
+
+// timelineResponse is the body of timeline responses.
+type timelineResponse struct {
+	Repository string                  `json:"repository"`
+	Events     []storage.TimelineEvent `json:"events"`
+}
+
+// GetTimeline returns the most recent events of the repository, optionally
+// those of a single tag.
+func (th *timelineHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(th).Debug("GetTimeline")
+
+	if th.App.timeline == nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported.WithDetail("the timeline endpoint is not enabled"))
+		return
+	}
+
+	q := r.URL.Query()
+	entries := defaultTimelineEntries
+	if n := q.Get("n"); n != "" {
+		var err error
+		entries, err = strconv.Atoi(n)
+		if err != nil || entries <= 0 {
+			th.Errors = append(th.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(map[string]string{"n": n}))
+			return
+		}
+	}
+
+	events, err := th.App.timeline.Events(th, th.Repository.Named().Name(), q.Get("tag"), entries)
+	if err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	body, err := json.Marshal(timelineResponse{
+		Repository: th.Repository.Named().Name(),
+		Events:     events,
+	})
+	if err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.Write(body)
+}
+
+// isManifestWrite returns true if the request pushes or deletes a manifest
+// or tag, including the manifests built by the registry from indexes and
+// annotations.
+func isManifestWrite(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	switch route.GetName() {
+	case v2.RouteNameManifest:
+		return r.Method == http.MethodPut || r.Method == http.MethodDelete
+	case v2.RouteNameIndex:
+		return r.Method == http.MethodPost
+	case v2.RouteNameIndexUpdate, v2.RouteNameAnnotations:
+		return r.Method == http.MethodPatch
+	}
+	return false
+}
+
+// isManifestRoute returns true if the manifest or tag written by the request
+// is the reference of its URL, rather than a tag named in its body.
+func isManifestRoute(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	return route != nil && route.GetName() == v2.RouteNameManifest
+}
+
+// taggedManifest returns the manifest the tag pushed or deleted by the
+// request points at, if any. The manifests built by the registry look up
+// the tag they are pushed to themselves, in storeManifest.
+func (app *App) taggedManifest(ctx *Context, r *http.Request) digest.Digest {
+	if !isManifestWrite(r) || !isManifestRoute(r) || ctx.Repository == nil {
+		return ""
+	}
+	tag := getReference(ctx)
+	if _, err := digest.Parse(tag); err == nil {
+		return ""
+	}
+	desc, err := ctx.Repository.Tags(ctx).Get(ctx, tag)
+	if err != nil {
+		return ""
+	}
+	return desc.Digest
+}
+
+// recordTimeline records the push or deletion of a manifest or tag in the
+// timeline of its repository once the request is served, or its rejection
+// by a policy of the registry. previous is the manifest the tag pointed at
+// before the request. Other failed requests are not recorded.
+func (app *App) recordTimeline(ctx *Context, r *http.Request, dgst string, previous digest.Digest) {
+	if app.timeline == nil || !isManifestWrite(r) {
+		return
+	}
+
+	event := storage.TimelineEvent{
+		Timestamp: time.Now().UTC(),
+		Actor:     dcontext.GetStringValue(ctx, auth.UserNameKey),
+	}
+	if isManifestRoute(r) {
+		reference := getReference(ctx)
+		if parsed, err := digest.Parse(reference); err == nil {
+			event.Digest = parsed
+		} else {
+			event.Tag = reference
+		}
+	} else {
+		event.Tag = ctx.storedTag
+		previous = ctx.storedPrevious
+	}
+
+	if ctx.Errors.Len() > 0 {
+		reason, denied := deniedReason(ctx.Errors)
+		if !denied {
+			return
+		}
+		event.Action = storage.TimelineRejected
+		event.Reason = reason
+	} else if r.Method == http.MethodDelete {
+		event.Action = storage.TimelineDelete
+		if event.Tag != "" {
+			event.Digest = previous
+		}
+	} else {
+		event.Action = storage.TimelinePush
+		event.Digest = digest.Digest(dgst)
+		if previous != "" && previous != event.Digest {
+			event.Action = storage.TimelineTagMove
+			event.Previous = previous
+		}
+	}
+
+	if err := app.timeline.Record(ctx, getName(ctx), event); err != nil {
+		dcontext.GetLogger(ctx).Warnf("failed to record %s event in the timeline: %v", event.Action, err)
+	}
+}
+
+// deniedReason returns the reason of the first DENIED or TAG_PROTECTED error
+// of errs, which the policies of the registry return when they refuse a
+// request.
+func deniedReason(errs errcode.Errors) (string, bool) {
+	for _, err := range errs {
+		switch err := err.(type) {
+		case errcode.Error:
+			if err.Code == v2.ErrorCodeTagProtected {
+				return err.Error(), true
+			}
+			if err.Code != errcode.ErrorCodeDenied {
+				continue
+			}
+			if detail, ok := err.Detail.(string); ok && detail != "" {
+				return detail, true
+			}
+			return err.Message, true
+		case errcode.ErrorCode:
+			if err == errcode.ErrorCodeDenied {
+				return err.Message(), true
+			}
+		}
+	}
+	return "", false
+}
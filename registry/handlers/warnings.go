@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+// maxWarningLength bounds the text of a warning, as required by the OCI
+// distribution specification.
+const maxWarningLength = 4096
+
+// schema1Warning is attached to responses serving or accepting schema1
+// manifests, if enabled.
+const schema1Warning = "schema1 manifests are deprecated and will stop being supported; push images as OCI or schema2 manifests"
+
+// warningQuoter escapes the text of a warning as an HTTP quoted-string.
+var warningQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// warningNotice is a notice of policy.warnings.
+type warningNotice struct {
+	repositories []*regexp.Regexp
+	methods      map[string]struct{}
+	message      string
+}
+
+// newWarningNotices parses the notices of the warnings configuration.
+func newWarningNotices(config []configuration.WarningNotice) ([]warningNotice, error) {
+	notices := make([]warningNotice, 0, len(config))
+	for _, c := range config {
+		if c.Message == "" {
+			return nil, fmt.Errorf("warning notice without a message")
+		}
+		if len(c.Message) > maxWarningLength {
+			return nil, fmt.Errorf("warning notice longer than %d characters", maxWarningLength)
+		}
+		n := warningNotice{message: c.Message}
+		for _, expr := range c.Repositories {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid warning notice repository %q: %v", expr, err)
+			}
+			n.repositories = append(n.repositories, re)
+		}
+		if len(c.Methods) > 0 {
+			n.methods = make(map[string]struct{}, len(c.Methods))
+			for _, method := range c.Methods {
+				n.methods[strings.ToUpper(method)] = struct{}{}
+			}
+		}
+		notices = append(notices, n)
+	}
+	return notices, nil
+}
+
+// applies reports whether the notice is attached to requests of method to
+// the named repository.
+func (n warningNotice) applies(name, method string) bool {
+	if n.methods != nil {
+		if _, ok := n.methods[method]; !ok {
+			return false
+		}
+	}
+	if len(n.repositories) == 0 {
+		return true
+	}
+	for _, re := range n.repositories {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// warn records a warning to attach to the response, should the request
+// succeed. It must be called before the response is started.
+func (ctx *Context) warn(text string) {
+	for _, warning := range ctx.warnings {
+		if warning == text {
+			return
+		}
+	}
+	ctx.warnings = append(ctx.warnings, text)
+}
+
+// warningResponseWriter attaches the warnings recorded on a context to the
+// response, as Warning headers, unless it reports an error.
+type warningResponseWriter struct {
+	http.ResponseWriter
+	ctx         *Context
+	wroteHeader bool
+}
+
+func (w *warningResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < http.StatusBadRequest {
+			for _, warning := range w.ctx.warnings {
+				w.Header().Add("Warning", fmt.Sprintf(`299 - "%s"`, warningQuoter.Replace(warning)))
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *warningResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ociartifact"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+// InspectCmd is the cobra command that corresponds to the inspect
+// subcommand
+var InspectCmd = &cobra.Command{
+	Use:   "inspect <config> <repository> <tag or digest>",
+	Short: "`inspect` prints a manifest, its tags and its referrers read from the storage",
+	Long:  "`inspect` prints a manifest of a repository, its media type, references, the tags pointing at it and the tree of its referrers, read from the storage rather than through the API",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		named, err := reference.WithName(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name %q: %v\n", args[1], err)
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct repository: %v", err)
+			os.Exit(1)
+		}
+
+		inspection, err := inspect(ctx, repository, args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to inspect %s: %v\n", args[2], err)
+			os.Exit(1)
+		}
+		printInspection(os.Stdout, inspection)
+	},
+}
+
+// inspection is what inspect finds out about a manifest.
+type inspection struct {
+	repository string
+	digest     digest.Digest
+	mediaType  string
+	payload    []byte
+	references []distribution.Descriptor
+	tags       []string
+	referrers  []inspectedReferrer
+}
+
+// inspectedReferrer is a node of the referrers tree of a manifest.
+type inspectedReferrer struct {
+	digest       digest.Digest
+	artifactType string
+	referrers    []inspectedReferrer
+}
+
+// inspect reads the manifest identified by a tag or digest, along with the
+// tags pointing at it and its referrers, recursively.
+func inspect(ctx context.Context, repository distribution.Repository, ref string) (*inspection, error) {
+	tags := repository.Tags(ctx)
+	dgst, err := digest.Parse(ref)
+	if err != nil {
+		desc, err := tags.Get(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		dgst = desc.Digest
+	}
+
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := manifests.Get(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return nil, err
+	}
+	tagged, err := tags.Lookup(ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up tags: %v", err)
+	}
+
+	i := &inspection{
+		repository: repository.Named().Name(),
+		digest:     dgst,
+		mediaType:  mediaType,
+		payload:    payload,
+		references: manifest.References(),
+		tags:       tagged,
+	}
+	if lister, ok := repository.(distribution.ReferrersLister); ok {
+		visited := map[digest.Digest]struct{}{dgst: {}}
+		i.referrers, err = inspectReferrers(ctx, lister, manifests, dgst, visited)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list referrers: %v", err)
+		}
+	}
+	return i, nil
+}
+
+// inspectReferrers returns the tree of the referrers of subject. visited
+// guards against referrers which refer to each other.
+func inspectReferrers(ctx context.Context, lister distribution.ReferrersLister, manifests distribution.ManifestService, subject digest.Digest, visited map[digest.Digest]struct{}) ([]inspectedReferrer, error) {
+	descs, err := lister.Referrers(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	var referrers []inspectedReferrer
+	for _, desc := range descs {
+		if _, ok := visited[desc.Digest]; ok {
+			continue
+		}
+		visited[desc.Digest] = struct{}{}
+		referrer := inspectedReferrer{digest: desc.Digest}
+		man, err := manifests.Get(ctx, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		switch m := man.(type) {
+		case *ocischema.DeserializedManifest:
+			referrer.artifactType = m.ArtifactType
+			if referrer.artifactType == "" {
+				referrer.artifactType = m.Config.MediaType
+			}
+		case *ociartifact.DeserializedManifest:
+			referrer.artifactType = m.ArtifactType
+		case *manifestlist.DeserializedManifestList:
+			referrer.artifactType = m.ArtifactType
+		}
+		referrer.referrers, err = inspectReferrers(ctx, lister, manifests, desc.Digest, visited)
+		if err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, referrer)
+	}
+	return referrers, nil
+}
+
+func printInspection(w io.Writer, i *inspection) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	tags := "-"
+	if len(i.tags) > 0 {
+		tags = strings.Join(i.tags, ", ")
+	}
+	fmt.Fprintf(tw, "REPOSITORY\t%s\n", i.repository)
+	fmt.Fprintf(tw, "DIGEST\t%s\n", i.digest)
+	fmt.Fprintf(tw, "MEDIA TYPE\t%s\n", i.mediaType)
+	fmt.Fprintf(tw, "SIZE\t%d\n", len(i.payload))
+	fmt.Fprintf(tw, "TAGS\t%s\n", tags)
+
+	fmt.Fprintln(tw, "\nREFERENCES\tMEDIA TYPE\tSIZE")
+	for _, desc := range i.references {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", desc.Digest, desc.MediaType, desc.Size)
+	}
+
+	fmt.Fprintln(tw, "\nREFERRERS\tARTIFACT TYPE")
+	var printReferrers func(referrers []inspectedReferrer, depth int)
+	printReferrers = func(referrers []inspectedReferrer, depth int) {
+		for _, referrer := range referrers {
+			fmt.Fprintf(tw, "%s%s\t%s\n", strings.Repeat("  ", depth), referrer.digest, referrer.artifactType)
+			printReferrers(referrer.referrers, depth+1)
+		}
+	}
+	printReferrers(i.referrers, 0)
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nMANIFEST")
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, i.payload, "", "   "); err != nil {
+		w.Write(i.payload)
+	} else {
+		indented.WriteTo(w)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestInspect(t *testing.T) {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, _ := reference.WithName("foo/inspected")
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(subject *distribution.Descriptor, artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repository.Blobs(ctx), []byte("{}"), subject, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		manifest, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := manifests.Put(ctx, manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dgst
+	}
+	image := push(nil, "")
+	for _, tag := range []string{"latest", "v1"} {
+		if err := repository.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: image}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signature := push(&distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: image}, "application/vnd.example.signature")
+	countersignature := push(&distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: signature}, "application/vnd.example.countersignature")
+
+	i, err := inspect(ctx, repository, "latest")
+	if err != nil {
+		t.Fatalf("failed to inspect: %v", err)
+	}
+	if i.digest != image || i.mediaType != v1.MediaTypeImageManifest || len(i.references) != 1 {
+		t.Fatalf("unexpected inspection %+v", i)
+	}
+	if strings.Join(i.tags, ",") != "latest,v1" {
+		t.Fatalf("unexpected tags %v", i.tags)
+	}
+	if len(i.referrers) != 1 || i.referrers[0].digest != signature || i.referrers[0].artifactType != "application/vnd.example.signature" ||
+		len(i.referrers[0].referrers) != 1 || i.referrers[0].referrers[0].digest != countersignature {
+		t.Fatalf("unexpected referrers %+v", i.referrers)
+	}
+
+	var out bytes.Buffer
+	printInspection(&out, i)
+	for _, s := range []string{
+		"TAGS        latest, v1\n",
+		"\n" + signature.String() + "    application/vnd.example.signature\n",
+		"\n  " + countersignature.String() + "  application/vnd.example.countersignature\n",
+		"\"schemaVersion\": 2",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("missing %q in output:\n%s", s, out.String())
+		}
+	}
+
+	// Referrers are inspected by digest.
+	i, err = inspect(ctx, repository, signature.String())
+	if err != nil {
+		t.Fatalf("failed to inspect: %v", err)
+	}
+	if len(i.tags) != 0 || len(i.referrers) != 1 {
+		t.Fatalf("unexpected inspection %+v", i)
+	}
+
+	if _, err := inspect(ctx, repository, "missing"); err == nil {
+		t.Fatal("expected inspecting an unknown tag to fail")
+	}
+}
@@ -0,0 +1,174 @@
+// Package ipfilter implements the network rules configured under
+// policy.network, which restrict the client addresses allowed to access
+// repositories regardless of their credentials.
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+// Rule restricts the client addresses which may access the matching
+// repositories.
+type Rule struct {
+	repositories []*regexp.Regexp
+	allow        []*net.IPNet
+	deny         []*net.IPNet
+}
+
+// Filter is a set of network rules.
+type Filter struct {
+	rules          []*Rule
+	trustedProxies []*net.IPNet
+}
+
+// New parses the network rules of a registry configuration.
+func New(config configuration.Network) (*Filter, error) {
+	f := &Filter{}
+	for _, c := range config.Rules {
+		rule, err := NewRule(c)
+		if err != nil {
+			return nil, err
+		}
+		f.rules = append(f.rules, rule)
+	}
+
+	var err error
+	f.trustedProxies, err = parseNets(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %v", err)
+	}
+	return f, nil
+}
+
+// NewRule parses a single network rule.
+func NewRule(config configuration.NetworkRule) (*Rule, error) {
+	rule := &Rule{}
+	for _, expr := range config.Repositories {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid network rule repository %q: %v", expr, err)
+		}
+		rule.repositories = append(rule.repositories, re)
+	}
+
+	var err error
+	if rule.allow, err = parseNets(config.Allow); err != nil {
+		return nil, fmt.Errorf("invalid network rule: %v", err)
+	}
+	if rule.deny, err = parseNets(config.Deny); err != nil {
+		return nil, fmt.Errorf("invalid network rule: %v", err)
+	}
+	return rule, nil
+}
+
+// parseNets parses addresses in CIDR notation. Bare IP addresses match
+// themselves only.
+func parseNets(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies reports whether the rule covers the named repository.
+func (r *Rule) Applies(name string) bool {
+	if len(r.repositories) == 0 {
+		return true
+	}
+	for _, re := range r.repositories {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the rule lets the client at ip through.
+func (r *Rule) Allows(ip net.IP) bool {
+	if ip == nil {
+		return len(r.allow) == 0 && len(r.deny) == 0
+	}
+	if contains(r.deny, ip) {
+		return false
+	}
+	return len(r.allow) == 0 || contains(r.allow, ip)
+}
+
+// Empty reports whether the filter has no rules, and so allows every
+// request.
+func (f *Filter) Empty() bool {
+	return len(f.rules) == 0
+}
+
+// Allowed reports whether the client at ip may access the named repository.
+func (f *Filter) Allowed(name string, ip net.IP) bool {
+	for _, rule := range f.rules {
+		if rule.Applies(name) && !rule.Allows(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ClientIP returns the address of the client of a request. The
+// X-Forwarded-For header is only followed through trusted proxies, so that
+// clients cannot claim another address. It returns nil if the address
+// cannot be determined.
+func (f *Filter) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !contains(f.trustedProxies, ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			return nil
+		}
+		ip = hop
+		if !contains(f.trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,91 @@
+package ipfilter
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+func TestAllowed(t *testing.T) {
+	f, err := New(configuration.Network{
+		Rules: []configuration.NetworkRule{
+			{
+				Repositories: []string{"internal/.*"},
+				Allow:        []string{"10.0.0.0/8", "2001:db8::/32"},
+				Deny:         []string{"10.0.0.1"},
+			},
+			{
+				Deny: []string{"192.0.2.0/24"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing rules: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		ip      string
+		allowed bool
+	}{
+		{"internal/app", "10.1.2.3", true},
+		{"internal/app", "2001:db8::1", true},
+		{"internal/app", "10.0.0.1", false},
+		{"internal/app", "203.0.113.1", false},
+		{"internal/app", "", false},
+		{"public/app", "203.0.113.1", true},
+		{"public/app", "192.0.2.1", false},
+		{"public/app", "", false},
+		{"internal", "203.0.113.1", true},
+	} {
+		if allowed := f.Allowed(tc.name, net.ParseIP(tc.ip)); allowed != tc.allowed {
+			t.Errorf("Allowed(%q, %q) = %v, expected %v", tc.name, tc.ip, allowed, tc.allowed)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, config := range []configuration.Network{
+		{Rules: []configuration.NetworkRule{{Repositories: []string{"("}}}},
+		{Rules: []configuration.NetworkRule{{Allow: []string{"10.0.0.0/33"}}}},
+		{Rules: []configuration.NetworkRule{{Deny: []string{"localhost"}}}},
+		{TrustedProxies: []string{"proxy"}},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	f, err := New(configuration.Network{TrustedProxies: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatalf("unexpected error parsing rules: %v", err)
+	}
+
+	for _, tc := range []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		// Untrusted peers cannot claim another address.
+		{"203.0.113.1:1234", []string{"10.1.1.1"}, "203.0.113.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.1"}, "203.0.113.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1, 10.0.0.2"}, "203.0.113.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1", "10.0.0.2"}, "203.0.113.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:1234", []string{"unknown"}, ""},
+	} {
+		r := &http.Request{RemoteAddr: tc.remoteAddr, Header: http.Header{}}
+		for _, value := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		ip := f.ClientIP(r)
+		if (tc.expected == "" && ip != nil) || (tc.expected != "" && !ip.Equal(net.ParseIP(tc.expected))) {
+			t.Errorf("ClientIP(%s, %v) = %v, expected %q", tc.remoteAddr, tc.forwarded, ip, tc.expected)
+		}
+	}
+}
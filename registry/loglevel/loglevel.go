@@ -0,0 +1,197 @@
+// Package loglevel overrides the level of the logs of the registry at
+// runtime, for a limited duration, and enables the debug logs of modules,
+// such as the storage driver operations, without enabling those of the rest
+// of the registry.
+package loglevel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/sirupsen/logrus"
+)
+
+// Module is a part of the registry whose debug logs may be enabled on their
+// own.
+type Module string
+
+const (
+	// Storage covers the operations of the storage driver.
+	Storage Module = "storage"
+
+	// Auth covers the authorization of requests.
+	Auth Module = "auth"
+
+	// Notifications covers the delivery of notifications to endpoints.
+	Notifications Module = "notifications"
+)
+
+// Modules lists the modules whose debug logs may be enabled.
+var Modules = []Module{Storage, Auth, Notifications}
+
+// Status describes the override in effect.
+type Status struct {
+	// Level is the level of the logs of the registry.
+	Level string `json:"level"`
+
+	// Modules lists the modules whose debug logs are enabled.
+	Modules []Module `json:"modules"`
+
+	// Expires is when the override ends, nil if none is in effect.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+var (
+	mu sync.Mutex
+	// base is the level the override replaced, restored when it ends.
+	base    logrus.Level
+	expires time.Time
+	timer   *time.Timer
+	// generation counts the overrides, so that the timer of a replaced
+	// override does not end the one replacing it.
+	generation uint64
+
+	// enabled holds the map[Module]bool of the modules whose debug logs
+	// are enabled, read on every storage operation.
+	enabled atomic.Value
+)
+
+// Set overrides the level of the logs of the registry, unless level is
+// empty, and enables the debug logs of modules, replacing any override in
+// effect. The override ends after duration.
+func Set(level string, modules []Module, duration time.Duration) (Status, error) {
+	if duration <= 0 {
+		return Status{}, fmt.Errorf("invalid log level override duration %v", duration)
+	}
+	var l logrus.Level
+	if level != "" {
+		var err error
+		l, err = logrus.ParseLevel(level)
+		if err != nil {
+			return Status{}, err
+		}
+	}
+	m := make(map[Module]bool, len(modules))
+	for _, module := range modules {
+		if !known(module) {
+			return Status{}, fmt.Errorf("unknown log module %q", module)
+		}
+		m[module] = true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if timer == nil {
+		base = logrus.GetLevel()
+	} else {
+		timer.Stop()
+	}
+	if level != "" {
+		logrus.SetLevel(l)
+	} else {
+		logrus.SetLevel(base)
+	}
+	enabled.Store(m)
+	expires = time.Now().Add(duration)
+	generation++
+	g := generation
+	timer = time.AfterFunc(duration, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if g == generation {
+			reset()
+			logrus.Infof("log level override expired")
+		}
+	})
+	return status(), nil
+}
+
+// Reset ends the override in effect, if any, restoring the level of the
+// logs and disabling the debug logs of modules.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	reset()
+}
+
+func reset() {
+	if timer == nil {
+		return
+	}
+	timer.Stop()
+	timer = nil
+	logrus.SetLevel(base)
+	enabled.Store(map[Module]bool{})
+}
+
+// Current returns the override in effect.
+func Current() Status {
+	mu.Lock()
+	defer mu.Unlock()
+	return status()
+}
+
+func status() Status {
+	s := Status{Level: logrus.GetLevel().String(), Modules: []Module{}}
+	if timer != nil {
+		e := expires
+		s.Expires = &e
+	}
+	m, _ := enabled.Load().(map[Module]bool)
+	for module := range m {
+		s.Modules = append(s.Modules, module)
+	}
+	sort.Slice(s.Modules, func(i, j int) bool { return s.Modules[i] < s.Modules[j] })
+	return s
+}
+
+// Enabled reports whether the debug logs of module are enabled.
+func Enabled(module Module) bool {
+	m, _ := enabled.Load().(map[Module]bool)
+	return m[module]
+}
+
+// Logger returns the logger of ctx, logging debug logs if those of module
+// are enabled.
+func Logger(ctx context.Context, module Module) dcontext.Logger {
+	logger := dcontext.GetLogger(ctx)
+	if !Enabled(module) {
+		return logger
+	}
+	entry, ok := logger.(*logrus.Entry)
+	if !ok || entry.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		return logger
+	}
+	debugLogger := &logrus.Logger{
+		Out:          entry.Logger.Out,
+		Hooks:        entry.Logger.Hooks,
+		Formatter:    entry.Logger.Formatter,
+		ReportCaller: entry.Logger.ReportCaller,
+		Level:        logrus.DebugLevel,
+		ExitFunc:     entry.Logger.ExitFunc,
+	}
+	return logrus.NewEntry(debugLogger).WithFields(entry.Data).WithField("module", string(module))
+}
+
+// WithModule returns ctx, with a logger logging debug logs if those of
+// module are enabled.
+func WithModule(ctx context.Context, module Module) context.Context {
+	if !Enabled(module) {
+		return ctx
+	}
+	return dcontext.WithLogger(ctx, Logger(ctx, module))
+}
+
+func known(module Module) bool {
+	for _, m := range Modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
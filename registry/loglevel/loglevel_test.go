@@ -0,0 +1,82 @@
+package loglevel
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSetExpires(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.InfoLevel)
+	defer Reset()
+
+	if _, err := Set("verbose", nil, time.Minute); err == nil {
+		t.Fatal("expected an invalid level to be refused")
+	}
+	if _, err := Set("", []Module{"unknown"}, time.Minute); err == nil {
+		t.Fatal("expected an unknown module to be refused")
+	}
+	if _, err := Set("debug", nil, 0); err == nil {
+		t.Fatal("expected an empty duration to be refused")
+	}
+
+	status, err := Set("debug", []Module{Storage}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error setting the log level: %v", err)
+	}
+	if status.Level != "debug" || len(status.Modules) != 1 || status.Modules[0] != Storage || status.Expires == nil {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// A new override replaces the one in effect, and restores the level
+	// it replaced when it expires.
+	if _, err := Set("", []Module{Auth, Notifications}, 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error setting the log level: %v", err)
+	}
+	if logrus.GetLevel() != logrus.InfoLevel || Enabled(Storage) || !Enabled(Auth) {
+		t.Fatalf("unexpected override %+v", Current())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for Enabled(Auth) {
+		if time.Now().After(deadline) {
+			t.Fatalf("override did not expire: %+v", Current())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if status := Current(); status.Level != "info" || len(status.Modules) != 0 || status.Expires != nil {
+		t.Fatalf("unexpected status after expiry %+v", status)
+	}
+}
+
+func TestModuleLogger(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.InfoLevel)
+	defer Reset()
+
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Level = logrus.InfoLevel
+	ctx := dcontext.WithLogger(context.Background(), logrus.NewEntry(logger).WithField("request", "r1"))
+
+	Logger(ctx, Storage).Debug("hidden")
+	if _, err := Set("", []Module{Storage}, time.Hour); err != nil {
+		t.Fatalf("unexpected error setting the log level: %v", err)
+	}
+	Logger(ctx, Auth).Debug("hidden")
+	dcontext.GetLogger(WithModule(ctx, Storage)).Debug("shown")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Fatalf("unexpected debug logs: %s", out)
+	}
+	if !strings.Contains(out, "shown") || !strings.Contains(out, "module=storage") || !strings.Contains(out, "request=r1") {
+		t.Fatalf("missing module debug logs: %s", out)
+	}
+}
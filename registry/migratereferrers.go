@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateRepositories []string
+	migrateDryRun       bool
+)
+
+// MigrateReferrersCmd is the cobra command that corresponds to the
+// migrate-referrers subcommand
+var MigrateReferrersCmd = &cobra.Command{
+	Use:   "migrate-referrers <config>",
+	Short: "`migrate-referrers` moves the referrer links to the v2 referrers layout",
+	Long:  "`migrate-referrers` moves the referrer links of the repositories, written in the v1 referrers layout, to the directories of their artifact types of the v2 layout, so that queries filtered by artifact type only read the manifests of the matching referrers. Links are moved one at a time and stay listed throughout, so the registry may keep serving during the migration.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		migration, err := storage.MigrateReferrerLinks(ctx, driver, registry, migrateDryRun, migrateRepositories...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate referrer links: %v\n", err)
+			os.Exit(1)
+		}
+		verb := "migrated"
+		if migrateDryRun {
+			verb = "would migrate"
+		}
+		fmt.Printf("%s %d referrer links in %d repositories, skipped %d links to referrers which no longer exist\n", verb, migration.Migrated, migration.Repositories, migration.Skipped)
+		if config.Referrers.Layout != "v2" {
+			fmt.Fprintln(os.Stderr, "referrers.layout is not set to v2, referrers pushed from now on are linked in the v1 layout")
+		}
+	},
+}
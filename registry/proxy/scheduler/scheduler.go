@@ -3,6 +3,7 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -239,8 +240,8 @@ func (ttles *TTLExpirationScheduler) writeState() error {
 
 func (ttles *TTLExpirationScheduler) readState() error {
 	if _, err := ttles.driver.Stat(ttles.ctx, ttles.pathToStateFile); err != nil {
-		switch err := err.(type) {
-		case driver.PathNotFoundError:
+		switch {
+		case errors.Is(err, driver.ErrNotFound):
 			return nil
 		default:
 			return err
@@ -0,0 +1,96 @@
+// Package quiesce holds the writes of a registry instance while it records
+// a consistency marker, so that snapshots of the storage can be correlated
+// with a point at which no write was in flight.
+package quiesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQuiesced is returned when writes are already held.
+var ErrQuiesced = errors.New("writes are already quiesced")
+
+// Gate counts the writes in flight, and holds new writes while quiesced.
+type Gate struct {
+	mu     sync.Mutex
+	writes int
+	// resumed is closed when the writes resume, nil unless quiesced.
+	resumed chan struct{}
+	// drained is closed when the last write in flight completes, nil
+	// unless quiesced with writes in flight.
+	drained chan struct{}
+}
+
+// Enter waits for the writes to resume if they are held, until ctx is done,
+// and counts a write in flight until the returned function is called.
+func (g *Gate) Enter(ctx context.Context) (func(), error) {
+	for {
+		g.mu.Lock()
+		resumed := g.resumed
+		if resumed == nil {
+			g.writes++
+			g.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(g.exit) }, nil
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (g *Gate) exit() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writes--
+	if g.writes == 0 && g.drained != nil {
+		close(g.drained)
+		g.drained = nil
+	}
+}
+
+// Quiesce holds new writes and waits for those in flight to complete, until
+// ctx is done. It returns the number of writes in flight it waited for, and
+// a function resuming the writes, which must be called even if an error is
+// returned, unless it is ErrQuiesced.
+func (g *Gate) Quiesce(ctx context.Context) (int, func(), error) {
+	g.mu.Lock()
+	if g.resumed != nil {
+		g.mu.Unlock()
+		return 0, nil, ErrQuiesced
+	}
+	resumed := make(chan struct{})
+	g.resumed = resumed
+	inFlight := g.writes
+	var drained chan struct{}
+	if inFlight > 0 {
+		drained = make(chan struct{})
+		g.drained = drained
+	}
+	g.mu.Unlock()
+
+	var once sync.Once
+	resume := func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.resumed = nil
+			g.drained = nil
+			close(resumed)
+		})
+	}
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return inFlight, resume, ctx.Err()
+		}
+	}
+	return inFlight, resume, nil
+}
@@ -0,0 +1,97 @@
+package quiesce
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuiesce(t *testing.T) {
+	ctx := context.Background()
+	var g Gate
+
+	exit, err := g.Enter(ctx)
+	if err != nil {
+		t.Fatalf("failed to enter: %v", err)
+	}
+
+	quiesced := make(chan int)
+	var resume func()
+	var quiesceErr error
+	go func() {
+		var inFlight int
+		inFlight, resume, quiesceErr = g.Quiesce(ctx)
+		quiesced <- inFlight
+	}()
+	for quiescing := false; !quiescing; {
+		g.mu.Lock()
+		quiescing = g.resumed != nil
+		g.mu.Unlock()
+	}
+
+	// New writes are held, and so is the quiesce until the write in flight
+	// completes.
+	entered := make(chan func())
+	go func() {
+		exit, err := g.Enter(ctx)
+		if err != nil {
+			t.Errorf("failed to enter: %v", err)
+		}
+		entered <- exit
+	}()
+	select {
+	case <-quiesced:
+		t.Fatal("quiesced with a write in flight")
+	case <-entered:
+		t.Fatal("write entered while quiescing")
+	case <-time.After(20 * time.Millisecond):
+	}
+	exit()
+	// Exiting twice is harmless.
+	exit()
+	if inFlight := <-quiesced; quiesceErr != nil || inFlight != 1 {
+		t.Fatalf("unexpected quiesce after %d writes: %v", inFlight, quiesceErr)
+	}
+
+	if _, _, err := g.Quiesce(ctx); !errors.Is(err, ErrQuiesced) {
+		t.Fatalf("unexpected error quiescing twice: %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := g.Enter(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error entering with a cancelled context: %v", err)
+	}
+
+	select {
+	case <-entered:
+		t.Fatal("write entered while quiesced")
+	case <-time.After(20 * time.Millisecond):
+	}
+	resume()
+	(<-entered)()
+}
+
+func TestQuiesceTimeout(t *testing.T) {
+	var g Gate
+	exit, err := g.Enter(context.Background())
+	if err != nil {
+		t.Fatalf("failed to enter: %v", err)
+	}
+	defer exit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	inFlight, resume, err := g.Quiesce(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || inFlight != 1 {
+		t.Fatalf("unexpected quiesce after %d writes: %v", inFlight, err)
+	}
+	resume()
+
+	// Writes resume once the quiesce gives up.
+	exit2, err := g.Enter(context.Background())
+	if err != nil {
+		t.Fatalf("failed to enter: %v", err)
+	}
+	exit2()
+}
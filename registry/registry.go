@@ -28,6 +28,7 @@ import (
 	"github.com/distribution/distribution/v3/configuration"
 	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/health"
+	"github.com/distribution/distribution/v3/registry/fips"
 	"github.com/distribution/distribution/v3/registry/handlers"
 	"github.com/distribution/distribution/v3/registry/listener"
 	"github.com/distribution/distribution/v3/uuid"
@@ -100,35 +101,41 @@ var ServeCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		if config.HTTP.Debug.Addr != "" {
-			go func(addr string) {
-				logrus.Infof("debug server listening %v", addr)
-				if err := http.ListenAndServe(addr, nil); err != nil {
-					logrus.Fatalf("error listening on debug interface: %v", err)
-				}
-			}(config.HTTP.Debug.Addr)
-		}
+		startDebugServer(config)
 
 		registry, err := NewRegistry(ctx, config)
 		if err != nil {
 			logrus.Fatalln(err)
 		}
 
-		if config.HTTP.Debug.Prometheus.Enabled {
-			path := config.HTTP.Debug.Prometheus.Path
-			if path == "" {
-				path = "/metrics"
-			}
-			logrus.Info("providing prometheus metrics on ", path)
-			http.Handle(path, metrics.Handler())
-		}
-
 		if err = registry.ListenAndServe(); err != nil {
 			logrus.Fatalln(err)
 		}
 	},
 }
 
+// startDebugServer listens on the debug address of the configuration, if
+// any, serving the Prometheus metrics if they are enabled.
+func startDebugServer(config *configuration.Configuration) {
+	if config.HTTP.Debug.Prometheus.Enabled {
+		path := config.HTTP.Debug.Prometheus.Path
+		if path == "" {
+			path = "/metrics"
+		}
+		logrus.Info("providing prometheus metrics on ", path)
+		http.Handle(path, metrics.Handler())
+	}
+
+	if config.HTTP.Debug.Addr != "" {
+		go func(addr string) {
+			logrus.Infof("debug server listening %v", addr)
+			if err := http.ListenAndServe(addr, nil); err != nil {
+				logrus.Fatalf("error listening on debug interface: %v", err)
+			}
+		}(config.HTTP.Debug.Addr)
+	}
+}
+
 // A Registry represents a complete instance of the registry.
 // TODO(aaronl): It might make sense for Registry to become an interface.
 type Registry struct {
@@ -232,6 +239,13 @@ func (registry *Registry) ListenAndServe() error {
 			if err != nil {
 				return err
 			}
+			if fips.Enabled(config) {
+				if len(config.HTTP.TLS.CipherSuites) == 0 {
+					tlsCipherSuites = fips.CipherSuites
+				} else if err := fips.ApprovedCipherSuites(tlsCipherSuites); err != nil {
+					return fmt.Errorf("%v, specified for http.tls.cipherSuites", err)
+				}
+			}
 			dcontext.GetLogger(registry.app).Infof("restricting TLS cipher suites to: %s", strings.Join(getCipherSuiteNames(tlsCipherSuites), ","))
 		}
 
@@ -242,6 +256,10 @@ func (registry *Registry) ListenAndServe() error {
 			PreferServerCipherSuites: true,
 			CipherSuites:             tlsCipherSuites,
 		}
+		if fips.Enabled(config) {
+			dcontext.GetLogger(registry.app).Info("restricting TLS to FIPS approved algorithms")
+			tlsConf.CurvePreferences = fips.CurvePreferences
+		}
 
 		if config.HTTP.TLS.LetsEncrypt.CacheFile != "" {
 			if config.HTTP.TLS.Certificate != "" {
@@ -312,7 +330,10 @@ func (registry *Registry) ListenAndServe() error {
 		// shutdown the server with a grace period of configured timeout
 		c, cancel := context.WithTimeout(context.Background(), config.HTTP.DrainTimeout)
 		defer cancel()
-		return registry.server.Shutdown(c)
+		if err := registry.server.Shutdown(c); err != nil {
+			return err
+		}
+		return registry.app.Shutdown()
 	}
 }
 
@@ -457,16 +478,9 @@ func alive(path string, handler http.Handler) http.Handler {
 }
 
 func resolveConfiguration(args []string) (*configuration.Configuration, error) {
-	var configurationPath string
-
-	if len(args) > 0 {
-		configurationPath = args[0]
-	} else if os.Getenv("REGISTRY_CONFIGURATION_PATH") != "" {
-		configurationPath = os.Getenv("REGISTRY_CONFIGURATION_PATH")
-	}
-
-	if configurationPath == "" {
-		return nil, fmt.Errorf("configuration path unspecified")
+	configurationPath, err := resolveConfigurationPath(args)
+	if err != nil {
+		return nil, err
 	}
 
 	fp, err := os.Open(configurationPath)
@@ -484,6 +498,21 @@ func resolveConfiguration(args []string) (*configuration.Configuration, error) {
 	return config, nil
 }
 
+func resolveConfigurationPath(args []string) (string, error) {
+	var configurationPath string
+
+	if len(args) > 0 {
+		configurationPath = args[0]
+	} else if os.Getenv("REGISTRY_CONFIGURATION_PATH") != "" {
+		configurationPath = os.Getenv("REGISTRY_CONFIGURATION_PATH")
+	}
+
+	if configurationPath == "" {
+		return "", fmt.Errorf("configuration path unspecified")
+	}
+	return configurationPath, nil
+}
+
 func nextProtos(config *configuration.Configuration) []string {
 	switch config.HTTP.HTTP2.Disabled {
 	case true:
@@ -369,6 +369,25 @@ func TestRegistryUnsupportedCipherSuite(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 }
 
+func TestRegistryFIPSCipherSuite(t *testing.T) {
+	name := "registry_test_server_fips_cipher"
+	serverTLS, err := buildRegistryTLSConfig(name, "rsa", []string{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := setupRegistry(serverTLS, ":5003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.config.Policy.FIPS = true
+
+	// a cipher suite which is not FIPS approved is refused at startup
+	if err := registry.ListenAndServe(); err == nil || !strings.Contains(err.Error(), "not FIPS approved") {
+		t.Fatalf("expected a FIPS error, got %v", err)
+	}
+}
+
 func TestConfigureLogging(t *testing.T) {
 	yamlConfig := `---
 log:
@@ -424,3 +443,35 @@ log:
 		t.Error("field baz not configured correctly; expected 'xyzzy' got: ", val)
 	}
 }
+
+func TestValidateConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		config string
+		err    string
+	}{
+		{config: "version: 0.1\nstorage: inmemory\n"},
+		{config: "version: 0.1\nstorage: inmemory\nhttp:\n  adr: :5000\n", err: `unknown key "adr"`},
+		{config: "version: 0.1\nstorage: nonexistent\n", err: `unknown storage driver "nonexistent"`},
+		{config: "version: 0.1\nstorage: inmemory\npolicy:\n  freeze:\n    - schedule: '* * *'\n      duration: 1h\n", err: "invalid schedule"},
+	} {
+		configurationPath := path.Join(dir, "config.yml")
+		if err := ioutil.WriteFile(configurationPath, []byte(tc.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := validateConfiguration(configurationPath)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tc.config, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: expected error containing %q, got %v", tc.config, tc.err, err)
+		}
+	}
+}
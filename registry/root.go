@@ -1,15 +1,32 @@
 package registry
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
 
 	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/freeze"
 	"github.com/distribution/distribution/v3/registry/storage"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	"github.com/distribution/distribution/v3/version"
 	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 var showVersion bool
@@ -19,6 +36,47 @@ func init() {
 	RootCmd.AddCommand(GCCmd)
 	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
 	GCCmd.Flags().BoolVarP(&removeUntagged, "delete-untagged", "m", false, "delete manifests that are not currently referenced via tag")
+	GCCmd.Flags().DurationVarP(&untaggedRetention, "untagged-retention", "u", 0, "with --delete-untagged, keep untagged manifests pushed less than this long ago")
+	GCCmd.Flags().BoolVarP(&removeExpired, "delete-expired", "e", false, "delete manifests whose expiration annotation has passed, even if tagged")
+	GCCmd.Flags().BoolVar(&removeOrphanedPlatforms, "delete-orphaned-platforms", false, "delete the untagged platform manifests of the indexes deleted by the collection")
+	GCCmd.Flags().BoolVarP(&explain, "explain", "x", false, "report why each manifest and blob is kept or deleted")
+	GCCmd.Flags().Float64VarP(&deleteRate, "delete-rate", "r", 0, "maximum number of deletes per second during the sweep, unlimited if 0")
+	GCCmd.Flags().IntVar(&sweepWorkers, "sweep-workers", 1, "number of blobs deleted concurrently during the sweep")
+	GCCmd.Flags().StringArrayVar(&includeRepositories, "include-repository", nil, "only collect the repositories matching this pattern, or below a namespace matching it")
+	GCCmd.Flags().StringArrayVar(&excludeRepositories, "exclude-repository", nil, "do not collect the repositories matching this pattern, or below a namespace matching it")
+	GCCmd.Flags().StringVar(&collectRepository, "repository", "", "only collect this repository, deleting its links to unreferenced blobs but not the blobs")
+	GCCmd.Flags().BoolVar(&online, "online", false, "collect while the registry is serving pushes, keeping recent and concurrently linked content")
+	GCCmd.Flags().DurationVar(&gracePeriod, "grace-period", storage.DefaultGCGracePeriod, "with --online, keep blobs and untagged manifests written less than this long ago")
+	GCCmd.Flags().StringVarP(&reportFormat, "report-format", "o", storage.GCReportText, "output format, text to print progress or json to print a summary once done")
+	GCCmd.Flags().IntVar(&enumerationRetries, "enumeration-retries", 0, "number of times to resume an enumeration of manifests or blobs interrupted by a storage error")
+	GCCmd.Flags().BoolVar(&journal, "journal", false, "record the deletions to a journal in the storage before making them, so that they can be undone")
+	GCCmd.Flags().BoolVar(&buildReferenceIndex, "build-reference-index", false, "record the references of the manifests kept to the reference index, marking it built after a full collection")
+	GCCmd.Flags().BoolVar(&incremental, "incremental", false, "only delete the blobs which lost their last reference since the last run, according to the reference index")
+	GCCmd.Flags().DurationVar(&gcTimeout, "timeout", 0, "stop the collection once it has run this long, without limit if 0")
+	GCCmd.Flags().BoolVar(&referrersOnly, "referrers-only", false, "only delete the referrer links whose referrer or subject manifest no longer exists, leaving manifests and blobs alone")
+	GCCmd.Flags().DurationVar(&metricsLinger, "metrics-linger", 0, "keep serving the metrics on the debug address this long after the collection, so that they are scraped")
+	GCCmd.AddCommand(GCUndoCmd)
+	GCUndoCmd.Flags().StringVarP(&backupConfig, "backup", "b", "", "configuration whose storage holds a backup of the blobs to restore")
+	RootCmd.AddCommand(ConfigCmd)
+	RootCmd.AddCommand(SelfTestCmd)
+	RootCmd.AddCommand(DedupReportCmd)
+	RootCmd.AddCommand(GraphCmd)
+	RootCmd.AddCommand(InspectCmd)
+	RootCmd.AddCommand(DeleteCmd)
+	DeleteCmd.Flags().BoolVar(&deleteCascadeReferrers, "cascade-referrers", false, "delete the referrers of the manifest too, recursively")
+	DeleteCmd.Flags().BoolVarP(&deleteDryRun, "dry-run", "d", false, "print what would be deleted without deleting it")
+	RootCmd.AddCommand(MigrateReferrersCmd)
+	MigrateReferrersCmd.Flags().StringArrayVar(&migrateRepositories, "repository", nil, "only migrate the referrer links of this repository")
+	MigrateReferrersCmd.Flags().BoolVarP(&migrateDryRun, "dry-run", "d", false, "count the referrer links to migrate without moving them")
+	RootCmd.AddCommand(VerifyUpstreamCmd)
+	VerifyUpstreamCmd.Flags().StringVar(&upstreamRepository, "remote-repository", "", "name of the repository in the remote registry, if it differs")
+	VerifyUpstreamCmd.Flags().StringVarP(&upstreamUsername, "username", "u", "", "username to authenticate to the remote registry with")
+	VerifyUpstreamCmd.Flags().StringVarP(&upstreamPassword, "password", "p", "", "password to authenticate to the remote registry with")
+	GraphCmd.Flags().StringArrayVarP(&graphDigests, "digest", "d", nil, "digest of a manifest to start the graph from, instead of all manifests of the repository")
+	GraphCmd.Flags().StringVarP(&graphFormat, "format", "f", "json", "output format, json or dot")
+	DedupReportCmd.Flags().IntVarP(&reportTop, "top", "n", 10, "number of blobs to list in each category")
+	ConfigCmd.AddCommand(ConfigValidateCmd)
+	ConfigCmd.AddCommand(ConfigPrintDefaultsCmd)
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
 }
 
@@ -38,6 +96,25 @@ var RootCmd = &cobra.Command{
 
 var dryRun bool
 var removeUntagged bool
+var untaggedRetention time.Duration
+var removeExpired bool
+var removeOrphanedPlatforms bool
+var explain bool
+var deleteRate float64
+var sweepWorkers int
+var reportFormat string
+var includeRepositories []string
+var excludeRepositories []string
+var collectRepository string
+var online bool
+var gracePeriod time.Duration
+var journal bool
+var enumerationRetries int
+var buildReferenceIndex bool
+var incremental bool
+var gcTimeout time.Duration
+var metricsLinger time.Duration
+var referrersOnly bool
 
 // GCCmd is the cobra command that corresponds to the garbage-collect subcommand
 var GCCmd = &cobra.Command{
@@ -52,6 +129,30 @@ var GCCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		opts, err := freezeGCOpts(config, storage.GCOpts{
+			DryRun:                  dryRun,
+			RemoveUntagged:          removeUntagged,
+			UntaggedRetentionPeriod: untaggedRetention,
+			RemoveExpired:           removeExpired,
+			RemoveOrphanedPlatforms: removeOrphanedPlatforms,
+			Explain:                 explain,
+			DeleteRate:              deleteRate,
+			SweepWorkers:            sweepWorkers,
+			ReportFormat:            reportFormat,
+			IncludeRepositories:     includeRepositories,
+			ExcludeRepositories:     excludeRepositories,
+			Online:                  online,
+			GracePeriod:             gracePeriod,
+			Journal:                 journal,
+			EnumerationRetries:      enumerationRetries,
+			BuildReferenceIndex:     buildReferenceIndex,
+			ReferrersOnly:           referrersOnly,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
 		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
@@ -77,13 +178,362 @@ var GCCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		err = storage.MarkAndSweep(ctx, driver, registry, storage.GCOpts{
-			DryRun:         dryRun,
-			RemoveUntagged: removeUntagged,
-		})
+		if config.Timeline.Enabled {
+			opts.Timeline = storage.NewTimeline(driver, config.Timeline.MaxEvents)
+		}
+
+		// The metrics of the collection are served on the debug address
+		// while it runs.
+		startDebugServer(config)
+
+		// Interrupting the collection stops it between two storage
+		// operations.
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if gcTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, gcTimeout)
+			defer cancel()
+		}
+
+		var report storage.GCReport
+		switch {
+		case incremental:
+			report, err = storage.SweepReferenceIndex(ctx, driver, registry, opts)
+		case collectRepository != "":
+			report, err = storage.CollectRepository(ctx, driver, registry, collectRepository, opts)
+		default:
+			report, err = storage.MarkAndSweep(ctx, driver, registry, opts)
+		}
+		if metricsLinger > 0 && config.HTTP.Debug.Addr != "" {
+			time.Sleep(metricsLinger)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to garbage collect: %v", err)
 			os.Exit(1)
 		}
+		if reportFormat == storage.GCReportJSON {
+			out, err := json.MarshalIndent(report, "", "   ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to marshal garbage collection report: %v", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(out))
+		}
 	},
 }
+
+var backupConfig string
+
+// GCUndoCmd is the cobra command that corresponds to the garbage-collect
+// undo subcommand
+var GCUndoCmd = &cobra.Command{
+	Use:   "undo <config> <journal>",
+	Short: "`undo` restores the deletions of a journaled garbage collection",
+	Long:  "`undo` restores the manifests, tags, links and blobs deleted by a garbage collection run with --journal, copying the blobs from a backup storage",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if config.Replica.Enabled {
+			fmt.Fprintln(os.Stderr, "refusing to undo a garbage collection from a replica, undo it from the primary instead")
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		var backup storagedriver.StorageDriver
+		if backupConfig != "" {
+			config, err := resolveConfiguration([]string{backupConfig})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "backup configuration error: %v\n", err)
+				os.Exit(1)
+			}
+			backup, err = factory.Create(config.Storage.Type(), config.Storage.Parameters())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to construct backup %s driver: %v", config.Storage.Type(), err)
+				os.Exit(1)
+			}
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		report, err := storage.UndoGC(ctx, driver, backup, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to undo garbage collection: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d manifests, %d tags, %d links and %d blobs restored\n", report.ManifestsRestored, report.TagsRestored, report.LinksRestored, report.BlobsRestored)
+		for _, dgst := range report.MissingBlobs {
+			fmt.Printf("blob %s could not be restored\n", dgst)
+		}
+	},
+}
+
+var reportTop int
+
+// DedupReportCmd is the cobra command that corresponds to the dedup-report
+// subcommand
+var DedupReportCmd = &cobra.Command{
+	Use:   "dedup-report <config>",
+	Short: "`dedup-report` reports how blobs are shared between repositories",
+	Long:  "`dedup-report` reports how blobs are shared between repositories, the largest blobs and the blobs no repository links to",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		report, err := storage.DedupStats(ctx, registry, reportTop)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compute dedup statistics: %v", err)
+			os.Exit(1)
+		}
+		printDedupReport(os.Stdout, report)
+	},
+}
+
+func printDedupReport(w io.Writer, report *storage.DedupReport) {
+	fmt.Fprintf(w, "%d blobs, %d bytes stored, %d bytes linked from repositories\n", report.Blobs, report.Size, report.LinkedSize)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nREPOSITORIES\tBLOBS")
+	counts := make([]int, 0, len(report.Sharing))
+	for count := range report.Sharing {
+		counts = append(counts, count)
+	}
+	sort.Ints(counts)
+	for _, count := range counts {
+		fmt.Fprintf(tw, "%d\t%d\n", count, report.Sharing[count])
+	}
+
+	for _, section := range []struct {
+		title  string
+		usages []storage.BlobUsage
+	}{
+		{"MOST SHARED", report.MostShared},
+		{"LARGEST", report.Largest},
+		{"ORPHANED", report.Orphaned},
+	} {
+		fmt.Fprintf(tw, "\n%s\tSIZE\tREPOSITORIES\n", section.title)
+		for _, usage := range section.usages {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", usage.Digest, usage.Size, strings.Join(usage.Repositories, ","))
+		}
+	}
+	tw.Flush()
+}
+
+var graphDigests []string
+var graphFormat string
+
+// GraphCmd is the cobra command that corresponds to the graph subcommand
+var GraphCmd = &cobra.Command{
+	Use:   "graph <config> <repository>",
+	Short: "`graph` exports the dependency graph of the manifests, blobs and referrers of a repository",
+	Long:  "`graph` exports the dependency graph of the manifests, blobs and referrers of a repository as JSON or Graphviz DOT",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if graphFormat != "json" && graphFormat != "dot" {
+			fmt.Fprintf(os.Stderr, "unsupported format %q\n", graphFormat)
+			cmd.Usage()
+			os.Exit(1)
+		}
+		var roots []digest.Digest
+		for _, d := range graphDigests {
+			dgst, err := digest.Parse(d)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid digest %q: %v\n", d, err)
+				os.Exit(1)
+			}
+			roots = append(roots, dgst)
+		}
+		named, err := reference.WithName(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name %q: %v\n", args[1], err)
+			os.Exit(1)
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct repository: %v", err)
+			os.Exit(1)
+		}
+
+		graph, err := storage.DependencyGraph(ctx, repository, roots...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to build graph: %v", err)
+			os.Exit(1)
+		}
+
+		if graphFormat == "dot" {
+			err = graph.WriteDOT(os.Stdout)
+		} else {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "   ")
+			err = enc.Encode(graph)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+// ConfigCmd is the cobra command that corresponds to the config subcommand
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "`config` validates configuration files and prints defaults",
+	Long:  "`config` validates configuration files and prints defaults",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+// ConfigValidateCmd is the cobra command that corresponds to the config
+// validate subcommand
+var ConfigValidateCmd = &cobra.Command{
+	Use:   "validate <config>",
+	Short: "`validate` checks a configuration file for unknown keys and invalid values",
+	Long:  "`validate` checks a configuration file for unknown keys and invalid values",
+	Run: func(cmd *cobra.Command, args []string) {
+		configurationPath, err := resolveConfigurationPath(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		if err := validateConfiguration(configurationPath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", configurationPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: configuration is valid\n", configurationPath)
+	},
+}
+
+// ConfigPrintDefaultsCmd is the cobra command that corresponds to the config
+// print-defaults subcommand
+var ConfigPrintDefaultsCmd = &cobra.Command{
+	Use:   "print-defaults",
+	Short: "`print-defaults` prints a configuration file with the default settings",
+	Long:  "`print-defaults` prints a configuration file with the default settings",
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := yaml.Marshal(defaultConfiguration())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+	},
+}
+
+// validateConfiguration parses the configuration file at the given path
+// strictly and checks the values which are otherwise only checked when the
+// registry starts.
+func validateConfiguration(configurationPath string) error {
+	fp, err := os.Open(configurationPath)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	config, err := configuration.ParseStrict(fp)
+	if err != nil {
+		return err
+	}
+
+	if !factory.Registered(config.Storage.Type()) {
+		return fmt.Errorf("unknown storage driver %q", config.Storage.Type())
+	}
+	if _, err := freeze.New(config.Policy.Freeze); err != nil {
+		return err
+	}
+	return nil
+}
+
+// defaultConfiguration returns a configuration with the settings the
+// registry uses when they are not configured, and the filesystem storage
+// driver which has no default.
+func defaultConfiguration() *configuration.Configuration {
+	config := &configuration.Configuration{
+		Version: configuration.CurrentVersion,
+		Storage: configuration.Storage{
+			"filesystem": configuration.Parameters{
+				"rootdirectory": "/var/lib/registry",
+			},
+			"maintenance": configuration.Parameters{
+				"uploadpurging": map[interface{}]interface{}{
+					"enabled":  true,
+					"age":      "168h",
+					"interval": "24h",
+					"dryrun":   false,
+				},
+			},
+		},
+	}
+	config.Log.Level = configuration.Loglevel("info")
+	config.Log.Formatter = "text"
+	config.HTTP.Addr = ":5000"
+	config.HTTP.Net = "tcp"
+	config.HTTP.Headers = http.Header{"X-Content-Type-Options": []string{"nosniff"}}
+	return config
+}
@@ -0,0 +1,173 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/health/checks"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/gomodule/redigo/redis"
+	"github.com/spf13/cobra"
+)
+
+// selfTestTimeout bounds the connection attempts of the self-test.
+const selfTestTimeout = 10 * time.Second
+
+// SelfTestCmd is the cobra command that corresponds to the self-test
+// subcommand
+var SelfTestCmd = &cobra.Command{
+	Use:   "self-test <config>",
+	Short: "`self-test` checks that the services a configuration depends on are usable",
+	Long:  "`self-test` checks that the services a configuration depends on are usable",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		results := selfTest(dcontext.Background(), config)
+		printSelfTestResults(os.Stdout, results)
+		for _, result := range results {
+			if result.err != nil {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// selfTestResult is the outcome of one self-test check.
+type selfTestResult struct {
+	check  string
+	target string
+	err    error
+}
+
+// selfTest exercises the storage driver, access controller, redis instance
+// and notification endpoints of the configuration.
+func selfTest(ctx context.Context, config *configuration.Configuration) []selfTestResult {
+	results := []selfTestResult{{
+		check:  "storage",
+		target: config.Storage.Type(),
+		err:    selfTestStorage(ctx, config),
+	}}
+
+	if authType := config.Auth.Type(); authType != "" {
+		_, err := auth.GetAccessController(authType, config.Auth.Parameters())
+		results = append(results, selfTestResult{check: "auth", target: authType, err: err})
+	}
+
+	if config.Redis.Addr != "" {
+		results = append(results, selfTestResult{
+			check:  "redis",
+			target: config.Redis.Addr,
+			err:    selfTestRedis(config),
+		})
+	}
+
+	for _, endpoint := range config.Notifications.Endpoints {
+		if endpoint.Disabled {
+			continue
+		}
+		results = append(results, selfTestResult{
+			check:  "notifications",
+			target: endpoint.Name,
+			err:    selfTestEndpoint(endpoint),
+		})
+	}
+
+	return results
+}
+
+// selfTestStorage writes, reads back and deletes a probe file.
+func selfTestStorage(ctx context.Context, config *configuration.Configuration) error {
+	driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+	if err != nil {
+		return err
+	}
+
+	probePath := "/selftest-" + uuid.Generate().String()
+	content := []byte("registry self-test")
+	if err := driver.PutContent(ctx, probePath, content); err != nil {
+		return fmt.Errorf("write failed: %v", err)
+	}
+	read, err := driver.GetContent(ctx, probePath)
+	if err != nil {
+		driver.Delete(ctx, probePath)
+		return fmt.Errorf("read failed: %v", err)
+	}
+	if !bytes.Equal(read, content) {
+		driver.Delete(ctx, probePath)
+		return fmt.Errorf("read back %d bytes which differ from the %d written", len(read), len(content))
+	}
+	if err := driver.Delete(ctx, probePath); err != nil {
+		return fmt.Errorf("delete failed: %v", err)
+	}
+	return nil
+}
+
+func selfTestRedis(config *configuration.Configuration) error {
+	conn, err := redis.Dial("tcp",
+		config.Redis.Addr,
+		redis.DialConnectTimeout(selfTestTimeout),
+		redis.DialReadTimeout(selfTestTimeout),
+		redis.DialWriteTimeout(selfTestTimeout),
+		redis.DialUseTLS(config.Redis.TLS.Enabled),
+		redis.DialPassword(config.Redis.Password),
+		redis.DialDatabase(config.Redis.DB))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("PING")
+	return err
+}
+
+// selfTestEndpoint checks that a connection to a notification endpoint can
+// be established. Events are not sent, as endpoints would process them.
+func selfTestEndpoint(endpoint configuration.Endpoint) error {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	timeout := endpoint.Timeout
+	if timeout == 0 {
+		timeout = selfTestTimeout
+	}
+	return checks.TCPChecker(net.JoinHostPort(u.Hostname(), port), timeout).Check()
+}
+
+func printSelfTestResults(w io.Writer, results []selfTestResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tTARGET\tRESULT")
+	for _, result := range results {
+		status := "ok"
+		if result.err != nil {
+			status = "FAILED: " + result.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.check, result.target, status)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	_ "github.com/distribution/distribution/v3/registry/auth/silly"
+)
+
+func TestSelfTest(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// Find an address nothing listens on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{"inmemory": configuration.Parameters{}},
+		Auth:    configuration.Auth{"silly": configuration.Parameters{"realm": "realm", "service": "service"}},
+	}
+	config.Notifications.Endpoints = []configuration.Endpoint{
+		{Name: "up", URL: server.URL + "/events"},
+		{Name: "down", URL: "http://" + closedAddr + "/events"},
+		{Name: "disabled", URL: "http://" + closedAddr + "/events", Disabled: true},
+	}
+
+	results := selfTest(context.Background(), config)
+
+	failed := make(map[string]bool)
+	var targets []string
+	for _, result := range results {
+		targets = append(targets, result.check+"/"+result.target)
+		failed[result.target] = result.err != nil
+	}
+	if strings.Join(targets, ",") != "storage/inmemory,auth/silly,notifications/up,notifications/down" {
+		t.Fatalf("unexpected checks: %v", targets)
+	}
+	if failed["inmemory"] || failed["silly"] || failed["up"] || !failed["down"] {
+		t.Fatalf("unexpected results: %v", failed)
+	}
+
+	var out bytes.Buffer
+	printSelfTestResults(&out, results)
+	if !strings.Contains(out.String(), "FAILED: connection to "+closedAddr+" failed") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,205 @@
+// Package shadow mirrors a sample of the read requests served by the
+// registry to a second registry, as configured under shadow, and compares
+// the status codes and digests of the responses. Divergences are logged and
+// counted in the metrics, so that storage migrations and upgrades can be
+// validated against live traffic before the second registry takes over.
+package shadow
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/docker/go-metrics"
+)
+
+const (
+	defaultSampleRate  = 0.1
+	defaultMaxInFlight = 100
+	defaultTimeout     = 30 * time.Second
+)
+
+// The results of mirrored requests, as labeled in the metrics.
+const (
+	resultMatch          = "match"
+	resultStatusMismatch = "status_mismatch"
+	resultDigestMismatch = "digest_mismatch"
+	resultError          = "error"
+	resultDropped        = "dropped"
+)
+
+var (
+	requests = prometheus.ShadowNamespace.NewLabeledCounter("requests", "The number of requests mirrored to the shadow registry, by result", "method", "result")
+	duration = prometheus.ShadowNamespace.NewTimer("request_duration", "The time taken by the shadow registry to answer mirrored requests")
+)
+
+func init() {
+	metrics.Register(prometheus.ShadowNamespace)
+}
+
+// Mirror sends a sample of read requests to the shadow registry, in the
+// background, and compares its responses with those of the registry.
+type Mirror struct {
+	config  configuration.Shadow
+	baseURL *url.URL
+	client  *http.Client
+
+	// slots holds a value for each mirrored request in flight.
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// New returns a mirror to the shadow registry of the configuration.
+func New(config configuration.Shadow) (*Mirror, error) {
+	baseURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shadow url %q: %v", config.URL, err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid shadow url %q: the scheme must be http or https", config.URL)
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("invalid shadow sample rate %v: must be between 0 and 1", config.SampleRate)
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = defaultSampleRate
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = defaultMaxInFlight
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	return &Mirror{
+		config:  config,
+		baseURL: baseURL,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// Redirects are compared rather than followed.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		slots: make(chan struct{}, config.MaxInFlight),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// sampled returns true for the configured fraction of calls.
+func (m *Mirror) sampled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rand.Float64() < m.config.SampleRate
+}
+
+// Observe mirrors a request served with the given status and content digest
+// to the shadow registry if it is a read and is sampled. It returns at once:
+// the mirrored request is sent in the background, and dropped if too many
+// are already in flight.
+func (m *Mirror) Observe(ctx context.Context, r *http.Request, status int, dgst string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return
+	}
+	if !m.sampled() {
+		return
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		requests.WithValues(r.Method, resultDropped).Inc(1)
+		return
+	}
+
+	// Handlers which write nothing are answered with 200 OK.
+	if status == 0 {
+		status = http.StatusOK
+	}
+	req, err := m.request(r)
+	if err != nil {
+		<-m.slots
+		dcontext.GetLogger(ctx).Errorf("shadow: %v", err)
+		requests.WithValues(r.Method, resultError).Inc(1)
+		return
+	}
+	logger := dcontext.GetLogger(ctx)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() { <-m.slots }()
+		result := m.compare(logger, req, status, dgst)
+		requests.WithValues(req.Method, result).Inc(1)
+	}()
+}
+
+// credentialHeaders are the headers carrying the credentials of clients,
+// which are not sent to the shadow registry.
+var credentialHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// request returns the request to the shadow registry mirroring r, without
+// the credentials of the client, and with the configured headers replacing
+// those of r.
+func (m *Mirror) request(r *http.Request) (*http.Request, error) {
+	u := *m.baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequest(r.Method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	for _, name := range credentialHeaders {
+		req.Header.Del(name)
+	}
+	for name, values := range m.config.Headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return req, nil
+}
+
+// compare sends a mirrored request and returns how the response of the
+// shadow registry compares with the status and digest of the registry.
+func (m *Mirror) compare(logger dcontext.Logger, req *http.Request, status int, dgst string) string {
+	start := time.Now()
+	resp, err := m.client.Do(req)
+	if err != nil {
+		logger.Warnf("shadow: error mirroring %s %s: %v", req.Method, req.URL.Path, err)
+		return resultError
+	}
+	// The body is not compared, so that mirroring blob downloads does not
+	// double their traffic.
+	resp.Body.Close()
+	duration.UpdateSince(start)
+
+	if resp.StatusCode != status {
+		logger.Warnf("shadow: %s %s answered %d by the shadow registry and %d by the registry", req.Method, req.URL.Path, resp.StatusCode, status)
+		return resultStatusMismatch
+	}
+	if shadowDigest := resp.Header.Get("Docker-Content-Digest"); shadowDigest != dgst {
+		logger.Warnf("shadow: %s %s has digest %q in the shadow registry and %q in the registry", req.Method, req.URL.Path, shadowDigest, dgst)
+		return resultDigestMismatch
+	}
+	return resultMatch
+}
+
+// Wait waits for the mirrored requests in flight to complete.
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
@@ -0,0 +1,154 @@
+package shadow
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/docker/go-metrics"
+)
+
+// shadowMetrics returns the values of the shadow metrics.
+func shadowMetrics(t *testing.T) map[string]float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || !strings.HasPrefix(name, "registry_shadow_requests_total") {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("invalid value of %s: %v", name, err)
+		}
+		values[name] = v
+	}
+	return values
+}
+
+func TestMirror(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		switch r.URL.Path {
+		case "/prefix/v2/foo/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		case "/prefix/v2/foo/manifests/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	m, err := New(configuration.Shadow{
+		URL:        server.URL + "/prefix/",
+		Headers:    http.Header{"Authorization": []string{"Basic c2hhZG93"}},
+		SampleRate: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create mirror: %v", err)
+	}
+
+	before := shadowMetrics(t)
+	for _, tc := range []struct {
+		method string
+		path   string
+		status int
+		digest string
+	}{
+		{http.MethodGet, "/v2/foo/manifests/latest?ns=docker.io", http.StatusOK, "sha256:abc"},
+		{http.MethodHead, "/v2/foo/manifests/latest", http.StatusOK, "sha256:def"},
+		{http.MethodGet, "/v2/foo/manifests/missing", http.StatusOK, ""},
+		{http.MethodPut, "/v2/foo/manifests/latest", http.StatusCreated, "sha256:abc"},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		r.Header.Set("Authorization", "Bearer token")
+		r.Header.Set("Cookie", "session=secret")
+		r.Header.Set("Proxy-Authorization", "Basic cHJveHk=")
+		r.Header.Set("Accept", "application/vnd.oci.image.manifest.v1+json")
+		m.Observe(context.Background(), r, tc.status, tc.digest)
+	}
+	m.Wait()
+	after := shadowMetrics(t)
+
+	close(received)
+	var count int
+	for r := range received {
+		count++
+		if r.Method == http.MethodPut {
+			t.Errorf("write mirrored to the shadow registry")
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Basic c2hhZG93" {
+			t.Errorf("unexpected authorization of the mirrored request: %q", auth)
+		}
+		if cookie, proxyAuth := r.Header.Get("Cookie"), r.Header.Get("Proxy-Authorization"); cookie != "" || proxyAuth != "" {
+			t.Errorf("credentials of the client mirrored: %q, %q", cookie, proxyAuth)
+		}
+		if accept := r.Header.Get("Accept"); accept != "application/vnd.oci.image.manifest.v1+json" {
+			t.Errorf("unexpected accept header of the mirrored request: %q", accept)
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/prefix/v2/foo/manifests/latest" && r.URL.RawQuery != "ns=docker.io" {
+			t.Errorf("unexpected query of the mirrored request: %q", r.URL.RawQuery)
+		}
+	}
+	if count != 3 {
+		t.Fatalf("unexpected number of mirrored requests: %d", count)
+	}
+
+	for name, expected := range map[string]float64{
+		`registry_shadow_requests_total{method="GET",result="match"}`:            1,
+		`registry_shadow_requests_total{method="HEAD",result="digest_mismatch"}`: 1,
+		`registry_shadow_requests_total{method="GET",result="status_mismatch"}`:  1,
+	} {
+		if delta := after[name] - before[name]; delta != expected {
+			t.Errorf("unexpected increase of %s: %v, expected %v", name, delta, expected)
+		}
+	}
+}
+
+func TestMirrorConfiguration(t *testing.T) {
+	for _, config := range []configuration.Shadow{
+		{URL: "ftp://shadow.example.com"},
+		{URL: "https://shadow.example.com", SampleRate: 1.5},
+		{URL: "https://shadow.example.com", SampleRate: -0.5},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("expected an error for the configuration %+v", config)
+		}
+	}
+
+	m, err := New(configuration.Shadow{URL: "https://shadow.example.com"})
+	if err != nil {
+		t.Fatalf("failed to create mirror: %v", err)
+	}
+	if m.config.SampleRate != defaultSampleRate || m.config.MaxInFlight != defaultMaxInFlight || m.config.Timeout != defaultTimeout {
+		t.Fatalf("unexpected defaults: %+v", m.config)
+	}
+}
+
+func TestMirrorWithoutCredentials(t *testing.T) {
+	m, err := New(configuration.Shadow{URL: "https://registry-next.internal:5000"})
+	if err != nil {
+		t.Fatalf("failed to create mirror: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/v2/foo/manifests/latest", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("Accept", "application/vnd.oci.image.manifest.v1+json")
+	req, err := m.request(r)
+	if err != nil {
+		t.Fatalf("failed to build mirrored request: %v", err)
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		t.Errorf("credentials of the client mirrored: %q", auth)
+	}
+	if accept := req.Header.Get("Accept"); accept != "application/vnd.oci.image.manifest.v1+json" {
+		t.Errorf("unexpected accept header of the mirrored request: %q", accept)
+	}
+}
@@ -0,0 +1,91 @@
+// Package share signs and verifies share links, expiring tokens which grant
+// clients without credentials pull access to a single manifest and the
+// content it references.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+var (
+	// ErrInvalid is returned for tokens which were not signed with the
+	// secret of the signer.
+	ErrInvalid = errors.New("invalid share link")
+
+	// ErrExpired is returned for tokens which have expired.
+	ErrExpired = errors.New("share link expired")
+)
+
+// Link describes the content a share link grants access to.
+type Link struct {
+	// ID identifies the link, to record that a pull-once link was used.
+	ID string `json:"id"`
+
+	// Repository and Digest identify the shared manifest.
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+
+	// Expires is when the link stops granting access.
+	Expires time.Time `json:"expires"`
+
+	// Once is true if the manifest may only be pulled once.
+	Once bool `json:"once,omitempty"`
+}
+
+// Signer signs and verifies share links.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a signer deriving its key from secret, so that share
+// links cannot be mistaken for other tokens signed with the same secret.
+func NewSigner(secret string) *Signer {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("share links"))
+	return &Signer{key: mac.Sum(nil)}
+}
+
+// Sign returns the token of a link, encoded to url safe base64.
+func (s *Signer) Sign(link Link) (string, error) {
+	p, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(p)
+	return base64.RawURLEncoding.EncodeToString(append(mac.Sum(nil), p...)), nil
+}
+
+// Verify returns the link of a token, or ErrInvalid if it was not signed by
+// the signer and ErrExpired if it expired before now.
+func (s *Signer) Verify(token string, now time.Time) (Link, error) {
+	var link Link
+
+	tokenBytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return link, ErrInvalid
+	}
+	mac := hmac.New(sha256.New, s.key)
+	if len(tokenBytes) < mac.Size() {
+		return link, ErrInvalid
+	}
+	mac.Write(tokenBytes[mac.Size():])
+	if !hmac.Equal(mac.Sum(nil), tokenBytes[:mac.Size()]) {
+		return link, ErrInvalid
+	}
+
+	if err := json.Unmarshal(tokenBytes[mac.Size():], &link); err != nil {
+		return link, ErrInvalid
+	}
+	if !now.Before(link.Expires) {
+		return link, ErrExpired
+	}
+	return link, nil
+}
@@ -0,0 +1,46 @@
+package share
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Now()
+	signer := NewSigner("secret")
+	link := Link{
+		ID:         "id",
+		Repository: "foo/bar",
+		Digest:     digest.FromString("manifest"),
+		Expires:    now.Add(time.Hour).UTC(),
+		Once:       true,
+	}
+	token, err := signer.Sign(link)
+	if err != nil {
+		t.Fatalf("failed to sign link: %v", err)
+	}
+
+	verified, err := signer.Verify(token, now)
+	if err != nil {
+		t.Fatalf("failed to verify link: %v", err)
+	}
+	if verified != link {
+		t.Fatalf("unexpected link %+v, expected %+v", verified, link)
+	}
+
+	if _, err := signer.Verify(token, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("unexpected error verifying an expired link: %v", err)
+	}
+	if _, err := NewSigner("other").Verify(token, now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error verifying a link signed with another secret: %v", err)
+	}
+	if _, err := signer.Verify(token[:len(token)-1], now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error verifying a truncated link: %v", err)
+	}
+	if _, err := signer.Verify("not a token", now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("unexpected error verifying garbage: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ociartifact"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/manifest/schema1"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// artifactClasses maps the names of the well-known artifact classes to the
+// artifact types of their manifests.
+var artifactClasses = map[string][]string{
+	"image": {
+		v1.MediaTypeImageConfig,
+		schema2.MediaTypeImageConfig,
+	},
+	"helm": {
+		"application/vnd.cncf.helm.config.v1+json",
+	},
+	"wasm": {
+		"application/vnd.wasm.config.v0+json",
+		"application/vnd.wasm.config.v1+json",
+		"application/vnd.module.wasm.config.v1+json",
+	},
+	"sbom": {
+		"application/spdx+json",
+		"text/spdx",
+		"application/vnd.cyclonedx+json",
+		"application/vnd.cyclonedx+xml",
+		"application/vnd.syft+json",
+	},
+	"signature": {
+		"application/vnd.cncf.notary.signature",
+		"application/vnd.dev.cosign.artifact.sig.v1+json",
+		"application/vnd.dev.sigstore.bundle+json",
+		"application/vnd.dev.sigstore.bundle.v0.3+json",
+	},
+}
+
+// ArtifactClasses returns the names of the artifact classes accepted by
+// ManifestArtifactClasses, in order.
+func ArtifactClasses() []string {
+	names := make([]string, 0, len(artifactClasses))
+	for name := range artifactClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// artifactClassPolicy restricts the artifact types of pushed manifests.
+type artifactClassPolicy struct {
+	// allow, if not nil, holds the only artifact types accepted.
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// ManifestArtifactClasses is a functional option for NewRegistry. It
+// restricts the manifests pushed to those of the artifact classes in allow,
+// if any, and of none of the classes in deny. Image indexes and manifest
+// lists are not restricted, their child manifests are.
+func ManifestArtifactClasses(allow, deny []string) RegistryOption {
+	return func(registry *registry) error {
+		var err error
+		if len(allow) > 0 {
+			if registry.artifactClasses.allow, err = artifactTypesOf(allow); err != nil {
+				return err
+			}
+		}
+		registry.artifactClasses.deny, err = artifactTypesOf(deny)
+		return err
+	}
+}
+
+// artifactTypesOf returns the artifact types of the named classes.
+func artifactTypesOf(classes []string) (map[string]struct{}, error) {
+	artifactTypes := make(map[string]struct{})
+	for _, class := range classes {
+		types, ok := artifactClasses[class]
+		if !ok {
+			return nil, fmt.Errorf("unknown artifact class %q, known classes are %s", class, strings.Join(ArtifactClasses(), ", "))
+		}
+		for _, artifactType := range types {
+			artifactTypes[artifactType] = struct{}{}
+		}
+	}
+	return artifactTypes, nil
+}
+
+// verify returns an error if the artifact type of a manifest is refused.
+func (p artifactClassPolicy) verify(manifest distribution.Manifest) error {
+	if p.allow == nil && len(p.deny) == 0 {
+		return nil
+	}
+	artifactType, ok := manifestArtifactType(manifest)
+	if !ok {
+		return nil
+	}
+	// Parameters do not change the class.
+	mediaType := strings.TrimSpace(strings.SplitN(artifactType, ";", 2)[0])
+
+	_, allowed := p.allow[mediaType]
+	_, denied := p.deny[mediaType]
+	if (p.allow != nil && !allowed) || denied {
+		return distribution.ErrManifestVerification{distribution.ErrManifestArtifactTypeDenied{ArtifactType: artifactType}}
+	}
+	return nil
+}
+
+// manifestArtifactType returns the artifact type of a manifest: its
+// artifactType field if set, or else the media type of its config. Image
+// indexes and manifest lists have none.
+func manifestArtifactType(manifest distribution.Manifest) (string, bool) {
+	switch m := manifest.(type) {
+	case *schema1.SignedManifest:
+		return schema2.MediaTypeImageConfig, true
+	case *schema2.DeserializedManifest:
+		return m.Config.MediaType, true
+	case *ocischema.DeserializedManifest:
+		if m.ArtifactType != "" {
+			return m.ArtifactType, true
+		}
+		return m.Config.MediaType, true
+	case *ociartifact.DeserializedManifest:
+		return m.ArtifactType, true
+	}
+	return "", false
+}
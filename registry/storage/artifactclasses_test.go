@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestManifestArtifactClasses(t *testing.T) {
+	ctx := context.Background()
+
+	push := func(t *testing.T, registry distribution.Namespace, artifactType string) error {
+		repo := makeRepository(t, registry, "artifacts")
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), nil, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		manifest, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build manifest: %v", err)
+		}
+		_, err = makeManifestService(t, repo).Put(ctx, manifest)
+		return err
+	}
+	denied := func(err error) bool {
+		errs, ok := err.(distribution.ErrManifestVerification)
+		if !ok || len(errs) != 1 {
+			return false
+		}
+		_, ok = errs[0].(distribution.ErrManifestArtifactTypeDenied)
+		return ok
+	}
+
+	for _, tc := range []struct {
+		name         string
+		allow, deny  []string
+		artifactType string
+		denied       bool
+	}{
+		{name: "no restriction", artifactType: "application/vnd.example"},
+		{name: "allowed", allow: []string{"helm"}, artifactType: "application/vnd.cncf.helm.config.v1+json"},
+		{name: "not allowed", allow: []string{"helm"}, artifactType: "application/vnd.wasm.config.v1+json", denied: true},
+		{name: "unknown type not allowed", allow: []string{"helm", "wasm"}, artifactType: "application/vnd.example", denied: true},
+		{name: "denied", deny: []string{"sbom"}, artifactType: "application/spdx+json", denied: true},
+		{name: "denied with parameters", deny: []string{"signature"}, artifactType: "application/vnd.cncf.notary.signature; charset=utf-8", denied: true},
+		{name: "not denied", deny: []string{"sbom"}, artifactType: "application/vnd.dev.cosign.artifact.sig.v1+json"},
+		{name: "allowed and denied", allow: []string{"sbom"}, deny: []string{"sbom"}, artifactType: "application/spdx+json", denied: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			registry := createRegistry(t, inmemory.New(), ManifestArtifactClasses(tc.allow, tc.deny))
+			err := push(t, registry, tc.artifactType)
+			if tc.denied && !denied(err) {
+				t.Fatalf("expected the artifact type to be denied, got %v", err)
+			}
+			if !tc.denied && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	if _, err := NewRegistry(ctx, inmemory.New(), ManifestArtifactClasses([]string{"chart"}, nil)); err == nil {
+		t.Fatalf("expected an error for an unknown artifact class")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/storage/cache/memory"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
 	"github.com/distribution/distribution/v3/testutil"
 	"github.com/opencontainers/go-digest"
@@ -611,3 +612,50 @@ func addBlob(ctx context.Context, bs distribution.BlobIngester, desc distributio
 
 	return wr.Commit(ctx, desc)
 }
+
+// statCountingDriver counts the Stat calls of the blobs.
+type statCountingDriver struct {
+	storagedriver.StorageDriver
+	stats int
+}
+
+func (d *statCountingDriver) Stat(ctx context.Context, p string) (storagedriver.FileInfo, error) {
+	if path.Base(p) == "data" {
+		d.stats++
+	}
+	return d.StorageDriver.Stat(ctx, p)
+}
+
+// TestBlobStatterCached tests that the global statter uses the blob
+// descriptor cache.
+func TestBlobStatterCached(t *testing.T) {
+	ctx := context.Background()
+	driver := &statCountingDriver{StorageDriver: testdriver.New()}
+	registry, err := NewRegistry(ctx, driver, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	imageName, _ := reference.WithName("foo/bar")
+	repository, err := registry.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	desc, err := repository.Blobs(ctx).Put(ctx, "application/octet-stream", []byte("cached"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	driver.stats = 0
+	for i := 0; i < 3; i++ {
+		stat, err := registry.BlobStatter().Stat(ctx, desc.Digest)
+		if err != nil {
+			t.Fatalf("unexpected error statting blob: %v", err)
+		}
+		if stat.Size != desc.Size {
+			t.Fatalf("unexpected size %d, want %d", stat.Size, desc.Size)
+		}
+	}
+	if driver.stats > 1 {
+		t.Fatalf("blob statted %d times, want at most once", driver.stats)
+	}
+}
@@ -23,6 +23,17 @@ type blobServer struct {
 	redirect bool // allows disabling URLFor redirects
 }
 
+// BlobURL returns a URL from which the content of a blob is downloaded
+// straight from the storage backend until expiry. Drivers which cannot
+// sign URLs return driver.ErrUnsupportedMethod.
+func BlobURL(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest, expiry time.Time) (string, error) {
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return "", err
+	}
+	return storageDriver.URLFor(ctx, blobPath, map[string]interface{}{"method": http.MethodGet, "expiry": expiry})
+}
+
 func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
 	desc, err := bs.statter.Stat(ctx, dgst)
 	if err != nil {
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"path"
 
 	"github.com/distribution/distribution/v3"
@@ -30,8 +32,8 @@ func (bs *blobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error
 
 	p, err := getContent(ctx, bs.driver, bp)
 	if err != nil {
-		switch err.(type) {
-		case driver.PathNotFoundError:
+		switch {
+		case errors.Is(err, driver.ErrNotFound):
 			return nil, distribution.ErrBlobUnknown
 		}
 
@@ -88,12 +90,38 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 }
 
 func (bs *blobStore) Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error {
+	_, err := bs.EnumerateFrom(ctx, "", ingester)
+	return err
+}
+
+// EnumerateFrom calls ingester for each blob after marker, the digest of the
+// last blob ingested, in the order of their paths.
+func (bs *blobStore) EnumerateFrom(ctx context.Context, marker string, ingester func(dgst digest.Digest) error) (string, error) {
+	return bs.EnumerateDetailed(ctx, marker, func(info distribution.BlobInfo) error {
+		return ingester(info.Digest)
+	})
+}
+
+// EnumerateDetailed calls ingester for each blob after marker, as
+// EnumerateFrom does, with the size and modification time of the data file
+// of the blob as listed by the driver.
+func (bs *blobStore) EnumerateDetailed(ctx context.Context, marker string, ingester func(info distribution.BlobInfo) error) (string, error) {
 	specPath, err := pathFor(blobsPathSpec{})
 	if err != nil {
-		return err
+		return marker, err
+	}
+	var from string
+	if marker != "" {
+		dgst, err := digest.Parse(marker)
+		if err != nil {
+			return marker, fmt.Errorf("invalid enumeration marker %q: %v", marker, err)
+		}
+		if from, err = pathFor(blobDataPathSpec{digest: dgst}); err != nil {
+			return marker, err
+		}
 	}
 
-	return bs.driver.Walk(ctx, specPath, func(fileInfo driver.FileInfo) error {
+	err = walkFrom(ctx, bs.driver, specPath, from, func(fileInfo driver.FileInfo) error {
 		// skip directories
 		if fileInfo.IsDir() {
 			return nil
@@ -111,8 +139,13 @@ func (bs *blobStore) Enumerate(ctx context.Context, ingester func(dgst digest.Di
 			return err
 		}
 
-		return ingester(digest)
+		if err := ingester(distribution.BlobInfo{Digest: digest, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}); err != nil {
+			return err
+		}
+		marker = digest.String()
+		return nil
 	})
+	return marker, err
 }
 
 // path returns the canonical path for the blob identified by digest. The blob
@@ -172,8 +205,8 @@ func (bs *blobStatter) Stat(ctx context.Context, dgst digest.Digest) (distributi
 
 	fi, err := bs.driver.Stat(ctx, path)
 	if err != nil {
-		switch err := err.(type) {
-		case driver.PathNotFoundError:
+		switch {
+		case errors.Is(err, driver.ErrNotFound):
 			return distribution.Descriptor{}, distribution.ErrBlobUnknown
 		default:
 			return distribution.Descriptor{}, err
@@ -71,6 +71,10 @@ func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor)
 		return distribution.Descriptor{}, err
 	}
 
+	if err := fenceDigests(ctx, bw.driver, canonical.Digest, desc.Digest); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	if err := bw.moveBlob(ctx, canonical); err != nil {
 		return distribution.Descriptor{}, err
 	}
@@ -180,8 +184,8 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 
 	// Stat the on disk file
 	if fi, err := bw.driver.Stat(ctx, bw.path); err != nil {
-		switch err := err.(type) {
-		case storagedriver.PathNotFoundError:
+		switch {
+		case errors.Is(err, storagedriver.ErrNotFound):
 			// NOTE(stevvooe): We really don't care if the file is
 			// not actually present for the reader. We now assume
 			// that the desc length is zero.
@@ -245,7 +249,7 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 		// paths. We may be able to make the size-based check a stronger
 		// guarantee, so this may be defensive.
 		if !verified {
-			digester := digest.Canonical.Digester()
+			digester := bw.blobStore.hasher.digester()
 			verifier := desc.Digest.Verifier()
 
 			// Read the file from the backend driver and validate it.
@@ -303,8 +307,8 @@ func (bw *blobWriter) moveBlob(ctx context.Context, desc distribution.Descriptor
 
 	// Check for existence
 	if _, err := bw.blobStore.driver.Stat(ctx, blobPath); err != nil {
-		switch err := err.(type) {
-		case storagedriver.PathNotFoundError:
+		switch {
+		case errors.Is(err, storagedriver.ErrNotFound):
 			break // ensure that it doesn't exist.
 		default:
 			return err
@@ -322,8 +326,8 @@ func (bw *blobWriter) moveBlob(ctx context.Context, desc distribution.Descriptor
 	// case. For the most part, this should only ever happen with zero-length
 	// blobs.
 	if _, err := bw.blobStore.driver.Stat(ctx, bw.path); err != nil {
-		switch err := err.(type) {
-		case storagedriver.PathNotFoundError:
+		switch {
+		case errors.Is(err, storagedriver.ErrNotFound):
 			// HACK(stevvooe): This is slightly dangerous: if we verify above,
 			// get a hash, then the underlying file is deleted, we risk moving
 			// a zero-length blob into a nonzero-length blob location. To
@@ -364,8 +368,8 @@ func (bw *blobWriter) removeResources(ctx context.Context) error {
 	// upload related files.
 	dirPath := path.Dir(dataPath)
 	if err := bw.blobStore.driver.Delete(ctx, dirPath); err != nil {
-		switch err := err.(type) {
-		case storagedriver.PathNotFoundError:
+		switch {
+		case errors.Is(err, storagedriver.ErrNotFound):
 			break // already gone!
 		default:
 			// This should be uncommon enough such that returning an error
@@ -387,8 +391,8 @@ func (bw *blobWriter) Reader() (io.ReadCloser, error) {
 		if err == nil {
 			break
 		}
-		switch err.(type) {
-		case storagedriver.PathNotFoundError:
+		switch {
+		case errors.Is(err, storagedriver.ErrNotFound):
 			dcontext.GetLogger(bw.ctx).Debugf("Nothing found on try %d, sleeping...", try)
 			time.Sleep(1 * time.Second)
 			try++
@@ -6,6 +6,7 @@ package storage
 import (
 	"context"
 	"encoding"
+	"errors"
 	"fmt"
 	"hash"
 	"path"
@@ -92,7 +93,7 @@ func (bw *blobWriter) getStoredHashStates(ctx context.Context) ([]hashStateEntry
 
 	paths, err := bw.blobStore.driver.List(ctx, uploadHashStatePathPrefix)
 	if err != nil {
-		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		if !errors.Is(err, storagedriver.ErrNotFound) {
 			return nil, err
 		}
 		// Treat PathNotFoundError as no entries.
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// WarmBlobDescriptorCache fills the blob descriptor cache of namespace with
+// the descriptors of the manifests and blobs of the tagged images of the
+// repositories most recently tagged, up to repositories of them, so that
+// the first pulls after a restart do not all go to the storage backend. It
+// returns the number of descriptors read. A repository whose content cannot
+// be read is skipped with a warning.
+func WarmBlobDescriptorCache(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, repositories int) (int, error) {
+	repositoryEnumerator, ok := namespace.(distribution.RepositoryEnumerator)
+	if !ok {
+		return 0, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	type taggedRepository struct {
+		name     string
+		taggedAt time.Time
+	}
+	var recent []taggedRepository
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		taggedAt, err := lastTaggedAt(ctx, storageDriver, repoName)
+		if err != nil {
+			return fmt.Errorf("failed to read the tags of %s: %v", repoName, err)
+		}
+		if !taggedAt.IsZero() {
+			recent = append(recent, taggedRepository{name: repoName, taggedAt: taggedAt})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].taggedAt.After(recent[j].taggedAt) })
+	if len(recent) > repositories {
+		recent = recent[:repositories]
+	}
+
+	var warmed int
+	for _, repo := range recent {
+		if err := ctx.Err(); err != nil {
+			return warmed, err
+		}
+		n, err := warmRepository(ctx, namespace, repo.name)
+		warmed += n
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return warmed, ctxErr
+			}
+			dcontext.GetLogger(ctx).Warnf("failed to warm the blob descriptor cache for %s: %v", repo.name, err)
+		}
+	}
+	return warmed, nil
+}
+
+// lastTaggedAt returns when a tag of a repository was last pointed at a
+// manifest, from the modification times of the tag links, or the zero time
+// if it has no tags.
+func lastTaggedAt(ctx context.Context, storageDriver driver.StorageDriver, repoName string) (time.Time, error) {
+	tagsPath, err := pathFor(manifestTagsPathSpec{name: repoName})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var taggedAt time.Time
+	err = storageDriver.Walk(ctx, tagsPath, func(fi driver.FileInfo) error {
+		if fi.IsDir() {
+			// The index of previous revisions of a tag is not needed.
+			if path.Base(fi.Path()) == "index" && path.Dir(path.Dir(fi.Path())) == tagsPath {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+		if path.Base(fi.Path()) == "link" && fi.ModTime().After(taggedAt) {
+			taggedAt = fi.ModTime()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, driver.ErrNotFound) {
+		return time.Time{}, err
+	}
+	return taggedAt, nil
+}
+
+// warmRepository reads the descriptors of the tagged manifests of a
+// repository, the manifests of the image indexes among them, and the blobs
+// they reference.
+func warmRepository(ctx context.Context, namespace distribution.Namespace, repoName string) (int, error) {
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		return 0, err
+	}
+	repository, err := namespace.Repository(ctx, named)
+	if err != nil {
+		return 0, err
+	}
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return 0, err
+	}
+	blobs := repository.Blobs(ctx)
+	tagService := repository.Tags(ctx)
+	tags, err := tagService.All(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var warmed int
+	seen := make(map[digest.Digest]struct{})
+	var warmManifest func(dgst digest.Digest) error
+	warmManifest = func(dgst digest.Digest) error {
+		if _, ok := seen[dgst]; ok {
+			return nil
+		}
+		seen[dgst] = struct{}{}
+		// Fetching the manifest reads its descriptor.
+		manifest, err := manifests.Get(ctx, dgst)
+		if err != nil {
+			return err
+		}
+		warmed++
+		_, isIndex := manifest.(*manifestlist.DeserializedManifestList)
+		for _, desc := range manifest.References() {
+			if isIndex {
+				if err := warmManifest(desc.Digest); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, ok := seen[desc.Digest]; ok {
+				continue
+			}
+			seen[desc.Digest] = struct{}{}
+			// Foreign layers are not stored in the registry.
+			if len(desc.URLs) > 0 {
+				continue
+			}
+			if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+				return err
+			}
+			warmed++
+		}
+		return nil
+	}
+	for _, tag := range tags {
+		if err := ctx.Err(); err != nil {
+			return warmed, err
+		}
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			// The tag may have been deleted since it was listed.
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return warmed, err
+		}
+		if err := warmManifest(desc.Digest); err != nil {
+			return warmed, fmt.Errorf("failed to warm %s:%s: %v", repoName, tag, err)
+		}
+	}
+	return warmed, nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/cache/memory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestWarmBlobDescriptorCache(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry := createRegistry(t, driver)
+
+	images := make(map[string]image)
+	for _, name := range []string{"old", "recent", "untagged"} {
+		repo := makeRepository(t, registry, name)
+		images[name] = uploadRandomOCIImage(t, repo, nil)
+		if name == "untagged" {
+			continue
+		}
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: images[name].manifestDigest}); err != nil {
+			t.Fatal(err)
+		}
+		// Tell the tags apart by their modification times.
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cache := memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)
+	warmed, err := WarmBlobDescriptorCache(ctx, driver, createRegistry(t, driver, BlobDescriptorCacheProvider(cache)), 1)
+	if err != nil {
+		t.Fatalf("failed to warm the cache: %v", err)
+	}
+	// The manifest, its config and its two layers.
+	if warmed != 4 {
+		t.Fatalf("unexpected number of descriptors warmed %d", warmed)
+	}
+	if _, err := cache.Stat(ctx, images["recent"].manifestDigest); err != nil {
+		t.Fatalf("expected the manifest of the most recently tagged repository to be cached: %v", err)
+	}
+	for dgst := range images["recent"].layers {
+		if _, err := cache.Stat(ctx, dgst); err != nil {
+			t.Fatalf("expected layer %s to be cached: %v", dgst, err)
+		}
+	}
+	for _, name := range []string{"old", "untagged"} {
+		if _, err := cache.Stat(ctx, images[name].manifestDigest); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected the manifest of %s not to be cached, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// BlobUsage describes a blob and the repositories linking to it.
+type BlobUsage struct {
+	Digest       digest.Digest
+	Size         int64
+	Repositories []string
+}
+
+// DedupReport summarizes how blobs are shared between repositories.
+type DedupReport struct {
+	// Blobs is the number of blobs in the blob store.
+	Blobs int
+	// Size is the total size of the blobs in the blob store.
+	Size int64
+	// LinkedSize is the size the blobs would take if each repository
+	// linking to a blob held its own copy.
+	LinkedSize int64
+	// Sharing maps a number of repositories to the number of blobs linked
+	// from that many repositories.
+	Sharing map[int]int
+	// MostShared lists the blobs linked from the most repositories, in
+	// decreasing order.
+	MostShared []BlobUsage
+	// Largest lists the largest blobs, in decreasing order of size.
+	Largest []BlobUsage
+	// Orphaned lists the blobs which no repository links to, which are
+	// candidates for garbage collection.
+	Orphaned []BlobUsage
+}
+
+// DedupStats computes blob sharing statistics for the registry, listing the
+// top blobs of each category. Blobs are linked to a repository when they
+// were pushed to it, or are one of its manifests.
+func DedupStats(ctx context.Context, registry distribution.Namespace, top int) (*DedupReport, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	linked := make(map[digest.Digest][]string)
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+
+		repoLinked := make(map[digest.Digest]struct{})
+		ingest := func(dgst digest.Digest) error {
+			repoLinked[dgst] = struct{}{}
+			return nil
+		}
+
+		blobEnumerator, ok := repository.Blobs(ctx).(distribution.BlobEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert BlobStore into BlobEnumerator")
+		}
+		if err := blobEnumerator.Enumerate(ctx, ingest); err != nil {
+			if !errors.Is(err, driver.ErrNotFound) {
+				return fmt.Errorf("failed to enumerate blobs of %s: %v", repoName, err)
+			}
+		}
+
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+		if err := manifestEnumerator.Enumerate(ctx, ingest); err != nil {
+			if !errors.Is(err, driver.ErrNotFound) {
+				return fmt.Errorf("failed to enumerate manifests of %s: %v", repoName, err)
+			}
+		}
+
+		for dgst := range repoLinked {
+			linked[dgst] = append(linked[dgst], repoName)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DedupReport{Sharing: make(map[int]int)}
+	var usages []BlobUsage
+	err = enumerateBlobInfo(ctx, registry, func(info distribution.BlobInfo) error {
+		usage := BlobUsage{Digest: info.Digest, Size: info.Size, Repositories: linked[info.Digest]}
+		sort.Strings(usage.Repositories)
+		usages = append(usages, usage)
+
+		report.Blobs++
+		report.Size += info.Size
+		report.LinkedSize += info.Size * int64(len(usage.Repositories))
+		report.Sharing[len(usage.Repositories)]++
+		if len(usage.Repositories) == 0 {
+			report.Orphaned = append(report.Orphaned, usage)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating blobs: %v", err)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Digest < usages[j].Digest
+	})
+	sort.SliceStable(usages, func(i, j int) bool {
+		return len(usages[i].Repositories) > len(usages[j].Repositories)
+	})
+	for _, usage := range usages {
+		if len(report.MostShared) == top || len(usage.Repositories) < 2 {
+			break
+		}
+		report.MostShared = append(report.MostShared, usage)
+	}
+
+	sort.SliceStable(usages, func(i, j int) bool {
+		return usages[i].Size > usages[j].Size
+	})
+	if len(usages) > top {
+		usages = usages[:top]
+	}
+	report.Largest = usages
+
+	sort.SliceStable(report.Orphaned, func(i, j int) bool {
+		return report.Orphaned[i].Size > report.Orphaned[j].Size
+	})
+	if len(report.Orphaned) > top {
+		report.Orphaned = report.Orphaned[:top]
+	}
+
+	return report, nil
+}
+
+// enumerateBlobInfo calls ingester for each blob of the registry, with its
+// size as listed by the storage if the registry enumerates blobs with their
+// details, or as returned by a Stat of the blob otherwise.
+func enumerateBlobInfo(ctx context.Context, registry distribution.Namespace, ingester func(info distribution.BlobInfo) error) error {
+	if detailed, ok := registry.Blobs().(distribution.DetailedBlobEnumerator); ok {
+		_, err := detailed.EnumerateDetailed(ctx, "", ingester)
+		return err
+	}
+	statter := registry.BlobStatter()
+	return registry.Blobs().Enumerate(ctx, func(dgst digest.Digest) error {
+		desc, err := statter.Stat(ctx, dgst)
+		if err != nil {
+			return fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+		}
+		return ingester(distribution.BlobInfo{Digest: dgst, Size: desc.Size})
+	})
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+)
+
+func TestDedupStats(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+
+	sharedLayers, err := testutil.CreateRandomLayers(2)
+	if err != nil {
+		t.Fatalf("failed to make layers: %v", err)
+	}
+	sharedKeys := getKeys(sharedLayers)
+	for _, name := range []string{"a", "b"} {
+		repo := makeRepository(t, registry, name)
+		manifest, err := testutil.MakeSchema2Manifest(repo, sharedKeys)
+		if err != nil {
+			t.Fatalf("failed to make manifest: %v", err)
+		}
+		for _, rs := range sharedLayers {
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+		}
+		uploadImage(t, repo, image{manifest: manifest, layers: sharedLayers})
+	}
+
+	repo := makeRepository(t, registry, "c")
+	uploadRandomSchema2Image(t, repo)
+	orphanLayers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("failed to make layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(repo, orphanLayers); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+	orphan := getAnyKey(orphanLayers)
+	if err := repo.Blobs(ctx).Delete(ctx, orphan); err != nil {
+		t.Fatalf("failed to unlink layer: %v", err)
+	}
+
+	report, err := DedupStats(ctx, registry, 10)
+	if err != nil {
+		t.Fatalf("failed to compute dedup stats: %v", err)
+	}
+
+	// The image shared by a and b, the image in c and the orphan. All
+	// images share the same empty config.
+	if report.Blobs != 8 {
+		t.Errorf("expected 8 blobs, got %d", report.Blobs)
+	}
+	if !reflect.DeepEqual(report.Sharing, map[int]int{0: 1, 1: 3, 2: 3, 3: 1}) {
+		t.Errorf("unexpected sharing histogram: %v", report.Sharing)
+	}
+	if len(report.MostShared) != 4 {
+		t.Fatalf("expected 4 shared blobs, got %v", report.MostShared)
+	}
+	if !reflect.DeepEqual(report.MostShared[0].Repositories, []string{"a", "b", "c"}) {
+		t.Errorf("expected the config to be the most shared blob, got %v", report.MostShared[0])
+	}
+	for _, usage := range report.MostShared[1:] {
+		if !reflect.DeepEqual(usage.Repositories, []string{"a", "b"}) {
+			t.Errorf("unexpected shared blob: %v", usage)
+		}
+	}
+	if len(report.Orphaned) != 1 || report.Orphaned[0].Digest != orphan {
+		t.Errorf("expected %s to be orphaned, got %v", orphan, report.Orphaned)
+	}
+	if len(report.Largest) != 8 || report.Largest[0].Size < report.Largest[7].Size {
+		t.Errorf("unexpected largest blobs: %v", report.Largest)
+	}
+
+	var savedSize int64
+	for _, usage := range report.MostShared {
+		savedSize += usage.Size * int64(len(usage.Repositories)-1)
+	}
+	if report.LinkedSize-report.Size != savedSize-report.Orphaned[0].Size {
+		t.Errorf("unexpected linked size %d for size %d", report.LinkedSize, report.Size)
+	}
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// DeleteOpts contains options for DeleteManifest.
+type DeleteOpts struct {
+	DryRun bool
+	// CascadeReferrers deletes the referrers of the manifest as well, and
+	// their own referrers, recursively.
+	CascadeReferrers bool
+}
+
+// DeleteReport describes what DeleteManifest deleted, or would delete in a
+// dry run.
+type DeleteReport struct {
+	// Manifests lists the deleted manifests, referrers first, along with
+	// the tags pointing at them.
+	Manifests []ManifestDel
+	// KeptReferrers lists the referrers of the deleted manifests which are
+	// left in place without CascadeReferrers.
+	KeptReferrers []digest.Digest
+}
+
+// DeleteManifest deletes a manifest of the named repository straight from
+// the storage, without a garbage collection, along with the tags pointing
+// at it and its link to its subject. The blobs it references are left for
+// the next garbage collection to delete.
+func DeleteManifest(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, repoName string, dgst digest.Digest, opts DeleteOpts) (DeleteReport, error) {
+	var report DeleteReport
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		return report, err
+	}
+	repository, err := namespace.Repository(ctx, named)
+	if err != nil {
+		return report, err
+	}
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return report, err
+	}
+	lister, _ := repository.(distribution.ReferrersLister)
+	allTags, err := repository.Tags(ctx).All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+			return report, fmt.Errorf("failed to retrieve tags: %v", err)
+		}
+	}
+
+	// The manifests are listed subjects first, and deleted referrers first,
+	// so that an interrupted deletion leaves no referrer without subject.
+	var manifests []distribution.Manifest
+	visited := map[digest.Digest]struct{}{dgst: {}}
+	for queue := []digest.Digest{dgst}; len(queue) > 0; queue = queue[1:] {
+		manifest, err := manifestService.Get(ctx, queue[0])
+		if err != nil {
+			return report, err
+		}
+		tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: queue[0]})
+		if err != nil {
+			return report, fmt.Errorf("failed to retrieve tags for digest %v: %v", queue[0], err)
+		}
+		report.Manifests = append(report.Manifests, ManifestDel{Name: repoName, Digest: queue[0], Tags: allTags, Untag: tags, Artifact: isArtifactManifest(manifest)})
+		manifests = append(manifests, manifest)
+
+		if lister == nil {
+			continue
+		}
+		referrers, err := lister.Referrers(ctx, queue[0])
+		if err != nil {
+			return report, fmt.Errorf("failed to list referrers of %v: %v", queue[0], err)
+		}
+		for _, referrer := range referrers {
+			if _, ok := visited[referrer.Digest]; ok {
+				continue
+			}
+			visited[referrer.Digest] = struct{}{}
+			if opts.CascadeReferrers {
+				queue = append(queue, referrer.Digest)
+			} else {
+				report.KeptReferrers = append(report.KeptReferrers, referrer.Digest)
+			}
+		}
+	}
+	for i, j := 0, len(report.Manifests)-1; i < j; i, j = i+1, j-1 {
+		report.Manifests[i], report.Manifests[j] = report.Manifests[j], report.Manifests[i]
+		manifests[i], manifests[j] = manifests[j], manifests[i]
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	reg, _ := namespace.(*registry)
+	vacuum := NewVacuum(ctx, storageDriver)
+	subjects := make(map[digest.Digest]struct{})
+	for i, del := range report.Manifests {
+		subjects[del.Digest] = struct{}{}
+		if subject := manifestSubject(manifests[i]); subject != nil {
+			subjects[subject.Digest] = struct{}{}
+			if err := vacuum.RemoveReferrerLink(repoName, subject.Digest, del.Digest); err != nil && !errors.Is(err, driver.ErrNotFound) {
+				return report, fmt.Errorf("failed to delete referrer link of %s: %v", del.Digest, err)
+			}
+			if reg != nil {
+				reg.referrerLinkCache.invalidate(repoName, subject.Digest)
+			}
+		}
+		// Like for the deletions through the API, the blobs are queued for
+		// collection before the manifest is unlinked, and its references
+		// are removed after.
+		var references []digest.Digest
+		if reg != nil && reg.referenceIndex {
+			references = manifestReferences(manifests[i])
+			if err := queueCandidates(ctx, storageDriver, append([]digest.Digest{del.Digest}, references...)); err != nil {
+				return report, err
+			}
+		}
+		if err := vacuum.RemoveManifest(repoName, del.Digest, del.Tags); err != nil {
+			return report, fmt.Errorf("failed to delete manifest %s: %v", del.Digest, err)
+		}
+		if reg != nil && reg.referenceIndex {
+			if err := removeReferences(ctx, storageDriver, repoName, del.Digest, references); err != nil {
+				return report, err
+			}
+		}
+		for _, tag := range del.Untag {
+			if err := vacuum.RemoveTag(repoName, tag); err != nil {
+				return report, fmt.Errorf("failed to delete tag %s: %v", tag, err)
+			}
+		}
+	}
+
+	// The referrers tags of the subjects of the deleted referrers, and of
+	// the deleted manifests, may list manifests which are gone.
+	dcontext.GetLogger(ctx).Debugf("updating the referrers tags of %d subjects", len(subjects))
+	if err := refreshReferrersTags(ctx, namespace, map[string]map[digest.Digest]struct{}{repoName: subjects}); err != nil {
+		return report, fmt.Errorf("failed to update referrers tags: %v", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDeleteManifest(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry := createRegistry(t, driver)
+	repo := makeRepository(t, registry, "delete")
+	manifestService := makeManifestService(t, repo)
+
+	pushReferrer := func(subject digest.Digest, artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	exists := func(dgst digest.Digest) bool {
+		exists, err := manifestService.Exists(ctx, dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exists
+	}
+
+	kept := uploadRandomOCIImage(t, repo, nil)
+	subject := uploadRandomOCIImage(t, repo, nil)
+	for tag, dgst := range map[string]digest.Digest{"kept": kept.manifestDigest, "latest": subject.manifestDigest, "v1": subject.manifestDigest} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signature := pushReferrer(subject.manifestDigest, "application/vnd.example.signature")
+	countersignature := pushReferrer(signature, "application/vnd.example.signature")
+
+	report, err := DeleteManifest(ctx, driver, registry, "delete", subject.manifestDigest, DeleteOpts{DryRun: true})
+	if err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+	if len(report.Manifests) != 1 || report.Manifests[0].Digest != subject.manifestDigest || len(report.Manifests[0].Untag) != 2 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	if len(report.KeptReferrers) != 1 || report.KeptReferrers[0] != signature {
+		t.Fatalf("expected signature to be kept, got %v", report.KeptReferrers)
+	}
+	if !exists(subject.manifestDigest) {
+		t.Fatal("expected dry run to keep the manifest")
+	}
+
+	report, err = DeleteManifest(ctx, driver, registry, "delete", subject.manifestDigest, DeleteOpts{CascadeReferrers: true})
+	if err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+	if len(report.Manifests) != 3 || report.Manifests[0].Digest != countersignature || report.Manifests[2].Digest != subject.manifestDigest {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for _, dgst := range []digest.Digest{subject.manifestDigest, signature, countersignature} {
+		if exists(dgst) {
+			t.Fatalf("expected %s to be deleted", dgst)
+		}
+	}
+	if !exists(kept.manifestDigest) {
+		t.Fatal("expected other manifest to be kept")
+	}
+	tags, err := repo.Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "kept" {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	links, err := walkSubjectReferrerLinks(ctx, driver, "delete", subject.manifestDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 0 {
+		t.Fatalf("expected referrer links to be deleted, got %v", links)
+	}
+
+	// The blobs are left to the garbage collection.
+	if _, err := registry.BlobStatter().Stat(ctx, subject.manifestDigest); err != nil {
+		t.Fatalf("expected manifest blob to be kept: %v", err)
+	}
+}
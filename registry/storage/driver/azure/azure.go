@@ -292,6 +292,17 @@ func (d *driver) List(ctx context.Context, path string) ([]string, error) {
 // Move moves an object stored at sourcePath to destPath, removing the original
 // object.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.Copy(ctx, sourcePath, destPath); err != nil {
+		return err
+	}
+
+	srcBlobRef := d.client.GetContainerReference(d.container).GetBlobReference(sourcePath)
+	return srcBlobRef.Delete(nil)
+}
+
+// Copy copies an object stored at sourcePath to destPath, leaving the
+// original object in place.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
 	srcBlobRef := d.client.GetContainerReference(d.container).GetBlobReference(sourcePath)
 	sourceBlobURL := srcBlobRef.GetURL()
 	destBlobRef := d.client.GetContainerReference(d.container).GetBlobReference(destPath)
@@ -302,8 +313,7 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 		}
 		return err
 	}
-
-	return srcBlobRef.Delete(nil)
+	return nil
 }
 
 // Delete recursively deletes all objects stored at "path" and its subpaths.
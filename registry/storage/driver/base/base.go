@@ -6,14 +6,14 @@
 // struct such that calls are proxied through this implementation. First,
 // declare the internal driver, as follows:
 //
-// 	type driver struct { ... internal ...}
+//	type driver struct { ... internal ...}
 //
 // The resulting type should implement StorageDriver such that it can be the
 // target of a Base struct. The exported type can then be declared as follows:
 //
-// 	type Driver struct {
-// 		Base
-// 	}
+//	type Driver struct {
+//		Base
+//	}
 //
 // Because Driver embeds Base, it effectively implements Base. If the driver
 // needs to intercept a call, before going to base, Driver should implement
@@ -23,15 +23,15 @@
 // To further shield the embed from other packages, it is recommended to
 // employ a private embed struct:
 //
-// 	type baseEmbed struct {
-// 		base.Base
-// 	}
+//	type baseEmbed struct {
+//		base.Base
+//	}
 //
 // Then, declare driver to embed baseEmbed, rather than Base directly:
 //
-// 	type Driver struct {
-// 		baseEmbed
-// 	}
+//	type Driver struct {
+//		baseEmbed
+//	}
 //
 // The type now implements StorageDriver, proxying through Base, without
 // exporting an unnecessary field.
@@ -39,12 +39,16 @@ package base
 
 import (
 	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"time"
 
 	dcontext "github.com/distribution/distribution/v3/context"
 	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/distribution/distribution/v3/registry/loglevel"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/watchdog"
 	"github.com/docker/go-metrics"
 )
 
@@ -80,7 +84,25 @@ func (base *Base) setDriverName(e error) error {
 	case storagedriver.InvalidOffsetError:
 		actual.DriverName = base.StorageDriver.Name()
 		return actual
+	case storagedriver.AccessDeniedError:
+		actual.DriverName = base.StorageDriver.Name()
+		return actual
+	case storagedriver.ThrottledError:
+		actual.DriverName = base.StorageDriver.Name()
+		return actual
+	case storagedriver.TimeoutError:
+		actual.DriverName = base.StorageDriver.Name()
+		return actual
 	default:
+		// Classify the errors drivers share, such as those of the
+		// filesystem and of HTTP clients.
+		var timeout interface{ Timeout() bool }
+		switch {
+		case errors.Is(e, fs.ErrPermission):
+			return storagedriver.AccessDeniedError{DriverName: base.StorageDriver.Name(), Enclosed: e}
+		case errors.Is(e, context.DeadlineExceeded), errors.As(e, &timeout) && timeout.Timeout():
+			return storagedriver.TimeoutError{DriverName: base.StorageDriver.Name(), Enclosed: e}
+		}
 		storageError := storagedriver.Error{
 			DriverName: base.StorageDriver.Name(),
 			Enclosed:   e,
@@ -92,8 +114,9 @@ func (base *Base) setDriverName(e error) error {
 
 // GetContent wraps GetContent of underlying storage driver.
 func (base *Base) GetContent(ctx context.Context, path string) ([]byte, error) {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.GetContent(%q)", base.Name(), path)
+	defer watchdog.StorageOperation(ctx, base.Name(), "GetContent", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -107,8 +130,9 @@ func (base *Base) GetContent(ctx context.Context, path string) ([]byte, error) {
 
 // PutContent wraps PutContent of underlying storage driver.
 func (base *Base) PutContent(ctx context.Context, path string, content []byte) error {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.PutContent(%q)", base.Name(), path)
+	defer watchdog.StorageOperation(ctx, base.Name(), "PutContent", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -122,8 +146,9 @@ func (base *Base) PutContent(ctx context.Context, path string, content []byte) e
 
 // Reader wraps Reader of underlying storage driver.
 func (base *Base) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.Reader(%q, %d)", base.Name(), path, offset)
+	defer watchdog.StorageOperation(ctx, base.Name(), "Reader", path)()
 
 	if offset < 0 {
 		return nil, storagedriver.InvalidOffsetError{Path: path, Offset: offset, DriverName: base.StorageDriver.Name()}
@@ -139,8 +164,9 @@ func (base *Base) Reader(ctx context.Context, path string, offset int64) (io.Rea
 
 // Writer wraps Writer of underlying storage driver.
 func (base *Base) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.Writer(%q, %v)", base.Name(), path, append)
+	defer watchdog.StorageOperation(ctx, base.Name(), "Writer", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -152,8 +178,9 @@ func (base *Base) Writer(ctx context.Context, path string, append bool) (storage
 
 // Stat wraps Stat of underlying storage driver.
 func (base *Base) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.Stat(%q)", base.Name(), path)
+	defer watchdog.StorageOperation(ctx, base.Name(), "Stat", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -167,8 +194,9 @@ func (base *Base) Stat(ctx context.Context, path string) (storagedriver.FileInfo
 
 // List wraps List of underlying storage driver.
 func (base *Base) List(ctx context.Context, path string) ([]string, error) {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.List(%q)", base.Name(), path)
+	defer watchdog.StorageOperation(ctx, base.Name(), "List", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
 		return nil, storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -182,8 +210,9 @@ func (base *Base) List(ctx context.Context, path string) ([]string, error) {
 
 // Move wraps Move of underlying storage driver.
 func (base *Base) Move(ctx context.Context, sourcePath string, destPath string) error {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.Move(%q, %q", base.Name(), sourcePath, destPath)
+	defer watchdog.StorageOperation(ctx, base.Name(), "Move", sourcePath)()
 
 	if !storagedriver.PathRegexp.MatchString(sourcePath) {
 		return storagedriver.InvalidPathError{Path: sourcePath, DriverName: base.StorageDriver.Name()}
@@ -197,10 +226,29 @@ func (base *Base) Move(ctx context.Context, sourcePath string, destPath string)
 	return err
 }
 
+// Copy wraps Copy of underlying storage driver.
+func (base *Base) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
+	defer done("%s.Copy(%q, %q)", base.Name(), sourcePath, destPath)
+	defer watchdog.StorageOperation(ctx, base.Name(), "Copy", sourcePath)()
+
+	if !storagedriver.PathRegexp.MatchString(sourcePath) {
+		return storagedriver.InvalidPathError{Path: sourcePath, DriverName: base.StorageDriver.Name()}
+	} else if !storagedriver.PathRegexp.MatchString(destPath) {
+		return storagedriver.InvalidPathError{Path: destPath, DriverName: base.StorageDriver.Name()}
+	}
+
+	start := time.Now()
+	err := base.setDriverName(base.StorageDriver.Copy(ctx, sourcePath, destPath))
+	storageAction.WithValues(base.Name(), "Copy").UpdateSince(start)
+	return err
+}
+
 // Delete wraps Delete of underlying storage driver.
 func (base *Base) Delete(ctx context.Context, path string) error {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.Delete(%q)", base.Name(), path)
+	defer watchdog.StorageOperation(ctx, base.Name(), "Delete", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -214,8 +262,9 @@ func (base *Base) Delete(ctx context.Context, path string) error {
 
 // URLFor wraps URLFor of underlying storage driver.
 func (base *Base) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.URLFor(%q)", base.Name(), path)
+	defer watchdog.StorageOperation(ctx, base.Name(), "URLFor", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) {
 		return "", storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
@@ -229,12 +278,20 @@ func (base *Base) URLFor(ctx context.Context, path string, options map[string]in
 
 // Walk wraps Walk of underlying storage driver.
 func (base *Base) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
-	ctx, done := dcontext.WithTrace(ctx)
+	ctx, done := dcontext.WithTrace(loglevel.WithModule(ctx, loglevel.Storage))
 	defer done("%s.Walk(%q)", base.Name(), path)
+	defer watchdog.StorageOperation(ctx, base.Name(), "Walk", path)()
 
 	if !storagedriver.PathRegexp.MatchString(path) && path != "/" {
 		return storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
 	}
 
-	return base.setDriverName(base.StorageDriver.Walk(ctx, path, f))
+	// Stop walking as soon as the context is done, whatever the driver.
+	walkFn := func(fileInfo storagedriver.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return f(fileInfo)
+	}
+	return base.setDriverName(base.StorageDriver.Walk(ctx, path, walkFn))
 }
@@ -0,0 +1,106 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// failingDriver fails reading any content with err.
+type failingDriver struct {
+	storagedriver.StorageDriver
+	err error
+}
+
+func (d *failingDriver) Name() string {
+	return "failing"
+}
+
+func (d *failingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	return nil, d.err
+}
+
+func TestErrorClasses(t *testing.T) {
+	backendErr := errors.New("backend error")
+	for _, tc := range []struct {
+		err       error
+		class     error
+		retryable bool
+	}{
+		{err: storagedriver.PathNotFoundError{Path: "/a"}, class: storagedriver.ErrNotFound},
+		{err: fmt.Errorf("open /a: %w", fs.ErrPermission), class: storagedriver.ErrAccessDenied},
+		{err: storagedriver.AccessDeniedError{Path: "/a", Enclosed: backendErr}, class: storagedriver.ErrAccessDenied},
+		{err: storagedriver.ThrottledError{Path: "/a", Enclosed: backendErr}, class: storagedriver.ErrThrottled, retryable: true},
+		{err: fmt.Errorf("request: %w", context.DeadlineExceeded), class: storagedriver.ErrTimeout, retryable: true},
+		{err: fmt.Errorf("read: %w", os.ErrDeadlineExceeded), class: storagedriver.ErrTimeout, retryable: true},
+		{err: backendErr},
+	} {
+		base := &Base{StorageDriver: &failingDriver{err: tc.err}}
+		_, err := base.GetContent(context.Background(), "/a")
+		for _, class := range []error{storagedriver.ErrNotFound, storagedriver.ErrAccessDenied, storagedriver.ErrThrottled, storagedriver.ErrTimeout} {
+			if errors.Is(err, class) != (class == tc.class) {
+				t.Errorf("errors.Is(%v, %v) = %t", err, class, !(class == tc.class))
+			}
+		}
+		if storagedriver.IsRetryable(err) != tc.retryable {
+			t.Errorf("IsRetryable(%v) = %t", err, !tc.retryable)
+		}
+		// The error of the backend is still reachable.
+		if errors.Is(tc.err, backendErr) && !errors.Is(err, backendErr) {
+			t.Errorf("%v does not wrap %v", err, backendErr)
+		}
+	}
+}
+
+// listingDriver walks its files without checking the context.
+type listingDriver struct {
+	storagedriver.StorageDriver
+	files []string
+}
+
+func (d *listingDriver) Name() string {
+	return "listing"
+}
+
+func (d *listingDriver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
+	for _, file := range d.files {
+		if err := f(storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{Path: file}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWalkCancelled(t *testing.T) {
+	base := &Base{StorageDriver: &listingDriver{files: []string{"/a", "/b", "/c"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var walked []string
+	err := base.Walk(ctx, "/", func(fileInfo storagedriver.FileInfo) error {
+		walked = append(walked, fileInfo.Path())
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the walk to be cancelled, got %v", err)
+	}
+	if len(walked) != 1 {
+		t.Fatalf("walked %v after the cancellation", walked)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	err = base.Walk(ctx, "/", func(fileInfo storagedriver.FileInfo) error {
+		t.Fatalf("walked %s past the deadline", fileInfo.Path())
+		return nil
+	})
+	if !errors.Is(err, storagedriver.ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the walk to time out, got %v", err)
+	}
+}
@@ -164,6 +164,15 @@ func (r *regulator) Move(ctx context.Context, sourcePath string, destPath string
 	return r.StorageDriver.Move(ctx, sourcePath, destPath)
 }
 
+// Copy copies an object stored at sourcePath to destPath, leaving the
+// original object in place.
+func (r *regulator) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	r.enter()
+	defer r.exit()
+
+	return r.StorageDriver.Copy(ctx, sourcePath, destPath)
+}
+
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (r *regulator) Delete(ctx context.Context, path string) error {
 	r.enter()
@@ -0,0 +1,33 @@
+package driver
+
+import (
+	"context"
+	"io"
+)
+
+// CopyFallback copies an object stored at sourcePath to destPath by reading
+// it through the driver and writing it back. It is used by drivers which
+// cannot copy objects server-side.
+func CopyFallback(ctx context.Context, driver StorageDriver, sourcePath string, destPath string) error {
+	rc, err := driver.Reader(ctx, sourcePath, 0)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	fw, err := driver.Writer(ctx, destPath, false)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(fw, rc); err != nil {
+		fw.Cancel()
+		fw.Close()
+		return err
+	}
+	if err := fw.Commit(); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
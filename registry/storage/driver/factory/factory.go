@@ -54,6 +54,13 @@ func Create(name string, parameters map[string]interface{}) (storagedriver.Stora
 	return driverFactory.Create(parameters)
 }
 
+// Registered reports whether a storage driver has been registered with the
+// given name.
+func Registered(name string) bool {
+	_, ok := driverFactories[name]
+	return ok
+}
+
 // InvalidStorageDriverError records an attempt to construct an unregistered storage driver
 type InvalidStorageDriverError struct {
 	Name string
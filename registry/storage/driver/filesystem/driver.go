@@ -268,6 +268,12 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	return err
 }
 
+// Copy copies an object stored at sourcePath to destPath, leaving the
+// original object in place.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	return storagedriver.CopyFallback(ctx, d, sourcePath, destPath)
+}
+
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (d *driver) Delete(ctx context.Context, subPath string) error {
 	fullPath := d.fullPath(subPath)
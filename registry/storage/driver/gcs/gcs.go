@@ -680,8 +680,22 @@ func (d *driver) List(context context.Context, path string) ([]string, error) {
 // Move moves an object stored at sourcePath to destPath, removing the
 // original object.
 func (d *driver) Move(context context.Context, sourcePath string, destPath string) error {
-	gcsContext := d.context(context)
-	_, err := storageCopyObject(gcsContext, d.bucket, d.pathToKey(sourcePath), d.bucket, d.pathToKey(destPath), nil)
+	if err := d.Copy(context, sourcePath, destPath); err != nil {
+		return err
+	}
+	err := storageDeleteObject(d.context(context), d.bucket, d.pathToKey(sourcePath))
+	// if deleting the file fails, log the error, but do not fail; the file was successfully copied,
+	// and the original should eventually be cleaned when purging the uploads folder.
+	if err != nil {
+		logrus.Infof("error deleting file: %v due to %v", sourcePath, err)
+	}
+	return nil
+}
+
+// Copy copies an object stored at sourcePath to destPath, leaving the
+// original object in place.
+func (d *driver) Copy(context context.Context, sourcePath string, destPath string) error {
+	_, err := storageCopyObject(d.context(context), d.bucket, d.pathToKey(sourcePath), d.bucket, d.pathToKey(destPath), nil)
 	if err != nil {
 		if status, ok := err.(*googleapi.Error); ok {
 			if status.Code == http.StatusNotFound {
@@ -690,12 +704,6 @@ func (d *driver) Move(context context.Context, sourcePath string, destPath strin
 		}
 		return err
 	}
-	err = storageDeleteObject(gcsContext, d.bucket, d.pathToKey(sourcePath))
-	// if deleting the file fails, log the error, but do not fail; the file was successfully copied,
-	// and the original should eventually be cleaned when purging the uploads folder.
-	if err != nil {
-		logrus.Infof("error deleting file: %v due to %v", sourcePath, err)
-	}
 	return nil
 }
 
@@ -410,17 +410,26 @@ const maxConcurrency = 10
 // object.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
 	logrus.Infof("Move from %s to %s", d.ossPath(sourcePath), d.ossPath(destPath))
+	if err := d.Copy(ctx, sourcePath, destPath); err != nil {
+		return err
+	}
+
+	return d.Delete(ctx, sourcePath)
+}
+
+// Copy copies an object stored at sourcePath to destPath, leaving the
+// original object in place.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
 	err := d.Bucket.CopyLargeFileInParallel(d.ossPath(sourcePath), d.ossPath(destPath),
 		d.getContentType(),
 		getPermissions(),
 		d.getOptions(),
 		maxConcurrency)
 	if err != nil {
-		logrus.Errorf("Failed for move from %s to %s: %v", d.ossPath(sourcePath), d.ossPath(destPath), err)
+		logrus.Errorf("Failed for copy from %s to %s: %v", d.ossPath(sourcePath), d.ossPath(destPath), err)
 		return parseError(sourcePath, err)
 	}
-
-	return d.Delete(ctx, sourcePath)
+	return nil
 }
 
 // Delete recursively deletes all objects stored at "path" and its subpaths.
@@ -503,6 +512,14 @@ func parseError(path string, err error) error {
 	if ossErr, ok := err.(*oss.Error); ok && ossErr.StatusCode == http.StatusNotFound && (ossErr.Code == "NoSuchKey" || ossErr.Code == "") {
 		return storagedriver.PathNotFoundError{Path: path}
 	}
+	if ossErr, ok := err.(*oss.Error); ok {
+		switch {
+		case ossErr.StatusCode == http.StatusForbidden:
+			return storagedriver.AccessDeniedError{Path: path, Enclosed: err}
+		case ossErr.StatusCode == http.StatusServiceUnavailable, ossErr.Code == "Throttling":
+			return storagedriver.ThrottledError{Path: path, Enclosed: err}
+		}
+	}
 
 	return err
 }
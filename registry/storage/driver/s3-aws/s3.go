@@ -831,6 +831,12 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	return d.Delete(ctx, sourcePath)
 }
 
+// Copy copies an object stored at sourcePath to destPath, leaving the
+// original object in place.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	return d.copy(ctx, sourcePath, destPath)
+}
+
 // copy copies an object stored at sourcePath to destPath.
 func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) error {
 	// S3 can copy objects up to 5 GB in size with a single PUT Object - Copy
@@ -1211,8 +1217,19 @@ func (d *Driver) S3BucketKey(path string) string {
 }
 
 func parseError(path string, err error) error {
-	if s3Err, ok := err.(awserr.Error); ok && s3Err.Code() == "NoSuchKey" {
+	s3Err, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	switch s3Err.Code() {
+	case "NoSuchKey":
 		return storagedriver.PathNotFoundError{Path: path}
+	case "AccessDenied", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch", "AllAccessDisabled":
+		return storagedriver.AccessDeniedError{Path: path, Enclosed: err}
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded":
+		return storagedriver.ThrottledError{Path: path, Enclosed: err}
+	case "RequestTimeout":
+		return storagedriver.TimeoutError{Path: path, Enclosed: err}
 	}
 
 	return err
@@ -2,6 +2,7 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
@@ -75,6 +76,11 @@ type StorageDriver interface {
 	// many implementations.
 	Move(ctx context.Context, sourcePath string, destPath string) error
 
+	// Copy copies an object stored at sourcePath to destPath, leaving the
+	// original object in place. Drivers for backends able to copy objects
+	// server-side should do so; others may use CopyFallback.
+	Copy(ctx context.Context, sourcePath string, destPath string) error
+
 	// Delete recursively deletes all objects stored at "path" and its subpaths.
 	Delete(ctx context.Context, path string) error
 
@@ -118,6 +124,25 @@ type FileWriter interface {
 // hyphen.
 var PathRegexp = regexp.MustCompile(`^(/[A-Za-z0-9._-]+)+$`)
 
+// The classes of storage driver errors, to be tested with errors.Is
+// regardless of the driver and of how the error was wrapped.
+var (
+	// ErrNotFound is matched by PathNotFoundError.
+	ErrNotFound = errors.New("path not found")
+	// ErrAccessDenied is matched by AccessDeniedError.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrThrottled is matched by ThrottledError.
+	ErrThrottled = errors.New("throttled")
+	// ErrTimeout is matched by TimeoutError.
+	ErrTimeout = errors.New("timeout")
+)
+
+// IsRetryable reports whether an operation which failed with err may
+// succeed if retried later, the backend having throttled it or timed out.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrThrottled) || errors.Is(err, ErrTimeout)
+}
+
 // ErrUnsupportedMethod may be returned in the case where a StorageDriver implementation does not support an optional method.
 type ErrUnsupportedMethod struct {
 	DriverName string
@@ -137,6 +162,76 @@ func (err PathNotFoundError) Error() string {
 	return fmt.Sprintf("%s: Path not found: %s", err.DriverName, err.Path)
 }
 
+// Is reports whether target is ErrNotFound.
+func (err PathNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// AccessDeniedError is returned when the storage backend refuses to
+// authorize an operation.
+type AccessDeniedError struct {
+	Path       string
+	DriverName string
+	Enclosed   error
+}
+
+func (err AccessDeniedError) Error() string {
+	return fmt.Sprintf("%s: access denied: %s: %v", err.DriverName, err.Path, err.Enclosed)
+}
+
+// Is reports whether target is ErrAccessDenied.
+func (err AccessDeniedError) Is(target error) bool {
+	return target == ErrAccessDenied
+}
+
+// Unwrap returns the error of the storage backend.
+func (err AccessDeniedError) Unwrap() error {
+	return err.Enclosed
+}
+
+// ThrottledError is returned when the storage backend rejects an operation
+// because of its rate limits.
+type ThrottledError struct {
+	Path       string
+	DriverName string
+	Enclosed   error
+}
+
+func (err ThrottledError) Error() string {
+	return fmt.Sprintf("%s: throttled: %s: %v", err.DriverName, err.Path, err.Enclosed)
+}
+
+// Is reports whether target is ErrThrottled.
+func (err ThrottledError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+// Unwrap returns the error of the storage backend.
+func (err ThrottledError) Unwrap() error {
+	return err.Enclosed
+}
+
+// TimeoutError is returned when an operation timed out.
+type TimeoutError struct {
+	Path       string
+	DriverName string
+	Enclosed   error
+}
+
+func (err TimeoutError) Error() string {
+	return fmt.Sprintf("%s: timeout: %s: %v", err.DriverName, err.Path, err.Enclosed)
+}
+
+// Is reports whether target is ErrTimeout.
+func (err TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// Unwrap returns the error of the storage backend.
+func (err TimeoutError) Unwrap() error {
+	return err.Enclosed
+}
+
 // InvalidPathError is returned when the provided path is malformed.
 type InvalidPathError struct {
 	Path       string
@@ -169,3 +264,8 @@ type Error struct {
 func (err Error) Error() string {
 	return fmt.Sprintf("%s: %s", err.DriverName, err.Enclosed)
 }
+
+// Unwrap returns the enclosed error.
+func (err Error) Unwrap() error {
+	return err.Enclosed
+}
@@ -516,6 +516,24 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	return err
 }
 
+// Copy copies an object stored at sourcePath to destPath, leaving the
+// original object in place.
+func (d *driver) Copy(ctx context.Context, sourcePath string, destPath string) error {
+	_, headers, err := d.Conn.Object(d.Container, d.swiftPath(sourcePath))
+	if err == nil {
+		if _, ok := headers["X-Object-Manifest"]; ok {
+			// Copying a dynamic large object would share its segments
+			// with the original, so copy the content instead.
+			return storagedriver.CopyFallback(ctx, d, sourcePath, destPath)
+		}
+		_, err = d.Conn.ObjectCopy(d.Container, d.swiftPath(sourcePath), d.Container, d.swiftPath(destPath), nil)
+	}
+	if err == swift.ObjectNotFound {
+		return storagedriver.PathNotFoundError{Path: sourcePath}
+	}
+	return err
+}
+
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (d *driver) Delete(ctx context.Context, path string) error {
 	opts := swift.ObjectsOpts{
@@ -600,6 +600,57 @@ func (suite *DriverSuite) TestMoveInvalid(c *check.C) {
 	c.Assert(err, check.NotNil) // non-nil error
 }
 
+// TestCopy checks that a copied object exists at both the source and the
+// destination path, overwriting the contents at the destination.
+func (suite *DriverSuite) TestCopy(c *check.C) {
+	sourcePath := randomPath(32)
+	destPath := randomPath(32)
+	sourceContents := randomContents(32)
+	destContents := randomContents(64)
+
+	defer suite.deletePath(c, firstPart(sourcePath))
+	defer suite.deletePath(c, firstPart(destPath))
+
+	err := suite.StorageDriver.PutContent(suite.ctx, sourcePath, sourceContents)
+	c.Assert(err, check.IsNil)
+
+	err = suite.StorageDriver.PutContent(suite.ctx, destPath, destContents)
+	c.Assert(err, check.IsNil)
+
+	err = suite.StorageDriver.Copy(suite.ctx, sourcePath, destPath)
+	c.Assert(err, check.IsNil)
+
+	received, err := suite.StorageDriver.GetContent(suite.ctx, destPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, sourceContents)
+
+	received, err = suite.StorageDriver.GetContent(suite.ctx, sourcePath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, sourceContents)
+}
+
+// TestCopyNonexistent checks that copying a nonexistent key fails and does
+// not modify the data at the destination path.
+func (suite *DriverSuite) TestCopyNonexistent(c *check.C) {
+	contents := randomContents(32)
+	sourcePath := randomPath(32)
+	destPath := randomPath(32)
+
+	defer suite.deletePath(c, firstPart(destPath))
+
+	err := suite.StorageDriver.PutContent(suite.ctx, destPath, contents)
+	c.Assert(err, check.IsNil)
+
+	err = suite.StorageDriver.Copy(suite.ctx, sourcePath, destPath)
+	c.Assert(err, check.NotNil)
+	c.Assert(err, check.FitsTypeOf, storagedriver.PathNotFoundError{})
+	c.Assert(strings.Contains(err.Error(), suite.Name()), check.Equals, true)
+
+	received, err := suite.StorageDriver.GetContent(suite.ctx, destPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.DeepEquals, contents)
+}
+
 // TestDelete checks that the delete operation removes data from the storage
 // driver
 func (suite *DriverSuite) TestDelete(c *check.C) {
@@ -20,19 +20,26 @@ type WalkFn func(fileInfo FileInfo) error
 // from the given path, calling f on each file. It uses the List method and Stat to drive itself.
 // If the returned error from the WalkFn is ErrSkipDir and fileInfo refers
 // to a directory, the directory will not be entered and Walk
-// will continue the traversal.  If fileInfo refers to a normal file, processing stops
+// will continue the traversal.  If fileInfo refers to a normal file, processing stops.
+// The traversal stops with the error of ctx once it is done.
 func WalkFallback(ctx context.Context, driver StorageDriver, from string, f WalkFn) error {
 	_, err := doWalkFallback(ctx, driver, from, f)
 	return err
 }
 
 func doWalkFallback(ctx context.Context, driver StorageDriver, from string, f WalkFn) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	children, err := driver.List(ctx, from)
 	if err != nil {
 		return false, err
 	}
 	sort.Stable(sort.StringSlice(children))
 	for _, child := range children {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
 		// TODO(stevvooe): Calling driver.Stat for every entry is quite
 		// expensive when running against backends with a slow Stat
 		// implementation, such as s3. This is very likely a serious
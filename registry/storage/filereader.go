@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -120,8 +121,8 @@ func (fr *fileReader) reader() (io.Reader, error) {
 	// If we don't have a reader, open one up.
 	rc, err := fr.driver.Reader(fr.ctx, fr.path, fr.offset)
 	if err != nil {
-		switch err := err.(type) {
-		case storagedriver.PathNotFoundError:
+		switch {
+		case errors.Is(err, storagedriver.ErrNotFound):
 			// NOTE(stevvooe): If the path is not found, we simply return a
 			// reader that returns io.EOF. However, we do not set fr.rc,
 			// allowing future attempts at getting a reader to possibly
@@ -2,22 +2,262 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ociartifact"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/opencontainers/go-digest"
 )
 
-func emit(format string, a ...interface{}) {
-	fmt.Printf(format+"\n", a...)
+// GCEventKind identifies the kind of a GCEvent.
+type GCEventKind string
+
+const (
+	// GCEventRepository is emitted when marking of a repository starts.
+	GCEventRepository GCEventKind = "repository"
+	// GCEventMark is emitted for each manifest and blob marked as in use.
+	GCEventMark GCEventKind = "mark"
+	// GCEventEligible is emitted for each manifest and blob eligible for
+	// deletion.
+	GCEventEligible GCEventKind = "eligible"
+	// GCEventDelete is emitted for each path deleted by the sweep.
+	GCEventDelete GCEventKind = "delete"
+	// GCEventSummary is emitted once marking is complete.
+	GCEventSummary GCEventKind = "summary"
+	// GCEventReclaimed is emitted once the sweep is complete, with the
+	// bytes reclaimed in each repository and overall.
+	GCEventReclaimed GCEventKind = "reclaimed"
+	// GCEventExplain carries the reasons a digest is kept or deleted, when
+	// GCOpts.Explain is set.
+	GCEventExplain GCEventKind = "explain"
+	// GCEventWarning reports a problem which does not stop the collection.
+	GCEventWarning GCEventKind = "warning"
+	// GCEventDanglingReferrer is emitted by dry runs for each referrer link
+	// whose referrer does not exist or would be deleted.
+	GCEventDanglingReferrer GCEventKind = "dangling-referrer"
+	// GCEventJournal is emitted once the sweep is complete, with the ID of
+	// its journal, when GCOpts.Journal is set.
+	GCEventJournal GCEventKind = "journal"
+)
+
+// GCEvent is a progress event of garbage collection.
+type GCEvent struct {
+	Kind GCEventKind
+	// Repository is the repository the event relates to, if any.
+	Repository string
+	// Digest is the manifest or blob the event relates to, if any.
+	Digest digest.Digest
+	// Path is the storage path removed, for GCEventDelete events.
+	Path string
+	// Message describes the event in human readable form.
+	Message string
+}
+
+// gcEmitter delivers garbage collection events.
+type gcEmitter func(GCEvent)
+
+// newGCEmitter returns an emitter delivering events to the given function,
+// or printing them unless quiet is set.
+func newGCEmitter(events func(GCEvent), quiet bool) gcEmitter {
+	switch {
+	case events != nil:
+		return events
+	case quiet:
+		return func(GCEvent) {}
+	}
+	return printGCEvent
+}
+
+func (e gcEmitter) emit(event GCEvent, format string, a ...interface{}) {
+	event.Message = fmt.Sprintf(format, a...)
+	e(event)
 }
 
+// printGCEvent prints events to standard output. Deletions are only logged
+// by the vacuum.
+func printGCEvent(event GCEvent) {
+	switch event.Kind {
+	case GCEventDelete:
+		return
+	case GCEventSummary:
+		fmt.Println()
+	}
+	fmt.Println(event.Message)
+}
+
+// AnnotationExpires is the manifest annotation holding the RFC 3339 time
+// after which the manifest may be removed by garbage collection.
+const AnnotationExpires = "org.opencontainers.image.expires"
+
 // GCOpts contains options for garbage collector
 type GCOpts struct {
 	DryRun         bool
 	RemoveUntagged bool
+	// UntaggedRetentionPeriod, if positive, keeps untagged manifests
+	// pushed less than that long ago, so that RemoveUntagged does not race
+	// with clients which push manifests by digest before tagging them.
+	// Referrers are kept as long as their subject is.
+	UntaggedRetentionPeriod time.Duration
+	// RemoveExpired deletes manifests whose AnnotationExpires time has
+	// passed, along with any tags pointing at them.
+	RemoveExpired bool
+	// Frozen, if set, reports whether the manifests of the named repository
+	// must be kept regardless of RemoveUntagged and RemoveExpired.
+	Frozen func(repoName string) bool
+	// Explain records why each manifest and blob is kept or deleted, and
+	// emits the reasons at the end of the report.
+	Explain bool
+	// DeleteRate, if positive, limits the sweep to that many deletes per
+	// second, so that collecting against shared object storage leaves
+	// request quota to live traffic.
+	DeleteRate float64
+	// Events, if set, receives the progress events of the collection, which
+	// are otherwise printed to standard output.
+	Events func(GCEvent)
+	// ReportFormat is the format of the output: GCReportText, the default,
+	// prints progress as it goes, while GCReportJSON prints nothing, for
+	// the caller to print the returned GCReport as JSON.
+	ReportFormat string
+	// IncludeRepositories and ExcludeRepositories are path.Match patterns
+	// restricting the collection to the repositories matching an include
+	// pattern, if any, and no exclude pattern. A pattern matches a
+	// repository if it matches its name or one of its parent namespaces.
+	// Only the blobs referenced by the manifests deleted from those
+	// repositories are swept, once no other repository links them.
+	IncludeRepositories []string
+	ExcludeRepositories []string
+	// Online lets the collection run against a registry which is not in
+	// read-only mode. Blobs written and links created within GracePeriod
+	// of the start of the collection are kept, as are the blobs linked in
+	// repositories with uploads in progress and untagged manifests pushed
+	// within GracePeriod. While the collection runs, the registry fences
+	// the blobs and manifests it links so that they are not swept.
+	Online bool
+	// GracePeriod is the grace window of online collections,
+	// DefaultGCGracePeriod if not set.
+	GracePeriod time.Duration
+	// OnProgress, if set, is called at most once per second with the
+	// progress of the collection, and once more at the end of each phase.
+	// Estimating the completion takes an extra pass over the repositories.
+	OnProgress func(GCProgress)
+	// Journal records the deletions of the sweep to a journal in the
+	// storage before they are made, so that UndoGC can restore them.
+	// It is ignored by dry runs.
+	Journal bool
+	// Timeline, if set, records the manifests and tags deleted by the
+	// sweep in the timelines of their repositories. It is ignored by dry
+	// runs.
+	Timeline *Timeline
+	// EnumerationRetries is the number of times an enumeration of the
+	// manifests of a repository or of the blobs interrupted by a storage
+	// error is resumed from the last manifest or blob it listed, instead of
+	// failing the collection.
+	EnumerationRetries int
+	// SweepWorkers is the number of blobs deleted concurrently by the
+	// sweep, 1 if not set. DeleteRate applies to all of them, and Events
+	// is never called concurrently.
+	SweepWorkers int
+	// BuildReferenceIndex records the references of the manifests kept in
+	// the reference index, which a full collection then marks as built so
+	// that SweepReferenceIndex can use it. The registry must already record
+	// the index as manifests are pushed and deleted, see
+	// EnableReferenceIndex. It is ignored by dry runs.
+	BuildReferenceIndex bool
+	// RemoveOrphanedPlatforms deletes the untagged child manifests of the
+	// indexes deleted by the collection, such as the platform manifests of
+	// an expired multi-arch image, even without RemoveUntagged or within
+	// UntaggedRetentionPeriod, unless an index kept in the repository
+	// references them too. The untagged child manifests of kept indexes are
+	// always kept, except referrers, which are kept as long as their
+	// subject is whichever index lists them.
+	RemoveOrphanedPlatforms bool
+	// ReferrersOnly only deletes the referrer links whose referrer or
+	// subject manifest no longer exists in the repository, such as those
+	// left behind by manifests deleted from the storage by hand. Manifests
+	// and blobs are left alone, and RemoveUntagged, RemoveExpired,
+	// Explain, OnProgress, EnumerationRetries, SweepWorkers and
+	// BuildReferenceIndex are ignored. With Online, the links written
+	// within GracePeriod are kept. Subjects whose digest is not of the
+	// canonical algorithm are not checked, as manifests are not stored
+	// under those digests.
+	ReferrersOnly bool
+}
+
+// GCPhase identifies the phase of a garbage collection.
+type GCPhase string
+
+const (
+	// GCPhaseMark is the phase marking the manifests and blobs in use.
+	GCPhaseMark GCPhase = "mark"
+	// GCPhaseSweep is the phase deleting the manifests and blobs which are
+	// not in use.
+	GCPhaseSweep GCPhase = "sweep"
+	// GCPhaseDone is reported once the collection is complete.
+	GCPhaseDone GCPhase = "done"
+)
+
+// GCProgress reports how far a garbage collection has come.
+type GCProgress struct {
+	Phase                 GCPhase
+	RepositoriesProcessed int
+	ManifestsMarked       int
+	// BlobsSwept counts the blobs the sweep deleted, or would have deleted
+	// in a dry run.
+	BlobsSwept int
+	// Completion is the estimated fraction of the collection done, between
+	// 0 and 1. Marking and sweeping each account for half of it.
+	Completion float64
+	// Elapsed is the time since the collection started.
+	Elapsed time.Duration
+	// Remaining is the time left estimated from Completion, or zero before
+	// anything is done.
+	Remaining time.Duration
+}
+
+// Formats of the garbage collection output.
+const (
+	GCReportText = "text"
+	GCReportJSON = "json"
+)
+
+// GCReport summarizes a garbage collection. For dry runs, it counts what
+// would have been deleted.
+type GCReport struct {
+	DryRun              bool `json:"dryRun"`
+	RepositoriesScanned int  `json:"repositoriesScanned"`
+	// ManifestsDeleted counts all deleted manifests, including artifact
+	// manifests.
+	ManifestsDeleted int `json:"manifestsDeleted"`
+	// ArtifactManifestsDeleted counts deleted manifests which are artifacts
+	// or referrers of another manifest.
+	ArtifactManifestsDeleted int   `json:"artifactManifestsDeleted"`
+	BlobsDeleted             int   `json:"blobsDeleted"`
+	BytesReclaimed           int64 `json:"bytesReclaimed"`
+	// RepositoryBytesReclaimed breaks BytesReclaimed down by the repository
+	// whose deleted manifests referenced the blobs. A blob referenced from
+	// several repositories is counted in the first one collected, and blobs
+	// no deleted manifest referenced are only counted in the total.
+	RepositoryBytesReclaimed map[string]int64 `json:"repositoryBytesReclaimed,omitempty"`
+	// DanglingReferrerLinks lists, for dry runs, the referrer links left
+	// behind by manifests which no longer exist or would be deleted.
+	DanglingReferrerLinks []string `json:"danglingReferrerLinks,omitempty"`
+	// LinksDeleted counts the layer and referrer links deleted by
+	// CollectRepository, or the referrer links deleted with
+	// GCOpts.ReferrersOnly.
+	LinksDeleted int `json:"linksDeleted,omitempty"`
+	// Journal is the ID of the journal of the deletions, if one was
+	// written.
+	Journal string `json:"journal,omitempty"`
 }
 
 // ManifestDel contains manifest structure which will be deleted
@@ -25,20 +265,176 @@ type ManifestDel struct {
 	Name   string
 	Digest digest.Digest
 	Tags   []string
+	// Untag lists the tags currently pointing at the manifest, which are
+	// removed along with it.
+	Untag []string
+	// Artifact is true if the manifest is an artifact or a referrer.
+	Artifact bool
+}
+
+// keptReferrer is a referrer whose marking waits for the collection to
+// find out whether its subject is deleted.
+type keptReferrer struct {
+	digest   digest.Digest
+	subject  digest.Digest
+	manifest distribution.Manifest
+	mark     func() error
+}
+
+// untaggedManifest is an untagged manifest whose fate waits for the
+// collection to find out whether an index kept in the repository references
+// it.
+type untaggedManifest struct {
+	del      ManifestDel
+	manifest distribution.Manifest
+	mark     func() error
+	// eligible is true if RemoveUntagged deletes the manifest unless a kept
+	// index references it.
+	eligible bool
+	// orphanOf is the deleted index the manifest is deleted along with, by
+	// RemoveOrphanedPlatforms.
+	orphanOf digest.Digest
 }
 
 // MarkAndSweep performs a mark and sweep of registry data
-func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) error {
+func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) (GCReport, error) {
 	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
 	if !ok {
-		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+		return GCReport{}, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
 	}
+	return observeGC(markAndSweep(ctx, storageDriver, registry, repositoryEnumerator.Enumerate, "", opts))
+}
+
+// CollectRepository performs a mark and sweep of a single repository. It
+// deletes manifests and tags as MarkAndSweep does, along with the links of
+// the repository to the blobs its remaining manifests do not reference and
+// the links to referrers which no longer exist. Blobs are left to a full
+// collection, which deletes them once no repository links them.
+// IncludeRepositories and ExcludeRepositories are ignored.
+func CollectRepository(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, repoName string, opts GCOpts) (GCReport, error) {
+	rootPath, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return GCReport{}, err
+	}
+	if _, err := storageDriver.Stat(ctx, path.Join(rootPath, repoName)); err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return GCReport{}, distribution.ErrRepositoryUnknown{Name: repoName}
+		}
+		return GCReport{}, err
+	}
+
+	opts.IncludeRepositories, opts.ExcludeRepositories = nil, nil
+	enumerate := func(ctx context.Context, ingester func(string) error) error {
+		return ingester(repoName)
+	}
+	return observeGC(markAndSweep(ctx, storageDriver, registry, enumerate, repoName, opts))
+}
+
+// markAndSweep collects the repositories listed by enumerate. If scope is
+// set, it names the only repository listed, whose links are swept instead
+// of the blobs.
+func markAndSweep(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, enumerate func(context.Context, func(string) error) error, scope string, opts GCOpts) (GCReport, error) {
+	switch opts.ReportFormat {
+	case "", GCReportText, GCReportJSON:
+	default:
+		return GCReport{}, fmt.Errorf("unknown garbage collection report format %q", opts.ReportFormat)
+	}
+	for _, pattern := range append(append([]string(nil), opts.IncludeRepositories...), opts.ExcludeRepositories...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return GCReport{}, fmt.Errorf("invalid repository pattern %q: %v", pattern, err)
+		}
+	}
+	filtered := len(opts.IncludeRepositories) > 0 || len(opts.ExcludeRepositories) > 0
+	events := newGCEmitter(opts.Events, opts.ReportFormat == GCReportJSON)
+	if opts.ReferrersOnly {
+		return collectReferrerLinks(ctx, storageDriver, registry, enumerate, events, opts)
+	}
+	report := GCReport{DryRun: opts.DryRun}
 
 	// mark
+	now := time.Now()
+	progress := &gcProgressTracker{fn: opts.OnProgress, start: now, last: now, progress: GCProgress{Phase: GCPhaseMark}}
+	if opts.OnProgress != nil {
+		err := enumerate(ctx, func(repoName string) error {
+			if repositorySelected(repoName, opts.IncludeRepositories, opts.ExcludeRepositories) {
+				progress.repositories++
+			}
+			return nil
+		})
+		if err != nil {
+			return GCReport{}, fmt.Errorf("failed to count repositories: %w", err)
+		}
+	}
+	retention := opts.UntaggedRetentionPeriod
+	var online *onlineGC
+	if opts.Online {
+		grace := opts.GracePeriod
+		if grace <= 0 {
+			grace = DefaultGCGracePeriod
+		}
+		if retention < grace {
+			retention = grace
+		}
+		var err error
+		online, err = startOnlineGC(ctx, storageDriver, now, now.Add(-grace), !opts.DryRun)
+		if err != nil {
+			return GCReport{}, err
+		}
+		defer func() {
+			if err := online.stop(ctx); err != nil {
+				events.emit(GCEvent{Kind: GCEventWarning}, "failed to stop online garbage collection: %v", err)
+			}
+		}()
+	}
 	markSet := make(map[digest.Digest]struct{})
 	manifestArr := make([]ManifestDel, 0)
-	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
-		emit(repoName)
+	reasons := make(gcReasons)
+	because := func(dgst digest.Digest, format string, a ...interface{}) {
+		if opts.Explain {
+			reasons.add(dgst, fmt.Sprintf(format, a...))
+		}
+	}
+	// With repository filters, the blobs of deleted manifests are the only
+	// candidates of the sweep, and are kept if linked by the repositories
+	// left out.
+	candidates := make(map[digest.Digest]struct{})
+	var scanned, skipped []string
+	// Online collections keep the references of the manifests to delete,
+	// in case they are linked again during the sweep.
+	references := make(map[digest.Digest][]digest.Digest)
+	// owners maps the blobs of deleted manifests to the repository the
+	// space they take is accounted to.
+	owners := make(map[digest.Digest]string)
+	// subjects maps deleted manifests to their subject, if they have one.
+	subjects := make(map[string]digest.Digest)
+	deleteManifest := func(del ManifestDel, manifest distribution.Manifest) {
+		manifestArr = append(manifestArr, del)
+		if subject := manifestSubject(manifest); subject != nil {
+			subjects[del.Name+"@"+del.Digest.String()] = subject.Digest
+		}
+		if online != nil {
+			references[del.Digest] = manifestReferences(manifest)
+		}
+		for _, dgst := range append([]digest.Digest{del.Digest}, manifestReferences(manifest)...) {
+			if _, ok := owners[dgst]; !ok {
+				owners[dgst] = del.Name
+			}
+		}
+		if filtered {
+			candidates[del.Digest] = struct{}{}
+			for _, descriptor := range manifest.References() {
+				candidates[descriptor.Digest] = struct{}{}
+			}
+		}
+	}
+	err := enumerate(ctx, func(repoName string) error {
+		if !repositorySelected(repoName, opts.IncludeRepositories, opts.ExcludeRepositories) {
+			skipped = append(skipped, repoName)
+			return nil
+		}
+		events.emit(GCEvent{Kind: GCEventRepository, Repository: repoName}, "%s", repoName)
+		report.RepositoriesScanned++
+		scanned = append(scanned, repoName)
 
 		var err error
 		named, err := reference.WithName(repoName)
@@ -60,93 +456,1132 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
 		}
 
-		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
-			if opts.RemoveUntagged {
-				// fetch all tags where this manifest is the latest one
-				tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
-				if err != nil {
-					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
-				}
-				if len(tags) == 0 {
-					emit("manifest eligible for deletion: %s", dgst)
-					// fetch all tags from repository
-					// all of these tags could contain manifest in history
-					// which means that we need check (and delete) those references when deleting manifest
-					allTags, err := repository.Tags(ctx).All(ctx)
-					if err != nil {
-						return fmt.Errorf("failed to retrieve tags %v", err)
-					}
-					manifestArr = append(manifestArr, ManifestDel{Name: repoName, Digest: dgst, Tags: allTags})
-					return nil
-				}
+		removeUntagged, removeExpired, removeOrphans := opts.RemoveUntagged, opts.RemoveExpired, opts.RemoveOrphanedPlatforms
+		frozen := opts.Frozen != nil && opts.Frozen(repoName)
+		if frozen {
+			events.emit(GCEvent{Kind: GCEventRepository, Repository: repoName}, "%s: repository is frozen, keeping all manifests", repoName)
+			removeUntagged, removeExpired, removeOrphans = false, false, false
+		}
+
+		// children maps the indexes of the repository to the manifests
+		// they reference, and keptBy the untagged manifests kept because a
+		// kept index references them to that index.
+		children := make(map[digest.Digest][]digest.Digest)
+		keptBy := make(map[digest.Digest]digest.Digest)
+		recordIndex := func(dgst digest.Digest, manifest distribution.Manifest) {
+			if index, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+				children[dgst] = manifestReferences(index)
+			}
+		}
+
+		if online != nil {
+			err = online.recentLinks(ctx, repoName, func(dgst digest.Digest, reason string) {
+				markSet[dgst] = struct{}{}
+				events.emit(GCEvent{Kind: GCEventMark, Repository: repoName, Digest: dgst}, "%s: marking blob %s", repoName, dgst)
+				because(dgst, "%s", reason)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to check the links of %s: %v", repoName, err)
 			}
+		}
+
+		// markManifest marks a manifest kept and the blobs it references.
+		markManifest := func(dgst digest.Digest, manifest distribution.Manifest, tags []string, fenced bool, pushedAt time.Time) error {
 			// Mark the manifest's blob
-			emit("%s: marking manifest %s ", repoName, dgst)
+			events.emit(GCEvent{Kind: GCEventMark, Repository: repoName, Digest: dgst}, "%s: marking manifest %s ", repoName, dgst)
 			markSet[dgst] = struct{}{}
+			progress.progress.ManifestsMarked++
+			progress.report(false)
+			for _, tag := range tags {
+				because(dgst, "tagged via %s:%s", repoName, tag)
+			}
+			switch {
+			case frozen:
+				because(dgst, "repository %s is frozen", repoName)
+			case fenced:
+				because(dgst, "linked in %s during the collection", repoName)
+			case keptBy[dgst] != "":
+				because(dgst, "untagged in %s, referenced by kept index %s@%s", repoName, repoName, keptBy[dgst])
+			case removeUntagged && len(tags) == 0:
+				because(dgst, "untagged in %s, pushed at %s within the retention period", repoName, pushedAt.Format(time.RFC3339))
+			case len(tags) == 0:
+				because(dgst, "manifest of %s, untagged manifests are not deleted", repoName)
+			}
 
-			manifest, err := manifestService.Get(ctx, dgst)
-			if err != nil {
-				return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+			if subject := manifestSubject(manifest); subject != nil {
+				because(dgst, "referrer of subject %s@%s", repoName, subject.Digest)
 			}
 
 			descriptors := manifest.References()
 			for _, descriptor := range descriptors {
 				markSet[descriptor.Digest] = struct{}{}
-				emit("%s: marking blob %s", repoName, descriptor.Digest)
+				events.emit(GCEvent{Kind: GCEventMark, Repository: repoName, Digest: descriptor.Digest}, "%s: marking blob %s", repoName, descriptor.Digest)
+				because(descriptor.Digest, "referenced by manifest %s@%s", repoName, dgst)
+			}
+			if opts.BuildReferenceIndex && !opts.DryRun {
+				return addReferences(ctx, storageDriver, repoName, dgst, manifestReferences(manifest))
 			}
 
 			return nil
+		}
+		// Referrers are deleted along with their subject, recursively, so
+		// that the signatures of signatures and the attestations of SBOMs
+		// of the deleted manifests go too.
+		var referrers []keptReferrer
+		cascadeReferrers := func() error {
+			deleted := make(map[digest.Digest]struct{})
+			for _, del := range manifestArr {
+				if del.Name == repoName {
+					deleted[del.Digest] = struct{}{}
+				}
+			}
+			for cascaded := true; cascaded; {
+				cascaded = false
+				kept := referrers[:0]
+				for _, referrer := range referrers {
+					if _, ok := deleted[referrer.subject]; !ok {
+						kept = append(kept, referrer)
+						continue
+					}
+					events.emit(GCEvent{Kind: GCEventEligible, Repository: repoName, Digest: referrer.digest}, "referrer of deleted subject %s eligible for deletion: %s", referrer.subject, referrer.digest)
+					because(referrer.digest, "referrer of deleted subject %s@%s", repoName, referrer.subject)
+					tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: referrer.digest})
+					if err != nil {
+						return fmt.Errorf("failed to retrieve tags for digest %v: %v", referrer.digest, err)
+					}
+					allTags, err := repository.Tags(ctx).All(ctx)
+					if err != nil {
+						if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+							return fmt.Errorf("failed to retrieve tags %v", err)
+						}
+					}
+					deleteManifest(ManifestDel{Name: repoName, Digest: referrer.digest, Tags: allTags, Untag: tags, Artifact: true}, referrer.manifest)
+					deleted[referrer.digest] = struct{}{}
+					cascaded = true
+				}
+				referrers = kept
+			}
+			for _, referrer := range referrers {
+				if err := referrer.mark(); err != nil {
+					return err
+				}
+			}
+			referrers = nil
+			return nil
+		}
+
+		// Untagged manifests are deleted or marked once it is known which
+		// indexes of the repository are kept, so that the platform
+		// manifests of kept multi-arch images are kept too.
+		var untagged []untaggedManifest
+		resolveUntagged := func() error {
+			deleted := make(map[digest.Digest]struct{})
+			for _, del := range manifestArr {
+				if del.Name == repoName {
+					deleted[del.Digest] = struct{}{}
+				}
+			}
+			for _, u := range untagged {
+				if u.eligible {
+					deleted[u.del.Digest] = struct{}{}
+				}
+			}
+			for changed := true; changed; {
+				changed = false
+				kept := make(map[digest.Digest]digest.Digest)
+				orphaned := make(map[digest.Digest]digest.Digest)
+				for index, refs := range children {
+					_, gone := deleted[index]
+					for _, ref := range refs {
+						if gone {
+							orphaned[ref] = index
+						} else {
+							kept[ref] = index
+						}
+					}
+				}
+				for i := range untagged {
+					u := &untagged[i]
+					_, gone := deleted[u.del.Digest]
+					index, isKept := kept[u.del.Digest]
+					switch {
+					case gone && isKept && u.orphanOf == "" && manifestSubject(u.manifest) == nil:
+						delete(deleted, u.del.Digest)
+						keptBy[u.del.Digest] = index
+						changed = true
+					case !gone && !isKept && removeOrphans && orphaned[u.del.Digest] != "":
+						u.orphanOf = orphaned[u.del.Digest]
+						deleted[u.del.Digest] = struct{}{}
+						changed = true
+					}
+				}
+			}
+
+			var allTags []string
+			for _, u := range untagged {
+				if _, ok := deleted[u.del.Digest]; !ok {
+					if err := u.mark(); err != nil {
+						return err
+					}
+					continue
+				}
+				if u.orphanOf != "" {
+					events.emit(GCEvent{Kind: GCEventEligible, Repository: repoName, Digest: u.del.Digest}, "platform manifest of deleted index %s eligible for deletion: %s", u.orphanOf, u.del.Digest)
+					because(u.del.Digest, "untagged in %s, referenced by deleted index %s@%s", repoName, repoName, u.orphanOf)
+				} else {
+					events.emit(GCEvent{Kind: GCEventEligible, Repository: repoName, Digest: u.del.Digest}, "manifest eligible for deletion: %s", u.del.Digest)
+					because(u.del.Digest, "untagged in %s", repoName)
+				}
+				// fetch all tags from repository
+				// all of these tags could contain manifest in history
+				// which means that we need check (and delete) those references when deleting manifest
+				if allTags == nil {
+					var err error
+					allTags, err = repository.Tags(ctx).All(ctx)
+					if err != nil {
+						if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+							return fmt.Errorf("failed to retrieve tags %v", err)
+						}
+					}
+				}
+				u.del.Tags = allTags
+				deleteManifest(u.del, u.manifest)
+			}
+			untagged = nil
+			return nil
+		}
+
+		err = gcEnumerate(ctx, events, opts.EnumerationRetries, "manifests of "+repoName, manifestEnumerator, func(dgst digest.Digest) error {
+			var manifest distribution.Manifest
+			if removeExpired {
+				manifest, err = manifestService.Get(ctx, dgst)
+				if err != nil {
+					return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+				}
+				expiresAt, ok, err := manifestExpiry(manifest)
+				if err != nil {
+					events.emit(GCEvent{Kind: GCEventWarning, Repository: repoName, Digest: dgst}, "%s: %v", dgst, err)
+				}
+				recordIndex(dgst, manifest)
+				if ok && expiresAt.Before(now) {
+					events.emit(GCEvent{Kind: GCEventEligible, Repository: repoName, Digest: dgst}, "manifest expired at %s, eligible for deletion: %s", expiresAt.Format(time.RFC3339), dgst)
+					because(dgst, "expired at %s in %s", expiresAt.Format(time.RFC3339), repoName)
+					tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+					if err != nil {
+						return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
+					}
+					allTags, err := repository.Tags(ctx).All(ctx)
+					if err != nil {
+						if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+							return fmt.Errorf("failed to retrieve tags %v", err)
+						}
+					}
+					deleteManifest(ManifestDel{Name: repoName, Digest: dgst, Tags: allTags, Untag: tags, Artifact: isArtifactManifest(manifest)}, manifest)
+					return nil
+				}
+			}
+			var tags []string
+			if removeUntagged || removeOrphans || opts.Explain {
+				// fetch all tags where this manifest is the latest one
+				tags, err = repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+				if err != nil {
+					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
+				}
+			}
+			var pushedAt time.Time
+			var fenced bool
+			if removeUntagged {
+				if len(tags) == 0 && online != nil {
+					fenced, err = online.fenced(ctx, dgst)
+					if err != nil {
+						return err
+					}
+				}
+				if len(tags) == 0 && !fenced && retention > 0 {
+					if manifest == nil {
+						manifest, err = manifestService.Get(ctx, dgst)
+						if err != nil {
+							return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+						}
+					}
+					pushedAt, err = manifestPushedAt(ctx, storageDriver, repoName, dgst, manifest)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			if manifest == nil {
+				manifest, err = manifestService.Get(ctx, dgst)
+				if err != nil {
+					return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+				}
+			}
+			recordIndex(dgst, manifest)
+			mark := func() error {
+				return markManifest(dgst, manifest, tags, fenced, pushedAt)
+			}
+			if removeUntagged && len(tags) == 0 && !fenced && !now.Before(pushedAt.Add(retention)) {
+				untagged = append(untagged, untaggedManifest{del: ManifestDel{Name: repoName, Digest: dgst, Artifact: isArtifactManifest(manifest)}, manifest: manifest, mark: mark, eligible: true})
+				return nil
+			}
+			subject := manifestSubject(manifest)
+			// Referrers are marked once it is known whether their subject
+			// is deleted, unless linked during the collection.
+			if subject != nil && !fenced {
+				referrers = append(referrers, keptReferrer{digest: dgst, subject: subject.Digest, manifest: manifest, mark: mark})
+				return nil
+			}
+			if removeOrphans && len(tags) == 0 && !fenced {
+				untagged = append(untagged, untaggedManifest{del: ManifestDel{Name: repoName, Digest: dgst, Artifact: isArtifactManifest(manifest)}, manifest: manifest, mark: mark})
+				return nil
+			}
+			return mark()
 		})
+		if err == nil {
+			err = resolveUntagged()
+		}
+		if err == nil {
+			err = cascadeReferrers()
+		}
+		progress.progress.RepositoriesProcessed++
+		progress.report(false)
 
 		// In certain situations such as unfinished uploads, deleting all
 		// tags in S3 or removing the _manifests folder manually, this
 		// error may be of type PathNotFound.
 		//
 		// In these cases we can continue marking other manifests safely.
-		if _, ok := err.(driver.PathNotFoundError); ok {
-			return nil
+		if errors.Is(err, driver.ErrNotFound) {
+			if err := resolveUntagged(); err != nil {
+				return err
+			}
+			return cascadeReferrers()
 		}
 
 		return err
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to mark: %v", err)
+		return GCReport{}, fmt.Errorf("failed to mark: %w", err)
 	}
 
 	// sweep
 	vacuum := NewVacuum(ctx, storageDriver)
+	vacuum.events = events
+	throttle := newDeleteThrottle(ctx, opts.DeleteRate)
+	defer throttle.stop()
+	var journal *gcJournal
+	if opts.Journal && !opts.DryRun {
+		journal = newGCJournal(storageDriver, now)
+	}
+	progress.progress.Phase = GCPhaseSweep
+	progress.report(true)
+	sweepStart := time.Now()
+	gcMarkDuration.Set(sweepStart.Sub(now).Seconds())
 	if !opts.DryRun {
+		progress.manifestsToSweep = len(manifestArr)
+		if journal != nil {
+			var entries []GCJournalEntry
+			for _, obj := range manifestArr {
+				entry, err := journal.manifestEntry(ctx, obj)
+				if err != nil {
+					return GCReport{}, err
+				}
+				entries = append(entries, entry)
+				for _, tag := range obj.Untag {
+					entry, err := tagEntry(obj.Name, tag, obj.Digest)
+					if err != nil {
+						return GCReport{}, err
+					}
+					entries = append(entries, entry)
+				}
+			}
+			if err := journal.record(ctx, entries...); err != nil {
+				return GCReport{}, err
+			}
+		}
+		removed := manifestArr[:0]
 		for _, obj := range manifestArr {
+			if err := throttle.wait(); err != nil {
+				return GCReport{}, err
+			}
+			progress.manifestsSwept++
+			progress.report(false)
+			if online != nil {
+				fenced, err := online.fenced(ctx, obj.Digest)
+				if err != nil {
+					return GCReport{}, err
+				}
+				if fenced {
+					events.emit(GCEvent{Kind: GCEventMark, Repository: obj.Name, Digest: obj.Digest}, "%s: marking manifest %s linked during the collection", obj.Name, obj.Digest)
+					markSet[obj.Digest] = struct{}{}
+					because(obj.Digest, "linked in %s during the collection", obj.Name)
+					for _, dgst := range references[obj.Digest] {
+						markSet[dgst] = struct{}{}
+						because(dgst, "referenced by manifest %s@%s", obj.Name, obj.Digest)
+					}
+					continue
+				}
+			}
+			removed = append(removed, obj)
 			err = vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
 			if err != nil {
-				return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
+				return GCReport{}, fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
 			}
+			for _, tag := range obj.Untag {
+				if err := throttle.wait(); err != nil {
+					return GCReport{}, err
+				}
+				err = vacuum.RemoveTag(obj.Name, tag)
+				if err != nil {
+					return GCReport{}, fmt.Errorf("failed to delete tag %s: %v", tag, err)
+				}
+			}
+		}
+		manifestArr = removed
+		if opts.Timeline != nil {
+			recordGCTimeline(ctx, opts.Timeline, manifestArr)
 		}
 	}
 	blobService := registry.Blobs()
 	deleteSet := make(map[digest.Digest]struct{})
-	err = blobService.Enumerate(ctx, func(dgst digest.Digest) error {
-		// check if digest is in markSet. If not, delete it!
-		if _, ok := markSet[dgst]; !ok {
+	// sizes holds the sizes of the blobs listed by the enumeration, which
+	// the sweep then does not need to stat.
+	sizes := make(map[digest.Digest]int64)
+	if detailed, ok := blobService.(distribution.DetailedBlobEnumerator); ok {
+		blobService = sizedBlobEnumerator{enumerator: detailed, sizes: sizes}
+	}
+	if filtered {
+		for dgst := range candidates {
+			if _, ok := markSet[dgst]; ok {
+				continue
+			}
+			repoName, err := linkingRepository(ctx, storageDriver, skipped, dgst)
+			if err != nil {
+				return GCReport{}, err
+			}
+			if repoName != "" {
+				markSet[dgst] = struct{}{}
+				because(dgst, "linked in %s, which is not collected", repoName)
+				continue
+			}
 			deleteSet[dgst] = struct{}{}
+			if len(reasons[dgst]) == 0 {
+				because(dgst, "unreachable")
+			}
+		}
+	} else if scope == "" {
+		err = gcEnumerate(ctx, events, opts.EnumerationRetries, "blobs", blobService, func(dgst digest.Digest) error {
+			// check if digest is in markSet. If not, delete it!
+			if _, ok := markSet[dgst]; !ok {
+				deleteSet[dgst] = struct{}{}
+				if len(reasons[dgst]) == 0 {
+					because(dgst, "unreachable")
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return GCReport{}, fmt.Errorf("error enumerating blobs: %w", err)
+		}
+	}
+	if online != nil {
+		for dgst := range deleteSet {
+			reason, err := online.keepBlob(ctx, dgst)
+			if err != nil {
+				return GCReport{}, err
+			}
+			if reason != "" {
+				delete(deleteSet, dgst)
+				markSet[dgst] = struct{}{}
+				because(dgst, "%s", reason)
+			}
+		}
+	}
+	events.emit(GCEvent{Kind: GCEventSummary}, "%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), len(manifestArr))
+	for _, obj := range manifestArr {
+		report.ManifestsDeleted++
+		if obj.Artifact {
+			report.ArtifactManifestsDeleted++
+		}
+	}
+	if !opts.DryRun {
+		gcManifestsDeleted.Inc(float64(report.ManifestsDeleted))
+		gcArtifactManifestsDeleted.Inc(float64(report.ArtifactManifestsDeleted))
+	}
+	if opts.DryRun || scope != "" {
+		deleted := make(map[string]struct{}, len(manifestArr))
+		for _, obj := range manifestArr {
+			deleted[obj.Name+"@"+obj.Digest.String()] = struct{}{}
+		}
+		for _, repoName := range scanned {
+			var dangling []referrerLink
+			// A referrer linked in both layouts, by an interrupted
+			// migration, is unlinked once.
+			unlinked := make(map[[2]digest.Digest]struct{})
+			err := walkReferrerLinks(ctx, storageDriver, repoName, func(linkPath string, subject, referrer digest.Digest) error {
+				state := "is eligible for deletion"
+				if _, ok := deleted[repoName+"@"+referrer.String()]; !ok {
+					if _, err := revisionLinkTime(ctx, storageDriver, repoName, referrer); err == nil {
+						return nil
+					} else if !errors.Is(err, driver.ErrNotFound) {
+						return err
+					}
+					state = "no longer exists"
+				}
+				if _, ok := unlinked[[2]digest.Digest{subject, referrer}]; !ok {
+					unlinked[[2]digest.Digest{subject, referrer}] = struct{}{}
+					dangling = append(dangling, referrerLink{path: linkPath, subject: subject, referrer: referrer})
+				}
+				if opts.DryRun {
+					report.DanglingReferrerLinks = append(report.DanglingReferrerLinks, linkPath)
+					events.emit(GCEvent{Kind: GCEventDanglingReferrer, Repository: repoName, Digest: referrer, Path: linkPath}, "dangling referrer link: %s, referrer %s %s", linkPath, referrer, state)
+				}
+				return nil
+			})
+			if err != nil {
+				return GCReport{}, fmt.Errorf("failed to check referrer links of %s: %v", repoName, err)
+			}
+
+			// Collections scoped to a repository remove them.
+			if scope == "" {
+				continue
+			}
+			if journal != nil {
+				var entries []GCJournalEntry
+				for _, link := range dangling {
+					entries = append(entries, referrerLinkEntry(repoName, link))
+				}
+				if err := journal.record(ctx, entries...); err != nil {
+					return GCReport{}, err
+				}
+			}
+			for _, link := range dangling {
+				report.LinksDeleted++
+				if opts.DryRun {
+					continue
+				}
+				if err := throttle.wait(); err != nil {
+					return GCReport{}, err
+				}
+				if err := vacuum.RemoveReferrerLink(repoName, link.subject, link.referrer); err != nil {
+					return GCReport{}, fmt.Errorf("failed to delete referrer link of %s: %v", link.referrer, err)
+				}
+			}
 		}
-		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("error enumerating blobs: %v", err)
 	}
-	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), len(manifestArr))
-	for dgst := range deleteSet {
-		emit("blob eligible for deletion: %s", dgst)
+	if scope != "" {
+		var unlinked []digest.Digest
+		err := walkLayerLinks(ctx, storageDriver, scope, func(dgst digest.Digest) error {
+			if _, ok := markSet[dgst]; !ok {
+				unlinked = append(unlinked, dgst)
+			}
+			return nil
+		})
+		if err != nil {
+			return GCReport{}, fmt.Errorf("failed to enumerate layer links of %s: %v", scope, err)
+		}
+		if journal != nil {
+			var entries []GCJournalEntry
+			for _, dgst := range unlinked {
+				entry, err := layerLinkEntry(scope, dgst)
+				if err != nil {
+					return GCReport{}, err
+				}
+				entries = append(entries, entry)
+			}
+			if err := journal.record(ctx, entries...); err != nil {
+				return GCReport{}, err
+			}
+		}
+		for _, dgst := range unlinked {
+			events.emit(GCEvent{Kind: GCEventEligible, Repository: scope, Digest: dgst}, "layer link eligible for deletion: %s@%s", scope, dgst)
+			if !opts.DryRun {
+				if err := throttle.wait(); err != nil {
+					return GCReport{}, err
+				}
+				if online != nil {
+					fenced, err := online.fenced(ctx, dgst)
+					if err != nil {
+						return GCReport{}, err
+					}
+					if fenced {
+						events.emit(GCEvent{Kind: GCEventWarning, Repository: scope, Digest: dgst}, "blob %s linked during the collection, keeping its link", dgst)
+						continue
+					}
+				}
+				if err := vacuum.RemoveLayerLink(scope, dgst); err != nil {
+					return GCReport{}, fmt.Errorf("failed to delete layer link of %s: %v", dgst, err)
+				}
+			}
+			report.LinksDeleted++
+		}
+	}
+	if opts.Explain {
+		reasons.emit(events, deleteSet)
+	}
+	statter := registry.BlobStatter()
+	if journal != nil {
+		var entries []GCJournalEntry
+		for dgst := range deleteSet {
+			entry, err := blobEntry(dgst)
+			if err != nil {
+				return GCReport{}, err
+			}
+			entries = append(entries, entry)
+		}
+		if err := journal.record(ctx, entries...); err != nil {
+			return GCReport{}, err
+		}
+	}
+	progress.sweepingBlobs, progress.blobsToSweep = true, len(deleteSet)
+	workers := opts.SweepWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > 1 {
+		// Deliver the events of the workers one at a time.
+		var mu sync.Mutex
+		emit := events
+		events = func(event GCEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			emit(event)
+		}
+		vacuum.events = events
+	}
+	// sweepBlob deletes a blob, returning its size and whether it was
+	// deleted.
+	sweepBlob := func(ctx context.Context, dgst digest.Digest) (int64, bool, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, false, err
+		}
+		events.emit(GCEvent{Kind: GCEventEligible, Digest: dgst}, "blob eligible for deletion: %s", dgst)
+		size, ok := sizes[dgst]
+		if !ok {
+			desc, err := statter.Stat(ctx, dgst)
+			if err != nil {
+				return 0, false, fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+			}
+			size = desc.Size
+		}
 		if opts.DryRun {
+			return size, true, nil
+		}
+		if err := throttle.wait(); err != nil {
+			return 0, false, err
+		}
+		if online != nil {
+			// Last chance to see a fence written during the sweep.
+			fenced, err := online.fenced(ctx, dgst)
+			if err != nil {
+				return 0, false, err
+			}
+			if fenced {
+				events.emit(GCEvent{Kind: GCEventWarning, Digest: dgst}, "blob %s linked during the collection, keeping it", dgst)
+				return 0, false, nil
+			}
+		}
+		if err := vacuum.RemoveBlob(string(dgst)); err != nil {
+			return 0, false, fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+		}
+		return size, true, nil
+	}
+	type sweptBlob struct {
+		digest  digest.Digest
+		size    int64
+		deleted bool
+		err     error
+	}
+	sweepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	work := make(chan digest.Digest)
+	results := make(chan sweptBlob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dgst := range work {
+				size, deleted, err := sweepBlob(sweepCtx, dgst)
+				results <- sweptBlob{digest: dgst, size: size, deleted: deleted, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(work)
+		for dgst := range deleteSet {
+			select {
+			case work <- dgst:
+			case <-sweepCtx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var sweepErr error
+	for result := range results {
+		progress.blobsSwept++
+		progress.report(false)
+		if result.err != nil {
+			if sweepErr == nil {
+				sweepErr = result.err
+				cancel()
+			}
 			continue
 		}
-		err = vacuum.RemoveBlob(string(dgst))
+		if !result.deleted || sweepErr != nil {
+			continue
+		}
+		report.BlobsDeleted++
+		report.BytesReclaimed += result.size
+		if !opts.DryRun {
+			gcBlobsDeleted.Inc(1)
+			gcBytesReclaimed.Inc(float64(result.size))
+		}
+		if repoName, ok := owners[result.digest]; ok {
+			if report.RepositoryBytesReclaimed == nil {
+				report.RepositoryBytesReclaimed = make(map[string]int64)
+			}
+			report.RepositoryBytesReclaimed[repoName] += result.size
+		}
+		progress.progress.BlobsSwept++
+	}
+	if sweepErr == nil {
+		// The blobs left were not sent to the workers.
+		sweepErr = ctx.Err()
+	}
+	if sweepErr != nil {
+		return GCReport{}, sweepErr
+	}
+	reclaimed := "reclaimed"
+	if opts.DryRun {
+		reclaimed = "would be reclaimed"
+	}
+	repoNames := make([]string, 0, len(report.RepositoryBytesReclaimed))
+	for repoName := range report.RepositoryBytesReclaimed {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	for _, repoName := range repoNames {
+		events.emit(GCEvent{Kind: GCEventReclaimed, Repository: repoName}, "%s: %d bytes %s", repoName, report.RepositoryBytesReclaimed[repoName], reclaimed)
+	}
+	events.emit(GCEvent{Kind: GCEventReclaimed}, "%d blobs deleted, %d bytes %s", report.BlobsDeleted, report.BytesReclaimed, reclaimed)
+	if journal != nil && journal.written() {
+		report.Journal = journal.journal.ID
+		events.emit(GCEvent{Kind: GCEventJournal}, "deletions journaled as %s", report.Journal)
+	}
+	if !opts.DryRun {
+		// The referrers tags of the subjects of the deleted referrers, and
+		// of the deleted subjects, may list manifests which are gone.
+		referrersTags := make(map[string]map[digest.Digest]struct{})
+		for _, obj := range manifestArr {
+			if referrersTags[obj.Name] == nil {
+				referrersTags[obj.Name] = make(map[digest.Digest]struct{})
+			}
+			referrersTags[obj.Name][obj.Digest] = struct{}{}
+			if subject, ok := subjects[obj.Name+"@"+obj.Digest.String()]; ok {
+				referrersTags[obj.Name][subject] = struct{}{}
+			}
+		}
+		if err := refreshReferrersTags(ctx, registry, referrersTags); err != nil {
+			return report, fmt.Errorf("failed to update referrers tags: %v", err)
+		}
+	}
+	// Only a collection of every repository records every reference.
+	if opts.BuildReferenceIndex && !opts.DryRun && !filtered && scope == "" {
+		if err := markReferenceIndexBuilt(ctx, storageDriver, now); err != nil {
+			return report, fmt.Errorf("failed to mark the reference index built: %v", err)
+		}
+	}
+	progress.progress.Phase = GCPhaseDone
+	progress.report(true)
+	gcSweepDuration.Set(time.Since(sweepStart).Seconds())
+
+	return report, nil
+}
+
+// digestEnumerator is a BlobEnumerator or a ManifestEnumerator.
+type digestEnumerator interface {
+	Enumerate(ctx context.Context, ingester func(digest.Digest) error) error
+}
+
+// sizedBlobEnumerator is a ResumableBlobEnumerator recording the sizes of
+// the blobs listed by a DetailedBlobEnumerator.
+type sizedBlobEnumerator struct {
+	enumerator distribution.DetailedBlobEnumerator
+	sizes      map[digest.Digest]int64
+}
+
+func (e sizedBlobEnumerator) Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error {
+	_, err := e.EnumerateFrom(ctx, "", ingester)
+	return err
+}
+
+func (e sizedBlobEnumerator) EnumerateFrom(ctx context.Context, marker string, ingester func(dgst digest.Digest) error) (string, error) {
+	return e.enumerator.EnumerateDetailed(ctx, marker, func(info distribution.BlobInfo) error {
+		e.sizes[info.Digest] = info.Size
+		return ingester(info.Digest)
+	})
+}
+
+// gcEnumerate calls ingester for each digest listed by enumerator. If the
+// enumerator is resumable, an enumeration interrupted by another error than
+// one of ingester is resumed after the last digest ingested, at most retries
+// times.
+func gcEnumerate(ctx context.Context, events gcEmitter, retries int, what string, enumerator digestEnumerator, ingester func(digest.Digest) error) error {
+	// ResumableManifestEnumerator has the same method.
+	resumable, ok := enumerator.(distribution.ResumableBlobEnumerator)
+	if !ok || retries <= 0 {
+		return enumerator.Enumerate(ctx, ingester)
+	}
+
+	var ingestErr error
+	ingest := func(dgst digest.Digest) error {
+		ingestErr = ingester(dgst)
+		return ingestErr
+	}
+	var marker string
+	for attempt := 0; ; attempt++ {
+		var err error
+		marker, err = resumable.EnumerateFrom(ctx, marker, ingest)
+		if err == nil || ingestErr != nil || ctx.Err() != nil || attempt == retries {
+			return err
+		}
+		// Repositories without manifests are not an interruption.
+		if errors.Is(err, driver.ErrNotFound) && marker == "" {
+			return err
+		}
+		events.emit(GCEvent{Kind: GCEventWarning}, "enumeration of %s interrupted, resuming after %q: %v", what, marker, err)
+	}
+}
+
+// repositorySelected reports whether a repository matches one of the include
+// patterns, if any, and none of the exclude patterns.
+func repositorySelected(repoName string, include, exclude []string) bool {
+	if len(include) > 0 && !repositoryMatches(repoName, include) {
+		return false
+	}
+	return !repositoryMatches(repoName, exclude)
+}
+
+// repositoryMatches reports whether one of the patterns matches the name of
+// a repository or one of its parent namespaces.
+func repositoryMatches(repoName string, patterns []string) bool {
+	for _, pattern := range patterns {
+		name := repoName
+		for {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+			i := strings.LastIndex(name, "/")
+			if i < 0 {
+				break
+			}
+			name = name[:i]
+		}
+	}
+	return false
+}
+
+// linkingRepository returns the first of the repositories linking a blob or
+// manifest, or an empty string if none does.
+func linkingRepository(ctx context.Context, storageDriver driver.StorageDriver, repositories []string, dgst digest.Digest) (string, error) {
+	for _, repoName := range repositories {
+		for _, spec := range []pathSpec{
+			layerLinkPathSpec{name: repoName, digest: dgst},
+			manifestRevisionLinkPathSpec{name: repoName, revision: dgst},
+		} {
+			linkPath, err := pathFor(spec)
+			if err != nil {
+				return "", err
+			}
+			if _, err := storageDriver.Stat(ctx, linkPath); err != nil {
+				if errors.Is(err, driver.ErrNotFound) {
+					continue
+				}
+				return "", fmt.Errorf("failed to stat link %s: %v", linkPath, err)
+			}
+			return repoName, nil
+		}
+	}
+	return "", nil
+}
+
+// walkLayerLinks calls fn with each blob linked into a repository.
+func walkLayerLinks(ctx context.Context, storageDriver driver.StorageDriver, repoName string, fn func(dgst digest.Digest) error) error {
+	layersPath, err := pathFor(layersPathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+	err = storageDriver.Walk(ctx, layersPath, func(fi driver.FileInfo) error {
+		if fi.IsDir() || path.Base(fi.Path()) != "link" {
+			return nil
+		}
+		dgst, err := digestFromPath(path.Dir(fi.Path()))
 		if err != nil {
-			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+			return nil
 		}
+		return fn(dgst)
+	})
+	if errors.Is(err, driver.ErrNotFound) {
+		return nil
 	}
+	return err
+}
 
+// referrerLink is a referrer link found by walkReferrerLinks.
+type referrerLink struct {
+	path     string
+	subject  digest.Digest
+	referrer digest.Digest
+}
+
+// walkReferrerLinks calls fn with the path of each referrer link of a
+// repository, in either layout, its subject and the referrer it points at.
+func walkReferrerLinks(ctx context.Context, storageDriver driver.StorageDriver, repoName string, fn func(linkPath string, subject, referrer digest.Digest) error) error {
+	rootPath, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+	err = storageDriver.Walk(ctx, path.Join(rootPath, repoName, "_referrers", "subjects"), func(fi driver.FileInfo) error {
+		if fi.IsDir() || path.Base(fi.Path()) != "link" {
+			return nil
+		}
+		referrerPath := path.Dir(fi.Path())
+		referrer, err := digestFromPath(referrerPath)
+		if err != nil {
+			return nil
+		}
+		subjectPath := path.Dir(path.Dir(referrerPath))
+		if isTypedReferrerLink(fi.Path()) {
+			subjectPath = path.Dir(path.Dir(subjectPath))
+		}
+		subject, err := digestFromPath(subjectPath)
+		if err != nil {
+			return nil
+		}
+		return fn(fi.Path(), subject, referrer)
+	})
+	if errors.Is(err, driver.ErrNotFound) {
+		return nil
+	}
 	return err
 }
+
+// deleteThrottle spaces out the deletes of the sweep phase.
+type deleteThrottle struct {
+	ctx    context.Context
+	ticker *time.Ticker
+}
+
+// newDeleteThrottle returns a throttle allowing rate deletes per second, or
+// no limit if rate is not positive.
+func newDeleteThrottle(ctx context.Context, rate float64) *deleteThrottle {
+	throttle := &deleteThrottle{ctx: ctx}
+	if rate > 0 {
+		throttle.ticker = time.NewTicker(time.Duration(float64(time.Second) / rate))
+	}
+	return throttle
+}
+
+// wait blocks until the next delete is allowed or the context is done.
+func (t *deleteThrottle) wait() error {
+	if t.ticker == nil {
+		return t.ctx.Err()
+	}
+	select {
+	case <-t.ticker.C:
+		return nil
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	}
+}
+
+func (t *deleteThrottle) stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+}
+
+// gcProgressInterval is the minimum interval between two progress reports
+// within a phase.
+const gcProgressInterval = time.Second
+
+// gcProgressTracker counts the work done by a garbage collection and
+// reports it to GCOpts.OnProgress.
+type gcProgressTracker struct {
+	fn       func(GCProgress)
+	start    time.Time
+	last     time.Time
+	progress GCProgress
+	// repositories is the number of repositories to mark.
+	repositories int
+	// The manifests and the blobs each account for half of the sweep.
+	manifestsSwept, manifestsToSweep int
+	sweepingBlobs                    bool
+	blobsSwept, blobsToSweep         int
+}
+
+// report calls the callback if force is set or the interval has passed
+// since the last report.
+func (t *gcProgressTracker) report(force bool) {
+	if t.fn == nil {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(t.last) < gcProgressInterval {
+		return
+	}
+	t.last = now
+
+	var completion float64
+	switch t.progress.Phase {
+	case GCPhaseMark:
+		if t.repositories > 0 {
+			completion = float64(t.progress.RepositoriesProcessed) / float64(t.repositories) / 2
+		}
+	case GCPhaseSweep:
+		completion = 0.5
+		if t.sweepingBlobs {
+			completion = 0.75
+			if t.blobsToSweep > 0 {
+				completion += float64(t.blobsSwept) / float64(t.blobsToSweep) / 4
+			}
+		} else if t.manifestsToSweep > 0 {
+			completion += float64(t.manifestsSwept) / float64(t.manifestsToSweep) / 4
+		}
+	case GCPhaseDone:
+		completion = 1
+	}
+	t.progress.Completion = completion
+
+	t.progress.Elapsed = now.Sub(t.start)
+	t.progress.Remaining = 0
+	if c := t.progress.Completion; c > 0 {
+		t.progress.Remaining = time.Duration(float64(t.progress.Elapsed) * (1 - c) / c)
+	}
+	t.fn(t.progress)
+}
+
+// gcReasons maps digests to the reasons garbage collection kept or deleted
+// them.
+type gcReasons map[digest.Digest][]string
+
+func (r gcReasons) add(dgst digest.Digest, reason string) {
+	r[dgst] = append(r[dgst], reason)
+}
+
+// emit prints the reasons of each digest, ordered by digest. Digests in
+// deleteSet are reported for deletion and all others as kept.
+func (r gcReasons) emit(events gcEmitter, deleteSet map[digest.Digest]struct{}) {
+	digests := make([]digest.Digest, 0, len(r))
+	for dgst := range r {
+		digests = append(digests, dgst)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i] < digests[j]
+	})
+
+	for _, dgst := range digests {
+		fate := "keep"
+		if _, ok := deleteSet[dgst]; ok {
+			fate = "delete"
+		}
+		events.emit(GCEvent{Kind: GCEventExplain, Digest: dgst}, "%s %s: %s", fate, dgst, strings.Join(r[dgst], "; "))
+	}
+}
+
+// isArtifactManifest returns true if the manifest is an OCI artifact
+// manifest, declares an artifact type or is a referrer.
+func isArtifactManifest(manifest distribution.Manifest) bool {
+	switch m := manifest.(type) {
+	case *ociartifact.DeserializedManifest:
+		return true
+	case *ocischema.DeserializedManifest:
+		return m.ArtifactType != "" || m.Subject != nil
+	case *manifestlist.DeserializedManifestList:
+		return m.ArtifactType != "" || m.Subject != nil
+	}
+	return false
+}
+
+// manifestSubject returns the subject of a referrer manifest, if any.
+func manifestSubject(manifest distribution.Manifest) *distribution.Descriptor {
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		return m.Subject
+	case *ociartifact.DeserializedManifest:
+		return m.Subject
+	case *manifestlist.DeserializedManifestList:
+		return m.Subject
+	}
+	return nil
+}
+
+// manifestPushedAt returns the time a manifest was pushed to a repository,
+// from the modification time of its revision link. A referrer counts as
+// pushed when its subject was, if that is more recent, so that it is not
+// swept before its subject.
+func manifestPushedAt(ctx context.Context, storageDriver driver.StorageDriver, repoName string, dgst digest.Digest, manifest distribution.Manifest) (time.Time, error) {
+	pushedAt, err := revisionLinkTime(ctx, storageDriver, repoName, dgst)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if subject := manifestSubject(manifest); subject != nil {
+		subjectPushedAt, err := revisionLinkTime(ctx, storageDriver, repoName, subject.Digest)
+		if err != nil {
+			if errors.Is(err, driver.ErrNotFound) {
+				return pushedAt, nil
+			}
+			return time.Time{}, err
+		}
+		if subjectPushedAt.After(pushedAt) {
+			pushedAt = subjectPushedAt
+		}
+	}
+	return pushedAt, nil
+}
+
+// revisionLinkTime returns the modification time of the revision link of a
+// manifest.
+func revisionLinkTime(ctx context.Context, storageDriver driver.StorageDriver, repoName string, dgst digest.Digest) (time.Time, error) {
+	linkPath, err := pathFor(manifestRevisionLinkPathSpec{name: repoName, revision: dgst})
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err := storageDriver.Stat(ctx, linkPath)
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return time.Time{}, err
+		}
+		return time.Time{}, fmt.Errorf("failed to stat manifest link %s: %v", linkPath, err)
+	}
+	return fi.ModTime(), nil
+}
+
+// manifestExpiry returns the expiration time recorded in the
+// AnnotationExpires annotation of a manifest, if any. Invalid annotations
+// are reported and otherwise ignored.
+func manifestExpiry(manifest distribution.Manifest) (time.Time, bool, error) {
+	var annotations map[string]string
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		annotations = m.Annotations
+	case *ociartifact.DeserializedManifest:
+		annotations = m.Annotations
+	}
+
+	value, ok := annotations[AnnotationExpires]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("ignoring invalid %s annotation %q: %v", AnnotationExpires, value, err)
+	}
+	return expiresAt, true, nil
+}
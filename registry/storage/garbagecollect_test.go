@@ -1,18 +1,24 @@
 package storage
 
 import (
+	"fmt"
 	"io"
 	"path"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
 	"github.com/distribution/distribution/v3/testutil"
 	"github.com/docker/libtrust"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type image struct {
@@ -186,7 +192,7 @@ func TestNoDeletionNoEffect(t *testing.T) {
 	before := allBlobs(t, registry)
 
 	// Run GC
-	err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+	_, err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
 		DryRun:         false,
 		RemoveUntagged: false,
 	})
@@ -261,7 +267,7 @@ func TestDeleteManifestIfTagNotFound(t *testing.T) {
 	before2 := allManifests(t, manifestService)
 
 	// run GC with dry-run (should not remove anything)
-	err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+	_, err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
 		DryRun:         true,
 		RemoveUntagged: true,
 	})
@@ -278,7 +284,7 @@ func TestDeleteManifestIfTagNotFound(t *testing.T) {
 	}
 
 	// Run GC (removes everything because no manifests with tags exist)
-	err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+	_, err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
 		DryRun:         false,
 		RemoveUntagged: true,
 	})
@@ -316,7 +322,7 @@ func TestGCWithMissingManifests(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = MarkAndSweep(context.Background(), d, registry, GCOpts{
+	_, err = MarkAndSweep(context.Background(), d, registry, GCOpts{
 		DryRun:         false,
 		RemoveUntagged: false,
 	})
@@ -346,7 +352,7 @@ func TestDeletionHasEffect(t *testing.T) {
 	manifests.Delete(ctx, image3.manifestDigest)
 
 	// Run GC
-	err := MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+	_, err := MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
 		DryRun:         false,
 		RemoveUntagged: false,
 	})
@@ -483,7 +489,7 @@ func TestOrphanBlobDeleted(t *testing.T) {
 	uploadRandomSchema2Image(t, repo)
 
 	// Run GC
-	err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+	_, err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
 		DryRun:         false,
 		RemoveUntagged: false,
 	})
@@ -500,3 +506,1217 @@ func TestOrphanBlobDeleted(t *testing.T) {
 		}
 	}
 }
+
+func uploadRandomOCIImage(t *testing.T, repository distribution.Repository, annotations map[string]string) image {
+	ctx := context.Background()
+	randomLayers, err := testutil.CreateRandomLayers(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	builder := ocischema.NewManifestBuilder(repository.Blobs(ctx), []byte(`{"architecture":"amd64","os":"linux"}`), nil, annotations)
+	for dgst := range randomLayers {
+		if err := builder.AppendReference(distribution.Descriptor{Digest: dgst, MediaType: v1.MediaTypeImageLayer}); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	manifest, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	manifestDigest := uploadImage(t, repository, image{manifest: manifest, layers: randomLayers})
+	return image{
+		manifest:       manifest,
+		manifestDigest: manifestDigest,
+		layers:         randomLayers,
+	}
+}
+
+func TestExpiredManifestDeleted(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "ci")
+
+	expired := uploadRandomOCIImage(t, repo, map[string]string{
+		AnnotationExpires: time.Now().Add(-time.Hour).Format(time.RFC3339),
+	})
+	live := uploadRandomOCIImage(t, repo, map[string]string{
+		AnnotationExpires: time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+	invalid := uploadRandomOCIImage(t, repo, map[string]string{
+		AnnotationExpires: "tomorrow",
+	})
+
+	for tag, im := range map[string]image{"expired": expired, "live": live, "invalid": invalid} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag %s: %v", tag, err)
+		}
+	}
+
+	// A dry run leaves everything in place.
+	_, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:        true,
+		RemoveExpired: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if _, ok := allManifests(t, makeManifestService(t, repo))[expired.manifestDigest]; !ok {
+		t.Fatalf("expired manifest deleted by dry run")
+	}
+
+	_, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:        false,
+		RemoveExpired: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests := allManifests(t, makeManifestService(t, repo))
+	if _, ok := manifests[expired.manifestDigest]; ok {
+		t.Fatalf("expired manifest is present")
+	}
+	for _, im := range []image{live, invalid} {
+		if _, ok := manifests[im.manifestDigest]; !ok {
+			t.Fatalf("manifest %s is missing", im.manifestDigest)
+		}
+	}
+
+	tags, err := repo.Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	sort.Strings(tags)
+	if !reflect.DeepEqual(tags, []string{"invalid", "live"}) {
+		t.Fatalf("unexpected tags after garbage collection: %v", tags)
+	}
+
+	blobs := allBlobs(t, registry)
+	for layer := range expired.layers {
+		if _, ok := blobs[layer]; ok {
+			t.Fatalf("expired manifest layer is present: %v", layer)
+		}
+	}
+	for layer := range live.layers {
+		if _, ok := blobs[layer]; !ok {
+			t.Fatalf("live manifest layer is missing: %v", layer)
+		}
+	}
+}
+
+func TestFrozenRepositoryKept(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	frozenRepo := makeRepository(t, registry, "release/app")
+	repo := makeRepository(t, registry, "ci/app")
+
+	frozen := uploadRandomSchema2Image(t, frozenRepo)
+	untagged := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	_, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+		Frozen: func(repoName string) bool {
+			return repoName == "release/app"
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if _, ok := allManifests(t, makeManifestService(t, frozenRepo))[frozen.manifestDigest]; !ok {
+		t.Fatalf("manifest of frozen repository was deleted")
+	}
+	if _, ok := allManifests(t, makeManifestService(t, repo))[untagged.manifestDigest]; ok {
+		t.Fatalf("untagged manifest is present")
+	}
+
+	blobs := allBlobs(t, registry)
+	for layer := range frozen.layers {
+		if _, ok := blobs[layer]; !ok {
+			t.Fatalf("frozen manifest layer is missing: %v", layer)
+		}
+	}
+}
+
+func TestUntaggedRetentionPeriod(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "retention")
+	manifestService := makeManifestService(t, repo)
+
+	tagged := uploadRandomOCIImage(t, repo, nil)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	old := uploadRandomOCIImage(t, repo, nil)
+	subject := uploadRandomOCIImage(t, repo, nil)
+
+	builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    subject.manifestDigest,
+	}, nil)
+	builder.(*ocischema.Builder).SetArtifactType("application/vnd.example.sbom")
+	referrer, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("failed to build referrer: %v", err)
+	}
+	referrerDigest, err := manifestService.Put(ctx, referrer)
+	if err != nil {
+		t.Fatalf("failed to put referrer: %v", err)
+	}
+
+	// Pushing the subject again makes it recent, which keeps the older
+	// referrer as well.
+	period := 500 * time.Millisecond
+	time.Sleep(period)
+	if _, err := manifestService.Put(ctx, subject.manifest); err != nil {
+		t.Fatalf("failed to put subject: %v", err)
+	}
+	young := uploadRandomOCIImage(t, repo, nil)
+
+	_, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged:          true,
+		UntaggedRetentionPeriod: period,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests := allManifests(t, manifestService)
+	if _, ok := manifests[old.manifestDigest]; ok {
+		t.Fatalf("untagged manifest older than the retention period is present")
+	}
+	for _, dgst := range []digest.Digest{tagged.manifestDigest, subject.manifestDigest, referrerDigest, young.manifestDigest} {
+		if _, ok := manifests[dgst]; !ok {
+			t.Fatalf("manifest %s is missing", dgst)
+		}
+	}
+}
+
+func TestIndexPlatformsKept(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "multiarch")
+	manifestService := makeManifestService(t, repo)
+
+	putIndex := func(children ...digest.Digest) digest.Digest {
+		t.Helper()
+		index, err := testutil.MakeManifestList(registry.BlobStatter(), children)
+		if err != nil {
+			t.Fatalf("Failed to make manifest list: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, index)
+		if err != nil {
+			t.Fatalf("Failed to add manifest list: %v", err)
+		}
+		return dgst
+	}
+	amd64 := uploadRandomOCIImage(t, repo, nil)
+	shared := uploadRandomOCIImage(t, repo, nil)
+	arm64 := uploadRandomOCIImage(t, repo, nil)
+	kept := putIndex(amd64.manifestDigest, shared.manifestDigest)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: kept}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	deleted := putIndex(shared.manifestDigest, arm64.manifestDigest)
+
+	// Pushing the platform manifests again keeps them within the retention
+	// period, unlike the untagged index referencing them.
+	period := 500 * time.Millisecond
+	time.Sleep(period)
+	for _, im := range []image{amd64, shared, arm64} {
+		if _, err := manifestService.Put(ctx, im.manifest); err != nil {
+			t.Fatalf("failed to put manifest: %v", err)
+		}
+	}
+
+	eligible := make(map[digest.Digest]struct{})
+	_, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:                  true,
+		RemoveUntagged:          true,
+		UntaggedRetentionPeriod: time.Hour,
+		Events: func(event GCEvent) {
+			if event.Kind == GCEventEligible && event.Repository != "" {
+				eligible[event.Digest] = struct{}{}
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(eligible) != 0 {
+		t.Fatalf("unexpected manifests eligible for deletion: %v", eligible)
+	}
+
+	// Without a retention period, the platform manifests of the tagged
+	// index are kept anyway.
+	_, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         true,
+		RemoveUntagged: true,
+		Events: func(event GCEvent) {
+			if event.Kind == GCEventEligible && event.Repository != "" {
+				eligible[event.Digest] = struct{}{}
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(eligible) != 2 {
+		t.Fatalf("unexpected manifests eligible for deletion: %v", eligible)
+	}
+	for _, dgst := range []digest.Digest{deleted, arm64.manifestDigest} {
+		if _, ok := eligible[dgst]; !ok {
+			t.Fatalf("manifest %s is not eligible for deletion", dgst)
+		}
+	}
+
+	_, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged:          true,
+		UntaggedRetentionPeriod: period,
+		RemoveOrphanedPlatforms: true,
+		Events:                  func(GCEvent) {},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests := allManifests(t, manifestService)
+	for _, dgst := range []digest.Digest{deleted, arm64.manifestDigest} {
+		if _, ok := manifests[dgst]; ok {
+			t.Fatalf("manifest %s of the deleted index is present", dgst)
+		}
+	}
+	for _, dgst := range []digest.Digest{kept, amd64.manifestDigest, shared.manifestDigest} {
+		if _, ok := manifests[dgst]; !ok {
+			t.Fatalf("manifest %s is missing", dgst)
+		}
+	}
+}
+
+func TestRepositoryFilters(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "tenant-a/app")
+	otherRepo := makeRepository(t, registry, "tenant-b/app")
+
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	untagged := uploadRandomSchema2Image(t, repo)
+	other := uploadRandomSchema2Image(t, otherRepo)
+
+	// The layers of the untagged image are also linked in the other tenant.
+	for _, rs := range untagged.layers {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testutil.UploadBlobs(otherRepo, untagged.layers); err != nil {
+		t.Fatalf("layer upload failed: %v", err)
+	}
+
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{IncludeRepositories: []string{"["}}); err == nil {
+		t.Fatalf("expected an error for an invalid pattern")
+	}
+
+	_, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged:      true,
+		IncludeRepositories: []string{"tenant-*"},
+		ExcludeRepositories: []string{"tenant-b"},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if _, ok := allManifests(t, makeManifestService(t, repo))[untagged.manifestDigest]; ok {
+		t.Fatalf("untagged manifest is present")
+	}
+	if _, ok := allManifests(t, makeManifestService(t, otherRepo))[other.manifestDigest]; !ok {
+		t.Fatalf("untagged manifest of excluded repository was deleted")
+	}
+
+	blobs := allBlobs(t, registry)
+	if _, ok := blobs[untagged.manifestDigest]; ok {
+		t.Fatalf("untagged manifest blob is present")
+	}
+	for layer := range untagged.layers {
+		if _, ok := blobs[layer]; !ok {
+			t.Fatalf("layer linked in excluded repository is missing: %v", layer)
+		}
+	}
+	for layer := range other.layers {
+		if _, ok := blobs[layer]; !ok {
+			t.Fatalf("layer of excluded repository is missing: %v", layer)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "explain")
+
+	tagged := uploadRandomSchema2Image(t, repo)
+	untagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	var events []GCEvent
+	_, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         true,
+		RemoveUntagged: true,
+		Explain:        true,
+		Events: func(event GCEvent) {
+			events = append(events, event)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	expected := []string{
+		fmt.Sprintf("keep %s: tagged via explain:latest", tagged.manifestDigest),
+		fmt.Sprintf("delete %s: untagged in explain", untagged.manifestDigest),
+	}
+	for layer := range tagged.layers {
+		expected = append(expected, fmt.Sprintf("keep %s: referenced by manifest explain@%s", layer, tagged.manifestDigest))
+	}
+	for orphan := range orphans {
+		expected = append(expected, fmt.Sprintf("delete %s: unreachable", orphan))
+	}
+	explanations := make(map[string]struct{})
+	for _, event := range events {
+		if event.Kind == GCEventExplain {
+			explanations[event.Message] = struct{}{}
+		}
+	}
+	for _, explanation := range expected {
+		if _, ok := explanations[explanation]; !ok {
+			t.Errorf("missing explanation %q in %v", explanation, explanations)
+		}
+	}
+}
+
+func TestDeleteRate(t *testing.T) {
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "throttled")
+
+	digests, err := testutil.CreateRandomLayers(4)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, digests); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+	uploadRandomSchema2Image(t, repo)
+
+	start := time.Now()
+	_, err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+		DeleteRate: 50,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	// Four deletes at 50 per second take at least 80ms.
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("sweep of 4 blobs took %v, expected it to be throttled", elapsed)
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range digests {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("orphan blob is present: %v", dgst)
+		}
+	}
+}
+
+func TestSweepWorkers(t *testing.T) {
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "concurrent")
+
+	digests, err := testutil.CreateRandomLayers(8)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, digests); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+	image := uploadRandomSchema2Image(t, repo)
+
+	var deletes int
+	start := time.Now()
+	report, err := MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+		SweepWorkers: 4,
+		DeleteRate:   100,
+		Events: func(event GCEvent) {
+			if event.Kind == GCEventDelete {
+				deletes++
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	// The rate applies to all workers: eight deletes at 100 per second
+	// take at least 80ms.
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("sweep of 8 blobs took %v, expected it to be throttled", elapsed)
+	}
+	if report.BlobsDeleted != len(digests) || deletes != len(digests) {
+		t.Fatalf("unexpected report %+v with %d deletes, want %d blobs deleted", report, deletes, len(digests))
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range digests {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("orphan blob is present: %v", dgst)
+		}
+	}
+	for dgst := range image.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("referenced blob is missing: %v", dgst)
+		}
+	}
+}
+
+func TestGCEvents(t *testing.T) {
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "events")
+
+	untagged := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(context.Background()).Tag(context.Background(), "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	deleted := make(map[digest.Digest]int)
+	var summaries int
+	_, err := MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Events: func(event GCEvent) {
+			switch event.Kind {
+			case GCEventDelete:
+				deleted[event.Digest]++
+			case GCEventSummary:
+				summaries++
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if summaries != 1 {
+		t.Errorf("expected 1 summary event, got %d", summaries)
+	}
+	// The manifest revision link and the manifest blob are deleted.
+	if deleted[untagged.manifestDigest] != 2 {
+		t.Errorf("expected 2 delete events for manifest %s, got %d", untagged.manifestDigest, deleted[untagged.manifestDigest])
+	}
+	for layer := range untagged.layers {
+		if deleted[layer] != 1 {
+			t.Errorf("expected 1 delete event for layer %s, got %d", layer, deleted[layer])
+		}
+	}
+}
+
+func TestGCReport(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "report")
+
+	tagged := uploadRandomOCIImage(t, repo, nil)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	untagged := uploadRandomOCIImage(t, repo, nil)
+
+	// An untagged artifact sharing the image config.
+	artifactLayers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte(`{"architecture":"amd64","os":"linux"}`), nil, nil)
+	builder.(*ocischema.Builder).SetArtifactType("application/vnd.example.sbom")
+	for dgst := range artifactLayers {
+		if err := builder.AppendReference(distribution.Descriptor{Digest: dgst, MediaType: v1.MediaTypeImageLayer}); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	artifact, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	artifactDigest := uploadImage(t, repo, image{manifest: artifact, layers: artifactLayers})
+
+	var reclaimed int64
+	for _, dgst := range append(append(getKeys(untagged.layers), getKeys(artifactLayers)...), untagged.manifestDigest, artifactDigest) {
+		desc, err := registry.BlobStatter().Stat(ctx, dgst)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", dgst, err)
+		}
+		reclaimed += desc.Size
+	}
+
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{ReportFormat: "yaml"}); err == nil {
+		t.Fatalf("expected an error for an unknown report format")
+	}
+
+	report, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		ReportFormat:   GCReportJSON,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	expected := GCReport{
+		RepositoriesScanned:      1,
+		ManifestsDeleted:         2,
+		ArtifactManifestsDeleted: 1,
+		BlobsDeleted:             5,
+		BytesReclaimed:           reclaimed,
+		RepositoryBytesReclaimed: map[string]int64{"report": reclaimed},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("unexpected report: %+v, expected %+v", report, expected)
+	}
+}
+
+func TestOnlineGC(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "online")
+	uploadingRepo := makeRepository(t, registry, "online-uploading")
+	otherRepo := makeRepository(t, registry, "online-other")
+	manifestService := makeManifestService(t, repo)
+
+	tagged := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	old := uploadRandomSchema2Image(t, repo)
+	relinked := uploadRandomSchema2Image(t, repo)
+	pending := uploadRandomSchema2Image(t, uploadingRepo)
+	if err := uploadingRepo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: pending.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	if err := uploadingRepo.Tags(ctx).Untag(ctx, "latest"); err != nil {
+		t.Fatalf("failed to untag manifest: %v", err)
+	}
+
+	grace := 500 * time.Millisecond
+	time.Sleep(grace)
+	young := uploadRandomSchema2Image(t, repo)
+	upload, err := uploadingRepo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("failed to start upload: %v", err)
+	}
+	defer upload.Cancel(ctx)
+
+	// A layer of the relinked image is mounted into another repository
+	// once the collection decided to delete it.
+	relinkedLayer := getAnyKey(relinked.layers)
+	named, err := reference.WithDigest(repo.Named(), relinkedLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := func(event GCEvent) {
+		if event.Kind != GCEventSummary {
+			return
+		}
+		if _, err := otherRepo.Blobs(ctx).Create(ctx, WithMountFrom(named)); err == nil {
+			t.Errorf("expected the layer to be mounted")
+		}
+	}
+
+	_, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Online:         true,
+		GracePeriod:    grace,
+		Events:         events,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	manifests := allManifests(t, manifestService)
+	if _, ok := manifests[old.manifestDigest]; ok {
+		t.Fatalf("untagged manifest older than the grace period is present")
+	}
+	if _, ok := manifests[young.manifestDigest]; !ok {
+		t.Fatalf("untagged manifest within the grace period is missing")
+	}
+	if _, ok := allManifests(t, makeManifestService(t, uploadingRepo))[pending.manifestDigest]; ok {
+		t.Fatalf("untagged manifest of the repository with uploads in progress is present")
+	}
+	blobs := allBlobs(t, registry)
+	for dgst := range old.layers {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("layer %s of the old image is present", dgst)
+		}
+	}
+	for _, im := range []image{young, pending} {
+		for dgst := range im.layers {
+			if _, ok := blobs[dgst]; !ok {
+				t.Fatalf("layer %s is missing", dgst)
+			}
+		}
+	}
+	if _, ok := blobs[relinkedLayer]; !ok {
+		t.Fatalf("layer linked during the collection is missing")
+	}
+
+	for _, spec := range []pathSpec{gcRunningPathSpec{}, gcFencesPathSpec{}} {
+		p, err := pathFor(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := inmemoryDriver.Stat(ctx, p); err == nil {
+			t.Fatalf("%s is present after the collection", p)
+		}
+	}
+
+	// Only one online collection runs at a time.
+	runningPath, err := pathFor(gcRunningPathSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, runningPath, []byte(time.Now().Format(time.RFC3339))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{Online: true}); err == nil {
+		t.Fatalf("expected an error while another collection is running")
+	}
+}
+
+func TestDanglingReferrerLinks(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "referrers")
+	manifestService := makeManifestService(t, repo)
+
+	subject := uploadRandomOCIImage(t, repo, nil)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: subject.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	pushReferrer := func(artifactType string) string {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		linkPath, err := pathFor(referrersLinkPathSpec{name: "referrers", revision: dgst, subjectRevision: subject.manifestDigest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return linkPath
+	}
+	untaggedLink := pushReferrer("application/vnd.example.sbom")
+	removedLink := pushReferrer("application/vnd.example.signature")
+
+	// Deleting the manifest directly leaves its referrer link behind.
+	removed, err := digestFromPath(path.Dir(removedLink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewVacuum(ctx, inmemoryDriver).RemoveManifest("referrers", removed, nil); err != nil {
+		t.Fatalf("failed to remove manifest: %v", err)
+	}
+
+	report, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{DryRun: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if !reflect.DeepEqual(report.DanglingReferrerLinks, []string{removedLink}) {
+		t.Fatalf("unexpected dangling referrer links %v, want %v", report.DanglingReferrerLinks, []string{removedLink})
+	}
+
+	report, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{DryRun: true, RemoveUntagged: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	want := []string{untaggedLink, removedLink}
+	sort.Strings(want)
+	got := append([]string(nil), report.DanglingReferrerLinks...)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected dangling referrer links %v, want %v", got, want)
+	}
+
+	report, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(report.DanglingReferrerLinks) != 0 {
+		t.Fatalf("dangling referrer links reported outside of a dry run: %v", report.DanglingReferrerLinks)
+	}
+}
+
+func TestReferrerChainDeleted(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "chains")
+	manifestService := makeManifestService(t, repo)
+
+	pushReferrer := func(subject digest.Digest, artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+
+	expired := uploadRandomOCIImage(t, repo, map[string]string{
+		AnnotationExpires: time.Now().Add(-time.Hour).Format(time.RFC3339),
+	})
+	sbom := pushReferrer(expired.manifestDigest, "application/vnd.example.sbom")
+	attestation := pushReferrer(sbom, "application/vnd.example.attestation")
+	signature := pushReferrer(attestation, "application/vnd.example.signature")
+	kept := uploadRandomOCIImage(t, repo, nil)
+	keptSignature := pushReferrer(kept.manifestDigest, "application/vnd.example.signature")
+	for tag, dgst := range map[string]digest.Digest{"latest": kept.manifestDigest, "expired": expired.manifestDigest, "sbom": sbom} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatalf("failed to tag %s: %v", tag, err)
+		}
+	}
+
+	report, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{RemoveExpired: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if report.ManifestsDeleted != 4 || report.ArtifactManifestsDeleted != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	manifests := allManifests(t, manifestService)
+	for _, dgst := range []digest.Digest{expired.manifestDigest, sbom, attestation, signature} {
+		if _, ok := manifests[dgst]; ok {
+			t.Fatalf("manifest %s of the deleted chain was kept", dgst)
+		}
+	}
+	for _, dgst := range []digest.Digest{kept.manifestDigest, keptSignature} {
+		if _, ok := manifests[dgst]; !ok {
+			t.Fatalf("manifest %s was deleted", dgst)
+		}
+	}
+	if _, err := repo.Tags(ctx).Get(ctx, "sbom"); err == nil {
+		t.Fatal("tag of a deleted referrer was kept")
+	}
+}
+
+func TestCollectRepository(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "collected")
+	manifestService := makeManifestService(t, repo)
+	other := makeRepository(t, registry, "other")
+
+	tagged := uploadRandomOCIImage(t, repo, nil)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	untagged := uploadRandomOCIImage(t, repo, nil)
+	otherUntagged := uploadRandomOCIImage(t, other, nil)
+
+	// Deleting a referrer directly leaves its link behind.
+	builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    tagged.manifestDigest,
+	}, nil)
+	referrer, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("failed to build referrer: %v", err)
+	}
+	referrerDigest, err := manifestService.Put(ctx, referrer)
+	if err != nil {
+		t.Fatalf("failed to put referrer: %v", err)
+	}
+	if err := NewVacuum(ctx, inmemoryDriver).RemoveManifest("collected", referrerDigest, nil); err != nil {
+		t.Fatalf("failed to remove manifest: %v", err)
+	}
+	referrerLink, err := pathFor(referrersLinkPathSpec{name: "collected", revision: referrerDigest, subjectRevision: tagged.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := allBlobs(t, registry)
+	report, err := CollectRepository(ctx, inmemoryDriver, registry, "collected", GCOpts{RemoveUntagged: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed collection: %v", err)
+	}
+	if report.ManifestsDeleted != 1 || report.BlobsDeleted != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	// The layer links of the untagged manifest, the config link of the
+	// referrer and its referrer link.
+	if report.LinksDeleted != len(untagged.layers)+2 {
+		t.Fatalf("unexpected number of links deleted %d, want %d", report.LinksDeleted, len(untagged.layers)+2)
+	}
+
+	manifests := allManifests(t, manifestService)
+	if _, ok := manifests[untagged.manifestDigest]; ok {
+		t.Fatalf("untagged manifest was not deleted")
+	}
+	if _, ok := manifests[tagged.manifestDigest]; !ok {
+		t.Fatalf("tagged manifest was deleted")
+	}
+	for dgst := range untagged.layers {
+		if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Fatalf("layer %s still linked: %v", dgst, err)
+		}
+	}
+	for dgst := range tagged.layers {
+		if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("layer %s of tagged manifest unlinked: %v", dgst, err)
+		}
+	}
+	if _, err := inmemoryDriver.Stat(ctx, referrerLink); err == nil {
+		t.Fatalf("dangling referrer link was not deleted")
+	}
+	if after := allBlobs(t, registry); !reflect.DeepEqual(after, before) {
+		t.Fatalf("blobs deleted by a repository collection")
+	}
+	if _, ok := allManifests(t, makeManifestService(t, other))[otherUntagged.manifestDigest]; !ok {
+		t.Fatalf("manifest of another repository was deleted")
+	}
+
+	_, err = CollectRepository(ctx, inmemoryDriver, registry, "unknown", GCOpts{Events: func(GCEvent) {}})
+	if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error collecting an unknown repository: %v", err)
+	}
+}
+
+func TestGCProgress(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	for _, name := range []string{"progress/a", "progress/b"} {
+		repo := makeRepository(t, registry, name)
+		image := uploadRandomOCIImage(t, repo, nil)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+		uploadRandomOCIImage(t, repo, nil)
+	}
+
+	var updates []GCProgress
+	report, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Events:         func(GCEvent) {},
+		OnProgress: func(progress GCProgress) {
+			updates = append(updates, progress)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if len(updates) < 2 {
+		t.Fatalf("expected progress at the end of each phase, got %v", updates)
+	}
+	for i := 1; i < len(updates); i++ {
+		if updates[i].Completion < updates[i-1].Completion {
+			t.Fatalf("completion went backwards: %v", updates)
+		}
+	}
+	if updates[len(updates)-2].Phase != GCPhaseSweep || updates[len(updates)-2].Completion != 0.5 {
+		t.Fatalf("unexpected progress at the end of marking: %+v", updates[len(updates)-2])
+	}
+	last := updates[len(updates)-1]
+	if last.Phase != GCPhaseDone || last.Completion != 1 || last.Remaining != 0 {
+		t.Fatalf("unexpected final progress: %+v", last)
+	}
+	if last.RepositoriesProcessed != 2 || last.ManifestsMarked != 2 || last.BlobsSwept != report.BlobsDeleted {
+		t.Fatalf("unexpected final progress %+v for report %+v", last, report)
+	}
+}
+
+func TestRepositoryBytesReclaimed(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	expected := make(map[string]int64)
+	var total int64
+	for _, name := range []string{"reclaimed/a", "reclaimed/b"} {
+		repo := makeRepository(t, registry, name)
+		tagged := uploadRandomOCIImage(t, repo, nil)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+		untagged := uploadRandomOCIImage(t, repo, nil)
+		for _, dgst := range append(getKeys(untagged.layers), untagged.manifestDigest) {
+			desc, err := registry.BlobStatter().Stat(ctx, dgst)
+			if err != nil {
+				t.Fatalf("failed to stat %s: %v", dgst, err)
+			}
+			expected[name] += desc.Size
+			total += desc.Size
+		}
+	}
+
+	// A blob no manifest references only counts in the total.
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := testutil.UploadBlobs(makeRepository(t, registry, "reclaimed/a"), orphans); err != nil {
+		t.Fatalf("failed to upload blob: %v", err)
+	}
+	for dgst := range orphans {
+		desc, err := registry.BlobStatter().Stat(ctx, dgst)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", dgst, err)
+		}
+		total += desc.Size
+	}
+
+	var events []GCEvent
+	report, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Events: func(event GCEvent) {
+			if event.Kind == GCEventReclaimed {
+				events = append(events, event)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if report.BytesReclaimed != total {
+		t.Fatalf("unexpected bytes reclaimed %d, want %d", report.BytesReclaimed, total)
+	}
+	if !reflect.DeepEqual(report.RepositoryBytesReclaimed, expected) {
+		t.Fatalf("unexpected bytes reclaimed per repository %v, want %v", report.RepositoryBytesReclaimed, expected)
+	}
+	if len(events) != 3 || events[0].Repository != "reclaimed/a" || events[1].Repository != "reclaimed/b" || events[2].Repository != "" {
+		t.Fatalf("unexpected reclaimed events %+v", events)
+	}
+}
+
+func TestGCJournalUndo(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "journaled")
+	manifestService := makeManifestService(t, repo)
+
+	tagged := uploadRandomOCIImage(t, repo, nil)
+	expired := uploadRandomOCIImage(t, repo, map[string]string{
+		AnnotationExpires: time.Now().Add(-time.Hour).Format(time.RFC3339),
+	})
+	for tag, im := range map[string]image{"latest": tagged, "expired": expired} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag %s: %v", tag, err)
+		}
+	}
+	untagged := uploadRandomOCIImage(t, repo, nil)
+	lost := uploadRandomOCIImage(t, repo, nil)
+
+	// Back up every blob but the manifest of lost.
+	backup := inmemory.New()
+	for dgst := range allBlobs(t, registry) {
+		if dgst == lost.manifestDigest {
+			continue
+		}
+		dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := inmemoryDriver.GetContent(ctx, dataPath)
+		if err != nil {
+			t.Fatalf("failed to read blob %s: %v", dgst, err)
+		}
+		if err := backup.PutContent(ctx, dataPath, content); err != nil {
+			t.Fatalf("failed to back up blob %s: %v", dgst, err)
+		}
+	}
+
+	// Dry runs do not write journals.
+	report, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{DryRun: true, RemoveUntagged: true, RemoveExpired: true, Journal: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if report.Journal != "" {
+		t.Fatalf("dry run wrote journal %s", report.Journal)
+	}
+
+	report, err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{RemoveUntagged: true, RemoveExpired: true, Journal: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if report.ManifestsDeleted != 3 || report.Journal == "" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	journal, err := ReadGCJournal(ctx, inmemoryDriver, report.Journal)
+	if err != nil {
+		t.Fatalf("failed to read journal: %v", err)
+	}
+	kinds := make(map[GCJournalEntryKind]int)
+	for _, entry := range journal.Entries {
+		kinds[entry.Kind]++
+	}
+	if kinds[GCJournalManifest] != 3 || kinds[GCJournalTag] != 1 || kinds[GCJournalBlob] != report.BlobsDeleted {
+		t.Fatalf("unexpected journal entries %v", kinds)
+	}
+
+	undo, err := UndoGC(ctx, inmemoryDriver, backup, report.Journal)
+	if err != nil {
+		t.Fatalf("failed to undo garbage collection: %v", err)
+	}
+	if undo.ManifestsRestored != 2 || undo.TagsRestored != 1 || undo.BlobsRestored != report.BlobsDeleted-1 {
+		t.Fatalf("unexpected undo report %+v", undo)
+	}
+	if !reflect.DeepEqual(undo.MissingBlobs, []digest.Digest{lost.manifestDigest}) {
+		t.Fatalf("unexpected missing blobs %v", undo.MissingBlobs)
+	}
+
+	manifests := allManifests(t, manifestService)
+	for _, im := range []image{tagged, expired, untagged} {
+		if _, ok := manifests[im.manifestDigest]; !ok {
+			t.Fatalf("manifest %s was not restored", im.manifestDigest)
+		}
+		if _, err := manifestService.Get(ctx, im.manifestDigest); err != nil {
+			t.Fatalf("failed to get restored manifest %s: %v", im.manifestDigest, err)
+		}
+		for dgst := range im.layers {
+			if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+				t.Fatalf("layer %s was not restored: %v", dgst, err)
+			}
+		}
+	}
+	if _, ok := manifests[lost.manifestDigest]; ok {
+		t.Fatalf("manifest missing from the backup was restored")
+	}
+	desc, err := repo.Tags(ctx).Get(ctx, "expired")
+	if err != nil || desc.Digest != expired.manifestDigest {
+		t.Fatalf("tag was not restored: %v, %v", desc, err)
+	}
+
+	if _, err := UndoGC(ctx, inmemoryDriver, backup, "../running"); err == nil {
+		t.Fatalf("expected an error undoing an invalid journal")
+	}
+}
+
+func TestGCEnumerationRetries(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "flaky")
+	tagged := uploadRandomOCIImage(t, repo, nil)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+	untagged := uploadRandomOCIImage(t, repo, nil)
+
+	blobsPath, err := pathFor(blobsPathSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky := &flakyDriver{StorageDriver: inmemoryDriver, failPrefix: blobsPath + "/sha256/"}
+	registry = createRegistry(t, flaky)
+
+	_, err = MarkAndSweep(ctx, flaky, registry, GCOpts{RemoveUntagged: true, Events: func(GCEvent) {}})
+	if err == nil {
+		t.Fatalf("expected the collection to fail without retries")
+	}
+
+	flaky.failed = false
+	var warnings int
+	report, err := MarkAndSweep(ctx, flaky, registry, GCOpts{
+		RemoveUntagged:     true,
+		EnumerationRetries: 1,
+		Events: func(event GCEvent) {
+			if event.Kind == GCEventWarning {
+				warnings++
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if !flaky.failed || warnings != 1 {
+		t.Fatalf("enumeration was not resumed, %d warnings", warnings)
+	}
+	if report.BlobsDeleted != len(untagged.layers)+1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	blobs := allBlobs(t, registry)
+	for dgst := range tagged.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("layer %s of tagged manifest was deleted", dgst)
+		}
+	}
+	for dgst := range untagged.layers {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("layer %s of untagged manifest was kept", dgst)
+		}
+	}
+}
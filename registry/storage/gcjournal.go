@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// GCJournalEntryKind identifies what a GCJournalEntry records the deletion
+// of.
+type GCJournalEntryKind string
+
+const (
+	// GCJournalManifest records the deletion of the revision link of a
+	// manifest and of its entries in the tag indexes.
+	GCJournalManifest GCJournalEntryKind = "manifest"
+	// GCJournalTag records the deletion of a tag pointing at a deleted
+	// manifest.
+	GCJournalTag GCJournalEntryKind = "tag"
+	// GCJournalReferrerLink records the deletion of the link of a referrer
+	// from the referrers of its subject.
+	GCJournalReferrerLink GCJournalEntryKind = "referrer-link"
+	// GCJournalLayerLink records the deletion of the link of a blob into a
+	// repository.
+	GCJournalLayerLink GCJournalEntryKind = "layer-link"
+	// GCJournalBlob records the deletion of a blob.
+	GCJournalBlob GCJournalEntryKind = "blob"
+)
+
+// GCJournalEntry is a deletion recorded in a garbage collection journal.
+type GCJournalEntry struct {
+	Kind GCJournalEntryKind `json:"kind"`
+	// Path is the storage path deleted.
+	Path string `json:"path"`
+	// Repository is the repository of manifests, tags and links.
+	Repository string `json:"repository,omitempty"`
+	// Digest is the deleted blob or manifest, the manifest a tag pointed
+	// at, or the linked blob or referrer.
+	Digest digest.Digest `json:"digest"`
+	// Tag is the name of a deleted tag, or for manifests, the tags whose
+	// index listed the manifest.
+	Tag  string   `json:"tag,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	// Subject is the subject of a referrer link.
+	Subject digest.Digest `json:"subject,omitempty"`
+}
+
+// GCJournal lists the deletions of a garbage collection, recorded before
+// they are made so that UndoGC can restore them.
+type GCJournal struct {
+	ID        string           `json:"id"`
+	StartedAt time.Time        `json:"startedAt"`
+	Entries   []GCJournalEntry `json:"entries"`
+}
+
+// gcJournal records a journal to the storage driver.
+type gcJournal struct {
+	driver  driver.StorageDriver
+	journal GCJournal
+}
+
+// newGCJournal returns a journal named after the start of the collection.
+func newGCJournal(storageDriver driver.StorageDriver, startedAt time.Time) *gcJournal {
+	return &gcJournal{
+		driver: storageDriver,
+		journal: GCJournal{
+			ID:        startedAt.UTC().Format("20060102T150405.000000000Z"),
+			StartedAt: startedAt.UTC(),
+		},
+	}
+}
+
+// record writes the journal with the given entries added, which must be
+// done before the deletions they record are made. Nothing is written until
+// there is something to record.
+func (j *gcJournal) record(ctx context.Context, entries ...GCJournalEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	j.journal.Entries = append(j.journal.Entries, entries...)
+	content, err := json.Marshal(j.journal)
+	if err != nil {
+		return err
+	}
+	journalPath, err := pathFor(gcJournalPathSpec{id: j.journal.ID})
+	if err != nil {
+		return err
+	}
+	if err := j.driver.PutContent(ctx, journalPath, content); err != nil {
+		return fmt.Errorf("failed to write garbage collection journal: %v", err)
+	}
+	return nil
+}
+
+// written reports whether the journal was written.
+func (j *gcJournal) written() bool {
+	return len(j.journal.Entries) > 0
+}
+
+// manifestEntry returns the entry of a manifest about to be deleted, with
+// the tags whose index lists it.
+func (j *gcJournal) manifestEntry(ctx context.Context, del ManifestDel) (GCJournalEntry, error) {
+	revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: del.Name, revision: del.Digest})
+	if err != nil {
+		return GCJournalEntry{}, err
+	}
+	entry := GCJournalEntry{Kind: GCJournalManifest, Path: revisionPath, Repository: del.Name, Digest: del.Digest}
+	for _, tag := range del.Tags {
+		indexPath, err := pathFor(manifestTagIndexEntryLinkPathSpec{name: del.Name, revision: del.Digest, tag: tag})
+		if err != nil {
+			return GCJournalEntry{}, err
+		}
+		if _, err := j.driver.Stat(ctx, indexPath); err != nil {
+			if errors.Is(err, driver.ErrNotFound) {
+				continue
+			}
+			return GCJournalEntry{}, err
+		}
+		entry.Tags = append(entry.Tags, tag)
+	}
+	return entry, nil
+}
+
+// tagEntry returns the entry of a tag about to be deleted along with the
+// manifest it points at.
+func tagEntry(repoName, tag string, dgst digest.Digest) (GCJournalEntry, error) {
+	tagPath, err := pathFor(manifestTagCurrentPathSpec{name: repoName, tag: tag})
+	if err != nil {
+		return GCJournalEntry{}, err
+	}
+	return GCJournalEntry{Kind: GCJournalTag, Path: tagPath, Repository: repoName, Digest: dgst, Tag: tag}, nil
+}
+
+// referrerLinkEntry returns the entry of a referrer link about to be
+// deleted.
+func referrerLinkEntry(repoName string, link referrerLink) GCJournalEntry {
+	return GCJournalEntry{Kind: GCJournalReferrerLink, Path: link.path, Repository: repoName, Digest: link.referrer, Subject: link.subject}
+}
+
+// layerLinkEntry returns the entry of a layer link about to be deleted.
+func layerLinkEntry(repoName string, dgst digest.Digest) (GCJournalEntry, error) {
+	linkPath, err := pathFor(layerLinkPathSpec{name: repoName, digest: dgst})
+	if err != nil {
+		return GCJournalEntry{}, err
+	}
+	return GCJournalEntry{Kind: GCJournalLayerLink, Path: linkPath, Repository: repoName, Digest: dgst}, nil
+}
+
+// blobEntry returns the entry of a blob about to be deleted.
+func blobEntry(dgst digest.Digest) (GCJournalEntry, error) {
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return GCJournalEntry{}, err
+	}
+	return GCJournalEntry{Kind: GCJournalBlob, Path: dataPath, Digest: dgst}, nil
+}
+
+// GCUndoReport summarizes what UndoGC restored.
+type GCUndoReport struct {
+	BlobsRestored     int `json:"blobsRestored"`
+	ManifestsRestored int `json:"manifestsRestored"`
+	TagsRestored      int `json:"tagsRestored"`
+	LinksRestored     int `json:"linksRestored"`
+	// MissingBlobs lists the deleted blobs found in neither the storage
+	// nor the backup. The manifests, tags and links to them are not
+	// restored.
+	MissingBlobs []digest.Digest `json:"missingBlobs,omitempty"`
+}
+
+// ReadGCJournal reads the journal of a garbage collection.
+func ReadGCJournal(ctx context.Context, storageDriver driver.StorageDriver, id string) (GCJournal, error) {
+	if id == "" || id == "." || id == ".." || strings.Contains(id, "/") {
+		return GCJournal{}, fmt.Errorf("invalid garbage collection journal %q", id)
+	}
+	journalPath, err := pathFor(gcJournalPathSpec{id: id})
+	if err != nil {
+		return GCJournal{}, err
+	}
+	content, err := storageDriver.GetContent(ctx, journalPath)
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return GCJournal{}, fmt.Errorf("unknown garbage collection journal %q", id)
+		}
+		return GCJournal{}, err
+	}
+	var journal GCJournal
+	if err := json.Unmarshal(content, &journal); err != nil {
+		return GCJournal{}, fmt.Errorf("invalid garbage collection journal %q: %v", id, err)
+	}
+	return journal, nil
+}
+
+// UndoGC restores the deletions recorded in the journal of a garbage
+// collection. Deleted blobs still present in the storage are kept, the
+// others are copied from backup, if set, when they are found there. The
+// manifests, tags and links to blobs which could not be restored are left
+// deleted, as are tags which were pushed again since. Tags are restored
+// pointing at the manifest they pointed at when deleted, without their
+// previous revisions.
+func UndoGC(ctx context.Context, storageDriver, backup driver.StorageDriver, id string) (GCUndoReport, error) {
+	var report GCUndoReport
+	journal, err := ReadGCJournal(ctx, storageDriver, id)
+	if err != nil {
+		return report, err
+	}
+
+	// Blobs first, so that nothing links to missing content.
+	missing := make(map[digest.Digest]struct{})
+	for _, entry := range journal.Entries {
+		if entry.Kind != GCJournalBlob {
+			continue
+		}
+		restored, err := restoreBlob(ctx, storageDriver, backup, entry.Digest)
+		if err != nil {
+			return report, fmt.Errorf("failed to restore blob %s: %v", entry.Digest, err)
+		}
+		if restored {
+			report.BlobsRestored++
+			continue
+		}
+		exists, err := blobExists(ctx, storageDriver, entry.Digest)
+		if err != nil {
+			return report, err
+		}
+		if !exists {
+			missing[entry.Digest] = struct{}{}
+			report.MissingBlobs = append(report.MissingBlobs, entry.Digest)
+			dcontext.GetLogger(ctx).Warnf("blob %s deleted by garbage collection %s is not in the backup", entry.Digest, id)
+		}
+	}
+
+	for _, entry := range journal.Entries {
+		if _, ok := missing[entry.Digest]; ok {
+			continue
+		}
+		switch entry.Kind {
+		case GCJournalManifest:
+			if err := restoreLink(ctx, storageDriver, manifestRevisionLinkPathSpec{name: entry.Repository, revision: entry.Digest}, entry.Digest); err != nil {
+				return report, err
+			}
+			for _, tag := range entry.Tags {
+				if err := restoreLink(ctx, storageDriver, manifestTagIndexEntryLinkPathSpec{name: entry.Repository, revision: entry.Digest, tag: tag}, entry.Digest); err != nil {
+					return report, err
+				}
+			}
+			// Referrers indexes built since the deletion miss the manifest.
+			if err := deleteReferrersIndexes(ctx, storageDriver, entry.Repository); err != nil {
+				return report, err
+			}
+			report.ManifestsRestored++
+		case GCJournalReferrerLink:
+			// The link is restored in the layout it was deleted from.
+			if err := restoreLinkPath(ctx, storageDriver, entry.Path, entry.Digest); err != nil {
+				return report, err
+			}
+			if err := deleteReferrersIndex(ctx, storageDriver, entry.Repository, entry.Subject); err != nil {
+				return report, err
+			}
+			report.LinksRestored++
+		case GCJournalLayerLink:
+			if err := restoreLink(ctx, storageDriver, layerLinkPathSpec{name: entry.Repository, digest: entry.Digest}, entry.Digest); err != nil {
+				return report, err
+			}
+			report.LinksRestored++
+		}
+	}
+
+	// Tags last, once the manifests they point at are back.
+	for _, entry := range journal.Entries {
+		if entry.Kind != GCJournalTag {
+			continue
+		}
+		if _, ok := missing[entry.Digest]; ok {
+			continue
+		}
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: entry.Repository, tag: entry.Tag})
+		if err != nil {
+			return report, err
+		}
+		if _, err := storageDriver.Stat(ctx, currentPath); err == nil {
+			dcontext.GetLogger(ctx).Warnf("tag %s:%s was pushed again since garbage collection %s, not restoring it", entry.Repository, entry.Tag, id)
+			continue
+		} else if !errors.Is(err, driver.ErrNotFound) {
+			return report, err
+		}
+		if err := restoreLink(ctx, storageDriver, manifestTagIndexEntryLinkPathSpec{name: entry.Repository, revision: entry.Digest, tag: entry.Tag}, entry.Digest); err != nil {
+			return report, err
+		}
+		if err := restoreLink(ctx, storageDriver, manifestTagCurrentPathSpec{name: entry.Repository, tag: entry.Tag}, entry.Digest); err != nil {
+			return report, err
+		}
+		report.TagsRestored++
+	}
+	return report, nil
+}
+
+// restoreLink writes a link to dgst.
+func restoreLink(ctx context.Context, storageDriver driver.StorageDriver, spec pathSpec, dgst digest.Digest) error {
+	linkPath, err := pathFor(spec)
+	if err != nil {
+		return err
+	}
+	return restoreLinkPath(ctx, storageDriver, linkPath, dgst)
+}
+
+// restoreLinkPath writes a link to dgst at linkPath.
+func restoreLinkPath(ctx context.Context, storageDriver driver.StorageDriver, linkPath string, dgst digest.Digest) error {
+	dcontext.GetLogger(ctx).Infof("restoring link: %s", linkPath)
+	if err := storageDriver.PutContent(ctx, linkPath, []byte(dgst)); err != nil {
+		return fmt.Errorf("failed to restore link %s: %v", linkPath, err)
+	}
+	return nil
+}
+
+// blobExists reports whether the data of a blob is in the storage.
+func blobExists(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest) (bool, error) {
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return false, err
+	}
+	if _, err := storageDriver.Stat(ctx, dataPath); err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// restoreBlob copies a blob missing from the storage from the backup, and
+// reports whether it did.
+func restoreBlob(ctx context.Context, storageDriver, backup driver.StorageDriver, dgst digest.Digest) (bool, error) {
+	exists, err := blobExists(ctx, storageDriver, dgst)
+	if err != nil || exists || backup == nil {
+		return false, err
+	}
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return false, err
+	}
+	reader, err := backup.Reader(ctx, dataPath, 0)
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer reader.Close()
+
+	// Check the content as it is copied: the backup may hold another
+	// version of the path.
+	verifier := dgst.Verifier()
+	writer, err := storageDriver.Writer(ctx, dataPath, false)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(io.MultiWriter(writer, verifier), reader); err != nil {
+		writer.Cancel()
+		return false, err
+	}
+	if !verifier.Verified() {
+		writer.Cancel()
+		return false, fmt.Errorf("content of the backup does not match the digest")
+	}
+	if err := writer.Commit(); err != nil {
+		writer.Cancel()
+		return false, err
+	}
+	if err := writer.Close(); err != nil {
+		return false, err
+	}
+	dcontext.GetLogger(ctx).Infof("restored blob from backup: %s", dataPath)
+	return true, nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"time"
+
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/docker/go-metrics"
+)
+
+var (
+	// gcMarkDuration and gcSweepDuration are the durations of the phases
+	// of the last garbage collection. Collections take far longer than
+	// the buckets of a timer cover.
+	gcMarkDuration  = prometheus.GCNamespace.NewGauge("mark_duration", "The number of seconds the mark phase of the last garbage collection took", metrics.Seconds)
+	gcSweepDuration = prometheus.GCNamespace.NewGauge("sweep_duration", "The number of seconds the sweep phase of the last garbage collection took", metrics.Seconds)
+
+	gcManifestsDeleted         = prometheus.GCNamespace.NewCounter("manifests_deleted", "The number of manifests deleted by garbage collection")
+	gcArtifactManifestsDeleted = prometheus.GCNamespace.NewCounter("artifact_manifests_deleted", "The number of artifact and referrer manifests deleted by garbage collection")
+	gcBlobsDeleted             = prometheus.GCNamespace.NewCounter("blobs_deleted", "The number of blobs deleted by garbage collection")
+	gcBytesReclaimed           = prometheus.GCNamespace.NewCounter("bytes_reclaimed", "The number of bytes reclaimed by garbage collection")
+	gcErrors                   = prometheus.GCNamespace.NewCounter("errors", "The number of garbage collections which failed")
+
+	// gcLastSuccess is when the last garbage collection completed, so that
+	// alerts can fire when scheduled collections stop succeeding.
+	gcLastSuccess = prometheus.GCNamespace.NewGauge("last_success_timestamp", "The time the last garbage collection completed, in seconds since the epoch", metrics.Seconds)
+)
+
+func init() {
+	metrics.Register(prometheus.GCNamespace)
+}
+
+// observeGC records the outcome of a garbage collection in the metrics.
+// Dry runs do not count as completed collections.
+func observeGC(report GCReport, err error) (GCReport, error) {
+	switch {
+	case err != nil:
+		gcErrors.Inc(1)
+	case !report.DryRun:
+		gcLastSuccess.Set(float64(time.Now().Unix()))
+	}
+	return report, err
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/docker/go-metrics"
+)
+
+// gcMetrics returns the values of the garbage collection metrics.
+func gcMetrics(t *testing.T) map[string]float64 {
+	t.Helper()
+	return metricValues(t, "registry_gc_")
+}
+
+// metricValues returns the values of the metrics whose name starts with
+// prefix.
+func metricValues(t *testing.T, prefix string) map[string]float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("invalid value of %s: %v", name, err)
+		}
+		values[name] = v
+	}
+	return values
+}
+
+func TestGCMetrics(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "metrics")
+	image := uploadRandomSchema2Image(t, repo)
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatalf("failed to get manifest service: %v", err)
+	}
+	if err := manifests.Delete(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+
+	before := gcMetrics(t)
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{DryRun: true, Events: func(GCEvent) {}}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if after := gcMetrics(t); after["registry_gc_blobs_deleted_total"] != before["registry_gc_blobs_deleted_total"] {
+		t.Fatalf("dry run counted deleted blobs")
+	}
+
+	report, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	after := gcMetrics(t)
+	for name, want := range map[string]int{
+		"registry_gc_blobs_deleted_total":     report.BlobsDeleted,
+		"registry_gc_manifests_deleted_total": report.ManifestsDeleted,
+		"registry_gc_bytes_reclaimed_total":   int(report.BytesReclaimed),
+		"registry_gc_errors_total":            0,
+	} {
+		if got := after[name] - before[name]; got != float64(want) {
+			t.Errorf("%s increased by %v, want %d", name, got, want)
+		}
+	}
+	if report.BlobsDeleted == 0 {
+		t.Fatalf("nothing was collected")
+	}
+	if after["registry_gc_last_success_timestamp_seconds"] == 0 {
+		t.Errorf("last success not recorded")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := MarkAndSweep(cancelled, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}}); err == nil {
+		t.Fatal("expected a cancelled collection to fail")
+	}
+	if got := gcMetrics(t)["registry_gc_errors_total"] - after["registry_gc_errors_total"]; got != 1 {
+		t.Fatalf("errors increased by %v, want 1", got)
+	}
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// DefaultGCGracePeriod is the grace window of online garbage collections
+// which do not set one.
+const DefaultGCGracePeriod = time.Hour
+
+// fenceDigests records blobs and manifests about to be linked or referenced
+// while an online garbage collection is running, so that the collection
+// does not sweep them. It must be called before checking that the content
+// exists: either the collection sees the fence, or the check fails.
+func fenceDigests(ctx context.Context, storageDriver driver.StorageDriver, dgsts ...digest.Digest) error {
+	runningPath, err := pathFor(gcRunningPathSpec{})
+	if err != nil {
+		return err
+	}
+	if _, err := storageDriver.Stat(ctx, runningPath); err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	for _, dgst := range dgsts {
+		fencePath, err := pathFor(gcFencePathSpec{digest: dgst})
+		if err != nil {
+			return err
+		}
+		if err := storageDriver.PutContent(ctx, fencePath, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onlineGC holds the state of a garbage collection running against a live
+// registry.
+type onlineGC struct {
+	driver driver.StorageDriver
+	// cutoff is the start of the grace window: blobs written and links
+	// created since are kept.
+	cutoff time.Time
+	// fencing is set when the registry fences the content it links, which
+	// is only needed when the collection deletes anything.
+	fencing bool
+}
+
+// startOnlineGC signals the registry to fence the content it links until
+// stop is called, unless fencing is false. It fails if another online
+// collection is running.
+func startOnlineGC(ctx context.Context, storageDriver driver.StorageDriver, now, cutoff time.Time, fencing bool) (*onlineGC, error) {
+	online := &onlineGC{driver: storageDriver, cutoff: cutoff, fencing: fencing}
+	if !fencing {
+		return online, nil
+	}
+
+	runningPath, err := pathFor(gcRunningPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+	content, err := storageDriver.GetContent(ctx, runningPath)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("an online garbage collection started at %s is running, remove %s if it was interrupted", content, runningPath)
+	case errors.Is(err, driver.ErrNotFound):
+	default:
+		return nil, err
+	}
+	if err := storageDriver.PutContent(ctx, runningPath, []byte(now.UTC().Format(time.RFC3339))); err != nil {
+		return nil, fmt.Errorf("failed to start online garbage collection: %v", err)
+	}
+	return online, nil
+}
+
+// stop removes the fences and lets the registry stop fencing.
+func (o *onlineGC) stop(ctx context.Context) error {
+	if !o.fencing {
+		return nil
+	}
+	for _, spec := range []pathSpec{gcRunningPathSpec{}, gcFencesPathSpec{}} {
+		p, err := pathFor(spec)
+		if err != nil {
+			return err
+		}
+		if err := o.driver.Delete(ctx, p); err != nil {
+			if !errors.Is(err, driver.ErrNotFound) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fenced reports whether the registry linked or referenced a blob or
+// manifest since the collection started.
+func (o *onlineGC) fenced(ctx context.Context, dgst digest.Digest) (bool, error) {
+	if !o.fencing {
+		return false, nil
+	}
+	fencePath, err := pathFor(gcFencePathSpec{digest: dgst})
+	if err != nil {
+		return false, err
+	}
+	if _, err := o.driver.Stat(ctx, fencePath); err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat fence %s: %v", fencePath, err)
+	}
+	return true, nil
+}
+
+// recentLinks calls fn with the blobs linked in a repository within the
+// grace window, or all of them if an upload to the repository is in
+// progress: the manifest the client pushes next may reference layers it
+// already has in the repository.
+func (o *onlineGC) recentLinks(ctx context.Context, repoName string, fn func(dgst digest.Digest, reason string)) error {
+	uploading, err := o.uploading(ctx, repoName)
+	if err != nil {
+		return err
+	}
+	layersPath, err := pathFor(layersPathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+	err = o.driver.Walk(ctx, layersPath, func(fi driver.FileInfo) error {
+		if fi.IsDir() || path.Base(fi.Path()) != "link" {
+			return nil
+		}
+		if !uploading && !fi.ModTime().After(o.cutoff) {
+			return nil
+		}
+		dgst, err := digestFromPath(path.Dir(fi.Path()))
+		if err != nil {
+			return nil
+		}
+		if uploading {
+			fn(dgst, fmt.Sprintf("linked in %s, which has uploads in progress", repoName))
+		} else {
+			fn(dgst, fmt.Sprintf("linked in %s at %s within the grace period", repoName, fi.ModTime().UTC().Format(time.RFC3339)))
+		}
+		return nil
+	})
+	if errors.Is(err, driver.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// uploading reports whether a repository has uploads started within the
+// grace window.
+func (o *onlineGC) uploading(ctx context.Context, repoName string) (bool, error) {
+	rootPath, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return false, err
+	}
+	ids, err := o.driver.List(ctx, path.Join(rootPath, repoName, "_uploads"))
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, id := range ids {
+		startedAtPath, err := pathFor(uploadStartedAtPathSpec{name: repoName, id: path.Base(id)})
+		if err != nil {
+			return false, err
+		}
+		content, err := o.driver.GetContent(ctx, startedAtPath)
+		if err != nil {
+			if errors.Is(err, driver.ErrNotFound) {
+				continue
+			}
+			return false, err
+		}
+		startedAt, err := time.Parse(time.RFC3339, string(content))
+		if err != nil {
+			continue
+		}
+		// The start time is recorded to the second.
+		if !startedAt.Before(o.cutoff.Truncate(time.Second)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// keepBlob returns the reason to keep a blob written within the grace
+// window or fenced by the registry, if any.
+func (o *onlineGC) keepBlob(ctx context.Context, dgst digest.Digest) (string, error) {
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return "", err
+	}
+	fi, err := o.driver.Stat(ctx, dataPath)
+	if err != nil {
+		if !errors.Is(err, driver.ErrNotFound) {
+			return "", fmt.Errorf("failed to stat blob %s: %v", dataPath, err)
+		}
+	} else if fi.ModTime().After(o.cutoff) {
+		return fmt.Sprintf("written at %s within the grace period", fi.ModTime().UTC().Format(time.RFC3339)), nil
+	}
+	fenced, err := o.fenced(ctx, dgst)
+	if err != nil || !fenced {
+		return "", err
+	}
+	return "linked during the collection", nil
+}
+
+// manifestReferences returns the digests referenced by a manifest.
+func manifestReferences(manifest distribution.Manifest) []digest.Digest {
+	descriptors := manifest.References()
+	dgsts := make([]digest.Digest, 0, len(descriptors))
+	for _, descriptor := range descriptors {
+		dgsts = append(dgsts, descriptor.Digest)
+	}
+	return dgsts
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// collectReferrerLinks deletes the referrer links of the repositories
+// listed by enumerate whose referrer or subject manifest no longer exists in
+// the repository, leaving manifests and blobs alone. It implements
+// GCOpts.ReferrersOnly.
+func collectReferrerLinks(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, enumerate func(context.Context, func(string) error) error, events gcEmitter, opts GCOpts) (GCReport, error) {
+	report := GCReport{DryRun: opts.DryRun}
+	now := time.Now()
+	// Referrer links are written before the referrer is linked, so online
+	// collections keep the recent ones of pushes in progress.
+	var cutoff time.Time
+	if opts.Online {
+		grace := opts.GracePeriod
+		if grace <= 0 {
+			grace = DefaultGCGracePeriod
+		}
+		cutoff = now.Add(-grace)
+	}
+	var journal *gcJournal
+	if opts.Journal && !opts.DryRun {
+		journal = newGCJournal(storageDriver, now)
+	}
+	vacuum := NewVacuum(ctx, storageDriver)
+	vacuum.events = events
+	throttle := newDeleteThrottle(ctx, opts.DeleteRate)
+	defer throttle.stop()
+	// referrersTags lists the subjects whose referrers tags may list the
+	// referrers of the deleted links.
+	referrersTags := make(map[string]map[digest.Digest]struct{})
+
+	err := enumerate(ctx, func(repoName string) error {
+		if !repositorySelected(repoName, opts.IncludeRepositories, opts.ExcludeRepositories) {
+			return nil
+		}
+		events.emit(GCEvent{Kind: GCEventRepository, Repository: repoName}, "%s", repoName)
+		report.RepositoriesScanned++
+
+		// exists caches whether the manifests of the repository exist.
+		exists := make(map[digest.Digest]bool)
+		manifestExists := func(dgst digest.Digest) (bool, error) {
+			if ok, cached := exists[dgst]; cached {
+				return ok, nil
+			}
+			_, err := revisionLinkTime(ctx, storageDriver, repoName, dgst)
+			if err != nil && !errors.Is(err, driver.ErrNotFound) {
+				return false, err
+			}
+			exists[dgst] = err == nil
+			return err == nil, nil
+		}
+		var dangling []referrerLink
+		// A referrer linked in both layouts, by an interrupted migration,
+		// is unlinked once.
+		unlinked := make(map[[2]digest.Digest]struct{})
+		err := walkReferrerLinks(ctx, storageDriver, repoName, func(linkPath string, subject, referrer digest.Digest) error {
+			state := ""
+			for _, manifest := range []struct {
+				what   string
+				digest digest.Digest
+			}{{"referrer", referrer}, {"subject", subject}} {
+				// Manifests are stored under their canonical digest, so
+				// a subject of another algorithm, such as sha512, may
+				// be in the repository without a revision of its digest.
+				if manifest.digest.Algorithm() != digest.Canonical {
+					continue
+				}
+				ok, err := manifestExists(manifest.digest)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					state = fmt.Sprintf("%s %s no longer exists", manifest.what, manifest.digest)
+					break
+				}
+			}
+			if state == "" {
+				return nil
+			}
+			if !cutoff.IsZero() {
+				fi, err := storageDriver.Stat(ctx, linkPath)
+				if err != nil {
+					if errors.Is(err, driver.ErrNotFound) {
+						return nil
+					}
+					return err
+				}
+				if fi.ModTime().After(cutoff) {
+					events.emit(GCEvent{Kind: GCEventMark, Repository: repoName, Digest: referrer, Path: linkPath}, "%s: keeping referrer link %s written during the grace period", repoName, linkPath)
+					return nil
+				}
+			}
+			if _, ok := unlinked[[2]digest.Digest{subject, referrer}]; !ok {
+				unlinked[[2]digest.Digest{subject, referrer}] = struct{}{}
+				dangling = append(dangling, referrerLink{path: linkPath, subject: subject, referrer: referrer})
+			}
+			events.emit(GCEvent{Kind: GCEventDanglingReferrer, Repository: repoName, Digest: referrer, Path: linkPath}, "dangling referrer link: %s, %s", linkPath, state)
+			if opts.DryRun {
+				report.DanglingReferrerLinks = append(report.DanglingReferrerLinks, linkPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to check referrer links of %s: %w", repoName, err)
+		}
+
+		if journal != nil && len(dangling) > 0 {
+			var entries []GCJournalEntry
+			for _, link := range dangling {
+				entries = append(entries, referrerLinkEntry(repoName, link))
+			}
+			if err := journal.record(ctx, entries...); err != nil {
+				return err
+			}
+		}
+		for _, link := range dangling {
+			report.LinksDeleted++
+			if opts.DryRun {
+				continue
+			}
+			if err := throttle.wait(); err != nil {
+				return err
+			}
+			if err := vacuum.RemoveReferrerLink(repoName, link.subject, link.referrer); err != nil {
+				return fmt.Errorf("failed to delete referrer link of %s: %v", link.referrer, err)
+			}
+			if referrersTags[repoName] == nil {
+				referrersTags[repoName] = make(map[digest.Digest]struct{})
+			}
+			referrersTags[repoName][link.subject] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return GCReport{}, fmt.Errorf("failed to collect referrer links: %w", err)
+	}
+	if err := refreshReferrersTags(ctx, registry, referrersTags); err != nil {
+		return GCReport{}, fmt.Errorf("failed to update referrers tags: %v", err)
+	}
+
+	deleted := "deleted"
+	if opts.DryRun {
+		deleted = "would be deleted"
+	}
+	events.emit(GCEvent{Kind: GCEventSummary}, "%d dangling referrer links %s", report.LinksDeleted, deleted)
+	if journal != nil && journal.written() {
+		report.Journal = journal.journal.ID
+		events.emit(GCEvent{Kind: GCEventJournal}, "deletions journaled as %s", report.Journal)
+	}
+
+	return report, nil
+}
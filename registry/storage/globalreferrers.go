@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// EnableGlobalReferrersIndex is a functional option for NewRegistry. It
+// records, for each subject, the referrers pushed to any repository, so that
+// GlobalReferrers lists them without walking every repository. Referrers
+// pushed before the index was enabled are not listed.
+func EnableGlobalReferrersIndex(registry *registry) error {
+	registry.globalReferrersIndex = true
+	return nil
+}
+
+// CheckGlobalReferrersIndex returns an error if the global referrers index
+// of namespace cannot be listed, such as when the credentials of the storage
+// driver are not granted its path. It returns nil if namespace does not
+// maintain the index.
+func CheckGlobalReferrersIndex(ctx context.Context, namespace distribution.Namespace) error {
+	reg, isRegistry := namespace.(*registry)
+	if !isRegistry || !reg.globalReferrersIndex {
+		return nil
+	}
+	subjectsPath, err := pathFor(globalReferrersSubjectsPathSpec{})
+	if err != nil {
+		return err
+	}
+	if _, err := reg.driver.List(ctx, subjectsPath); err != nil && !errors.Is(err, driver.ErrNotFound) {
+		return fmt.Errorf("failed to list the global referrers index: %w", err)
+	}
+	return nil
+}
+
+// GlobalReferrer is a referrer of a subject in one of the repositories of
+// the registry.
+type GlobalReferrer struct {
+	Repository string
+	Descriptor v1.Descriptor
+}
+
+// GlobalReferrers returns the referrers of subject in every repository, as
+// recorded in the global referrers index, sorted by repository then digest.
+// Entries of referrers which no longer exist are removed along the way. ok
+// is false if namespace does not maintain the index.
+func GlobalReferrers(ctx context.Context, namespace distribution.Namespace, subject digest.Digest) (referrers []GlobalReferrer, ok bool, err error) {
+	reg, isRegistry := namespace.(*registry)
+	if !isRegistry || !reg.globalReferrersIndex {
+		return nil, false, nil
+	}
+	referrersPath, err := pathFor(globalReferrersPathSpec{subject: subject})
+	if err != nil {
+		return nil, false, err
+	}
+	var stale []GlobalReferrer
+	err = reg.driver.Walk(ctx, referrersPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		name, revisionPath, found := strings.Cut(strings.TrimPrefix(fileInfo.Path(), referrersPath+"/"), "/_manifests/")
+		if !found {
+			return nil
+		}
+		algorithm, hex := path.Split(revisionPath)
+		revision := digest.NewDigestFromHex(strings.TrimSuffix(algorithm, "/"), hex)
+		if revision.Validate() != nil {
+			return nil
+		}
+
+		// The referrer may have been deleted by a garbage collection or
+		// along with its repository, which do not update the index.
+		if _, err := revisionLinkTime(ctx, reg.driver, name, revision); err != nil {
+			if errors.Is(err, driver.ErrNotFound) {
+				stale = append(stale, GlobalReferrer{Repository: name, Descriptor: v1.Descriptor{Digest: revision}})
+				return nil
+			}
+			return err
+		}
+		content, err := reg.driver.GetContent(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+		var desc v1.Descriptor
+		if err := json.Unmarshal(content, &desc); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error reading global referrers index entry %s: %v", fileInfo.Path(), err)
+			return nil
+		}
+		referrers = append(referrers, GlobalReferrer{Repository: name, Descriptor: desc})
+		return nil
+	})
+	if err != nil && !errors.Is(err, driver.ErrNotFound) {
+		return nil, false, err
+	}
+	for _, referrer := range stale {
+		if err := removeGlobalReferrer(ctx, reg.driver, referrer.Repository, subject, referrer.Descriptor.Digest); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error removing stale global referrers index entry: %v", err)
+		}
+	}
+	sort.Slice(referrers, func(i, j int) bool {
+		if referrers[i].Repository != referrers[j].Repository {
+			return referrers[i].Repository < referrers[j].Repository
+		}
+		return referrers[i].Descriptor.Digest < referrers[j].Descriptor.Digest
+	})
+	return referrers, true, nil
+}
+
+// indexGlobalReferrer records a referrer pushed to this repository in the
+// global referrers index, if the registry maintains it.
+func (repo *repository) indexGlobalReferrer(ctx context.Context, subject, dgst digest.Digest, man distribution.Manifest) error {
+	if !repo.globalReferrersIndex {
+		return nil
+	}
+	referrer, ok := referrerDescriptor(dgst, man)
+	if !ok {
+		return nil
+	}
+	referrerPath, err := pathFor(globalReferrerPathSpec{subject: subject, name: repo.name.Name(), revision: dgst})
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(referrer)
+	if err != nil {
+		return err
+	}
+	if err := repo.driver.PutContent(ctx, referrerPath, content); err != nil {
+		return fmt.Errorf("failed to record referrer %s of %s in the global referrers index: %v", dgst, subject, err)
+	}
+	return nil
+}
+
+// unindexGlobalReferrer removes a referrer deleted from this repository from
+// the global referrers index. Entries are removed even if the registry no
+// longer maintains the index, so that they do not go stale.
+func (repo *repository) unindexGlobalReferrer(ctx context.Context, subject, dgst digest.Digest) error {
+	return removeGlobalReferrer(ctx, repo.driver, repo.name.Name(), subject, dgst)
+}
+
+func removeGlobalReferrer(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject, dgst digest.Digest) error {
+	referrerPath, err := pathFor(globalReferrerPathSpec{subject: subject, name: repoName, revision: dgst})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.Delete(ctx, referrerPath); err != nil && !errors.Is(err, driver.ErrNotFound) {
+		return fmt.Errorf("failed to remove referrer %s of %s from the global referrers index: %v", dgst, subject, err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// Kinds of nodes and edges of a dependency graph.
+const (
+	// GraphNodeManifest is a manifest stored in the repository.
+	GraphNodeManifest = "manifest"
+	// GraphNodeBlob is a blob referenced by a manifest.
+	GraphNodeBlob = "blob"
+
+	// GraphEdgeReference points from a manifest to a manifest or blob it
+	// references.
+	GraphEdgeReference = "reference"
+	// GraphEdgeSubject points from a referrer to its subject.
+	GraphEdgeSubject = "subject"
+)
+
+// GraphNode is a manifest or blob of a dependency graph.
+type GraphNode struct {
+	Kind      string        `json:"kind"`
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType,omitempty"`
+	Size      int64         `json:"size"`
+	Tags      []string      `json:"tags,omitempty"`
+}
+
+// GraphEdge is a dependency between two nodes of a dependency graph.
+type GraphEdge struct {
+	Kind string        `json:"kind"`
+	From digest.Digest `json:"from"`
+	To   digest.Digest `json:"to"`
+}
+
+// Graph is the dependency graph of manifests, blobs and referrers of a
+// repository.
+type Graph struct {
+	Repository string      `json:"repository"`
+	Nodes      []GraphNode `json:"nodes"`
+	Edges      []GraphEdge `json:"edges"`
+}
+
+// DependencyGraph builds the dependency graph of the given manifests of a
+// repository, following references to manifests and blobs and the referrers
+// of each manifest. Without roots, the graph covers all manifests of the
+// repository.
+func DependencyGraph(ctx context.Context, repository distribution.Repository, roots ...digest.Digest) (*Graph, error) {
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct manifest service: %v", err)
+	}
+
+	if len(roots) == 0 {
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return nil, fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+		err := manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			roots = append(roots, dgst)
+			return nil
+		})
+		if err != nil {
+			if !errors.Is(err, driver.ErrNotFound) {
+				return nil, fmt.Errorf("failed to enumerate manifests: %v", err)
+			}
+		}
+	}
+
+	tags, err := tagsByDigest(ctx, repository.Tags(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	referrersLister, _ := repository.(distribution.ReferrersLister)
+	manifestMediaTypes := make(map[string]struct{})
+	for _, mediaType := range distribution.ManifestMediaTypes() {
+		manifestMediaTypes[mediaType] = struct{}{}
+	}
+
+	graph := &Graph{Repository: repository.Named().Name()}
+	nodes := make(map[digest.Digest]*GraphNode)
+	queue := append([]digest.Digest(nil), roots...)
+	for len(queue) > 0 {
+		dgst := queue[0]
+		queue = queue[1:]
+		if _, ok := nodes[dgst]; ok {
+			continue
+		}
+
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve manifest %s: %v", dgst, err)
+		}
+		mediaType, payload, err := manifest.Payload()
+		if err != nil {
+			return nil, err
+		}
+		nodes[dgst] = &GraphNode{
+			Kind:      GraphNodeManifest,
+			Digest:    dgst,
+			MediaType: mediaType,
+			Size:      int64(len(payload)),
+			Tags:      tags[dgst],
+		}
+
+		for _, desc := range manifest.References() {
+			graph.Edges = append(graph.Edges, GraphEdge{Kind: GraphEdgeReference, From: dgst, To: desc.Digest})
+			if _, ok := manifestMediaTypes[desc.MediaType]; ok {
+				queue = append(queue, desc.Digest)
+				continue
+			}
+			if _, ok := nodes[desc.Digest]; !ok {
+				nodes[desc.Digest] = &GraphNode{
+					Kind:      GraphNodeBlob,
+					Digest:    desc.Digest,
+					MediaType: desc.MediaType,
+					Size:      desc.Size,
+				}
+			}
+		}
+
+		if referrersLister == nil {
+			continue
+		}
+		referrers, err := referrersLister.Referrers(ctx, dgst)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list referrers of %s: %v", dgst, err)
+		}
+		for _, referrer := range referrers {
+			graph.Edges = append(graph.Edges, GraphEdge{Kind: GraphEdgeSubject, From: referrer.Digest, To: dgst})
+			queue = append(queue, referrer.Digest)
+		}
+	}
+
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, *node)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].Digest < graph.Nodes[j].Digest
+	})
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Kind < b.Kind
+	})
+	return graph, nil
+}
+
+// tagsByDigest maps the manifests of a repository to the tags pointing at
+// them.
+func tagsByDigest(ctx context.Context, tagService distribution.TagService) (map[digest.Digest][]string, error) {
+	allTags, err := tagService.All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve tags: %v", err)
+	}
+
+	tags := make(map[digest.Digest][]string)
+	for _, tag := range allTags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve tag %s: %v", tag, err)
+		}
+		tags[desc.Digest] = append(tags[desc.Digest], tag)
+	}
+	return tags, nil
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Manifests are
+// drawn as boxes labelled with their tags, and subject edges are dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "digraph %q {\n", g.Repository); err != nil {
+		return err
+	}
+	for _, node := range g.Nodes {
+		label := node.Digest.Encoded()
+		if len(label) > 12 {
+			label = label[:12]
+		}
+		label = node.MediaType + "\n" + label
+		for _, tag := range node.Tags {
+			label += "\n" + tag
+		}
+		shape := "ellipse"
+		if node.Kind == GraphNodeManifest {
+			shape = "box"
+		}
+		if _, err := fmt.Fprintf(w, "  %q [shape=%s, label=%q];\n", node.Digest, shape, label); err != nil {
+			return err
+		}
+	}
+	for _, edge := range g.Edges {
+		style := "solid"
+		if edge.Kind == GraphEdgeSubject {
+			style = "dashed"
+		}
+		if _, err := fmt.Fprintf(w, "  %q -> %q [style=%s];\n", edge.From, edge.To, style); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
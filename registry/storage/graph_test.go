@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "graph")
+
+	image := uploadRandomOCIImage(t, repo, nil)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    image.manifestDigest,
+	}, nil)
+	builder.(*ocischema.Builder).SetArtifactType("application/vnd.example.sbom")
+	referrer, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("failed to build referrer: %v", err)
+	}
+	referrerDigest, err := makeManifestService(t, repo).Put(ctx, referrer)
+	if err != nil {
+		t.Fatalf("failed to put referrer: %v", err)
+	}
+
+	// The whole repository, and the graph starting from the image, are the
+	// same.
+	for _, roots := range [][]digest.Digest{nil, {image.manifestDigest}} {
+		graph, err := DependencyGraph(ctx, repo, roots...)
+		if err != nil {
+			t.Fatalf("failed to build graph: %v", err)
+		}
+
+		// The image, its config and two layers, and the referrer and its
+		// empty config.
+		if len(graph.Nodes) != 6 {
+			t.Fatalf("expected 6 nodes, got %v", graph.Nodes)
+		}
+		for _, node := range graph.Nodes {
+			switch node.Digest {
+			case image.manifestDigest:
+				if node.Kind != GraphNodeManifest || len(node.Tags) != 1 || node.Tags[0] != "latest" {
+					t.Errorf("unexpected image node: %v", node)
+				}
+			case referrerDigest:
+				if node.Kind != GraphNodeManifest {
+					t.Errorf("unexpected referrer node: %v", node)
+				}
+			default:
+				if node.Kind != GraphNodeBlob {
+					t.Errorf("unexpected node: %v", node)
+				}
+			}
+		}
+
+		var references, subjects int
+		for _, edge := range graph.Edges {
+			switch edge.Kind {
+			case GraphEdgeReference:
+				references++
+			case GraphEdgeSubject:
+				subjects++
+				if edge.From != referrerDigest || edge.To != image.manifestDigest {
+					t.Errorf("unexpected subject edge: %v", edge)
+				}
+			}
+		}
+		if references != 4 || subjects != 1 {
+			t.Errorf("expected 4 reference and 1 subject edges, got %v", graph.Edges)
+		}
+	}
+
+	graph, err := DependencyGraph(ctx, repo, image.manifestDigest)
+	if err != nil {
+		t.Fatalf("failed to build graph: %v", err)
+	}
+	var dot bytes.Buffer
+	if err := graph.WriteDOT(&dot); err != nil {
+		t.Fatalf("failed to write graph: %v", err)
+	}
+	if !strings.HasPrefix(dot.String(), `digraph "graph" {`) ||
+		!strings.Contains(dot.String(), `"`+referrerDigest.String()+`" -> "`+image.manifestDigest.String()+`" [style=dashed];`) {
+		t.Errorf("unexpected DOT output:\n%s", dot.String())
+	}
+}
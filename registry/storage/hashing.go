@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"encoding"
+	"fmt"
+	"hash"
+	"sort"
+	"sync"
+	"time"
+
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultHashImplementation is the name of the implementation of the
+// canonical digest algorithm of the standard library, which uses the SHA
+// extensions of the CPU when it has them.
+const defaultHashImplementation = "go"
+
+var (
+	hashedBytes = prometheus.StorageNamespace.NewLabeledCounter("hashed_bytes", "The number of bytes of uploaded blobs digested, by hash implementation", "implementation")
+	hashSeconds = prometheus.StorageNamespace.NewLabeledCounter("hash_seconds", "The number of seconds spent digesting uploaded blobs, by hash implementation", "implementation")
+)
+
+var (
+	hashImplementationsMu sync.Mutex
+	hashImplementations   = map[string]func() hash.Hash{
+		defaultHashImplementation: digest.Canonical.Hash,
+	}
+)
+
+// RegisterHashImplementation makes an implementation of the canonical
+// digest algorithm, sha256, available under name to the HashImplementation
+// option, such as a vectorized implementation hashing faster on some CPUs.
+// Implementations are registered from the init function of their package,
+// like storage drivers. It panics if name is already registered.
+func RegisterHashImplementation(name string, newHash func() hash.Hash) {
+	if newHash == nil {
+		panic("hash implementation " + name + " is nil")
+	}
+	hashImplementationsMu.Lock()
+	defer hashImplementationsMu.Unlock()
+	if _, ok := hashImplementations[name]; ok {
+		panic("hash implementation " + name + " registered twice")
+	}
+	hashImplementations[name] = newHash
+}
+
+// HashImplementation is a functional option for NewRegistry. Uploaded blobs
+// are digested, and their digest verified, with the implementation
+// registered as name rather than with crypto/sha256. Implementations which
+// cannot marshal their state disable the resumption of digests across
+// requests.
+func HashImplementation(name string) RegistryOption {
+	return func(registry *registry) error {
+		hashImplementationsMu.Lock()
+		newHash, ok := hashImplementations[name]
+		var names []string
+		for name := range hashImplementations {
+			names = append(names, name)
+		}
+		hashImplementationsMu.Unlock()
+		if !ok {
+			sort.Strings(names)
+			return fmt.Errorf("unknown hash implementation %q, registered implementations are %v", name, names)
+		}
+		registry.hasher = hasher{implementation: name, newHash: newHash}
+		return nil
+	}
+}
+
+// hasher creates the digesters of uploaded blobs, which record their
+// throughput in the metrics. The zero hasher uses the standard library.
+type hasher struct {
+	implementation string
+	newHash        func() hash.Hash
+}
+
+// digester returns a digester of the canonical algorithm.
+func (h hasher) digester() digest.Digester {
+	implementation, newHash := h.implementation, h.newHash
+	if newHash == nil {
+		implementation, newHash = defaultHashImplementation, digest.Canonical.Hash
+	}
+	metered := meteredHash{Hash: newHash(), implementation: implementation}
+	if _, ok := metered.Hash.(resumableHash); ok {
+		return &hashDigester{hash: &meteredResumableHash{metered}}
+	}
+	return &hashDigester{hash: &metered}
+}
+
+// hashDigester is a digester of the canonical algorithm using any
+// implementation of it.
+type hashDigester struct {
+	hash hash.Hash
+}
+
+func (d *hashDigester) Hash() hash.Hash {
+	return d.hash
+}
+
+func (d *hashDigester) Digest() digest.Digest {
+	return digest.NewDigest(digest.Canonical, d.hash)
+}
+
+// meteredHash counts the bytes it digests and the time it takes.
+type meteredHash struct {
+	hash.Hash
+	implementation string
+}
+
+func (h *meteredHash) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := h.Hash.Write(p)
+	hashSeconds.WithValues(h.implementation).Inc(time.Since(start).Seconds())
+	hashedBytes.WithValues(h.implementation).Inc(float64(n))
+	return n, err
+}
+
+// resumableHash is a hash whose state can be stored, to resume digesting
+// an upload in another request.
+type resumableHash interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// meteredResumableHash is a metered hash whose state can be stored.
+type meteredResumableHash struct {
+	meteredHash
+}
+
+func (h *meteredResumableHash) MarshalBinary() ([]byte, error) {
+	return h.Hash.(resumableHash).MarshalBinary()
+}
+
+func (h *meteredResumableHash) UnmarshalBinary(data []byte) error {
+	return h.Hash.(resumableHash).UnmarshalBinary(data)
+}
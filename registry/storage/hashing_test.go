@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+// countingHash counts the bytes written to sha256.
+type countingHash struct {
+	hash.Hash
+	written *int
+}
+
+func (h countingHash) Write(p []byte) (int, error) {
+	*h.written += len(p)
+	return h.Hash.Write(p)
+}
+
+func TestHashImplementation(t *testing.T) {
+	ctx := context.Background()
+
+	var written int
+	RegisterHashImplementation("counting", func() hash.Hash {
+		return countingHash{Hash: sha256.New(), written: &written}
+	})
+
+	if _, err := NewRegistry(ctx, inmemory.New(), HashImplementation("unknown")); err == nil {
+		t.Fatalf("expected an error creating a registry with an unknown hash implementation")
+	}
+
+	registry := createRegistry(t, inmemory.New(), HashImplementation("counting"))
+	repo := makeRepository(t, registry, "hashing")
+	blobs := repo.Blobs(ctx)
+
+	before := metricValues(t, "registry_storage_hashed_bytes_total")
+	content := []byte("hashed with another implementation")
+	writer, err := blobs.Create(ctx)
+	if err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatalf("failed to write blob: %v", err)
+	}
+	desc, err := writer.Commit(ctx, distribution.Descriptor{Digest: digest.FromBytes(content)})
+	if err != nil {
+		t.Fatalf("failed to commit blob: %v", err)
+	}
+	if desc.Digest != digest.FromBytes(content) {
+		t.Fatalf("unexpected digest %s", desc.Digest)
+	}
+	if written != len(content) {
+		t.Fatalf("the implementation digested %d bytes, expected %d", written, len(content))
+	}
+
+	after := metricValues(t, "registry_storage_hashed_bytes_total")
+	name := `registry_storage_hashed_bytes_total{implementation="counting"}`
+	if delta := after[name] - before[name]; delta != float64(len(content)) {
+		t.Fatalf("unexpected increase of %s: %v", name, delta)
+	}
+}
+
+func TestHasherResumable(t *testing.T) {
+	// The standard implementation can store its state, so that uploads
+	// resume their digest across requests.
+	if _, ok := (hasher{}).digester().Hash().(resumableHash); !ok {
+		t.Errorf("the digester of the standard implementation is not resumable")
+	}
+	digester := hasher{implementation: "counting", newHash: func() hash.Hash {
+		return countingHash{Hash: sha256.New(), written: new(int)}
+	}}.digester()
+	if _, ok := digester.Hash().(resumableHash); ok {
+		t.Errorf("the digester of an implementation without state is resumable")
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+)
+
+// DeleteImpact is what deleting a manifest, or a tag, would affect.
+type DeleteImpact struct {
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+
+	// Tag is set if the impact is that of deleting the tag rather than the
+	// manifest it points at.
+	Tag string `json:"tag,omitempty"`
+
+	// Tags lists the tags which would be deleted: the tag itself, or every
+	// tag pointing at the manifest.
+	Tags []string `json:"tags"`
+
+	// Untagged is true if deleting the tag would leave the manifest without
+	// tags, so that garbage collection of untagged manifests would delete
+	// it.
+	Untagged bool `json:"untagged,omitempty"`
+
+	// Indexes lists the manifests of the repository which reference the
+	// manifest, and would be left with a dangling reference.
+	Indexes []digest.Digest `json:"indexes"`
+
+	// Referrers lists the referrers of the manifest, whose subject would
+	// dangle.
+	Referrers []digest.Digest `json:"referrers"`
+}
+
+// ManifestDeleteImpact walks the dependency graph of a repository to find
+// the tags, indexes and referrers affected by deleting a manifest. The
+// repository must list referrers for them to be found.
+func ManifestDeleteImpact(ctx context.Context, repository distribution.Repository, dgst digest.Digest) (*DeleteImpact, error) {
+	graph, err := DependencyGraph(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	impact := &DeleteImpact{
+		Repository: repository.Named().Name(),
+		Digest:     dgst,
+		Tags:       []string{},
+		Indexes:    []digest.Digest{},
+		Referrers:  []digest.Digest{},
+	}
+	found := false
+	for _, node := range graph.Nodes {
+		if node.Digest == dgst && node.Kind == GraphNodeManifest {
+			found = true
+			impact.Tags = append(impact.Tags, node.Tags...)
+		}
+	}
+	if !found {
+		return nil, distribution.ErrManifestUnknownRevision{Name: impact.Repository, Revision: dgst}
+	}
+
+	// Edges are sorted, so that the lists are too, and may repeat when a
+	// manifest references another twice.
+	seen := make(map[GraphEdge]struct{})
+	for _, edge := range graph.Edges {
+		if edge.To != dgst {
+			continue
+		}
+		if _, ok := seen[edge]; ok {
+			continue
+		}
+		seen[edge] = struct{}{}
+		switch edge.Kind {
+		case GraphEdgeReference:
+			impact.Indexes = append(impact.Indexes, edge.From)
+		case GraphEdgeSubject:
+			impact.Referrers = append(impact.Referrers, edge.From)
+		}
+	}
+	return impact, nil
+}
+
+// TagDeleteImpact returns what deleting a tag of a repository would affect:
+// only the tag is deleted, but the manifest it points at may be left
+// untagged.
+func TagDeleteImpact(ctx context.Context, repository distribution.Repository, tag string) (*DeleteImpact, error) {
+	tagService := repository.Tags(ctx)
+	desc, err := tagService.Get(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := tagService.Lookup(ctx, desc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the tags of %s: %v", desc.Digest, err)
+	}
+
+	return &DeleteImpact{
+		Repository: repository.Named().Name(),
+		Digest:     desc.Digest,
+		Tag:        tag,
+		Tags:       []string{tag},
+		Untagged:   len(tags) <= 1,
+		Indexes:    []digest.Digest{},
+		Referrers:  []digest.Digest{},
+	}, nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDeleteImpact(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "impact")
+	manifests := makeManifestService(t, repo)
+
+	image := uploadRandomOCIImage(t, repo, nil)
+	for _, tag := range []string{"latest", "v1"} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+	}
+
+	descriptor, err := registry.BlobStatter().Stat(ctx, image.manifestDigest)
+	if err != nil {
+		t.Fatalf("failed to stat manifest: %v", err)
+	}
+	descriptor.MediaType = v1.MediaTypeImageManifest
+	index, err := manifestlist.FromDescriptorsWithMediaType([]manifestlist.ManifestDescriptor{{Descriptor: descriptor}}, v1.MediaTypeImageIndex)
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	indexDigest, err := manifests.Put(ctx, index)
+	if err != nil {
+		t.Fatalf("failed to put index: %v", err)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "multi", distribution.Descriptor{Digest: indexDigest}); err != nil {
+		t.Fatalf("failed to tag index: %v", err)
+	}
+
+	builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    image.manifestDigest,
+	}, nil)
+	builder.(*ocischema.Builder).SetArtifactType("application/vnd.example.sbom")
+	referrer, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("failed to build referrer: %v", err)
+	}
+	referrerDigest, err := manifests.Put(ctx, referrer)
+	if err != nil {
+		t.Fatalf("failed to put referrer: %v", err)
+	}
+
+	impact, err := ManifestDeleteImpact(ctx, repo, image.manifestDigest)
+	if err != nil {
+		t.Fatalf("failed to analyze the deletion of the image: %v", err)
+	}
+	expected := &DeleteImpact{
+		Repository: "impact",
+		Digest:     image.manifestDigest,
+		Tags:       []string{"latest", "v1"},
+		Indexes:    []digest.Digest{indexDigest},
+		Referrers:  []digest.Digest{referrerDigest},
+	}
+	if !reflect.DeepEqual(impact, expected) {
+		t.Errorf("unexpected impact of deleting the image: %+v, expected %+v", impact, expected)
+	}
+
+	impact, err = ManifestDeleteImpact(ctx, repo, indexDigest)
+	if err != nil {
+		t.Fatalf("failed to analyze the deletion of the index: %v", err)
+	}
+	expected = &DeleteImpact{
+		Repository: "impact",
+		Digest:     indexDigest,
+		Tags:       []string{"multi"},
+		Indexes:    []digest.Digest{},
+		Referrers:  []digest.Digest{},
+	}
+	if !reflect.DeepEqual(impact, expected) {
+		t.Errorf("unexpected impact of deleting the index: %+v, expected %+v", impact, expected)
+	}
+
+	if _, err := ManifestDeleteImpact(ctx, repo, digest.FromString("unknown")); err == nil {
+		t.Errorf("expected an error analyzing the deletion of an unknown manifest")
+	}
+
+	impact, err = TagDeleteImpact(ctx, repo, "latest")
+	if err != nil {
+		t.Fatalf("failed to analyze the deletion of a tag: %v", err)
+	}
+	if impact.Untagged || impact.Digest != image.manifestDigest || !reflect.DeepEqual(impact.Tags, []string{"latest"}) {
+		t.Errorf("unexpected impact of deleting a tag of a manifest with two tags: %+v", impact)
+	}
+	impact, err = TagDeleteImpact(ctx, repo, "multi")
+	if err != nil {
+		t.Fatalf("failed to analyze the deletion of a tag: %v", err)
+	}
+	if !impact.Untagged {
+		t.Errorf("deleting the only tag of a manifest does not leave it untagged: %+v", impact)
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"path"
@@ -31,6 +32,7 @@ type linkedBlobStore struct {
 	ctx                    context.Context // only to be used where context can't come through method args
 	deleteEnabled          bool
 	resumableDigestEnabled bool
+	hasher                 hasher
 
 	// linkPathFns specifies one or more path functions allowing one to
 	// control the repository blob link set to which the blob store
@@ -84,6 +86,10 @@ func (lbs *linkedBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter
 
 func (lbs *linkedBlobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
 	dgst := digest.FromBytes(p)
+	if err := fenceDigests(ctx, lbs.driver, dgst); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	// Place the data in the blob store first.
 	desc, err := lbs.blobStore.Put(ctx, mediaType, p)
 	if err != nil {
@@ -188,8 +194,8 @@ func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution
 
 	startedAtBytes, err := lbs.blobStore.driver.GetContent(ctx, startedAtPath)
 	if err != nil {
-		switch err := err.(type) {
-		case driver.PathNotFoundError:
+		switch {
+		case errors.Is(err, driver.ErrNotFound):
 			return nil, distribution.ErrBlobUploadUnknown
 		default:
 			return nil, err
@@ -233,11 +239,30 @@ func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) erro
 }
 
 func (lbs *linkedBlobStore) Enumerate(ctx context.Context, ingestor func(digest.Digest) error) error {
+	_, err := lbs.EnumerateFrom(ctx, "", ingestor)
+	return err
+}
+
+// EnumerateFrom calls ingestor for each linked blob after marker, the digest
+// of the last blob ingested, in the order of their links.
+func (lbs *linkedBlobStore) EnumerateFrom(ctx context.Context, marker string, ingestor func(digest.Digest) error) (string, error) {
 	rootPath, err := pathFor(lbs.linkDirectoryPathSpec)
 	if err != nil {
-		return err
+		return marker, err
+	}
+	var from string
+	if marker != "" {
+		dgst, err := digest.Parse(marker)
+		if err != nil {
+			return marker, fmt.Errorf("invalid enumeration marker %q: %v", marker, err)
+		}
+		components, err := digestPathComponents(dgst, false)
+		if err != nil {
+			return marker, err
+		}
+		from = path.Join(append(append([]string{rootPath}, components...), "link")...)
 	}
-	return lbs.driver.Walk(ctx, rootPath, func(fileInfo driver.FileInfo) error {
+	err = walkFrom(ctx, lbs.driver, rootPath, from, func(fileInfo driver.FileInfo) error {
 		// exit early if directory...
 		if fileInfo.IsDir() {
 			return nil
@@ -271,11 +296,17 @@ func (lbs *linkedBlobStore) Enumerate(ctx context.Context, ingestor func(digest.
 			return err
 		}
 
+		marker = digest.String()
 		return nil
 	})
+	return marker, err
 }
 
 func (lbs *linkedBlobStore) mount(ctx context.Context, sourceRepo reference.Named, dgst digest.Digest, sourceStat *distribution.Descriptor) (distribution.Descriptor, error) {
+	if err := fenceDigests(ctx, lbs.driver, dgst); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
 	var stat distribution.Descriptor
 	if sourceStat == nil {
 		// look up the blob info from the sourceRepo if not already provided
@@ -316,7 +347,7 @@ func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string
 		blobStore:              lbs,
 		id:                     uuid,
 		startedAt:              startedAt,
-		digester:               digest.Canonical.Digester(),
+		digester:               lbs.hasher.digester(),
 		fileWriter:             fw,
 		driver:                 lbs.driver,
 		path:                   path,
@@ -392,8 +423,8 @@ func (lbs *linkedBlobStatter) Stat(ctx context.Context, dgst digest.Digest) (dis
 			break // success!
 		}
 
-		switch err := err.(type) {
-		case driver.PathNotFoundError:
+		switch {
+		case errors.Is(err, driver.ErrNotFound):
 			// do nothing, just move to the next linkPathFn
 		default:
 			return distribution.Descriptor{}, err
@@ -425,8 +456,8 @@ func (lbs *linkedBlobStatter) Clear(ctx context.Context, dgst digest.Digest) (er
 
 		err = lbs.blobStore.driver.Delete(ctx, blobLinkPath)
 		if err != nil {
-			switch err := err.(type) {
-			case driver.PathNotFoundError:
+			switch {
+			case errors.Is(err, driver.ErrNotFound):
 				continue // just ignore this error and continue
 			default:
 				return err
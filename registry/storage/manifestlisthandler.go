@@ -7,14 +7,18 @@ import (
 	"github.com/distribution/distribution/v3"
 	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // manifestListHandler is a ManifestHandler that covers schema2 manifest lists.
 type manifestListHandler struct {
-	repository distribution.Repository
-	blobStore  distribution.BlobStore
-	ctx        context.Context
+	repository    *repository
+	blobStore     distribution.BlobStore
+	ctx           context.Context
+	storageDriver driver.StorageDriver
 }
 
 var _ ManifestHandler = &manifestListHandler{}
@@ -47,12 +51,24 @@ func (ms *manifestListHandler) Put(ctx context.Context, manifestList distributio
 		return "", err
 	}
 
+	if m.Subject != nil {
+		if err := ms.repository.verifyReferrersLimit(ctx, m.Subject.Digest, digest.FromBytes(payload)); err != nil {
+			return "", err
+		}
+	}
+
 	revision, err := ms.blobStore.Put(ctx, mt, payload)
 	if err != nil {
 		dcontext.GetLogger(ctx).Errorf("error putting payload into blobstore: %v", err)
 		return "", err
 	}
 
+	err = ms.indexReferrers(ctx, m, revision.Digest)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error indexing referrers: %v", err)
+		return "", err
+	}
+
 	return revision.Digest, nil
 }
 
@@ -77,6 +93,19 @@ func (ms *manifestListHandler) verifyManifest(ctx context.Context, mnfst manifes
 			return err
 		}
 
+		// An OCI image index may refer to a subject, which like for image
+		// manifests need not exist.
+		if mnfst.Subject != nil {
+			if err := mnfst.Subject.Digest.Validate(); err != nil {
+				errs = append(errs, err, distribution.ErrManifestBlobUnknown{Digest: mnfst.Subject.Digest})
+			}
+			switch mnfst.Subject.MediaType {
+			case v1.MediaTypeImageManifest, v1.MediaTypeArtifactManifest, v1.MediaTypeImageIndex, schema2.MediaTypeManifest, manifestlist.MediaTypeManifestList:
+			default:
+				errs = append(errs, distribution.ErrInvalidSubjectMediaType)
+			}
+		}
+
 		for _, manifestDescriptor := range mnfst.References() {
 			exists, err := manifestService.Exists(ctx, manifestDescriptor.Digest)
 			if err != nil && err != distribution.ErrBlobUnknown {
@@ -94,3 +123,25 @@ func (ms *manifestListHandler) verifyManifest(ctx context.Context, mnfst manifes
 
 	return nil
 }
+
+// indexReferrers indexes the subject of the given revision in its referrers
+// index store, for image indexes which refer to one.
+func (ms *manifestListHandler) indexReferrers(ctx context.Context, dm *manifestlist.DeserializedManifestList, revision digest.Digest) error {
+	if dm.Subject == nil {
+		return nil
+	}
+
+	subjectRevision := dm.Subject.Digest
+	artifactType, _ := referrerMetadata(dm)
+	if err := ms.repository.linkReferrer(ctx, subjectRevision, revision, artifactType); err != nil {
+		return err
+	}
+	ms.repository.referrerLinkCache.invalidate(ms.repository.Named().Name(), subjectRevision)
+	if err := ms.repository.indexReferrer(ctx, subjectRevision, revision, dm); err != nil {
+		return err
+	}
+	if err := ms.repository.indexGlobalReferrer(ctx, subjectRevision, revision, dm); err != nil {
+		return err
+	}
+	return ms.repository.tagReferrers(ctx, subjectRevision)
+}
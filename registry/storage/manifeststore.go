@@ -135,6 +135,28 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
+	if err := ms.repository.artifactClasses.verify(manifest); err != nil {
+		return "", err
+	}
+
+	// Fence the references before they are verified, in case an online
+	// garbage collection is running.
+	if err := fenceDigests(ctx, ms.blobStore.driver, manifestReferences(manifest)...); err != nil {
+		return "", err
+	}
+
+	// Record the references before the manifest is linked, so that an
+	// incremental garbage collection never misses one.
+	if ms.repository.referenceIndex {
+		revision, err := manifestRevision(manifest)
+		if err != nil {
+			return "", err
+		}
+		if err := addReferences(ctx, ms.blobStore.driver, ms.repository.Named().Name(), revision, manifestReferences(manifest)); err != nil {
+			return "", err
+		}
+	}
+
 	switch manifest.(type) {
 	case *schema1.SignedManifest:
 		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
@@ -177,19 +199,82 @@ func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
 		subject = m.Subject
 	case *ocischema.DeserializedManifest:
 		subject = m.Subject
+	case *manifestlist.DeserializedManifestList:
+		subject = m.Subject
 	}
 
+	// The referrer link is removed before the revision, and restored if the
+	// revision cannot be, so that the subject never lists a deleted
+	// manifest.
 	if subject != nil {
-		referrersLinkPath, err := pathFor(referrersLinkPathSpec{name: ms.repository.Named().Name(), revision: dgst, subjectRevision: subject.Digest})
-		if err != nil {
-			return fmt.Errorf("failed to generate referrers link path for %v", dgst)
+		if err := ms.unlinkReferrer(ctx, subject.Digest, dgst); err != nil {
+			return err
+		}
+	}
+
+	var references []digest.Digest
+	if ms.repository.referenceIndex {
+		// Queue the blobs for collection before the manifest is unlinked,
+		// and remove its references after.
+		references = manifestReferences(man)
+		err = queueCandidates(ctx, ms.blobStore.driver, append([]digest.Digest{dgst}, references...))
+	}
+	if err == nil {
+		err = ms.blobStore.blobAccessController.Clear(ctx, dgst)
+	}
+	if err != nil {
+		if subject != nil {
+			artifactType, _ := referrerMetadata(man)
+			if err := ms.relinkReferrer(ctx, subject.Digest, dgst, artifactType); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error restoring referrer link of %s: %v", dgst, err)
+			}
+		}
+		return err
+	}
+
+	if subject != nil {
+		if err := ms.repository.unindexReferrer(ctx, subject.Digest, dgst); err != nil {
+			return err
 		}
-		if err = ms.repository.driver.Delete(ctx, referrersLinkPath); err != nil {
+		if err := ms.repository.unindexGlobalReferrer(ctx, subject.Digest, dgst); err != nil {
+			return err
+		}
+		if err := ms.repository.tagReferrers(ctx, subject.Digest); err != nil {
 			return err
 		}
 	}
 
-	return ms.blobStore.blobAccessController.Clear(ctx, dgst)
+	if !ms.repository.referenceIndex {
+		return nil
+	}
+	return removeReferences(ctx, ms.blobStore.driver, ms.repository.Named().Name(), dgst, references)
+}
+
+// unlinkReferrer removes the link of a referrer from the referrers of its
+// subject. A missing link is not an error, so that a referrer whose link is
+// already gone can still be deleted.
+func (ms *manifestStore) unlinkReferrer(ctx context.Context, subject, dgst digest.Digest) error {
+	defer ms.repository.referrerLinkCache.invalidate(ms.repository.Named().Name(), subject)
+	_, err := deleteReferrerLinks(ctx, ms.repository.driver, ms.repository.Named().Name(), subject, dgst)
+	return err
+}
+
+// relinkReferrer restores the link of a referrer removed by unlinkReferrer.
+func (ms *manifestStore) relinkReferrer(ctx context.Context, subject, dgst digest.Digest, artifactType string) error {
+	defer ms.repository.referrerLinkCache.invalidate(ms.repository.Named().Name(), subject)
+	return ms.repository.linkReferrer(ctx, subject, dgst, artifactType)
+}
+
+// manifestRevision returns the digest a manifest is stored under.
+func manifestRevision(manifest distribution.Manifest) (digest.Digest, error) {
+	if sm, ok := manifest.(*schema1.SignedManifest); ok {
+		return digest.FromBytes(sm.Canonical), nil
+	}
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(payload), nil
 }
 
 func (ms *manifestStore) Enumerate(ctx context.Context, ingester func(digest.Digest) error) error {
@@ -202,3 +287,9 @@ func (ms *manifestStore) Enumerate(ctx context.Context, ingester func(digest.Dig
 	})
 	return err
 }
+
+// EnumerateFrom calls ingester for each manifest after marker, the digest of
+// the last manifest ingested, in the order of their revision links.
+func (ms *manifestStore) EnumerateFrom(ctx context.Context, marker string, ingester func(digest.Digest) error) (string, error) {
+	return ms.blobStore.EnumerateFrom(ctx, marker, ingester)
+}
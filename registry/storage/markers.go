@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// ConsistencyMarker records a point at which a registry instance held its
+// writes and had none in flight. A snapshot of the storage holding the
+// marker holds every write the instance completed before it was quiesced.
+type ConsistencyMarker struct {
+	ID       string `json:"id"`
+	Label    string `json:"label,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// QuiescedAt is when the writes were held, and CreatedAt when the
+	// marker was recorded, once the writes in flight had completed.
+	QuiescedAt time.Time `json:"quiescedAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// DrainedWrites is the number of writes in flight when the writes were
+	// held.
+	DrainedWrites int `json:"drainedWrites"`
+}
+
+// PutConsistencyMarker records marker in the storage, named after the time
+// it was created, which is set to now.
+func PutConsistencyMarker(ctx context.Context, storageDriver driver.StorageDriver, marker *ConsistencyMarker) error {
+	marker.CreatedAt = time.Now().UTC()
+	marker.ID = marker.CreatedAt.Format("20060102T150405.000000000Z")
+	content, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	markerPath, err := pathFor(consistencyMarkerPathSpec{id: marker.ID})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.PutContent(ctx, markerPath, content); err != nil {
+		return fmt.Errorf("failed to write consistency marker: %v", err)
+	}
+	return nil
+}
+
+// ConsistencyMarkers returns the consistency markers recorded in the
+// storage, oldest first.
+func ConsistencyMarkers(ctx context.Context, storageDriver driver.StorageDriver) ([]ConsistencyMarker, error) {
+	markersPath, err := pathFor(consistencyMarkersPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+	markerPaths, err := storageDriver.List(ctx, markersPath)
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// Markers are named after the time they were created.
+	sort.Strings(markerPaths)
+
+	markers := make([]ConsistencyMarker, 0, len(markerPaths))
+	for _, markerPath := range markerPaths {
+		content, err := storageDriver.GetContent(ctx, markerPath)
+		if err != nil {
+			return nil, err
+		}
+		var marker ConsistencyMarker
+		if err := json.Unmarshal(content, &marker); err != nil {
+			return nil, fmt.Errorf("invalid consistency marker %q: %v", path.Base(markerPath), err)
+		}
+		markers = append(markers, marker)
+	}
+	return markers, nil
+}
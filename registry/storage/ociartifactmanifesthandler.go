@@ -16,7 +16,7 @@ import (
 
 // ociArtifactManifestHandler is a ManifestHandler that covers oci artifact manifests.
 type ociArtifactManifestHandler struct {
-	repository    distribution.Repository
+	repository    *repository
 	blobStore     distribution.BlobStore
 	ctx           context.Context
 	storageDriver driver.StorageDriver
@@ -52,6 +52,12 @@ func (ms *ociArtifactManifestHandler) Put(ctx context.Context, manifest distribu
 		return "", err
 	}
 
+	if m.Subject != nil {
+		if err := ms.repository.verifyReferrersLimit(ctx, m.Subject.Digest, digest.FromBytes(payload)); err != nil {
+			return "", err
+		}
+	}
+
 	revision, err := ms.blobStore.Put(ctx, mt, payload)
 	if err != nil {
 		dcontext.GetLogger(ctx).Errorf("error putting payload into blobstore: %v", err)
@@ -127,11 +133,20 @@ func (ms *ociArtifactManifestHandler) indexReferrers(ctx context.Context, dm *oc
 		return nil
 	}
 
-	// [TODO] We can use artifact type in the link path to support filtering by artifact type
-	//  but need to consider the max path length in different os
 	subjectRevision := dm.Subject.Digest
 
-	return indexWithSubject(ctx, ms.repository.Named().Name(), revision, subjectRevision, ms.storageDriver)
+	artifactType, _ := referrerMetadata(dm)
+	if err := ms.repository.linkReferrer(ctx, subjectRevision, revision, artifactType); err != nil {
+		return err
+	}
+	ms.repository.referrerLinkCache.invalidate(ms.repository.Named().Name(), subjectRevision)
+	if err := ms.repository.indexReferrer(ctx, subjectRevision, revision, dm); err != nil {
+		return err
+	}
+	if err := ms.repository.indexGlobalReferrer(ctx, subjectRevision, revision, dm); err != nil {
+		return err
+	}
+	return ms.repository.tagReferrers(ctx, subjectRevision)
 }
 
 func indexWithSubject(ctx context.Context, repo string, revision digest.Digest, subjectRevision digest.Digest, sd driver.StorageDriver) error {
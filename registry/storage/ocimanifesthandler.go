@@ -17,7 +17,7 @@ import (
 
 // ocischemaManifestHandler is a ManifestHandler that covers ocischema manifests.
 type ocischemaManifestHandler struct {
-	repository    distribution.Repository
+	repository    *repository
 	blobStore     distribution.BlobStore
 	ctx           context.Context
 	manifestURLs  manifestURLs
@@ -54,6 +54,12 @@ func (ms *ocischemaManifestHandler) Put(ctx context.Context, manifest distributi
 		return "", err
 	}
 
+	if m.Subject != nil {
+		if err := ms.repository.verifyReferrersLimit(ctx, m.Subject.Digest, digest.FromBytes(payload)); err != nil {
+			return "", err
+		}
+	}
+
 	revision, err := ms.blobStore.Put(ctx, mt, payload)
 	if err != nil {
 		dcontext.GetLogger(ctx).Errorf("error putting payload into blobstore: %v", err)
@@ -176,9 +182,18 @@ func (ms *ocischemaManifestHandler) indexReferrers(ctx context.Context, dm *ocis
 		return nil
 	}
 
-	// [TODO] We can use artifact type in the link path to support filtering by artifact type
-	//  but need to consider the max path length in different os
 	subjectRevision := dm.Subject.Digest
 
-	return indexWithSubject(ctx, ms.repository.Named().Name(), revision, subjectRevision, ms.storageDriver)
+	artifactType, _ := referrerMetadata(dm)
+	if err := ms.repository.linkReferrer(ctx, subjectRevision, revision, artifactType); err != nil {
+		return err
+	}
+	ms.repository.referrerLinkCache.invalidate(ms.repository.Named().Name(), subjectRevision)
+	if err := ms.repository.indexReferrer(ctx, subjectRevision, revision, dm); err != nil {
+		return err
+	}
+	if err := ms.repository.indexGlobalReferrer(ctx, subjectRevision, revision, dm); err != nil {
+		return err
+	}
+	return ms.repository.tagReferrers(ctx, subjectRevision)
 }
@@ -43,6 +43,8 @@ const (
 //				-> _referrers/subjects
 //					-> <subject digest path>
 //						-> <revision digest path>/link
+//				-> _referrers/indexes
+//					-> <subject digest path>/index.json
 //
 //		-> blob/<algorithm>
 //			<split directory content addressable storage>
@@ -101,7 +103,17 @@ const (
 //
 //	Referrers:
 //
+//	referrersSubjectPathSpec:       <root>/v2/repositories/<name>/_referrers/subjects/<subject algorithm>/<subject hex digest>/
 //	referrersLinkPathSpec:          <root>/v2/repositories/<name>/_referrers/subjects/<subject algorithm>/<subject hex digest>/<algorithm>/<hex digest>/link
+//	referrersTypesPathSpec:         <root>/v2/repositories/<name>/_referrers/subjects/<subject algorithm>/<subject hex digest>/types/
+//	referrersTypePathSpec:          <root>/v2/repositories/<name>/_referrers/subjects/<subject algorithm>/<subject hex digest>/types/<artifact type hash>/
+//	referrersTypedLinkPathSpec:     <root>/v2/repositories/<name>/_referrers/subjects/<subject algorithm>/<subject hex digest>/types/<artifact type hash>/<algorithm>/<hex digest>/link
+//	referrersIndexesPathSpec:       <root>/v2/repositories/<name>/_referrers/indexes/
+//	referrersIndexPathSpec:         <root>/v2/repositories/<name>/_referrers/indexes/<subject algorithm>/<subject hex digest>/index.json
+//
+//	Timeline:
+//
+//	timelinePathSpec:               <root>/v2/repositories/<name>/_timeline/events
 //
 //	Blob Store:
 //
@@ -110,6 +122,36 @@ const (
 //	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
+//	Garbage Collection:
+//
+//	gcRunningPathSpec:              <root>/v2/gc/running
+//	gcFencesPathSpec:               <root>/v2/gc/fences/
+//	gcFencePathSpec:                <root>/v2/gc/fences/<algorithm>/<hex digest>
+//	gcJournalPathSpec:              <root>/v2/gc/journals/<id>
+//
+//	Consistency markers:
+//
+//	consistencyMarkersPathSpec:     <root>/v2/markers/
+//	consistencyMarkerPathSpec:      <root>/v2/markers/<id>
+//
+//	Share links:
+//
+//	shareLinkUsedPathSpec:          <root>/v2/shares/<id>
+//
+//	Reference index:
+//
+//	referenceIndexBuiltPathSpec:    <root>/v2/references/built
+//	blobReferencesPathSpec:         <root>/v2/references/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/
+//	blobReferencePathSpec:          <root>/v2/references/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/<name>/_manifests/<algorithm>/<hex digest>
+//	referenceCandidatesPathSpec:    <root>/v2/references/candidates/
+//	referenceCandidatePathSpec:     <root>/v2/references/candidates/<algorithm>/<hex digest>
+//
+//	Global referrers index:
+//
+//	globalReferrersSubjectsPathSpec: <root>/v2/referrers/subjects/
+//	globalReferrersPathSpec:        <root>/v2/referrers/subjects/<subject algorithm>/<subject hex digest>/
+//	globalReferrerPathSpec:         <root>/v2/referrers/subjects/<subject algorithm>/<subject hex digest>/<name>/_manifests/<algorithm>/<hex digest>
+//
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
 func pathFor(spec pathSpec) (string, error) {
@@ -250,20 +292,125 @@ func pathFor(spec pathSpec) (string, error) {
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
+	case referrersSubjectPathSpec:
+		subjectComponents, err := digestPathComponents(v.subjectRevision, false)
+		if err != nil {
+			return "", err
+		}
+		return path.Join(append(append(repoPrefix, v.name, "_referrers", "subjects"), subjectComponents...)...), nil
 	case referrersLinkPathSpec:
+		revisionComponents, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
 
+		subjectPath, err := pathFor(referrersSubjectPathSpec{name: v.name, subjectRevision: v.subjectRevision})
+		if err != nil {
+			return "", err
+		}
+		return path.Join(append(append([]string{subjectPath}, revisionComponents...), "link")...), nil
+	case referrersTypesPathSpec:
+		subjectPath, err := pathFor(referrersSubjectPathSpec{name: v.name, subjectRevision: v.subjectRevision})
+		if err != nil {
+			return "", err
+		}
+		return path.Join(subjectPath, "types"), nil
+	case referrersTypePathSpec:
+		typesPath, err := pathFor(referrersTypesPathSpec{name: v.name, subjectRevision: v.subjectRevision})
+		if err != nil {
+			return "", err
+		}
+		return path.Join(typesPath, artifactTypeHash(v.artifactType)), nil
+	case referrersTypedLinkPathSpec:
 		revisionComponents, err := digestPathComponents(v.revision, false)
 		if err != nil {
 			return "", err
 		}
 
+		typePath, err := pathFor(referrersTypePathSpec{name: v.name, subjectRevision: v.subjectRevision, artifactType: v.artifactType})
+		if err != nil {
+			return "", err
+		}
+		return path.Join(append(append([]string{typePath}, revisionComponents...), "link")...), nil
+	case referrersIndexesPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_referrers", "indexes")...), nil
+	case referrersIndexPathSpec:
 		subjectComponents, err := digestPathComponents(v.subjectRevision, false)
 		if err != nil {
 			return "", err
 		}
-		referrersRootPath := append(repoPrefix, v.name, "_referrers", "subjects")
-		referrersComponentPath := append(append(referrersRootPath, subjectComponents...), revisionComponents...)
-		return path.Join(append(referrersComponentPath, "link")...), nil
+		return path.Join(append(append(append(repoPrefix, v.name, "_referrers", "indexes"), subjectComponents...), "index.json")...), nil
+	case timelinePathSpec:
+		return path.Join(append(repoPrefix, v.name, "_timeline", "events")...), nil
+	case gcRunningPathSpec:
+		return path.Join(append(rootPrefix, "gc", "running")...), nil
+	case gcFencesPathSpec:
+		return path.Join(append(rootPrefix, "gc", "fences")...), nil
+	case gcFencePathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(rootPrefix, "gc", "fences"), components...)...), nil
+	case gcJournalPathSpec:
+		return path.Join(append(rootPrefix, "gc", "journals", v.id)...), nil
+	case consistencyMarkersPathSpec:
+		return path.Join(append(rootPrefix, "markers")...), nil
+	case consistencyMarkerPathSpec:
+		return path.Join(append(rootPrefix, "markers", v.id)...), nil
+	case shareLinkUsedPathSpec:
+		return path.Join(append(rootPrefix, "shares", v.id)...), nil
+	case referenceIndexBuiltPathSpec:
+		return path.Join(append(rootPrefix, "references", "built")...), nil
+	case blobReferencesPathSpec:
+		components, err := digestPathComponents(v.digest, true)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(rootPrefix, "references", "blobs"), components...)...), nil
+	case blobReferencePathSpec:
+		components, err := digestPathComponents(v.digest, true)
+		if err != nil {
+			return "", err
+		}
+		revisionComponents, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		referencePath := append(append(append(rootPrefix, "references", "blobs"), components...), v.name, "_manifests")
+		return path.Join(append(referencePath, revisionComponents...)...), nil
+	case globalReferrersSubjectsPathSpec:
+		return path.Join(append(rootPrefix, "referrers", "subjects")...), nil
+	case globalReferrersPathSpec:
+		subjectComponents, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+		return path.Join(append(append(rootPrefix, "referrers", "subjects"), subjectComponents...)...), nil
+	case globalReferrerPathSpec:
+		subjectComponents, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+		revisionComponents, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		referrerPath := append(append(append(rootPrefix, "referrers", "subjects"), subjectComponents...), v.name, "_manifests")
+		return path.Join(append(referrerPath, revisionComponents...)...), nil
+	case referenceCandidatesPathSpec:
+		return path.Join(append(rootPrefix, "references", "candidates")...), nil
+	case referenceCandidatePathSpec:
+		components, err := digestPathComponents(v.digest, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(rootPrefix, "references", "candidates"), components...)...), nil
 	default:
 		// TODO(sday): This is an internal error. Ensure it doesn't escape (panic?).
 		return "", fmt.Errorf("unknown path spec: %#v", v)
@@ -458,6 +605,16 @@ type repositoriesRootPathSpec struct {
 
 func (repositoriesRootPathSpec) pathSpec() {}
 
+// referrersSubjectPathSpec is the directory of the referrer links of a
+// subject. Subjects of each digest algorithm have their own directory, so
+// that a repository may hold referrers of subjects of several algorithms.
+type referrersSubjectPathSpec struct {
+	name            string
+	subjectRevision digest.Digest
+}
+
+func (referrersSubjectPathSpec) pathSpec() {}
+
 // referrersLinkPathSpec defines the link path of a referrer.
 type referrersLinkPathSpec struct {
 	name            string
@@ -467,6 +624,173 @@ type referrersLinkPathSpec struct {
 
 func (referrersLinkPathSpec) pathSpec() {}
 
+// referrersTypesPathSpec is the directory of the referrer links of a
+// subject partitioned by artifact type.
+type referrersTypesPathSpec struct {
+	name            string
+	subjectRevision digest.Digest
+}
+
+func (referrersTypesPathSpec) pathSpec() {}
+
+// referrersTypePathSpec is the directory of the referrer links of a subject
+// of an artifact type. It is named after a hash of the artifact type, which
+// may not be a valid path component.
+type referrersTypePathSpec struct {
+	name            string
+	subjectRevision digest.Digest
+	artifactType    string
+}
+
+func (referrersTypePathSpec) pathSpec() {}
+
+// referrersTypedLinkPathSpec defines the link path of a referrer in the
+// directory of its artifact type.
+type referrersTypedLinkPathSpec struct {
+	name            string
+	revision        digest.Digest
+	subjectRevision digest.Digest
+	artifactType    string
+}
+
+func (referrersTypedLinkPathSpec) pathSpec() {}
+
+// referrersIndexesPathSpec is the directory of the referrers indexes of a
+// repository.
+type referrersIndexesPathSpec struct {
+	name string
+}
+
+func (referrersIndexesPathSpec) pathSpec() {}
+
+// referrersIndexPathSpec is the referrers index of a subject, listing the
+// descriptors of its referrers.
+type referrersIndexPathSpec struct {
+	name            string
+	subjectRevision digest.Digest
+}
+
+func (referrersIndexPathSpec) pathSpec() {}
+
+// timelinePathSpec is the timeline of the recent events of a repository.
+type timelinePathSpec struct {
+	name string
+}
+
+func (timelinePathSpec) pathSpec() {}
+
+// gcRunningPathSpec is the marker of an online garbage collection in
+// progress. It contains the time the collection started.
+type gcRunningPathSpec struct{}
+
+func (gcRunningPathSpec) pathSpec() {}
+
+// gcFencesPathSpec contains the fences written while an online garbage
+// collection is running.
+type gcFencesPathSpec struct{}
+
+func (gcFencesPathSpec) pathSpec() {}
+
+// gcFencePathSpec is the fence of a blob or manifest linked while an online
+// garbage collection is running, which must not be swept by it.
+type gcFencePathSpec struct {
+	digest digest.Digest
+}
+
+func (gcFencePathSpec) pathSpec() {}
+
+// gcJournalPathSpec is the journal of the deletions of a garbage collection,
+// written before they are made.
+type gcJournalPathSpec struct {
+	id string
+}
+
+func (gcJournalPathSpec) pathSpec() {}
+
+// consistencyMarkersPathSpec contains the consistency markers of the
+// registry.
+type consistencyMarkersPathSpec struct{}
+
+func (consistencyMarkersPathSpec) pathSpec() {}
+
+// consistencyMarkerPathSpec is a consistency marker, recorded while no write
+// was in flight.
+type consistencyMarkerPathSpec struct {
+	id string
+}
+
+func (consistencyMarkerPathSpec) pathSpec() {}
+
+// shareLinkUsedPathSpec records that a pull-once share link was used. It
+// contains the time it was used.
+type shareLinkUsedPathSpec struct {
+	id string
+}
+
+func (shareLinkUsedPathSpec) pathSpec() {}
+
+// referenceIndexBuiltPathSpec marks the reference index as complete. It
+// contains the time it was built.
+type referenceIndexBuiltPathSpec struct{}
+
+func (referenceIndexBuiltPathSpec) pathSpec() {}
+
+// blobReferencesPathSpec contains the manifests recorded as referencing a
+// blob.
+type blobReferencesPathSpec struct {
+	digest digest.Digest
+}
+
+func (blobReferencesPathSpec) pathSpec() {}
+
+// blobReferencePathSpec records that a manifest of a repository references
+// a blob.
+type blobReferencePathSpec struct {
+	digest   digest.Digest
+	name     string
+	revision digest.Digest
+}
+
+func (blobReferencePathSpec) pathSpec() {}
+
+// referenceCandidatesPathSpec contains the blobs which lost a reference
+// since the last incremental collection.
+type referenceCandidatesPathSpec struct{}
+
+func (referenceCandidatesPathSpec) pathSpec() {}
+
+// referenceCandidatePathSpec queues a blob which lost a reference, to be
+// deleted by the next incremental collection if it has none left.
+type referenceCandidatePathSpec struct {
+	digest digest.Digest
+}
+
+func (referenceCandidatePathSpec) pathSpec() {}
+
+// globalReferrersSubjectsPathSpec contains the subjects of the global
+// referrers index.
+type globalReferrersSubjectsPathSpec struct{}
+
+func (globalReferrersSubjectsPathSpec) pathSpec() {}
+
+// globalReferrersPathSpec contains the referrers of a subject, across
+// repositories, recorded in the global referrers index.
+type globalReferrersPathSpec struct {
+	subject digest.Digest
+}
+
+func (globalReferrersPathSpec) pathSpec() {}
+
+// globalReferrerPathSpec records that a manifest of a repository refers to
+// a subject. It contains the descriptor of the referrer.
+type globalReferrerPathSpec struct {
+	subject  digest.Digest
+	name     string
+	revision digest.Digest
+}
+
+func (globalReferrerPathSpec) pathSpec() {}
+
 // digestPathComponents provides a consistent path breakdown for a given
 // digest. For a generic digest, it will be as follows:
 //
@@ -515,9 +839,3 @@ func digestFromPath(digestPath string) (digest.Digest, error) {
 	dgst := digest.NewDigestFromHex(algo, hex)
 	return dgst, dgst.Validate()
 }
-
-// GetReferrersSearchPath generates the root path used for searching referrers.
-func GetReferrersSearchPath(repo string, subject digest.Digest) string {
-	repoPrefix := []string{storagePathRoot, storagePathVersion, "repositories"}
-	return path.Join(append(repoPrefix, repo, "_referrers", "subjects", subject.Algorithm().String(), subject.Hex())...)
-}
@@ -94,6 +94,32 @@ func TestPathMapper(t *testing.T) {
 				subjectRevision: "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"},
 			expected: "/docker/registry/v2/repositories/bar/_referrers/subjects/sha256/6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
+		{
+			spec: referrersSubjectPathSpec{
+				name:            "bar",
+				subjectRevision: "sha512:abababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababab"},
+			expected: "/docker/registry/v2/repositories/bar/_referrers/subjects/sha512/abababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababab",
+		},
+		{
+			spec: referrersLinkPathSpec{
+				name:            "bar",
+				revision:        "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				subjectRevision: "sha512:abababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababab"},
+			expected: "/docker/registry/v2/repositories/bar/_referrers/subjects/sha512/abababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababababab/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
+		},
+		{
+			spec: referrersIndexPathSpec{
+				name:            "bar",
+				subjectRevision: "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"},
+			expected: "/docker/registry/v2/repositories/bar/_referrers/indexes/sha256/6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b/index.json",
+		},
+		{
+			spec: globalReferrerPathSpec{
+				subject:  "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+				name:     "foo/bar",
+				revision: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"},
+			expected: "/docker/registry/v2/referrers/subjects/sha256/6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b/foo/bar/_manifests/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+		},
 	} {
 		p, err := pathFor(testcase.spec)
 		if err != nil {
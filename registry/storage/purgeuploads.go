@@ -53,6 +53,44 @@ func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, older
 	return deleted, errors
 }
 
+// Upload is an upload in progress.
+type Upload struct {
+	// Repository is the name of the repository the upload is made to.
+	Repository string
+	// ID is the UUID of the upload.
+	ID string
+	// StartedAt is when the upload started, or zero if it is unknown.
+	StartedAt time.Time
+}
+
+// OutstandingUploads returns the uploads in progress in every repository,
+// completed or abandoned uploads included until they are purged. The errors
+// encountered while walking the uploads are returned along with them.
+func OutstandingUploads(ctx context.Context, driver storageDriver.StorageDriver) ([]Upload, []error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, []error{err}
+	}
+	outstanding, errors := getOutstandingUploads(ctx, driver)
+	now := time.Now()
+	uploads := make([]Upload, 0, len(outstanding))
+	for id, ud := range outstanding {
+		repoDir := path.Dir(path.Dir(ud.containingDir))
+		if ud.containingDir == "" || !strings.HasPrefix(repoDir, root+"/") {
+			continue
+		}
+		upload := Upload{
+			Repository: strings.TrimPrefix(repoDir, root+"/"),
+			ID:         id,
+		}
+		if !ud.startedAt.After(now) {
+			upload.StartedAt = ud.startedAt
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, errors
+}
+
 // getOutstandingUploads walks the upload directory, collecting files
 // which could be eligible for deletion.  The only reliable way to
 // classify the age of a file is with the date stored in the startedAt
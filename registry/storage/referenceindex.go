@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// EnableReferenceIndex is a functional option for NewRegistry. It records,
+// for each blob, the manifests referencing it, and queues the blobs
+// referenced by deleted manifests, so that SweepReferenceIndex can delete
+// those no manifest references anymore without marking the whole registry.
+func EnableReferenceIndex(registry *registry) error {
+	registry.referenceIndex = true
+	return nil
+}
+
+// blobReference is a manifest referencing a blob.
+type blobReference struct {
+	name     string
+	revision digest.Digest
+	// recorded is when the reference was recorded.
+	recorded time.Time
+}
+
+// addReferences records that a manifest references itself and the blobs it
+// references. It must be called before the manifest is linked, so that the
+// index never misses a reference.
+func addReferences(ctx context.Context, storageDriver driver.StorageDriver, repoName string, revision digest.Digest, dgsts []digest.Digest) error {
+	for _, dgst := range append([]digest.Digest{revision}, dgsts...) {
+		referencePath, err := pathFor(blobReferencePathSpec{digest: dgst, name: repoName, revision: revision})
+		if err != nil {
+			return err
+		}
+		if err := storageDriver.PutContent(ctx, referencePath, []byte{}); err != nil {
+			return fmt.Errorf("failed to record reference to %s: %v", dgst, err)
+		}
+	}
+	return nil
+}
+
+// queueCandidates queues blobs as candidates of the next incremental
+// collection. The blobs referenced by a manifest must be queued before it
+// is unlinked.
+func queueCandidates(ctx context.Context, storageDriver driver.StorageDriver, dgsts []digest.Digest) error {
+	for _, dgst := range dgsts {
+		candidatePath, err := pathFor(referenceCandidatePathSpec{digest: dgst})
+		if err != nil {
+			return err
+		}
+		if err := storageDriver.PutContent(ctx, candidatePath, []byte{}); err != nil {
+			return fmt.Errorf("failed to queue %s for collection: %v", dgst, err)
+		}
+	}
+	return nil
+}
+
+// removeReferences removes the references of a manifest to itself and the
+// blobs it references.
+func removeReferences(ctx context.Context, storageDriver driver.StorageDriver, repoName string, revision digest.Digest, dgsts []digest.Digest) error {
+	for _, dgst := range append([]digest.Digest{revision}, dgsts...) {
+		if err := removeReference(ctx, storageDriver, dgst, blobReference{name: repoName, revision: revision}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeReference(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest, ref blobReference) error {
+	referencePath, err := pathFor(blobReferencePathSpec{digest: dgst, name: ref.name, revision: ref.revision})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.Delete(ctx, referencePath); err != nil {
+		if !errors.Is(err, driver.ErrNotFound) {
+			return fmt.Errorf("failed to remove reference to %s: %v", dgst, err)
+		}
+	}
+	return nil
+}
+
+// blobReferences lists the manifests recorded as referencing a blob.
+func blobReferences(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest) ([]blobReference, error) {
+	referencesPath, err := pathFor(blobReferencesPathSpec{digest: dgst})
+	if err != nil {
+		return nil, err
+	}
+	var refs []blobReference
+	err = storageDriver.Walk(ctx, referencesPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		name, revisionPath, ok := strings.Cut(strings.TrimPrefix(fileInfo.Path(), referencesPath+"/"), "/_manifests/")
+		if !ok {
+			return nil
+		}
+		algorithm, hex := path.Split(revisionPath)
+		revision := digest.NewDigestFromHex(strings.TrimSuffix(algorithm, "/"), hex)
+		if revision.Validate() != nil {
+			return nil
+		}
+		refs = append(refs, blobReference{name: name, revision: revision, recorded: fileInfo.ModTime()})
+		return nil
+	})
+	if errors.Is(err, driver.ErrNotFound) {
+		return nil, nil
+	}
+	return refs, err
+}
+
+// SweepReferenceIndex deletes the blobs which lost a reference since the
+// last call, when no manifest references them anymore according to the
+// reference index. The index is only complete once built by a full
+// collection with GCOpts.BuildReferenceIndex, against a registry recording
+// it. References of manifests which no longer exist are removed along the
+// way.
+//
+// Only DryRun, DeleteRate, Events, ReportFormat, Online and GracePeriod of
+// opts apply.
+func SweepReferenceIndex(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) (GCReport, error) {
+	return observeGC(sweepReferenceIndex(ctx, storageDriver, registry, opts))
+}
+
+func sweepReferenceIndex(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) (GCReport, error) {
+	switch opts.ReportFormat {
+	case "", GCReportText, GCReportJSON:
+	default:
+		return GCReport{}, fmt.Errorf("unknown garbage collection report format %q", opts.ReportFormat)
+	}
+	builtPath, err := pathFor(referenceIndexBuiltPathSpec{})
+	if err != nil {
+		return GCReport{}, err
+	}
+	if _, err := storageDriver.Stat(ctx, builtPath); err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return GCReport{}, fmt.Errorf("the reference index has not been built, run a full garbage collection building it first")
+		}
+		return GCReport{}, err
+	}
+
+	events := newGCEmitter(opts.Events, opts.ReportFormat == GCReportJSON)
+	report := GCReport{DryRun: opts.DryRun}
+	var online *onlineGC
+	var cutoff time.Time
+	if opts.Online {
+		grace := opts.GracePeriod
+		if grace <= 0 {
+			grace = DefaultGCGracePeriod
+		}
+		now := time.Now()
+		cutoff = now.Add(-grace)
+		online, err = startOnlineGC(ctx, storageDriver, now, cutoff, !opts.DryRun)
+		if err != nil {
+			return GCReport{}, err
+		}
+		defer func() {
+			if err := online.stop(ctx); err != nil {
+				events.emit(GCEvent{Kind: GCEventWarning}, "failed to stop online garbage collection: %v", err)
+			}
+		}()
+	}
+
+	candidatesPath, err := pathFor(referenceCandidatesPathSpec{})
+	if err != nil {
+		return GCReport{}, err
+	}
+	var candidates []digest.Digest
+	err = storageDriver.Walk(ctx, candidatesPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		dgst, err := digestFromPath(fileInfo.Path())
+		if err != nil {
+			return nil
+		}
+		candidates = append(candidates, dgst)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, driver.ErrNotFound) {
+			return GCReport{}, fmt.Errorf("failed to list collection candidates: %v", err)
+		}
+	}
+
+	vacuum := NewVacuum(ctx, storageDriver)
+	vacuum.events = events
+	throttle := newDeleteThrottle(ctx, opts.DeleteRate)
+	defer throttle.stop()
+	statter := registry.BlobStatter()
+	dequeue := func(dgst digest.Digest) error {
+		if opts.DryRun {
+			return nil
+		}
+		candidatePath, err := pathFor(referenceCandidatePathSpec{digest: dgst})
+		if err != nil {
+			return err
+		}
+		if err := storageDriver.Delete(ctx, candidatePath); err != nil {
+			if !errors.Is(err, driver.ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, dgst := range candidates {
+		referenced, pending, err := liveReferences(ctx, storageDriver, dgst, cutoff, !opts.DryRun)
+		if err != nil {
+			return GCReport{}, err
+		}
+		if len(referenced) == 0 && len(pending) > 0 {
+			// The next run finds out whether the push completed.
+			events.emit(GCEvent{Kind: GCEventMark, Repository: pending[0].name, Digest: dgst}, "%s: marking blob %s referenced by manifest %s being pushed", pending[0].name, dgst, pending[0].revision)
+			continue
+		}
+		if len(referenced) > 0 {
+			events.emit(GCEvent{Kind: GCEventMark, Repository: referenced[0].name, Digest: dgst}, "%s: blob %s still referenced by manifest %s", referenced[0].name, dgst, referenced[0].revision)
+			if err := dequeue(dgst); err != nil {
+				return GCReport{}, err
+			}
+			continue
+		}
+		if online != nil {
+			// Candidates kept for now are reconsidered by the next run.
+			reason, err := online.keepBlob(ctx, dgst)
+			if err != nil {
+				return GCReport{}, err
+			}
+			if reason != "" {
+				events.emit(GCEvent{Kind: GCEventMark, Digest: dgst}, "marking blob %s %s", dgst, reason)
+				continue
+			}
+		}
+		desc, err := statter.Stat(ctx, dgst)
+		if err != nil {
+			if err != distribution.ErrBlobUnknown {
+				return GCReport{}, fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+			}
+			// Already deleted, by a full collection for instance.
+			if err := dequeue(dgst); err != nil {
+				return GCReport{}, err
+			}
+			continue
+		}
+		events.emit(GCEvent{Kind: GCEventEligible, Digest: dgst}, "blob eligible for deletion: %s", dgst)
+		if !opts.DryRun {
+			if err := throttle.wait(); err != nil {
+				return GCReport{}, err
+			}
+			if err := vacuum.RemoveBlob(string(dgst)); err != nil {
+				return GCReport{}, fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+			}
+			if err := dequeue(dgst); err != nil {
+				return GCReport{}, err
+			}
+		}
+		report.BlobsDeleted++
+		report.BytesReclaimed += desc.Size
+		if !opts.DryRun {
+			gcBlobsDeleted.Inc(1)
+			gcBytesReclaimed.Inc(float64(desc.Size))
+		}
+	}
+
+	reclaimed := "reclaimed"
+	if opts.DryRun {
+		reclaimed = "would be reclaimed"
+	}
+	events.emit(GCEvent{Kind: GCEventReclaimed}, "%d blobs deleted, %d bytes %s", report.BlobsDeleted, report.BytesReclaimed, reclaimed)
+
+	return report, nil
+}
+
+// liveReferences returns the manifests referencing a blob which still
+// exist, and those which may be being pushed as their reference was
+// recorded after cutoff, removing the references of the others if prune is
+// set.
+func liveReferences(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest, cutoff time.Time, prune bool) (live, pending []blobReference, err error) {
+	refs, err := blobReferences(ctx, storageDriver, dgst)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list references to %s: %v", dgst, err)
+	}
+	for _, ref := range refs {
+		_, err := revisionLinkTime(ctx, storageDriver, ref.name, ref.revision)
+		if err == nil {
+			live = append(live, ref)
+			continue
+		}
+		if !errors.Is(err, driver.ErrNotFound) {
+			return nil, nil, err
+		}
+		if !cutoff.IsZero() && ref.recorded.After(cutoff) {
+			pending = append(pending, ref)
+			continue
+		}
+		if prune {
+			if err := removeReference(ctx, storageDriver, dgst, ref); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return live, pending, nil
+}
+
+// markReferenceIndexBuilt records that the reference index is complete.
+func markReferenceIndexBuilt(ctx context.Context, storageDriver driver.StorageDriver, now time.Time) error {
+	builtPath, err := pathFor(referenceIndexBuiltPathSpec{})
+	if err != nil {
+		return err
+	}
+	return storageDriver.PutContent(ctx, builtPath, []byte(now.UTC().Format(time.RFC3339)))
+}
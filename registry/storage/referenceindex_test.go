@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestSweepReferenceIndex(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver, EnableReferenceIndex)
+	repoA := makeRepository(t, registry, "indexed/a")
+	repoB := makeRepository(t, registry, "indexed/b")
+
+	layersA, err := testutil.CreateRandomLayers(3)
+	if err != nil {
+		t.Fatalf("failed to make layers: %v", err)
+	}
+	layersB, err := testutil.CreateRandomLayers(3)
+	if err != nil {
+		t.Fatalf("failed to make layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(repoA, layersA); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(repoB, layersB); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+	// Share a layer of a with b.
+	shared := getAnyKey(layersA)
+	if _, err := layersA[shared].Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repoB, map[digest.Digest]io.ReadSeeker{shared: layersA[shared]}); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+
+	manifestA, err := testutil.MakeSchema2Manifest(repoA, getKeys(layersA))
+	if err != nil {
+		t.Fatalf("failed to make manifest: %v", err)
+	}
+	manifestB, err := testutil.MakeSchema2Manifest(repoB, append(getKeys(layersB), shared))
+	if err != nil {
+		t.Fatalf("failed to make manifest: %v", err)
+	}
+	if _, err := makeManifestService(t, repoA).Put(ctx, manifestA); err != nil {
+		t.Fatalf("manifest upload failed: %v", err)
+	}
+	manifestServiceB := makeManifestService(t, repoB)
+	dgstB, err := manifestServiceB.Put(ctx, manifestB)
+	if err != nil {
+		t.Fatalf("manifest upload failed: %v", err)
+	}
+
+	// The index is only used once built by a full collection.
+	if _, err := SweepReferenceIndex(ctx, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}}); err == nil {
+		t.Fatal("expected an error sweeping an index which was not built")
+	}
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{BuildReferenceIndex: true, Events: func(GCEvent) {}}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	before := allBlobs(t, registry)
+	if err := manifestServiceB.Delete(ctx, dgstB); err != nil {
+		t.Fatalf("manifest deletion failed: %v", err)
+	}
+	// The layer and the config b shares with a are kept.
+	unshared := map[digest.Digest]struct{}{dgstB: {}}
+	for _, descriptor := range manifestB.References() {
+		unshared[descriptor.Digest] = struct{}{}
+	}
+	for _, descriptor := range manifestA.References() {
+		delete(unshared, descriptor.Digest)
+	}
+
+	report, err := SweepReferenceIndex(ctx, inmemoryDriver, registry, GCOpts{DryRun: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("failed to sweep the reference index: %v", err)
+	}
+	if report.BlobsDeleted != len(unshared) || len(allBlobs(t, registry)) != len(before) {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+
+	report, err = SweepReferenceIndex(ctx, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("failed to sweep the reference index: %v", err)
+	}
+	if report.BlobsDeleted != len(unshared) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	after := allBlobs(t, registry)
+	for dgst := range before {
+		_, deleted := unshared[dgst]
+		if _, ok := after[dgst]; ok == deleted {
+			t.Fatalf("blob %s deleted: %t, expected %t", dgst, !ok, deleted)
+		}
+	}
+
+	// The candidates were dequeued.
+	report, err = SweepReferenceIndex(ctx, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("failed to sweep the reference index: %v", err)
+	}
+	if report.BlobsDeleted != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ociartifact"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.ReferrersLister = &repository{}
+
+// Referrers lists the manifests of this repository which declare subject as
+// their subject, as recorded in the repository's referrers index. Links to
+// manifests which no longer exist are ignored.
+func (repo *repository) Referrers(ctx context.Context, subject digest.Digest, artifactTypes ...string) ([]distribution.Descriptor, error) {
+	dcontext.GetLogger(ctx).Debug("(*repository).Referrers")
+
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := ReferrerLinksOfTypes(ctx, repo.driver, repo.registry, repo.name.Name(), subject, artifactTypes)
+	if err != nil {
+		return nil, err
+	}
+	var referrers []distribution.Descriptor
+	for _, dgst := range links {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		man, err := manifests.Get(ctx, dgst)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				continue
+			}
+			return nil, err
+		}
+
+		artifactType, annotations := referrerMetadata(man)
+		if !matchesArtifactType(artifactType, artifactTypes) {
+			continue
+		}
+
+		mediaType, payload, err := man.Payload()
+		if err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, distribution.Descriptor{
+			MediaType:   mediaType,
+			Size:        int64(len(payload)),
+			Digest:      dgst,
+			Annotations: annotations,
+		})
+	}
+
+	return referrers, nil
+}
+
+// ReferrerLinks returns the digests of the manifests linked as referrers of
+// subject in the named repository, which may no longer exist. They come
+// from the referrer link cache of namespace, if it has one.
+func ReferrerLinks(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, repoName string, subject digest.Digest) ([]digest.Digest, error) {
+	if reg, ok := namespace.(*registry); ok {
+		return reg.referrerLinkCache.get(ctx, storageDriver, repoName, subject)
+	}
+	return walkSubjectReferrerLinks(ctx, storageDriver, repoName, subject)
+}
+
+// referrerLinks returns the digests of the manifests linked as referrers of
+// subject.
+func (repo *repository) referrerLinks(ctx context.Context, subject digest.Digest) ([]digest.Digest, error) {
+	return repo.referrerLinkCache.get(ctx, repo.driver, repo.name.Name(), subject)
+}
+
+// walkSubjectReferrerLinks reads the referrer links of subject, in either
+// layout.
+func walkSubjectReferrerLinks(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject digest.Digest) ([]digest.Digest, error) {
+	subjectPath, err := pathFor(referrersSubjectPathSpec{name: repoName, subjectRevision: subject})
+	if err != nil {
+		return nil, err
+	}
+	return walkLinkFiles(ctx, storageDriver, subjectPath)
+}
+
+// walkLinkFiles reads the digests of the link files under root.
+func walkLinkFiles(ctx context.Context, storageDriver driver.StorageDriver, root string) ([]digest.Digest, error) {
+	var links []digest.Digest
+	err := storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		content, err := storageDriver.GetContent(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+		dgst, err := digest.Parse(string(content))
+		if err != nil {
+			return err
+		}
+		links = append(links, dgst)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return links, nil
+}
+
+// maxReferrerLinkEntries bounds the number of subjects whose referrer links
+// are cached.
+const maxReferrerLinkEntries = 10000
+
+// referrerLinkCache caches the referrer links of subjects, so that the
+// referrers of hot subjects are not walked on every query. The registry
+// invalidates the links of a subject when it writes or deletes one, and
+// entries expire after the TTL to catch up with the writes of other
+// instances and garbage collections.
+type referrerLinkCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]referrerLinksEntry
+	// invalidations counts the invalidations, so that a walk racing with
+	// one is not cached.
+	invalidations uint64
+}
+
+type referrerLinksEntry struct {
+	links   []digest.Digest
+	expires time.Time
+}
+
+// ReferrerLinkCache is a functional option for NewRegistry. It caches the
+// referrer links of subjects for up to ttl.
+func ReferrerLinkCache(ttl time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		if ttl > 0 {
+			registry.referrerLinkCache = &referrerLinkCache{
+				ttl:     ttl,
+				entries: make(map[string]referrerLinksEntry),
+			}
+		}
+		return nil
+	}
+}
+
+func referrerLinkKey(repoName string, subject digest.Digest) string {
+	return repoName + "@" + subject.String()
+}
+
+// get returns the referrer links of subject, walking them if they are not
+// cached. A nil cache always walks.
+func (c *referrerLinkCache) get(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject digest.Digest) ([]digest.Digest, error) {
+	if c == nil {
+		return walkSubjectReferrerLinks(ctx, storageDriver, repoName, subject)
+	}
+	key := referrerLinkKey(repoName, subject)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	invalidations := c.invalidations
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.links, nil
+	}
+
+	links, err := walkSubjectReferrerLinks(ctx, storageDriver, repoName, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.invalidations != invalidations {
+		return links, nil
+	}
+	now := time.Now()
+	if len(c.entries) >= maxReferrerLinkEntries {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxReferrerLinkEntries {
+			c.entries = make(map[string]referrerLinksEntry)
+		}
+	}
+	c.entries[key] = referrerLinksEntry{links: links, expires: now.Add(c.ttl)}
+	return links, nil
+}
+
+// invalidate drops the cached referrer links of subject, once one of them
+// is written or deleted.
+func (c *referrerLinkCache) invalidate(repoName string, subject digest.Digest) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidations++
+	delete(c.entries, referrerLinkKey(repoName, subject))
+}
+
+// referrerMetadata returns the artifact type and annotations of a manifest
+// which may carry a subject.
+func referrerMetadata(man distribution.Manifest) (string, map[string]string) {
+	switch m := man.(type) {
+	case *ociartifact.DeserializedManifest:
+		return m.ArtifactType, m.Annotations
+	case *ocischema.DeserializedManifest:
+		if m.ArtifactType != "" {
+			return m.ArtifactType, m.Annotations
+		}
+		return m.Config.MediaType, m.Annotations
+	case *manifestlist.DeserializedManifestList:
+		return m.ArtifactType, m.Annotations
+	}
+	return "", nil
+}
+
+// matchesArtifactType reports whether artifactType is one of the filters. An
+// empty filter list matches everything.
+func matchesArtifactType(artifactType string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if filter == artifactType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,669 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// walkCountingDriver counts the walks of the storage.
+type walkCountingDriver struct {
+	storagedriver.StorageDriver
+	walks int
+}
+
+func (d *walkCountingDriver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
+	d.walks++
+	return d.StorageDriver.Walk(ctx, path, f)
+}
+
+func TestReferrerLinkCache(t *testing.T) {
+	ctx := context.Background()
+	driver := &walkCountingDriver{StorageDriver: inmemory.New()}
+
+	registry := createRegistry(t, driver, ReferrerLinkCache(time.Hour))
+	repo := makeRepository(t, registry, "cached")
+	manifestService := makeManifestService(t, repo)
+	lister := repo.(distribution.ReferrersLister)
+
+	subject := uploadRandomOCIImage(t, repo, nil)
+	pushReferrer := func(artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	checkReferrers := func(want int, walks int) {
+		t.Helper()
+		driver.walks = 0
+		for i := 0; i < 3; i++ {
+			referrers, err := lister.Referrers(ctx, subject.manifestDigest)
+			if err != nil {
+				t.Fatalf("failed to list referrers: %v", err)
+			}
+			if len(referrers) != want {
+				t.Fatalf("listed %d referrers, want %d", len(referrers), want)
+			}
+		}
+		if driver.walks != walks {
+			t.Fatalf("referrers walked %d times, want %d", driver.walks, walks)
+		}
+	}
+
+	// Subjects without referrers are cached too.
+	checkReferrers(0, 1)
+	signature := pushReferrer("application/vnd.example.signature")
+	checkReferrers(1, 1)
+	checkReferrers(1, 0)
+
+	links, err := ReferrerLinks(ctx, driver, registry, "cached", subject.manifestDigest)
+	if err != nil {
+		t.Fatalf("failed to list referrer links: %v", err)
+	}
+	if len(links) != 1 || links[0] != signature {
+		t.Fatalf("unexpected referrer links %v", links)
+	}
+
+	pushReferrer("application/vnd.example.sbom")
+	checkReferrers(2, 1)
+	if err := manifestService.Delete(ctx, signature); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	checkReferrers(1, 1)
+}
+
+// revisionDeleteFailingDriver fails the deletion of manifest revisions.
+type revisionDeleteFailingDriver struct {
+	storagedriver.StorageDriver
+	fail bool
+}
+
+func (d *revisionDeleteFailingDriver) Delete(ctx context.Context, path string) error {
+	if d.fail && strings.Contains(path, "/_manifests/revisions/") {
+		return errors.New("revision deletion failed")
+	}
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+func TestDeleteReferrerLink(t *testing.T) {
+	ctx := context.Background()
+	driver := &revisionDeleteFailingDriver{StorageDriver: inmemory.New()}
+
+	registry := createRegistry(t, driver)
+	repo := makeRepository(t, registry, "unlinked")
+	manifestService := makeManifestService(t, repo)
+	lister := repo.(distribution.ReferrersLister)
+
+	subject := uploadRandomOCIImage(t, repo, nil)
+	pushReferrer := func(artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	checkLinks := func(want ...digest.Digest) {
+		t.Helper()
+		links, err := walkSubjectReferrerLinks(ctx, driver, "unlinked", subject.manifestDigest)
+		if err != nil {
+			t.Fatalf("failed to list referrer links: %v", err)
+		}
+		if len(links) != len(want) {
+			t.Fatalf("unexpected referrer links %v, want %v", links, want)
+		}
+		for i := range want {
+			if links[i] != want[i] {
+				t.Fatalf("unexpected referrer links %v, want %v", links, want)
+			}
+		}
+		referrers, err := lister.Referrers(ctx, subject.manifestDigest)
+		if err != nil {
+			t.Fatalf("failed to list referrers: %v", err)
+		}
+		if len(referrers) != len(want) {
+			t.Fatalf("listed %d referrers, want %d", len(referrers), len(want))
+		}
+	}
+
+	signature := pushReferrer("application/vnd.example.signature")
+	checkLinks(signature)
+
+	// The link is restored if the revision cannot be deleted.
+	driver.fail = true
+	if err := manifestService.Delete(ctx, signature); err == nil {
+		t.Fatal("expected the deletion of the referrer to fail")
+	}
+	checkLinks(signature)
+
+	driver.fail = false
+	if err := manifestService.Delete(ctx, signature); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	checkLinks()
+
+	// A referrer whose link is already gone is deleted all the same.
+	sbom := pushReferrer("application/vnd.example.sbom")
+	linkPath, err := pathFor(referrersLinkPathSpec{name: "unlinked", revision: sbom, subjectRevision: subject.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Delete(ctx, linkPath); err != nil {
+		t.Fatalf("failed to delete referrer link: %v", err)
+	}
+	if err := manifestService.Delete(ctx, sbom); err != nil {
+		t.Fatalf("failed to delete referrer without a link: %v", err)
+	}
+	if _, err := manifestService.Get(ctx, sbom); err == nil {
+		t.Fatal("expected the referrer to be deleted")
+	}
+	checkLinks()
+}
+
+func TestReferrersIndex(t *testing.T) {
+	ctx := context.Background()
+	driver := &walkCountingDriver{StorageDriver: inmemory.New()}
+
+	registry := createRegistry(t, driver, ReferrersIndex(false))
+	repo := makeRepository(t, registry, "indexed")
+	manifestService := makeManifestService(t, repo)
+
+	subject := uploadRandomOCIImage(t, repo, nil)
+	pushReferrer := func(artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	checkReferrers := func(want []string, walks int) {
+		t.Helper()
+		driver.walks = 0
+		for i := 0; i < 3; i++ {
+			referrers, ok, err := IndexedReferrers(ctx, registry, "indexed", subject.manifestDigest)
+			if err != nil || !ok {
+				t.Fatalf("failed to list indexed referrers: %v", err)
+			}
+			if len(referrers) != len(want) {
+				t.Fatalf("listed %d referrers, want %d", len(referrers), len(want))
+			}
+			artifactTypes := map[string]int{}
+			for j, referrer := range referrers {
+				if j > 0 && referrers[j-1].Digest >= referrer.Digest {
+					t.Fatalf("referrers are not sorted: %v", referrers)
+				}
+				if referrer.MediaType != v1.MediaTypeImageManifest || referrer.Size == 0 {
+					t.Fatalf("unexpected referrer %v", referrer)
+				}
+				artifactTypes[referrer.ArtifactType]++
+			}
+			for _, artifactType := range want {
+				artifactTypes[artifactType]--
+			}
+			for artifactType, count := range artifactTypes {
+				if count != 0 {
+					t.Fatalf("unexpected referrers of type %s in %v", artifactType, referrers)
+				}
+			}
+		}
+		if driver.walks != walks {
+			t.Fatalf("referrers walked %d times, want %d", driver.walks, walks)
+		}
+	}
+
+	// The index is built by the first query, then maintained by pushes
+	// and deletes.
+	signature := pushReferrer("application/vnd.example.signature")
+	checkReferrers([]string{"application/vnd.example.signature"}, 1)
+	sbom := pushReferrer("application/vnd.example.sbom")
+	checkReferrers([]string{"application/vnd.example.signature", "application/vnd.example.sbom"}, 0)
+	if err := manifestService.Delete(ctx, signature); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	checkReferrers([]string{"application/vnd.example.sbom"}, 0)
+
+	// Garbage collections drop the index.
+	if err := NewVacuum(ctx, driver).RemoveReferrerLink("indexed", subject.manifestDigest, sbom); err != nil {
+		t.Fatalf("failed to remove referrer link: %v", err)
+	}
+	checkReferrers([]string{}, 1)
+
+	// Registries without referrers indexes drop them as referrers change.
+	unindexed := createRegistry(t, driver)
+	if _, ok, err := IndexedReferrers(ctx, unindexed, "indexed", subject.manifestDigest); err != nil || ok {
+		t.Fatalf("unexpected indexed referrers of registry without index: %v", err)
+	}
+	manifestService = makeManifestService(t, makeRepository(t, unindexed, "indexed"))
+	pushReferrer("application/vnd.example.signature")
+	checkReferrers([]string{"application/vnd.example.signature"}, 1)
+}
+
+func TestReferrersTagSchema(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry := createRegistry(t, driver, EnableReferrersTagSchema)
+	repo := makeRepository(t, registry, "tagged")
+	manifestService := makeManifestService(t, repo)
+
+	subject := uploadRandomOCIImage(t, repo, nil)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: subject.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	pushReferrer := func(artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	tag := ReferrersTag(subject.manifestDigest)
+	if tag != "sha256-"+subject.manifestDigest.Encoded() {
+		t.Fatalf("unexpected referrers tag %s", tag)
+	}
+	checkTag := func(want ...string) {
+		t.Helper()
+		desc, err := repo.Tags(ctx).Get(ctx, tag)
+		if len(want) == 0 {
+			if _, ok := err.(distribution.ErrTagUnknown); !ok {
+				t.Fatalf("expected referrers tag to be deleted, got %v", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("failed to get referrers tag: %v", err)
+		}
+		manifest, err := manifestService.Get(ctx, desc.Digest)
+		if err != nil {
+			t.Fatalf("failed to get referrers index: %v", err)
+		}
+		mediaType, payload, _ := manifest.Payload()
+		var index v1.Index
+		if err := json.Unmarshal(payload, &index); err != nil {
+			t.Fatal(err)
+		}
+		if mediaType != v1.MediaTypeImageIndex || len(index.Manifests) != len(want) {
+			t.Fatalf("unexpected referrers index %s", payload)
+		}
+		for i, artifactType := range want {
+			if index.Manifests[i].ArtifactType != artifactType {
+				t.Fatalf("unexpected referrers index %s", payload)
+			}
+		}
+	}
+
+	signature := pushReferrer("application/vnd.example.signature")
+	checkTag("application/vnd.example.signature")
+	sbom := pushReferrer("application/vnd.example.sbom")
+	if sbom < signature {
+		checkTag("application/vnd.example.sbom", "application/vnd.example.signature")
+	} else {
+		checkTag("application/vnd.example.signature", "application/vnd.example.sbom")
+	}
+	if err := manifestService.Delete(ctx, signature); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	checkTag("application/vnd.example.sbom")
+
+	// Garbage collection deletes the tag along with the last referrer.
+	if _, err := MarkAndSweep(ctx, driver, registry, GCOpts{RemoveUntagged: true, Events: func(GCEvent) {}}); err != nil {
+		t.Fatalf("failed to collect garbage: %v", err)
+	}
+	if _, err := manifestService.Get(ctx, sbom); err == nil {
+		t.Fatal("expected untagged referrer to be deleted")
+	}
+	checkTag()
+}
+
+func TestReferrersCancelled(t *testing.T) {
+	driver := inmemory.New()
+	registry := createRegistry(t, driver)
+	repo := makeRepository(t, registry, "cancelled")
+	subject := uploadRandomOCIImage(t, repo, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := repo.(distribution.ReferrersLister).Referrers(ctx, subject.manifestDigest); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected listing referrers to be cancelled, got %v", err)
+	}
+}
+
+func TestCollectReferrersOnly(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry := createRegistry(t, driver)
+	repo := makeRepository(t, registry, "referrers-only")
+	manifestService := makeManifestService(t, repo)
+
+	pushReferrer := func(subject digest.Digest, artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	// unlink deletes a manifest from the storage by hand, leaving its
+	// referrer links behind.
+	unlink := func(dgst digest.Digest) {
+		linkPath, err := pathFor(manifestRevisionLinkPathSpec{name: "referrers-only", revision: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := driver.Delete(ctx, linkPath); err != nil {
+			t.Fatalf("failed to unlink manifest: %v", err)
+		}
+	}
+
+	kept := uploadRandomOCIImage(t, repo, nil)
+	keptReferrer := pushReferrer(kept.manifestDigest, "application/vnd.example.signature")
+	unlink(pushReferrer(kept.manifestDigest, "application/vnd.example.sbom"))
+	orphaned := uploadRandomOCIImage(t, repo, nil)
+	pushReferrer(orphaned.manifestDigest, "application/vnd.example.signature")
+	unlink(orphaned.manifestDigest)
+	before := allBlobs(t, registry)
+
+	report, err := MarkAndSweep(ctx, driver, registry, GCOpts{DryRun: true, ReferrersOnly: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("failed to collect referrer links: %v", err)
+	}
+	if len(report.DanglingReferrerLinks) != 2 || report.LinksDeleted != 2 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+
+	report, err = MarkAndSweep(ctx, driver, registry, GCOpts{ReferrersOnly: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("failed to collect referrer links: %v", err)
+	}
+	if report.LinksDeleted != 2 || report.BlobsDeleted != 0 || report.ManifestsDeleted != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if after := allBlobs(t, registry); len(after) != len(before) {
+		t.Fatalf("blobs deleted collecting referrer links")
+	}
+	for subject, want := range map[digest.Digest][]digest.Digest{
+		kept.manifestDigest:     {keptReferrer},
+		orphaned.manifestDigest: nil,
+	} {
+		links, err := ReferrerLinks(ctx, driver, registry, "referrers-only", subject)
+		if err != nil {
+			t.Fatalf("failed to list referrer links: %v", err)
+		}
+		if len(links) != len(want) || (len(want) > 0 && links[0] != want[0]) {
+			t.Fatalf("referrer links of %s are %v, want %v", subject, links, want)
+		}
+	}
+}
+
+func TestReferrersSubjectAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry := createRegistry(t, driver, ReferrersIndex(false))
+	repo := makeRepository(t, registry, "algorithms")
+	manifestService := makeManifestService(t, repo)
+	lister := repo.(distribution.ReferrersLister)
+
+	image := uploadRandomOCIImage(t, repo, nil)
+	manifest, err := manifestService.Get(ctx, image.manifestDigest)
+	if err != nil {
+		t.Fatalf("failed to get subject: %v", err)
+	}
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		t.Fatalf("failed to get subject payload: %v", err)
+	}
+	// The same subject, referenced by digests of both algorithms.
+	sha256Subject := image.manifestDigest
+	sha512Subject := digest.SHA512.FromBytes(payload)
+
+	pushReferrer := func(subject digest.Digest) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType("application/vnd.example." + subject.Algorithm().String())
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := manifestService.Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer of %s: %v", subject, err)
+		}
+		return dgst
+	}
+	referrers := map[digest.Digest]digest.Digest{
+		sha256Subject: pushReferrer(sha256Subject),
+		sha512Subject: pushReferrer(sha512Subject),
+	}
+	checkReferrers := func() {
+		t.Helper()
+		for subject, referrer := range referrers {
+			links, err := ReferrerLinks(ctx, driver, registry, "algorithms", subject)
+			if err != nil {
+				t.Fatalf("failed to list referrer links of %s: %v", subject, err)
+			}
+			if len(links) != 1 || links[0] != referrer {
+				t.Fatalf("referrer links of %s are %v, want %s", subject, links, referrer)
+			}
+			listed, err := lister.Referrers(ctx, subject)
+			if err != nil {
+				t.Fatalf("failed to list referrers of %s: %v", subject, err)
+			}
+			if len(listed) != 1 || listed[0].Digest != referrer {
+				t.Fatalf("referrers of %s are %+v, want %s", subject, listed, referrer)
+			}
+		}
+	}
+	checkReferrers()
+
+	// The referrers of a subject of another algorithm are not dangling.
+	report, err := MarkAndSweep(ctx, driver, registry, GCOpts{ReferrersOnly: true, Events: func(GCEvent) {}})
+	if err != nil {
+		t.Fatalf("failed to collect referrer links: %v", err)
+	}
+	if report.LinksDeleted != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := MarkAndSweep(ctx, driver, registry, GCOpts{Events: func(GCEvent) {}}); err != nil {
+		t.Fatalf("failed to collect garbage: %v", err)
+	}
+	checkReferrers()
+
+	if err := manifestService.Delete(ctx, referrers[sha512Subject]); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	links, err := ReferrerLinks(ctx, driver, registry, "algorithms", sha512Subject)
+	if err != nil {
+		t.Fatalf("failed to list referrer links: %v", err)
+	}
+	if len(links) != 0 {
+		t.Fatalf("unexpected referrer links %v of deleted referrer", links)
+	}
+	delete(referrers, sha512Subject)
+	checkReferrers()
+}
+
+func TestGlobalReferrersIndex(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+	registry := createRegistry(t, driver, EnableGlobalReferrersIndex)
+
+	subject := digest.FromString("subject")
+	pushReferrer := func(repo distribution.Repository, artifactType string) digest.Digest {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := makeManifestService(t, repo).Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	checkReferrers := func(want ...GlobalReferrer) {
+		t.Helper()
+		referrers, ok, err := GlobalReferrers(ctx, registry, subject)
+		if err != nil || !ok {
+			t.Fatalf("failed to list global referrers: %v, %v", ok, err)
+		}
+		if len(referrers) != len(want) {
+			t.Fatalf("listed global referrers %+v, want %+v", referrers, want)
+		}
+		for i := range want {
+			if referrers[i].Repository != want[i].Repository || referrers[i].Descriptor.Digest != want[i].Descriptor.Digest || referrers[i].Descriptor.ArtifactType != want[i].Descriptor.ArtifactType {
+				t.Fatalf("listed global referrer %+v, want %+v", referrers[i], want[i])
+			}
+		}
+	}
+
+	signed := makeRepository(t, registry, "signed")
+	scanned := makeRepository(t, registry, "scanned")
+	signature := pushReferrer(signed, "application/vnd.example.signature")
+	sbom := pushReferrer(scanned, "application/vnd.example.sbom")
+	checkReferrers(
+		GlobalReferrer{Repository: "scanned", Descriptor: v1.Descriptor{Digest: sbom, ArtifactType: "application/vnd.example.sbom"}},
+		GlobalReferrer{Repository: "signed", Descriptor: v1.Descriptor{Digest: signature, ArtifactType: "application/vnd.example.signature"}},
+	)
+
+	if err := makeManifestService(t, signed).Delete(ctx, signature); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	checkReferrers(GlobalReferrer{Repository: "scanned", Descriptor: v1.Descriptor{Digest: sbom, ArtifactType: "application/vnd.example.sbom"}})
+
+	// Repositories removed from the storage are pruned from the index.
+	if err := NewVacuum(ctx, driver).RemoveRepository("scanned"); err != nil {
+		t.Fatalf("failed to remove repository: %v", err)
+	}
+	checkReferrers()
+	entryPath, err := pathFor(globalReferrerPathSpec{subject: subject, name: "scanned", revision: sbom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Stat(ctx, entryPath); !errors.Is(err, storagedriver.ErrNotFound) {
+		t.Fatalf("expected the stale entry to be removed, got %v", err)
+	}
+
+	if _, ok, err := GlobalReferrers(ctx, createRegistry(t, driver), subject); ok || err != nil {
+		t.Fatalf("expected the global referrers index to be disabled, got %v, %v", ok, err)
+	}
+}
+
+func TestMaxReferrersPerSubject(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	registry := createRegistry(t, driver, MaxReferrersPerSubject(2))
+	repo := makeRepository(t, registry, "limited")
+	manifestService := makeManifestService(t, repo)
+
+	subject := uploadRandomOCIImage(t, repo, nil)
+	pushReferrer := func(artifactType string) (digest.Digest, error) {
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		return manifestService.Put(ctx, referrer)
+	}
+
+	signature, err := pushReferrer("application/vnd.example.signature")
+	if err != nil {
+		t.Fatalf("failed to put referrer: %v", err)
+	}
+	if _, err := pushReferrer("application/vnd.example.sbom"); err != nil {
+		t.Fatalf("failed to put referrer: %v", err)
+	}
+
+	_, err = pushReferrer("application/vnd.example.attestation")
+	verificationErrs, ok := err.(distribution.ErrManifestVerification)
+	if !ok || len(verificationErrs) != 1 {
+		t.Fatalf("expected a verification error, got %v", err)
+	}
+	limitErr, ok := verificationErrs[0].(distribution.ErrReferrersLimitExceeded)
+	if !ok || limitErr.Subject != subject.manifestDigest || limitErr.Limit != 2 {
+		t.Fatalf("unexpected verification error %v", verificationErrs[0])
+	}
+
+	// Referrers already linked may be pushed again.
+	if _, err := pushReferrer("application/vnd.example.signature"); err != nil {
+		t.Fatalf("failed to put referrer again: %v", err)
+	}
+
+	// Manifests which are not referrers are not limited.
+	uploadRandomOCIImage(t, repo, nil)
+
+	// Links to referrers which no longer exist are not counted.
+	revisionPath, err := pathFor(manifestRevisionPathSpec{name: "limited", revision: signature})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Delete(ctx, revisionPath); err != nil {
+		t.Fatalf("failed to delete referrer revision: %v", err)
+	}
+	if _, err := pushReferrer("application/vnd.example.attestation"); err != nil {
+		t.Fatalf("failed to put referrer after deleting one: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ociartifact"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// referrersIndex maintains, for each subject, an index of the descriptors
+// of its referrers.
+type referrersIndex struct {
+	// readOnly is true if missing indexes are not written.
+	readOnly bool
+
+	// mu serializes the updates of the indexes by this instance.
+	mu sync.Mutex
+}
+
+// referrersIndexFile is the content of the referrers index of a subject.
+type referrersIndexFile struct {
+	// Referrers are sorted by digest.
+	Referrers []v1.Descriptor `json:"referrers"`
+}
+
+// ReferrersIndex is a functional option for NewRegistry. It maintains, for
+// each subject, an index of the descriptors of its referrers, updated as
+// referrers are pushed and deleted, so that IndexedReferrers lists them with
+// a single read rather than walking the referrer links and fetching every
+// referrer manifest. Missing indexes are built from the referrer links by
+// the first query, unless readOnly is set.
+func ReferrersIndex(readOnly bool) RegistryOption {
+	return func(registry *registry) error {
+		registry.referrersIndex = &referrersIndex{readOnly: readOnly}
+		return nil
+	}
+}
+
+// IndexedReferrers returns the descriptors of the referrers of subject in
+// the named repository, sorted by digest, from its referrers index. ok is
+// false if namespace does not maintain referrers indexes.
+func IndexedReferrers(ctx context.Context, namespace distribution.Namespace, repoName string, subject digest.Digest) (referrers []v1.Descriptor, ok bool, err error) {
+	reg, isRegistry := namespace.(*registry)
+	if !isRegistry || reg.referrersIndex == nil {
+		return nil, false, nil
+	}
+	referrers, found, err := readReferrersIndex(ctx, reg.driver, repoName, subject)
+	if err != nil {
+		return nil, false, err
+	}
+	if found {
+		return referrers, true, nil
+	}
+
+	// The index is written under the lock, so that it does not miss a
+	// referrer pushed while it is built.
+	if !reg.referrersIndex.readOnly {
+		reg.referrersIndex.mu.Lock()
+		defer reg.referrersIndex.mu.Unlock()
+	}
+	referrers, err = buildReferrersIndex(ctx, reg, repoName, subject)
+	if err != nil {
+		return nil, false, err
+	}
+	if !reg.referrersIndex.readOnly {
+		if err := writeReferrersIndex(ctx, reg.driver, repoName, subject, referrers); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error writing referrers index of %s: %v", subject, err)
+		}
+	}
+	return referrers, true, nil
+}
+
+// buildReferrersIndex lists the referrers of subject from its referrer
+// links. Links to manifests which no longer exist are ignored.
+func buildReferrersIndex(ctx context.Context, reg *registry, repoName string, subject digest.Digest) ([]v1.Descriptor, error) {
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := reg.Repository(ctx, named)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	links, err := walkSubjectReferrerLinks(ctx, reg.driver, repoName, subject)
+	if err != nil {
+		return nil, err
+	}
+	referrers := []v1.Descriptor{}
+	for _, dgst := range links {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		man, err := manifests.Get(ctx, dgst)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				continue
+			}
+			return nil, err
+		}
+		if referrer, ok := referrerDescriptor(dgst, man); ok {
+			referrers = append(referrers, referrer)
+		}
+	}
+	sortReferrers(referrers)
+	return referrers, nil
+}
+
+// referrerDescriptor returns the descriptor of a referrer as listed by the
+// referrers API. ok is false for manifests which cannot be referrers.
+func referrerDescriptor(dgst digest.Digest, man distribution.Manifest) (v1.Descriptor, bool) {
+	switch man.(type) {
+	case *ocischema.DeserializedManifest, *ociartifact.DeserializedManifest, *manifestlist.DeserializedManifestList:
+	default:
+		return v1.Descriptor{}, false
+	}
+	mediaType, payload, err := man.Payload()
+	if err != nil {
+		return v1.Descriptor{}, false
+	}
+	artifactType, annotations := referrerMetadata(man)
+	return v1.Descriptor{
+		MediaType:    mediaType,
+		Size:         int64(len(payload)),
+		Digest:       dgst,
+		ArtifactType: artifactType,
+		Annotations:  annotations,
+	}, true
+}
+
+func sortReferrers(referrers []v1.Descriptor) {
+	sort.Slice(referrers, func(i, j int) bool { return referrers[i].Digest < referrers[j].Digest })
+}
+
+// indexReferrer adds a referrer pushed to this repository to the index of
+// its subject.
+func (repo *repository) indexReferrer(ctx context.Context, subject, dgst digest.Digest, man distribution.Manifest) error {
+	referrer, ok := referrerDescriptor(dgst, man)
+	if !ok {
+		return nil
+	}
+	return repo.updateReferrersIndex(ctx, subject, func(referrers []v1.Descriptor) []v1.Descriptor {
+		for i := range referrers {
+			if referrers[i].Digest == dgst {
+				referrers[i] = referrer
+				return referrers
+			}
+		}
+		referrers = append(referrers, referrer)
+		sortReferrers(referrers)
+		return referrers
+	})
+}
+
+// unindexReferrer removes a referrer deleted from this repository from the
+// index of its subject.
+func (repo *repository) unindexReferrer(ctx context.Context, subject, dgst digest.Digest) error {
+	return repo.updateReferrersIndex(ctx, subject, func(referrers []v1.Descriptor) []v1.Descriptor {
+		for i := range referrers {
+			if referrers[i].Digest == dgst {
+				return append(referrers[:i], referrers[i+1:]...)
+			}
+		}
+		return referrers
+	})
+}
+
+// updateReferrersIndex applies update to the index of subject, if it
+// exists. Missing indexes are left to be built by the next query, and an
+// index which cannot be updated is deleted for the same. Without referrers
+// indexes, the index of subject is deleted too, so that it does not go
+// stale while they are disabled.
+func (repo *repository) updateReferrersIndex(ctx context.Context, subject digest.Digest, update func([]v1.Descriptor) []v1.Descriptor) error {
+	repoName := repo.name.Name()
+	if repo.referrersIndex == nil {
+		return deleteReferrersIndex(ctx, repo.driver, repoName, subject)
+	}
+	repo.referrersIndex.mu.Lock()
+	defer repo.referrersIndex.mu.Unlock()
+
+	referrers, found, err := readReferrersIndex(ctx, repo.driver, repoName, subject)
+	if err == nil && !found {
+		return nil
+	}
+	if err == nil {
+		err = writeReferrersIndex(ctx, repo.driver, repoName, subject, update(referrers))
+	}
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error updating referrers index of %s: %v", subject, err)
+		return deleteReferrersIndex(ctx, repo.driver, repoName, subject)
+	}
+	return nil
+}
+
+// readReferrersIndex reads the index of subject. found is false if it has
+// not been built.
+func readReferrersIndex(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject digest.Digest) (referrers []v1.Descriptor, found bool, err error) {
+	indexPath, err := pathFor(referrersIndexPathSpec{name: repoName, subjectRevision: subject})
+	if err != nil {
+		return nil, false, err
+	}
+	content, err := storageDriver.GetContent(ctx, indexPath)
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	var index referrersIndexFile
+	if err := json.Unmarshal(content, &index); err != nil {
+		// A corrupt index is built again.
+		dcontext.GetLogger(ctx).Errorf("error reading referrers index of %s: %v", subject, err)
+		return nil, false, nil
+	}
+	if index.Referrers == nil {
+		index.Referrers = []v1.Descriptor{}
+	}
+	return index.Referrers, true, nil
+}
+
+func writeReferrersIndex(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject digest.Digest, referrers []v1.Descriptor) error {
+	indexPath, err := pathFor(referrersIndexPathSpec{name: repoName, subjectRevision: subject})
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(referrersIndexFile{Referrers: referrers})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.PutContent(ctx, indexPath, content); err != nil {
+		return fmt.Errorf("failed to write referrers index of %s: %v", subject, err)
+	}
+	return nil
+}
+
+// deleteReferrersIndex deletes the index of subject, so that the next query
+// builds it again.
+func deleteReferrersIndex(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject digest.Digest) error {
+	indexPath, err := pathFor(referrersIndexPathSpec{name: repoName, subjectRevision: subject})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.Delete(ctx, indexPath); err != nil && !errors.Is(err, driver.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// deleteReferrersIndexes deletes the referrers indexes of a repository.
+func deleteReferrersIndexes(ctx context.Context, storageDriver driver.StorageDriver, repoName string) error {
+	indexesPath, err := pathFor(referrersIndexesPathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+	if err := storageDriver.Delete(ctx, indexesPath); err != nil && !errors.Is(err, driver.ErrNotFound) {
+		return err
+	}
+	return nil
+}
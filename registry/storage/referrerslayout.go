@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// artifactTypeHashLength is the number of hex characters of the hash naming
+// the directory of an artifact type, short enough to keep referrer link
+// paths within the limits of storage backends.
+const artifactTypeHashLength = 32
+
+// artifactTypeHash returns the name of the directory of the referrer links
+// of artifactType.
+func artifactTypeHash(artifactType string) string {
+	return digest.FromString(artifactType).Encoded()[:artifactTypeHashLength]
+}
+
+// PartitionReferrerLinks is a functional option for NewRegistry. It links
+// referrers in the directory of their artifact type, under the directory
+// of their subject, so that referrers queries filtered by artifact type
+// only read the manifests of the matching referrers. Links of the
+// unpartitioned layout are still read until MigrateReferrerLinks moves
+// them.
+func PartitionReferrerLinks(registry *registry) error {
+	registry.partitionedReferrerLinks = true
+	return nil
+}
+
+// linkReferrer links revision, of artifactType, as a referrer of subject, in
+// the layout of the registry.
+func (repo *repository) linkReferrer(ctx context.Context, subject, revision digest.Digest, artifactType string) error {
+	if !repo.partitionedReferrerLinks {
+		return indexWithSubject(ctx, repo.name.Name(), revision, subject, repo.driver)
+	}
+	linkPath, err := pathFor(referrersTypedLinkPathSpec{name: repo.name.Name(), revision: revision, subjectRevision: subject, artifactType: artifactType})
+	if err != nil {
+		return fmt.Errorf("failed to generate referrers link path for %v", revision)
+	}
+	return repo.driver.PutContent(ctx, linkPath, []byte(revision.String()))
+}
+
+// deleteReferrerLinks deletes the links of referrer to subject in either
+// layout, returning the directories deleted.
+func deleteReferrerLinks(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject, referrer digest.Digest) ([]string, error) {
+	linkPath, err := pathFor(referrersLinkPathSpec{name: repoName, revision: referrer, subjectRevision: subject})
+	if err != nil {
+		return nil, err
+	}
+	typesPath, err := pathFor(referrersTypesPathSpec{name: repoName, subjectRevision: subject})
+	if err != nil {
+		return nil, err
+	}
+	typePaths, err := storageDriver.List(ctx, typesPath)
+	if err != nil && !errors.Is(err, driver.ErrNotFound) {
+		return nil, err
+	}
+	revisionComponents, err := digestPathComponents(referrer, false)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{path.Dir(linkPath)}
+	for _, typePath := range typePaths {
+		dirs = append(dirs, path.Join(append([]string{typePath}, revisionComponents...)...))
+	}
+	var deleted []string
+	for _, dir := range dirs {
+		if err := storageDriver.Delete(ctx, dir); err != nil {
+			if errors.Is(err, driver.ErrNotFound) {
+				continue
+			}
+			return deleted, err
+		}
+		deleted = append(deleted, dir)
+	}
+	return deleted, nil
+}
+
+// isTypedReferrerLink reports whether linkPath is the path of a referrer
+// link in the directory of its artifact type.
+func isTypedReferrerLink(linkPath string) bool {
+	return path.Base(path.Dir(path.Dir(path.Dir(path.Dir(linkPath))))) == "types"
+}
+
+// ReferrerLinksOfTypes returns the digests of the manifests linked as
+// referrers of subject in the named repository, as ReferrerLinks does,
+// leaving out those known not to be of one of artifactTypes. The referrers
+// are known by their artifact type if namespace partitions referrer links,
+// and they were linked since.
+func ReferrerLinksOfTypes(ctx context.Context, storageDriver driver.StorageDriver, namespace distribution.Namespace, repoName string, subject digest.Digest, artifactTypes []string) ([]digest.Digest, error) {
+	if reg, ok := namespace.(*registry); ok && reg.partitionedReferrerLinks && len(artifactTypes) > 0 {
+		return walkReferrerLinksOfTypes(ctx, storageDriver, repoName, subject, artifactTypes)
+	}
+	return ReferrerLinks(ctx, storageDriver, namespace, repoName, subject)
+}
+
+// walkReferrerLinksOfTypes reads the referrer links of subject in the
+// directories of artifactTypes, along with those of the unpartitioned
+// layout, whose artifact types are unknown.
+func walkReferrerLinksOfTypes(ctx context.Context, storageDriver driver.StorageDriver, repoName string, subject digest.Digest, artifactTypes []string) ([]digest.Digest, error) {
+	subjectPath, err := pathFor(referrersSubjectPathSpec{name: repoName, subjectRevision: subject})
+	if err != nil {
+		return nil, err
+	}
+	typesPath, err := pathFor(referrersTypesPathSpec{name: repoName, subjectRevision: subject})
+	if err != nil {
+		return nil, err
+	}
+	children, err := storageDriver.List(ctx, subjectPath)
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var roots []string
+	for _, child := range children {
+		if child != typesPath {
+			roots = append(roots, child)
+		}
+	}
+	seenTypes := make(map[string]struct{}, len(artifactTypes))
+	for _, artifactType := range artifactTypes {
+		if _, ok := seenTypes[artifactType]; ok {
+			continue
+		}
+		seenTypes[artifactType] = struct{}{}
+		typePath, err := pathFor(referrersTypePathSpec{name: repoName, subjectRevision: subject, artifactType: artifactType})
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, typePath)
+	}
+
+	var links []digest.Digest
+	for _, root := range roots {
+		rootLinks, err := walkLinkFiles(ctx, storageDriver, root)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, rootLinks...)
+	}
+	return links, nil
+}
+
+// ReferrerLinksMigration summarizes what MigrateReferrerLinks did.
+type ReferrerLinksMigration struct {
+	Repositories int `json:"repositories"`
+	Migrated     int `json:"migrated"`
+	// Skipped counts the links to referrers which no longer exist, left
+	// for the garbage collection to delete.
+	Skipped int `json:"skipped"`
+}
+
+// MigrateReferrerLinks moves the referrer links of the named repositories,
+// or of every repository if none is named, from the unpartitioned layout to
+// the directories of their artifact types, where PartitionReferrerLinks
+// links referrers. Each link is written to its new path before it is
+// deleted from the old one, so that referrers stay listed throughout. With
+// dryRun, the links are counted without being moved.
+func MigrateReferrerLinks(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, dryRun bool, repoNames ...string) (ReferrerLinksMigration, error) {
+	var migration ReferrerLinksMigration
+	migrate := func(repoName string) error {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+		manifests, err := repository.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+
+		// The links are moved once walked, so that the walk does not
+		// run into the links it writes.
+		var links []referrerLink
+		err = walkReferrerLinks(ctx, storageDriver, repoName, func(linkPath string, subject, referrer digest.Digest) error {
+			if !isTypedReferrerLink(linkPath) {
+				links = append(links, referrerLink{path: linkPath, subject: subject, referrer: referrer})
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to walk referrer links of %s: %v", repoName, err)
+		}
+
+		migration.Repositories++
+		for _, link := range links {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			man, err := manifests.Get(ctx, link.referrer)
+			if err != nil {
+				if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+					migration.Skipped++
+					continue
+				}
+				return fmt.Errorf("failed to get referrer %s of %s: %v", link.referrer, repoName, err)
+			}
+			migration.Migrated++
+			if dryRun {
+				continue
+			}
+			artifactType, _ := referrerMetadata(man)
+			typedPath, err := pathFor(referrersTypedLinkPathSpec{name: repoName, revision: link.referrer, subjectRevision: link.subject, artifactType: artifactType})
+			if err != nil {
+				return err
+			}
+			dcontext.GetLogger(ctx).Infof("moving referrer link %s to %s", link.path, typedPath)
+			if err := storageDriver.PutContent(ctx, typedPath, []byte(link.referrer.String())); err != nil {
+				return err
+			}
+			if err := storageDriver.Delete(ctx, path.Dir(link.path)); err != nil && !errors.Is(err, driver.ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(repoNames) > 0 {
+		for _, repoName := range repoNames {
+			if err := migrate(repoName); err != nil {
+				return migration, err
+			}
+		}
+		return migration, nil
+	}
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return migration, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+	err := repositoryEnumerator.Enumerate(ctx, migrate)
+	return migration, err
+}
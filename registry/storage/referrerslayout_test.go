@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPartitionedReferrerLinks(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	// Referrers pushed before the layout changed stay in the v1 layout.
+	unpartitioned := createRegistry(t, driver)
+	partitioned := createRegistry(t, driver, PartitionReferrerLinks)
+	repo := makeRepository(t, partitioned, "partitioned")
+	subject := uploadRandomOCIImage(t, repo, nil)
+
+	pushReferrer := func(registry distribution.Namespace, artifactType string) digest.Digest {
+		t.Helper()
+		repo := makeRepository(t, registry, "partitioned")
+		builder := ocischema.NewManifestBuilder(repo.Blobs(ctx), []byte("{}"), &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+		}, nil)
+		builder.(*ocischema.Builder).SetArtifactType(artifactType)
+		referrer, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatalf("failed to build referrer: %v", err)
+		}
+		dgst, err := makeManifestService(t, repo).Put(ctx, referrer)
+		if err != nil {
+			t.Fatalf("failed to put referrer: %v", err)
+		}
+		return dgst
+	}
+	checkLinks := func(artifactTypes []string, want ...digest.Digest) {
+		t.Helper()
+		links, err := ReferrerLinksOfTypes(ctx, driver, partitioned, "partitioned", subject.manifestDigest, artifactTypes)
+		if err != nil {
+			t.Fatalf("failed to list referrer links: %v", err)
+		}
+		sort.Slice(links, func(i, j int) bool { return links[i] < links[j] })
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		if len(links) != len(want) {
+			t.Fatalf("unexpected referrer links %v of %v, want %v", links, artifactTypes, want)
+		}
+		for i := range want {
+			if links[i] != want[i] {
+				t.Fatalf("unexpected referrer links %v of %v, want %v", links, artifactTypes, want)
+			}
+		}
+	}
+	checkReferrers := func(artifactType string, want ...digest.Digest) {
+		t.Helper()
+		referrers, err := repo.(distribution.ReferrersLister).Referrers(ctx, subject.manifestDigest, artifactType)
+		if err != nil {
+			t.Fatalf("failed to list referrers: %v", err)
+		}
+		if len(referrers) != len(want) {
+			t.Fatalf("listed %d referrers of type %s, want %d", len(referrers), artifactType, len(want))
+		}
+		sort.Slice(referrers, func(i, j int) bool { return referrers[i].Digest < referrers[j].Digest })
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		for i := range want {
+			if referrers[i].Digest != want[i] {
+				t.Fatalf("unexpected referrer %s of type %s, want %s", referrers[i].Digest, artifactType, want[i])
+			}
+		}
+	}
+
+	legacy := pushReferrer(unpartitioned, "application/vnd.example.attestation")
+	signature := pushReferrer(partitioned, "application/vnd.example.signature")
+	sbom := pushReferrer(partitioned, "application/vnd.example.sbom")
+
+	linkPath, err := pathFor(referrersTypedLinkPathSpec{name: "partitioned", revision: signature, subjectRevision: subject.manifestDigest, artifactType: "application/vnd.example.signature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Stat(ctx, linkPath); err != nil {
+		t.Fatalf("missing partitioned referrer link: %v", err)
+	}
+
+	// Filtered listings leave out the referrers of other types, but not
+	// those linked in the v1 layout.
+	checkLinks(nil, legacy, signature, sbom)
+	checkLinks([]string{"application/vnd.example.signature"}, legacy, signature)
+	checkLinks([]string{"application/vnd.example.sbom", "application/vnd.example.sbom"}, legacy, sbom)
+	checkReferrers("application/vnd.example.signature", signature)
+
+	// Referrers are unlinked from either layout.
+	if err := makeManifestService(t, repo).Delete(ctx, signature); err != nil {
+		t.Fatalf("failed to delete referrer: %v", err)
+	}
+	checkLinks(nil, legacy, sbom)
+
+	// Garbage collection finds the subject of partitioned links.
+	var subjects []digest.Digest
+	err = walkReferrerLinks(ctx, driver, "partitioned", func(linkPath string, subject, referrer digest.Digest) error {
+		subjects = append(subjects, subject)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk referrer links: %v", err)
+	}
+	if len(subjects) != 2 || subjects[0] != subject.manifestDigest || subjects[1] != subject.manifestDigest {
+		t.Fatalf("unexpected subjects %v", subjects)
+	}
+
+	migration, err := MigrateReferrerLinks(ctx, driver, partitioned, true)
+	if err != nil {
+		t.Fatalf("failed to count referrer links to migrate: %v", err)
+	}
+	if migration.Repositories != 1 || migration.Migrated != 1 || migration.Skipped != 0 {
+		t.Fatalf("unexpected dry run %+v", migration)
+	}
+	checkLinks([]string{"application/vnd.example.signature"}, legacy)
+
+	migration, err = MigrateReferrerLinks(ctx, driver, partitioned, false, "partitioned")
+	if err != nil {
+		t.Fatalf("failed to migrate referrer links: %v", err)
+	}
+	if migration.Repositories != 1 || migration.Migrated != 1 {
+		t.Fatalf("unexpected migration %+v", migration)
+	}
+	checkLinks([]string{"application/vnd.example.signature"})
+	checkLinks([]string{"application/vnd.example.sbom"}, sbom)
+	checkLinks([]string{"application/vnd.example.attestation"}, legacy)
+	checkReferrers("application/vnd.example.attestation", legacy)
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// MaxReferrersPerSubject is a functional option for NewRegistry. It refuses
+// the manifests pushed with a subject which already has max referrers in
+// the repository, so that the referrers of a subject stay cheap to list.
+func MaxReferrersPerSubject(max int) RegistryOption {
+	return func(registry *registry) error {
+		if max < 0 {
+			return fmt.Errorf("invalid maximum number of referrers per subject %d", max)
+		}
+		registry.maxReferrersPerSubject = max
+		return nil
+	}
+}
+
+// verifyReferrersLimit returns an ErrManifestVerification if the manifest
+// dgst may not be linked as a referrer of subject without exceeding the
+// maximum number of referrers of a subject. Manifests already linked are
+// accepted again, and links to manifests which no longer exist are not
+// counted.
+func (repo *repository) verifyReferrersLimit(ctx context.Context, subject, dgst digest.Digest) error {
+	max := repo.maxReferrersPerSubject
+	if max == 0 {
+		return nil
+	}
+
+	links, err := repo.referrerLinks(ctx, subject)
+	if err != nil {
+		return err
+	}
+	if len(links) < max {
+		return nil
+	}
+	count := 0
+	for _, link := range links {
+		if link == dgst {
+			return nil
+		}
+		if _, err := revisionLinkTime(ctx, repo.driver, repo.name.Name(), link); err != nil {
+			if errors.Is(err, driver.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		count++
+	}
+	if count < max {
+		return nil
+	}
+	return distribution.ErrManifestVerification{
+		distribution.ErrReferrersLimitExceeded{Subject: subject, Limit: max},
+	}
+}
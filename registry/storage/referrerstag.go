@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// referrersTagSchema maintains the referrers tags of subjects.
+type referrersTagSchema struct {
+	// mu serializes the updates of the tags by this instance.
+	mu sync.Mutex
+}
+
+// EnableReferrersTagSchema is a functional option for NewRegistry. It
+// maintains, for each subject with referrers, the tag of the referrers tag
+// schema of the OCI distribution specification, pointing at an image index
+// listing the referrers, for clients which predate the referrers API.
+func EnableReferrersTagSchema(registry *registry) error {
+	registry.referrersTagSchema = &referrersTagSchema{}
+	return nil
+}
+
+// ReferrersTag returns the tag of the referrers of subject in the referrers
+// tag schema: its algorithm and encoded digest, truncated to 32 and 64
+// characters, joined with a dash.
+func ReferrersTag(subject digest.Digest) string {
+	algorithm, encoded := subject.Algorithm().String(), subject.Encoded()
+	if len(algorithm) > 32 {
+		algorithm = algorithm[:32]
+	}
+	if len(encoded) > 64 {
+		encoded = encoded[:64]
+	}
+	return algorithm + "-" + encoded
+}
+
+// tagReferrers updates the referrers tag of subject, once one of its
+// referrers is pushed or deleted.
+func (repo *repository) tagReferrers(ctx context.Context, subject digest.Digest) error {
+	if repo.referrersTagSchema == nil {
+		return nil
+	}
+	repo.referrersTagSchema.mu.Lock()
+	defer repo.referrersTagSchema.mu.Unlock()
+	return updateReferrersTag(ctx, repo, subject)
+}
+
+// updateReferrersTag points the referrers tag of subject at an image index
+// listing its referrers, or deletes it if there are none left.
+func updateReferrersTag(ctx context.Context, repo *repository, subject digest.Digest) error {
+	referrers, err := buildReferrersIndex(ctx, repo.registry, repo.name.Name(), subject)
+	if err != nil {
+		return err
+	}
+	tag := ReferrersTag(subject)
+	tags := repo.Tags(ctx)
+	if len(referrers) == 0 {
+		if err := tags.Untag(ctx, tag); err != nil && !errors.Is(err, driver.ErrNotFound) {
+			return fmt.Errorf("failed to delete referrers tag %s: %v", tag, err)
+		}
+		return nil
+	}
+
+	payload, err := json.Marshal(v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: referrers,
+	})
+	if err != nil {
+		return err
+	}
+	index := new(manifestlist.DeserializedManifestList)
+	if err := index.UnmarshalJSON(payload); err != nil {
+		return err
+	}
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	dgst, err := manifests.Put(ctx, index)
+	if err != nil {
+		return fmt.Errorf("failed to put referrers index of %s: %v", subject, err)
+	}
+	desc := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageIndex,
+		Size:      int64(len(payload)),
+		Digest:    dgst,
+	}
+	if err := tags.Tag(ctx, tag, desc); err != nil {
+		return fmt.Errorf("failed to tag referrers index of %s: %v", subject, err)
+	}
+	return nil
+}
+
+// refreshReferrersTags updates the referrers tags of subjects which exist,
+// after garbage collection deleted some of their referrers or the subjects
+// themselves. subjects maps repository names to the subjects to refresh.
+func refreshReferrersTags(ctx context.Context, registry distribution.Namespace, subjects map[string]map[digest.Digest]struct{}) error {
+	for repoName, dgsts := range subjects {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return err
+		}
+		r, err := registry.Repository(ctx, named)
+		if err != nil {
+			return err
+		}
+		repo, ok := r.(*repository)
+		if !ok {
+			return nil
+		}
+		for subject := range dgsts {
+			if _, err := repo.Tags(ctx).Get(ctx, ReferrersTag(subject)); err != nil {
+				if _, ok := err.(distribution.ErrTagUnknown); ok {
+					continue
+				}
+				return err
+			}
+			dcontext.GetLogger(ctx).Infof("updating referrers tag of %s@%s", repoName, subject)
+			if err := updateReferrersTag(ctx, repo, subject); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
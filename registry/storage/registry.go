@@ -24,6 +24,15 @@ type registry struct {
 	schema1SigningKey            libtrust.PrivateKey
 	blobDescriptorServiceFactory distribution.BlobDescriptorServiceFactory
 	manifestURLs                 manifestURLs
+	artifactClasses              artifactClassPolicy
+	referenceIndex               bool
+	referrerLinkCache            *referrerLinkCache
+	referrersIndex               *referrersIndex
+	referrersTagSchema           *referrersTagSchema
+	globalReferrersIndex         bool
+	maxReferrersPerSubject       int
+	partitionedReferrerLinks     bool
+	hasher                       hasher
 	driver                       storagedriver.StorageDriver
 }
 
@@ -185,8 +194,10 @@ func (reg *registry) Blobs() distribution.BlobEnumerator {
 	return reg.blobStore
 }
 
+// BlobStatter returns the global statter, backed by the blob descriptor
+// cache if one is configured.
 func (reg *registry) BlobStatter() distribution.BlobStatter {
-	return reg.statter
+	return reg.blobStore.statter
 }
 
 // repository provides name-scoped access to various services.
@@ -278,9 +289,10 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 			manifestURLs: repo.registry.manifestURLs,
 		},
 		manifestListHandler: &manifestListHandler{
-			ctx:        ctx,
-			repository: repo,
-			blobStore:  blobStore,
+			ctx:           ctx,
+			repository:    repo,
+			blobStore:     blobStore,
+			storageDriver: repo.driver,
 		},
 		ocischemaHandler: &ocischemaManifestHandler{
 			ctx:           ctx,
@@ -340,5 +352,6 @@ func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 		linkDirectoryPathSpec:  layersPathSpec{name: repo.name.Name()},
 		deleteEnabled:          repo.registry.deleteEnabled,
 		resumableDigestEnabled: repo.resumableDigestEnabled,
+		hasher:                 repo.hasher,
 	}
 }
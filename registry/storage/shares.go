@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// UseShareLink records that the pull-once share link id was used, and
+// reports whether it had not been used before. Two pulls racing through
+// different instances may both be reported as the first.
+func UseShareLink(ctx context.Context, storageDriver driver.StorageDriver, id string) (bool, error) {
+	usedPath, err := pathFor(shareLinkUsedPathSpec{id: id})
+	if err != nil {
+		return false, err
+	}
+	if _, err := storageDriver.Stat(ctx, usedPath); err == nil {
+		return false, nil
+	} else if !errors.Is(err, driver.ErrNotFound) {
+		return false, err
+	}
+	if err := storageDriver.PutContent(ctx, usedPath, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return false, fmt.Errorf("failed to record share link use: %v", err)
+	}
+	return true, nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"path"
 	"sort"
 
@@ -35,12 +36,10 @@ func (ts *tagStore) All(ctx context.Context) ([]string, error) {
 
 	entries, err := ts.blobStore.driver.List(ctx, pathSpec)
 	if err != nil {
-		switch err := err.(type) {
-		case storagedriver.PathNotFoundError:
+		if errors.Is(err, storagedriver.ErrNotFound) {
 			return tags, distribution.ErrRepositoryUnknown{Name: ts.repository.Named().Name()}
-		default:
-			return tags, err
 		}
+		return tags, err
 	}
 
 	for _, entry := range entries {
@@ -67,6 +66,10 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 		return err
 	}
 
+	if err := fenceDigests(ctx, ts.blobStore.driver, desc.Digest); err != nil {
+		return err
+	}
+
 	lbs := ts.linkedBlobStore(ctx, tag)
 
 	// Link into the index
@@ -91,8 +94,7 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 
 	revision, err := ts.blobStore.readlink(ctx, currentPath)
 	if err != nil {
-		switch err.(type) {
-		case storagedriver.PathNotFoundError:
+		if errors.Is(err, storagedriver.ErrNotFound) {
 			return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
 		}
 
@@ -159,8 +161,7 @@ func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([
 		tagLinkPath, _ := pathFor(tagLinkPathSpec)
 		tagDigest, err := ts.blobStore.readlink(ctx, tagLinkPath)
 		if err != nil {
-			switch err.(type) {
-			case storagedriver.PathNotFoundError:
+			if errors.Is(err, storagedriver.ErrNotFound) {
 				continue
 			}
 			return nil, err
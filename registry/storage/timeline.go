@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// DefaultTimelineEvents is the number of events a timeline keeps by default.
+const DefaultTimelineEvents = 1000
+
+// TimelineAction identifies what a TimelineEvent records.
+type TimelineAction string
+
+const (
+	// TimelinePush records the push of a manifest, by digest or to a tag
+	// which did not exist.
+	TimelinePush TimelineAction = "push"
+	// TimelineTagMove records the push of a manifest to a tag which pointed
+	// at another manifest.
+	TimelineTagMove TimelineAction = "tag.move"
+	// TimelineDelete records the deletion of a manifest or tag through the
+	// API.
+	TimelineDelete TimelineAction = "delete"
+	// TimelineGCDelete records the deletion of a manifest, or of a tag
+	// pointing at it, by garbage collection.
+	TimelineGCDelete TimelineAction = "gc.delete"
+	// TimelineRejected records a push or deletion refused by a policy of
+	// the registry.
+	TimelineRejected TimelineAction = "rejected"
+)
+
+// TimelineEvent is a significant event in the history of a repository.
+type TimelineEvent struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Action    TimelineAction `json:"action"`
+	Digest    digest.Digest  `json:"digest,omitempty"`
+	Tag       string         `json:"tag,omitempty"`
+	// Previous is the manifest a moved tag pointed at.
+	Previous digest.Digest `json:"previous,omitempty"`
+	// Actor is the authenticated user which made the request, if any.
+	Actor string `json:"actor,omitempty"`
+	// Reason is why a request was rejected.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Timeline records the recent events of repositories in the storage, so
+// that users can find out what happened to their tags without access to the
+// logs of the registry. Each repository keeps its most recent events, up to
+// a maximum. Events recorded concurrently by several registry instances may
+// be lost, as the timeline of a repository is rewritten with each event.
+type Timeline struct {
+	driver    driver.StorageDriver
+	maxEvents int
+
+	mu sync.Mutex
+	// locks serialize the events recorded to each repository, so that
+	// repositories do not wait on each other.
+	locks map[string]*timelineLock
+}
+
+// timelineLock serializes the events recorded to a repository. users counts
+// the callers holding or waiting for it, so that it is dropped once idle.
+type timelineLock struct {
+	sync.Mutex
+	users int
+}
+
+// NewTimeline returns a timeline keeping maxEvents events for each
+// repository, or DefaultTimelineEvents if maxEvents is not positive.
+func NewTimeline(storageDriver driver.StorageDriver, maxEvents int) *Timeline {
+	if maxEvents <= 0 {
+		maxEvents = DefaultTimelineEvents
+	}
+	return &Timeline{
+		driver:    storageDriver,
+		maxEvents: maxEvents,
+		locks:     make(map[string]*timelineLock),
+	}
+}
+
+// lock locks the timeline of the named repository, and returns the function
+// unlocking it.
+func (t *Timeline) lock(repoName string) func() {
+	t.mu.Lock()
+	l, ok := t.locks[repoName]
+	if !ok {
+		l = &timelineLock{}
+		t.locks[repoName] = l
+	}
+	l.users++
+	t.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		t.mu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(t.locks, repoName)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Record appends events to the timeline of the named repository, dropping
+// its oldest events beyond the maximum.
+func (t *Timeline) Record(ctx context.Context, repoName string, events ...TimelineEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	defer t.lock(repoName)()
+
+	recorded, err := t.read(ctx, repoName)
+	if err != nil {
+		return err
+	}
+	recorded = append(recorded, events...)
+	if len(recorded) > t.maxEvents {
+		recorded = recorded[len(recorded)-t.maxEvents:]
+	}
+	content, err := json.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	timelinePath, err := pathFor(timelinePathSpec{name: repoName})
+	if err != nil {
+		return err
+	}
+	if err := t.driver.PutContent(ctx, timelinePath, content); err != nil {
+		return fmt.Errorf("failed to write timeline of %s: %v", repoName, err)
+	}
+	return nil
+}
+
+// Events returns up to n events of the timeline of the named repository,
+// most recent first, or all of them if n is not positive. If tag is set,
+// only the events of that tag are returned.
+func (t *Timeline) Events(ctx context.Context, repoName, tag string, n int) ([]TimelineEvent, error) {
+	recorded, err := t.read(ctx, repoName)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]TimelineEvent, 0, len(recorded))
+	for i := len(recorded) - 1; i >= 0 && (n <= 0 || len(events) < n); i-- {
+		if tag != "" && recorded[i].Tag != tag {
+			continue
+		}
+		events = append(events, recorded[i])
+	}
+	return events, nil
+}
+
+// read returns the events of the timeline of the named repository, oldest
+// first.
+func (t *Timeline) read(ctx context.Context, repoName string) ([]TimelineEvent, error) {
+	timelinePath, err := pathFor(timelinePathSpec{name: repoName})
+	if err != nil {
+		return nil, err
+	}
+	content, err := t.driver.GetContent(ctx, timelinePath)
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var events []TimelineEvent
+	if err := json.Unmarshal(content, &events); err != nil {
+		return nil, fmt.Errorf("invalid timeline of %s: %v", repoName, err)
+	}
+	return events, nil
+}
+
+// recordGCTimeline records the manifests deleted by garbage collection, and
+// the tags deleted along with them, in the timelines of their repositories.
+// Failures are logged, as the deletions are made.
+func recordGCTimeline(ctx context.Context, timeline *Timeline, deleted []ManifestDel) {
+	now := time.Now().UTC()
+	var repoNames []string
+	events := make(map[string][]TimelineEvent)
+	for _, obj := range deleted {
+		if _, ok := events[obj.Name]; !ok {
+			repoNames = append(repoNames, obj.Name)
+		}
+		events[obj.Name] = append(events[obj.Name], TimelineEvent{Timestamp: now, Action: TimelineGCDelete, Digest: obj.Digest})
+		for _, tag := range obj.Untag {
+			events[obj.Name] = append(events[obj.Name], TimelineEvent{Timestamp: now, Action: TimelineGCDelete, Digest: obj.Digest, Tag: tag})
+		}
+	}
+	for _, repoName := range repoNames {
+		if err := timeline.Record(ctx, repoName, events[repoName]...); err != nil {
+			dcontext.GetLogger(ctx).Warnf("failed to record garbage collection in the timeline of %s: %v", repoName, err)
+		}
+	}
+}
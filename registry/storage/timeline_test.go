@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestTimeline(t *testing.T) {
+	ctx := context.Background()
+	timeline := NewTimeline(inmemory.New(), 3)
+
+	events, err := timeline.Events(ctx, "foo/bar", "", 0)
+	if err != nil {
+		t.Fatalf("failed to read an empty timeline: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("unexpected events in an empty timeline: %v", events)
+	}
+
+	first, second := digest.FromString("first"), digest.FromString("second")
+	recorded := []TimelineEvent{
+		{Action: TimelinePush, Digest: first, Tag: "latest"},
+		{Action: TimelinePush, Digest: first, Tag: "v1"},
+		{Action: TimelineTagMove, Digest: second, Tag: "latest", Previous: first},
+		{Action: TimelineDelete, Digest: first, Tag: "v1"},
+	}
+	for _, event := range recorded {
+		if err := timeline.Record(ctx, "foo/bar", event); err != nil {
+			t.Fatalf("failed to record event: %v", err)
+		}
+	}
+
+	// The oldest event is dropped beyond the maximum.
+	events, err = timeline.Events(ctx, "foo/bar", "", 0)
+	if err != nil {
+		t.Fatalf("failed to read timeline: %v", err)
+	}
+	expected := []TimelineEvent{recorded[3], recorded[2], recorded[1]}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("unexpected events: %+v, expected %+v", events, expected)
+	}
+
+	events, err = timeline.Events(ctx, "foo/bar", "v1", 1)
+	if err != nil {
+		t.Fatalf("failed to read timeline: %v", err)
+	}
+	if !reflect.DeepEqual(events, []TimelineEvent{recorded[3]}) {
+		t.Fatalf("unexpected events of the tag: %+v", events)
+	}
+
+	// Timelines are kept for each repository.
+	events, err = timeline.Events(ctx, "foo/baz", "", 0)
+	if err != nil {
+		t.Fatalf("failed to read timeline: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("unexpected events in the timeline of another repository: %v", events)
+	}
+}
+
+func TestTimelineConcurrent(t *testing.T) {
+	ctx := context.Background()
+	timeline := NewTimeline(inmemory.New(), 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			repoName := []string{"foo/bar", "foo/baz"}[i%2]
+			if err := timeline.Record(ctx, repoName, TimelineEvent{Action: TimelinePush, Digest: digest.FromString(repoName)}); err != nil {
+				t.Errorf("failed to record event: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, repoName := range []string{"foo/bar", "foo/baz"} {
+		events, err := timeline.Events(ctx, repoName, "", 0)
+		if err != nil {
+			t.Fatalf("failed to read timeline: %v", err)
+		}
+		if len(events) != 10 {
+			t.Errorf("unexpected number of events of %s: %d", repoName, len(events))
+		}
+	}
+	if len(timeline.locks) != 0 {
+		t.Errorf("idle repository locks were kept: %v", timeline.locks)
+	}
+}
+
+func TestGCTimeline(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "timeline")
+
+	expired := uploadRandomOCIImage(t, repo, map[string]string{
+		AnnotationExpires: time.Now().Add(-time.Hour).Format(time.RFC3339),
+	})
+	if err := repo.Tags(ctx).Tag(ctx, "expired", distribution.Descriptor{Digest: expired.manifestDigest}); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	timeline := NewTimeline(inmemoryDriver, 0)
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:        true,
+		RemoveExpired: true,
+		Timeline:      timeline,
+	}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	events, err := timeline.Events(ctx, "timeline", "", 0)
+	if err != nil {
+		t.Fatalf("failed to read timeline: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("dry run recorded events: %+v", events)
+	}
+
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveExpired: true,
+		Timeline:      timeline,
+	}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	events, err = timeline.Events(ctx, "timeline", "", 0)
+	if err != nil {
+		t.Fatalf("failed to read timeline: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	for _, event := range events {
+		if event.Action != TimelineGCDelete || event.Digest != expired.manifestDigest {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	}
+	if events[0].Tag != "expired" || events[1].Tag != "" {
+		t.Errorf("unexpected events of the manifest and its tag: %+v", events)
+	}
+}
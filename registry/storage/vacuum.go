@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"path"
 
 	dcontext "github.com/distribution/distribution/v3/context"
@@ -26,6 +27,15 @@ func NewVacuum(ctx context.Context, driver driver.StorageDriver) Vacuum {
 type Vacuum struct {
 	driver driver.StorageDriver
 	ctx    context.Context
+	// events, if set, receives an event for each removed path.
+	events gcEmitter
+}
+
+// removed reports the removal of a path to the garbage collection events.
+func (v Vacuum) removed(repoName string, dgst digest.Digest, p string) {
+	if v.events != nil {
+		v.events.emit(GCEvent{Kind: GCEventDelete, Repository: repoName, Digest: dgst, Path: p}, "deleted %s", p)
+	}
 }
 
 // RemoveBlob removes a blob from the filesystem
@@ -47,6 +57,7 @@ func (v Vacuum) RemoveBlob(dgst string) error {
 		return err
 	}
 
+	v.removed("", d, blobPath)
 	return nil
 }
 
@@ -62,18 +73,17 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 
 		_, err = v.driver.Stat(v.ctx, tagsPath)
 		if err != nil {
-			switch err := err.(type) {
-			case driver.PathNotFoundError:
+			if errors.Is(err, driver.ErrNotFound) {
 				continue
-			default:
-				return err
 			}
+			return err
 		}
 		dcontext.GetLogger(v.ctx).Infof("deleting manifest tag reference: %s", tagsPath)
 		err = v.driver.Delete(v.ctx, tagsPath)
 		if err != nil {
 			return err
 		}
+		v.removed(name, dgst, tagsPath)
 	}
 
 	manifestPath, err := pathFor(manifestRevisionPathSpec{name: name, revision: dgst})
@@ -81,7 +91,31 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 		return err
 	}
 	dcontext.GetLogger(v.ctx).Infof("deleting manifest: %s", manifestPath)
-	return v.driver.Delete(v.ctx, manifestPath)
+	if err := v.driver.Delete(v.ctx, manifestPath); err != nil {
+		return err
+	}
+	v.removed(name, dgst, manifestPath)
+	// The manifest may be listed by referrers indexes, which are built
+	// again by the next queries.
+	return deleteReferrersIndexes(v.ctx, v.driver, name)
+}
+
+// RemoveTag removes a tag, including its index of previous revisions, from
+// the filesystem
+func (v Vacuum) RemoveTag(name, tag string) error {
+	tagPath, err := pathFor(manifestTagPathSpec{name: name, tag: tag})
+	if err != nil {
+		return err
+	}
+	dcontext.GetLogger(v.ctx).Infof("deleting tag: %s", tagPath)
+	err = v.driver.Delete(v.ctx, tagPath)
+	switch {
+	case err == nil:
+		v.removed(name, "", tagPath)
+	case errors.Is(err, driver.ErrNotFound):
+		return nil
+	}
+	return err
 }
 
 // RemoveRepository removes a repository directory from the
@@ -98,5 +132,43 @@ func (v Vacuum) RemoveRepository(repoName string) error {
 		return err
 	}
 
+	v.removed(repoName, "", repoDir)
+	return nil
+}
+
+// RemoveLayerLink removes the link of a blob into a repository, leaving the
+// blob itself in place.
+func (v Vacuum) RemoveLayerLink(name string, dgst digest.Digest) error {
+	linkPath, err := pathFor(layerLinkPathSpec{name: name, digest: dgst})
+	if err != nil {
+		return err
+	}
+	linkDir := path.Dir(linkPath)
+	dcontext.GetLogger(v.ctx).Infof("deleting layer link: %s", linkDir)
+	if err := v.driver.Delete(v.ctx, linkDir); err != nil {
+		return err
+	}
+	v.removed(name, dgst, linkDir)
 	return nil
 }
+
+// RemoveReferrerLink removes the link of a referrer from the referrers of
+// its subject.
+func (v Vacuum) RemoveReferrerLink(name string, subject, referrer digest.Digest) error {
+	linkDirs, err := deleteReferrerLinks(v.ctx, v.driver, name, subject, referrer)
+	for _, linkDir := range linkDirs {
+		dcontext.GetLogger(v.ctx).Infof("deleted referrer link: %s", linkDir)
+		v.removed(name, referrer, linkDir)
+	}
+	if err != nil {
+		return err
+	}
+	if len(linkDirs) == 0 {
+		linkPath, err := pathFor(referrersLinkPathSpec{name: name, revision: referrer, subjectRevision: subject})
+		if err != nil {
+			return err
+		}
+		return driver.PathNotFoundError{Path: path.Dir(linkPath)}
+	}
+	return deleteReferrersIndex(v.ctx, v.driver, name, subject)
+}
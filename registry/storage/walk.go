@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// walkFrom walks root like Walk, calling fn only for the paths after from,
+// or for all of them if from is empty. The directories holding no path after
+// from are skipped without being listed. It relies on the driver walking
+// directories in lexical order, as all the drivers of the registry do.
+func walkFrom(ctx context.Context, storageDriver driver.StorageDriver, root, from string, fn driver.WalkFn) error {
+	if from == "" {
+		return storageDriver.Walk(ctx, root, fn)
+	}
+	return storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+		if fileInfo.IsDir() {
+			if lessPath(filePath, from) && !strings.HasPrefix(from, filePath+"/") {
+				return driver.ErrSkipDir
+			}
+		} else if !lessPath(from, filePath) {
+			return nil
+		}
+		return fn(fileInfo)
+	})
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+// flakyDriver fails the first listing of a directory under failPrefix.
+type flakyDriver struct {
+	driver.StorageDriver
+	failPrefix string
+	failed     bool
+}
+
+func (d *flakyDriver) List(ctx context.Context, p string) ([]string, error) {
+	if !d.failed && strings.HasPrefix(p, d.failPrefix) {
+		d.failed = true
+		return nil, fmt.Errorf("transient failure listing %s", p)
+	}
+	return d.StorageDriver.List(ctx, p)
+}
+
+func (d *flakyDriver) Walk(ctx context.Context, p string, f driver.WalkFn) error {
+	return driver.WalkFallback(ctx, d, p, f)
+}
+
+func TestEnumerateFrom(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "enumerated")
+	for i := 0; i < 3; i++ {
+		uploadRandomOCIImage(t, repo, nil)
+	}
+
+	enumerator := registry.Blobs().(distribution.ResumableBlobEnumerator)
+	var all []digest.Digest
+	marker, err := enumerator.EnumerateFrom(ctx, "", func(dgst digest.Digest) error {
+		all = append(all, dgst)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to enumerate blobs: %v", err)
+	}
+	if len(all) < 4 || marker != all[len(all)-1].String() {
+		t.Fatalf("unexpected enumeration %v ending at %q", all, marker)
+	}
+	if !sort.SliceIsSorted(all, func(i, j int) bool { return all[i] < all[j] }) {
+		t.Fatalf("blobs not enumerated in order: %v", all)
+	}
+
+	var rest []digest.Digest
+	marker, err = enumerator.EnumerateFrom(ctx, all[1].String(), func(dgst digest.Digest) error {
+		rest = append(rest, dgst)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to resume enumeration: %v", err)
+	}
+	if !reflect.DeepEqual(rest, all[2:]) || marker != all[len(all)-1].String() {
+		t.Fatalf("unexpected resumed enumeration %v, want %v", rest, all[2:])
+	}
+
+	// An error of the ingester returns the marker of the last digest ingested.
+	marker, err = enumerator.EnumerateFrom(ctx, "", func(dgst digest.Digest) error {
+		if dgst == all[2] {
+			return fmt.Errorf("stop")
+		}
+		return nil
+	})
+	if err == nil || marker != all[1].String() {
+		t.Fatalf("unexpected interrupted enumeration ending at %q: %v", marker, err)
+	}
+
+	manifests := makeManifestService(t, repo).(distribution.ResumableManifestEnumerator)
+	var revisions []digest.Digest
+	if _, err := manifests.EnumerateFrom(ctx, "", func(dgst digest.Digest) error {
+		revisions = append(revisions, dgst)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to enumerate manifests: %v", err)
+	}
+	var resumed []digest.Digest
+	if _, err := manifests.EnumerateFrom(ctx, revisions[0].String(), func(dgst digest.Digest) error {
+		resumed = append(resumed, dgst)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to resume manifest enumeration: %v", err)
+	}
+	if len(revisions) != 3 || !reflect.DeepEqual(resumed, revisions[1:]) {
+		t.Fatalf("unexpected resumed manifest enumeration %v of %v", resumed, revisions)
+	}
+}
+
+func TestEnumerateDetailed(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "detailed")
+	uploadRandomOCIImage(t, repo, nil)
+
+	enumerator := registry.Blobs().(distribution.DetailedBlobEnumerator)
+	statter := registry.BlobStatter()
+	var blobs int
+	_, err := enumerator.EnumerateDetailed(ctx, "", func(info distribution.BlobInfo) error {
+		blobs++
+		desc, err := statter.Stat(ctx, info.Digest)
+		if err != nil {
+			return err
+		}
+		if info.Size != desc.Size || info.ModTime.IsZero() {
+			t.Errorf("unexpected details %+v of blob of size %d", info, desc.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to enumerate blobs: %v", err)
+	}
+	if blobs < 4 {
+		t.Fatalf("enumerated %d blobs", blobs)
+	}
+}
+
+func TestMarkAndSweepCancelled(t *testing.T) {
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "cancelled")
+	image := uploadRandomSchema2Image(t, repo)
+	manifests, err := repo.Manifests(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get manifest service: %v", err)
+	}
+	if err := manifests.Delete(context.Background(), image.manifestDigest); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+	before := allBlobs(t, registry)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the collection to be cancelled, got %v", err)
+	}
+	if after := allBlobs(t, registry); !reflect.DeepEqual(before, after) {
+		t.Fatalf("blobs deleted by a cancelled collection")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{Events: func(GCEvent) {}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the collection to time out, got %v", err)
+	}
+	if after := allBlobs(t, registry); !reflect.DeepEqual(before, after) {
+		t.Fatalf("blobs deleted by a collection past its deadline")
+	}
+}
@@ -0,0 +1,186 @@
+// Package tagprotection implements the tag protection rules configured under
+// policy.tagprotection, which restrict the clients allowed to create and move
+// the matching tags.
+package tagprotection
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/ipfilter"
+)
+
+// Rule restricts the clients which may create and move the matching tags.
+type Rule struct {
+	repositories []*regexp.Regexp
+	tags         []string
+	scopes       []scope
+	allow        *ipfilter.Rule
+}
+
+// scope is a token scope allowing clients to create and move tags.
+type scope struct {
+	typ, name, action string
+}
+
+// Rules is a set of tag protection rules.
+type Rules []*Rule
+
+// New parses the tag protection rules of a registry configuration.
+func New(config []configuration.TagProtectionRule) (Rules, error) {
+	rules := make(Rules, 0, len(config))
+	for _, c := range config {
+		rule, err := NewRule(c)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// NewRule parses a single tag protection rule.
+func NewRule(config configuration.TagProtectionRule) (*Rule, error) {
+	if len(config.Tags) == 0 {
+		return nil, fmt.Errorf("tag protection rule without tags")
+	}
+	rule := &Rule{tags: config.Tags}
+	for _, pattern := range config.Tags {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag protection pattern %q: %v", pattern, err)
+		}
+	}
+	for _, expr := range config.Repositories {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag protection repository %q: %v", expr, err)
+		}
+		rule.repositories = append(rule.repositories, re)
+	}
+	for _, s := range config.Scopes {
+		parts := strings.Split(s, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid tag protection scope %q, expected type:name:action", s)
+		}
+		rule.scopes = append(rule.scopes, scope{typ: parts[0], name: parts[1], action: parts[2]})
+	}
+	if len(config.Allow) > 0 {
+		allow, err := ipfilter.NewRule(configuration.NetworkRule{Allow: config.Allow})
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag protection rule: %v", err)
+		}
+		rule.allow = allow
+	}
+	return rule, nil
+}
+
+// Protects returns the pattern matching tag if the rule protects the tags of
+// the named repository.
+func (r *Rule) Protects(repoName, tag string) (string, bool) {
+	if len(r.repositories) > 0 {
+		matched := false
+		for _, re := range r.repositories {
+			if re.MatchString(repoName) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "", false
+		}
+	}
+	for _, pattern := range r.tags {
+		if ok, _ := path.Match(pattern, tag); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// Permits reports whether the client at ip, whose credentials grant the
+// given access, may create and move the protected tags of the named
+// repository.
+func (r *Rule) Permits(repoName string, ip net.IP, granted []auth.Access) bool {
+	if r.allow != nil && ip != nil && r.allow.Allows(ip) {
+		return true
+	}
+	for _, s := range r.scopes {
+		name := s.name
+		if name == "*" {
+			name = repoName
+		}
+		for _, access := range granted {
+			if access.Type == s.typ && access.Name == name && access.Action == s.action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check returns an ErrTagProtected if a rule protecting the tag of the named
+// repository does not permit the client.
+func (rules Rules) Check(repoName, tag string, ip net.IP, granted []auth.Access) error {
+	for _, rule := range rules {
+		if pattern, ok := rule.Protects(repoName, tag); ok && !rule.Permits(repoName, ip, granted) {
+			return distribution.ErrTagProtected{Tag: tag, Pattern: pattern}
+		}
+	}
+	return nil
+}
+
+// Repository returns repository with a tag service enforcing the rules for
+// the client at ip, whose access is read from the context of the calls.
+// Refused attempts are passed to refused, to audit them.
+func (rules Rules) Repository(repository distribution.Repository, ip net.IP, refused func(ctx context.Context, err distribution.ErrTagProtected, desc distribution.Descriptor)) distribution.Repository {
+	return &protectedRepository{
+		Repository: repository,
+		rules:      rules,
+		ip:         ip,
+		refused:    refused,
+	}
+}
+
+type protectedRepository struct {
+	distribution.Repository
+	rules   Rules
+	ip      net.IP
+	refused func(ctx context.Context, err distribution.ErrTagProtected, desc distribution.Descriptor)
+}
+
+func (pr *protectedRepository) Tags(ctx context.Context) distribution.TagService {
+	return &protectedTagService{
+		TagService: pr.Repository.Tags(ctx),
+		repository: pr,
+	}
+}
+
+type protectedTagService struct {
+	distribution.TagService
+	repository *protectedRepository
+}
+
+// Tag refuses to create or move a protected tag, unless a rule permits the
+// client. Pushing the tag again to the manifest it points at neither
+// creates nor moves it.
+func (ts *protectedTagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+	pr := ts.repository
+	err := pr.rules.Check(pr.Named().Name(), tag, pr.ip, auth.GrantedAccess(ctx))
+	if err != nil {
+		current, getErr := ts.TagService.Get(ctx, tag)
+		if getErr != nil || current.Digest != desc.Digest {
+			if pr.refused != nil {
+				pr.refused(ctx, err.(distribution.ErrTagProtected), desc)
+			}
+			return err
+		}
+	}
+	return ts.TagService.Tag(ctx, tag, desc)
+}
@@ -0,0 +1,137 @@
+package tagprotection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestCheck(t *testing.T) {
+	rules, err := New([]configuration.TagProtectionRule{
+		{
+			Repositories: []string{"release/.*"},
+			Tags:         []string{"v*", "release-*"},
+			Scopes:       []string{"repository:*:release", "registry:catalog:*"},
+			Allow:        []string{"10.0.0.0/8"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error parsing rules: %v", err)
+	}
+
+	release := []auth.Access{{Resource: auth.Resource{Type: "repository", Name: "release/app"}, Action: "release"}}
+	otherRelease := []auth.Access{{Resource: auth.Resource{Type: "repository", Name: "release/other"}, Action: "release"}}
+	push := []auth.Access{{Resource: auth.Resource{Type: "repository", Name: "release/app"}, Action: "push"}}
+	catalog := []auth.Access{{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Action: "*"}}
+
+	for _, tc := range []struct {
+		name, tag, ip string
+		granted       []auth.Access
+		protected     bool
+	}{
+		{"release/app", "latest", "", push, false},
+		{"release/app", "v1.0", "", push, true},
+		{"release/app", "release-2024", "203.0.113.1", nil, true},
+		{"release/app", "v1.0", "", release, false},
+		{"release/app", "v1.0", "", otherRelease, true},
+		{"release/app", "v1.0", "", catalog, false},
+		{"release/app", "v1.0", "10.1.2.3", push, false},
+		{"dev/app", "v1.0", "", push, false},
+		{"release", "v1.0", "", push, false},
+	} {
+		err := rules.Check(tc.name, tc.tag, net.ParseIP(tc.ip), tc.granted)
+		if protected := err != nil; protected != tc.protected {
+			t.Errorf("Check(%q, %q, %q, %v) = %v, expected protected %v", tc.name, tc.tag, tc.ip, tc.granted, err, tc.protected)
+		}
+		var tagErr distribution.ErrTagProtected
+		if err != nil && !errors.As(err, &tagErr) {
+			t.Errorf("unexpected error type %T", err)
+		}
+	}
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	named, err := reference.WithName("release/app")
+	if err != nil {
+		t.Fatalf("invalid name: %v", err)
+	}
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("failed to get repository: %v", err)
+	}
+
+	rules, err := New([]configuration.TagProtectionRule{{Tags: []string{"v*"}, Scopes: []string{"repository:*:release"}}})
+	if err != nil {
+		t.Fatalf("unexpected error parsing rules: %v", err)
+	}
+	var refused []distribution.ErrTagProtected
+	protected := rules.Repository(repository, nil, func(ctx context.Context, err distribution.ErrTagProtected, desc distribution.Descriptor) {
+		refused = append(refused, err)
+	})
+
+	first := distribution.Descriptor{Digest: digest.FromString("first")}
+	second := distribution.Descriptor{Digest: digest.FromString("second")}
+
+	if err := protected.Tags(ctx).Tag(ctx, "latest", first); err != nil {
+		t.Fatalf("unexpected error tagging an unprotected tag: %v", err)
+	}
+	if err := protected.Tags(ctx).Tag(ctx, "v1", first); !errors.As(err, &distribution.ErrTagProtected{}) {
+		t.Fatalf("expected the tag to be protected, got %v", err)
+	}
+	if len(refused) != 1 || refused[0].Tag != "v1" || refused[0].Pattern != "v*" {
+		t.Fatalf("unexpected refused attempts: %+v", refused)
+	}
+
+	releaseCtx := auth.WithAccess(ctx, []auth.Access{{Resource: auth.Resource{Type: "repository", Name: "release/app"}, Action: "release"}})
+	if err := protected.Tags(releaseCtx).Tag(releaseCtx, "v1", first); err != nil {
+		t.Fatalf("unexpected error tagging with the release scope: %v", err)
+	}
+
+	// Pushing the tag again to the same manifest neither creates nor moves
+	// it, while moving it to another manifest is refused.
+	if err := protected.Tags(ctx).Tag(ctx, "v1", first); err != nil {
+		t.Fatalf("unexpected error tagging the same manifest again: %v", err)
+	}
+	if err := protected.Tags(ctx).Tag(ctx, "v1", second); !errors.As(err, &distribution.ErrTagProtected{}) {
+		t.Fatalf("expected the tag move to be refused, got %v", err)
+	}
+	desc, err := repository.Tags(ctx).Get(ctx, "v1")
+	if err != nil {
+		t.Fatalf("failed to get tag: %v", err)
+	}
+	if desc.Digest != first.Digest {
+		t.Fatalf("protected tag moved to %s", desc.Digest)
+	}
+	if len(refused) != 2 {
+		t.Fatalf("unexpected refused attempts: %+v", refused)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, config := range []configuration.TagProtectionRule{
+		{},
+		{Tags: []string{"["}},
+		{Tags: []string{"v*"}, Repositories: []string{"("}},
+		{Tags: []string{"v*"}, Scopes: []string{"repository:release"}},
+		{Tags: []string{"v*"}, Scopes: []string{"repository::push"}},
+		{Tags: []string{"v*"}, Allow: []string{"10.0.0.0/33"}},
+	} {
+		if _, err := New([]configuration.TagProtectionRule{config}); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
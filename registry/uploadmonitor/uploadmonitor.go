@@ -0,0 +1,274 @@
+// Package uploadmonitor periodically scans the uploads in progress, as
+// configured under uploadmonitor, so that uploads stranded by failed or
+// abandoned pushes show up in the metrics and alerts before they fill the
+// storage.
+package uploadmonitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/docker/go-metrics"
+)
+
+const (
+	defaultInterval = 10 * time.Minute
+	defaultTimeout  = 30 * time.Second
+)
+
+// ages are the bounds of the age distribution of the uploads reported in
+// the metrics, by label.
+var ages = []struct {
+	label string
+	age   time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+	{"168h", 7 * 24 * time.Hour},
+}
+
+var (
+	inProgress = prometheus.UploadsNamespace.NewLabeledGauge("in_progress", "The number of uploads in progress in a repository", metrics.Total, "repository")
+	olderThan  = prometheus.UploadsNamespace.NewLabeledGauge("older_than", "The number of uploads of a repository in progress for longer than the age", metrics.Total, "repository", "age")
+	oldestAge  = prometheus.UploadsNamespace.NewLabeledGauge("oldest_age", "How long the oldest upload of a repository has been in progress", metrics.Seconds, "repository")
+)
+
+func init() {
+	metrics.Register(prometheus.UploadsNamespace)
+}
+
+// RepositoryUploads summarizes the uploads in progress in a repository.
+type RepositoryUploads struct {
+	Repository string `json:"repository"`
+	// Uploads is the number of uploads in progress.
+	Uploads int `json:"uploads"`
+	// OldestStartedAt is when the oldest upload started. It is zero if the
+	// start of none of the uploads is known.
+	OldestStartedAt time.Time `json:"oldestStartedAt"`
+
+	// olderThan counts the uploads older than each of ages.
+	olderThan []int
+}
+
+// Alert is the document posted to the alert endpoint.
+type Alert struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Repositories lists the repositories exceeding the thresholds,
+	// ordered by name.
+	Repositories []RepositoryUploads `json:"repositories"`
+}
+
+// Monitor periodically scans the uploads in progress.
+type Monitor struct {
+	config configuration.UploadMonitor
+	driver driver.StorageDriver
+	client *http.Client
+
+	mu sync.Mutex
+	// reported are the repositories reported in the metrics by the last
+	// scan, whose gauges are reset once they have no upload left.
+	reported map[string]struct{}
+	// alerted are the repositories exceeding the thresholds the endpoint
+	// was last alerted of.
+	alerted map[string]struct{}
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a monitor scanning the uploads of storageDriver.
+func New(storageDriver driver.StorageDriver, config configuration.UploadMonitor) *Monitor {
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+	if config.Alert.Timeout <= 0 {
+		config.Alert.Timeout = defaultTimeout
+	}
+	return &Monitor{
+		config:   config,
+		driver:   storageDriver,
+		client:   &http.Client{Timeout: config.Alert.Timeout},
+		reported: make(map[string]struct{}),
+		alerted:  make(map[string]struct{}),
+	}
+}
+
+// Start scans the uploads every configured interval until Close is called.
+func (m *Monitor) Start(ctx context.Context) {
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.config.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := m.Scan(ctx); err != nil {
+				dcontext.GetLogger(ctx).Errorf("uploadmonitor: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the periodic scans started by Start.
+func (m *Monitor) Close() {
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+		m.stop = nil
+	}
+}
+
+// Scan reports the uploads in progress in the metrics, alerts the endpoint
+// if a repository newly exceeds the thresholds, and returns the uploads of
+// each repository, ordered by name. Repositories keep exceeding the
+// thresholds without further alerts until they recover; if the alert
+// cannot be posted, it is retried by the next scan.
+func (m *Monitor) Scan(ctx context.Context) ([]RepositoryUploads, error) {
+	uploads, errs := storage.OutstandingUploads(ctx, m.driver)
+	for _, err := range errs {
+		dcontext.GetLogger(ctx).Warnf("uploadmonitor: error walking uploads: %v", err)
+	}
+
+	now := time.Now()
+	byRepository := make(map[string]*RepositoryUploads)
+	for _, upload := range uploads {
+		ru, ok := byRepository[upload.Repository]
+		if !ok {
+			ru = &RepositoryUploads{Repository: upload.Repository, olderThan: make([]int, len(ages))}
+			byRepository[upload.Repository] = ru
+		}
+		ru.Uploads++
+		if upload.StartedAt.IsZero() {
+			continue
+		}
+		if ru.OldestStartedAt.IsZero() || upload.StartedAt.Before(ru.OldestStartedAt) {
+			ru.OldestStartedAt = upload.StartedAt
+		}
+		for i, a := range ages {
+			if now.Sub(upload.StartedAt) > a.age {
+				ru.olderThan[i]++
+			}
+		}
+	}
+
+	repositories := make([]RepositoryUploads, 0, len(byRepository))
+	for _, ru := range byRepository {
+		repositories = append(repositories, *ru)
+	}
+	sort.Slice(repositories, func(i, j int) bool {
+		return repositories[i].Repository < repositories[j].Repository
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observe(repositories, now)
+	return repositories, m.alert(ctx, repositories, now)
+}
+
+// observe sets the gauges of the repositories with uploads, and resets those
+// of the repositories which no longer have any.
+func (m *Monitor) observe(repositories []RepositoryUploads, now time.Time) {
+	reported := make(map[string]struct{}, len(repositories))
+	for _, ru := range repositories {
+		reported[ru.Repository] = struct{}{}
+		inProgress.WithValues(ru.Repository).Set(float64(ru.Uploads))
+		for i, a := range ages {
+			olderThan.WithValues(ru.Repository, a.label).Set(float64(ru.olderThan[i]))
+		}
+		var age time.Duration
+		if !ru.OldestStartedAt.IsZero() {
+			age = now.Sub(ru.OldestStartedAt)
+		}
+		oldestAge.WithValues(ru.Repository).Set(age.Seconds())
+	}
+	for repoName := range m.reported {
+		if _, ok := reported[repoName]; ok {
+			continue
+		}
+		inProgress.WithValues(repoName).Set(0)
+		for _, a := range ages {
+			olderThan.WithValues(repoName, a.label).Set(0)
+		}
+		oldestAge.WithValues(repoName).Set(0)
+	}
+	m.reported = reported
+}
+
+// exceeds returns true if the uploads of a repository exceed a threshold.
+func (m *Monitor) exceeds(ru RepositoryUploads, now time.Time) bool {
+	alert := m.config.Alert
+	if alert.MaxUploads > 0 && ru.Uploads > alert.MaxUploads {
+		return true
+	}
+	return alert.MaxAge > 0 && !ru.OldestStartedAt.IsZero() && now.Sub(ru.OldestStartedAt) > alert.MaxAge
+}
+
+// alert posts the repositories exceeding the thresholds to the endpoint if
+// any of them was not part of the last alert.
+func (m *Monitor) alert(ctx context.Context, repositories []RepositoryUploads, now time.Time) error {
+	if m.config.Alert.URL == "" {
+		return nil
+	}
+	exceeding := make(map[string]struct{})
+	report := Alert{Timestamp: now.UTC(), Repositories: []RepositoryUploads{}}
+	newlyExceeding := false
+	for _, ru := range repositories {
+		if !m.exceeds(ru, now) {
+			continue
+		}
+		exceeding[ru.Repository] = struct{}{}
+		report.Repositories = append(report.Repositories, ru)
+		if _, ok := m.alerted[ru.Repository]; !ok {
+			newlyExceeding = true
+		}
+	}
+	if newlyExceeding {
+		if err := m.post(ctx, report); err != nil {
+			return err
+		}
+	}
+	m.alerted = exceeding
+	return nil
+}
+
+func (m *Monitor) post(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.Alert.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range m.config.Alert.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting alert: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert endpoint %s returned %s", m.config.Alert.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package uploadmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/uuid"
+)
+
+// addUpload stores an upload to the named repository which started at
+// startedAt, and returns its directory.
+func addUpload(t *testing.T, d driver.StorageDriver, repoName string, startedAt time.Time) string {
+	ctx := context.Background()
+	uploadDir := path.Join("/docker/registry/v2/repositories", repoName, "_uploads", uuid.Generate().String())
+	if err := d.PutContent(ctx, path.Join(uploadDir, "startedat"), []byte(startedAt.Format(time.RFC3339))); err != nil {
+		t.Fatalf("error writing upload: %v", err)
+	}
+	if err := d.PutContent(ctx, path.Join(uploadDir, "data"), []byte("partial")); err != nil {
+		t.Fatalf("error writing upload: %v", err)
+	}
+	return uploadDir
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	alerts := make(chan Alert, 10)
+	status := http.StatusOK
+	alertServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("missing configured header: %v", r.Header)
+		}
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("error decoding alert: %v", err)
+		}
+		alerts <- alert
+		w.WriteHeader(status)
+	}))
+	defer alertServer.Close()
+
+	d := inmemory.New()
+	now := time.Now()
+	stranded := addUpload(t, d, "team-a/app", now.Add(-48*time.Hour))
+	addUpload(t, d, "team-a/app", now)
+	addUpload(t, d, "team-b/app", now)
+
+	monitor := New(d, configuration.UploadMonitor{
+		Enabled: true,
+		Alert: configuration.UploadAlert{
+			URL:     alertServer.URL,
+			Headers: http.Header{"Authorization": []string{"Bearer secret"}},
+			MaxAge:  24 * time.Hour,
+		},
+	})
+	expectAlert := func(msg string, repositories ...string) {
+		t.Helper()
+		if len(repositories) == 0 {
+			select {
+			case alert := <-alerts:
+				t.Fatalf("%s: unexpected alert: %+v", msg, alert)
+			default:
+				return
+			}
+		}
+		select {
+		case alert := <-alerts:
+			if len(alert.Repositories) != len(repositories) {
+				t.Fatalf("%s: unexpected alert: %+v", msg, alert)
+			}
+			for i, ru := range alert.Repositories {
+				if ru.Repository != repositories[i] {
+					t.Fatalf("%s: unexpected alert: %+v", msg, alert)
+				}
+			}
+		default:
+			t.Fatalf("%s: no alert", msg)
+		}
+	}
+
+	repositories, err := monitor.Scan(ctx)
+	if err != nil {
+		t.Fatalf("error scanning uploads: %v", err)
+	}
+	if len(repositories) != 2 {
+		t.Fatalf("unexpected repositories: %+v", repositories)
+	}
+	teamA, teamB := repositories[0], repositories[1]
+	if teamA.Repository != "team-a/app" || teamA.Uploads != 2 || teamA.OldestStartedAt.Unix() != now.Add(-48*time.Hour).Unix() {
+		t.Errorf("unexpected uploads of team-a/app: %+v", teamA)
+	}
+	if teamA.olderThan[0] != 1 || teamA.olderThan[1] != 1 || teamA.olderThan[2] != 0 {
+		t.Errorf("unexpected age distribution of team-a/app: %v", teamA.olderThan)
+	}
+	if teamB.Repository != "team-b/app" || teamB.Uploads != 1 {
+		t.Errorf("unexpected uploads of team-b/app: %+v", teamB)
+	}
+	expectAlert("first scan", "team-a/app")
+
+	if _, err := monitor.Scan(ctx); err != nil {
+		t.Fatalf("error scanning uploads: %v", err)
+	}
+	expectAlert("repository still exceeding the thresholds")
+
+	// Repositories are alerted of again once they recover, and alerts
+	// which could not be posted are retried.
+	if err := d.Delete(ctx, stranded); err != nil {
+		t.Fatalf("error deleting upload: %v", err)
+	}
+	if _, err := monitor.Scan(ctx); err != nil {
+		t.Fatalf("error scanning uploads: %v", err)
+	}
+	expectAlert("repository recovered")
+
+	addUpload(t, d, "team-b/app", now.Add(-25*time.Hour))
+	status = http.StatusInternalServerError
+	if _, err := monitor.Scan(ctx); err == nil {
+		t.Fatal("expected an error posting the alert")
+	}
+	expectAlert("failed alert", "team-b/app")
+	status = http.StatusOK
+	if _, err := monitor.Scan(ctx); err != nil {
+		t.Fatalf("error scanning uploads: %v", err)
+	}
+	expectAlert("retried alert", "team-b/app")
+}
+
+func TestScanMaxUploads(t *testing.T) {
+	ctx := context.Background()
+	alerts := make(chan Alert, 10)
+	alertServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("error decoding alert: %v", err)
+		}
+		alerts <- alert
+	}))
+	defer alertServer.Close()
+
+	d := inmemory.New()
+	for i := 0; i < 3; i++ {
+		addUpload(t, d, "busy", time.Now())
+	}
+	addUpload(t, d, "quiet", time.Now())
+
+	monitor := New(d, configuration.UploadMonitor{
+		Enabled: true,
+		Alert:   configuration.UploadAlert{URL: alertServer.URL, MaxUploads: 2},
+	})
+	if _, err := monitor.Scan(ctx); err != nil {
+		t.Fatalf("error scanning uploads: %v", err)
+	}
+	select {
+	case alert := <-alerts:
+		if len(alert.Repositories) != 1 || alert.Repositories[0].Repository != "busy" || alert.Repositories[0].Uploads != 3 {
+			t.Fatalf("unexpected alert: %+v", alert)
+		}
+	default:
+		t.Fatal("no alert")
+	}
+}
@@ -0,0 +1,331 @@
+// Package usage records the per-namespace usage of the registry and
+// periodically posts it to the endpoint configured under usage, so that
+// billing and chargeback systems do not need to scrape metrics.
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultInterval = time.Hour
+	defaultTimeout  = 30 * time.Second
+)
+
+// Report is the document posted to the usage endpoint.
+type Report struct {
+	// Start and End delimit the period the egress and request counts
+	// cover.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Namespaces lists the usage of each namespace, ordered by name.
+	Namespaces []NamespaceUsage `json:"namespaces"`
+}
+
+// NamespaceUsage is the usage of the repositories of a namespace.
+type NamespaceUsage struct {
+	Namespace string `json:"namespace"`
+
+	// StorageBytes is the size of the blobs linked to the repositories of
+	// the namespace at the end of the period, counting blobs shared between
+	// them once.
+	StorageBytes int64 `json:"storageBytes"`
+
+	// EgressBytes is the number of bytes of blobs served during the period.
+	EgressBytes int64 `json:"egressBytes"`
+
+	// Requests is the number of API requests made during the period.
+	Requests int64 `json:"requests"`
+}
+
+// counters accumulate the traffic of a namespace.
+type counters struct {
+	egressBytes int64
+	requests    int64
+}
+
+// Exporter records the traffic of each namespace and periodically posts
+// usage reports.
+type Exporter struct {
+	config   configuration.Usage
+	registry distribution.Namespace
+	client   *http.Client
+
+	mu       sync.Mutex
+	start    time.Time
+	counters map[string]*counters
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewExporter returns an exporter computing storage usage from the given
+// registry, which must implement distribution.RepositoryEnumerator.
+func NewExporter(registry distribution.Namespace, config configuration.Usage) *Exporter {
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.NamespaceDepth <= 0 {
+		config.NamespaceDepth = 1
+	}
+
+	return &Exporter{
+		config:   config,
+		registry: registry,
+		client:   &http.Client{Timeout: config.Timeout},
+		start:    time.Now(),
+		counters: make(map[string]*counters),
+	}
+}
+
+// Namespace returns the namespace of a repository: the first depth
+// components of its name.
+func Namespace(repoName string, depth int) string {
+	components := strings.SplitN(repoName, "/", depth+1)
+	if len(components) > depth {
+		components = components[:depth]
+	}
+	return strings.Join(components, "/")
+}
+
+// Record accounts for a request to a repository which served egressBytes
+// bytes of blob content.
+func (e *Exporter) Record(repoName string, egressBytes int64) {
+	namespace := Namespace(repoName, e.config.NamespaceDepth)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.counters[namespace]
+	if !ok {
+		c = &counters{}
+		e.counters[namespace] = c
+	}
+	c.requests++
+	c.egressBytes += egressBytes
+}
+
+// Start posts a report every configured interval until Close is called.
+func (e *Exporter) Start(ctx context.Context) {
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.Export(ctx); err != nil {
+					dcontext.GetLogger(ctx).Errorf("usage: %v", err)
+				}
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the periodic reports started by Start, and posts a last
+// report so that the traffic recorded since the previous one is not lost.
+func (e *Exporter) Close(ctx context.Context) error {
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+		e.stop = nil
+	}
+	return e.Export(ctx)
+}
+
+// Export computes a report and posts it to the endpoint. If the post fails,
+// the traffic of the period is carried over to the next report.
+func (e *Exporter) Export(ctx context.Context) error {
+	storageBytes, err := e.storageUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	report := Report{Start: e.start, End: time.Now()}
+	period := e.counters
+	e.start, e.counters = report.End, make(map[string]*counters)
+	e.mu.Unlock()
+
+	namespaces := make(map[string]*NamespaceUsage)
+	namespaceUsage := func(namespace string) *NamespaceUsage {
+		u, ok := namespaces[namespace]
+		if !ok {
+			u = &NamespaceUsage{Namespace: namespace}
+			namespaces[namespace] = u
+		}
+		return u
+	}
+	for namespace, size := range storageBytes {
+		namespaceUsage(namespace).StorageBytes = size
+	}
+	for namespace, c := range period {
+		u := namespaceUsage(namespace)
+		u.EgressBytes = c.egressBytes
+		u.Requests = c.requests
+	}
+	for _, u := range namespaces {
+		report.Namespaces = append(report.Namespaces, *u)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+
+	if err := e.post(ctx, report); err != nil {
+		e.restore(report.Start, period)
+		return err
+	}
+	return nil
+}
+
+// restore merges the traffic of a report which could not be posted back
+// into the current period.
+func (e *Exporter) restore(start time.Time, period map[string]*counters) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.start = start
+	for namespace, c := range period {
+		current, ok := e.counters[namespace]
+		if !ok {
+			e.counters[namespace] = c
+			continue
+		}
+		current.egressBytes += c.egressBytes
+		current.requests += c.requests
+	}
+}
+
+func (e *Exporter) post(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range e.config.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting usage report: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("usage endpoint %s returned %s", e.config.URL, resp.Status)
+	}
+	return nil
+}
+
+// storageUsage returns the size of the blobs linked to the repositories of
+// each namespace.
+func (e *Exporter) storageUsage(ctx context.Context) (map[string]int64, error) {
+	repositoryEnumerator, ok := e.registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	linked := make(map[string]map[digest.Digest]struct{})
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := e.registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+
+		namespace := Namespace(repoName, e.config.NamespaceDepth)
+		digests, ok := linked[namespace]
+		if !ok {
+			digests = make(map[digest.Digest]struct{})
+			linked[namespace] = digests
+		}
+		ingest := func(dgst digest.Digest) error {
+			digests[dgst] = struct{}{}
+			return nil
+		}
+
+		blobEnumerator, ok := repository.Blobs(ctx).(distribution.BlobEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert BlobStore into BlobEnumerator")
+		}
+		if err := blobEnumerator.Enumerate(ctx, ingest); err != nil {
+			if !errors.Is(err, driver.ErrNotFound) {
+				return fmt.Errorf("failed to enumerate blobs of %s: %v", repoName, err)
+			}
+		}
+
+		manifestService, err := repository.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+		if err := manifestEnumerator.Enumerate(ctx, ingest); err != nil {
+			if !errors.Is(err, driver.ErrNotFound) {
+				return fmt.Errorf("failed to enumerate manifests of %s: %v", repoName, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, driver.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	statter := e.registry.BlobStatter()
+	sizes := make(map[digest.Digest]int64)
+	storageBytes := make(map[string]int64)
+	for namespace, digests := range linked {
+		for dgst := range digests {
+			size, ok := sizes[dgst]
+			if !ok {
+				desc, err := statter.Stat(ctx, dgst)
+				if err != nil {
+					if err == distribution.ErrBlobUnknown {
+						continue
+					}
+					return nil, fmt.Errorf("failed to stat blob %s: %v", dgst, err)
+				}
+				size = desc.Size
+				sizes[dgst] = size
+			}
+			storageBytes[namespace] += size
+		}
+	}
+	return storageBytes, nil
+}
@@ -0,0 +1,148 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		repoName string
+		depth    int
+		expected string
+	}{
+		{"foo", 1, "foo"},
+		{"foo/bar", 1, "foo"},
+		{"foo/bar/baz", 1, "foo"},
+		{"foo/bar/baz", 2, "foo/bar"},
+		{"foo/bar", 3, "foo/bar"},
+	} {
+		if namespace := Namespace(tc.repoName, tc.depth); namespace != tc.expected {
+			t.Errorf("Namespace(%q, %d) = %q, expected %q", tc.repoName, tc.depth, namespace, tc.expected)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	// The same image is pushed twice to team-a and once to team-b, so both
+	// namespaces store the same bytes.
+	layers, err := testutil.CreateRandomLayers(2)
+	if err != nil {
+		t.Fatalf("error creating layers: %v", err)
+	}
+	var layerDigests []digest.Digest
+	for dgst := range layers {
+		layerDigests = append(layerDigests, dgst)
+	}
+	for _, name := range []string{"team-a/app", "team-a/lib", "team-b/app"} {
+		named, err := reference.WithName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			t.Fatalf("error creating repository: %v", err)
+		}
+		for _, rs := range layers {
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := testutil.UploadBlobs(repo, layers); err != nil {
+			t.Fatalf("error uploading layers: %v", err)
+		}
+		manifest, err := testutil.MakeSchema2Manifest(repo, layerDigests)
+		if err != nil {
+			t.Fatalf("error creating manifest: %v", err)
+		}
+		manifests, err := repo.Manifests(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := manifests.Put(ctx, manifest); err != nil {
+			t.Fatalf("error putting manifest: %v", err)
+		}
+	}
+
+	var reports []Report
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("missing configured header")
+		}
+		var report Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("error decoding report: %v", err)
+		}
+		reports = append(reports, report)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	exporter := NewExporter(registry, configuration.Usage{
+		URL:     server.URL,
+		Headers: http.Header{"Authorization": []string{"Bearer token"}},
+	})
+	exporter.Record("team-a/app", 100)
+	exporter.Record("team-a/lib", 50)
+	exporter.Record("team-b/app", 0)
+
+	// A failed post carries the traffic over to the next report.
+	status = http.StatusServiceUnavailable
+	if err := exporter.Export(ctx); err == nil {
+		t.Fatal("expected an error from a failed post")
+	}
+	status = http.StatusOK
+	exporter.Record("team-b/app", 10)
+	if err := exporter.Export(ctx); err != nil {
+		t.Fatalf("unexpected error exporting: %v", err)
+	}
+
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 reports, got %d", len(reports))
+	}
+	report := reports[1]
+	if !report.Start.Equal(reports[0].Start) {
+		t.Errorf("expected the period to start at %v, got %v", reports[0].Start, report.Start)
+	}
+	if len(report.Namespaces) != 2 {
+		t.Fatalf("expected 2 namespaces, got %v", report.Namespaces)
+	}
+	teamA, teamB := report.Namespaces[0], report.Namespaces[1]
+	if teamA.Namespace != "team-a" || teamA.Requests != 2 || teamA.EgressBytes != 150 {
+		t.Errorf("unexpected usage of team-a: %+v", teamA)
+	}
+	if teamB.Namespace != "team-b" || teamB.Requests != 2 || teamB.EgressBytes != 10 {
+		t.Errorf("unexpected usage of team-b: %+v", teamB)
+	}
+	if teamA.StorageBytes == 0 || teamA.StorageBytes != teamB.StorageBytes {
+		t.Errorf("expected team-a and team-b to store the same bytes, got %d and %d", teamA.StorageBytes, teamB.StorageBytes)
+	}
+
+	// Traffic is reset once reported, storage is not.
+	if err := exporter.Export(ctx); err != nil {
+		t.Fatalf("unexpected error exporting: %v", err)
+	}
+	for _, u := range reports[2].Namespaces {
+		if u.Requests != 0 || u.EgressBytes != 0 || u.StorageBytes != teamB.StorageBytes {
+			t.Errorf("unexpected usage after reset: %+v", u)
+		}
+	}
+}
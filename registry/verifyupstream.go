@@ -0,0 +1,266 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/client"
+	"github.com/distribution/distribution/v3/registry/client/auth"
+	"github.com/distribution/distribution/v3/registry/client/auth/challenge"
+	"github.com/distribution/distribution/v3/registry/client/transport"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upstreamRepository string
+	upstreamUsername   string
+	upstreamPassword   string
+)
+
+// VerifyUpstreamCmd is the cobra command that corresponds to the
+// verify-upstream subcommand
+var VerifyUpstreamCmd = &cobra.Command{
+	Use:   "verify-upstream <config> <repository> <remote URL>",
+	Short: "`verify-upstream` compares the tags of a repository with another registry",
+	Long:  "`verify-upstream` compares the tags of a repository, read from the storage, and the digests they point at with those of the same repository in another registry, reporting the tags which drifted. It exits with status 1 if any did.",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		named, err := reference.WithName(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name %q: %v\n", args[1], err)
+			os.Exit(1)
+		}
+		remoteNamed := named
+		if upstreamRepository != "" {
+			remoteNamed, err = reference.WithName(upstreamRepository)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid remote repository name %q: %v\n", upstreamRepository, err)
+				os.Exit(1)
+			}
+		}
+
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+		local, err := registry.Repository(ctx, named)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct repository: %v", err)
+			os.Exit(1)
+		}
+		remote, err := remoteRepository(ctx, args[2], remoteNamed, upstreamUsername, upstreamPassword)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct remote repository: %v\n", err)
+			os.Exit(1)
+		}
+
+		drift, err := verifyUpstream(ctx, local, remote)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to verify %s against %s: %v\n", named.Name(), args[2], err)
+			os.Exit(1)
+		}
+		printUpstreamDrift(os.Stdout, drift)
+		if len(drift.Tags) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// remoteRepository returns a client of a repository of another registry,
+// authenticating with the given credentials if it asks for them.
+func remoteRepository(ctx context.Context, remoteURL string, named reference.Named, username, password string) (distribution.Repository, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/v2/"
+	manager := challenge.NewSimpleManager()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if err := manager.AddResponse(resp); err != nil {
+		return nil, err
+	}
+
+	creds := upstreamCredentials{username: username, password: password}
+	tokenHandler := auth.NewTokenHandlerWithOptions(auth.TokenHandlerOptions{
+		Transport:   http.DefaultTransport,
+		Credentials: creds,
+		Scopes: []auth.Scope{
+			auth.RepositoryScope{
+				Repository: named.Name(),
+				Actions:    []string{"pull"},
+			},
+		},
+		Logger: dcontext.GetLogger(ctx),
+	})
+	tr := transport.NewTransport(http.DefaultTransport,
+		auth.NewAuthorizer(manager, tokenHandler, auth.NewBasicHandler(creds)))
+	return client.NewRepository(named, remoteURL, tr)
+}
+
+// upstreamCredentials answers every authentication challenge of the remote
+// registry with the same credentials.
+type upstreamCredentials struct {
+	username string
+	password string
+}
+
+func (c upstreamCredentials) Basic(*url.URL) (string, string) {
+	return c.username, c.password
+}
+
+func (c upstreamCredentials) RefreshToken(*url.URL, string) string {
+	return ""
+}
+
+func (c upstreamCredentials) SetRefreshToken(*url.URL, string, string) {
+}
+
+// upstreamDrift lists the tags of a repository which differ from another
+// registry.
+type upstreamDrift struct {
+	// InSync counts the tags pointing at the same digest in both.
+	InSync int
+	Tags   []driftedTag
+}
+
+// driftedTag is a tag which is missing from one of the registries, or
+// points at different digests. A digest is empty where the tag is missing.
+type driftedTag struct {
+	Tag    string
+	Local  digest.Digest
+	Remote digest.Digest
+}
+
+// verifyUpstream compares the tags of a local repository, and the digests
+// they point at, with those of a remote one.
+func verifyUpstream(ctx context.Context, local, remote distribution.Repository) (*upstreamDrift, error) {
+	localTags, err := tagDigests(ctx, local.Tags(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local tags: %v", err)
+	}
+	remoteTags, err := tagDigests(ctx, remote.Tags(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote tags: %v", err)
+	}
+
+	tags := make([]string, 0, len(localTags)+len(remoteTags))
+	for tag := range localTags {
+		tags = append(tags, tag)
+	}
+	for tag := range remoteTags {
+		if _, ok := localTags[tag]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	drift := &upstreamDrift{}
+	for _, tag := range tags {
+		if localTags[tag] == remoteTags[tag] {
+			drift.InSync++
+			continue
+		}
+		drift.Tags = append(drift.Tags, driftedTag{Tag: tag, Local: localTags[tag], Remote: remoteTags[tag]})
+	}
+	return drift, nil
+}
+
+// tagDigests returns the digests the tags of a repository point at. A
+// repository which does not exist has no tags.
+func tagDigests(ctx context.Context, tagService distribution.TagService) (map[string]digest.Digest, error) {
+	tags, err := tagService.All(ctx)
+	if err != nil && !isRepositoryUnknown(err) {
+		return nil, err
+	}
+	digests := make(map[string]digest.Digest, len(tags))
+	for _, tag := range tags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			// The tag may have been deleted since it was listed.
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return nil, fmt.Errorf("failed to resolve tag %s: %v", tag, err)
+		}
+		digests[tag] = desc.Digest
+	}
+	return digests, nil
+}
+
+// isRepositoryUnknown reports whether err means that a repository does not
+// exist, in the storage or in a remote registry.
+func isRepositoryUnknown(err error) bool {
+	switch err := err.(type) {
+	case distribution.ErrRepositoryUnknown:
+		return true
+	case errcode.Errors:
+		for _, e := range err {
+			if e, ok := e.(errcode.Error); ok && e.Code == v2.ErrorCodeNameUnknown {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func printUpstreamDrift(w io.Writer, drift *upstreamDrift) {
+	if len(drift.Tags) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "TAG\tLOCAL\tREMOTE")
+		for _, tag := range drift.Tags {
+			local, remote := "-", "-"
+			if tag.Local != "" {
+				local = tag.Local.String()
+			}
+			if tag.Remote != "" {
+				remote = tag.Remote.String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", tag.Tag, local, remote)
+		}
+		tw.Flush()
+	}
+	fmt.Fprintf(w, "%d tags in sync, %d drifted\n", drift.InSync, len(drift.Tags))
+}
@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestVerifyUpstream(t *testing.T) {
+	ctx := context.Background()
+	named, _ := reference.WithName("foo/verified")
+	newRepository := func() distribution.Repository {
+		registry, err := storage.NewRegistry(ctx, inmemory.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repository
+	}
+	push := func(repository distribution.Repository, config string, tags ...string) digest.Digest {
+		manifests, err := repository.Manifests(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := ocischema.NewManifestBuilder(repository.Blobs(ctx), []byte(config), nil, nil).Build(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := manifests.Put(ctx, manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range tags {
+			if err := repository.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dgst
+	}
+
+	local, remote := newRepository(), newRepository()
+	empty, err := verifyUpstream(ctx, local, remote)
+	if err != nil {
+		t.Fatalf("failed to verify empty repositories: %v", err)
+	}
+	if empty.InSync != 0 || len(empty.Tags) != 0 {
+		t.Fatalf("unexpected drift %+v of empty repositories", empty)
+	}
+
+	v1 := push(local, `{"v":1}`, "v1", "local")
+	push(remote, `{"v":1}`, "v1", "remote")
+	stale := push(local, `{"v":2}`, "latest")
+	current := push(remote, `{"v":3}`, "latest")
+
+	drift, err := verifyUpstream(ctx, local, remote)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	expected := []driftedTag{
+		{Tag: "latest", Local: stale, Remote: current},
+		{Tag: "local", Local: v1},
+		{Tag: "remote", Remote: v1},
+	}
+	if drift.InSync != 1 || !reflect.DeepEqual(drift.Tags, expected) {
+		t.Fatalf("unexpected drift %+v, expected %+v", drift, expected)
+	}
+
+	var out bytes.Buffer
+	printUpstreamDrift(&out, drift)
+	if !strings.Contains(out.String(), "1 tags in sync, 3 drifted") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	if !isRepositoryUnknown(errcode.Errors{v2.ErrorCodeNameUnknown.WithDetail(nil)}) {
+		t.Fatal("expected an unknown remote repository to be recognized")
+	}
+}
@@ -0,0 +1,152 @@
+// Package watchdog logs the requests which run for longer than a threshold,
+// with the storage operation they are waiting for and a snapshot of the
+// stacks of the goroutines of the registry, so that requests hung on a
+// storage backend can be diagnosed from the logs alone.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+)
+
+// maxStackSize bounds the size of the goroutine stack snapshots.
+const maxStackSize = 1 << 20
+
+// Watchdog watches requests, logging those which run for longer than its
+// threshold.
+type Watchdog struct {
+	threshold time.Duration
+
+	mu sync.Mutex
+	// lastSnapshot is when the stacks were last logged, so that a burst
+	// of stuck requests logs them once per threshold.
+	lastSnapshot time.Time
+}
+
+// New returns a Watchdog logging the requests which run for longer than
+// threshold.
+func New(threshold time.Duration) *Watchdog {
+	return &Watchdog{threshold: threshold}
+}
+
+// Request describes a watched request.
+type Request struct {
+	// Route is the name of the route of the request.
+	Route string
+
+	// Repository is the name of the repository of the request, if any.
+	Repository string
+
+	// Digest is the digest or tag of the request, if any.
+	Digest string
+
+	start time.Time
+
+	mu sync.Mutex
+	// operation is the storage operation the request is waiting for.
+	operation string
+	stuck     bool
+}
+
+type requestKey struct{}
+
+// Watch watches req, returning a context recording its storage operations
+// and a function to call once it is served. The request is logged if it is
+// not served within the threshold.
+func (w *Watchdog) Watch(ctx context.Context, req *Request) (context.Context, func()) {
+	req.start = time.Now()
+	ctx = context.WithValue(ctx, requestKey{}, req)
+	timer := time.AfterFunc(w.threshold, func() {
+		w.stuck(ctx, req)
+	})
+
+	return ctx, func() {
+		timer.Stop()
+		req.mu.Lock()
+		stuck := req.stuck
+		req.mu.Unlock()
+		if stuck {
+			dcontext.GetLoggerWithFields(ctx, req.fields()).Warnf("stuck request completed after %v", time.Since(req.start))
+		}
+	}
+}
+
+// stuck logs a request which has not been served within the threshold.
+func (w *Watchdog) stuck(ctx context.Context, req *Request) {
+	req.mu.Lock()
+	req.stuck = true
+	req.mu.Unlock()
+
+	logger := dcontext.GetLoggerWithFields(ctx, req.fields())
+	stacks, ok := w.snapshot()
+	if !ok {
+		logger.Warnf("request running for more than %v, goroutine stacks were logged recently", w.threshold)
+		return
+	}
+	logger.Warnf("request running for more than %v, goroutine stacks:\n%s", w.threshold, stacks)
+}
+
+// snapshot returns the stacks of the goroutines of the registry, unless
+// they were returned less than a threshold ago.
+func (w *Watchdog) snapshot() ([]byte, bool) {
+	w.mu.Lock()
+	now := time.Now()
+	if now.Sub(w.lastSnapshot) < w.threshold {
+		w.mu.Unlock()
+		return nil, false
+	}
+	w.lastSnapshot = now
+	w.mu.Unlock()
+
+	buf := make([]byte, maxStackSize)
+	return buf[:runtime.Stack(buf, true)], true
+}
+
+// fields returns the fields describing the request in its logs.
+func (req *Request) fields() map[interface{}]interface{} {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+
+	operation := req.operation
+	if operation == "" {
+		operation = "none"
+	}
+	fields := map[interface{}]interface{}{
+		"watchdog.route":     req.Route,
+		"watchdog.elapsed":   time.Since(req.start).String(),
+		"watchdog.operation": operation,
+	}
+	if req.Repository != "" {
+		fields["watchdog.repository"] = req.Repository
+	}
+	if req.Digest != "" {
+		fields["watchdog.digest"] = req.Digest
+	}
+	return fields
+}
+
+// StorageOperation records that the request of ctx, if it is watched, is
+// waiting for the storage operation of the driver on path, returning a
+// function to call once it completes.
+func StorageOperation(ctx context.Context, driver, operation, path string) func() {
+	req, ok := ctx.Value(requestKey{}).(*Request)
+	if !ok {
+		return func() {}
+	}
+
+	req.mu.Lock()
+	previous := req.operation
+	req.operation = fmt.Sprintf("%s.%s(%q)", driver, operation, path)
+	req.mu.Unlock()
+
+	return func() {
+		req.mu.Lock()
+		req.operation = previous
+		req.mu.Unlock()
+	}
+}
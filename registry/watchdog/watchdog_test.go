@@ -0,0 +1,83 @@
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/sirupsen/logrus"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of timers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchStuckRequest(t *testing.T) {
+	var out syncBuffer
+	logger := logrus.New()
+	logger.Out = &out
+	ctx := dcontext.WithLogger(context.Background(), logrus.NewEntry(logger))
+
+	w := New(20 * time.Millisecond)
+
+	// Requests served within the threshold are not logged.
+	_, served := w.Watch(ctx, &Request{Route: "manifest"})
+	served()
+
+	stuckCtx, stuckServed := w.Watch(ctx, &Request{Route: "blob", Repository: "foo/bar", Digest: "sha256:abc"})
+	operationDone := StorageOperation(stuckCtx, "inmemory", "Reader", "/docker/registry/v2/blobs/sha256/ab/abc/data")
+	_, otherServed := w.Watch(ctx, &Request{Route: "tags"})
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "request running for more than") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stuck requests were not logged: %s", out.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	operationDone()
+	stuckServed()
+	otherServed()
+
+	logs := out.String()
+	for _, expected := range []string{
+		"watchdog.route=blob",
+		"watchdog.repository=foo/bar",
+		"watchdog.digest=\"sha256:abc\"",
+		`inmemory.Reader(\"/docker/registry/v2/blobs/sha256/ab/abc/data\")`,
+		"goroutine stacks",
+		"watchdog.TestWatchStuckRequest",
+		"goroutine stacks were logged recently",
+		"watchdog.operation=none",
+		"stuck request completed after",
+	} {
+		if !strings.Contains(logs, expected) {
+			t.Fatalf("missing %q in logs: %s", expected, logs)
+		}
+	}
+	if strings.Contains(logs, "watchdog.route=manifest") {
+		t.Fatalf("unexpected log of a request served in time: %s", logs)
+	}
+}
+
+func TestStorageOperationUnwatched(t *testing.T) {
+	// Operations of requests which are not watched are ignored.
+	StorageOperation(context.Background(), "inmemory", "Stat", "/")()
+}